@@ -0,0 +1,58 @@
+import { NextRequest } from 'next/server';
+
+// The browser calls the store through this route, so the store's API key
+// stays on the server instead of being inlined into the page bundle
+const STORE_API_BASE = process.env.STORE_API_URL || 'http://localhost:8082';
+// The store answers 403 to requests without a key unless ANONYMOUS_SCOPE allows them
+const STORE_API_KEY = process.env.STORE_API_KEY;
+
+// Only the routes the UI uses are passed on, so the key can't reach admin routes
+const ALLOWED_PREFIXES = ['ping', 'messages', 'v1/user', 'v1/conversations', 'v1/profile'];
+
+// Request and response headers passed through as they are
+const REQUEST_HEADERS = ['accept', 'content-type', 'if-match', 'if-none-match'];
+const RESPONSE_HEADERS = ['cache-control', 'content-type', 'etag', 'location'];
+
+export const dynamic = 'force-dynamic';
+
+async function proxy(request: NextRequest, { params }: { params: { path: string[] } }) {
+  const path = params.path.map(encodeURIComponent).join('/');
+  if (!ALLOWED_PREFIXES.some(prefix => path === prefix || path.startsWith(`${prefix}/`))) {
+    return Response.json({ code: 'NOT_FOUND', message: 'not found' }, { status: 404 });
+  }
+
+  const headers = new Headers();
+  for (const name of REQUEST_HEADERS) {
+    const value = request.headers.get(name);
+    if (value) {
+      headers.set(name, value);
+    }
+  }
+  if (STORE_API_KEY) {
+    headers.set('Authorization', `Bearer ${STORE_API_KEY}`);
+  }
+
+  let response: Response;
+  try {
+    response = await fetch(`${STORE_API_BASE}/${path}${request.nextUrl.search}`, {
+      method: request.method,
+      headers,
+      body: request.method === 'GET' || request.method === 'HEAD' ? undefined : await request.arrayBuffer(),
+      cache: 'no-store',
+    });
+  } catch (error: any) {
+    console.error(`Store request ${request.method} /${path} failed:`, error.message);
+    return Response.json({ code: 'BAD_GATEWAY', message: 'SMS Store service is unreachable' }, { status: 502 });
+  }
+
+  const out = new Headers();
+  for (const name of RESPONSE_HEADERS) {
+    const value = response.headers.get(name);
+    if (value) {
+      out.set(name, value);
+    }
+  }
+  return new Response(response.body, { status: response.status, headers: out });
+}
+
+export { proxy as GET, proxy as HEAD, proxy as POST, proxy as PUT, proxy as PATCH, proxy as DELETE };
@@ -1,7 +1,8 @@
 import axios from 'axios';
 
 const SMS_API_BASE = process.env.NEXT_PUBLIC_SMS_API_URL || 'http://localhost:8081/v1';
-const STORE_API_BASE = process.env.NEXT_PUBLIC_STORE_API_URL || 'http://localhost:8082';
+// Store calls go through app/api/store, which adds the server-side STORE_API_KEY
+const STORE_API_BASE = '/api/store';
 
 const smsApi = axios.create({
   baseURL: SMS_API_BASE,
@@ -162,7 +163,8 @@ export const storeApiClient = {
       return messages;
     } catch (error: any) {
       // Network errors
-      if (!error.response) {
+      // The proxy answers 502 when it can't reach the store
+      if (!error.response || error.response.status === 502) {
         console.error(`Network error fetching messages for ${phoneNumber}:`, error.message);
         throw new Error(
           `Network Error: Unable to connect to SMS Store service at ${STORE_API_BASE}. ` +
@@ -196,7 +198,7 @@ export const storeApiClient = {
       return response.data || [];
     } catch (error: any) {
       // Network errors
-      if (!error.response) {
+      if (!error.response || error.response.status === 502) {
         console.error('Network error fetching conversations:', error.message);
         throw new Error(
           `Network Error: Unable to connect to SMS Store service at ${STORE_API_BASE}. ` +
@@ -1,19 +1,48 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
+	_ "time/tzdata" // Daily digests resolve IANA zones even on hosts without zoneinfo
 
+	"sms-store/internal/autoack"
+	"sms-store/internal/exports"
+	"sms-store/internal/growth"
 	"sms-store/internal/httpapi"
+	"sms-store/internal/jobs"
 	"sms-store/internal/kafka"
+	"sms-store/internal/language"
+	"sms-store/internal/migrate"
+	"sms-store/internal/models"
+	"sms-store/internal/mqtt"
+	"sms-store/internal/pricing"
+	"sms-store/internal/redact"
+	"sms-store/internal/scheduler"
+	"sms-store/internal/search"
 	"sms-store/internal/store"
+	"sms-store/internal/version"
+	"sms-store/internal/watchdog"
 )
 
 func main() {
+	// Every log line goes through redaction, masking phone numbers and
+	// message text; REDACTION_DISABLED=true turns it off for local development
+	log.SetOutput(redact.NewWriter(os.Stderr))
+	if getEnv("REDACTION_DISABLED", "false") == "true" {
+		redact.SetEnabled(false)
+		log.Println("Warning: log redaction is disabled; logs may contain phone numbers and message text")
+	}
+
 	// MongoDB connection configuration
 	connectionString := getEnv("MONGODB_URI", "mongodb://localhost:27017")
 	databaseName := getEnv("MONGODB_DATABASE", "sms_store")
@@ -27,6 +56,12 @@ func main() {
 	}
 	log.Println("Successfully connected to MongoDB")
 
+	// Bound the batches and documents of reads decoded into memory at once
+	readLimits := store.DefaultReadLimits()
+	readLimits.BatchSize = getEnvInt("MONGODB_READ_BATCH_SIZE", readLimits.BatchSize)
+	readLimits.MaxDocuments = getEnvInt("MONGODB_READ_MAX_DOCUMENTS", readLimits.MaxDocuments)
+	mongoStore.SetReadLimits(readLimits)
+
 	// Ensure MongoDB connection is closed on shutdown
 	defer func() {
 		log.Println("Closing MongoDB connection...")
@@ -35,56 +70,842 @@ func main() {
 		}
 	}()
 
+	// Reads and idempotent writes failing with a transient MongoDB error,
+	// such as a connection reset, are tried MONGODB_RETRY_ATTEMPTS times in
+	// all, none starting past MONGODB_RETRY_BUDGET; 1 disables retries
+	retryPolicy := store.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = getEnvInt("MONGODB_RETRY_ATTEMPTS", retryPolicy.MaxAttempts)
+	retryPolicy.BaseDelay = getEnvDuration("MONGODB_RETRY_BASE_DELAY", retryPolicy.BaseDelay)
+	retryPolicy.MaxDelay = getEnvDuration("MONGODB_RETRY_MAX_DELAY", retryPolicy.MaxDelay)
+	retryPolicy.Budget = getEnvDuration("MONGODB_RETRY_BUDGET", retryPolicy.Budget)
+
+	// Identical reads of a conversation, its summary or a profile made at
+	// once share one query when READ_COALESCING_ENABLED=true, and their
+	// results answer the same reads for READ_COALESCING_WINDOW after
+	var coalescer *store.Coalescer
+	if getEnv("READ_COALESCING_ENABLED", "false") == "true" {
+		window := getEnvDuration("READ_COALESCING_WINDOW", 100*time.Millisecond)
+		coalescer = store.NewCoalescer(window)
+		log.Printf("Read coalescing enabled (results reused for %v)", window)
+	}
+
+	// Data residency: with DATA_REGIONS_ALLOWED set, messages and profiles
+	// are stamped with their region (DATA_REGION_ACCOUNTS pairs, else
+	// DATA_REGION_DEFAULT) and only those of the allowed regions are served
+	residency, err := store.ParseResidency(
+		getEnv("DATA_REGIONS_ALLOWED", ""),
+		getEnv("DATA_REGION_DEFAULT", ""),
+		getEnv("DATA_REGION_ACCOUNTS", ""),
+	)
+	if err != nil {
+		log.Fatalf("Invalid DATA_REGION_ACCOUNTS: %v", err)
+	}
+	if residency.Enabled() {
+		log.Printf("Data residency enabled (serving regions %s, default %s)", strings.Join(residency.Allowed, ", "), residency.DefaultRegion)
+	}
+
 	// Initialize ProfileStore
 	profileCollectionName := getEnv("MONGODB_PROFILE_COLLECTION", "profiles")
-	profileStore := store.NewMongoProfileStore(
+	mongoProfileStore := store.NewMongoProfileStore(
 		mongoStore.GetClient(),
 		mongoStore.GetDatabaseName(),
 		profileCollectionName,
 	)
+	var profileStore store.ProfileStore = mongoProfileStore
+	if retryPolicy.MaxAttempts > 1 {
+		profileStore = store.NewRetryingProfileStore(profileStore, retryPolicy)
+	}
+	if ttl := getEnvDuration("PROFILE_MISS_CACHE_TTL", 10*time.Second); ttl > 0 {
+		profileStore = store.NewMissCachingProfileStore(profileStore, getEnvInt("PROFILE_MISS_CACHE_SIZE", 10000), ttl)
+	}
+	if coalescer != nil {
+		profileStore = store.NewCoalescingProfileStore(profileStore, coalescer)
+	}
+	if residency.Enabled() {
+		profileStore = store.NewRegionScopedProfileStore(profileStore, residency)
+	}
+	// Every profile change is recorded for PROFILE_HISTORY_RETENTION; 0
+	// keeps the history forever
+	profileHistory := store.NewProfileHistoryRecorder(
+		profileStore,
+		store.NewMongoProfileHistoryStore(
+			mongoStore.GetClient(),
+			mongoStore.GetDatabaseName(),
+			getEnv("MONGODB_PROFILE_HISTORY_COLLECTION", "profile_history"),
+		),
+		getEnvDuration("PROFILE_HISTORY_RETENTION", 90*24*time.Hour),
+	)
+	profileStore = profileHistory
 	log.Println("ProfileStore initialized")
 
+	// Initialize PreferenceStore
+	preferenceStore := store.NewMongoPreferenceStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_PREFERENCES_COLLECTION", "preferences"),
+	)
+
+	// Each account's schema of conversation custom attributes
+	attributeSchemaStore := store.NewMongoAttributeSchemaStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_ATTRIBUTE_SCHEMAS_COLLECTION", "attribute_schemas"),
+	)
+
+	// Read cursors are shared by an account's devices, so marking a
+	// conversation read on one clears its unread count on the others
+	readCursorStore := store.NewMongoReadCursorStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_READ_CURSORS_COLLECTION", "read_cursors"),
+	)
+
+	// Deleting a conversation leaves a tombstone so events for it still
+	// buffered in Kafka can't bring it back
+	tombstoneStore := store.NewMongoTombstoneStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_TOMBSTONES_COLLECTION", "tombstones"),
+	)
+
+	// Read-only conversation share links; only hashes of their tokens are kept
+	shareStore := store.NewMongoShareStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_SHARES_COLLECTION", "shares"),
+	)
+
+	// Group conversations and their participants; their messages are in
+	// the messages collection with a conversationId
+	conversationStore := store.NewMongoConversationStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_CONVERSATIONS_COLLECTION", "conversations"),
+	)
+
+	// Latencies are measured next to MongoDB, below the decorators
+	instrumentedStore := store.NewInstrumentedStore(mongoStore, "mongo")
+	var messageStore store.Store = instrumentedStore
+	if retryPolicy.MaxAttempts > 1 {
+		// Each attempt is measured on its own
+		messageStore = store.NewRetryingStore(messageStore, retryPolicy)
+		log.Printf("MongoDB retries enabled (%d attempts within %v)", retryPolicy.MaxAttempts, retryPolicy.Budget)
+	}
+
+	// Outbound messages are priced from PRICING_FILE or, failing that, the
+	// table document in MONGODB_PRICING_COLLECTION. Without either, messages
+	// are stored without a cost.
+	var pricer *pricing.Pricer
+	var pricingSource pricing.Source
+	if path := getEnv("PRICING_FILE", ""); path != "" {
+		pricingSource = pricing.FileSource{Path: path}
+	} else if coll := getEnv("MONGODB_PRICING_COLLECTION", ""); coll != "" {
+		pricingSource = pricing.NewMongoSource(mongoStore.GetClient(), mongoStore.GetDatabaseName(), coll)
+	}
+	if pricingSource != nil {
+		pricer, err = pricing.NewPricer(pricingSource)
+		if err != nil {
+			log.Fatalf("Failed to load pricing table: %v", err)
+		}
+		messageStore = store.NewCostingStore(messageStore, pricer)
+		log.Printf("Pricing table loaded from %s", pricingSource)
+	}
+
+	// Prefix search stores word prefixes on every message. Their index is
+	// large, so it is only built when SEARCH_PREFIX_ENABLED=true.
+	var tokenizer *search.Tokenizer
+	if getEnv("SEARCH_PREFIX_ENABLED", "false") == "true" {
+		tokenizer = &search.Tokenizer{
+			MaxGram:   getEnvInt("SEARCH_PREFIX_MAX_GRAM", 10),
+			MaxTokens: getEnvInt("SEARCH_PREFIX_MAX_TOKENS", 64),
+		}
+		if err := mongoStore.EnsureSearchTokenIndex(); err != nil {
+			log.Printf("Warning: could not ensure search token index: %v", err)
+		}
+		messageStore = store.NewTokenizingStore(messageStore, tokenizer)
+		log.Printf("Prefix search enabled (prefixes up to %d characters, %d per message)", tokenizer.MaxGram, tokenizer.MaxTokens)
+	}
+
+	// Accounts are held to a storage quota of QUOTA_DEFAULT_LIMIT messages,
+	// or a limit set for them, when QUOTAS_ENABLED=true. Their counters sit
+	// above the costing store, which fills in missing account IDs.
+	var quotaStore *store.QuotaEnforcingStore
+	if getEnv("QUOTAS_ENABLED", "false") == "true" {
+		quotaStore = store.NewQuotaEnforcingStore(messageStore, store.NewMongoQuotaStore(
+			mongoStore.GetClient(),
+			mongoStore.GetDatabaseName(),
+			getEnv("MONGODB_QUOTAS_COLLECTION", "account_quotas"),
+		), int64(getEnvInt("QUOTA_DEFAULT_LIMIT", 0)))
+		messageStore = quotaStore
+		log.Printf("Storage quotas enabled (default limit %d messages, 0 is unlimited)", quotaStore.DefaultLimit())
+	}
+
+	tombstoneWindow := getEnvDuration("TOMBSTONE_WINDOW", 24*time.Hour)
+	messageStore = store.NewTombstoningStore(messageStore, tombstoneStore, tombstoneWindow)
+
+	// Conversation summaries are kept up to date on every write, outermost so
+	// they only see messages that were actually stored
+	var summaryStore store.SummaryStore = store.NewMongoSummaryStore(mongoStore, getEnv("MONGODB_SUMMARIES_COLLECTION", "conversation_summaries"))
+	if coalescer != nil {
+		summaryStore = store.NewCoalescingSummaryStore(summaryStore, coalescer)
+	}
+	messageStore = store.NewSummarizingStore(messageStore, summaryStore)
+
+	// With LANGUAGE_DETECTION_ENABLED=true every message is stored with the
+	// language of its text, "und" below LANGUAGE_MIN_CONFIDENCE. It sits
+	// above the summaries, which count the languages of their messages
+	if getEnv("LANGUAGE_DETECTION_ENABLED", "false") == "true" {
+		minConfidence := getEnvFloat("LANGUAGE_MIN_CONFIDENCE", language.DefaultMinConfidence)
+		messageStore = store.NewLanguageDetectingStore(messageStore, language.NewDetector(minConfidence))
+		log.Printf("Language detection enabled (minimum confidence %.2f)", minConfidence)
+	}
+
+	// Coalescing sits above every decorator, so each write through them
+	// drops the reads it changes
+	if coalescer != nil {
+		messageStore = store.NewCoalescingStore(messageStore, coalescer)
+	}
+
+	// Residency scoping sits above everything else, so no read or write
+	// reaches the store unscoped
+	if residency.Enabled() {
+		messageStore = store.NewRegionScopedStore(messageStore, residency)
+	}
+
+	// Summaries are read and changed by requests scoped the same way; the
+	// summarizing store and auto-acks keep writing them unscoped, for the
+	// messages the scoped store let through
+	scopedSummaries := summaryStore
+	if residency.Enabled() {
+		scopedSummaries = store.NewRegionScopedSummaryStore(summaryStore, messageStore, residency)
+	}
+
+	// Conversations are closed, reopened and snoozed on their summaries,
+	// each transition recorded in the audit log
+	auditStore := store.NewMongoAuditStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_AUDIT_COLLECTION", "audit_log"),
+	)
+	lifecycle := store.NewConversationLifecycle(scopedSummaries, auditStore)
+
+	// Snapshots of conversations, diffed against later states when messages
+	// are reported missing; they expire on a TTL index
+	snapshotStore := store.NewMongoSnapshotStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_SNAPSHOTS_COLLECTION", "conversation_snapshots"),
+	)
+
+	// Every delete appends a receipt proving it happened, for compliance
+	deletionReceiptStore := store.NewMongoDeletionReceiptStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_DELETION_RECEIPTS_COLLECTION", "deletion_receipts"),
+	)
+
+	// Accounts with auto-acks enabled answer the first inbound message of a
+	// new conversation with one of the AUTO_ACK_TEMPLATES, stored as an
+	// outbound reply and claimed on the conversation's summary
+	autoAckTemplates, err := autoack.ParseTemplates(getEnv("AUTO_ACK_TEMPLATES", ""))
+	if err != nil {
+		log.Fatalf("Invalid AUTO_ACK_TEMPLATES: %v", err)
+	}
+	autoAckStore := store.NewMongoAutoAckStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_AUTO_ACK_COLLECTION", "auto_ack_configs"),
+	)
+	acknowledger := autoack.New(autoAckStore, autoAckTemplates, messageStore, summaryStore)
+
 	// Create handler with MongoDB store and ProfileStore
-	h := httpapi.NewHandler(mongoStore, profileStore)
+	handlerConfig := httpapi.DefaultHandlerConfig()
+	handlerConfig.MessageCacheThreshold = getEnvDuration("MESSAGE_CACHE_THRESHOLD", handlerConfig.MessageCacheThreshold)
+	handlerConfig.PageCountCacheTTL = getEnvDuration("PAGE_COUNT_CACHE_TTL", handlerConfig.PageCountCacheTTL)
+	handlerConfig.AdminAPIKey = getEnv("ADMIN_API_KEY", "")
+	handlerConfig.APIKeys, err = httpapi.ParseAPIKeys(getEnv("API_KEYS", ""))
+	if err != nil {
+		log.Fatalf("Invalid API_KEYS: %v", err)
+	}
+	handlerConfig.AnonymousScope, err = httpapi.ParseScope(getEnv("ANONYMOUS_SCOPE", string(handlerConfig.AnonymousScope)))
+	if err != nil {
+		log.Fatalf("Invalid ANONYMOUS_SCOPE: %v", err)
+	}
+	if handlerConfig.AdminAPIKey == "" && len(handlerConfig.APIKeys) == 0 && handlerConfig.AnonymousScope == httpapi.ScopeNone {
+		log.Println("No API_KEYS or ADMIN_API_KEY set: every route but the public ones answers 403")
+	} else if handlerConfig.AnonymousScope == httpapi.ScopeWrite || handlerConfig.AnonymousScope == httpapi.ScopeAdmin {
+		log.Printf("ANONYMOUS_SCOPE=%s: requests without a key can change data", handlerConfig.AnonymousScope)
+	}
+	handlerConfig.DeleteBatchSize = getEnvInt("DELETE_BATCH_SIZE", handlerConfig.DeleteBatchSize)
+	handlerConfig.ListMessagesLimit = getEnvInt("LIST_MESSAGES_LIMIT", handlerConfig.ListMessagesLimit)
+	handlerConfig.ListMessagesMaxLimit = getEnvInt("LIST_MESSAGES_MAX_LIMIT", handlerConfig.ListMessagesMaxLimit)
+	handlerConfig.ArchiveAfter = time.Duration(getEnvInt("ARCHIVE_AFTER_DAYS", int(handlerConfig.ArchiveAfter/(24*time.Hour)))) * 24 * time.Hour
+	handlerConfig.ArchiveBatchSize = getEnvInt("ARCHIVE_BATCH_SIZE", handlerConfig.ArchiveBatchSize)
+	handlerConfig.ProfileCleanupAfter = time.Duration(getEnvInt("PROFILE_CLEANUP_AFTER_DAYS", int(handlerConfig.ProfileCleanupAfter/(24*time.Hour)))) * 24 * time.Hour
+	handlerConfig.ProfileCleanupBatchSize = getEnvInt("PROFILE_CLEANUP_BATCH_SIZE", handlerConfig.ProfileCleanupBatchSize)
+	handlerConfig.ExportLinkTTL = getEnvDuration("EXPORT_LINK_TTL", handlerConfig.ExportLinkTTL)
+	handlerConfig.ShareLinkTTL = getEnvDuration("SHARE_LINK_TTL", handlerConfig.ShareLinkTTL)
+	handlerConfig.ShareLinkMaxTTL = getEnvDuration("SHARE_LINK_MAX_TTL", handlerConfig.ShareLinkMaxTTL)
+	handlerConfig.SnapshotTTL = getEnvDuration("SNAPSHOT_TTL", handlerConfig.SnapshotTTL)
+	handlerConfig.SnapshotMaxEntries = getEnvInt("SNAPSHOT_MAX_ENTRIES", handlerConfig.SnapshotMaxEntries)
+	handlerConfig.GraphQLMaxDepth = getEnvInt("GRAPHQL_MAX_DEPTH", handlerConfig.GraphQLMaxDepth)
+	handlerConfig.GraphQLMaxComplexity = getEnvInt("GRAPHQL_MAX_COMPLEXITY", handlerConfig.GraphQLMaxComplexity)
+	// The schema can only be introspected with GRAPHQL_INTROSPECTION=true,
+	// which development environments set
+	handlerConfig.GraphQLIntrospection = getEnv("GRAPHQL_INTROSPECTION", "false") == "true"
+	handlerConfig.ThreadMaxDepth = getEnvInt("THREAD_MAX_DEPTH", handlerConfig.ThreadMaxDepth)
+	handlerConfig.MigrationDir = getEnv("MIGRATION_DIR", "")
+	handlerConfig.MigrationParallelism = getEnvInt("MIGRATION_PARALLELISM", handlerConfig.MigrationParallelism)
+	handlerConfig.MigrationBatchSize = getEnvInt("MIGRATION_BATCH_SIZE", handlerConfig.MigrationBatchSize)
+	handlerConfig.ProfileEnrichmentTimeout = getEnvDuration("PROFILE_ENRICHMENT_TIMEOUT", handlerConfig.ProfileEnrichmentTimeout)
+	handlerConfig.TombstoneWindow = tombstoneWindow
+	handlerConfig.EmptyConversationTTL = getEnvDuration("EMPTY_CONVERSATION_TTL", handlerConfig.EmptyConversationTTL)
+	handlerConfig.MaxFutureSkew = getEnvDuration("MESSAGE_MAX_FUTURE_SKEW", handlerConfig.MaxFutureSkew)
+	// An empty FORWARD_TEXT_PREFIX forwards texts as they are
+	if prefix, ok := os.LookupEnv("FORWARD_TEXT_PREFIX"); ok {
+		handlerConfig.ForwardPrefix = prefix
+	}
+	// Demo data can only be generated, and removed, with SEEDING_ENABLED=true
+	handlerConfig.SeedingEnabled = getEnv("SEEDING_ENABLED", "false") == "true"
+	handlerConfig.ExportQueryMaxRows = getEnvInt("EXPORT_QUERY_MAX_ROWS", handlerConfig.ExportQueryMaxRows)
+	handlerConfig.ExportBatchSize = getEnvInt("EXPORT_BATCH_SIZE", handlerConfig.ExportBatchSize)
+	handlerConfig.StrictJSON, err = httpapi.ParseStrictJSON(getEnv("STRICT_JSON", string(handlerConfig.StrictJSON)))
+	if err != nil {
+		log.Fatalf("Invalid STRICT_JSON: %v", err)
+	}
+	h := httpapi.NewHandlerWithConfig(messageStore, profileStore, handlerConfig)
+	h.SetPreferenceStore(preferenceStore)
+	h.SetReadCursorStore(readCursorStore)
+	h.SetTombstoneStore(tombstoneStore)
+	h.SetShareStore(shareStore)
+	h.SetConversationStore(conversationStore)
+	h.SetSummaryStore(scopedSummaries)
+	h.SetAttributeSchemaStore(attributeSchemaStore)
+	h.SetAutoAck(autoAckStore, autoAckTemplates)
+	h.SetProfileHistory(profileHistory)
+	h.SetConversationLifecycle(lifecycle)
+	h.SetAuditStore(auditStore)
+	h.SetDeletionReceiptStore(deletionReceiptStore)
+	h.SetSnapshotStore(snapshotStore)
+
+	// Periodic tasks run on one scheduler, started once they are all
+	// registered and stopped on shutdown
+	tasks := scheduler.New()
+	h.SetScheduler(tasks)
+
+	// Conversations opened without messages expire after EMPTY_CONVERSATION_TTL
+	if ttl := handlerConfig.EmptyConversationTTL; ttl > 0 {
+		registerTask(tasks, "empty-conversation-sweep", scheduler.Every(min(ttl, time.Hour)), h.SweepEmptyConversations)
+	}
+	h.SetStoreLatency(instrumentedStore)
+
+	// Searches, digests, cost summaries, store stats and exports read with
+	// MONGODB_ANALYTICS_READ_PREFERENCE, such as secondaryPreferred to keep
+	// them off the primary; every mode but primary falls back to it when no
+	// secondary is available. Conversation reads stay on the primary, so
+	// they see their own writes
+	analyticsReads := mongoStore
+	if mode := getEnv("MONGODB_ANALYTICS_READ_PREFERENCE", "primary"); mode != "primary" {
+		rp, err := store.ParseReadPreference(mode, getEnvDuration("MONGODB_ANALYTICS_MAX_STALENESS", 0))
+		if err != nil {
+			log.Fatalf("Invalid MONGODB_ANALYTICS_READ_PREFERENCE: %v", err)
+		}
+		if analyticsReads, err = mongoStore.WithReadPreference(rp); err != nil {
+			log.Fatalf("Failed to set up analytics reads: %v", err)
+		}
+		analyticsProfiles, err := mongoProfileStore.WithReadPreference(rp)
+		if err != nil {
+			log.Fatalf("Failed to set up analytics reads: %v", err)
+		}
+		var analyticsMessages store.Store = store.NewInstrumentedStore(analyticsReads, "mongo_analytics")
+		var analyticsProfileStore store.ProfileStore = analyticsProfiles
+		if residency.Enabled() {
+			analyticsMessages = store.NewRegionScopedStore(analyticsMessages, residency)
+			analyticsProfileStore = store.NewRegionScopedProfileStore(analyticsProfileStore, residency)
+		}
+		h.SetAnalyticsStores(analyticsMessages, analyticsProfileStore)
+		log.Printf("Analytics read with read preference %s", mode)
+	}
+	h.SetStoreUsage(analyticsReads)
+	if pricer != nil {
+		h.SetPricer(pricer)
+	}
+	if tokenizer != nil {
+		h.SetSearchTokenizer(*tokenizer)
+	}
+
+	// Background admin jobs are recorded in MongoDB
+	h.SetJobManager(jobs.NewManager(jobs.NewMongoRepository(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_JOBS_COLLECTION", "jobs"),
+	)))
+
+	// The compound query indexes are built by a background job so a large
+	// collection doesn't block startup; queries run without them until then
+	if _, err := h.StartIndexBuild(mongoStore); err != nil {
+		log.Printf("Warning: could not start building query indexes: %v", err)
+	}
+
+	// Migrations write through every decorator like the API, so imported
+	// messages are region-stamped, costed, counted against quotas, checked
+	// against tombstones and summarized
+	h.SetMigrator(migrate.NewMigrator(messageStore, migrate.NewMongoCheckpointStore(
+		mongoStore.GetClient(),
+		mongoStore.GetDatabaseName(),
+		getEnv("MONGODB_MIGRATION_CHECKPOINTS_COLLECTION", "migration_checkpoints"),
+	)))
+
+	// s3://bucket/prefix sources are read with the standard AWS
+	// credential variables; instance roles aren't supported
+	if accessKeyID := getEnv("AWS_ACCESS_KEY_ID", ""); accessKeyID != "" {
+		h.SetMigrationS3(migrate.S3Config{
+			Region:          getEnv("MIGRATION_S3_REGION", getEnv("AWS_REGION", "us-east-1")),
+			Endpoint:        getEnv("MIGRATION_S3_ENDPOINT", ""),
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			SessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		})
+	}
+
+	// Old messages move to a cold collection, by admin request or on
+	// ARCHIVE_SCHEDULE (a duration or cron expression), which defaults to
+	// every ARCHIVE_INTERVAL when that is set
+	var archiver store.Archiver = store.NewMongoArchive(mongoStore, getEnv("MONGODB_ARCHIVE_COLLECTION", "messages_archive"))
+	if residency.Enabled() {
+		archiver = store.NewRegionScopedArchiver(archiver, mongoStore, residency)
+	}
+	h.SetArchiver(archiver)
+	archiveSchedule := getEnv("ARCHIVE_SCHEDULE", "")
+	if archiveSchedule == "" {
+		if interval := getEnvDuration("ARCHIVE_INTERVAL", 0); interval > 0 {
+			archiveSchedule = interval.String()
+		}
+	}
+	if archiveSchedule != "" {
+		schedule, err := scheduler.ParseSchedule(archiveSchedule)
+		if err != nil {
+			log.Fatalf("Invalid ARCHIVE_SCHEDULE: %v", err)
+		}
+		registerTask(tasks, "archive", schedule, func(context.Context) error {
+			if _, err := h.SubmitArchive(handlerConfig.ArchiveAfter); err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+				return fmt.Errorf("failed to start scheduled archiving: %w", err)
+			}
+			return nil
+		})
+		log.Printf("Archiving messages older than %v %v", handlerConfig.ArchiveAfter, schedule)
+	}
+
+	// Auto-created profiles of numbers without messages for
+	// PROFILE_CLEANUP_AFTER_DAYS are deleted by admin request or on
+	// PROFILE_CLEANUP_SCHEDULE, which only reports them with
+	// PROFILE_CLEANUP_DRY_RUN=true
+	var autoProfiles store.AutoProfileLister = mongoProfileStore
+	if residency.Enabled() {
+		autoProfiles = store.NewRegionScopedAutoProfileLister(autoProfiles, residency)
+	}
+	h.SetAutoProfileLister(autoProfiles)
+	if raw := getEnv("PROFILE_CLEANUP_SCHEDULE", ""); raw != "" {
+		schedule, err := scheduler.ParseSchedule(raw)
+		if err != nil {
+			log.Fatalf("Invalid PROFILE_CLEANUP_SCHEDULE: %v", err)
+		}
+		dryRun := getEnv("PROFILE_CLEANUP_DRY_RUN", "false") == "true"
+		registerTask(tasks, "profile-cleanup", schedule, func(context.Context) error {
+			if _, err := h.SubmitProfileCleanup(handlerConfig.ProfileCleanupAfter, dryRun); err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+				return fmt.Errorf("failed to start scheduled profile cleanup: %w", err)
+			}
+			return nil
+		})
+		log.Printf("Cleaning up auto-created profiles without messages for %v %v (dry run: %v)", handlerConfig.ProfileCleanupAfter, schedule, dryRun)
+	}
+
+	// Quota counters drift when messages are migrated, archived or lost to
+	// a failed count; they are recounted by admin request or every
+	// QUOTA_RECONCILE_INTERVAL
+	if quotaStore != nil {
+		h.SetQuotas(quotaStore)
+		if interval := getEnvDuration("QUOTA_RECONCILE_INTERVAL", time.Hour); interval > 0 {
+			registerTask(tasks, "quota-reconcile", scheduler.Every(interval), func(context.Context) error {
+				if _, err := h.SubmitQuotaReconcile(); err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+					return fmt.Errorf("failed to start scheduled quota reconciliation: %w", err)
+				}
+				return nil
+			})
+			log.Printf("Reconciling quota counters every %v", interval)
+		}
+	}
+
+	// Conversation exports are built into files that are served, resumably,
+	// until they expire
+	exportArtifacts, err := exports.NewArtifacts(
+		getEnv("EXPORT_DIR", filepath.Join(os.TempDir(), "sms-store-exports")),
+		getEnvDuration("EXPORT_TTL", 24*time.Hour),
+	)
+	if err != nil {
+		log.Fatalf("Failed to initialize exports: %v", err)
+	}
+	h.SetExportArtifacts(exportArtifacts)
+	var querier store.MessageQuerier = analyticsReads
+	if residency.Enabled() {
+		querier = store.NewRegionScopedQuerier(querier, residency)
+	}
+	h.SetMessageQuerier(querier)
+	registerTask(tasks, "export-sweep", scheduler.Every(time.Hour), exportArtifacts.SweepTask)
+
+	// Signed export links let auditors download one conversation without an
+	// API key. To rotate the secret, move the old one to
+	// EXPORT_LINK_PREVIOUS_SECRETS until its links have expired.
+	if secret := getEnv("EXPORT_LINK_SECRET", ""); secret != "" {
+		signer, err := exports.NewLinkSigner(secret, strings.Split(getEnv("EXPORT_LINK_PREVIOUS_SECRETS", ""), ",")...)
+		if err != nil {
+			log.Fatalf("Invalid export link secret: %v", err)
+		}
+		h.SetExportLinkSigner(signer)
+	}
+
+	// MongoDB health is reported on /healthz
+	h.RegisterHealthCheck("mongodb", func() httpapi.ComponentHealth {
+		if err := mongoStore.Ping(); err != nil {
+			return httpapi.ComponentHealth{Status: httpapi.HealthFailed, Message: err.Error()}
+		}
+		return httpapi.ComponentHealth{Status: httpapi.HealthUp}
+	})
 
 	// Initialize Kafka consumer
 	kafkaBrokers := getEnv("KAFKA_BROKERS", "localhost:9092")
 	kafkaGroupID := getEnv("KAFKA_GROUP_ID", "sms-store-consumer-group")
 	kafkaTopic := getEnv("KAFKA_TOPIC", "sms-events")
+	kafkaRequired := getEnv("KAFKA_REQUIRED", "false") == "true"
 
-	log.Println("Initializing Kafka consumer...")
-	kafkaConsumer, err := kafka.NewConsumer(
-		strings.Split(kafkaBrokers, ","),
-		kafkaGroupID,
-		kafkaTopic,
-		mongoStore,
-	)
+	// Alerts of the ingestion watchdog and the growth monitor are logged
+	// and posted to INGESTION_ALERT_WEBHOOK_URL when that is set
+	var alertWebhook *watchdog.WebhookAlerter
+	if url := getEnv("INGESTION_ALERT_WEBHOOK_URL", ""); url != "" {
+		alertWebhook = watchdog.NewWebhookAlerter(url)
+	}
+
+	// The ingestion watchdog alerts when the Kafka topic, or a source named
+	// in INGESTION_WATCHDOG_THRESHOLDS, stores nothing for longer than its
+	// threshold during INGESTION_WATCHDOG_HOURS. It is off unless a
+	// threshold is set
+	var ingestionWatchdog *watchdog.Watchdog
+	watchdogThresholds, err := watchdog.ParseThresholds(getEnv("INGESTION_WATCHDOG_THRESHOLDS", ""))
 	if err != nil {
-		log.Fatalf("Failed to create Kafka consumer: %v", err)
+		log.Fatalf("Invalid INGESTION_WATCHDOG_THRESHOLDS: %v", err)
+	}
+	watchdogThreshold := getEnvDuration("INGESTION_WATCHDOG_THRESHOLD", 0)
+	if watchdogThreshold > 0 || len(watchdogThresholds) > 0 {
+		loc, err := time.LoadLocation(getEnv("INGESTION_WATCHDOG_TZ", "UTC"))
+		if err != nil {
+			log.Fatalf("Invalid INGESTION_WATCHDOG_TZ: %v", err)
+		}
+		hours, err := watchdog.ParseHours(getEnv("INGESTION_WATCHDOG_HOURS", ""), loc)
+		if err != nil {
+			log.Fatalf("Invalid INGESTION_WATCHDOG_HOURS: %v", err)
+		}
+		var alerter watchdog.Alerter
+		if alertWebhook != nil {
+			alerter = alertWebhook
+		}
+		ingestionWatchdog, err = watchdog.New(watchdog.Config{Threshold: watchdogThreshold, Thresholds: watchdogThresholds, Hours: hours}, alerter)
+		if err != nil {
+			log.Fatalf("Invalid ingestion watchdog settings: %v", err)
+		}
+		ingestionWatchdog.Watch(watchdog.SourceKafka(kafkaTopic))
+		ingestionWatchdog.WatchConfigured()
+		h.SetIngestionWatchdog(ingestionWatchdog)
+		registerTask(tasks, "ingestion-watchdog", scheduler.Every(getEnvDuration("INGESTION_WATCHDOG_INTERVAL", time.Minute)), ingestionWatchdog.Check)
+		log.Printf("Ingestion watchdog enabled (expected hours: %s)", hours)
 	}
 
-	// Start Kafka consumer in background
-	if err := kafkaConsumer.Start(); err != nil {
-		log.Fatalf("Failed to start Kafka consumer: %v", err)
+	// The growth monitor samples the size of the messages collection every
+	// GROWTH_SAMPLE_INTERVAL, keeping GROWTH_HISTORY_SAMPLES of them (30
+	// days' worth by default). Growing by more than GROWTH_ALERT_THRESHOLD
+	// in a day, as a fraction, marks /healthz degraded and alerts, once the
+	// collection stores GROWTH_ALERT_MIN_STORAGE_MB; an interval of 0 turns
+	// sampling off and a threshold of 0 alerting
+	if interval := getEnvDuration("GROWTH_SAMPLE_INTERVAL", time.Hour); interval > 0 {
+		growthStore := store.NewMongoGrowthStore(
+			mongoStore.GetClient(),
+			mongoStore.GetDatabaseName(),
+			getEnv("MONGODB_GROWTH_COLLECTION", "growth_samples"),
+		)
+		var webhook growth.Webhook
+		if alertWebhook != nil {
+			webhook = alertWebhook
+		}
+		growthMonitor, err := growth.New(growth.Config{
+			Collection:      collectionName,
+			Interval:        interval,
+			Keep:            getEnvInt("GROWTH_HISTORY_SAMPLES", int(30*24*time.Hour/interval)),
+			Threshold:       getEnvFloat("GROWTH_ALERT_THRESHOLD", 1),
+			MinStorageBytes: int64(getEnvInt("GROWTH_ALERT_MIN_STORAGE_MB", 100)) << 20,
+		}, mongoStore, growthStore, webhook)
+		if err != nil {
+			log.Fatalf("Invalid growth monitor settings: %v", err)
+		}
+		h.SetGrowthMonitor(growthMonitor)
+		registerTask(tasks, "growth-sample", scheduler.Every(interval), growthMonitor.Sample)
+		log.Printf("Sampling %s collection growth every %v", collectionName, interval)
+	}
+
+	consumerConfig := kafka.DefaultConsumerConfig()
+	consumerConfig.MaxInFlight = getEnvInt("KAFKA_MAX_IN_FLIGHT", consumerConfig.MaxInFlight)
+	consumerConfig.FetchMinBytes = int32(getEnvInt("KAFKA_FETCH_MIN_BYTES", int(consumerConfig.FetchMinBytes)))
+	consumerConfig.FetchMaxBytes = int32(getEnvInt("KAFKA_FETCH_MAX_BYTES", int(consumerConfig.FetchMaxBytes)))
+	consumerConfig.MaxPartitionFetchBytes = int32(getEnvInt("KAFKA_MAX_PARTITION_FETCH_BYTES", int(consumerConfig.MaxPartitionFetchBytes)))
+	consumerConfig.SessionTimeout = getEnvDuration("KAFKA_SESSION_TIMEOUT", consumerConfig.SessionTimeout)
+	consumerConfig.HeartbeatInterval = getEnvDuration("KAFKA_HEARTBEAT_INTERVAL", consumerConfig.HeartbeatInterval)
+	consumerConfig.InitialOffset = getEnv("KAFKA_INITIAL_OFFSET", consumerConfig.InitialOffset)
+	consumerConfig.MaxFutureSkew = getEnvDuration("MESSAGE_MAX_FUTURE_SKEW", consumerConfig.MaxFutureSkew)
+	consumerConfig.DuplicateTextWindow = getEnvDuration("KAFKA_DUPLICATE_TEXT_WINDOW", 0)
+	consumerConfig.DuplicateTextMode = getEnv("KAFKA_DUPLICATE_TEXT_MODE", kafka.DuplicateTextMark)
+	if codecs := getEnv("KAFKA_COMPRESSION", ""); codecs != "" {
+		consumerConfig.Compression = strings.Split(codecs, ",")
+	}
+	// Consumption slows while batch writes are slower than
+	// KAFKA_THROTTLE_LATENCY; unset, it runs at full speed regardless
+	consumerConfig.Throttle = kafka.ThrottleConfig{
+		Latency:   getEnvDuration("KAFKA_THROTTLE_LATENCY", 0),
+		ErrorRate: getEnvFloat("KAFKA_THROTTLE_ERROR_RATE", 0),
+		Window:    getEnvInt("KAFKA_THROTTLE_WINDOW", 0),
+		Step:      getEnvFloat("KAFKA_THROTTLE_STEP", 0),
+		MaxDelay:  getEnvDuration("KAFKA_THROTTLE_MAX_DELAY", 0),
+	}
+
+	// Configuration errors can't be fixed by retrying, so fail now
+	if err := kafka.ValidateConsumerConfig(consumerConfig); err != nil {
+		log.Fatalf("Invalid Kafka consumer configuration: %v", err)
+	}
+
+	// Events that can't be processed go to KAFKA_DLQ_TOPIC when it is set
+	kafkaDLQTopic := getEnv("KAFKA_DLQ_TOPIC", "")
+
+	// With AUTO_CREATE_PROFILES=true a number's first message creates its
+	// profile, announced on KAFKA_PROFILE_EVENTS_TOPIC when it is set
+	autoCreateProfiles := getEnv("AUTO_CREATE_PROFILES", "false") == "true"
+	kafkaProfileEventsTopic := getEnv("KAFKA_PROFILE_EVENTS_TOPIC", "")
+	if kafkaProfileEventsTopic != "" && kafkaProfileEventsTopic == kafkaTopic {
+		log.Fatalf("KAFKA_PROFILE_EVENTS_TOPIC must differ from KAFKA_TOPIC")
+	}
+
+	// With RAW_CAPTURE_ENABLED=true the payload of each message event is
+	// kept for RAW_CAPTURE_TTL, cut to RAW_CAPTURE_MAX_BYTES, for
+	// GET /v1/admin/messages/{id}/raw. It is written in the background and
+	// dropped when the writer falls behind
+	var rawCapture *store.RawCapture
+	if getEnv("RAW_CAPTURE_ENABLED", "false") == "true" {
+		rawConfig := store.DefaultRawCaptureConfig()
+		rawConfig.TTL = getEnvDuration("RAW_CAPTURE_TTL", rawConfig.TTL)
+		rawConfig.MaxBytes = getEnvInt("RAW_CAPTURE_MAX_BYTES", rawConfig.MaxBytes)
+		rawCapture = store.NewRawCapture(
+			store.NewMongoRawEventStore(
+				mongoStore.GetClient(),
+				mongoStore.GetDatabaseName(),
+				getEnv("MONGODB_RAW_EVENTS_COLLECTION", "raw_events"),
+			),
+			rawConfig,
+		)
+		h.SetRawEventStore(rawCapture.Store())
+		log.Printf("Raw event capture enabled (kept for %v, up to %d bytes each)", rawConfig.TTL, rawConfig.MaxBytes)
+
+		// Deferred before the consumer stops, so this runs after it
+		defer rawCapture.Close()
+	}
+
+	newKafkaConsumer := func() (*kafka.Consumer, error) {
+		var dlq *kafka.KafkaDeadLetterQueue
+		if kafkaDLQTopic != "" {
+			var err error
+			if dlq, err = kafka.NewKafkaDeadLetterQueue(strings.Split(kafkaBrokers, ","), kafkaDLQTopic); err != nil {
+				return nil, err
+			}
+		}
+		var profileEvents *kafka.KafkaProfileEvents
+		if autoCreateProfiles && kafkaProfileEventsTopic != "" {
+			var err error
+			if profileEvents, err = kafka.NewKafkaProfileEvents(strings.Split(kafkaBrokers, ","), kafkaProfileEventsTopic); err != nil {
+				if dlq != nil {
+					dlq.Close()
+				}
+				return nil, err
+			}
+		}
+
+		consumer, err := kafka.NewConsumerWithConfig(
+			strings.Split(kafkaBrokers, ","),
+			kafkaGroupID,
+			kafkaTopic,
+			messageStore,
+			consumerConfig,
+		)
+		if err != nil {
+			if dlq != nil {
+				dlq.Close()
+			}
+			if profileEvents != nil {
+				profileEvents.Close()
+			}
+			return nil, err
+		}
+		consumer.SetProfileStore(profileHistory.As(models.AuditActorKafka))
+		consumer.SetConversationStore(conversationStore)
+		consumer.SetConversationLifecycle(lifecycle)
+		consumer.SetAutoAck(acknowledger)
+		if rawCapture != nil {
+			consumer.SetRawEvents(rawCapture)
+		}
+		if dlq != nil {
+			consumer.SetDeadLetterQueue(dlq)
+		}
+		if ingestionWatchdog != nil {
+			consumer.SetIngestionWatch(ingestionWatchdog, watchdog.SourceKafka(kafkaTopic))
+		}
+		if profileEvents != nil {
+			consumer.SetAutoCreateProfiles(profileEvents)
+		} else if autoCreateProfiles {
+			consumer.SetAutoCreateProfiles(nil)
+		}
+		return consumer, nil
+	}
+
+	// With KAFKA_REQUIRED=true startup fails fast when Kafka is unreachable.
+	// Otherwise the consumer connects in the background so the HTTP API can
+	// keep serving reads during a Kafka outage.
+	supervisorConfig := kafka.DefaultSupervisorConfig()
+	supervisorConfig.MaxAttempts = getEnvInt("KAFKA_CONNECT_MAX_ATTEMPTS", supervisorConfig.MaxAttempts)
+	if kafkaRequired {
+		log.Println("Initializing Kafka consumer (KAFKA_REQUIRED=true)...")
+		supervisorConfig.MaxAttempts = 1
+	} else {
+		log.Println("Initializing Kafka consumer in the background...")
+	}
+	kafkaSupervisor := kafka.NewSupervisor(newKafkaConsumer, supervisorConfig)
+	kafkaSupervisor.Start()
+
+	if kafkaRequired {
+		// Wait for the single attempt to finish and fail fast on error
+		<-kafkaSupervisor.Done()
+		if state := kafkaSupervisor.State(); state.State != kafka.StateRunning {
+			log.Fatalf("Failed to start Kafka consumer: %s", state.LastError)
+		}
 	}
 
 	// Ensure Kafka consumer is stopped on shutdown
 	defer func() {
 		log.Println("Stopping Kafka consumer...")
-		if err := kafkaConsumer.Stop(); err != nil {
+		if err := kafkaSupervisor.Stop(); err != nil {
 			log.Printf("Error stopping Kafka consumer: %v", err)
 		}
 	}()
 
-	mux := http.NewServeMux()
+	h.SetKafkaSupervisor(kafkaSupervisor)
+	h.RegisterHealthCheck("kafka", func() httpapi.ComponentHealth {
+		state := kafkaSupervisor.State()
+		details := struct {
+			kafka.SupervisorState
+			Stats *kafka.ConsumerStats `json:"stats,omitempty"`
+		}{SupervisorState: state}
+		health := httpapi.ComponentHealth{Message: state.LastError, Details: &details}
+		switch state.State {
+		case kafka.StateRunning:
+			health.Status = httpapi.HealthUp
+			health.Message = ""
+			if consumer := kafkaSupervisor.Consumer(); consumer != nil {
+				stats := consumer.Stats()
+				details.Stats = &stats
+			}
+		case kafka.StateConnecting:
+			health.Status = httpapi.HealthConnecting
+		default:
+			health.Status = httpapi.HealthFailed
+		}
+		return health
+	})
+
+	// With MQTT_ENABLED=true messages are also received from an MQTT
+	// broker, through the same validation, duplicate suppression and
+	// batched saves as Kafka events
+	var mqttSource *mqtt.Source
+	var mqttPipeline *kafka.Pipeline
+	if getEnv("MQTT_ENABLED", "false") == "true" {
+		mqttConfig := mqtt.DefaultConfig()
+		mqttConfig.BrokerURL = getEnv("MQTT_BROKER_URL", "mqtt://localhost:1883")
+		mqttConfig.Topic = getEnv("MQTT_TOPIC", mqttConfig.Topic)
+		mqttConfig.ClientID = getEnv("MQTT_CLIENT_ID", mqttConfig.ClientID)
+		mqttConfig.Username = getEnv("MQTT_USERNAME", "")
+		mqttConfig.Password = getEnv("MQTT_PASSWORD", "")
+		mqttConfig.TLS = getEnv("MQTT_TLS", "false") == "true"
+		mqttConfig.CAFile = getEnv("MQTT_TLS_CA_FILE", "")
+		mqttConfig.CleanSession = getEnv("MQTT_CLEAN_SESSION", "false") == "true"
+		mqttConfig.KeepAlive = getEnvDuration("MQTT_KEEP_ALIVE", mqttConfig.KeepAlive)
+		mqttConfig.MaxBackoff = getEnvDuration("MQTT_MAX_BACKOFF", mqttConfig.MaxBackoff)
+
+		mqttPipeline, err = kafka.NewPipeline(messageStore, models.RawSourceMQTT, consumerConfig)
+		if err != nil {
+			log.Fatalf("Invalid MQTT pipeline settings: %v", err)
+		}
+		mqttPipeline.SetProfileStore(profileHistory.As(models.AuditActorMQTT))
+		mqttPipeline.SetConversationStore(conversationStore)
+		mqttPipeline.SetConversationLifecycle(lifecycle)
+		mqttPipeline.SetAutoAck(acknowledger)
+		if rawCapture != nil {
+			mqttPipeline.SetRawEvents(rawCapture)
+		}
+		if ingestionWatchdog != nil {
+			ingestionWatchdog.Watch(watchdog.SourceMQTT(mqttConfig.Topic))
+			mqttPipeline.SetIngestionWatch(ingestionWatchdog, watchdog.SourceMQTT(mqttConfig.Topic))
+		}
+		if autoCreateProfiles {
+			mqttPipeline.SetAutoCreateProfiles(nil)
+		}
+		mqttSource, err = mqtt.NewSource(mqttConfig, mqttPipeline)
+		if err != nil {
+			log.Fatalf("Invalid MQTT settings: %v", err)
+		}
+		mqttPipeline.Start()
+		mqttSource.Start()
+
+		// The source stops taking messages before the pipeline stores
+		// what it holds
+		defer func() {
+			mqttSource.Stop()
+			if err := mqttPipeline.Stop(); err != nil {
+				log.Printf("Error stopping MQTT pipeline: %v", err)
+			}
+		}()
 
-	// CORS middleware
-	corsMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
+		h.RegisterHealthCheck("mqtt", func() httpapi.ComponentHealth {
+			state := mqttSource.State()
+			details := struct {
+				mqtt.State
+				Stats kafka.PipelineStats `json:"stats"`
+			}{State: state, Stats: mqttPipeline.Stats()}
+			health := httpapi.ComponentHealth{Message: state.LastError, Details: &details}
+			switch state.State {
+			case mqtt.StateConnected:
+				health.Status = httpapi.HealthUp
+				health.Message = ""
+			case mqtt.StateConnecting:
+				health.Status = httpapi.HealthConnecting
+			default:
+				health.Status = httpapi.HealthFailed
+			}
+			return health
+		})
+	}
+
+	mux := h.Routes()
+
+	// CORS middleware, outside the scope check so its 403s are readable too
+	corsMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Set CORS headers
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, If-Range, Range, X-Request-ID, X-Account-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID, X-App-Version, Deprecation, Accept-Ranges, Content-Range, Content-Disposition")
 			w.Header().Set("Access-Control-Max-Age", "3600")
 
 			// Handle preflight requests
@@ -93,87 +914,21 @@ func main() {
 				return
 			}
 
-			next(w, r)
-		}
+			next.ServeHTTP(w, r)
+		})
 	}
 
-	// GET /ping - Health check endpoint
-	mux.HandleFunc("/ping", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		h.Ping(w, r)
-	}))
-
-	// GET /v1/conversations - Get all distinct phone numbers (conversations)
-	mux.HandleFunc("/v1/conversations", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		h.GetConversations(w, r)
-	}))
-
-	// GET /v1/user/{user_id}/messages - Required endpoint for SMS Store
-	// DELETE /v1/user/{user_id}/messages - Delete all messages for a conversation
-	mux.HandleFunc("/v1/user/", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		// Only handle paths that end with /messages
-		if !strings.HasSuffix(r.URL.Path, "/messages") {
-			http.NotFound(w, r)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodGet:
-			h.GetUserMessages(w, r)
-		case http.MethodDelete:
-			h.DeleteUserMessages(w, r)
-		default:
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		}
-	}))
-
-	// GET /v1/profile/{phoneNumber} - Get profile
-	// PUT /v1/profile/{phoneNumber} - Update profile
-	mux.HandleFunc("/v1/profile/", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			h.GetProfile(w, r)
-		case http.MethodPut:
-			h.UpdateProfile(w, r)
-		default:
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		}
-	}))
-
-	// POST /v1/profile - Create profile
-	mux.HandleFunc("/v1/profile", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		h.CreateProfile(w, r)
-	}))
-
-	// POST /messages, GET /messages, DELETE /messages - Optional endpoints for testing
-	mux.HandleFunc("/messages", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			h.CreateMessage(w, r)
-		case http.MethodGet:
-			h.ListMessages(w, r)
-		case http.MethodDelete:
-			h.DeleteAllMessages(w, r)
-		default:
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		}
-	}))
+	// Behind a load balancer the peer is the proxy; its forwarding headers
+	// name the client only when it is listed in TRUSTED_PROXIES
+	trustedProxies, err := httpapi.ParseTrustedProxies(getEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	addr := ":8082"
 	server := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: httpapi.ResolveClientIP(trustedProxies, httpapi.RequestContext(httpapi.AppVersion(corsMiddleware(h.Authorize(mux))))),
 	}
 
 	// Setup graceful shutdown
@@ -186,9 +941,18 @@ func main() {
 		log.Println("Shutting down server...")
 
 		// Stop Kafka consumer first
-		if err := kafkaConsumer.Stop(); err != nil {
+		if err := kafkaSupervisor.Stop(); err != nil {
 			log.Printf("Error stopping Kafka consumer: %v", err)
 		}
+		if mqttSource != nil {
+			mqttSource.Stop()
+			if err := mqttPipeline.Stop(); err != nil {
+				log.Printf("Error stopping MQTT pipeline: %v", err)
+			}
+		}
+
+		// Let running tasks finish or give up before the stores go away
+		tasks.Stop()
 
 		// Then close HTTP server
 		if err := server.Close(); err != nil {
@@ -196,20 +960,110 @@ func main() {
 		}
 	}()
 
-	log.Println("sms-store server started at", addr)
+	log.Println("sms-store", version.Get(), "started at", addr)
 	log.Println("Available endpoints:")
 	log.Println("  GET    /ping")
+	log.Println("  GET    /healthz")
+	log.Println("  GET    /readyz")
+	log.Println("  GET    /version")
+	log.Println("  GET    /metrics")
 	log.Println("  GET    /v1/conversations")
-	log.Println("  GET    /v1/user/{user_id}/messages")
+	log.Println("  POST   /v1/conversations")
+	log.Println("  GET    /v1/conversations/changes")
+	log.Println("  GET    /graphql?query=")
+	log.Println("  POST   /graphql")
+	log.Println("  GET    /v1/groups")
+	log.Println("  GET    /v1/groups/{conversation_id}")
+	log.Println("  GET    /v1/groups/{conversation_id}/messages?limit=&cursor=")
+	log.Println("  GET    /v1/refs/{type}/{id}/messages?limit=&cursor=")
+	log.Println("  GET    /v1/search?q=|prefix=&refType=&refId=")
+	log.Println("  GET    /v1/user/{user_id}/messages?participant=&includeParticipants=&includeTranslations=")
 	log.Println("  DELETE /v1/user/{user_id}/messages")
+	log.Println("  GET    /v1/user/{user_id}/messages/daily?tz=")
+	log.Println("  GET    /v1/user/{user_id}/messages/transcript?format=html|pdf&tz=")
+	log.Println("  POST   /v1/user/{user_id}/messages/export")
+	log.Println("  POST   /v1/user/{user_id}/messages/export-link")
+	log.Println("  GET    /v1/exports/{jobId}")
+	log.Println("  GET    /v1/export-download?token=")
+	log.Println("  POST   /v1/user/{user_id}/share?expiresIn=")
+	log.Println("  GET    /v1/shares")
+	log.Println("  DELETE /v1/shares/{id}")
+	log.Println("  GET    /v1/shared/{token}/messages?limit=&cursor=")
+	log.Println("  GET    /v1/user/{user_id}/preferences")
+	log.Println("  PUT    /v1/user/{user_id}/preferences")
+	log.Println("  GET    /v1/user/{user_id}/attributes")
+	log.Println("  PUT    /v1/user/{user_id}/attributes")
+	log.Println("  POST   /v1/user/{user_id}/read")
+	log.Println("  POST   /v1/user/{user_id}/close")
+	log.Println("  POST   /v1/user/{user_id}/reopen")
+	log.Println("  POST   /v1/user/{user_id}/snooze?until=")
 	log.Println("  GET    /v1/profile/{phoneNumber}")
 	log.Println("  PUT    /v1/profile/{phoneNumber}")
 	log.Println("  POST   /v1/profile")
+	log.Println("  GET    /v1/profile/{phoneNumber}/history")
+	log.Println("  POST   /v1/profile/{phoneNumber}/rollback/{historyId}")
 	log.Println("  POST   /messages (testing only)")
-	log.Println("  GET    /messages (testing only)")
-	log.Println("  DELETE /messages (testing only - clears all messages)")
+	log.Println("  GET    /messages?limit=&cursor= (testing only - newest first, capped)")
+	log.Println("  DELETE /messages (testing only - clears all messages; ?mode=drop and ?regionOverride=true need admin)")
+	log.Println("  GET    /messages/{id}")
+	log.Println("  PATCH  /messages/{id}")
+	log.Println("  GET    /messages/{id}/thread?depth=")
+	log.Println("  POST   /messages/{id}/reactions")
+	log.Println("  DELETE /messages/{id}/reactions")
+	log.Println("  POST   /messages/{id}/forward")
+	log.Println("  POST   /messages/{id}/annotations")
+	log.Println("  POST   /messages/{id}/annotations/{source}/review")
+	log.Println("  GET    /messages/{id}/translations")
+	log.Println("  PUT    /messages/{id}/translations/{lang}?overwrite=")
+	log.Println("  GET    /v1/analytics/cost?groupBy=day|account|language|annotation")
+	log.Println("  GET    /v1/admin/pricing")
+	log.Println("  POST   /v1/admin/pricing/reload")
+	log.Println("  POST   /v1/admin/archive?olderThanDays=")
+	log.Println("  POST   /v1/admin/search/tokens/backfill")
+	log.Println("  POST   /v1/admin/conversations/summaries/rebuild?phoneNumber=")
+	log.Println("  POST   /v1/admin/conversations/summaries/check?sample=&repair=")
+	log.Println("  GET    /v1/admin/store/latency?window=")
+	log.Println("  GET    /v1/admin/store/stats")
+	log.Println("  POST   /v1/admin/migrate/start")
+	log.Println("  POST   /v1/admin/seed")
+	log.Println("  DELETE /v1/admin/seed")
+	log.Println("  POST   /v1/admin/export/query?regionOverride=")
+	log.Println("  GET    /v1/admin/tombstones")
+	log.Println("  DELETE /v1/admin/tombstones/{phoneNumber}")
+	log.Println("  POST   /v1/admin/profiles/merge")
+	log.Println("  POST   /v1/admin/profiles/cleanup?olderThanDays=&dryRun=")
+	log.Println("  GET    /v1/admin/accounts/{id}/quota")
+	log.Println("  PUT    /v1/admin/accounts/{id}/quota")
+	log.Println("  GET    /v1/admin/accounts/{id}/attributes")
+	log.Println("  PUT    /v1/admin/accounts/{id}/attributes")
+	log.Println("  GET    /v1/admin/accounts/{id}/auto-ack")
+	log.Println("  PUT    /v1/admin/accounts/{id}/auto-ack")
+	log.Println("  POST   /v1/admin/quotas/reconcile")
+	log.Println("  GET    /v1/admin/audit?phoneNumber=&limit=")
+	log.Println("  GET    /v1/admin/deletion-receipts?phoneNumber=&from=&to=&limit=")
+	log.Println("  POST   /v1/admin/user/{phoneNumber}/snapshot")
+	log.Println("  GET    /v1/admin/user/{phoneNumber}/diff?from=&to=")
+	log.Println("  GET    /v1/admin/messages/{id}/raw")
+	log.Println("  GET    /v1/admin/consumer/offsets")
+	log.Println("  POST   /v1/admin/consumer/seek")
+	log.Println("  POST   /v1/admin/events/validate")
+	log.Println("  GET    /v1/admin/ingestion/latency?window=")
+	log.Println("  GET    /v1/admin/ingestion/health")
+	log.Println("  GET    /v1/admin/growth")
+	log.Println("  GET    /v1/admin/jobs")
+	log.Println("  GET    /v1/admin/jobs/{id}")
+	log.Println("  POST   /v1/admin/jobs/{id}/cancel")
+	log.Println("  GET    /v1/admin/tasks")
+	log.Println("  POST   /v1/admin/tasks/{name}/run")
 	log.Println("Kafka consumer listening on topic:", kafkaTopic)
 
+	// The warm-up primes the queries of GET /v1/conversations, which run
+	// slowly against a cold MongoDB cache after a deploy
+	if getEnv("WARMUP_ENABLED", "false") == "true" {
+		h.StartWarmUp(getEnvDuration("WARMUP_TIMEOUT", 30*time.Second))
+	}
+
+	tasks.Start()
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
@@ -217,6 +1071,13 @@ func main() {
 	log.Println("Server stopped")
 }
 
+// registerTask adds a periodic task to s, exiting if it can't.
+func registerTask(s *scheduler.Scheduler, name string, schedule scheduler.Schedule, fn scheduler.Func) {
+	if err := s.Register(name, schedule, fn); err != nil {
+		log.Fatalf("Failed to register task %s: %v", name, err)
+	}
+}
+
 // getEnv retrieves an environment variable or returns a default value.
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -224,3 +1085,45 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt retrieves an integer environment variable or returns a default value.
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvFloat retrieves a decimal environment variable or returns a default value.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s=%q, using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+// getEnvDuration retrieves a duration environment variable (e.g. "24h") or returns a default value.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s=%q, using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
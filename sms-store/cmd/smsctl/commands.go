@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"sms-store/pkg/client"
+)
+
+func runPing(ctx context.Context, a *app, args []string) error {
+	status, err := a.client.Ping(ctx)
+	if err != nil {
+		return err
+	}
+	if a.output == "json" {
+		return a.printJSON(map[string]string{"status": status})
+	}
+	fmt.Fprintln(a.stdout, status)
+	return nil
+}
+
+func runStats(ctx context.Context, a *app, args []string) error {
+	health, err := a.client.Health(ctx)
+	if err != nil {
+		return err
+	}
+	if a.output == "json" {
+		return a.printJSON(health)
+	}
+	stats, err := health.ConsumerStats()
+	if err != nil {
+		return err
+	}
+	return a.printHealth(health, stats)
+}
+
+func runConversations(ctx context.Context, a *app, args []string) error {
+	phoneNumbers, err := a.client.ListConversations(ctx)
+	if err != nil {
+		return err
+	}
+	if a.output == "json" {
+		return a.printJSON(phoneNumbers)
+	}
+
+	rows := make([][]string, 0, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		rows = append(rows, []string{pn})
+	}
+	return a.printTable([]string{"PHONE NUMBER"}, rows)
+}
+
+func runMessages(ctx context.Context, a *app, args []string) error {
+	phoneNumber, err := singleArg(args, "phoneNumber")
+	if err != nil {
+		return err
+	}
+
+	messages, err := a.client.GetUserMessages(ctx, phoneNumber)
+	if err != nil {
+		return err
+	}
+	return a.printMessages(messages)
+}
+
+func runTail(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	interval := fs.Duration("interval", 2*time.Second, "polling interval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	phoneNumber, err := singleArg(fs.Args(), "phoneNumber")
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		messages, err := a.client.GetUserMessages(ctx, phoneNumber)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var fresh []client.Message
+		for _, msg := range messages {
+			if !seen[msg.ID] {
+				seen[msg.ID] = true
+				fresh = append(fresh, msg)
+			}
+		}
+		for _, msg := range fresh {
+			if a.output == "json" {
+				if err := json.NewEncoder(a.stdout).Encode(msg); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(a.stdout, "%s  %-8s  %s\n", msg.CreatedAt.Format(time.RFC3339), msg.Status, msg.Text)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func runExport(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	file := fs.String("f", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	phoneNumber, err := singleArg(fs.Args(), "phoneNumber")
+	if err != nil {
+		return err
+	}
+
+	out := a.stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	count := 0
+	it := a.client.Messages(ctx, phoneNumber)
+	for it.Next() {
+		if err := enc.Encode(it.Message()); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stderr, "exported %d messages\n", count)
+	return nil
+}
+
+func runImport(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	file := fs.String("f", "", "input NDJSON file (default stdin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	in := a.stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	imported, failed, err := importMessages(ctx, a, in)
+	fmt.Fprintf(a.stderr, "imported %d messages, %d failed\n", imported, failed)
+	return err
+}
+
+// importMessages posts each NDJSON line as a message. Bad lines are reported and skipped.
+func importMessages(ctx context.Context, a *app, in io.Reader) (int, int, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	imported, failed, line := 0, 0, 0
+	for scanner.Scan() {
+		line++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+
+		var req client.CreateMessageRequest
+		if err := json.Unmarshal([]byte(raw), &req); err != nil {
+			fmt.Fprintf(a.stderr, "line %d: invalid JSON: %v\n", line, err)
+			failed++
+			continue
+		}
+		if _, err := a.client.CreateMessage(ctx, req); err != nil {
+			if ctx.Err() != nil {
+				return imported, failed, ctx.Err()
+			}
+			fmt.Fprintf(a.stderr, "line %d: %v\n", line, err)
+			failed++
+			continue
+		}
+		imported++
+	}
+	return imported, failed, scanner.Err()
+}
+
+func runDelete(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	yes := fs.Bool("yes", false, "skip the confirmation prompt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	phoneNumber, err := singleArg(fs.Args(), "phoneNumber")
+	if err != nil {
+		return err
+	}
+
+	if !*yes {
+		ok, err := confirm(a, fmt.Sprintf("Delete ALL messages for %s? Type the phone number to confirm: ", phoneNumber), phoneNumber)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("aborted")
+		}
+	}
+
+	result, err := a.client.DeleteUserMessages(ctx, phoneNumber)
+	if err != nil {
+		return err
+	}
+	if a.output == "json" {
+		return a.printJSON(result)
+	}
+	fmt.Fprintf(a.stdout, "deleted %d messages for %s\n", result.DeletedCount, phoneNumber)
+	if result.ProfileExists != nil && *result.ProfileExists {
+		fmt.Fprintf(a.stdout, "the profile of %s was kept\n", phoneNumber)
+	}
+	return nil
+}
+
+func runProfile(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: profile get|create|update <phoneNumber> [-name N] [-avatar A]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("profile "+action, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	name := fs.String("name", "", "profile name")
+	avatar := fs.String("avatar", "", "avatar URL or base64 image")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	phoneNumber, err := singleArg(fs.Args(), "phoneNumber")
+	if err != nil {
+		return err
+	}
+
+	var profile client.Profile
+	switch action {
+	case "get":
+		profile, err = a.client.GetProfile(ctx, phoneNumber)
+	case "create":
+		profile, err = a.client.CreateProfile(ctx, client.Profile{PhoneNumber: phoneNumber, Name: *name, Avatar: *avatar})
+	case "update":
+		profile, err = a.client.UpdateProfile(ctx, phoneNumber, client.Profile{Name: *name, Avatar: *avatar})
+	default:
+		return fmt.Errorf("unknown profile action %q (want get, create or update)", action)
+	}
+	if err != nil {
+		return err
+	}
+	return a.printProfile(profile)
+}
+
+/* ---------- helpers ---------- */
+
+// singleArg validates that exactly one positional argument was given.
+func singleArg(args []string, name string) (string, error) {
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		return "", fmt.Errorf("expected exactly one <%s> argument", name)
+	}
+	return strings.TrimSpace(args[0]), nil
+}
+
+// confirm prompts the user and reports whether they typed the expected answer.
+func confirm(a *app, prompt, expected string) (bool, error) {
+	fmt.Fprint(a.stderr, prompt)
+	answer, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return strings.TrimSpace(answer) == expected, nil
+}
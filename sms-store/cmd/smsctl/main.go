@@ -0,0 +1,137 @@
+// Command smsctl is an admin CLI for the sms-store service.
+//
+// Usage:
+//
+//	smsctl [global flags] <command> [command flags] [args]
+//
+// Global flags:
+//
+//	-url string     base URL of sms-store (env SMSCTL_URL, default http://localhost:8082)
+//	-api-key string API key sent as a bearer token (env SMSCTL_API_KEY)
+//	-o string       output format: table or json (default table)
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"sms-store/pkg/client"
+)
+
+// command is a single smsctl subcommand.
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, app *app, args []string) error
+}
+
+// app carries shared state for subcommands.
+type app struct {
+	client *client.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = []command{
+	{name: "conversations", usage: "list conversations", run: runConversations},
+	{name: "messages", usage: "messages <phoneNumber>: list messages for a number", run: runMessages},
+	{name: "tail", usage: "tail [-interval 2s] <phoneNumber>: follow new messages for a number", run: runTail},
+	{name: "export", usage: "export [-f file] <phoneNumber>: export messages as NDJSON", run: runExport},
+	{name: "import", usage: "import [-f file]: import NDJSON messages via POST /messages", run: runImport},
+	{name: "delete", usage: "delete [-yes] <phoneNumber>: delete all messages for a number", run: runDelete},
+	{name: "profile", usage: "profile get|create|update <phoneNumber> [-name N] [-avatar A]", run: runProfile},
+	{name: "stats", usage: "show component health and Kafka consumer stats", run: runStats},
+	{name: "ping", usage: "check service health", run: runPing},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run parses global flags and dispatches to a subcommand. It returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("smsctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	baseURL := fs.String("url", getEnv("SMSCTL_URL", "http://localhost:8082"), "base URL of sms-store")
+	apiKey := fs.String("api-key", os.Getenv("SMSCTL_API_KEY"), "API key sent as a bearer token")
+	output := fs.String("o", "table", "output format: table or json")
+	fs.Usage = func() { printUsage(stderr, fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "invalid output format %q (want table or json)\n", *output)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	name := fs.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n", name)
+		fs.Usage()
+		return 2
+	}
+
+	cfg := client.DefaultConfig()
+	cfg.BaseURL = *baseURL
+	cfg.APIKey = *apiKey
+
+	a := &app{
+		client: client.NewWithConfig(cfg),
+		output: *output,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, a, fs.Args()[1:]); err != nil {
+		fmt.Fprintf(stderr, "smsctl %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: smsctl [global flags] <command> [command flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	sorted := make([]command, len(commands))
+	copy(sorted, commands)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	for _, c := range sorted {
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	fs.PrintDefaults()
+}
+
+// getEnv retrieves an environment variable or returns a default value.
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
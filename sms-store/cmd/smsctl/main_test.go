@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"sms-store/pkg/client"
+)
+
+// fakeServer answers the sms-store endpoints smsctl calls with canned
+// bodies and records each request as "METHOD path?query body".
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+	handlers map[string]http.HandlerFunc // By "METHOD path"
+}
+
+func newFakeServer(t *testing.T, handlers map[string]http.HandlerFunc) *fakeServer {
+	t.Helper()
+	f := &fakeServer{handlers: handlers}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+		f.mu.Unlock()
+
+		handler, ok := f.handlers[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code": "NOT_FOUND", "message": "no such route"}`)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler(w, r)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeServer) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// respond answers with status and body.
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}
+}
+
+// runSmsctl runs smsctl against srv with stdin and returns its exit code,
+// stdout and stderr.
+func runSmsctl(srv *fakeServer, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-url", srv.URL}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+const twoMessages = `[
+	{"id": "m2", "phoneNumber": "9876543210", "text": "second", "status": "DELIVERED", "createdAt": "2026-10-14T10:01:00Z"},
+	{"id": "m1", "phoneNumber": "9876543210", "text": "first", "status": "RECEIVED", "createdAt": "2026-10-14T10:00:00Z"}
+]`
+
+func TestSubcommands(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"GET /ping":                           respond(200, `{"status": "ok"}`),
+		"GET /v1/conversations":               respond(200, `["9876543210", "1111111111"]`),
+		"GET /v1/user/9876543210/messages":    respond(200, twoMessages),
+		"GET /v1/profile/9876543210":          respond(200, `{"phoneNumber": "9876543210", "name": "Ram", "updatedAt": "2026-10-14T10:00:00Z"}`),
+		"POST /v1/profile":                    respond(201, `{"phoneNumber": "9876543210", "name": "Ram", "updatedAt": "2026-10-14T10:00:00Z"}`),
+		"PUT /v1/profile/9876543210":          respond(200, `{"phoneNumber": "9876543210", "name": "Ramesh", "updatedAt": "2026-10-14T11:00:00Z"}`),
+		"DELETE /v1/user/9876543210/messages": respond(200, `{"message": "deleted", "deletedCount": 2, "phoneNumber": "9876543210", "profileExists": true}`),
+		"GET /healthz": respond(200, `{"status": "UP", "version": {"version": "1.4.0"}, "components": {
+			"mongodb": {"status": "up"},
+			"kafka": {"status": "up", "details": {"state": "running", "stats": {"topic": "sms-events", "groupId": "sms-store-consumer-group", "messagesReceived": 120, "messagesSaved": 118, "parseErrors": 2, "inFlight": 3}}}
+		}}`),
+	}
+
+	for _, tc := range []struct {
+		name         string
+		args         []string
+		wantRequests []string
+		wantStdout   []string // Substrings
+	}{
+		{"Ping", []string{"ping"}, []string{"GET /ping"}, []string{"ok"}},
+		{"PingJSON", []string{"-o", "json", "ping"}, []string{"GET /ping"}, []string{`"status": "ok"`}},
+		{"Conversations", []string{"conversations"}, []string{"GET /v1/conversations"}, []string{"PHONE NUMBER", "9876543210", "1111111111"}},
+		{"Messages", []string{"messages", "9876543210"}, []string{"GET /v1/user/9876543210/messages"}, []string{"m2", "2026-10-14T10:01:00Z", "DELIVERED", "second", "m1", "first"}},
+		{"MessagesJSON", []string{"-o", "json", "messages", "9876543210"}, []string{"GET /v1/user/9876543210/messages"}, []string{`"id": "m2"`, `"text": "first"`}},
+		{"ProfileGet", []string{"profile", "get", "9876543210"}, []string{"GET /v1/profile/9876543210"}, []string{"9876543210", "Ram"}},
+		{"ProfileCreate", []string{"profile", "create", "-name", "Ram", "9876543210"}, []string{`POST /v1/profile {"phoneNumber":"9876543210","name":"Ram","avatar":"","createdAt":"0001-01-01T00:00:00Z","updatedAt":"0001-01-01T00:00:00Z"}`}, []string{"Ram"}},
+		{"ProfileUpdate", []string{"profile", "update", "-name", "Ramesh", "9876543210"}, []string{`PUT /v1/profile/9876543210 {"phoneNumber":"","name":"Ramesh","avatar":"","createdAt":"0001-01-01T00:00:00Z","updatedAt":"0001-01-01T00:00:00Z"}`}, []string{"Ramesh"}},
+		{"DeleteYes", []string{"delete", "-yes", "9876543210"}, []string{"DELETE /v1/user/9876543210/messages"}, []string{"deleted 2 messages for 9876543210", "the profile of 9876543210 was kept"}},
+		{"Stats", []string{"stats"}, []string{"GET /healthz"}, []string{"status: UP (version 1.4.0)", "kafka", "mongodb", "sms-events", "received", "120", "saved", "118", "in flight"}},
+		{"StatsJSON", []string{"-o", "json", "stats"}, []string{"GET /healthz"}, []string{`"status": "UP"`, `"messagesReceived": 120`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t, handlers)
+			code, stdout, stderr := runSmsctl(srv, "", tc.args...)
+			if code != 0 {
+				t.Fatalf("exit %d, stderr %s", code, stderr)
+			}
+			if got := srv.Requests(); strings.Join(got, "\n") != strings.Join(tc.wantRequests, "\n") {
+				t.Fatalf("requests %q, want %q", got, tc.wantRequests)
+			}
+			for _, want := range tc.wantStdout {
+				if !strings.Contains(stdout, want) {
+					t.Fatalf("stdout lacks %q:\n%s", want, stdout)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteConfirmation(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"DELETE /v1/user/9876543210/messages": respond(200, `{"message": "deleted", "deletedCount": 2, "phoneNumber": "9876543210"}`),
+	}
+	for _, tc := range []struct {
+		name    string
+		stdin   string
+		deleted bool
+	}{
+		{"TypedNumber", "9876543210\n", true},
+		{"TypedNumberWithoutNewline", "9876543210", true},
+		{"TypedOtherNumber", "1111111111\n", false},
+		{"TypedYes", "yes\n", false},
+		{"NoInput", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t, handlers)
+			code, stdout, stderr := runSmsctl(srv, tc.stdin, "delete", "9876543210")
+			if !strings.Contains(stderr, "Type the phone number to confirm") {
+				t.Fatalf("stderr lacks the prompt: %s", stderr)
+			}
+			requests := srv.Requests()
+			if tc.deleted {
+				if code != 0 || len(requests) != 1 || !strings.Contains(stdout, "deleted 2 messages") {
+					t.Fatalf("exit %d, requests %q, stdout %s; want the messages deleted", code, requests, stdout)
+				}
+				return
+			}
+			if code != 1 || len(requests) != 0 || !strings.Contains(stderr, "aborted") {
+				t.Fatalf("exit %d, requests %q, stderr %s; want an abort without a request", code, requests, stderr)
+			}
+		})
+	}
+}
+
+func TestExportPagesToFile(t *testing.T) {
+	srv := newFakeServer(t, map[string]http.HandlerFunc{
+		"GET /v1/user/9876543210/messages": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("cursor") == "" {
+				fmt.Fprint(w, `{"data": [{"id": "m3"}, {"id": "m2"}], "meta": {"limit": 200, "hasMore": true, "nextCursor": "c1"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"data": [{"id": "m1"}], "meta": {"limit": 200, "hasMore": false}}`)
+		},
+	})
+	file := filepath.Join(t.TempDir(), "export.ndjson")
+
+	code, _, stderr := runSmsctl(srv, "", "export", "-f", file, "9876543210")
+	if code != 0 {
+		t.Fatalf("exit %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "exported 3 messages") {
+		t.Fatalf("stderr = %s, want 3 exported", stderr)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var msg client.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		ids = append(ids, msg.ID)
+	}
+	if fmt.Sprint(ids) != "[m3 m2 m1]" {
+		t.Fatalf("exported %v, want m3 m2 m1", ids)
+	}
+}
+
+func TestImportSkipsBadLines(t *testing.T) {
+	srv := newFakeServer(t, map[string]http.HandlerFunc{
+		"POST /messages": func(w http.ResponseWriter, r *http.Request) {
+			var req client.CreateMessageRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Text == "" {
+				respond(400, `{"code": "BAD_REQUEST", "message": "text is required"}`)(w, r)
+				return
+			}
+			respond(201, `{"id": "new"}`)(w, r)
+		},
+	})
+	stdin := strings.Join([]string{
+		`{"phoneNumber": "9876543210", "text": "one"}`,
+		``,
+		`not json`,
+		`{"phoneNumber": "9876543210", "text": ""}`,
+		`{"phoneNumber": "9876543210", "text": "two"}`,
+	}, "\n")
+
+	code, _, stderr := runSmsctl(srv, stdin, "import")
+	if code != 0 {
+		t.Fatalf("exit %d, stderr %s", code, stderr)
+	}
+	for _, want := range []string{"line 3: invalid JSON", "line 4: sms-store: BAD_REQUEST (HTTP 400): text is required", "imported 2 messages, 2 failed"} {
+		if !strings.Contains(stderr, want) {
+			t.Fatalf("stderr lacks %q:\n%s", want, stderr)
+		}
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Fatalf("%d requests, want 3 for the lines that parsed", n)
+	}
+}
+
+func TestTailPrintsNewMessagesOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var polls int
+	srv := newFakeServer(t, map[string]http.HandlerFunc{
+		"GET /v1/user/9876543210/messages": func(w http.ResponseWriter, r *http.Request) {
+			polls++
+			switch polls {
+			case 1:
+				fmt.Fprint(w, `[{"id": "m1", "text": "first", "status": "RECEIVED", "createdAt": "2026-10-14T10:00:00Z"}]`)
+			case 2:
+				fmt.Fprint(w, `[{"id": "m2", "text": "second", "status": "RECEIVED", "createdAt": "2026-10-14T10:01:00Z"}, {"id": "m1", "text": "first", "status": "RECEIVED", "createdAt": "2026-10-14T10:00:00Z"}]`)
+			default:
+				cancel()
+			}
+		},
+	})
+
+	var stdout, stderr bytes.Buffer
+	a := &app{client: client.New(srv.URL), output: "table", stdout: &stdout, stderr: &stderr}
+	if err := runTail(ctx, a, []string{"-interval", "5ms", "9876543210"}); err != nil {
+		t.Fatalf("runTail: %v", err)
+	}
+	want := "2026-10-14T10:00:00Z  RECEIVED  first\n2026-10-14T10:01:00Z  RECEIVED  second\n"
+	if stdout.String() != want {
+		t.Fatalf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	for _, tc := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{nil, 2, "Usage: smsctl"},
+		{[]string{"nope"}, 2, `unknown command "nope"`},
+		{[]string{"-o", "yaml", "ping"}, 2, `invalid output format "yaml"`},
+		{[]string{"messages"}, 1, "expected exactly one <phoneNumber> argument"},
+		{[]string{"profile", "rename", "9876543210"}, 1, `unknown profile action "rename"`},
+		{[]string{"messages", "0000000000"}, 1, "sms-store: NOT_FOUND (HTTP 404): no such route"},
+	} {
+		code, _, stderr := runSmsctl(srv, "", tc.args...)
+		if code != tc.code || !strings.Contains(stderr, tc.stderr) {
+			t.Errorf("smsctl %q: exit %d, stderr %s; want %d and %q", tc.args, code, stderr, tc.code, tc.stderr)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sms-store/pkg/client"
+)
+
+// printJSON writes v as indented JSON.
+func (a *app) printJSON(v any) error {
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable writes rows as an aligned table with a header line.
+func (a *app) printTable(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (a *app) printMessages(messages []client.Message) error {
+	if a.output == "json" {
+		return a.printJSON(messages)
+	}
+
+	rows := make([][]string, 0, len(messages))
+	for _, msg := range messages {
+		rows = append(rows, []string{msg.ID, msg.CreatedAt.Format(time.RFC3339), msg.Status, truncate(msg.Text, 60)})
+	}
+	return a.printTable([]string{"ID", "CREATED AT", "STATUS", "TEXT"}, rows)
+}
+
+func (a *app) printProfile(profile client.Profile) error {
+	if a.output == "json" {
+		return a.printJSON(profile)
+	}
+
+	return a.printTable([]string{"PHONE NUMBER", "NAME", "AVATAR", "UPDATED AT"}, [][]string{{
+		profile.PhoneNumber,
+		profile.Name,
+		truncate(profile.Avatar, 40),
+		profile.UpdatedAt.Format(time.RFC3339),
+	}})
+}
+
+// printHealth writes the service status, a table of its components and,
+// when the Kafka consumer runs, a table of its counters.
+func (a *app) printHealth(health client.Health, stats *client.ConsumerStats) error {
+	fmt.Fprintf(a.stdout, "status: %s (version %s)\n\n", health.Status, cmp.Or(health.Version.Version, "unknown"))
+
+	names := slices.Sorted(maps.Keys(health.Components))
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		c := health.Components[name]
+		rows = append(rows, []string{name, c.Status, truncate(c.Message, 60)})
+	}
+	if err := a.printTable([]string{"COMPONENT", "STATUS", "MESSAGE"}, rows); err != nil {
+		return err
+	}
+	if stats == nil {
+		return nil
+	}
+
+	lastMessage := "-"
+	if stats.LastMessageAt != nil {
+		lastMessage = stats.LastMessageAt.Format(time.RFC3339)
+	}
+	fmt.Fprintln(a.stdout)
+	return a.printTable([]string{"CONSUMER", "VALUE"}, [][]string{
+		{"topic", stats.Topic},
+		{"group", stats.GroupID},
+		{"received", strconv.FormatInt(stats.MessagesReceived, 10)},
+		{"saved", strconv.FormatInt(stats.MessagesSaved, 10)},
+		{"parse errors", strconv.FormatInt(stats.ParseErrors, 10)},
+		{"batches flushed", strconv.FormatInt(stats.BatchesFlushed, 10)},
+		{"batch errors", strconv.FormatInt(stats.BatchErrors, 10)},
+		{"dead-lettered", strconv.FormatInt(stats.DeadLettered, 10)},
+		{"duplicates suppressed", strconv.FormatInt(stats.DuplicatesSuppressed, 10)},
+		{"in flight", strconv.Itoa(stats.InFlight)},
+		{"last message", lastMessage},
+	})
+}
+
+// truncate shortens s to at most n runes for table output.
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
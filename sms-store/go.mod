@@ -5,6 +5,7 @@ go 1.24.4
 require (
 	github.com/IBM/sarama v1.46.3
 	go.mongodb.org/mongo-driver v1.17.6
+	golang.org/x/text v0.30.0
 )
 
 require (
@@ -30,5 +31,4 @@ require (
 	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/net v0.46.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
-	golang.org/x/text v0.30.0 // indirect
 )
@@ -0,0 +1,228 @@
+// Package autoack answers the first inbound message of a new conversation
+// with an automatic acknowledgement, such as "We received your message",
+// as each account's models.AutoAckConfig asks. A conversation is new when
+// its number sent nothing within the config's window; it gets at most one
+// acknowledgement per window, however many messages it sends and however
+// many consumers store them.
+package autoack
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// Outcomes of an inbound message considered for an acknowledgement.
+const (
+	outcomeSent    = "sent"
+	outcomeStale   = "stale"   // Stored longer than the window after it was sent
+	outcomeOngoing = "ongoing" // The number sent another message within the window
+	outcomeClaimed = "claimed" // The conversation was acknowledged within the window, perhaps by another consumer
+	outcomeFailed  = "failed"
+)
+
+var acks = metrics.NewCounterVec(
+	"auto_acks_total",
+	"First inbound messages considered for an automatic acknowledgement, by outcome.",
+	"outcome",
+)
+
+// Templates are the texts of acknowledgements by template ID, as Go
+// text/template with the fields PhoneNumber and AccountID. An ID may have
+// variants by language, as received.hi next to received: a message
+// detected in a language is answered with its variant when there is one.
+type Templates struct {
+	byID map[string]*template.Template
+}
+
+// ParseTemplates parses an AUTO_ACK_TEMPLATES setting: a JSON object of
+// texts by template ID, e.g. {"received": "We received your message"}.
+func ParseTemplates(raw string) (*Templates, error) {
+	t := &Templates{byID: make(map[string]*template.Template)}
+	if strings.TrimSpace(raw) == "" {
+		return t, nil
+	}
+	var texts map[string]string
+	if err := json.Unmarshal([]byte(raw), &texts); err != nil {
+		return nil, errors.New("templates must be a JSON object of texts by template ID")
+	}
+	for id, text := range texts {
+		if strings.TrimSpace(id) == "" || strings.TrimSpace(text) == "" {
+			return nil, errors.New("template IDs and texts must not be empty")
+		}
+		parsed, err := template.New(id).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", id, err)
+		}
+		t.byID[id] = parsed
+	}
+	return t, nil
+}
+
+// Has reports whether id names a template.
+func (t *Templates) Has(id string) bool {
+	_, ok := t.byID[id]
+	return ok
+}
+
+// IDs returns the template IDs, language variants included, sorted.
+func (t *Templates) IDs() []string {
+	return slices.Sorted(maps.Keys(t.byID))
+}
+
+// Render returns the text of template id answering msg.
+func (t *Templates) Render(id string, msg models.Message) (string, error) {
+	tmpl, ok := t.byID[id]
+	if msg.Language != nil {
+		lang, _, _ := strings.Cut(msg.Language.Code, "-")
+		if variant, found := t.byID[id+"."+strings.ToLower(lang)]; found {
+			tmpl, ok = variant, true
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("no template %s", id)
+	}
+	var out bytes.Buffer
+	data := struct{ PhoneNumber, AccountID string }{msg.PhoneNumber, cmp.Or(msg.AccountID, models.DefaultAccountID)}
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", id, err)
+	}
+	return out.String(), nil
+}
+
+// Acknowledger sends the acknowledgements of stored inbound messages.
+type Acknowledger struct {
+	configs   store.AutoAckStore
+	templates *Templates
+	messages  store.Store
+	summaries store.SummaryStore
+
+	clock.Clocked // Tells the time of acknowledgements and windows
+}
+
+// New returns an acknowledger reading configs from configs and rendering
+// templates. It checks for earlier messages in messages, where it also
+// stores the acknowledgements as outbound messages, and claims each
+// conversation's acknowledgement on its summary in summaries.
+func New(configs store.AutoAckStore, templates *Templates, messages store.Store, summaries store.SummaryStore) *Acknowledger {
+	return &Acknowledger{configs: configs, templates: templates, messages: messages, summaries: summaries}
+}
+
+// Templates returns the templates acknowledgements are rendered from.
+func (a *Acknowledger) Templates() *Templates {
+	return a.templates
+}
+
+// Acknowledge answers the first inbound message of each conversation among
+// msgs, just stored, when its account has acknowledgements enabled and:
+//
+//   - it was sent within the window, so replayed and backfilled messages
+//     aren't answered late;
+//   - the number sent no inbound message within the window before it;
+//   - the conversation's summary can be claimed, being unacknowledged
+//     within the window. The claim is atomic, so of two near-simultaneous
+//     first messages only one is answered.
+//
+// The acknowledgement is stored as an outbound reply with Source
+// models.MessageSourceAutoAck, which leaves it out of unread counts.
+// Failures are logged; the messages are already stored.
+func (a *Acknowledger) Acknowledge(msgs []models.Message) {
+	firsts := make(map[string]models.Message)
+	var phoneNumbers []string
+	for _, msg := range msgs {
+		if msg.Direction != models.DirectionInbound || msg.PhoneNumber == "" || msg.DuplicateOf != "" {
+			continue
+		}
+		first, ok := firsts[msg.PhoneNumber]
+		if !ok {
+			phoneNumbers = append(phoneNumbers, msg.PhoneNumber)
+		}
+		if !ok || msg.CreatedAt.Before(first.CreatedAt) || msg.CreatedAt.Equal(first.CreatedAt) && msg.ID < first.ID {
+			firsts[msg.PhoneNumber] = msg
+		}
+	}
+
+	configs := make(map[string]models.AutoAckConfig)
+	for _, pn := range phoneNumbers {
+		msg := firsts[pn]
+		account := cmp.Or(msg.AccountID, models.DefaultAccountID)
+		config, ok := configs[account]
+		if !ok {
+			var err error
+			if config, err = a.configs.GetAutoAckConfig(account); err != nil {
+				log.Printf("Error reading auto-ack config of account %s: %v", account, err)
+			}
+			configs[account] = config
+		}
+		if !config.Enabled {
+			continue
+		}
+		outcome, err := a.acknowledge(msg, config)
+		acks.WithLabelValues(outcome).Inc()
+		if err != nil {
+			log.Printf("Error acknowledging message %s from %s: %v", msg.ID, pn, err)
+		}
+	}
+}
+
+func (a *Acknowledger) acknowledge(msg models.Message, config models.AutoAckConfig) (string, error) {
+	now := a.Clock().Now()
+	window := config.WindowDuration()
+	if msg.CreatedAt.Before(now.Add(-window)) {
+		return outcomeStale, nil
+	}
+
+	prior, err := a.messages.FindByPhoneNumberPage(msg.PhoneNumber, store.PageQuery{
+		Limit:     1,
+		Direction: models.DirectionInbound,
+		Before:    msg.CreatedAt,
+		BeforeID:  msg.ID,
+	})
+	if err != nil {
+		return outcomeFailed, fmt.Errorf("failed to read earlier messages: %w", err)
+	}
+	if len(prior) > 0 && !prior[0].CreatedAt.Before(msg.CreatedAt.Add(-window)) {
+		return outcomeOngoing, nil
+	}
+
+	text, err := a.templates.Render(config.TemplateID, msg)
+	if err != nil {
+		return outcomeFailed, err
+	}
+	claimed, err := a.summaries.ClaimAutoAck(msg.PhoneNumber, now.Add(-window), now)
+	if err != nil {
+		return outcomeFailed, err
+	}
+	if !claimed {
+		return outcomeClaimed, nil
+	}
+
+	ack := models.Message{
+		ID:          "ack-" + msg.ID,
+		PhoneNumber: msg.PhoneNumber,
+		SenderType:  msg.SenderType,
+		Text:        text,
+		Status:      "RECEIVED",
+		CreatedAt:   now,
+		ReceivedAt:  now,
+		AccountID:   msg.AccountID,
+		ReplyToID:   msg.ID,
+		Source:      models.MessageSourceAutoAck,
+	}
+	if _, err := a.messages.Save(ack); err != nil {
+		return outcomeFailed, fmt.Errorf("failed to store acknowledgement: %w", err)
+	}
+	return outcomeSent, nil
+}
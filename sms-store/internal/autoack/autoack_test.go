@@ -0,0 +1,103 @@
+package autoack
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// newTestAcknowledger returns an acknowledger with acknowledgements enabled
+// on the default account and the stores it writes to. With summarize, the
+// messages it is given are saved through a SummarizingStore first, as the
+// consumer saves them; without, their conversation has no summary yet.
+func newTestAcknowledger(t *testing.T, msgs []models.Message, summarize bool) (*Acknowledger, *store.MemoryStore) {
+	t.Helper()
+	messages := store.NewMemoryStore()
+	summaries := store.NewMemorySummaryStore(messages)
+	var saver store.Store = messages
+	if summarize {
+		saver = store.NewSummarizingStore(messages, summaries)
+	}
+	if _, err := saver.SaveBatch(msgs); err != nil {
+		t.Fatalf("SaveBatch: %v", err)
+	}
+
+	configs := store.NewMemoryAutoAckStore()
+	if _, err := configs.PutAutoAckConfig(models.AutoAckConfig{AccountID: models.DefaultAccountID, Enabled: true, TemplateID: "received", Window: "24h"}); err != nil {
+		t.Fatalf("PutAutoAckConfig: %v", err)
+	}
+	templates, err := ParseTemplates(`{"received": "We received your message"}`)
+	if err != nil {
+		t.Fatalf("ParseTemplates: %v", err)
+	}
+	return New(configs, templates, messages, summaries), messages
+}
+
+// acksOf returns the acknowledgements stored for phoneNumber.
+func acksOf(t *testing.T, s *store.MemoryStore, phoneNumber string) []models.Message {
+	t.Helper()
+	stored, err := s.FindByPhoneNumber(phoneNumber)
+	if err != nil {
+		t.Fatalf("FindByPhoneNumber: %v", err)
+	}
+	var acks []models.Message
+	for _, msg := range stored {
+		if msg.Source == models.MessageSourceAutoAck {
+			acks = append(acks, msg)
+		}
+	}
+	return acks
+}
+
+func TestConcurrentAcknowledgeSendsOneAck(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		summarize bool
+	}{
+		{"WithSummary", true},
+		{"WithoutSummary", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			first := models.Message{ID: "m1", PhoneNumber: "9876543210", Text: "hello", Direction: models.DirectionInbound, CreatedAt: time.Now().UTC()}
+			a, messages := newTestAcknowledger(t, []models.Message{first}, tc.summarize)
+
+			const callers = 10
+			var wg sync.WaitGroup
+			for range callers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					a.Acknowledge([]models.Message{first})
+				}()
+			}
+			wg.Wait()
+
+			acks := acksOf(t, messages, "9876543210")
+			if len(acks) != 1 {
+				t.Fatalf("%d concurrent Acknowledge calls stored %d acknowledgements, want 1", callers, len(acks))
+			}
+			if ack := acks[0]; ack.ID != "ack-m1" || ack.ReplyToID != "m1" || ack.Text != "We received your message" || ack.Direction != "" {
+				t.Fatalf("acknowledgement = %+v, want an outbound reply to m1", ack)
+			}
+		})
+	}
+}
+
+func TestAcknowledgeSkipsOngoingAndStaleMessages(t *testing.T) {
+	now := time.Now().UTC()
+	earlier := models.Message{ID: "m1", PhoneNumber: "9876543210", Text: "hello", Direction: models.DirectionInbound, CreatedAt: now.Add(-time.Hour)}
+	next := models.Message{ID: "m2", PhoneNumber: "9876543210", Text: "again", Direction: models.DirectionInbound, CreatedAt: now}
+	stale := models.Message{ID: "m3", PhoneNumber: "1111111111", Text: "old", Direction: models.DirectionInbound, CreatedAt: now.Add(-48 * time.Hour)}
+	a, messages := newTestAcknowledger(t, []models.Message{earlier, next, stale}, true)
+
+	a.Acknowledge([]models.Message{next, stale})
+	if acks := acksOf(t, messages, "9876543210"); len(acks) != 0 {
+		t.Fatalf("message within the window of an earlier one got %d acknowledgements, want 0", len(acks))
+	}
+	if acks := acksOf(t, messages, "1111111111"); len(acks) != 0 {
+		t.Fatalf("stale message got %d acknowledgements, want 0", len(acks))
+	}
+}
@@ -0,0 +1,40 @@
+// Package clock tells the time, so code whose behavior depends on it, such
+// as expiry, retention and schedules, can be driven by a fake clock. Types
+// that read the time embed Clocked, which tells it by the system clock
+// until SetClock replaces it. How long something took is still measured
+// with time.Since: a fake clock has no monotonic reading to offer.
+package clock
+
+import "time"
+
+// Clock tells the time and waits for it.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the system clock.
+type Real struct{}
+
+func (Real) Now() time.Time                         { return time.Now() }
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Clocked is embedded by types that read the time. Its zero value uses the
+// system clock.
+type Clocked struct {
+	clock Clock
+}
+
+// SetClock makes the value tell the time by c. It must be called before the
+// value is used.
+func (k *Clocked) SetClock(c Clock) {
+	k.clock = c
+}
+
+// Clock returns the clock the value tells the time by.
+func (k *Clocked) Clock() Clock {
+	if k.clock == nil {
+		return Real{}
+	}
+	return k.clock
+}
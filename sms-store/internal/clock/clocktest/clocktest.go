@@ -0,0 +1,98 @@
+// Package clocktest provides a fake clock for tests of code that reads the
+// time through a clock.Clock.
+package clocktest
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Fake is a clock.Clock whose time only moves when told to. Channels from
+// After receive once Advance or Set reaches their deadline.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	waited  chan struct{} // Closed and replaced whenever After is called
+}
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFake returns a fake clock reading start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start, waited: make(chan struct{})}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After returns a channel receiving the time once the clock has moved d on.
+// A d of 0 or less receives at once.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+	} else {
+		f.waiters = append(f.waiters, waiter{deadline: f.now.Add(d), ch: ch})
+	}
+	close(f.waited)
+	f.waited = make(chan struct{})
+	return ch
+}
+
+// Advance moves the clock d on, waking the waiters whose deadline it
+// reaches, earliest first.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	t := f.now.Add(d)
+	f.mu.Unlock()
+	f.Set(t)
+}
+
+// Set moves the clock to t, waking the waiters whose deadline it reaches,
+// earliest first. The clock never moves back: an earlier t is ignored.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.Before(f.now) {
+		return
+	}
+	f.now = t
+	slices.SortStableFunc(f.waiters, func(a, b waiter) int { return a.deadline.Compare(b.deadline) })
+	due := 0
+	for due < len(f.waiters) && !f.waiters[due].deadline.After(t) {
+		f.waiters[due].ch <- t
+		due++
+	}
+	f.waiters = slices.Delete(f.waiters, 0, due)
+}
+
+// Waiters returns how many After channels are waiting for the clock.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until n After channels are waiting for the clock, so a
+// test can advance it once the code under test has gone to sleep.
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		waiting, waited := len(f.waiters), f.waited
+		f.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		<-waited
+	}
+}
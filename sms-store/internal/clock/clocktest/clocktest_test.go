@@ -0,0 +1,86 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+func received(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeWakesWaitersAtTheirDeadline(t *testing.T) {
+	f := NewFake(start)
+	late, early := f.After(2*time.Minute), f.After(time.Minute)
+	if f.Waiters() != 2 {
+		t.Fatalf("Waiters = %d, want 2", f.Waiters())
+	}
+
+	f.Advance(59 * time.Second)
+	if _, ok := received(early); ok {
+		t.Fatal("woke before the deadline")
+	}
+	f.Advance(time.Second)
+	if got, ok := received(early); !ok || !got.Equal(start.Add(time.Minute)) {
+		t.Fatalf("early waiter received %v, %v; want the deadline", got, ok)
+	}
+	if _, ok := received(late); ok || f.Waiters() != 1 {
+		t.Fatalf("the late waiter woke early, or %d waiters left", f.Waiters())
+	}
+
+	// Set past the deadline wakes with the time set, not the deadline
+	f.Set(start.Add(time.Hour))
+	if got, ok := received(late); !ok || !got.Equal(start.Add(time.Hour)) {
+		t.Fatalf("late waiter received %v, %v", got, ok)
+	}
+	if !f.Now().Equal(start.Add(time.Hour)) {
+		t.Fatalf("Now = %v", f.Now())
+	}
+}
+
+func TestFakeAfterZeroReceivesAtOnce(t *testing.T) {
+	f := NewFake(start)
+	for _, d := range []time.Duration{0, -time.Second} {
+		if got, ok := received(f.After(d)); !ok || !got.Equal(start) {
+			t.Fatalf("After(%v) received %v, %v; want now at once", d, got, ok)
+		}
+	}
+	if f.Waiters() != 0 {
+		t.Fatalf("Waiters = %d, want 0", f.Waiters())
+	}
+}
+
+func TestFakeNeverMovesBack(t *testing.T) {
+	f := NewFake(start)
+	f.Set(start.Add(-time.Hour))
+	f.Advance(-time.Minute)
+	if !f.Now().Equal(start) {
+		t.Fatalf("Now = %v, want %v", f.Now(), start)
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(start)
+	woke := make(chan time.Time)
+	go func() {
+		woke <- <-f.After(time.Second)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	select {
+	case got := <-woke:
+		if !got.Equal(start.Add(time.Second)) {
+			t.Fatalf("woke at %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiter didn't wake")
+	}
+}
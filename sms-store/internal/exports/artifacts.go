@@ -0,0 +1,190 @@
+// Package exports keeps finished export files on disk so they can be
+// downloaded, and resumed, after the job that built them is done.
+//
+// An export is written to a temporary file and renamed into place only when
+// complete, so a download never sees a partial file. Files are immutable
+// once committed and expire after a TTL.
+//
+// The package also signs links that grant access to one conversation's export
+// without an API key.
+package exports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"sms-store/internal/clock"
+)
+
+// ErrNotFound is returned for exports that don't exist or have expired.
+var ErrNotFound = errors.New("export not found")
+
+const (
+	artifactExt = ".ndjson"
+	partialExt  = ".partial"
+)
+
+// validID keeps artifact IDs (job IDs) from escaping the directory.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Artifacts is a directory of export files.
+type Artifacts struct {
+	dir string
+	ttl time.Duration
+
+	clock.Clocked
+}
+
+// NewArtifacts stores exports in dir, creating it if needed. Exports are
+// removed ttl after they were committed.
+func NewArtifacts(dir string, ttl time.Duration) (*Artifacts, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	return &Artifacts{dir: dir, ttl: ttl}, nil
+}
+
+// TTL returns how long committed exports are kept.
+func (a *Artifacts) TTL() time.Duration {
+	return a.ttl
+}
+
+// Writer receives the contents of one export.
+type Writer struct {
+	*os.File
+	a  *Artifacts
+	id string
+}
+
+// Create starts writing the export id. Call Commit when done, or Abort.
+func (a *Artifacts) Create(id string) (*Writer, error) {
+	if !validID.MatchString(id) {
+		return nil, fmt.Errorf("invalid export ID: %q", id)
+	}
+	f, err := os.CreateTemp(a.dir, id+"-*"+partialExt)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{File: f, a: a, id: id}, nil
+}
+
+// Commit flushes the export to disk and makes it available for download.
+// It returns the file size.
+func (w *Writer) Commit() (int64, error) {
+	if err := w.Sync(); err != nil {
+		w.Abort()
+		return 0, err
+	}
+	info, err := w.Stat()
+	if err != nil {
+		w.Abort()
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(w.Name())
+		return 0, err
+	}
+	if err := os.Rename(w.Name(), w.a.path(w.id)); err != nil {
+		os.Remove(w.Name())
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Abort discards a partially written export.
+func (w *Writer) Abort() {
+	w.Close()
+	os.Remove(w.Name())
+}
+
+// Artifact is an open, committed export.
+type Artifact struct {
+	*os.File
+	Size      int64
+	ModTime   time.Time
+	ExpiresAt time.Time
+	ETag      string // Strong validator; the file never changes once committed
+}
+
+// Open opens the export id for reading. The caller must close it.
+func (a *Artifacts) Open(id string) (*Artifact, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(a.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	expiresAt := info.ModTime().Add(a.ttl)
+	if !a.Clock().Now().Before(expiresAt) {
+		f.Close()
+		os.Remove(a.path(id))
+		return nil, ErrNotFound
+	}
+
+	return &Artifact{
+		File:      f,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		ExpiresAt: expiresAt,
+		ETag:      fmt.Sprintf(`"%s-%x-%x"`, id, info.Size(), info.ModTime().UnixNano()),
+	}, nil
+}
+
+// Sweep removes expired exports and partial files left behind by a crash.
+// It returns how many files were removed.
+func (a *Artifacts) Sweep() (int, error) {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := a.Clock().Now().Add(-a.ttl)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, artifactExt) || strings.HasSuffix(name, partialExt)) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(a.dir, name)); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// SweepTask runs Sweep as a scheduled task.
+func (a *Artifacts) SweepTask(context.Context) error {
+	n, err := a.Sweep()
+	if err != nil {
+		return fmt.Errorf("failed to sweep expired exports: %w", err)
+	}
+	if n > 0 {
+		log.Printf("Removed %d expired export file(s)", n)
+	}
+	return nil
+}
+
+func (a *Artifacts) path(id string) string {
+	return filepath.Join(a.dir, id+artifactExt)
+}
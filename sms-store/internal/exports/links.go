@@ -0,0 +1,110 @@
+package exports
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"sms-store/internal/clock"
+)
+
+var (
+	// ErrInvalidLink is returned for tokens that are malformed or whose
+	// signature matches none of the signer's secrets.
+	ErrInvalidLink = errors.New("invalid export link")
+
+	// ErrLinkExpired is returned for correctly signed tokens past their expiry.
+	ErrLinkExpired = errors.New("export link has expired")
+)
+
+// Link is what a signed export link grants: the export of one conversation
+// until ExpiresAt.
+type Link struct {
+	PhoneNumber string    `json:"p"`
+	ExpiresAt   time.Time `json:"-"`
+	Expires     int64     `json:"exp"` // Unix seconds; the signed form of ExpiresAt
+}
+
+// LinkSigner signs export links with a server secret. Tokens are the
+// base64url JSON payload and its HMAC-SHA256, joined by a dot.
+//
+// Secrets are rotated by making the new secret current and passing the old
+// one as previous until links signed with it have expired: new links are
+// signed with the current secret, and links signed with any of them verify.
+type LinkSigner struct {
+	keys [][]byte // keys[0] signs
+
+	clock.Clocked
+}
+
+// NewLinkSigner signs with secret and also accepts links signed with any of
+// previous. Empty previous secrets are ignored.
+func NewLinkSigner(secret string, previous ...string) (*LinkSigner, error) {
+	if secret == "" {
+		return nil, errors.New("export link secret must not be empty")
+	}
+	s := &LinkSigner{keys: [][]byte{[]byte(secret)}}
+	for _, p := range previous {
+		if p = strings.TrimSpace(p); p != "" {
+			s.keys = append(s.keys, []byte(p))
+		}
+	}
+	return s, nil
+}
+
+// Sign returns a token for the export of phoneNumber valid until expiresAt.
+func (s *LinkSigner) Sign(phoneNumber string, expiresAt time.Time) (string, error) {
+	payload, err := json.Marshal(Link{PhoneNumber: phoneNumber, Expires: expiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac(s.keys[0], encoded)), nil
+}
+
+// Verify checks token's signature against every secret, then its expiry.
+func (s *LinkSigner) Verify(token string) (Link, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Link{}, ErrInvalidLink
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return Link{}, ErrInvalidLink
+	}
+
+	valid := false
+	for _, key := range s.keys {
+		if hmac.Equal(got, mac(key, encoded)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return Link{}, ErrInvalidLink
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Link{}, ErrInvalidLink
+	}
+	var link Link
+	if err := json.Unmarshal(payload, &link); err != nil || link.PhoneNumber == "" {
+		return Link{}, ErrInvalidLink
+	}
+	link.ExpiresAt = time.Unix(link.Expires, 0).UTC()
+	if !s.Clock().Now().Before(link.ExpiresAt) {
+		return link, ErrLinkExpired
+	}
+	return link, nil
+}
+
+func mac(key []byte, payload string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
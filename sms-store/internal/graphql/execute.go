@@ -0,0 +1,498 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Request is a GraphQL request, as POSTed in JSON.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of a Request. Data is absent when the request
+// failed before execution.
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is an error of a Request, at the locations of the query it concerns
+// and, once executing, at the path of the field.
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	Path      []any      `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Options limits what a query may do. Zero limits are no limits.
+type Options struct {
+	// MaxDepth is how deeply fields may be nested; those of the query type
+	// are at depth 1.
+	MaxDepth int
+
+	// MaxComplexity is the most a query may cost. Each field costs 1, and
+	// the selections of a field with a first argument cost first times over
+	// (10 when it's left out without a default).
+	MaxComplexity int
+
+	// Introspection allows the __schema and __type fields.
+	Introspection bool
+}
+
+// Execute runs the query of req against s.
+func (s *Schema) Execute(ctx context.Context, req Request, opts Options) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return failed(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return failed(err)
+	}
+	if op.kind != "query" {
+		return failed(&Error{Message: fmt.Sprintf("only queries are supported, not %ss", op.kind), Locations: []Location{op.loc}})
+	}
+	vars, err := s.coerceVariables(op, req.Variables)
+	if err != nil {
+		return failed(err)
+	}
+
+	v := &validator{schema: s, doc: doc, vars: vars, defined: make(map[string]bool, len(op.vars)), introspection: opts.Introspection}
+	for _, def := range op.vars {
+		v.defined[def.name] = true
+	}
+	for _, d := range op.directives {
+		v.directive(d)
+	}
+	depth, cost := v.selectionSet(s.Query, op.selections, 1, make(map[string]bool))
+	if len(v.errors) > 0 {
+		return Response{Errors: v.errors}
+	}
+	if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+		return failed(&Error{Message: fmt.Sprintf("the query is %d fields deep, deeper than the limit of %d", depth, opts.MaxDepth), Locations: []Location{op.loc}})
+	}
+	if opts.MaxComplexity > 0 && cost > opts.MaxComplexity {
+		return failed(&Error{Message: fmt.Sprintf("the query costs %d, more than the limit of %d", cost, opts.MaxComplexity), Locations: []Location{op.loc}})
+	}
+
+	ex := &executor{ctx: context.WithValue(ctx, schemaKey{}, s), schema: s, doc: doc, vars: vars}
+	data := ex.run(op)
+	return Response{Data: data, Errors: ex.errors}
+}
+
+func failed(err error) Response {
+	var gqlErr *Error
+	if !errors.As(err, &gqlErr) {
+		gqlErr = &Error{Message: err.Error()}
+	}
+	return Response{Errors: []*Error{gqlErr}}
+}
+
+// operation returns the operation name of doc, which may be left empty when
+// doc has one operation.
+func (doc *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, &Error{Message: "the document has several operations, so operationName is required"}
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("the document has no operation %q", name)}
+}
+
+// coerceVariables returns the values of the variables op defines, from
+// given and the defaults. Those without either are left out.
+func (s *Schema) coerceVariables(op *operation, given map[string]any) (map[string]any, error) {
+	vars := make(map[string]any, len(op.vars))
+	for _, def := range op.vars {
+		t, err := s.inputType(def.typ)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("variable $%s: %v", def.name, err), Locations: []Location{def.loc}}
+		}
+		v, ok := given[def.name]
+		switch {
+		case ok:
+			v, err = coerceVariable(t, v)
+		case def.def != nil:
+			v, err = coerceLiteral(t, def.def, nil)
+		default:
+			if _, nonNull := t.(*NonNull); nonNull {
+				err = fmt.Errorf("a value of type %s is required", t)
+			}
+		}
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("variable $%s: %v", def.name, err), Locations: []Location{def.loc}}
+		}
+		if ok || def.def != nil {
+			vars[def.name] = v
+		}
+	}
+	return vars, nil
+}
+
+// inputType returns the type ref names, which can't be an object.
+func (s *Schema) inputType(ref *typeRef) (Type, error) {
+	var t Type
+	if ref.list != nil {
+		of, err := s.inputType(ref.list)
+		if err != nil {
+			return nil, err
+		}
+		t = NewList(of)
+	} else {
+		named, ok := s.types[ref.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", ref.name)
+		}
+		if _, ok := named.(*Object); ok {
+			return nil, fmt.Errorf("type %s is not an input type", ref.name)
+		}
+		t = named
+	}
+	if ref.nonNull {
+		t = NewNonNull(t)
+	}
+	return t, nil
+}
+
+// fieldDef returns the field name of parent, the introspection fields of
+// the query type included, or nil.
+func (s *Schema) fieldDef(parent *Object, name string) *Field {
+	if parent == s.Query {
+		switch name {
+		case "__schema":
+			return schemaField
+		case "__type":
+			return typeField
+		}
+	}
+	return parent.field(name)
+}
+
+// result is an object or list of the response, filled in as the levels
+// below it are executed. A field that turns out null where its type isn't
+// nullable makes the result holding it null, and so on up.
+type result struct {
+	list    bool
+	keys    []string       // Of an object, in selection order
+	fields  map[string]any // Of an object
+	items   []any          // Of a list
+	null    bool
+	parent  *result
+	nonNull bool // Whether parent can't hold null in place of this
+	path    []any
+}
+
+// nullify makes r null, and its parents where they can't hold null.
+func (r *result) nullify() {
+	for ; r != nil; r = r.parent {
+		r.null = true
+		if !r.nonNull {
+			return
+		}
+	}
+}
+
+// dead reports whether r, or a result holding it, was made null.
+func (r *result) dead() bool {
+	for ; r != nil; r = r.parent {
+		if r.null {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *result) set(key string, v any) {
+	if _, ok := r.fields[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.fields[key] = v
+}
+
+func (r *result) MarshalJSON() ([]byte, error) {
+	if r.null {
+		return []byte("null"), nil
+	}
+	if r.list {
+		return json.Marshal(r.items)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(r.fields[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// job is a selection set to execute on objects of one type: the values of
+// one field across every object of the level above.
+type job struct {
+	obj     *Object
+	sels    []*selection
+	sources []any
+	results []*result
+}
+
+type executor struct {
+	ctx    context.Context
+	schema *Schema
+	doc    *document
+	vars   map[string]any
+	errors []*Error
+}
+
+// run executes op a level at a time and returns its data.
+func (ex *executor) run(op *operation) *result {
+	root := &result{fields: make(map[string]any)}
+	queue := []*job{{obj: ex.schema.Query, sels: op.selections, sources: []any{nil}, results: []*result{root}}}
+	for len(queue) > 0 {
+		if err := ex.ctx.Err(); err != nil {
+			ex.errors = append(ex.errors, &Error{Message: err.Error()})
+			root.null = true
+			break
+		}
+		j := queue[0]
+		queue = queue[1:]
+		queue = append(queue, ex.execute(j)...)
+	}
+	return root
+}
+
+// collected is the fields selected under one response key.
+type collected struct {
+	key    string
+	nodes  []*field
+	loc    Location
+	merged []*selection // Selections of every node
+}
+
+// collect returns the fields sels select on obj, by response key, leaving
+// out those @skip or @include exclude.
+func (ex *executor) collect(obj *Object, sels []*selection, into []*collected) []*collected {
+	for _, sel := range sels {
+		if !ex.included(sel.directives) {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			into = ex.collect(obj, ex.doc.fragments[sel.spread].selections, into)
+		case sel.inline != nil:
+			into = ex.collect(obj, sel.inline.selections, into)
+		default:
+			key := sel.field.responseKey()
+			var c *collected
+			for _, existing := range into {
+				if existing.key == key {
+					c = existing
+				}
+			}
+			if c == nil {
+				c = &collected{key: key, loc: sel.loc}
+				into = append(into, c)
+			}
+			c.nodes = append(c.nodes, sel.field)
+			c.merged = append(c.merged, sel.field.selections...)
+		}
+	}
+	return into
+}
+
+func (ex *executor) included(directives []*directive) bool {
+	for _, d := range directives {
+		args, _ := coerceArguments(conditionArgs, d.args, ex.vars)
+		cond, _ := args["if"].(bool)
+		if d.name == "skip" && cond || d.name == "include" && !cond {
+			return false
+		}
+	}
+	return true
+}
+
+// execute resolves the fields of j for each of its sources and returns the
+// jobs of the objects they hold.
+func (ex *executor) execute(j *job) []*job {
+	sources, results := j.sources[:0:0], j.results[:0:0]
+	for i, r := range j.results {
+		if !r.dead() {
+			sources = append(sources, j.sources[i])
+			results = append(results, r)
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	var next []*job
+	for _, c := range ex.collect(j.obj, j.sels, nil) {
+		f := c.nodes[0]
+		if f.name == "__typename" {
+			for _, r := range results {
+				r.set(c.key, j.obj.Name)
+			}
+			continue
+		}
+		def := ex.schema.fieldDef(j.obj, f.name)
+		args, _ := coerceArguments(def.Args, f.args, ex.vars)
+		values, errs := ex.resolve(def, sources, args)
+
+		var child *job
+		if obj, ok := namedType(def.Type).(*Object); ok {
+			child = &job{obj: obj, sels: c.merged}
+		}
+		for i, r := range results {
+			path := appendPath(r.path, c.key)
+			if errs[i] != nil {
+				ex.errors = append(ex.errors, &Error{Message: errs[i].Error(), Locations: []Location{c.loc}, Path: path})
+				r.set(c.key, nil)
+				if _, nonNull := def.Type.(*NonNull); nonNull {
+					r.nullify()
+				}
+				continue
+			}
+			v, ok := ex.complete(def.Type, values[i], r, false, path, c.loc, child)
+			r.set(c.key, v)
+			if !ok {
+				r.nullify()
+			}
+		}
+		if child != nil && len(child.sources) > 0 {
+			next = append(next, child)
+		}
+	}
+	return next
+}
+
+// resolve returns the values of def for each of sources, with the error
+// of each.
+func (ex *executor) resolve(def *Field, sources []any, args map[string]any) ([]any, []error) {
+	values, errs := make([]any, len(sources)), make([]error, len(sources))
+	if def.BatchResolve != nil {
+		batch, err := def.BatchResolve(ex.ctx, sources, args)
+		if err == nil && len(batch) != len(sources) {
+			err = fmt.Errorf("resolved %d values for %d objects", len(batch), len(sources))
+		}
+		if err != nil {
+			for i := range errs {
+				errs[i] = err
+			}
+			return values, errs
+		}
+		return batch, errs
+	}
+	for i, source := range sources {
+		if def.Resolve != nil {
+			values[i], errs[i] = def.Resolve(ex.ctx, source, args)
+		} else {
+			values[i], errs[i] = defaultResolve(source, def.Name)
+		}
+	}
+	return values, errs
+}
+
+// complete returns the response value of v, of type t, held by parent at
+// path, adding the objects it holds to child. It returns false when v is
+// null and nonNull, or t isn't nullable, after recording the error.
+func (ex *executor) complete(t Type, v any, parent *result, nonNull bool, path []any, loc Location, child *job) (any, bool) {
+	if nn, ok := t.(*NonNull); ok {
+		return ex.complete(nn.Of, v, parent, true, path, loc, child)
+	}
+	fail := func(format string, args ...any) (any, bool) {
+		ex.errors = append(ex.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}, Path: path})
+		return nil, !nonNull
+	}
+	if isNull(v) {
+		if nonNull {
+			return fail("field of non-null type %s! is null", t)
+		}
+		return nil, true
+	}
+
+	if _, ok := t.(*Object); !ok {
+		// Leaves and lists are serialized from what pointers point to
+		for rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer; rv = rv.Elem() {
+			v = rv.Elem().Interface()
+		}
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		s, err := t.Serialize(v)
+		if err != nil {
+			return fail("%s: %v", t.Name, err)
+		}
+		if s == nil && nonNull {
+			return fail("field of non-null type %s! is null", t)
+		}
+		return s, true
+	case *Enum:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.String || !t.has(rv.String()) {
+			return fail("%v is not a value of %s", v, t.Name)
+		}
+		return rv.String(), true
+	case *List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return fail("expected a list, got %T", v)
+		}
+		list := &result{list: true, items: make([]any, rv.Len()), parent: parent, nonNull: nonNull, path: path}
+		for i := range list.items {
+			item, ok := ex.complete(t.Of, rv.Index(i).Interface(), list, false, appendPath(path, i), loc, child)
+			if !ok {
+				return nil, !nonNull
+			}
+			list.items[i] = item
+		}
+		return list, true
+	case *Object:
+		obj := &result{fields: make(map[string]any), parent: parent, nonNull: nonNull, path: path}
+		child.sources = append(child.sources, v)
+		child.results = append(child.results, obj)
+		return obj, true
+	}
+	return fail("unsupported type %s", t)
+}
+
+// isNull reports whether v is nil, or a nil pointer or map. A nil slice is
+// an empty list.
+func isNull(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func appendPath(path []any, elem any) []any {
+	return append(path[:len(path):len(path)], elem)
+}
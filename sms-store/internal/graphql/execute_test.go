@@ -0,0 +1,241 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type testItem struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// newTestSchema returns a schema of items. Item.owner is batch-resolved,
+// counting its calls in ownerLoads.
+func newTestSchema(t *testing.T, ownerLoads *atomic.Int32) *Schema {
+	t.Helper()
+	owner := &Object{Name: "Owner", Fields: []*Field{
+		{Name: "name", Type: NewNonNull(String)},
+	}}
+	item := &Object{Name: "Item", Fields: []*Field{
+		{Name: "id", Type: NewNonNull(ID)},
+		{Name: "name", Type: String},
+		{Name: "tags", Type: NewList(NewNonNull(String))},
+		{Name: "owner", Type: owner, BatchResolve: func(ctx context.Context, sources []any, args map[string]any) ([]any, error) {
+			ownerLoads.Add(1)
+			owners := make([]any, len(sources))
+			for i, s := range sources {
+				owners[i] = map[string]any{"name": "owner of " + s.(testItem).ID}
+			}
+			return owners, nil
+		}},
+		{Name: "broken", Type: NewNonNull(String), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return nil, errors.New("broken resolver")
+		}},
+	}}
+	item.Fields = append(item.Fields, &Field{Name: "related", Type: NewList(item), Args: []*Argument{{Name: "first", Type: Int}},
+		Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return []testItem{{ID: source.(testItem).ID + "r"}}, nil
+		}})
+
+	items := []testItem{{ID: "1", Name: "one", Tags: []string{"a"}}, {ID: "2", Name: "two"}, {ID: "3", Name: "three"}}
+	query := &Object{Name: "Query", Fields: []*Field{
+		{Name: "hello", Type: NewNonNull(String), Args: []*Argument{{Name: "name", Type: String, Default: "world"}},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return "hello " + fmt.Sprint(args["name"]), nil
+			}},
+		{Name: "items", Type: NewNonNull(NewList(NewNonNull(item))), Args: []*Argument{{Name: "first", Type: Int}, {Name: "kind", Type: &Enum{Name: "Kind", Values: []string{"ALL", "NAMED"}}}},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				n := len(items)
+				if first, ok := args["first"].(int); ok && first < n {
+					n = first
+				}
+				return items[:n], nil
+			}},
+		{Name: "item", Type: item, Args: []*Argument{{Name: "id", Type: NewNonNull(ID)}},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				for _, it := range items {
+					if it.ID == args["id"] {
+						return it, nil
+					}
+				}
+				return nil, nil
+			}},
+		{Name: "paged", Type: NewList(item), Args: []*Argument{{Name: "first", Type: Int, Default: 50}},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return items, nil
+			}},
+	}}
+	s, err := NewSchema(query)
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+	return s
+}
+
+// execute runs query and returns the response as JSON.
+func execute(t *testing.T, s *Schema, req Request, opts Options) string {
+	t.Helper()
+	out, err := json.Marshal(s.Execute(context.Background(), req, opts))
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	return string(out)
+}
+
+func TestExecute(t *testing.T) {
+	var loads atomic.Int32
+	s := newTestSchema(t, &loads)
+	for _, tc := range []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"DefaultArgument", Request{Query: `{ hello }`}, `{"data":{"hello":"hello world"}}`},
+		{"Aliases", Request{Query: `{ a: hello(name: "a") b: hello(name: "b") }`}, `{"data":{"a":"hello a","b":"hello b"}}`},
+		{"Variables", Request{Query: `query($n: String, $first: Int = 1) { hello(name: $n) items(first: $first) { id } }`, Variables: map[string]any{"n": "vars"}},
+			`{"data":{"hello":"hello vars","items":[{"id":"1"}]}}`},
+		{"WholeFloatVariableIsInt", Request{Query: `query($first: Int) { items(first: $first) { id } }`, Variables: map[string]any{"first": float64(2)}}, `{"data":{"items":[{"id":"1"},{"id":"2"}]}}`},
+		{"UnsetVariableLeavesArgumentOut", Request{Query: `query($n: String) { hello(name: $n) }`}, `{"data":{"hello":"hello world"}}`},
+		{"FieldOrderFollowsQuery", Request{Query: `{ item(id: 1) { tags name id } }`}, `{"data":{"item":{"tags":["a"],"name":"one","id":"1"}}}`},
+		{"Fragments", Request{Query: `{ item(id: "2") { ...f ... on Item { name } } } fragment f on Item { id name }`}, `{"data":{"item":{"id":"2","name":"two"}}}`},
+		{"Directives", Request{Query: `query($yes: Boolean!) { item(id: "1") { id name @skip(if: $yes) tags @include(if: $yes) } }`, Variables: map[string]any{"yes": true}},
+			`{"data":{"item":{"id":"1","tags":["a"]}}}`},
+		{"Typename", Request{Query: `{ __typename item(id: "1") { __typename } }`}, `{"data":{"__typename":"Query","item":{"__typename":"Item"}}}`},
+		{"NullObject", Request{Query: `{ item(id: "9") { id } }`}, `{"data":{"item":null}}`},
+		{"NilSliceIsEmptyList", Request{Query: `{ item(id: "2") { tags } }`}, `{"data":{"item":{"tags":[]}}}`},
+		{"OperationName", Request{Query: `query A { hello } query B { hello(name: "b") }`, OperationName: "B"}, `{"data":{"hello":"hello b"}}`},
+		{"EnumArgument", Request{Query: `{ items(kind: NAMED, first: 1) { id } }`}, `{"data":{"items":[{"id":"1"}]}}`},
+		// A failed non-null field nulls its nearest nullable parent
+		{"NonNullErrorPropagates", Request{Query: `{ item(id: "1") { id broken } }`},
+			`{"data":{"item":null},"errors":[{"message":"broken resolver","locations":[{"line":1,"column":22}],"path":["item","broken"]}]}`},
+		{"NonNullErrorReachesRoot", Request{Query: `{ items(first: 1) { broken } }`},
+			`{"data":null,"errors":[{"message":"broken resolver","locations":[{"line":1,"column":21}],"path":["items",0,"broken"]}]}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := execute(t, s, tc.req, Options{}); got != tc.want {
+				t.Fatalf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchesEachLevel(t *testing.T) {
+	var loads atomic.Int32
+	s := newTestSchema(t, &loads)
+	got := execute(t, s, Request{Query: `{ items { id owner { name } related { owner { name } } } }`}, Options{})
+	if !strings.Contains(got, `"owner":{"name":"owner of 3"}`) || !strings.Contains(got, `"owner":{"name":"owner of 1r"}`) {
+		t.Fatalf("response = %s", got)
+	}
+	// One load for the owners of the items, and one for those of the related
+	// items, however many items there are
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("owners loaded %d times, want 2", n)
+	}
+}
+
+func TestExecuteRejects(t *testing.T) {
+	var loads atomic.Int32
+	s := newTestSchema(t, &loads)
+	for _, tc := range []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"Mutation", Request{Query: `mutation { hello }`}, "only queries are supported, not mutations"},
+		{"Subscription", Request{Query: `subscription { hello }`}, "only queries are supported, not subscriptions"},
+		{"UnknownField", Request{Query: `{ nope }`}, `unknown field "nope" on type Query`},
+		{"UnknownArgument", Request{Query: `{ hello(nope: 1) }`}, `field hello: unknown argument "nope"`},
+		{"MissingRequiredArgument", Request{Query: `{ item { id } }`}, `field item: argument "id" of type ID! is required`},
+		{"WrongArgumentType", Request{Query: `{ items(first: "2") { id } }`}, `field items: argument "first": Int: expected an integer`},
+		{"IntOutOfRange", Request{Query: `{ items(first: 3000000000) { id } }`}, `field items: argument "first": Int: expected a 32-bit integer`},
+		{"UnknownEnumValue", Request{Query: `{ items(kind: SOME) { id } }`}, `field items: argument "kind": expected a value of Kind`},
+		{"MissingSelectionSet", Request{Query: `{ items }`}, `field "items" of type [Item!]! must have a selection set`},
+		{"SelectionOnLeaf", Request{Query: `{ hello { length } }`}, `field "hello" of type String! can't have a selection set`},
+		{"UnknownFragment", Request{Query: `{ ...missing }`}, `unknown fragment "missing"`},
+		{"FragmentCycle", Request{Query: `{ item(id: 1) { ...a } } fragment a on Item { ...b } fragment b on Item { ...a }`}, `fragment "a" spreads itself`},
+		{"FragmentOnWrongType", Request{Query: `{ ...f } fragment f on Item { id }`}, "a fragment on Item can't be spread on Query"},
+		{"UnknownDirective", Request{Query: `{ hello @cached }`}, "unknown directive @cached"},
+		{"DirectiveWithoutIf", Request{Query: `{ hello @skip }`}, `directive @skip: argument "if" of type Boolean! is required`},
+		{"MissingVariable", Request{Query: `query($id: ID!) { item(id: $id) { id } }`}, "variable $id: a value of type ID! is required"},
+		{"WrongVariableType", Request{Query: `query($first: Int) { items(first: $first) { id } }`, Variables: map[string]any{"first": "x"}}, "variable $first: Int: expected an integer"},
+		{"UndefinedVariable", Request{Query: `{ items(first: $n) { id } }`}, `field items: argument "first": variable $n is not defined`},
+		{"UndefinedVariableInDirective", Request{Query: `{ hello @skip(if: $no) }`}, `directive @skip: argument "if": variable $no is not defined`},
+		{"SeveralOperationsWithoutName", Request{Query: `query A { hello } query B { hello }`}, "the document has several operations, so operationName is required"},
+		{"UnknownOperation", Request{Query: `query A { hello }`, OperationName: "B"}, `the document has no operation "B"`},
+		{"Introspection", Request{Query: `{ __schema { queryType { name } } }`}, "introspection is disabled"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := s.Execute(context.Background(), tc.req, Options{})
+			if resp.Data != nil || len(resp.Errors) != 1 || resp.Errors[0].Message != tc.want {
+				got, _ := json.Marshal(resp)
+				t.Fatalf("response = %s, want only the error %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	var loads atomic.Int32
+	s := newTestSchema(t, &loads)
+	for _, tc := range []struct {
+		name  string
+		query string
+		depth int
+		cost  int
+	}{
+		{"Leaf", `{ hello }`, 1, 1},
+		{"Object", `{ item(id: 1) { id name } }`, 2, 3},
+		// Fields under one with a first argument cost first times over
+		{"First", `{ items(first: 5) { id name } }`, 2, 1 + 5*2},
+		{"FirstLeftOut", `{ items { id } }`, 2, 1 + defaultListCost},
+		{"FirstDefault", `{ paged { id } }`, 2, 1 + 50},
+		{"FirstVariable", `query($n: Int = 3) { items(first: $n) { id } }`, 2, 1 + 3},
+		{"Nested", `{ items(first: 2) { related(first: 4) { owner { name } } } }`, 4, 1 + 2*(1+4*(1+1))},
+		{"FragmentsCount", `{ item(id: 1) { ...f ...f } } fragment f on Item { related(first: 2) { id } }`, 3, 1 + 2*(1+2)},
+		{"TypenameIsFree", `{ item(id: 1) { __typename } }`, 2, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := Request{Query: tc.query}
+			if got := execute(t, s, req, Options{MaxDepth: tc.depth, MaxComplexity: tc.cost}); strings.Contains(got, `"errors"`) {
+				t.Fatalf("at the limits of depth %d and cost %d: %s", tc.depth, tc.cost, got)
+			}
+
+			resp := s.Execute(context.Background(), req, Options{MaxDepth: tc.depth - 1})
+			if tc.depth > 1 && (len(resp.Errors) != 1 || resp.Errors[0].Message != fmt.Sprintf("the query is %d fields deep, deeper than the limit of %d", tc.depth, tc.depth-1)) {
+				t.Fatalf("below the depth limit: %+v", resp.Errors)
+			}
+			resp = s.Execute(context.Background(), req, Options{MaxComplexity: tc.cost - 1})
+			if tc.cost > 1 && (len(resp.Errors) != 1 || resp.Errors[0].Message != fmt.Sprintf("the query costs %d, more than the limit of %d", tc.cost, tc.cost-1)) {
+				t.Fatalf("below the cost limit: %+v", resp.Errors)
+			}
+			if tc.cost > 1 && resp.Data != nil {
+				t.Fatal("a query over the limit was executed")
+			}
+		})
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	var loads atomic.Int32
+	s := newTestSchema(t, &loads)
+	got := execute(t, s, Request{Query: `{
+		__schema { queryType { name } }
+		__type(name: "Item") { name kind fields { name type { kind ofType { name } } } }
+	}`}, Options{Introspection: true})
+	for _, want := range []string{
+		`"queryType":{"name":"Query"}`,
+		`"name":"Item","kind":"OBJECT"`,
+		`{"name":"id","type":{"kind":"NON_NULL","ofType":{"name":"ID"}}}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("introspection lacks %s:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// schemaKey is the context key of the schema being executed, which the
+// introspection fields describe.
+type schemaKey struct{}
+
+func schemaFrom(ctx context.Context) *Schema {
+	s, _ := ctx.Value(schemaKey{}).(*Schema)
+	return s
+}
+
+// The introspection types, whose fields are set in init as they refer to
+// each other.
+var (
+	introspectionSchema = &Object{Name: "__Schema", Description: "The types and directives of the schema."}
+	typeType            = &Object{Name: "__Type", Description: "A type of the schema."}
+	fieldType           = &Object{Name: "__Field", Description: "A field of an object type."}
+	inputValueType      = &Object{Name: "__InputValue", Description: "An argument of a field or directive."}
+	enumValueType       = &Object{Name: "__EnumValue", Description: "A value of an enum type."}
+	directiveType       = &Object{Name: "__Directive", Description: "A directive the schema accepts."}
+
+	typeKindType = &Enum{
+		Name:        "__TypeKind",
+		Description: "The kind of a __Type.",
+		Values:      []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"},
+	}
+	directiveLocationType = &Enum{
+		Name:        "__DirectiveLocation",
+		Description: "Where a directive may be used.",
+		Values:      []string{"QUERY", "FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+	}
+)
+
+// schemaField and typeField are the introspection fields of the query type.
+var (
+	schemaField = &Field{
+		Name:        "__schema",
+		Description: "The schema itself.",
+		Type:        NewNonNull(introspectionSchema),
+		Resolve: func(ctx context.Context, _ any, _ map[string]any) (any, error) {
+			return schemaFrom(ctx), nil
+		},
+	}
+	typeField = &Field{
+		Name:        "__type",
+		Description: "The type named name, or null.",
+		Type:        typeType,
+		Args:        []*Argument{{Name: "name", Type: NewNonNull(String)}},
+		Resolve: func(ctx context.Context, _ any, args map[string]any) (any, error) {
+			t, ok := schemaFrom(ctx).types[args["name"].(string)]
+			if !ok {
+				return nil, nil
+			}
+			return t, nil
+		},
+	}
+)
+
+// introspectedDirective is the source of a __Directive.
+type introspectedDirective struct {
+	name        string
+	description string
+	args        []*Argument
+}
+
+var directives = []introspectedDirective{
+	{"include", "Includes the selection only when if is true.", conditionArgs},
+	{"skip", "Leaves the selection out when if is true.", conditionArgs},
+}
+
+func init() {
+	nonNullString := NewNonNull(String)
+	nonNullBoolean := NewNonNull(Boolean)
+	typeList := func(t Type) Type { return NewList(NewNonNull(t)) }
+	includeDeprecated := []*Argument{{Name: "includeDeprecated", Type: Boolean, Default: false}}
+
+	introspectionSchema.Fields = []*Field{
+		{Name: "description", Type: String, Resolve: constant(nil)},
+		{Name: "types", Type: NewNonNull(typeList(typeType)), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			s := source.(*Schema)
+			names := make([]string, 0, len(s.types))
+			for name := range s.types {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			types := make([]Type, len(names))
+			for i, name := range names {
+				types[i] = s.types[name]
+			}
+			return types, nil
+		}},
+		{Name: "queryType", Type: NewNonNull(typeType), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(*Schema).Query, nil
+		}},
+		{Name: "mutationType", Type: typeType, Resolve: constant(nil)},
+		{Name: "subscriptionType", Type: typeType, Resolve: constant(nil)},
+		{Name: "directives", Type: NewNonNull(typeList(directiveType)), Resolve: constant(directives)},
+	}
+
+	typeType.Fields = []*Field{
+		{Name: "kind", Type: NewNonNull(typeKindType), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			switch source.(type) {
+			case *Scalar:
+				return "SCALAR", nil
+			case *Enum:
+				return "ENUM", nil
+			case *Object:
+				return "OBJECT", nil
+			case *List:
+				return "LIST", nil
+			case *NonNull:
+				return "NON_NULL", nil
+			}
+			return nil, fmt.Errorf("unknown type %T", source)
+		}},
+		{Name: "name", Type: String, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			switch t := source.(type) {
+			case *Scalar, *Enum, *Object:
+				return t.(Type).String(), nil
+			}
+			return nil, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			switch t := source.(type) {
+			case *Scalar:
+				return optional(t.Description), nil
+			case *Enum:
+				return optional(t.Description), nil
+			case *Object:
+				return optional(t.Description), nil
+			}
+			return nil, nil
+		}},
+		{Name: "fields", Type: typeList(fieldType), Args: includeDeprecated, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			if obj, ok := source.(*Object); ok {
+				return obj.Fields, nil
+			}
+			return nil, nil
+		}},
+		{Name: "interfaces", Type: typeList(typeType), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			if _, ok := source.(*Object); ok {
+				return []Type{}, nil
+			}
+			return nil, nil
+		}},
+		{Name: "possibleTypes", Type: typeList(typeType), Resolve: constant(nil)},
+		{Name: "enumValues", Type: typeList(enumValueType), Args: includeDeprecated, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			if e, ok := source.(*Enum); ok {
+				return e.Values, nil
+			}
+			return nil, nil
+		}},
+		{Name: "inputFields", Type: typeList(inputValueType), Resolve: constant(nil)},
+		{Name: "ofType", Type: typeType, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			switch t := source.(type) {
+			case *List:
+				return t.Of, nil
+			case *NonNull:
+				return t.Of, nil
+			}
+			return nil, nil
+		}},
+		{Name: "specifiedByURL", Type: String, Resolve: constant(nil)},
+	}
+
+	fieldType.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(*Field).Name, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return optional(source.(*Field).Description), nil
+		}},
+		{Name: "args", Type: NewNonNull(typeList(inputValueType)), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(*Field).Args, nil
+		}},
+		{Name: "type", Type: NewNonNull(typeType), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(*Field).Type, nil
+		}},
+		{Name: "isDeprecated", Type: nonNullBoolean, Resolve: constant(false)},
+		{Name: "deprecationReason", Type: String, Resolve: constant(nil)},
+	}
+
+	inputValueType.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(*Argument).Name, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return optional(source.(*Argument).Description), nil
+		}},
+		{Name: "type", Type: NewNonNull(typeType), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(*Argument).Type, nil
+		}},
+		{Name: "defaultValue", Type: String, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return literal(source.(*Argument).Default), nil
+		}},
+		{Name: "isDeprecated", Type: nonNullBoolean, Resolve: constant(false)},
+		{Name: "deprecationReason", Type: String, Resolve: constant(nil)},
+	}
+
+	enumValueType.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source, nil
+		}},
+		{Name: "description", Type: String, Resolve: constant(nil)},
+		{Name: "isDeprecated", Type: nonNullBoolean, Resolve: constant(false)},
+		{Name: "deprecationReason", Type: String, Resolve: constant(nil)},
+	}
+
+	directiveType.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(introspectedDirective).name, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return optional(source.(introspectedDirective).description), nil
+		}},
+		{Name: "locations", Type: NewNonNull(typeList(directiveLocationType)), Resolve: constant([]string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"})},
+		{Name: "args", Type: NewNonNull(typeList(inputValueType)), Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+			return source.(introspectedDirective).args, nil
+		}},
+		{Name: "isRepeatable", Type: nonNullBoolean, Resolve: constant(false)},
+	}
+}
+
+// constant resolves a field to v.
+func constant(v any) ResolveFunc {
+	return func(context.Context, any, map[string]any) (any, error) { return v, nil }
+}
+
+// optional is s, or nil when it's empty.
+func optional(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// literal writes a default value as it would be in a query, or returns nil
+// for none.
+func literal(v any) any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
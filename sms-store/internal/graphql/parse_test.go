@@ -0,0 +1,140 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func TestParseSyntaxErrors(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  string
+		loc   Location
+	}{
+		{"", "syntax error: the document has no operation", Location{1, 1}},
+		{"{ hello", `syntax error: unexpected end of query`, Location{1, 8}},
+		{"{ }", "syntax error: a selection set can't be empty", Location{1, 3}},
+		{"{ hello(name: ) }", `syntax error: unexpected ")"`, Location{1, 15}},
+		{"{ hello() }", "syntax error: an argument list can't be empty", Location{1, 9}},
+		{"{ hello(name: \"a\", name: \"b\") }", `syntax error: argument "name" is given more than once`, Location{1, 20}},
+		{"{ hello(name: \"abc) }", "syntax error: unterminated string", Location{1, 15}},
+		{"{\n  hello(name: \"a\nb\")\n}", "syntax error: unterminated string", Location{2, 15}},
+		{`{ hello(name: "\q") }`, `syntax error: invalid escape \q`, Location{1, 15}},
+		{`{ hello(name: "\u12") }`, "syntax error: invalid unicode escape", Location{1, 15}},
+		{"{ items(first: 01) { id } }", "syntax error: invalid number", Location{1, 16}},
+		{"{ items(first: 1.) { id } }", "syntax error: invalid number", Location{1, 16}},
+		{"{ hello % }", `syntax error: unexpected character '%'`, Location{1, 9}},
+		{"query Q($n: Int = $m) { hello }", "syntax error: a default value can't hold a variable", Location{1, 19}},
+		{"fragment F on Query { hello } fragment F on Query { hello } { ...F }", `syntax error: fragment "F" is defined more than once`, Location{1, 31}},
+		{"fragment on on Query { hello } { hello }", "syntax error: a fragment can't be named on", Location{1, 1}},
+		{"hello", `syntax error: unexpected "hello"`, Location{1, 1}},
+	} {
+		_, err := parse(tc.query)
+		gqlErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("parse(%q) = %v, want a syntax error", tc.query, err)
+			continue
+		}
+		if gqlErr.Message != tc.want || len(gqlErr.Locations) != 1 || gqlErr.Locations[0] != tc.loc {
+			t.Errorf("parse(%q) = %q at %v, want %q at %v", tc.query, gqlErr.Message, gqlErr.Locations, tc.want, tc.loc)
+		}
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	doc, err := parse(`
+		# Comments, commas and a byte order mark are ignored
+		query Page($phone: String!, $first: Int = 20) @include(if: true) {
+			page: messages(phoneNumber: $phone, first: $first) {
+				...fields
+				... on Message @skip(if: false) { text }
+			}
+		},
+		fragment fields on Message { id, createdAt }
+		{ stats { total } }
+	`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(doc.operations) != 2 || len(doc.fragments) != 1 {
+		t.Fatalf("%d operations and %d fragments, want 2 and 1", len(doc.operations), len(doc.fragments))
+	}
+
+	op := doc.operations[0]
+	if op.kind != "query" || op.name != "Page" || len(op.directives) != 1 || op.directives[0].name != "include" {
+		t.Fatalf("operation = %+v", op)
+	}
+	if len(op.vars) != 2 || op.vars[0].name != "phone" || op.vars[0].typ.String() != "String!" || op.vars[1].def == nil || op.vars[1].def.raw != "20" {
+		t.Fatalf("variables = %+v %+v", op.vars[0], op.vars[1])
+	}
+
+	page := op.selections[0].field
+	if page.name != "messages" || page.alias != "page" || page.responseKey() != "page" || len(page.args) != 2 {
+		t.Fatalf("field = %+v", page)
+	}
+	if page.args[0].value.kind != valueVariable || page.args[0].value.raw != "phone" {
+		t.Fatalf("argument = %+v", page.args[0].value)
+	}
+	if sels := page.selections; len(sels) != 2 || sels[0].spread != "fields" || sels[1].inline == nil || sels[1].inline.typeCondition != "Message" || sels[1].directives[0].name != "skip" {
+		t.Fatalf("selections = %+v %+v", sels[0], sels[1])
+	}
+	if frag := doc.fragments["fields"]; frag.typeCondition != "Message" || len(frag.selections) != 2 {
+		t.Fatalf("fragment = %+v", frag)
+	}
+
+	if anon := doc.operations[1]; anon.kind != "query" || anon.name != "" || anon.selections[0].field.name != "stats" {
+		t.Fatalf("shorthand operation = %+v", anon)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	doc, err := parse(`{ f(
+		i: -12, f: 1.5e3, s: "tab\t\"q\" é", b: true, n: null, e: INBOUND,
+		l: [1, [2], "x"], o: {a: 1, b: {c: $v}},
+		block: """
+			first
+			  indented \""" quotes
+		"""
+	) }`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	args := map[string]*value{}
+	for _, a := range doc.operations[0].selections[0].field.args {
+		args[a.name] = a.value
+	}
+	for name, want := range map[string]struct {
+		kind valueKind
+		raw  string
+	}{
+		"i":     {valueInt, "-12"},
+		"f":     {valueFloat, "1.5e3"},
+		"s":     {valueString, "tab\t\"q\" é"},
+		"b":     {valueBoolean, "true"},
+		"n":     {valueNull, ""},
+		"e":     {valueEnum, "INBOUND"},
+		"block": {valueString, "first\n  indented \"\"\" quotes"},
+	} {
+		if got := args[name]; got.kind != want.kind || got.kind != valueNull && got.raw != want.raw {
+			t.Errorf("argument %s = kind %d %q, want kind %d %q", name, got.kind, got.raw, want.kind, want.raw)
+		}
+	}
+	if l := args["l"]; l.kind != valueList || len(l.list) != 3 || l.list[1].kind != valueList {
+		t.Errorf("list = %+v", l)
+	}
+	if o := args["o"]; o.kind != valueObject || len(o.fields) != 2 || o.fields[1].value.fields[0].value.kind != valueVariable {
+		t.Errorf("object = %+v", o)
+	}
+}
+
+func TestBlockString(t *testing.T) {
+	for raw, want := range map[string]string{
+		"single":                    "single",
+		"\n    a\n      b\n    c\n": "a\n  b\nc",
+		"\n\n  a\n\n  b\n\n":        "a\n\nb",
+		"  first line kept\n    b":  "  first line kept\nb",
+	} {
+		if got := blockString(raw); got != want {
+			t.Errorf("blockString(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+// Package graphql serves read-only GraphQL queries against a schema of
+// object types whose fields are resolved by Go functions. It implements the
+// part of the language queries need: fields, aliases, arguments, variables,
+// fragments, the @skip and @include directives and introspection. There
+// are no mutations, subscriptions, interfaces, unions or input objects.
+//
+// Queries are executed level by level: a field is resolved for every
+// object of a level at once, so a field with a BatchResolve, such as the
+// profile of each message of a page, costs one lookup per level rather
+// than one per object, the way a dataloader batches them.
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is a type of the schema: a *Scalar, *Enum, *Object, *List or
+// *NonNull.
+type Type interface {
+	String() string
+}
+
+// ResolveFunc returns the value of a field of source, an object of the
+// field's type's parent, with args coerced to the argument types.
+type ResolveFunc func(ctx context.Context, source any, args map[string]any) (any, error)
+
+// BatchResolveFunc returns the values of a field for each of sources, in
+// the same order.
+type BatchResolveFunc func(ctx context.Context, sources []any, args map[string]any) ([]any, error)
+
+// Scalar is a leaf type.
+type Scalar struct {
+	Name        string
+	Description string
+
+	// Serialize turns a resolved value into its JSON form.
+	Serialize func(v any) (any, error)
+
+	// Parse turns an argument, as decoded from a JSON variable or a literal
+	// (a string, bool, float64 or int64), into the Go value resolvers get.
+	Parse func(v any) (any, error)
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// Enum is a leaf type of named values, which resolve and parse as strings.
+type Enum struct {
+	Name        string
+	Description string
+	Values      []string
+}
+
+func (e *Enum) String() string { return e.Name }
+
+// Object is a type with fields.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+
+	once   sync.Once
+	byName map[string]*Field
+}
+
+func (o *Object) String() string { return o.Name }
+
+// field returns the field name of o, or nil.
+func (o *Object) field(name string) *Field {
+	o.once.Do(func() {
+		o.byName = make(map[string]*Field, len(o.Fields))
+		for _, f := range o.Fields {
+			o.byName[f.Name] = f
+		}
+	})
+	return o.byName[name]
+}
+
+// Field is a field of an Object. Without a Resolve or BatchResolve, its
+// value is the source's struct field with the same JSON name, or the
+// source map's entry.
+type Field struct {
+	Name         string
+	Description  string
+	Type         Type
+	Args         []*Argument
+	Resolve      ResolveFunc
+	BatchResolve BatchResolveFunc // Takes precedence over Resolve
+}
+
+// argument returns the argument name of f, or nil.
+func (f *Field) argument(name string) *Argument {
+	for _, a := range f.Args {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Argument is an argument of a Field.
+type Argument struct {
+	Name        string
+	Description string
+	Type        Type
+	Default     any // Parsed value used when the argument is left out; nil for none
+}
+
+// List is a list of Of.
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+// NonNull is Of without null.
+type NonNull struct {
+	Of Type
+}
+
+func (n *NonNull) String() string { return n.Of.String() + "!" }
+
+// NewList returns the type [of].
+func NewList(of Type) *List { return &List{Of: of} }
+
+// NewNonNull returns the type of!.
+func NewNonNull(of Type) *NonNull { return &NonNull{Of: of} }
+
+// namedType returns the scalar, enum or object a type is made of.
+func namedType(t Type) Type {
+	for {
+		switch w := t.(type) {
+		case *List:
+			t = w.Of
+		case *NonNull:
+			t = w.Of
+		default:
+			return t
+		}
+	}
+}
+
+// Schema is a set of types reachable from a query type.
+type Schema struct {
+	Query *Object
+	types map[string]Type // Named types, by name
+}
+
+// NewSchema returns the schema of query, checking that every type it
+// reaches has a unique name and every field a type.
+func NewSchema(query *Object) (*Schema, error) {
+	s := &Schema{Query: query, types: make(map[string]Type)}
+	for _, t := range []Type{String, Int, Float, Boolean, ID} {
+		s.types[t.String()] = t
+	}
+	if err := s.collect(query); err != nil {
+		return nil, err
+	}
+	if err := s.collect(introspectionSchema); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) collect(t Type) error {
+	t = namedType(t)
+	name := t.String()
+	if existing, ok := s.types[name]; ok {
+		if existing != t {
+			return fmt.Errorf("graphql: two types are named %s", name)
+		}
+		return nil
+	}
+	s.types[name] = t
+
+	obj, ok := t.(*Object)
+	if !ok {
+		return nil
+	}
+	for _, f := range obj.Fields {
+		if f.Type == nil {
+			return fmt.Errorf("graphql: field %s.%s has no type", obj.Name, f.Name)
+		}
+		if err := s.collect(f.Type); err != nil {
+			return err
+		}
+		for _, a := range f.Args {
+			if _, ok := namedType(a.Type).(*Object); ok {
+				return fmt.Errorf("graphql: argument %s of %s.%s is an object", a.Name, obj.Name, f.Name)
+			}
+			if err := s.collect(a.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Built-in scalars.
+var (
+	String = &Scalar{
+		Name:        "String",
+		Description: "UTF-8 text.",
+		Serialize: func(v any) (any, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case fmt.Stringer:
+				return v.String(), nil
+			}
+			return fmt.Sprint(v), nil
+		},
+		Parse: func(v any) (any, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("expected a string")
+		},
+	}
+
+	ID = &Scalar{
+		Name:        "ID",
+		Description: "A unique identifier, serialized as a string.",
+		Serialize:   String.Serialize,
+		Parse: func(v any) (any, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case int64:
+				return strconv.FormatInt(v, 10), nil
+			}
+			return nil, fmt.Errorf("expected a string or integer")
+		},
+	}
+
+	Int = &Scalar{
+		Name:        "Int",
+		Description: "A signed 32-bit integer.",
+		Serialize: func(v any) (any, error) {
+			rv := reflect.ValueOf(v)
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return rv.Int(), nil
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return int64(rv.Uint()), nil
+			}
+			return nil, fmt.Errorf("expected an integer, got %T", v)
+		},
+		Parse: func(v any) (any, error) {
+			switch v := v.(type) {
+			case int64:
+				if v < math.MinInt32 || v > math.MaxInt32 {
+					return nil, fmt.Errorf("expected a 32-bit integer")
+				}
+				return int(v), nil
+			case float64:
+				if v != math.Trunc(v) || v < math.MinInt32 || v > math.MaxInt32 {
+					return nil, fmt.Errorf("expected a 32-bit integer")
+				}
+				return int(v), nil
+			}
+			return nil, fmt.Errorf("expected an integer")
+		},
+	}
+
+	Float = &Scalar{
+		Name:        "Float",
+		Description: "A double-precision number.",
+		Serialize: func(v any) (any, error) {
+			rv := reflect.ValueOf(v)
+			switch rv.Kind() {
+			case reflect.Float32, reflect.Float64:
+				return rv.Float(), nil
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return float64(rv.Int()), nil
+			}
+			return nil, fmt.Errorf("expected a number, got %T", v)
+		},
+		Parse: func(v any) (any, error) {
+			switch v := v.(type) {
+			case int64:
+				return float64(v), nil
+			case float64:
+				return v, nil
+			}
+			return nil, fmt.Errorf("expected a number")
+		},
+	}
+
+	Boolean = &Scalar{
+		Name:        "Boolean",
+		Description: "true or false.",
+		Serialize: func(v any) (any, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("expected a boolean, got %T", v)
+		},
+		Parse: func(v any) (any, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("expected a boolean")
+		},
+	}
+
+	// DateTime is a time.Time, as an RFC 3339 string in UTC. The zero time
+	// serializes as null.
+	DateTime = &Scalar{
+		Name:        "DateTime",
+		Description: "A point in time, as an RFC 3339 string.",
+		Serialize: func(v any) (any, error) {
+			switch t := v.(type) {
+			case time.Time:
+				if t.IsZero() {
+					return nil, nil
+				}
+				return t.UTC().Format(time.RFC3339Nano), nil
+			case *time.Time:
+				if t == nil || t.IsZero() {
+					return nil, nil
+				}
+				return t.UTC().Format(time.RFC3339Nano), nil
+			}
+			return nil, fmt.Errorf("expected a time, got %T", v)
+		},
+		Parse: func(v any) (any, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected an RFC 3339 string")
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, fmt.Errorf("expected an RFC 3339 string")
+			}
+			return t, nil
+		},
+	}
+)
+
+// defaultResolve returns the field name of source: a map's entry, or the
+// struct field whose JSON name is name.
+func defaultResolve(source any, name string) (any, error) {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		v := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+	case reflect.Struct:
+		if i, ok := jsonFieldIndex(rv.Type())[name]; ok {
+			return rv.FieldByIndex(i).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("no field %s on %T", name, source)
+}
+
+var jsonFieldIndexes sync.Map // reflect.Type -> map[string][]int
+
+// jsonFieldIndex maps the JSON names of t's fields, those of embedded
+// structs included, to their indexes.
+func jsonFieldIndex(t reflect.Type) map[string][]int {
+	if cached, ok := jsonFieldIndexes.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	index := make(map[string][]int)
+	var walk func(t reflect.Type, prefix []int)
+	walk = func(t reflect.Type, prefix []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			at := append(append([]int{}, prefix...), i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				walk(f.Type, at)
+				continue
+			}
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if _, ok := index[name]; !ok {
+				index[name] = at
+			}
+		}
+	}
+	walk(t, nil)
+	jsonFieldIndexes.Store(t, index)
+	return index
+}
@@ -0,0 +1,349 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// defaultListCost is what a field taking a first argument, left out and
+// without a default, multiplies the cost of its selections by.
+const defaultListCost = 10
+
+// validator checks an operation against the schema before it runs, and
+// measures its depth and cost.
+type validator struct {
+	schema        *Schema
+	doc           *document
+	vars          map[string]any // Coerced
+	defined       map[string]bool
+	introspection bool
+	errors        []*Error
+}
+
+// selectionSet checks sels, selected on parent at depth, and returns the
+// deepest depth they reach and their cost. spreading names the fragments
+// being expanded, to stop cycles.
+func (v *validator) selectionSet(parent *Object, sels []*selection, depth int, spreading map[string]bool) (maxDepth, cost int) {
+	maxDepth = depth
+	for _, sel := range sels {
+		for _, d := range sel.directives {
+			v.directive(d)
+		}
+		var d, c int
+		switch {
+		case sel.spread != "":
+			frag, ok := v.doc.fragments[sel.spread]
+			if !ok {
+				v.errorf(sel.loc, "unknown fragment %q", sel.spread)
+				continue
+			}
+			if spreading[frag.name] {
+				v.errorf(sel.loc, "fragment %q spreads itself", frag.name)
+				continue
+			}
+			if !v.typeCondition(sel.loc, parent, frag.typeCondition) {
+				continue
+			}
+			spreading[frag.name] = true
+			d, c = v.selectionSet(parent, frag.selections, depth, spreading)
+			delete(spreading, frag.name)
+		case sel.inline != nil:
+			if sel.inline.typeCondition != "" && !v.typeCondition(sel.loc, parent, sel.inline.typeCondition) {
+				continue
+			}
+			d, c = v.selectionSet(parent, sel.inline.selections, depth, spreading)
+		default:
+			d, c = v.field(parent, sel, depth, spreading)
+		}
+		maxDepth = max(maxDepth, d)
+		cost += c
+	}
+	return maxDepth, cost
+}
+
+// typeCondition reports whether a fragment on name applies to parent.
+// Without interfaces or unions, only parent itself matches.
+func (v *validator) typeCondition(loc Location, parent *Object, name string) bool {
+	if _, ok := v.schema.types[name]; !ok {
+		v.errorf(loc, "unknown type %q", name)
+		return false
+	}
+	if name != parent.Name {
+		v.errorf(loc, "a fragment on %s can't be spread on %s", name, parent.Name)
+		return false
+	}
+	return true
+}
+
+func (v *validator) field(parent *Object, sel *selection, depth int, spreading map[string]bool) (int, int) {
+	f := sel.field
+	if f.name == "__typename" {
+		if len(f.selections) > 0 {
+			v.errorf(sel.loc, "field __typename of type String! can't have a selection set")
+		}
+		return depth, 0
+	}
+	def := v.schema.fieldDef(parent, f.name)
+	if def == nil {
+		v.errorf(sel.loc, "unknown field %q on type %s", f.name, parent.Name)
+		return depth, 0
+	}
+	if (f.name == "__schema" || f.name == "__type") && !v.introspection {
+		v.errorf(sel.loc, "introspection is disabled")
+		return depth, 0
+	}
+
+	args, err := v.arguments(def.Args, f.args)
+	if err != nil {
+		v.errorf(sel.loc, "field %s: %v", f.name, err)
+	}
+
+	obj, isObject := namedType(def.Type).(*Object)
+	switch {
+	case isObject && len(f.selections) == 0:
+		v.errorf(sel.loc, "field %q of type %s must have a selection set", f.name, def.Type)
+		return depth, 1
+	case !isObject && len(f.selections) > 0:
+		v.errorf(sel.loc, "field %q of type %s can't have a selection set", f.name, def.Type)
+		return depth, 1
+	case !isObject:
+		return depth, 1
+	}
+
+	d, c := v.selectionSet(obj, f.selections, depth+1, spreading)
+	if first := def.argument("first"); first != nil {
+		n := defaultListCost
+		if given, ok := args["first"].(int); ok && given > 0 {
+			n = given
+		}
+		c *= n
+	}
+	return d, 1 + c
+}
+
+func (v *validator) directive(d *directive) {
+	if d.name != "skip" && d.name != "include" {
+		v.errorf(d.loc, "unknown directive @%s", d.name)
+		return
+	}
+	if _, err := v.arguments(conditionArgs, d.args); err != nil {
+		v.errorf(d.loc, "directive @%s: %v", d.name, err)
+	}
+}
+
+// arguments coerces given for defs, first checking that the variables they
+// use are defined: coercion alone leaves those without a value out.
+func (v *validator) arguments(defs []*Argument, given []*argument) (map[string]any, error) {
+	for _, g := range given {
+		if name, ok := undefinedVariable(g.value, v.defined); ok {
+			return nil, fmt.Errorf("argument %q: variable $%s is not defined", g.name, name)
+		}
+	}
+	return coerceArguments(defs, given, v.vars)
+}
+
+// undefinedVariable returns the first variable in lit not in defined.
+func undefinedVariable(lit *value, defined map[string]bool) (string, bool) {
+	switch lit.kind {
+	case valueVariable:
+		return lit.raw, !defined[lit.raw]
+	case valueList:
+		for _, item := range lit.list {
+			if name, ok := undefinedVariable(item, defined); ok {
+				return name, true
+			}
+		}
+	case valueObject:
+		for _, f := range lit.fields {
+			if name, ok := undefinedVariable(f.value, defined); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (v *validator) errorf(loc Location, format string, args ...any) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+// conditionArgs are the arguments of @skip and @include.
+var conditionArgs = []*Argument{{Name: "if", Type: NewNonNull(Boolean)}}
+
+// coerceArguments returns the values of given for defs, with defaults for
+// those left out.
+func coerceArguments(defs []*Argument, given []*argument, vars map[string]any) (map[string]any, error) {
+	args := make(map[string]any, len(defs))
+	for _, g := range given {
+		found := false
+		for _, def := range defs {
+			found = found || def.Name == g.name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown argument %q", g.name)
+		}
+	}
+	for _, def := range defs {
+		var lit *value
+		for _, g := range given {
+			if g.name == def.Name {
+				lit = g.value
+			}
+		}
+		if lit != nil && lit.kind == valueVariable {
+			if v, ok := vars[lit.raw]; ok {
+				if _, nonNull := def.Type.(*NonNull); nonNull && v == nil {
+					return nil, fmt.Errorf("argument %q of type %s can't be null", def.Name, def.Type)
+				}
+				args[def.Name] = v
+				continue
+			}
+			lit = nil // A variable without a value leaves the argument out
+		}
+		if lit == nil {
+			if def.Default != nil {
+				args[def.Name] = def.Default
+			} else if _, nonNull := def.Type.(*NonNull); nonNull {
+				return nil, fmt.Errorf("argument %q of type %s is required", def.Name, def.Type)
+			}
+			continue
+		}
+		v, err := coerceLiteral(def.Type, lit, vars)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %v", def.Name, err)
+		}
+		args[def.Name] = v
+	}
+	return args, nil
+}
+
+// coerceLiteral returns the value of lit as of t.
+func coerceLiteral(t Type, lit *value, vars map[string]any) (any, error) {
+	if lit.kind == valueVariable {
+		v, ok := vars[lit.raw]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", lit.raw)
+		}
+		return v, nil
+	}
+	if nn, ok := t.(*NonNull); ok {
+		if lit.kind == valueNull {
+			return nil, fmt.Errorf("expected a non-null %s", nn.Of)
+		}
+		return coerceLiteral(nn.Of, lit, vars)
+	}
+	if lit.kind == valueNull {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *List:
+		if lit.kind != valueList {
+			item, err := coerceLiteral(t.Of, lit, vars)
+			if err != nil {
+				return nil, err
+			}
+			return []any{item}, nil
+		}
+		items := make([]any, len(lit.list))
+		for i, item := range lit.list {
+			v, err := coerceLiteral(t.Of, item, vars)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	case *Enum:
+		if lit.kind != valueEnum || !t.has(lit.raw) {
+			return nil, fmt.Errorf("expected a value of %s", t.Name)
+		}
+		return lit.raw, nil
+	case *Scalar:
+		var raw any
+		switch lit.kind {
+		case valueInt:
+			n, err := strconv.ParseInt(lit.raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("integer %s is out of range", lit.raw)
+			}
+			raw = n
+		case valueFloat:
+			f, err := strconv.ParseFloat(lit.raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", lit.raw)
+			}
+			raw = f
+		case valueString:
+			raw = lit.raw
+		case valueBoolean:
+			raw = lit.raw == "true"
+		default:
+			return nil, fmt.Errorf("expected a %s", t.Name)
+		}
+		v, err := t.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("arguments of type %s aren't supported", t)
+}
+
+// coerceVariable returns v, a variable as decoded from JSON, as of t.
+func coerceVariable(t Type, v any) (any, error) {
+	if nn, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("expected a non-null %s", nn.Of)
+		}
+		return coerceVariable(nn.Of, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *List:
+		list, ok := v.([]any)
+		if !ok {
+			item, err := coerceVariable(t.Of, v)
+			if err != nil {
+				return nil, err
+			}
+			return []any{item}, nil
+		}
+		items := make([]any, len(list))
+		for i, item := range list {
+			c, err := coerceVariable(t.Of, item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = c
+		}
+		return items, nil
+	case *Enum:
+		s, ok := v.(string)
+		if !ok || !t.has(s) {
+			return nil, fmt.Errorf("expected a value of %s", t.Name)
+		}
+		return s, nil
+	case *Scalar:
+		// JSON numbers that are whole parse as integers, as literals do
+		if f, ok := v.(float64); ok && f == float64(int64(f)) && t != Float {
+			v = int64(f)
+		}
+		c, err := t.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("variables of type %s aren't supported", t)
+}
+
+func (e *Enum) has(name string) bool {
+	for _, v := range e.Values {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
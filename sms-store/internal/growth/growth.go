@@ -0,0 +1,253 @@
+// Package growth watches how fast the messages collection grows. A
+// scheduled task samples its document count and sizes into a small, capped
+// history; growth day over day past a threshold, such as a producer stuck
+// resending or a retention job that stopped, is reported and alerted on
+// well before the disk fills. It warns and never fails the service: large
+// growth can be legitimate.
+package growth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// Events of an Alert.
+const (
+	EventFast   = "growth.fast"   // Growth over the last day passed the threshold
+	EventNormal = "growth.normal" // Growth fell back under the threshold
+)
+
+const day = 24 * time.Hour
+
+var alertsSent = metrics.NewCounterVec(
+	"collection_growth_alerts_total",
+	"Alerts the growth monitor raised, by event.",
+	"event",
+)
+
+// Sampler measures the messages collection; *store.MongoStore is one.
+type Sampler interface {
+	SampleGrowth() (models.GrowthSample, error)
+}
+
+// Webhook posts alerts as JSON; *watchdog.WebhookAlerter is one, so growth
+// alerts reach the receiver of ingestion alerts.
+type Webhook interface {
+	Post(ctx context.Context, payload any, what string) error
+}
+
+// Config describes how much history is kept and when growth alerts.
+type Config struct {
+	Collection      string        // Named in alerts
+	Interval        time.Duration // Between samples, as scheduled
+	Keep            int           // Samples kept; older ones are dropped
+	Threshold       float64       // Growth in a day, as a fraction, past which the monitor alerts; 0 never alerts
+	MinStorageBytes int64         // Growth of a collection storing less doesn't alert
+}
+
+// Point is a sample with its growth since the sample a day before. Growth
+// is a fraction: 0.5 is half as much again. It is nil without a sample
+// from between one and two days before, or when that one was empty.
+type Point struct {
+	models.GrowthSample
+	MessagesGrowth *float64 `json:"messagesGrowth,omitempty"`
+	StorageGrowth  *float64 `json:"storageGrowth,omitempty"`
+}
+
+// Growth returns the larger of p's growth rates, or 0 without any.
+func (p Point) Growth() float64 {
+	growth := 0.0
+	for _, g := range []*float64{p.MessagesGrowth, p.StorageGrowth} {
+		if g != nil && *g > growth {
+			growth = *g
+		}
+	}
+	return growth
+}
+
+// Series returns the points of samples, which are oldest first.
+func Series(samples []models.GrowthSample) []Point {
+	points := make([]Point, len(samples))
+	for i, s := range samples {
+		points[i] = Point{GrowthSample: s}
+		// The last sample at least a day older, if it's less than two
+		j, _ := slices.BinarySearchFunc(samples[:i], s.At.Add(-day), func(e models.GrowthSample, t time.Time) int {
+			if e.At.After(t) {
+				return 1
+			}
+			return -1
+		})
+		if j == 0 || samples[j-1].At.Before(s.At.Add(-2*day)) {
+			continue
+		}
+		prev := samples[j-1]
+		points[i].MessagesGrowth = rate(s.Messages, prev.Messages)
+		points[i].StorageGrowth = rate(s.StorageBytes, prev.StorageBytes)
+	}
+	return points
+}
+
+func rate(now, before int64) *float64 {
+	if before <= 0 {
+		return nil
+	}
+	r := float64(now-before) / float64(before)
+	return &r
+}
+
+// Alert tells about growth passing the threshold or falling back under it.
+type Alert struct {
+	Event     string    `json:"event"`
+	Source    string    `json:"source"` // The collection
+	At        time.Time `json:"at"`
+	Summary   string    `json:"summary"` // One line, for chat and logs
+	Threshold float64   `json:"threshold"`
+	Point     Point     `json:"point"`
+}
+
+// Status is what the monitor knows of the latest sample.
+type Status struct {
+	Latest    *Point    `json:"latest"`             // Nil until the first sample
+	Fast      bool      `json:"fast"`               // Growth is past the threshold
+	AlertedAt time.Time `json:"alertedAt,omitzero"` // When growth was reported fast, while it still is
+}
+
+// Monitor samples the collection from Sample and raises alerts. Its
+// methods are safe for concurrent use.
+type Monitor struct {
+	config  Config
+	sampler Sampler
+	history store.GrowthStore
+	webhook Webhook
+
+	mu        sync.Mutex
+	latest    *Point
+	alertedAt time.Time
+
+	clock.Clocked // Tells the time of samples
+}
+
+// New returns a monitor keeping the samples of sampler in history and
+// posting alerts to webhook, after logging them. A nil webhook only logs.
+func New(config Config, sampler Sampler, history store.GrowthStore, webhook Webhook) (*Monitor, error) {
+	if config.Interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	if time.Duration(config.Keep)*config.Interval <= day {
+		return nil, fmt.Errorf("history must keep more than a day of samples, %d at %s", int(day/config.Interval)+1, config.Interval)
+	}
+	if !(config.Threshold >= 0) { // NaN too
+		return nil, errors.New("threshold must not be negative")
+	}
+	return &Monitor{config: config, sampler: sampler, history: history, webhook: webhook}, nil
+}
+
+// Config returns the monitor's configuration.
+func (m *Monitor) Config() Config {
+	return m.config
+}
+
+// Sample records the collection's size now, dropping the oldest sample
+// past the ones kept, and alerts when growth passes the threshold or falls
+// back under it. It is meant to run as a scheduled task every
+// Config.Interval.
+func (m *Monitor) Sample(ctx context.Context) error {
+	sample, err := m.sampler.SampleGrowth()
+	if err != nil {
+		return err
+	}
+	sample.At = m.Clock().Now().UTC()
+	if err := m.history.AddGrowthSample(sample, m.config.Keep); err != nil {
+		return err
+	}
+	samples, err := m.history.ListGrowthSamples()
+	if err != nil {
+		return err
+	}
+	points := Series(samples)
+	if len(points) == 0 {
+		return nil
+	}
+	latest := points[len(points)-1]
+
+	var alert *Alert
+	m.mu.Lock()
+	m.latest = &latest
+	switch fast := m.fast(latest); {
+	case fast && m.alertedAt.IsZero():
+		m.alertedAt = sample.At
+		alert = m.newAlert(EventFast, latest)
+	case !fast && !m.alertedAt.IsZero():
+		m.alertedAt = time.Time{}
+		alert = m.newAlert(EventNormal, latest)
+	}
+	m.mu.Unlock()
+
+	if alert == nil {
+		return nil
+	}
+	alertsSent.WithLabelValues(alert.Event).Inc()
+	log.Printf("Growth monitor: %s", alert.Summary)
+	if m.webhook == nil {
+		return nil
+	}
+	return m.webhook.Post(ctx, alert, fmt.Sprintf("%s alert for %s", alert.Event, alert.Source))
+}
+
+// Status returns what the monitor knows of the latest sample, without
+// reading the history.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Status{Latest: m.latest, Fast: m.latest != nil && m.fast(*m.latest), AlertedAt: m.alertedAt}
+}
+
+// Series returns the points of every stored sample, oldest first.
+func (m *Monitor) Series() ([]Point, error) {
+	samples, err := m.history.ListGrowthSamples()
+	if err != nil {
+		return nil, err
+	}
+	return Series(samples), nil
+}
+
+// Summary describes p's growth in one line.
+func (m *Monitor) Summary(p Point) string {
+	return fmt.Sprintf("%s grew %.0f%% in a day (threshold %.0f%%) to %d messages in %s",
+		m.config.Collection, p.Growth()*100, m.config.Threshold*100, p.Messages, formatBytes(p.StorageBytes))
+}
+
+func (m *Monitor) fast(p Point) bool {
+	return m.config.Threshold > 0 && p.StorageBytes >= m.config.MinStorageBytes && p.Growth() > m.config.Threshold
+}
+
+func (m *Monitor) newAlert(event string, p Point) *Alert {
+	summary := m.Summary(p)
+	if event == EventNormal {
+		summary = fmt.Sprintf("%s growth is back under the threshold, at %.0f%% in a day", m.config.Collection, p.Growth()*100)
+	}
+	return &Alert{Event: event, Source: m.config.Collection, At: p.At, Summary: summary, Threshold: m.config.Threshold, Point: p}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < 4 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[prefix])
+}
@@ -0,0 +1,434 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sms-store/internal/jobs"
+)
+
+// isAdmin reports whether the request has admin scope.
+func (h *Handler) isAdmin(r *http.Request) bool {
+	return h.scope(r).includes(ScopeAdmin)
+}
+
+// requireAdmin answers 403 and returns false unless the request has admin scope.
+func (h *Handler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	return h.requireScope(w, r, ScopeAdmin)
+}
+
+// SetJobManager replaces the background job manager, e.g. with one backed by
+// MongoDB so job state survives restarts. The default keeps jobs in memory.
+func (h *Handler) SetJobManager(m *jobs.Manager) {
+	h.jobs = m
+}
+
+// ListAdminJobs lists background jobs, newest first.
+// GET /v1/admin/jobs?type=&status=&limit=
+func (h *Handler) ListAdminJobs(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := jobs.ListFilter{Type: q.Get("type"), Status: q.Get("status"), Limit: 50}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be a positive integer")
+			return
+		}
+		filter.Limit = min(n, 500)
+	}
+
+	list, err := h.jobs.List(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not list jobs")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetAdminJob reports the state of a background job.
+// GET /v1/admin/jobs/{id}
+func (h *Handler) GetAdminJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	id, ok := adminJobID(r.URL.Path, "")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid job id")
+		return
+	}
+
+	job, err := h.jobs.Get(id)
+	if err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "job not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve job")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// CancelAdminJob asks a queued or running job to stop.
+// POST /v1/admin/jobs/{id}/cancel
+func (h *Handler) CancelAdminJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	id, ok := adminJobID(r.URL.Path, "/cancel")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid job id")
+		return
+	}
+
+	job, err := h.jobs.Cancel(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "job not found")
+		case errors.Is(err, jobs.ErrFinished):
+			writeErrorDetails(w, http.StatusConflict, "CONFLICT", "job already finished", job)
+		default:
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not cancel job")
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// adminJobID extracts the job ID from /v1/admin/jobs/{id}{suffix}.
+func adminJobID(path, suffix string) (string, bool) {
+	prefix := "/v1/admin/jobs/"
+	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) {
+		return "", false
+	}
+	id := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(path, prefix), suffix))
+	if id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+// adminRoutes adds the /v1/admin routes to mux.
+func (h *Handler) adminRoutes(mux *http.ServeMux) {
+	// GET /v1/admin/pricing - Pricing table in use
+	mux.HandleFunc("/v1/admin/pricing", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetPricing(w, r)
+	})
+
+	// POST /v1/admin/pricing/reload - Reload the pricing table from its source
+	mux.HandleFunc("/v1/admin/pricing/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ReloadPricing(w, r)
+	})
+
+	// POST /v1/admin/archive - Archive old messages in the background
+	mux.HandleFunc("/v1/admin/archive", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.StartArchive(w, r)
+	})
+
+	// POST /v1/admin/search/tokens/backfill - Tokenize existing messages for prefix search
+	mux.HandleFunc("/v1/admin/search/tokens/backfill", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.BackfillSearchTokens(w, r)
+	})
+
+	// POST /v1/admin/conversations/summaries/rebuild - Recompute summaries
+	mux.HandleFunc("/v1/admin/conversations/summaries/rebuild", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.RebuildSummaries(w, r)
+	})
+
+	// POST /v1/admin/conversations/summaries/check - Compare a sample with the messages
+	mux.HandleFunc("/v1/admin/conversations/summaries/check", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.CheckSummaries(w, r)
+	})
+
+	// GET /v1/admin/store/latency - Recent store latency percentiles
+	mux.HandleFunc("/v1/admin/store/latency", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetStoreLatency(w, r)
+	})
+
+	// GET /v1/admin/store/stats - Message store usage
+	mux.HandleFunc("/v1/admin/store/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetStoreStats(w, r)
+	})
+
+	// POST /v1/admin/migrate/start - Bulk-import NDJSON files from MIGRATION_DIR
+	mux.HandleFunc("/v1/admin/migrate/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.StartMigration(w, r)
+	})
+
+	// POST /v1/admin/seed - Generate demo conversations in the background
+	// DELETE /v1/admin/seed - Remove the generated conversations
+	mux.HandleFunc("/v1/admin/seed", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.StartSeed(w, r)
+		case http.MethodDelete:
+			h.DeleteSeed(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// POST /v1/admin/export/query - Export the messages matching a search in the background
+	mux.HandleFunc("/v1/admin/export/query", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.StartQueryExport(w, r)
+	})
+
+	// GET /v1/admin/tombstones - List active conversation tombstones
+	mux.HandleFunc("/v1/admin/tombstones", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListTombstones(w, r)
+	})
+
+	// DELETE /v1/admin/tombstones/{phoneNumber} - Clear a tombstone
+	mux.HandleFunc("/v1/admin/tombstones/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.DeleteTombstone(w, r)
+	})
+
+	// POST /v1/admin/profiles/merge - Merge the profile of a duplicate contact into another
+	mux.HandleFunc("/v1/admin/profiles/merge", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.MergeProfiles(w, r)
+	})
+
+	// POST /v1/admin/profiles/cleanup?olderThanDays=&dryRun= - Delete auto-created profiles of quiet numbers
+	mux.HandleFunc("/v1/admin/profiles/cleanup", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.StartProfileCleanup(w, r)
+	})
+
+	// GET, PUT /v1/admin/accounts/{id}/quota - Storage usage and limit of an account
+	// GET, PUT /v1/admin/accounts/{id}/attributes - Custom attribute schema of an account
+	// GET, PUT /v1/admin/accounts/{id}/auto-ack - Automatic acknowledgement of an account's new conversations
+	mux.HandleFunc("/v1/admin/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/attributes") {
+			h.AccountAttributeSchema(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/auto-ack") {
+			h.AccountAutoAck(w, r)
+			return
+		}
+		h.AccountQuota(w, r)
+	})
+
+	// POST /v1/admin/quotas/reconcile - Recount quota counters in the background
+	mux.HandleFunc("/v1/admin/quotas/reconcile", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.StartQuotaReconcile(w, r)
+	})
+
+	// GET /v1/admin/audit?phoneNumber=&limit= - Newest audit log entries
+	mux.HandleFunc("/v1/admin/audit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListAudit(w, r)
+	})
+
+	// POST /v1/admin/user/{phoneNumber}/snapshot - Capture a snapshot of a conversation
+	// GET /v1/admin/user/{phoneNumber}/diff?from=&to= - Changes between snapshots, or a snapshot and live data
+	mux.HandleFunc("/v1/admin/user/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/snapshot") && r.Method == http.MethodPost:
+			h.CreateSnapshot(w, r)
+		case strings.HasSuffix(r.URL.Path, "/diff") && r.Method == http.MethodGet:
+			h.DiffSnapshots(w, r)
+		case strings.HasSuffix(r.URL.Path, "/snapshot"), strings.HasSuffix(r.URL.Path, "/diff"):
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// GET /v1/admin/deletion-receipts?phoneNumber=&from=&to=&limit= - Receipts of deletes
+	mux.HandleFunc("/v1/admin/deletion-receipts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListDeletionReceipts(w, r)
+	})
+
+	// GET /v1/admin/messages/{id}/raw - Payload a message arrived with
+	mux.HandleFunc("/v1/admin/messages/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetRawEvent(w, r)
+	})
+
+	// GET /v1/admin/consumer/offsets - Kafka consumer offsets and lag per partition
+	mux.HandleFunc("/v1/admin/consumer/offsets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetConsumerOffsets(w, r)
+	})
+
+	// GET /v1/admin/ingestion/latency - Recent Kafka ingestion latency percentiles
+	mux.HandleFunc("/v1/admin/ingestion/latency", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetIngestionLatency(w, r)
+	})
+
+	// GET /v1/admin/ingestion/health - When each ingestion source last stored a message
+	mux.HandleFunc("/v1/admin/ingestion/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetIngestionHealth(w, r)
+	})
+
+	// GET /v1/admin/growth - Size history and day-over-day growth of the messages collection
+	mux.HandleFunc("/v1/admin/growth", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetGrowth(w, r)
+	})
+
+	// POST /v1/admin/consumer/seek - Move the Kafka consumer and replay
+	mux.HandleFunc("/v1/admin/consumer/seek", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.SeekConsumer(w, r)
+	})
+
+	// POST /v1/admin/events/validate - Decode an sms-events payload without storing it
+	mux.HandleFunc("/v1/admin/events/validate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ValidateEvent(w, r)
+	})
+
+	// GET /v1/admin/jobs - List background admin jobs
+	mux.HandleFunc("/v1/admin/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListAdminJobs(w, r)
+	})
+
+	// GET /v1/admin/jobs/{id} - Progress of a background admin job
+	// POST /v1/admin/jobs/{id}/cancel - Cancel a queued or running job
+	mux.HandleFunc("/v1/admin/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/cancel") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.CancelAdminJob(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetAdminJob(w, r)
+	})
+
+	// GET /v1/admin/tasks - Periodic tasks with their last and next runs
+	mux.HandleFunc("/v1/admin/tasks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListAdminTasks(w, r)
+	})
+
+	// POST /v1/admin/tasks/{name}/run - Run a periodic task now
+	mux.HandleFunc("/v1/admin/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/run") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.RunAdminTask(w, r)
+	})
+}
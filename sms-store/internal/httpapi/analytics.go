@@ -0,0 +1,29 @@
+package httpapi
+
+import "sms-store/internal/store"
+
+// SetAnalyticsStores makes searches, digests, cost summaries and exports
+// read from messages and profiles, usually the handler's collections read
+// from secondaries so these scans stay off the primary. Reads that must see
+// a write just made, such as a conversation's pages, keep the handler's
+// stores. Either may be nil to keep the handler's.
+func (h *Handler) SetAnalyticsStores(messages store.Store, profiles store.ProfileStore) {
+	h.analytics = messages
+	h.analyticsProfiles = profiles
+}
+
+// analyticsStore returns the message store analytics read from.
+func (h *Handler) analyticsStore() store.Store {
+	if h.analytics != nil {
+		return h.analytics
+	}
+	return h.store
+}
+
+// analyticsProfileStore returns the profile store analytics read from.
+func (h *Handler) analyticsProfileStore() store.ProfileStore {
+	if h.analyticsProfiles != nil {
+		return h.analyticsProfiles
+	}
+	return h.profileStore
+}
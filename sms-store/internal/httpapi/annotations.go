@@ -0,0 +1,196 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	maxAnnotationSource = 128
+	maxAnnotationLabel  = 64 // As annotationLabel
+	maxReviewerLength   = 128
+	maxReviewNoteLength = 500
+)
+
+var (
+	// annotationSource matches classifier names, such as complaints-v2 or
+	// ml.intent; they sit in review paths, so '/' is out.
+	annotationSource = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]*$`)
+
+	// annotationLabel matches labels, such as refund-request, once lowercased.
+	annotationLabel = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+type annotationRequest struct {
+	Source     string   `json:"source"`
+	Label      string   `json:"label"`
+	Confidence *float64 `json:"confidence"`
+}
+
+func (req *annotationRequest) validate() error {
+	req.Source = strings.TrimSpace(req.Source)
+	if len(req.Source) > maxAnnotationSource || !annotationSource.MatchString(req.Source) {
+		return fmt.Errorf("source is required and at most %d letters, digits, '.', ':', '-' and '_'", maxAnnotationSource)
+	}
+	req.Label = strings.ToLower(strings.TrimSpace(req.Label))
+	if !annotationLabel.MatchString(req.Label) {
+		return fmt.Errorf("label must be at most %d lowercase letters, digits, '-' and '_'", maxAnnotationLabel)
+	}
+	if req.Confidence == nil || *req.Confidence < 0 || *req.Confidence > 1 {
+		return errors.New("confidence is required and between 0 and 1")
+	}
+	return nil
+}
+
+type annotationReviewRequest struct {
+	Reviewer string `json:"reviewer"`
+	Decision string `json:"decision"`
+	Note     string `json:"note"`
+}
+
+func (req *annotationReviewRequest) validate() error {
+	req.Reviewer = strings.TrimSpace(req.Reviewer)
+	if req.Reviewer == "" || utf8.RuneCountInString(req.Reviewer) > maxReviewerLength {
+		return fmt.Errorf("reviewer is required and at most %d characters", maxReviewerLength)
+	}
+	req.Decision = strings.ToLower(strings.TrimSpace(req.Decision))
+	if req.Decision != models.AnnotationConfirmed && req.Decision != models.AnnotationRejected {
+		return errors.New("decision must be confirmed or rejected")
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(req.Note) > maxReviewNoteLength {
+		return fmt.Errorf("note must be at most %d characters", maxReviewNoteLength)
+	}
+	return nil
+}
+
+type annotationsResponse struct {
+	MessageID   string              `json:"messageId"`
+	Annotations []models.Annotation `json:"annotations"` // In the order their sources first set them
+}
+
+// SetAnnotation writes a classifier's label back onto a message. Each
+// source keeps one annotation per message: setting it again replaces the
+// label, confidence and time, and clears its review, which was of the old
+// label. A message keeps annotations of at most
+// store.MaxAnnotationsPerMessage sources.
+// POST /messages/{id}/annotations
+func (h *Handler) SetAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, ok := messagePathID(r.URL.Path, "/annotations")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return
+	}
+	var req annotationRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+
+	msg, err := h.store.SetAnnotation(id, models.Annotation{
+		Source:     req.Source,
+		Label:      req.Label,
+		Confidence: *req.Confidence,
+		CreatedAt:  h.Clock().Now().UTC(),
+	})
+	switch {
+	case errors.Is(err, store.ErrTooManyAnnotations):
+		writeError(w, http.StatusConflict, "CONFLICT", fmt.Sprintf("message already has annotations from %d sources", store.MaxAnnotationsPerMessage))
+		return
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "message not found")
+		return
+	case err != nil:
+		writeStoreError(w, err, "update annotations")
+		return
+	}
+	writeJSON(w, http.StatusOK, newAnnotationsResponse(msg))
+}
+
+// ReviewAnnotation records a person confirming or rejecting a source's
+// annotation of a message. Reviewing it again replaces the review. Rejected
+// annotations no longer match ?annotation= filters.
+// POST /messages/{id}/annotations/{source}/review
+func (h *Handler) ReviewAnnotation(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/messages/"), "/review")
+	id, source, found := strings.Cut(rest, "/annotations/")
+	if !ok || !found || id == "" || strings.Contains(id, "/") || !annotationSource.MatchString(source) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID or annotation source")
+		return
+	}
+	var req annotationReviewRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+
+	msg, err := h.store.ReviewAnnotation(id, source, models.AnnotationReview{
+		Reviewer:   req.Reviewer,
+		Decision:   req.Decision,
+		Note:       req.Note,
+		ReviewedAt: h.Clock().Now().UTC(),
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "annotation not found")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "review annotation")
+		return
+	}
+	writeJSON(w, http.StatusOK, newAnnotationsResponse(msg))
+}
+
+func newAnnotationsResponse(msg models.Message) annotationsResponse {
+	resp := annotationsResponse{MessageID: msg.ID, Annotations: msg.Annotations}
+	if resp.Annotations == nil {
+		resp.Annotations = []models.Annotation{}
+	}
+	return resp
+}
+
+// parseAnnotationFilter reads ?annotation= and ?minConfidence=. An empty
+// annotation filters nothing; minConfidence defaults to 0.
+func parseAnnotationFilter(q url.Values) (string, float64, error) {
+	label := strings.ToLower(strings.TrimSpace(q.Get("annotation")))
+	rawConfidence := strings.TrimSpace(q.Get("minConfidence"))
+	if label == "" {
+		if rawConfidence != "" {
+			return "", 0, errors.New("minConfidence requires annotation")
+		}
+		return "", 0, nil
+	}
+	if !annotationLabel.MatchString(label) {
+		return "", 0, errors.New("annotation must be a label such as complaint")
+	}
+	if rawConfidence == "" {
+		return label, 0, nil
+	}
+	minConfidence, err := strconv.ParseFloat(rawConfidence, 64)
+	if err != nil || !(minConfidence >= 0 && minConfidence <= 1) { // NaN too
+		return "", 0, errors.New("minConfidence must be between 0 and 1")
+	}
+	return label, minConfidence, nil
+}
+
+// filterByAnnotation keeps only messages with an unrejected annotation of
+// label with at least minConfidence; an empty label keeps all.
+func filterByAnnotation(messages []models.Message, label string, minConfidence float64) []models.Message {
+	if label == "" {
+		return messages
+	}
+	out := make([]models.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.HasAnnotation(label, minConfidence) {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	archiveJobType       = "archive_messages"
+	archiveBatchAttempts = 3
+)
+
+// SetArchiver attaches the cold archive for old messages. Until one is set,
+// archiving answers 501 and ?includeArchived=true reads only live messages.
+func (h *Handler) SetArchiver(a store.Archiver) {
+	h.archiver = a
+}
+
+// includeArchived reports whether the request asked for archived messages too.
+func (h *Handler) includeArchived(r *http.Request) bool {
+	return h.archiver != nil && r.URL.Query().Get("includeArchived") == "true"
+}
+
+// StartArchive archives messages older than ?olderThanDays= (default
+// ArchiveAfter) in the background. Requires the admin scope.
+// POST /v1/admin/archive?olderThanDays=90
+func (h *Handler) StartArchive(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.archiver == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "archiving is not configured")
+		return
+	}
+
+	olderThan := h.config.ArchiveAfter
+	if raw := strings.TrimSpace(r.URL.Query().Get("olderThanDays")); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "olderThanDays must be a positive integer")
+			return
+		}
+		olderThan = time.Duration(days) * 24 * time.Hour
+	}
+
+	job, err := h.SubmitArchive(olderThan)
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start archiving")
+		return
+	}
+
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": "Archiving started",
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+// SubmitArchive starts a job archiving messages older than olderThan, or
+// returns the archive job already running with jobs.ErrAlreadyRunning.
+// It is also called on a schedule.
+func (h *Handler) SubmitArchive(olderThan time.Duration) (jobs.Job, error) {
+	if h.archiver == nil {
+		return jobs.Job{}, errors.New("archiving is not configured")
+	}
+	cutoff := h.Clock().Now().Add(-olderThan)
+	return h.jobs.Submit(archiveJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		return h.runArchive(ctx, p, cutoff)
+	})
+}
+
+// runArchive moves batches into the archive until none are left before
+// cutoff. Each batch is safe to repeat, so a failed one is retried and a
+// job interrupted by a restart is simply run again.
+func (h *Handler) runArchive(ctx context.Context, p *jobs.Progress, cutoff time.Time) (map[string]any, error) {
+	batchSize := h.config.ArchiveBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultHandlerConfig().ArchiveBatchSize
+	}
+
+	var archived int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var n int64
+		var err error
+		for attempt := 1; attempt <= archiveBatchAttempts; attempt++ {
+			if n, err = h.archiver.ArchiveBatch(cutoff, batchSize); err == nil {
+				break
+			}
+			log.Printf("Archive batch attempt %d failed: %v", attempt, err)
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			// The archive moves messages behind the store's back, so the
+			// summaries' counts are recomputed
+			if archived > 0 && h.summaries != nil {
+				if _, err := h.summaries.RebuildSummaries(nil); err != nil {
+					return nil, err
+				}
+			}
+			return map[string]any{"archivedCount": archived, "cutoff": cutoff}, nil
+		}
+		archived += n
+		p.Add(n)
+	}
+}
+
+// withArchived appends phoneNumber's archived messages to live and sorts the
+// result newest first.
+func (h *Handler) withArchived(phoneNumber string, live []models.Message) ([]models.Message, error) {
+	archived, err := h.archiver.FindArchivedByPhoneNumber(phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	return mergeNewestFirst(live, archived), nil
+}
+
+// mergeNewestFirst merges two message lists into one ordered newest first
+// (createdAt descending, ID descending), like the store's pages.
+func mergeNewestFirst(a, b []models.Message) []models.Message {
+	out := make([]models.Message, 0, len(a)+len(b))
+	out = append(out, a...)
+	out = append(out, b...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out
+}
+
+// withArchivedPhoneNumbers adds numbers whose conversation is entirely archived.
+func (h *Handler) withArchivedPhoneNumbers(phoneNumbers []string) ([]string, error) {
+	archived, err := h.archiver.GetArchivedPhoneNumbers()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		seen[pn] = true
+	}
+	for _, pn := range archived {
+		if !seen[pn] {
+			phoneNumbers = append(phoneNumbers, pn)
+			seen[pn] = true
+		}
+	}
+	return phoneNumbers, nil
+}
+
+// withCounts fills in live and archived message counts.
+func (h *Handler) withCounts(convs []conversationWithPreferences) error {
+	counts, err := h.archiver.ConversationCounts(directPhoneNumbers(convs))
+	if err != nil {
+		return err
+	}
+	for i := range convs {
+		if convs[i].Type != models.ConversationDirect {
+			continue
+		}
+		c := counts[convs[i].PhoneNumber]
+		convs[i].MessageCount = &c.MessageCount
+		convs[i].ArchivedCount = &c.ArchivedCount
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// attributeQueryPrefix starts the GET /v1/conversations query parameters
+// that filter on a custom attribute, as in ?attr.customerTier=gold.
+const attributeQueryPrefix = "attr."
+
+// SetAttributeSchemaStore attaches the per-account custom attribute schemas.
+// Attribute endpoints and ?attr. filters answer 501 until one is set, and
+// until conversation summaries, which carry the attributes, are.
+func (h *Handler) SetAttributeSchemaStore(as store.AttributeSchemaStore) {
+	h.attributeSchemas = as
+}
+
+type attributeSchemaRequest struct {
+	Attributes []models.AttributeDefinition `json:"attributes"`
+}
+
+type conversationAttributesRequest struct {
+	CustomAttributes map[string]any `json:"customAttributes"`
+}
+
+type conversationAttributesResponse struct {
+	PhoneNumber      string         `json:"phoneNumber"`
+	CustomAttributes map[string]any `json:"customAttributes"`
+}
+
+// AccountAttributeSchema returns an account's custom attribute schema, or
+// replaces it with PUT, indexing the attributes marked indexed. Requires
+// the admin scope.
+// GET /v1/admin/accounts/{id}/attributes
+// PUT /v1/admin/accounts/{id}/attributes
+//
+// A new schema applies to later writes only: values stored under the old
+// one are kept, and returned, as they are.
+func (h *Handler) AccountAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.attributeSchemas == nil || h.summaries == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "attribute schemas are not configured")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/admin/accounts/")
+	account, ok := strings.CutSuffix(rest, "/attributes")
+	account = strings.TrimSpace(account)
+	if !ok || account == "" || strings.Contains(account, "/") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "route not found")
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		schema, err := h.attributeSchemas.GetAttributeSchema(account)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve attribute schema")
+			return
+		}
+		writeJSON(w, http.StatusOK, schema)
+		return
+	}
+
+	var req attributeSchemaRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	defs, err := models.NormalizeAttributeDefinitions(req.Attributes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	schema, err := h.attributeSchemas.PutAttributeSchema(models.AttributeSchema{AccountID: account, Attributes: defs})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not save attribute schema")
+		return
+	}
+	for _, def := range defs {
+		if def.Indexed {
+			if err := h.summaries.EnsureAttributeIndex(def.Name); err != nil {
+				writeError(w, http.StatusInternalServerError, "INTERNAL", "could not save attribute schema")
+				return
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, schema)
+}
+
+// GetConversationAttributes returns a conversation's custom attributes.
+// GET /v1/user/{phoneNumber}/attributes
+func (h *Handler) GetConversationAttributes(w http.ResponseWriter, r *http.Request) {
+	if h.attributeSchemas == nil || h.summaries == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "attribute schemas are not configured")
+		return
+	}
+
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/attributes")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	summary, found, err := h.conversationSummary(phoneNumber)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation summary")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "conversation not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, attributesResponse(summary))
+}
+
+// PutConversationAttributes sets the custom attributes given, removing
+// those given as null and leaving the rest, after checking them against
+// the account's schema.
+// PUT /v1/user/{phoneNumber}/attributes
+func (h *Handler) PutConversationAttributes(w http.ResponseWriter, r *http.Request) {
+	if h.attributeSchemas == nil || h.summaries == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "attribute schemas are not configured")
+		return
+	}
+
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/attributes")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	var req conversationAttributesRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.CustomAttributes == nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "customAttributes is required")
+		return
+	}
+
+	schema, err := h.attributeSchemas.GetAttributeSchema(accountID(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve attribute schema")
+		return
+	}
+	summary, found, err := h.conversationSummary(phoneNumber)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation summary")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "conversation not found")
+		return
+	}
+
+	set, unset, err := schema.ApplyAttributes(summary.CustomAttributes, req.CustomAttributes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if summary, err = h.summaries.SetAttributes(phoneNumber, set, unset); err != nil {
+		writeStoreError(w, err, "update attributes")
+		return
+	}
+	writeJSON(w, http.StatusOK, attributesResponse(summary))
+}
+
+// conversationSummary returns phoneNumber's stored summary, building it
+// from the messages if there is none yet.
+func (h *Handler) conversationSummary(phoneNumber string) (store.ConversationSummary, bool, error) {
+	summaries, err := h.summaries.GetSummaries([]string{phoneNumber})
+	if err != nil {
+		return store.ConversationSummary{}, false, err
+	}
+	if s, ok := summaries[phoneNumber]; ok {
+		return s, true, nil
+	}
+
+	if _, err := h.summaries.RebuildSummaries([]string{phoneNumber}); err != nil {
+		return store.ConversationSummary{}, false, err
+	}
+	if summaries, err = h.summaries.GetSummaries([]string{phoneNumber}); err != nil {
+		return store.ConversationSummary{}, false, err
+	}
+	s, ok := summaries[phoneNumber]
+	return s, ok, nil
+}
+
+func attributesResponse(s store.ConversationSummary) conversationAttributesResponse {
+	attrs := s.CustomAttributes
+	if attrs == nil {
+		attrs = map[string]any{}
+	}
+	return conversationAttributesResponse{PhoneNumber: s.PhoneNumber, CustomAttributes: attrs}
+}
+
+// attributeFilter returns the custom attribute values the attr. parameters
+// of q ask for, parsed as the types the schema gives them, or nil when
+// there are none.
+func attributeFilter(q url.Values, schema models.AttributeSchema) (map[string]any, error) {
+	var filter map[string]any
+	for key, values := range q {
+		name, ok := strings.CutPrefix(key, attributeQueryPrefix)
+		if !ok {
+			continue
+		}
+		def, ok := schema.Definition(name)
+		if !ok {
+			return nil, errors.New("unknown attribute " + name)
+		}
+		value, err := def.ParseValue(key, values[0])
+		if err != nil {
+			return nil, err
+		}
+		if filter == nil {
+			filter = make(map[string]any)
+		}
+		filter[name] = value
+	}
+	return filter, nil
+}
+
+// hasAttributeFilter reports whether q filters on a custom attribute.
+func hasAttributeFilter(q url.Values) bool {
+	for key := range q {
+		if strings.HasPrefix(key, attributeQueryPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByAttributes keeps the phone numbers whose conversations hold every
+// value of filter.
+func (h *Handler) filterByAttributes(phoneNumbers []string, filter map[string]any) ([]string, error) {
+	matching, err := h.summaries.FindByAttributes(filter)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[string]bool, len(matching))
+	for _, pn := range matching {
+		matched[pn] = true
+	}
+	kept := make([]string, 0, len(matching))
+	for _, pn := range phoneNumbers {
+		if matched[pn] {
+			kept = append(kept, pn)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/autoack"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// maxAutoAckWindow is the longest window an auto-ack config may set.
+const maxAutoAckWindow = 30 * 24 * time.Hour
+
+// SetAutoAck attaches the per-account auto-ack configs and the templates
+// they may name. The auto-ack endpoint answers 501 until they are set.
+func (h *Handler) SetAutoAck(configs store.AutoAckStore, templates *autoack.Templates) {
+	h.autoAcks = configs
+	h.autoAckTemplates = templates
+}
+
+type autoAckRequest struct {
+	Enabled    bool   `json:"enabled"`
+	TemplateID string `json:"templateId"`
+	Window     string `json:"window"`
+}
+
+func (req *autoAckRequest) validate() error {
+	req.TemplateID = strings.TrimSpace(req.TemplateID)
+	if req.Enabled && req.TemplateID == "" {
+		return errors.New("templateId is required to enable auto-acks")
+	}
+	req.Window = strings.TrimSpace(req.Window)
+	if req.Window == "" {
+		req.Window = models.DefaultAutoAckWindow.String()
+	}
+	window, err := time.ParseDuration(req.Window)
+	if err != nil || window <= 0 || window > maxAutoAckWindow {
+		return fmt.Errorf("window must be a duration such as 24h, at most %s", maxAutoAckWindow)
+	}
+	req.Window = window.String()
+	return nil
+}
+
+type autoAckResponse struct {
+	models.AutoAckConfig
+	Templates []string `json:"templates"` // IDs a config may name, language variants included
+}
+
+// AccountAutoAck returns an account's auto-ack config, or replaces it with
+// PUT. Requires the admin scope.
+// GET /v1/admin/accounts/{id}/auto-ack
+// PUT /v1/admin/accounts/{id}/auto-ack
+func (h *Handler) AccountAutoAck(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.autoAcks == nil || h.autoAckTemplates == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "auto-acks are not configured")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/admin/accounts/")
+	account, ok := strings.CutSuffix(rest, "/auto-ack")
+	account = strings.TrimSpace(account)
+	if !ok || account == "" || strings.Contains(account, "/") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "route not found")
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		config, err := h.autoAcks.GetAutoAckConfig(account)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve auto-ack config")
+			return
+		}
+		writeJSON(w, http.StatusOK, h.autoAckResponse(config))
+		return
+	}
+
+	var req autoAckRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+	if req.TemplateID != "" && !h.autoAckTemplates.Has(req.TemplateID) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("no template %s", req.TemplateID))
+		return
+	}
+
+	config, err := h.autoAcks.PutAutoAckConfig(models.AutoAckConfig{
+		AccountID:  account,
+		Enabled:    req.Enabled,
+		TemplateID: req.TemplateID,
+		Window:     req.Window,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not save auto-ack config")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.autoAckResponse(config))
+}
+
+func (h *Handler) autoAckResponse(config models.AutoAckConfig) autoAckResponse {
+	return autoAckResponse{AutoAckConfig: config, Templates: h.autoAckTemplates.IDs()}
+}
@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// terminalStatuses are message statuses that never change once written.
+// Messages in any other status may still receive status updates and make
+// the page they appear on mutable.
+var terminalStatuses = map[string]bool{
+	"SUCCESS":   true,
+	"FAIL":      true,
+	"FAILED":    true,
+	"DELIVERED": true,
+	"RECEIVED":  true,
+}
+
+// isCacheablePage decides whether a message page may be cached by clients,
+// to be revalidated with its ETag.
+//
+// Only pages anchored by a cursor qualify: the first page of a conversation
+// changes whenever a new message arrives, no matter how old its newest item is.
+// An anchored page is cacheable when its newest message is older than the
+// configured threshold and every message on it has a terminal status.
+func (h *Handler) isCacheablePage(page store.PageQuery, messages []models.Message) bool {
+	if page.Before.IsZero() || len(messages) == 0 || h.config.MessageCacheThreshold <= 0 {
+		return false
+	}
+
+	// Pages are sorted newest first
+	if h.Clock().Now().Sub(messages[0].CreatedAt) < h.config.MessageCacheThreshold {
+		return false
+	}
+
+	// Classifiers annotate messages long after they arrive, so a page
+	// filtered by annotation may still gain messages
+	if page.Annotation != "" {
+		return false
+	}
+
+	for _, msg := range messages {
+		if !terminalStatuses[msg.Status] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeCacheableJSON writes payload with a strong ETag and private caching
+// headers, answering 304 Not Modified when the client's If-None-Match
+// matches. Pages are only served to API key holders, so shared caches must
+// not keep them. Reactions, annotations, their reviews and participant tags
+// still change old messages, so clients must revalidate every time; the ETag hashes the
+// body, so any such change gives the page a new one.
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not encode response")
+		return
+	}
+	body = transcodeResponse(body, requestedCase(r))
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Add("Vary", "Accept")        // The Accept profile can select snake_case
+	w.Header().Add("Vary", "Authorization") // For caches that ignore private
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		recordWriteError(w, err)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
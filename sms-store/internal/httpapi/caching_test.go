@@ -0,0 +1,190 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestIsCacheablePage(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	anchored := store.PageQuery{Limit: 2, Before: now.Add(-72 * time.Hour)}
+	aged := func(age time.Duration, statuses ...string) []models.Message {
+		var messages []models.Message
+		for i, status := range statuses {
+			messages = append(messages, models.Message{ID: string(rune('a' + i)), Status: status, CreatedAt: now.Add(-age - time.Duration(i)*time.Minute)})
+		}
+		return messages
+	}
+
+	for _, tc := range []struct {
+		name      string
+		page      store.PageQuery
+		messages  []models.Message
+		threshold time.Duration
+		want      bool
+	}{
+		{"OldTerminal", anchored, aged(48*time.Hour, "SUCCESS", "DELIVERED"), 24 * time.Hour, true},
+		{"EveryTerminalStatus", anchored, aged(48*time.Hour, "SUCCESS", "FAIL", "FAILED", "DELIVERED", "RECEIVED"), 24 * time.Hour, true},
+		{"ExactlyAtThreshold", anchored, aged(24*time.Hour, "SUCCESS"), 24 * time.Hour, true},
+		{"FirstPage", store.PageQuery{Limit: 2}, aged(48*time.Hour, "SUCCESS"), 24 * time.Hour, false},
+		{"Empty", anchored, nil, 24 * time.Hour, false},
+		{"NewerThanThreshold", anchored, aged(23*time.Hour, "SUCCESS", "SUCCESS"), 24 * time.Hour, false},
+		{"PendingStatus", anchored, aged(48*time.Hour, "SUCCESS", "PENDING"), 24 * time.Hour, false},
+		{"NoStatus", anchored, aged(48*time.Hour, ""), 24 * time.Hour, false},
+		{"AnnotationFilter", store.PageQuery{Limit: 2, Before: anchored.Before, Annotation: "complaint"}, aged(48*time.Hour, "SUCCESS"), 24 * time.Hour, false},
+		{"CachingDisabled", anchored, aged(48*time.Hour, "SUCCESS"), 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultHandlerConfig()
+			config.MessageCacheThreshold = tc.threshold
+			h := NewHandlerWithConfig(store.NewMemoryStore(), store.NewMemoryProfileStore(), config)
+			h.SetClock(clocktest.NewFake(now))
+			if got := h.isCacheablePage(tc.page, tc.messages); got != tc.want {
+				t.Fatalf("isCacheablePage = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{"*", true},
+		{`"ab"`, false},
+		{`W/"abc"`, false},
+		{"abc", false},
+	} {
+		if got := etagMatches(tc.header, `"abc"`); got != tc.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
+
+// getWithETag serves GET path with If-None-Match set to etag, if any.
+func getWithETag(h *Handler, path, etag string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, r)
+	return w
+}
+
+func TestCacheablePageAnswersNotModified(t *testing.T) {
+	h, _, _ := newTotalsTestHandler(t)
+	path := "/v1/user/9876543210/messages?limit=2&cursor=" + encodeCursor(totalsStart.Add(-24*time.Hour), "")
+
+	w := getWithETag(h, path, "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET = %d with ETag %q, want 200 with one", w.Code, etag)
+	}
+	if again := getWithETag(h, path, "").Header().Get("ETag"); again != etag {
+		t.Fatalf("ETag changed from %s to %s for the same page", etag, again)
+	}
+
+	for _, header := range []string{etag, `"stale", ` + etag, "*"} {
+		w := getWithETag(h, path, header)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("If-None-Match %s = %d with %d bytes, want an empty 304", header, w.Code, w.Body.Len())
+		}
+		if w.Header().Get("ETag") != etag || w.Header().Get("Cache-Control") != "private, no-cache" {
+			t.Fatalf("304 headers = %v, want the ETag and Cache-Control", w.Header())
+		}
+	}
+	if w := getWithETag(h, path, `"stale"`); w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("If-None-Match of another page = %d, want 200 with the page", w.Code)
+	}
+
+	// The first page is never cached, so it has no ETag to match
+	w = getWithETag(h, "/v1/user/9876543210/messages?limit=2", "*")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("first page with If-None-Match = %d, ETag %q, Cache-Control %q; want 200 no-store", w.Code, w.Header().Get("ETag"), w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestAuthenticatedCacheablePageIsPrivate(t *testing.T) {
+	h, _, _ := newTotalsTestHandler(t)
+	h.config.APIKeys = map[string]Scope{"read-key": ScopeRead}
+	r := httptest.NewRequest(http.MethodGet, "/v1/user/9876543210/messages?limit=2&cursor="+encodeCursor(totalsStart.Add(-24*time.Hour), ""), nil)
+	r.Header.Set("Authorization", "Bearer read-key")
+	w := httptest.NewRecorder()
+	h.Authorize(h.Routes()).ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == "" {
+		t.Fatalf("GET = %d with ETag %q, want a cacheable 200", w.Code, w.Header().Get("ETag"))
+	}
+	// A shared cache must not hand one key holder's page to another client
+	if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "private,") || strings.Contains(cc, "public") {
+		t.Fatalf("Cache-Control = %q, want private", cc)
+	}
+	if vary := w.Header().Values("Vary"); !slices.Contains(vary, "Authorization") || !slices.Contains(vary, "Accept") {
+		t.Fatalf("Vary = %q, want Accept and Authorization", vary)
+	}
+}
+
+// cacheChange is a request changing a message of a cacheable page.
+type cacheChange struct {
+	method, path, body string
+}
+
+func (c cacheChange) serve(t *testing.T, h *Handler) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+	if w.Code >= 300 {
+		t.Fatalf("%s %s = %d %s", c.method, c.path, w.Code, w.Body.String())
+	}
+}
+
+// TestCachedPageRevalidatesChanges changes a message of a cacheable page
+// in each way that leaves its status terminal, and checks that a client
+// holding the page's ETag, which must revalidate, is sent the change.
+func TestCachedPageRevalidatesChanges(t *testing.T) {
+	path := "/v1/user/9876543210/messages?limit=2&cursor=" + encodeCursor(totalsStart.Add(-24*time.Hour), "")
+	annotate := cacheChange{http.MethodPost, "/messages/m4/annotations", `{"source": "intent-model", "label": "complaint", "confidence": 0.9}`}
+	for _, tc := range []struct {
+		name   string
+		setup  []cacheChange // Before the page is first fetched
+		change cacheChange
+		want   string // In the page after the change
+	}{
+		{"Reaction", nil, cacheChange{http.MethodPost, "/messages/m4/reactions", `{"emoji": "👍", "actor": "agent-1"}`}, `"reactions":{"👍":1}`},
+		{"Annotation", nil, annotate, `"label":"complaint"`},
+		{"Review", []cacheChange{annotate}, cacheChange{http.MethodPost, "/messages/m4/annotations/intent-model/review", `{"reviewer": "priya", "decision": "rejected"}`}, `"decision":"rejected"`},
+		{"Participant", nil, cacheChange{http.MethodPatch, "/messages/m4", `{"senderName": "Priya S."}`}, `"participant":{"id":"priya-s"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, _, _ := newTotalsTestHandler(t)
+			for _, c := range tc.setup {
+				c.serve(t, h)
+			}
+			before := getWithETag(h, path, "")
+			etag := before.Header().Get("ETag")
+			if before.Code != http.StatusOK || etag == "" || before.Header().Get("Cache-Control") != "private, no-cache" {
+				t.Fatalf("GET = %d, ETag %q, Cache-Control %q; want 200 to revalidate", before.Code, etag, before.Header().Get("Cache-Control"))
+			}
+
+			tc.change.serve(t, h)
+
+			after := getWithETag(h, path, etag)
+			if after.Code != http.StatusOK || after.Header().Get("ETag") == etag || !strings.Contains(after.Body.String(), tc.want) {
+				t.Fatalf("revalidating = %d with ETag %q and %s, want 200 with a new ETag and %s", after.Code, after.Header().Get("ETag"), after.Body.String(), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/kafka"
+	"sms-store/internal/models"
+	"sms-store/internal/scheduler"
+	"sms-store/internal/snapshot"
+	"sms-store/internal/store"
+	"sms-store/internal/watchdog"
+)
+
+// fieldCase is the naming of JSON field names in request and response
+// bodies. Handlers work in camelCase; snake case is translated at the edges.
+type fieldCase int
+
+const (
+	camelCase fieldCase = iota
+	snakeCase
+)
+
+// requestedCase returns the field naming a request asks for, with ?case=snake
+// or an Accept profile parameter such as application/json; profile=snake_case.
+func requestedCase(r *http.Request) fieldCase {
+	if r == nil {
+		return camelCase
+	}
+	if strings.EqualFold(r.URL.Query().Get("case"), "snake") {
+		return snakeCase
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil {
+			if profile := strings.ToLower(params["profile"]); profile == "snake" || profile == "snake_case" {
+				return snakeCase
+			}
+		}
+	}
+	return camelCase
+}
+
+// caseTypes are the request and response types whose JSON field names, and
+// those of every struct they contain, seed snakeNames.
+var caseTypes = []any{
+	models.Message{}, models.Profile{}, models.ConversationPreferences{}, models.Conversation{},
+	store.ConversationSummary{}, store.OperationLatency{}, store.DailyBucket{}, store.CostBucket{},
+	store.Tombstone{}, store.ConversationCount{}, store.StoreUsage{}, jobs.Job{},
+	errorResponse{}, unknownFieldDetails{}, createMessageRequest{}, updateProfileRequest{}, preferencesRequest{},
+	messagePage{}, conversationWithPreferences{}, searchResponse{}, threadResponse{},
+	dailyDigestResponse{}, costSummaryResponse{}, exportStartedResponse{}, exportLinkResponse{}, transcriptStartedResponse{},
+	healthResponse{}, readyResponse{}, summaryMismatch{}, enrichedConversations{}, userMessagesWithProfile{},
+	createConversationRequest{}, accountQuotaResponse{}, setQuotaRequest{}, store.QuotaError{},
+	models.ReadCursor{}, markReadRequest{}, readCursorResponse{},
+	models.AuditEntry{}, conversationStateResponse{}, store.TransitionError{},
+	kafka.ConsumerOffsets{}, kafka.SeekResult{}, seekConsumerRequest{}, validateEventResponse{},
+	models.Reaction{}, reactionRequest{}, reactionsResponse{},
+	messageResponse{}, profileResponse{}, openedConversation{}, scheduler.Status{},
+	forwardRequest{}, indexBuildProgress{},
+	models.AttributeSchema{}, attributeSchemaRequest{}, conversationAttributesRequest{}, conversationAttributesResponse{},
+	models.ProfileChange{}, profileHistoryPage{}, profileRollbackResponse{},
+	conversationChangesPage{}, seedRequest{}, exportQueryRequest{},
+	watchdog.SourceStatus{}, patchMessageRequest{}, store.ParticipantCount{}, store.ReadLimitError{},
+	mergeProfilesRequest{}, mergeProfilesResponse{},
+	shareResponse{}, createShareResponse{},
+	models.Annotation{}, annotationRequest{}, annotationReviewRequest{}, annotationsResponse{}, store.AnnotationCount{},
+	models.Translation{}, translationRequest{}, translationsResponse{},
+	growthResponse{}, models.AutoAckConfig{}, autoAckRequest{}, autoAckResponse{},
+	models.DeletionReceipt{}, snapshotResponse{}, snapshot.Diff{}, timelineRow{},
+}
+
+// snakeNames maps camelCase field names to snake_case, built once from the
+// struct tags of caseTypes. Keys of map-literal responses aren't declared on
+// any struct; they're converted by the same rule on first sight and cached.
+var (
+	snakeNames     = buildSnakeNames()
+	snakeFallbacks sync.Map // camelCase key -> snake_case key
+)
+
+func buildSnakeNames() map[string]string {
+	names := make(map[string]string)
+	seen := make(map[reflect.Type]bool)
+	for _, v := range caseTypes {
+		collectFieldNames(reflect.TypeOf(v), seen, func(name string) {
+			names[name] = toSnake(name)
+		})
+	}
+	return names
+}
+
+// collectFieldNames calls add with the JSON name of every field of t and of
+// the structs it contains.
+func collectFieldNames(t reflect.Type, seen map[reflect.Type]bool, add func(string)) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	for name, ft := range jsonFields(t) {
+		add(name)
+		collectFieldNames(ft, seen, add)
+	}
+}
+
+// snakeKey returns the snake_case form of a response key. Keys that aren't
+// lowerCamelCase identifiers, such as phone numbers or status values used
+// as map keys, are left alone.
+func snakeKey(key string) string {
+	if snake, ok := snakeNames[key]; ok {
+		return snake
+	}
+	if !isLowerCamel(key) {
+		return key
+	}
+	if snake, ok := snakeFallbacks.Load(key); ok {
+		return snake.(string)
+	}
+	snake := toSnake(key)
+	snakeFallbacks.Store(key, snake)
+	return snake
+}
+
+func isLowerCamel(s string) bool {
+	if s == "" || !unicode.IsLower(rune(s[0])) {
+		return false
+	}
+	upper := false
+	for _, c := range s {
+		if c > unicode.MaxASCII || !(unicode.IsLetter(c) || unicode.IsDigit(c)) {
+			return false
+		}
+		upper = upper || unicode.IsUpper(c)
+	}
+	return upper
+}
+
+// toSnake converts a camelCase name: createdAt becomes created_at and
+// senderID sender_id.
+func toSnake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, c := range runes {
+		if unicode.IsUpper(c) {
+			prevLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// camelNamesByType caches, per request body type, the snake_case form of
+// each JSON field name of the type and the structs it contains.
+var camelNamesByType sync.Map // reflect.Type -> map[string]string
+
+func camelNames(t reflect.Type) map[string]string {
+	if names, ok := camelNamesByType.Load(t); ok {
+		return names.(map[string]string)
+	}
+	names := make(map[string]string)
+	collectFieldNames(t, make(map[reflect.Type]bool), func(name string) {
+		names[toSnake(name)] = name
+	})
+	camelNamesByType.Store(t, names)
+	return names
+}
+
+// renameKeys rewrites the object keys of a JSON document with rename,
+// keeping everything else, including key order, as it is.
+func renameKeys(data []byte, rename func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	type container struct {
+		object bool
+		tokens int // Keys and values so far
+	}
+	var stack []container
+	var out bytes.Buffer
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			out.WriteRune(rune(delim))
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		isKey := false
+		if n := len(stack); n > 0 {
+			top := &stack[n-1]
+			switch {
+			case top.object && top.tokens%2 == 1:
+				out.WriteByte(':')
+			case top.object:
+				isKey = true
+				fallthrough
+			default:
+				if top.tokens > 0 {
+					out.WriteByte(',')
+				}
+			}
+			top.tokens++
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			out.WriteRune(rune(v))
+			stack = append(stack, container{object: v == '{'})
+		case string:
+			if isKey {
+				v = rename(v)
+			}
+			encoded, _ := json.Marshal(v)
+			out.Write(encoded)
+		case json.Number:
+			out.WriteString(v.String())
+		case bool:
+			out.WriteString(strconv.FormatBool(v))
+		case nil:
+			out.WriteString("null")
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// transcodeResponse returns body, a JSON response, in the field naming fc.
+// A body that can't be rewritten is returned unchanged.
+func transcodeResponse(body []byte, fc fieldCase) []byte {
+	if fc != snakeCase {
+		return body
+	}
+	renamed, err := renameKeys(body, snakeKey)
+	if err != nil {
+		return body
+	}
+	return renamed
+}
+
+// transcodeRequest returns body, a JSON request for dst, with snake_case
+// field names turned back into dst's camelCase ones. Unknown keys are kept
+// as sent, so strict decoding reports them by the name the client used.
+func transcodeRequest(body []byte, fc fieldCase, dst any) []byte {
+	if fc != snakeCase {
+		return body
+	}
+	names := camelNames(reflect.TypeOf(dst))
+	renamed, err := renameKeys(body, func(key string) string {
+		if camel, ok := names[key]; ok {
+			return camel
+		}
+		return key
+	})
+	if err != nil {
+		return body // Decoding reports the syntax error
+	}
+	return renamed
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/store"
+)
+
+func TestSnakeCaseMessageRoundTrip(t *testing.T) {
+	config := DefaultHandlerConfig()
+	config.StrictJSON = StrictJSONAll // snake_case keys must not count as unknown
+	mem := store.NewMemoryStore()
+	h := NewHandlerWithConfig(mem, store.NewMemoryProfileStore(), config)
+
+	created := time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)
+	r := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(
+		`{"phone_number": "9876543210", "text": "hello", "created_at": "2026-10-14T09:30:00Z", "provider": {"name": "acme", "sender_id": "VM-ACME"}, "participant_id": "priya"}`))
+	r.Header.Set("Accept", "application/json; profile=snake_case")
+	w := httptest.NewRecorder()
+	// As main.go serves it; responses are transcoded through its writer
+	RequestContext(h.Routes()).ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /messages = %d %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body.String(), err)
+	}
+	provider, _ := resp["provider"].(map[string]any)
+	if resp["phone_number"] != "9876543210" || resp["created_at"] != "2026-10-14T09:30:00Z" || provider["sender_id"] != "VM-ACME" {
+		t.Fatalf("response = %s, want the message in snake_case", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "phoneNumber") || strings.Contains(w.Body.String(), "senderId") {
+		t.Fatalf("response = %s, want no camelCase fields", w.Body.String())
+	}
+
+	id, _ := resp["id"].(string)
+	msg, err := mem.FindByID(id)
+	if err != nil {
+		t.Fatalf("FindByID(%q): %v", id, err)
+	}
+	if msg.PhoneNumber != "9876543210" || !msg.CreatedAt.Equal(created) || msg.Provider == nil || msg.Provider.SenderID != "VM-ACME" ||
+		msg.Participant == nil || msg.Participant.ID != "priya" {
+		t.Fatalf("stored %+v, want the snake_case fields filled in", msg)
+	}
+}
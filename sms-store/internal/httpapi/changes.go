@@ -0,0 +1,220 @@
+package httpapi
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// changeFeedSettle is how far behind the present GET
+// /v1/conversations/changes reads. A write is stamped before it commits, so
+// one stamped just before a read could otherwise commit after it, behind
+// the cursor the read handed out.
+const changeFeedSettle = 2 * time.Second
+
+// conversationChange is one conversation in GET /v1/conversations/changes,
+// as it is now, or marked deleted.
+type conversationChange struct {
+	PhoneNumber string    `json:"phoneNumber"`
+	ChangedAt   time.Time `json:"changedAt"`
+	Deleted     bool      `json:"deleted,omitempty"`
+
+	// As GET /v1/conversations?includeSummary=true gives them; absent once
+	// deleted
+	Summary           *store.ConversationSummary `json:"summary,omitempty"`
+	LastReadMessageAt *time.Time                 `json:"lastReadMessageAt,omitempty"`
+	UnreadCount       *int64                     `json:"unreadCount,omitempty"`
+}
+
+// conversationChangesPage is the body of GET /v1/conversations/changes.
+// Unlike other pages its meta always has a nextCursor: the one to ask with
+// next, whether or not there are more changes now.
+type conversationChangesPage struct {
+	Data []conversationChange `json:"data"`
+	Meta pageMeta             `json:"meta"`
+}
+
+// changeFeedEntry is one change the feed merges, of a summary, a read
+// cursor or a tombstone.
+type changeFeedEntry struct {
+	at          time.Time
+	phoneNumber string
+	deleted     bool
+}
+
+// GetConversationChanges lists the conversations whose summary, state or
+// unread count changed since the cursor, and those deleted, oldest change
+// first.
+// GET /v1/conversations/changes?since=&limit=
+//
+// Without since it lists nothing and answers the cursor of the present, to
+// take before loading GET /v1/conversations in full. Unread counts are the
+// X-Account-ID account's. A cursor older than the tombstone window answers
+// 410: deletions before it may be forgotten, so the list must be loaded
+// again.
+func (h *Handler) GetConversationChanges(w http.ResponseWriter, r *http.Request) {
+	if h.summaries == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation summaries are not configured")
+		return
+	}
+	if h.tombstoneStore == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "tombstones are not configured")
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultPageLimit
+	if raw := strings.TrimSpace(q.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+
+	now := h.Clock().Now()
+	until := now.Add(-changeFeedSettle)
+	page := conversationChangesPage{Data: []conversationChange{}, Meta: pageMeta{Limit: limit}}
+	raw := strings.TrimSpace(q.Get("since"))
+	if raw == "" {
+		page.Meta.NextCursor = encodeCursor(until, "")
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+	after, afterPhoneNumber, err := decodeCursor(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid since")
+		return
+	}
+	if window := h.config.TombstoneWindow; window > 0 && after.Before(now.Add(-window)) {
+		writeError(w, http.StatusGone, "GONE", "cursor is older than the tombstone window; load the conversations again")
+		return
+	}
+
+	entries, hasMore, err := h.changeFeed(r, store.ChangeQuery{After: after, AfterPhoneNumber: afterPhoneNumber, Until: until, Limit: limit + 1}, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation changes")
+		return
+	}
+	// A complete page has seen every change before until
+	page.Meta.HasMore = hasMore
+	page.Meta.NextCursor = encodeCursor(until, "")
+	if hasMore {
+		last := entries[len(entries)-1]
+		page.Meta.NextCursor = encodeCursor(last.at, last.phoneNumber)
+	}
+
+	if page.Data, err = h.conversationChanges(r, entries); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation changes")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// changeFeed merges the summaries, read cursors and tombstones changed
+// within q into the first limit changes, and reports whether there are
+// more. Each source returns its first q.Limit, more than limit, so the
+// merge holds every change up to the page end.
+func (h *Handler) changeFeed(r *http.Request, q store.ChangeQuery, limit int) ([]changeFeedEntry, bool, error) {
+	summaries, err := h.summaries.ListChangedSummaries(q)
+	if err != nil {
+		return nil, false, err
+	}
+	entries := make([]changeFeedEntry, 0, len(summaries))
+	for _, s := range summaries {
+		entries = append(entries, changeFeedEntry{at: s.UpdatedAt, phoneNumber: s.PhoneNumber})
+	}
+
+	if h.readCursors != nil {
+		cursors, err := h.readCursors.ListChangedReadCursors(accountID(r), q)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, c := range cursors {
+			entries = append(entries, changeFeedEntry{at: c.UpdatedAt, phoneNumber: c.PhoneNumber})
+		}
+	}
+
+	// Tombstones last only the tombstone window, so there are few to scan
+	tombstones, err := h.tombstoneStore.ListTombstones()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, t := range tombstones {
+		if q.Includes(t.DeletedAt, t.PhoneNumber) {
+			entries = append(entries, changeFeedEntry{at: t.DeletedAt, phoneNumber: t.PhoneNumber, deleted: true})
+		}
+	}
+
+	slices.SortStableFunc(entries, func(a, b changeFeedEntry) int {
+		return cmp.Or(a.at.Compare(b.at), cmp.Compare(a.phoneNumber, b.phoneNumber))
+	})
+	if len(entries) > limit {
+		return entries[:limit], true, nil
+	}
+	return entries, false, nil
+}
+
+// conversationChanges describes each conversation among entries once, by
+// its latest change: deleted if that was its deletion and it has no
+// summary since, otherwise as it is now.
+func (h *Handler) conversationChanges(r *http.Request, entries []changeFeedEntry) ([]conversationChange, error) {
+	latest := make(map[string]changeFeedEntry, len(entries))
+	order := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if _, seen := latest[e.phoneNumber]; !seen {
+			order = append(order, e.phoneNumber)
+		}
+		latest[e.phoneNumber] = e
+	}
+	slices.SortStableFunc(order, func(a, b string) int {
+		return latest[a].at.Compare(latest[b].at)
+	})
+
+	summaries, err := h.summaries.GetSummaries(order)
+	if err != nil {
+		return nil, err
+	}
+	now := h.Clock().Now()
+	changes := make([]conversationChange, 0, len(order))
+	convs := make([]conversationWithPreferences, 0, len(order))
+	for _, pn := range order {
+		e := latest[pn]
+		summary, ok := summaries[pn]
+		if e.deleted && !ok {
+			changes = append(changes, conversationChange{PhoneNumber: pn, ChangedAt: e.at, Deleted: true})
+			continue
+		}
+		conv := conversationWithPreferences{Type: models.ConversationDirect, ConversationID: pn, PhoneNumber: pn}
+		if ok {
+			summary = summary.Current(now)
+			conv.Summary = &summary
+		}
+		changes = append(changes, conversationChange{PhoneNumber: pn, ChangedAt: e.at})
+		convs = append(convs, conv)
+	}
+
+	if h.readCursors != nil {
+		if err := h.withUnreadCounts(r, convs); err != nil {
+			return nil, err
+		}
+	}
+	i := 0
+	for j := range changes {
+		if changes[j].Deleted {
+			continue
+		}
+		changes[j].Summary = convs[i].Summary
+		changes[j].LastReadMessageAt = convs[i].LastReadMessageAt
+		changes[j].UnreadCount = convs[i].UnreadCount
+		i++
+	}
+	return changes, nil
+}
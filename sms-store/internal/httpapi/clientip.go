@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ParseTrustedProxies parses a TRUSTED_PROXIES setting: comma-separated
+// CIDRs or single addresses, e.g. "10.0.0.0/8,192.168.1.7".
+func ParseTrustedProxies(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ResolveClientIP wraps the server so ClientIP reports the address of the
+// client rather than of the load balancer in front of it. X-Forwarded-For
+// and X-Real-IP are honored only when the direct peer is in trusted;
+// anyone else could set them to any address, so for other peers they are
+// ignored and the peer address is the client.
+//
+// X-Forwarded-For is read from the right, skipping trusted proxies: the
+// first untrusted hop is the client, since everything to its left was
+// written by the client itself.
+func ResolveClientIP(trusted []netip.Prefix, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := resolveClientIP(r, trusted)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+	})
+}
+
+// ClientIP returns the client address of r as resolved by ResolveClientIP,
+// or the peer address for requests it didn't see.
+func ClientIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	if peer, ok := peerAddr(r); ok {
+		return peer.String()
+	}
+	return r.RemoteAddr
+}
+
+func resolveClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer, ok := peerAddr(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !isTrusted(peer, trusted) {
+		return peer.String()
+	}
+
+	if hops := r.Header.Values("X-Forwarded-For"); len(hops) > 0 {
+		// Proxies may append to one header or add their own
+		var list []string
+		for _, h := range hops {
+			list = append(list, strings.Split(h, ",")...)
+		}
+		client := peer
+		for i := len(list) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(list[i]))
+			if err != nil {
+				break // A malformed hop ends the chain we can vouch for
+			}
+			client = addr.Unmap()
+			if !isTrusted(client, trusted) {
+				break
+			}
+		}
+		return client.String()
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return peer.String()
+}
+
+// peerAddr returns the address of the direct peer of r.
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.7")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		peer      string
+		forwarded []string // X-Forwarded-For headers, one per proxy that added its own
+		realIP    string
+		want      string
+	}{
+		{"NoHeaders", "203.0.113.9:4000", nil, "", "203.0.113.9"},
+		{"SpoofedForwardedForFromUntrustedPeer", "203.0.113.9:4000", []string{"198.51.100.1"}, "", "203.0.113.9"},
+		{"SpoofedRealIPFromUntrustedPeer", "203.0.113.9:4000", nil, "198.51.100.1", "203.0.113.9"},
+		{"OneTrustedProxy", "10.0.0.1:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"MultiHopChain", "10.0.0.1:4000", []string{"198.51.100.1, 192.168.1.7, 10.2.3.4"}, "", "198.51.100.1"},
+		{"MultiHopHeaders", "10.0.0.1:4000", []string{"198.51.100.1", "192.168.1.7"}, "", "198.51.100.1"},
+		// Everything left of the first untrusted hop was written by the client
+		{"SpoofedHopLeftOfClient", "10.0.0.1:4000", []string{"1.1.1.1, 198.51.100.1, 10.2.3.4"}, "", "198.51.100.1"},
+		{"MalformedHop", "10.0.0.1:4000", []string{"198.51.100.1, not-an-ip, 10.2.3.4"}, "", "10.2.3.4"},
+		{"MalformedLastHop", "10.0.0.1:4000", []string{"198.51.100.1, not-an-ip"}, "", "10.0.0.1"},
+		{"EveryHopTrusted", "10.0.0.1:4000", []string{"10.9.9.9, 10.2.3.4"}, "", "10.9.9.9"},
+		{"MappedIPv4Hop", "10.0.0.1:4000", []string{"::ffff:198.51.100.1"}, "", "198.51.100.1"},
+		{"RealIPFallback", "10.0.0.1:4000", nil, "198.51.100.1", "198.51.100.1"},
+		{"ForwardedForOverRealIP", "10.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.2", "198.51.100.1"},
+		{"MalformedRealIP", "10.0.0.1:4000", nil, "not-an-ip", "10.0.0.1"},
+		{"TrustedSingleAddress", "192.168.1.7:4000", nil, "198.51.100.1", "198.51.100.1"},
+		{"UntrustedNeighbourOfSingleAddress", "192.168.1.8:4000", nil, "198.51.100.1", "192.168.1.8"},
+		{"PeerWithoutPort", "10.0.0.1", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"UnparsablePeer", "pipe", []string{"198.51.100.1"}, "", "pipe"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			r.RemoteAddr = tc.peer
+			for _, hop := range tc.forwarded {
+				r.Header.Add("X-Forwarded-For", hop)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := resolveClientIP(r, trusted); got != tc.want {
+				t.Fatalf("resolveClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsMalformedEntries(t *testing.T) {
+	for _, raw := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.0/8, 300.1.1.1"} {
+		if _, err := ParseTrustedProxies(raw); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want an error", raw)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"sms-store/internal/kafka"
+	"sms-store/internal/models"
+)
+
+// SetKafkaSupervisor attaches the supervisor of the Kafka consumer whose
+// offsets the consumer admin routes read and move. They answer 501 until
+// one is set, and 503 while the consumer isn't running.
+func (h *Handler) SetKafkaSupervisor(s *kafka.Supervisor) {
+	h.kafka = s
+}
+
+type seekConsumerRequest struct {
+	Confirm   bool            `json:"confirm"`             // Must be true; a seek replays or skips events
+	Offsets   map[int32]int64 `json:"offsets,omitempty"`   // Offset of the next event to consume, by partition
+	Timestamp *time.Time      `json:"timestamp,omitempty"` // Or every partition to its first event at or after this time
+}
+
+// GetConsumerOffsets reports the consumer group's committed offset, the
+// offsets the broker holds and the lag of every partition. Requires the
+// admin scope.
+// GET /v1/admin/consumer/offsets
+func (h *Handler) GetConsumerOffsets(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	consumer, ok := h.kafkaConsumer(w)
+	if !ok {
+		return
+	}
+
+	offsets, err := consumer.Offsets()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "KAFKA_UNAVAILABLE", "could not read consumer offsets")
+		return
+	}
+	writeJSON(w, http.StatusOK, offsets)
+}
+
+// SeekConsumer moves the consumer group to explicit offsets or to a point
+// in time and replays from there. Consumption pauses until the new offsets
+// are committed. Replayed events that were stored already are skipped.
+// The body must set "confirm": true. Requires the admin scope.
+// POST /v1/admin/consumer/seek
+func (h *Handler) SeekConsumer(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req seekConsumerRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if !req.Confirm {
+		writeError(w, http.StatusBadRequest, "CONFIRMATION_REQUIRED", "a seek replays or skips events; set confirm to true")
+		return
+	}
+
+	consumer, ok := h.kafkaConsumer(w)
+	if !ok {
+		return
+	}
+	result, err := consumer.Seek(kafka.SeekRequest{Offsets: req.Offsets, Timestamp: req.Timestamp})
+	switch {
+	case errors.Is(err, kafka.ErrInvalidSeek):
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, "SEEK_FAILED", err.Error())
+		return
+	}
+
+	if h.audit != nil {
+		details := map[string]any{"partitions": result.Partitions}
+		if req.Timestamp != nil {
+			details["timestamp"] = *req.Timestamp
+		}
+		if _, err := h.audit.RecordAudit(models.AuditEntry{
+			At:        h.Clock().Now(),
+			AccountID: accountID(r),
+			Actor:     ClientIP(r),
+			Action:    models.AuditConsumerSeek,
+			Details:   details,
+		}); err != nil {
+			log.Printf("Failed to audit consumer seek: %v", err)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// kafkaConsumer returns the running consumer, answering 501 or 503 when
+// there is none.
+func (h *Handler) kafkaConsumer(w http.ResponseWriter) (*kafka.Consumer, bool) {
+	if h.kafka == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "the Kafka consumer is not configured")
+		return nil, false
+	}
+	consumer := h.kafka.Consumer()
+	if consumer == nil {
+		writeError(w, http.StatusServiceUnavailable, "KAFKA_UNAVAILABLE", "the Kafka consumer is not running")
+		return nil, false
+	}
+	return consumer, true
+}
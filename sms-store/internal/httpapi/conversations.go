@@ -0,0 +1,405 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// createConversationRequest is the body of POST /v1/conversations.
+type createConversationRequest struct {
+	PhoneNumber string `json:"phoneNumber"`
+	Name        string `json:"name,omitempty"`   // Creates the profile when the number has none
+	Avatar      string `json:"avatar,omitempty"` // Creates the profile when the number has none
+}
+
+// openedConversation is the answer of POST /v1/conversations, with the URL
+// the conversation's messages are read at.
+type openedConversation struct {
+	conversationWithProfile
+	Self string `json:"self"`
+}
+
+// CreateConversation opens a direct conversation before its first message,
+// so a new chat survives a refresh.
+// POST /v1/conversations
+//
+// The conversation is kept as a summary without messages and listed with
+// empty:true until a message arrives; one still empty after
+// EmptyConversationTTL is removed. A number that already has a
+// conversation answers 200 with it, a new one 201. name and avatar create
+// the number's profile if it has none, or only an automatically created
+// one; any other profile is left alone. Both carry the conversation's
+// GET /v1/user/{phoneNumber}/messages URL as self, and a 201 as Location.
+func (h *Handler) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	if h.summaries == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation summaries are not configured")
+		return
+	}
+
+	var req createConversationRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	req.PhoneNumber = strings.TrimSpace(req.PhoneNumber)
+	req.Name = strings.TrimSpace(req.Name)
+	req.Avatar = strings.TrimSpace(req.Avatar)
+
+	if req.PhoneNumber == "" {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "phoneNumber is required")
+		return
+	}
+	if strings.Contains(req.PhoneNumber, "/") {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	summary, created, err := h.openConversation(req.PhoneNumber)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not create conversation")
+		return
+	}
+	summary = summary.Current(h.Clock().Now())
+
+	conv := conversationWithProfile{conversationWithPreferences: conversationWithPreferences{
+		Type:           models.ConversationDirect,
+		ConversationID: req.PhoneNumber,
+		PhoneNumber:    req.PhoneNumber,
+		Summary:        &summary,
+		Empty:          summary.MessageCount == 0,
+	}}
+	if req.Name != "" || req.Avatar != "" {
+		profile, err := h.ensureProfile(r, models.Profile{PhoneNumber: req.PhoneNumber, Name: req.Name, Avatar: req.Avatar})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not create profile")
+			return
+		}
+		conv.Profile = profile
+	} else if profiles, _ := h.lookupProfiles(w, []string{req.PhoneNumber}); len(profiles) > 0 {
+		p := profiles[req.PhoneNumber]
+		conv.Profile = &p
+	}
+
+	resp := openedConversation{conversationWithProfile: conv, Self: conversationURL(req.PhoneNumber)}
+	if created {
+		writeCreated(w, resp.Self, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// openConversation returns phoneNumber's summary, creating an empty one
+// when the number has no messages. Messages stored before summaries were
+// built have none yet, so theirs is rebuilt instead.
+func (h *Handler) openConversation(phoneNumber string) (store.ConversationSummary, bool, error) {
+	msgs, err := h.store.FindByPhoneNumberPage(phoneNumber, store.PageQuery{Limit: 1})
+	if err != nil {
+		return store.ConversationSummary{}, false, err
+	}
+	if len(msgs) == 0 {
+		// A message arriving meanwhile upserts the summary first, and is kept
+		return h.summaries.CreateEmptySummary(phoneNumber, h.Clock().Now())
+	}
+
+	summaries, err := h.summaries.GetSummaries([]string{phoneNumber})
+	if err != nil {
+		return store.ConversationSummary{}, false, err
+	}
+	if summary, ok := summaries[phoneNumber]; ok {
+		return summary, false, nil
+	}
+	if _, err := h.summaries.RebuildSummaries([]string{phoneNumber}); err != nil {
+		return store.ConversationSummary{}, false, err
+	}
+	if summaries, err = h.summaries.GetSummaries([]string{phoneNumber}); err != nil {
+		return store.ConversationSummary{}, false, err
+	}
+	return summaries[phoneNumber], false, nil
+}
+
+// ensureProfile creates profile for r unless its number already has one
+// other than an automatically created one, and returns the number's
+// profile. Without a profile store it returns nil.
+func (h *Handler) ensureProfile(r *http.Request, profile models.Profile) (*models.Profile, error) {
+	if h.profileStore == nil {
+		return nil, nil
+	}
+	created, err := h.createProfile(h.profileWriter(r), profile)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		created, err = h.profileStore.GetProfile(profile.PhoneNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// conversationPageSize is how many summaries conversationPhoneNumbers
+// reads at a time.
+const conversationPageSize = 1000
+
+// conversationPhoneNumbers returns the phone numbers of the direct
+// conversations with messages. It pages over the summaries when they are
+// configured, and only falls back to a distinct over every message
+// without them.
+func (h *Handler) conversationPhoneNumbers() ([]string, error) {
+	if h.summaries == nil {
+		return h.store.GetDistinctPhoneNumbers()
+	}
+	phoneNumbers := []string{}
+	after := ""
+	for {
+		page, err := h.summaries.ListSummaries(after, conversationPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range page {
+			phoneNumbers = append(phoneNumbers, s.PhoneNumber)
+		}
+		if len(page) < conversationPageSize {
+			return phoneNumbers, nil
+		}
+		after = page[len(page)-1].PhoneNumber
+	}
+}
+
+// withEmptyConversations adds the conversations opened without messages,
+// and not yet expired, to phoneNumbers. It returns the combined list and
+// the set of numbers it added.
+func (h *Handler) withEmptyConversations(phoneNumbers []string) ([]string, map[string]bool, error) {
+	summaries, err := h.summaries.ListEmptySummaries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listed := make(map[string]bool, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		listed[pn] = true
+	}
+	// Expired ones are hidden before the sweeper gets to them
+	var cutoff time.Time
+	if h.config.EmptyConversationTTL > 0 {
+		cutoff = h.Clock().Now().Add(-h.config.EmptyConversationTTL)
+	}
+	empty := make(map[string]bool)
+	for _, s := range summaries {
+		if listed[s.PhoneNumber] || (s.CreatedAt != nil && s.CreatedAt.Before(cutoff)) {
+			continue
+		}
+		empty[s.PhoneNumber] = true
+	}
+
+	added := make([]string, 0, len(empty))
+	for pn := range empty {
+		added = append(added, pn)
+	}
+	sort.Strings(added)
+	return append(phoneNumbers, added...), empty, nil
+}
+
+// SweepEmptyConversations removes conversations still empty after
+// EmptyConversationTTL. It is run as a scheduled task.
+func (h *Handler) SweepEmptyConversations(context.Context) error {
+	n, err := h.summaries.DeleteEmptySummaries(h.Clock().Now().Add(-h.config.EmptyConversationTTL))
+	if err != nil {
+		return fmt.Errorf("failed to sweep empty conversations: %w", err)
+	}
+	if n > 0 {
+		log.Printf("Removed %d expired empty conversation(s)", n)
+	}
+	return nil
+}
+
+// GetConversations retrieves all distinct phone numbers (conversations) from the store.
+// With ?includePreferences=true each entry becomes {phoneNumber, preferences};
+// ?includeCounts=true does the same and adds messageCount and archivedCount.
+// ?includeArchived=true also lists conversations that are entirely archived.
+// ?includeSummary=true adds the stored summary (last message, preview and
+// message count) and orders conversations by last message, newest first.
+// ?includeGroups=true appends group conversations. Each entry carries a type
+// (direct or group) and a conversationId, the phone number of a direct one.
+// Conversations opened without messages are listed too, flagged empty in
+// the object forms.
+// ?includeProfiles=true adds each profile, best-effort, and wraps the list
+// in {data, meta} so meta.partial can report profiles that were left out.
+// ?state=open, closed or snoozed lists only conversations in that state;
+// group conversations have no state and are always open.
+// ?senderType=phone_number, shortcode or alphanumeric lists only direct
+// conversations with that kind of sender.
+// ?attr.{name}={value} lists only conversations whose custom attribute name,
+// in the account's schema, holds value; several are all matched.
+// ?language={code} lists only direct conversations mostly in that language,
+// hi matching hi-Latn too.
+func (h *Handler) GetConversations(w http.ResponseWriter, r *http.Request) {
+	phoneNumbers, err := h.conversationPhoneNumbers()
+	if err != nil {
+		writeStoreError(w, err, "retrieve conversations")
+		return
+	}
+
+	if h.includeArchived(r) {
+		if phoneNumbers, err = h.withArchivedPhoneNumbers(phoneNumbers); err != nil {
+			writeStoreError(w, err, "retrieve archived conversations")
+			return
+		}
+	}
+
+	// Conversations opened with POST /v1/conversations are listed before
+	// their first message
+	var empty map[string]bool
+	if h.summaries != nil {
+		if phoneNumbers, empty, err = h.withEmptyConversations(phoneNumbers); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve empty conversations")
+			return
+		}
+	}
+
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state != "" {
+		if !validState(state) {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "state must be open, closed or snoozed")
+			return
+		}
+		if h.summaries == nil {
+			writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation summaries are not configured")
+			return
+		}
+		if phoneNumbers, err = h.filterByState(phoneNumbers, state); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation states")
+			return
+		}
+	}
+
+	senderType := q.Get("senderType")
+	if senderType != "" {
+		if !validSenderType(senderType) {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "senderType must be phone_number, shortcode or alphanumeric")
+			return
+		}
+		phoneNumbers = filterBySenderType(phoneNumbers, senderType)
+	}
+
+	language, err := parseLanguage(q.Get("language"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if language != "" {
+		if h.summaries == nil {
+			writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation summaries are not configured")
+			return
+		}
+		if phoneNumbers, err = h.filterByConversationLanguage(phoneNumbers, language); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation languages")
+			return
+		}
+	}
+
+	if hasAttributeFilter(q) {
+		if h.attributeSchemas == nil || h.summaries == nil {
+			writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "attribute schemas are not configured")
+			return
+		}
+		schema, err := h.attributeSchemas.GetAttributeSchema(accountID(r))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve attribute schema")
+			return
+		}
+		filter, err := attributeFilter(q, schema)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if phoneNumbers, err = h.filterByAttributes(phoneNumbers, filter); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not filter conversations by attributes")
+			return
+		}
+	}
+
+	if q.Get("includePreferences") == "true" || q.Get("includeCounts") == "true" || q.Get("includeSummary") == "true" || q.Get("includeGroups") == "true" || q.Get("includeProfiles") == "true" {
+		convs, err := h.withPreferences(r, phoneNumbers)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve preferences")
+			return
+		}
+		for i := range convs {
+			convs[i].Empty = empty[convs[i].PhoneNumber]
+		}
+		if q.Get("includeGroups") == "true" && (state == "" || state == models.ConversationOpen) && senderType == "" && language == "" {
+			if h.conversations == nil {
+				writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "group conversations are not configured")
+				return
+			}
+			if convs, err = h.withGroups(convs); err != nil {
+				writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve group conversations")
+				return
+			}
+		}
+		if q.Get("includeCounts") == "true" {
+			if h.archiver == nil {
+				writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation counts are not configured")
+				return
+			}
+			if err := h.withCounts(convs); err != nil {
+				writeStoreError(w, err, "count messages")
+				return
+			}
+		}
+		if q.Get("includeSummary") == "true" {
+			if h.summaries == nil {
+				writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation summaries are not configured")
+				return
+			}
+			if err := h.withSummaries(convs); err != nil {
+				writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation summaries")
+				return
+			}
+			if h.readCursors != nil {
+				if err := h.withUnreadCounts(r, convs); err != nil {
+					writeError(w, http.StatusInternalServerError, "INTERNAL", "could not count unread messages")
+					return
+				}
+			}
+		}
+		// Profiles are best-effort: a slow profile store gives profile:null
+		// and meta.partial=true rather than an error
+		if q.Get("includeProfiles") == "true" {
+			writeJSON(w, http.StatusOK, h.withProfiles(w, convs))
+			return
+		}
+		writeJSON(w, http.StatusOK, convs)
+		return
+	}
+
+	// Return empty array if no conversations found (not an error)
+	writeJSON(w, http.StatusOK, phoneNumbers)
+}
+
+// filterBySenderType keeps the phone numbers of senderType.
+func filterBySenderType(phoneNumbers []string, senderType string) []string {
+	kept := make([]string, 0, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		if models.ClassifySender(pn) == senderType {
+			kept = append(kept, pn)
+		}
+	}
+	return kept
+}
+
+// validSenderType reports whether senderType names a sender type.
+func validSenderType(senderType string) bool {
+	switch senderType {
+	case models.SenderPhoneNumber, models.SenderShortcode, models.SenderAlphanumeric:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// distinctCountingStore counts the distincts run over every message.
+type distinctCountingStore struct {
+	store.Store
+	distincts int
+}
+
+func (s *distinctCountingStore) GetDistinctPhoneNumbers() ([]string, error) {
+	s.distincts++
+	return s.Store.GetDistinctPhoneNumbers()
+}
+
+func TestConversationsAreListedFromSummaries(t *testing.T) {
+	mem := store.NewMemoryStore()
+	summaries := store.NewMemorySummaryStore(mem)
+	s := &distinctCountingStore{Store: store.NewSummarizingStore(mem, summaries)}
+	// More than a page of summaries
+	want := make([]string, 0, conversationPageSize+1)
+	for i := range conversationPageSize + 1 {
+		pn := fmt.Sprintf("9%09d", i)
+		if _, err := s.Save(models.Message{ID: "m" + pn, PhoneNumber: pn, Text: "hello", Status: "SUCCESS", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		want = append(want, pn)
+	}
+	h := NewHandler(s, store.NewMemoryProfileStore())
+
+	// Without summaries the listing falls back to the distinct
+	w := httptest.NewRecorder()
+	h.GetConversations(w, httptest.NewRequest(http.MethodGet, "/v1/conversations", nil))
+	if w.Code != http.StatusOK || s.distincts != 1 {
+		t.Fatalf("GET /v1/conversations without summaries = %d, %d distincts; want 200 and 1", w.Code, s.distincts)
+	}
+
+	h.SetSummaryStore(summaries)
+	if _, _, err := summaries.CreateEmptySummary("8000000000", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s.distincts = 0
+
+	w = httptest.NewRecorder()
+	h.GetConversations(w, httptest.NewRequest(http.MethodGet, "/v1/conversations", nil))
+	var listed []string
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET /v1/conversations = %d %s", w.Code, w.Body.String())
+	}
+	if len(listed) != len(want)+1 || listed[0] != want[0] || listed[len(want)-1] != want[len(want)-1] || listed[len(want)] != "8000000000" {
+		t.Fatalf("listed %d conversations, want the %d with messages and then the empty one", len(listed), len(want))
+	}
+
+	w = httptest.NewRecorder()
+	h.GraphQL(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ conversations { totalCount } }"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), fmt.Sprintf(`"totalCount":%d`, len(want)+1)) {
+		t.Fatalf("GraphQL conversations = %d %s, want %d", w.Code, w.Body.String(), len(want)+1)
+	}
+
+	if s.distincts != 0 {
+		t.Fatalf("%d distincts over the messages, want the summaries paged instead", s.distincts)
+	}
+}
@@ -0,0 +1,144 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"sms-store/internal/pricing"
+	"sms-store/internal/store"
+)
+
+// SetPricer attaches the pricing table used to estimate message costs.
+// Pricing admin endpoints answer 501 until one is set.
+func (h *Handler) SetPricer(p *pricing.Pricer) {
+	h.pricer = p
+}
+
+// costTotal sums every bucket of one currency.
+type costTotal struct {
+	Currency            string  `json:"currency"`
+	Messages            int     `json:"messages"`
+	Segments            int     `json:"segments"`
+	EstimatedCost       float64 `json:"estimatedCost"`
+	DefaultRateMessages int     `json:"defaultRateMessages"`
+}
+
+type costSummaryResponse struct {
+	GroupBy  store.CostGroupBy  `json:"groupBy"`
+	Timezone string             `json:"timezone"`
+	Buckets  []store.CostBucket `json:"buckets"`
+	Totals   []costTotal        `json:"totals"`
+}
+
+// GetCostSummary totals the estimated cost of stored messages.
+// GET /v1/analytics/cost?groupBy=day|account|language|annotation&from=2024-01-01&to=2024-01-31&tz=Asia/Kolkata
+//
+// groupBy defaults to day. language groups by detected language, und for
+// messages without one. annotation groups by the label of each message's
+// most confident unrejected annotation, none for messages without one. from, to and tz work as for the daily digest.
+// defaultRateMessages counts messages whose destination prefix is missing
+// from the pricing table.
+func (h *Handler) GetCostSummary(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	groupBy := store.CostGroupBy(strings.TrimSpace(q.Get("groupBy")))
+	switch groupBy {
+	case "":
+		groupBy = store.CostByDay
+	case store.CostByDay, store.CostByAccount, store.CostByLanguage, store.CostByAnnotation:
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "groupBy must be day, account, language or annotation")
+		return
+	}
+
+	loc, err := parseTimezone(q.Get("tz"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "tz must be a valid IANA time zone name")
+		return
+	}
+
+	from, err := parseDigestBound(q.Get("from"), loc, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	to, err := parseDigestBound(q.Get("to"), loc, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "to must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from must be before to")
+		return
+	}
+
+	buckets, err := h.analyticsStore().CostSummary(store.CostQuery{
+		GroupBy:  groupBy,
+		Location: loc,
+		From:     from,
+		To:       to,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not summarize costs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, costSummaryResponse{
+		GroupBy:  groupBy,
+		Timezone: loc.String(),
+		Buckets:  buckets,
+		Totals:   costTotals(buckets),
+	})
+}
+
+// costTotals sums buckets per currency, in order of first appearance.
+func costTotals(buckets []store.CostBucket) []costTotal {
+	totals := make([]costTotal, 0)
+	index := make(map[string]int)
+	for _, b := range buckets {
+		i, ok := index[b.Currency]
+		if !ok {
+			i = len(totals)
+			index[b.Currency] = i
+			totals = append(totals, costTotal{Currency: b.Currency})
+		}
+		totals[i].Messages += b.Messages
+		totals[i].Segments += b.Segments
+		totals[i].EstimatedCost += b.EstimatedCost
+		totals[i].DefaultRateMessages += b.DefaultRateMessages
+	}
+	return totals
+}
+
+// GetPricing returns the pricing table in use. Requires the admin scope.
+// GET /v1/admin/pricing
+func (h *Handler) GetPricing(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.pricer == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "pricing is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.pricer.Snapshot())
+}
+
+// ReloadPricing reloads the pricing table from its source. If the new table
+// can't be loaded the previous one stays in use. Requires the admin scope.
+// POST /v1/admin/pricing/reload
+func (h *Handler) ReloadPricing(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.pricer == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "pricing is not configured")
+		return
+	}
+
+	snap, err := h.pricer.Reload()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, snap)
+}
@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedTotals is the most totals a countCache holds. Past it, expired
+// ones are dropped, and nothing new is kept until some expire.
+const maxCachedTotals = 1000
+
+// countCache keeps the totals of ?includeTotal=true pages for a short
+// while, so a client paging through one filter counts it once rather than
+// once per page. A total can be up to the TTL behind the pages it comes
+// with.
+type countCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedTotal
+}
+
+type cachedTotal struct {
+	n       int64
+	expires time.Time
+}
+
+func newCountCache() *countCache {
+	return &countCache{entries: make(map[string]cachedTotal)}
+}
+
+// includesTotal reports whether the client asked for meta.totalCount with
+// ?includeTotal=true. Counting a filter is a query of its own, so pages
+// leave it out unless asked and tell whether more follow by fetching one
+// extra item instead.
+func includesTotal(r *http.Request) bool {
+	return r.URL.Query().Get("includeTotal") == "true"
+}
+
+// cachedTotal returns the total counted for the filter described by parts
+// within PageCountCacheTTL, or else calls count and keeps its result.
+func (h *Handler) cachedTotal(count func() (int64, error), parts ...string) (int64, error) {
+	ttl := h.config.PageCountCacheTTL
+	if ttl <= 0 {
+		return count()
+	}
+	key := strings.Join(parts, "\x00")
+	now := h.Clock().Now()
+
+	c := h.totals
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		pageTotalLookups.WithLabelValues("hit").Inc()
+		return cached.n, nil
+	}
+	pageTotalLookups.WithLabelValues("miss").Inc()
+
+	n, err := count()
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedTotals {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) < maxCachedTotals {
+		c.entries[key] = cachedTotal{n: n, expires: now.Add(ttl)}
+	}
+	return n, nil
+}
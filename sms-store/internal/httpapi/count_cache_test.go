@@ -0,0 +1,177 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// recordingStore records the page sizes fetched and the counts run.
+type recordingStore struct {
+	store.Store
+	fetched []int    // Limits of ListPage and FindByPhoneNumberPage
+	counted []string // "messages" or "participants", with the filter
+}
+
+func (s *recordingStore) ListPage(page store.PageQuery) ([]models.Message, error) {
+	s.fetched = append(s.fetched, page.Limit)
+	return s.Store.ListPage(page)
+}
+
+func (s *recordingStore) FindByPhoneNumberPage(phoneNumber string, page store.PageQuery) ([]models.Message, error) {
+	s.fetched = append(s.fetched, page.Limit)
+	return s.Store.FindByPhoneNumberPage(phoneNumber, page)
+}
+
+func (s *recordingStore) CountMessages(senderID string) (int64, error) {
+	s.counted = append(s.counted, "messages "+senderID)
+	return s.Store.CountMessages(senderID)
+}
+
+func (s *recordingStore) CountByParticipant(phoneNumber string) ([]store.ParticipantCount, error) {
+	s.counted = append(s.counted, "participants "+phoneNumber)
+	return s.Store.CountByParticipant(phoneNumber)
+}
+
+var totalsStart = time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+// newTotalsTestHandler returns a handler on a fake clock over a recording
+// store holding five messages of 9876543210, two days old, three of them
+// from sender s1.
+func newTotalsTestHandler(t *testing.T) (*Handler, *recordingStore, *clocktest.Fake) {
+	t.Helper()
+	s := &recordingStore{Store: store.NewMemoryStore()}
+	for i := range 5 {
+		msg := models.Message{ID: fmt.Sprintf("m%d", i), PhoneNumber: "9876543210", Text: "hello", Status: "SUCCESS", CreatedAt: totalsStart.Add(-48*time.Hour + time.Duration(i)*time.Minute)}
+		if i < 3 {
+			msg.Provider = &models.Provider{SenderID: "s1"}
+		}
+		if _, err := s.Save(msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	h := NewHandler(s, store.NewMemoryProfileStore())
+	fake := clocktest.NewFake(totalsStart)
+	h.SetClock(fake)
+	return h, s, fake
+}
+
+// getPage serves path and decodes the page it answers.
+func getPage(t *testing.T, h *Handler, path string) (messagePage, *httptest.ResponseRecorder) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", path, w.Code, w.Body)
+	}
+	var page messagePage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return page, w
+}
+
+func TestPagesFetchOneExtraMessageAndCountOnlyWhenAsked(t *testing.T) {
+	for _, tc := range []struct {
+		path      string
+		wantTotal int64 // 0 for none
+		counted   string
+	}{
+		{"/messages?limit=2", 0, ""},
+		{"/messages?limit=2&includeTotal=true", 5, "messages "},
+		{"/messages?limit=2&senderId=s1&includeTotal=true", 3, "messages s1"},
+		{"/v1/user/9876543210/messages?limit=2", 0, ""},
+		{"/v1/user/9876543210/messages?limit=2&includeTotal=true", 5, "participants 9876543210"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			h, s, _ := newTotalsTestHandler(t)
+			page, _ := getPage(t, h, tc.path)
+
+			if fmt.Sprint(s.fetched) != "[3]" {
+				t.Fatalf("fetched pages of %v, want one of limit+1", s.fetched)
+			}
+			if len(page.Data) != 2 || !page.Meta.HasMore {
+				t.Fatalf("page of %d messages, hasMore %v", len(page.Data), page.Meta.HasMore)
+			}
+			if tc.wantTotal == 0 {
+				if page.Meta.TotalCount != nil || len(s.counted) != 0 {
+					t.Fatalf("totalCount %v after counts %v, want neither without ?includeTotal=true", page.Meta.TotalCount, s.counted)
+				}
+				return
+			}
+			if page.Meta.TotalCount == nil || *page.Meta.TotalCount != tc.wantTotal {
+				t.Fatalf("totalCount = %v, want %d", page.Meta.TotalCount, tc.wantTotal)
+			}
+			if fmt.Sprint(s.counted) != "["+tc.counted+"]" {
+				t.Fatalf("counted %q, want %q once", s.counted, tc.counted)
+			}
+		})
+	}
+}
+
+func TestTotalsAreCountedOncePerFilter(t *testing.T) {
+	h, s, fake := newTotalsTestHandler(t)
+
+	first, _ := getPage(t, h, "/messages?limit=2&includeTotal=true")
+	second, _ := getPage(t, h, "/messages?limit=2&includeTotal=true&cursor="+first.Meta.NextCursor)
+	getPage(t, h, "/messages?limit=2&senderId=s1&includeTotal=true")
+	getPage(t, h, "/v1/user/9876543210/messages?limit=2&includeTotal=true")
+	getPage(t, h, "/v1/user/9876543210/messages?limit=4&includeTotal=true")
+	if *second.Meta.TotalCount != 5 {
+		t.Fatalf("second page totalCount = %d, want the cached 5", *second.Meta.TotalCount)
+	}
+	if want := "[messages  messages s1 participants 9876543210]"; fmt.Sprint(s.counted) != want {
+		t.Fatalf("counted %q, want each filter once", s.counted)
+	}
+
+	// Past PageCountCacheTTL, a filter is counted again
+	fake.Advance(h.config.PageCountCacheTTL)
+	getPage(t, h, "/messages?limit=2&includeTotal=true")
+	if len(s.counted) != 4 || s.counted[3] != "messages " {
+		t.Fatalf("counted %q after the TTL, want messages counted again", s.counted)
+	}
+
+	// A TTL of 0 counts every page
+	h.config.PageCountCacheTTL = 0
+	getPage(t, h, "/messages?limit=2&includeTotal=true")
+	getPage(t, h, "/messages?limit=2&includeTotal=true")
+	if len(s.counted) != 6 {
+		t.Fatalf("counted %q with no TTL, want every page counted", s.counted)
+	}
+}
+
+func TestFilteredPagesOmitTotal(t *testing.T) {
+	for _, path := range []string{
+		"/messages?limit=2&language=hi&includeTotal=true",
+		"/messages?limit=2&annotation=complaint&includeTotal=true",
+		"/v1/user/9876543210/messages?limit=2&senderId=s1&includeTotal=true",
+		"/v1/user/9876543210/messages?limit=2&language=hi&includeTotal=true",
+		"/v1/user/9876543210/messages?limit=2&annotation=complaint&includeTotal=true",
+	} {
+		h, s, _ := newTotalsTestHandler(t)
+		page, _ := getPage(t, h, path)
+		if page.Meta.TotalCount != nil || len(s.counted) != 0 {
+			t.Errorf("GET %s: totalCount %v after counts %v, want neither", path, page.Meta.TotalCount, s.counted)
+		}
+	}
+}
+
+func TestConversationPageWithTotalIsNotCached(t *testing.T) {
+	h, _, _ := newTotalsTestHandler(t)
+	path := "/v1/user/9876543210/messages?limit=2&cursor=" + encodeCursor(totalsStart.Add(-24*time.Hour), "")
+
+	// The page is of messages two days old, so it's immutable without a total
+	if _, w := getPage(t, h, path); w.Header().Get("ETag") == "" || w.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("page without a total has Cache-Control %q and ETag %q, want it cached", w.Header().Get("Cache-Control"), w.Header().Get("ETag"))
+	}
+	if _, w := getPage(t, h, path+"&includeTotal=true"); w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("page with a total has Cache-Control %q and ETag %q, want no-store", w.Header().Get("Cache-Control"), w.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,165 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// StrictJSON selects which routes reject request bodies with unknown fields.
+type StrictJSON string
+
+const (
+	StrictJSONV1  StrictJSON = "v1"  // Only /v1 routes; the legacy testing routes stay lenient
+	StrictJSONAll StrictJSON = "all" // Every route
+	StrictJSONOff StrictJSON = "off" // No route
+)
+
+// ParseStrictJSON parses a STRICT_JSON setting. The empty string means StrictJSONV1.
+func ParseStrictJSON(raw string) (StrictJSON, error) {
+	switch mode := StrictJSON(strings.ToLower(strings.TrimSpace(raw))); mode {
+	case "":
+		return StrictJSONV1, nil
+	case StrictJSONV1, StrictJSONAll, StrictJSONOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("strict JSON mode must be v1, all or off, got %q", raw)
+	}
+}
+
+// strictFor reports whether bodies sent to r must not contain unknown fields.
+func (m StrictJSON) strictFor(r *http.Request) bool {
+	switch m {
+	case StrictJSONAll:
+		return true
+	case StrictJSONOff:
+		return false
+	default:
+		return strings.HasPrefix(r.URL.Path, "/v1/")
+	}
+}
+
+// unknownFieldDetails names the offending field of a 400 response.
+type unknownFieldDetails struct {
+	Field string `json:"field"`
+}
+
+// decodeJSON decodes the request body into dst. Every handler reading a JSON
+// body goes through it, so strictness and error responses are the same
+// everywhere. On failure it answers 400 and returns false.
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "could not read request body")
+		return false
+	}
+	body = transcodeRequest(body, requestedCase(r), dst)
+
+	strict := h.config.StrictJSON.strictFor(r)
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(dst); err != nil {
+		// encoding/json has no typed error for unknown fields; its message is
+		// `json: unknown field "name"`
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			// It names only the key, so report the dotted path as a wrongly
+			// cased key would be
+			if path, ok := inexactField(body, reflect.TypeOf(dst), ""); ok {
+				field = path
+			}
+			writeUnknownField(w, strings.Trim(field, `"`))
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid JSON body")
+		return false
+	}
+
+	// encoding/json matches keys case-insensitively, so "phonenumber" fills
+	// phoneNumber even with DisallowUnknownFields; strict mode rejects it
+	if strict {
+		if field, ok := inexactField(body, reflect.TypeOf(dst), ""); ok {
+			writeUnknownField(w, field)
+			return false
+		}
+	}
+	return true
+}
+
+func writeUnknownField(w http.ResponseWriter, field string) {
+	writeErrorDetails(w, http.StatusBadRequest, "BAD_REQUEST",
+		fmt.Sprintf("unknown field %q in JSON body", field), unknownFieldDetails{Field: field})
+}
+
+// inexactField returns the dotted path of the first object key in data that
+// doesn't exactly match a JSON field name of t.
+func inexactField(data []byte, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return "", false
+		}
+		fields := jsonFields(t)
+		for key, value := range obj {
+			field, ok := fields[key]
+			if !ok {
+				return path + key, true
+			}
+			if name, bad := inexactField(value, field, path+key+"."); bad {
+				return name, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return "", false
+		}
+		for _, item := range items {
+			if name, bad := inexactField(item, t.Elem(), path); bad {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// jsonFields maps the exact JSON names of t's fields to their types,
+// including fields promoted from embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					fields[k] = v
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,95 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sms-store/internal/store"
+)
+
+func TestDecodeJSONUnknownFields(t *testing.T) {
+	type endpoint struct {
+		method, path string
+		v1           bool // Strict under StrictJSONV1
+	}
+	var (
+		createMessage      = endpoint{http.MethodPost, "/messages", false}
+		createProfile      = endpoint{http.MethodPost, "/v1/profile", true}
+		updateProfile      = endpoint{http.MethodPut, "/v1/profile/9876543210", true}
+		createConversation = endpoint{http.MethodPost, "/v1/conversations", true}
+	)
+
+	for _, tc := range []struct {
+		name     string
+		endpoint endpoint
+		body     string
+		field    string // Rejected as unknown on strict routes; empty for a valid body
+	}{
+		{"MessageValid", createMessage, `{"phoneNumber": "9876543210", "text": "hi", "provider": {"name": "acme"}}`, ""},
+		{"MessageMisspelled", createMessage, `{"phoneNumber": "9876543210", "text": "hi", "txt": "hi"}`, "txt"},
+		{"MessageCaseMismatch", createMessage, `{"phonenumber": "9876543210", "text": "hi"}`, "phonenumber"},
+		{"MessageNestedUnknown", createMessage, `{"phoneNumber": "9876543210", "text": "hi", "provider": {"name": "acme", "region": "in"}}`, "provider.region"},
+		{"MessageNestedCaseMismatch", createMessage, `{"phoneNumber": "9876543210", "text": "hi", "provider": {"name": "acme", "senderid": "VM-ACME"}}`, "provider.senderid"},
+		{"ProfileValid", createProfile, `{"phoneNumber": "9876543210", "name": "Ram"}`, ""},
+		{"ProfileMisspelled", createProfile, `{"phoneNumber": "9876543210", "nmae": "Ram"}`, "nmae"},
+		{"ProfileCaseMismatch", createProfile, `{"phonenumber": "9876543210", "name": "Ram"}`, "phonenumber"},
+		{"ProfileUpdateValid", updateProfile, `{"name": "Ram K."}`, ""},
+		{"ProfileUpdateCaseMismatch", updateProfile, `{"Name": "Ram K."}`, "Name"},
+		{"ProfileUpdateMisspelled", updateProfile, `{"name": "Ram K.", "expectedVersoin": 0}`, "expectedVersoin"},
+		{"ConversationValid", createConversation, `{"phoneNumber": "9876543211"}`, ""},
+		{"ConversationCaseMismatch", createConversation, `{"PhoneNumber": "9876543211"}`, "PhoneNumber"},
+		{"ConversationMisspelled", createConversation, `{"phoneNumber": "9876543211", "avtar": "https://example.com/a.png"}`, "avtar"},
+	} {
+		for _, mode := range []StrictJSON{StrictJSONOff, StrictJSONV1, StrictJSONAll} {
+			t.Run(tc.name+"/"+string(mode), func(t *testing.T) {
+				config := DefaultHandlerConfig()
+				config.StrictJSON = mode
+				mem := store.NewMemoryStore()
+				h := NewHandlerWithConfig(mem, store.NewMemoryProfileStore(), config)
+				h.SetSummaryStore(store.NewMemorySummaryStore(mem))
+				if tc.endpoint == updateProfile {
+					w := httptest.NewRecorder()
+					h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/profile", strings.NewReader(`{"phoneNumber": "9876543210", "name": "Ram"}`)))
+					if w.Code != http.StatusCreated {
+						t.Fatalf("creating the profile = %d %s", w.Code, w.Body.String())
+					}
+				}
+
+				w := httptest.NewRecorder()
+				h.Routes().ServeHTTP(w, httptest.NewRequest(tc.endpoint.method, tc.endpoint.path, strings.NewReader(tc.body)))
+
+				strict := mode == StrictJSONAll || mode == StrictJSONV1 && tc.endpoint.v1
+				if tc.field == "" || !strict {
+					if w.Code >= 300 {
+						t.Fatalf("%s %s = %d %s, want it accepted", tc.endpoint.method, tc.endpoint.path, w.Code, w.Body.String())
+					}
+					return
+				}
+				var resp struct {
+					Code    string              `json:"code"`
+					Details unknownFieldDetails `json:"details"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusBadRequest {
+					t.Fatalf("%s %s = %d %s, want 400", tc.endpoint.method, tc.endpoint.path, w.Code, w.Body.String())
+				}
+				if resp.Code != "BAD_REQUEST" || resp.Details.Field != tc.field {
+					t.Fatalf("400 body = %s, want field %q", w.Body.String(), tc.field)
+				}
+			})
+		}
+	}
+}
+
+func TestParseStrictJSON(t *testing.T) {
+	for raw, want := range map[string]StrictJSON{"": StrictJSONV1, "v1": StrictJSONV1, " ALL ": StrictJSONAll, "off": StrictJSONOff} {
+		if got, err := ParseStrictJSON(raw); err != nil || got != want {
+			t.Errorf("ParseStrictJSON(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	if _, err := ParseStrictJSON("strict"); err == nil {
+		t.Error("ParseStrictJSON(\"strict\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,160 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	// maxReceiptLimit is the most receipts GET /v1/admin/deletion-receipts
+	// returns at once.
+	maxReceiptLimit = 1000
+
+	// receiptPageSize is how many messages are read at a time while
+	// listing a conversation's for its receipt or snapshot.
+	receiptPageSize = 1000
+)
+
+// SetDeletionReceiptStore attaches the deletion receipts. Once set, every
+// delete records one, and GET /v1/admin/deletion-receipts reads them; it
+// answers 501 until then.
+func (h *Handler) SetDeletionReceiptStore(rs store.DeletionReceiptStore) {
+	h.deletionReceipts = rs
+}
+
+// newDeletionReceipt starts the receipt of the delete r asks for.
+func newDeletionReceipt(r *http.Request, operation, phoneNumber string) models.DeletionReceipt {
+	return models.DeletionReceipt{
+		Operation:   operation,
+		Request:     r.Method + " " + r.URL.RequestURI(),
+		Actor:       ClientIP(r),
+		AccountID:   accountID(r),
+		PhoneNumber: phoneNumber,
+		Matched:     map[string]int64{},
+	}
+}
+
+// recordDeletion appends receipt, timed now, when receipts are kept. The
+// delete has happened by then, so failing to record it is reported as an
+// error the caller can retry: deleting again matches nothing and records a
+// receipt saying so.
+func (h *Handler) recordDeletion(receipt models.DeletionReceipt) error {
+	if h.deletionReceipts == nil {
+		return nil
+	}
+	receipt.At = h.Clock().Now().UTC()
+	_, err := h.deletionReceipts.RecordDeletion(receipt)
+	return err
+}
+
+// conversationMessageIDs returns the IDs of phoneNumber's messages, live
+// and archived, for a receipt; nil when no receipts are kept, sparing the
+// reads.
+func (h *Handler) conversationMessageIDs(phoneNumber string) ([]string, error) {
+	if h.deletionReceipts == nil {
+		return nil, nil
+	}
+	ids, err := pagedIDs(func(page store.PageQuery) ([]models.Message, error) {
+		return h.store.FindByPhoneNumberPage(phoneNumber, page)
+	})
+	if err != nil || h.archiver == nil {
+		return ids, err
+	}
+	archived, err := pagedIDs(func(page store.PageQuery) ([]models.Message, error) {
+		return h.archiver.FindArchivedByPhoneNumberPage(phoneNumber, page)
+	})
+	return append(ids, archived...), err
+}
+
+// pagedIDs reads the IDs of every message find pages through.
+func pagedIDs(find func(store.PageQuery) ([]models.Message, error)) ([]string, error) {
+	var ids []string
+	err := eachMessage(find, func(msg models.Message) error {
+		ids = append(ids, msg.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// eachMessage calls fn with every message find pages through, newest
+// first, a page of receiptPageSize at a time.
+func eachMessage(find func(store.PageQuery) ([]models.Message, error), fn func(models.Message) error) error {
+	page := store.PageQuery{Limit: receiptPageSize}
+	for {
+		msgs, err := find(page)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < page.Limit {
+			return nil
+		}
+		last := msgs[len(msgs)-1]
+		page.Before, page.BeforeID = last.CreatedAt, last.ID
+	}
+}
+
+// withIDs sets receipt's digest of ids.
+func withIDs(receipt models.DeletionReceipt, ids []string) models.DeletionReceipt {
+	receipt.IDCount = len(ids)
+	receipt.IDDigest = models.DeletionDigest(ids)
+	return receipt
+}
+
+// ListDeletionReceipts returns the newest deletion receipts, optionally
+// only those of one ?phoneNumber= and recorded from ?from= until ?to=
+// (YYYY-MM-DD or RFC 3339, a date to including its day), at most ?limit= (default 100).
+// Requires the admin scope.
+// GET /v1/admin/deletion-receipts
+func (h *Handler) ListDeletionReceipts(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.deletionReceipts == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "deletion receipts are not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	q := store.DeletionReceiptQuery{PhoneNumber: strings.TrimSpace(query.Get("phoneNumber"))}
+	var err error
+	if q.From, err = parseDigestBound(query.Get("from"), time.UTC, false); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	if q.To, err = parseDigestBound(query.Get("to"), time.UTC, true); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "to must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from must be before to")
+		return
+	}
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxReceiptLimit {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be between 1 and "+strconv.Itoa(maxReceiptLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	receipts, err := h.deletionReceipts.ListDeletionReceipts(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve deletion receipts")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": receipts})
+}
@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/store"
+)
+
+type dailyDigestResponse struct {
+	PhoneNumber string              `json:"phoneNumber"`
+	Timezone    string              `json:"timezone"`
+	Days        []store.DailyBucket `json:"days"`
+}
+
+// GetDailyDigest groups a conversation's messages by local calendar day.
+// GET /v1/user/{phoneNumber}/messages/daily?tz=Asia/Kolkata&from=2024-01-01&to=2024-01-31&includeMessages=true
+//
+// tz is an IANA zone name (default UTC). from and to are either local dates
+// (YYYY-MM-DD, both inclusive) or RFC 3339 timestamps (to exclusive).
+func (h *Handler) GetDailyDigest(w http.ResponseWriter, r *http.Request) {
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/messages/daily")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	q := r.URL.Query()
+	loc, err := parseTimezone(q.Get("tz"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "tz must be a valid IANA time zone name")
+		return
+	}
+
+	from, err := parseDigestBound(q.Get("from"), loc, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	to, err := parseDigestBound(q.Get("to"), loc, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "to must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from must be before to")
+		return
+	}
+
+	days, err := h.analyticsStore().DailyDigest(phoneNumber, store.DigestQuery{
+		Location:        loc,
+		From:            from,
+		To:              to,
+		IncludeMessages: q.Get("includeMessages") == "true",
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not build daily digest")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dailyDigestResponse{
+		PhoneNumber: phoneNumber,
+		Timezone:    loc.String(),
+		Days:        days,
+	})
+}
+
+// parseTimezone loads an IANA zone name, defaulting to UTC.
+func parseTimezone(raw string) (*time.Location, error) {
+	tz := strings.TrimSpace(raw)
+	if tz == "" {
+		tz = "UTC"
+	}
+	// time.LoadLocation treats "" and "Local" specially; neither is a zone name
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		return nil, errors.New("invalid time zone")
+	}
+	return loc, nil
+}
+
+// parseDigestBound parses a from/to bound. A bare date means local midnight in
+// loc; as an upper bound it means the midnight ending that day, so the day is
+// included. An empty value returns the zero time.
+func parseDigestBound(raw string, loc *time.Location, upper bool) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", raw, loc); err == nil {
+		if upper {
+			// AddDate keeps wall-clock midnight across DST changes
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time bound")
+	}
+	return t, nil
+}
@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+var profileEnrichmentDegraded = metrics.NewCounterVec(
+	"profile_enrichment_degraded_total",
+	"Responses served without profiles because the profile lookup timed out or failed.",
+	"route", "reason",
+)
+
+// conversationWithProfile is a conversation of GET /v1/conversations?includeProfiles=true.
+// Profile is null for numbers without one, group conversations, and every
+// conversation of a partial response.
+type conversationWithProfile struct {
+	conversationWithPreferences
+	Profile *models.Profile `json:"profile"`
+}
+
+// enrichmentMeta tells clients whether profiles were left out.
+type enrichmentMeta struct {
+	Partial bool `json:"partial"` // The profile lookup timed out or failed
+}
+
+// enrichedConversations is the envelope of GET /v1/conversations?includeProfiles=true.
+type enrichedConversations struct {
+	Data []conversationWithProfile `json:"data"`
+	Meta enrichmentMeta            `json:"meta"`
+}
+
+// userMessagesWithProfile is a page of GET /v1/user/{phoneNumber}/messages?includeProfile=true.
+type userMessagesWithProfile struct {
+	Data         []models.Message         `json:"data"`
+	Profile      *models.Profile          `json:"profile"`
+	Participants []store.ParticipantCount `json:"participants,omitempty"`
+	Annotations  []store.AnnotationCount  `json:"annotations,omitempty"`
+	Meta         pageMeta                 `json:"meta"`
+}
+
+// lookupProfiles fetches the profiles of phoneNumbers for decorating a
+// response, waiting at most ProfileEnrichmentTimeout. Profiles are extras,
+// so a slow or failing profile store degrades the response instead of
+// failing it: partial is true when the lookup timed out or errored, and the
+// degradation is counted by route and reason.
+//
+// A lookup that times out keeps running in the background until the
+// profile store's own deadline; its result is discarded.
+func (h *Handler) lookupProfiles(w http.ResponseWriter, phoneNumbers []string) (profiles map[string]models.Profile, partial bool) {
+	if h.profileStore == nil || len(phoneNumbers) == 0 {
+		return map[string]models.Profile{}, false
+	}
+
+	type result struct {
+		profiles map[string]models.Profile
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		profiles, err := h.profileStore.GetProfiles(phoneNumbers)
+		done <- result{profiles, err}
+	}()
+
+	timer := time.NewTimer(h.config.ProfileEnrichmentTimeout)
+	defer timer.Stop()
+
+	route, requestID, _, _ := responseInfo(w)
+	select {
+	case res := <-done:
+		if res.err != nil {
+			profileEnrichmentDegraded.WithLabelValues(route, "error").Inc()
+			log.Printf("Serving without profiles (route=%s request_id=%s): %v", route, requestID, res.err)
+			return map[string]models.Profile{}, true
+		}
+		return res.profiles, false
+	case <-timer.C:
+		profileEnrichmentDegraded.WithLabelValues(route, "timeout").Inc()
+		log.Printf("Serving without profiles (route=%s request_id=%s): lookup exceeded %s", route, requestID, h.config.ProfileEnrichmentTimeout)
+		return map[string]models.Profile{}, true
+	}
+}
+
+// withProfiles attaches the profile of each direct conversation.
+func (h *Handler) withProfiles(w http.ResponseWriter, convs []conversationWithPreferences) enrichedConversations {
+	profiles, partial := h.lookupProfiles(w, directPhoneNumbers(convs))
+
+	out := enrichedConversations{Data: make([]conversationWithProfile, len(convs)), Meta: enrichmentMeta{Partial: partial}}
+	for i, conv := range convs {
+		out.Data[i].conversationWithPreferences = conv
+		if p, ok := profiles[conv.PhoneNumber]; ok && conv.Type == models.ConversationDirect {
+			out.Data[i].Profile = &p
+		}
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// slowProfileStore answers GetProfiles after delay, or with err.
+type slowProfileStore struct {
+	store.ProfileStore
+	delay   time.Duration
+	err     error
+	lookups atomic.Int32
+}
+
+func (s *slowProfileStore) GetProfiles(phoneNumbers []string) (map[string]models.Profile, error) {
+	s.lookups.Add(1)
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.ProfileStore.GetProfiles(phoneNumbers)
+}
+
+func TestProfileEnrichmentIsBoundedByItsTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	for _, tc := range []struct {
+		name     string
+		delay    time.Duration
+		err      error
+		partial  bool
+		profiles int
+	}{
+		{"Fast", 0, nil, false, 3},
+		{"Slow", 2 * time.Second, nil, true, 0},
+		{"Failing", 0, errors.New("profiles unavailable"), true, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mem := store.NewMemoryStore()
+			profiles := &slowProfileStore{ProfileStore: store.NewMemoryProfileStore(), delay: tc.delay, err: tc.err}
+			for i := range 3 {
+				pn := fmt.Sprintf("987654321%d", i)
+				if _, err := mem.Save(models.Message{ID: "m" + pn, PhoneNumber: pn, Text: "hello", Status: "SUCCESS", CreatedAt: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := profiles.CreateProfile(models.Profile{PhoneNumber: pn, Name: "Ram"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config := DefaultHandlerConfig()
+			config.ProfileEnrichmentTimeout = timeout
+			h := NewHandlerWithConfig(mem, profiles, config)
+
+			start := time.Now()
+			w := httptest.NewRecorder()
+			h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/conversations?includeProfiles=true", nil))
+			elapsed := time.Since(start)
+
+			var resp enrichedConversations
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("GET = %d %s", w.Code, w.Body.String())
+			}
+			// Within the timeout and some slack, not the store's two seconds
+			if elapsed > timeout+500*time.Millisecond {
+				t.Fatalf("answered after %v, want about %v at most", elapsed, timeout)
+			}
+			if tc.delay > 0 && elapsed < timeout {
+				t.Fatalf("answered after %v, before the %v timeout", elapsed, timeout)
+			}
+			found := 0
+			for _, conv := range resp.Data {
+				if conv.Profile != nil {
+					found++
+				}
+			}
+			if resp.Meta.Partial != tc.partial || found != tc.profiles || len(resp.Data) != 3 {
+				t.Fatalf("%d conversations with %d profiles, partial %v; want 3 with %d, partial %v", len(resp.Data), found, resp.Meta.Partial, tc.profiles, tc.partial)
+			}
+			// Every number is looked up in the one query
+			if n := profiles.lookups.Load(); n != 1 {
+				t.Fatalf("%d profile lookups, want 1", n)
+			}
+		})
+	}
+}
+
+func TestMessagePageProfileIsBoundedByItsTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	mem := store.NewMemoryStore()
+	if _, err := mem.Save(models.Message{ID: "m1", PhoneNumber: "9876543210", Text: "hello", Status: "SUCCESS", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultHandlerConfig()
+	config.ProfileEnrichmentTimeout = timeout
+	h := NewHandlerWithConfig(mem, &slowProfileStore{ProfileStore: store.NewMemoryProfileStore(), delay: 2 * time.Second}, config)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/user/9876543210/messages?limit=10&includeProfile=true", nil))
+	elapsed := time.Since(start)
+
+	var resp userMessagesWithProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET = %d %s", w.Code, w.Body.String())
+	}
+	if elapsed < timeout || elapsed > timeout+500*time.Millisecond {
+		t.Fatalf("answered after %v, want about %v", elapsed, timeout)
+	}
+	if !resp.Meta.Partial || resp.Profile != nil || len(resp.Data) != 1 {
+		t.Fatalf("page = %s, want its message without the profile, partial", w.Body.String())
+	}
+}
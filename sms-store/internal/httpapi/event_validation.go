@@ -0,0 +1,93 @@
+package httpapi
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"sms-store/internal/kafka"
+	"sms-store/internal/store"
+)
+
+// validateEventResponse is what the consumer would make of an event: the
+// decoded event, or why it would be dead-lettered.
+type validateEventResponse struct {
+	Valid bool `json:"valid"`
+	kafka.DecodedEvent
+	Errors           []string `json:"errors"`
+	DeadLetterReason string   `json:"deadLetterReason,omitempty"` // One of the DLQ reasons, when the event is invalid
+}
+
+// ValidateEvent runs a request body through the decoding the Kafka consumer
+// gives an sms-events payload and answers what it would store, without
+// storing anything. Besides the payload itself, it checks the routes the
+// event would take: a group conversation to join, a message to update, a
+// profile store. What the message store adds when saving, such as the
+// language and cost of a message, and duplicate text suppression are left
+// out. An invalid event is still answered 200, with valid set to false.
+// Requires the admin scope.
+// POST /v1/admin/events/validate
+func (h *Handler) ValidateEvent(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "could not read request body")
+		return
+	}
+
+	ev, err := kafka.DecodeEvent(body, h.Clock().Now(), h.config.MaxFutureSkew)
+	resp := validateEventResponse{DecodedEvent: ev, Errors: []string{}}
+	var eventErr *kafka.EventError
+	switch {
+	case ev.Type == kafka.EventProfileUpdated && h.profileStore == nil:
+		// The consumer checks for a profile store before the payload
+		resp.DeadLetterReason, resp.Errors = kafka.ReasonNoRoute, []string{"no profile store configured"}
+	case errors.As(err, &eventErr):
+		resp.DeadLetterReason, resp.Errors = eventErr.Reason, eventErr.Problems
+	default:
+		reason, problem, err := h.checkEventRoute(ev)
+		if err != nil {
+			writeStoreError(w, err, "check event route")
+			return
+		}
+		if reason != "" {
+			resp.DeadLetterReason, resp.Errors = reason, []string{problem}
+		}
+	}
+	resp.Valid = resp.DeadLetterReason == ""
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checkEventRoute looks up, without changing them, the records a decoded
+// event needs. It returns the reason the consumer would dead-letter the
+// event with, and why, or an empty reason when the event would be applied.
+func (h *Handler) checkEventRoute(ev kafka.DecodedEvent) (reason, problem string, err error) {
+	switch ev.Type {
+	case kafka.EventMessageReceived:
+		if ev.Message.ConversationID == "" {
+			return "", "", nil
+		}
+		if h.conversations == nil {
+			return kafka.ReasonNoRoute, "no conversation store configured", nil
+		}
+		if len(ev.Participants) > 0 {
+			// The consumer creates the conversation on its first message
+			return "", "", nil
+		}
+		_, err := h.conversations.GetConversation(ev.Message.ConversationID)
+		if errors.Is(err, store.ErrNotFound) {
+			return kafka.ReasonConversationNotFound, "conversation not found", nil
+		}
+		return "", "", err
+
+	case kafka.EventMessageUpdated:
+		_, err := h.store.FindByID(ev.Update.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			return kafka.ReasonMessageNotFound, "message not found", nil
+		}
+		return "", "", err
+	}
+	return "", "", nil
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"sms-store/internal/exports"
+)
+
+// SetExportLinkSigner attaches the signer for export links. Export link
+// endpoints answer 501 until one is set.
+func (h *Handler) SetExportLinkSigner(s *exports.LinkSigner) {
+	h.exportLinks = s
+}
+
+type exportLinkResponse struct {
+	PhoneNumber string    `json:"phoneNumber"`
+	URL         string    `json:"url"`
+	Token       string    `json:"token"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// CreateExportLink returns a signed link to a conversation's export that
+// works without an API key until it expires, e.g. for an external auditor.
+// Requires the admin scope.
+// POST /v1/user/{phoneNumber}/messages/export-link
+func (h *Handler) CreateExportLink(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.exportLinks == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "export links are not configured")
+		return
+	}
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/messages/export-link")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	expiresAt := h.Clock().Now().Add(h.config.ExportLinkTTL).Truncate(time.Second)
+	token, err := h.exportLinks.Sign(phoneNumber, expiresAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not sign export link")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, exportLinkResponse{
+		PhoneNumber: phoneNumber,
+		URL:         "/v1/export-download?token=" + url.QueryEscape(token),
+		Token:       token,
+		ExpiresAt:   expiresAt.UTC(),
+	})
+}
+
+// DownloadExportLink streams the NDJSON export a signed link grants. The
+// token is the only credential; a tampered or expired one gets 401.
+// GET /v1/export-download?token=...
+func (h *Handler) DownloadExportLink(w http.ResponseWriter, r *http.Request) {
+	if h.exportLinks == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "export links are not configured")
+		return
+	}
+
+	link, err := h.exportLinks.Verify(r.URL.Query().Get("token"))
+	switch {
+	case errors.Is(err, exports.ErrLinkExpired):
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "export link has expired")
+		return
+	case err != nil:
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid export link")
+		return
+	}
+
+	filename := link.PhoneNumber + ".ndjson"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// Headers are gone by now, so a failure can only cut the stream short
+	buf := bufio.NewWriter(w)
+	if _, err := h.writeNDJSON(r.Context(), buf, link.PhoneNumber, requestedCase(r), func(int64) {}); err != nil {
+		log.Printf("Export link download for %s stopped: %v", link.PhoneNumber, err)
+		return
+	}
+	if err := buf.Flush(); err != nil {
+		recordWriteError(w, err)
+	}
+}
@@ -0,0 +1,300 @@
+package httpapi
+
+import (
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/search"
+	"sms-store/internal/store"
+)
+
+const exportQueryJobType = "export_query"
+
+// queryExportFormats are the file types of query exports, by format.
+var queryExportFormats = map[string]struct{ ext, contentType string }{
+	"ndjson": {".ndjson.gz", "application/gzip"},
+	"csv":    {".csv.gz", "application/gzip"},
+}
+
+// csvExportColumns are the columns of a CSV query export, named as the
+// message fields they hold.
+var csvExportColumns = []string{"id", "phoneNumber", "conversationId", "direction", "status", "senderId", "createdAt", "receivedAt", "text"}
+
+// SetMessageQuerier attaches the message store POST /v1/admin/export/query
+// reads. It answers 501 until one is set.
+func (h *Handler) SetMessageQuerier(q store.MessageQuerier) {
+	h.querier = q
+}
+
+type exportQueryRequest struct {
+	Q         string `json:"q,omitempty"`         // Text the messages contain, as GET /v1/search?q=
+	Prefix    string `json:"prefix,omitempty"`    // Or words they have words starting with, as GET /v1/search?prefix=
+	RefType   string `json:"refType,omitempty"`   // With refId, an external reference the messages carry
+	RefID     string `json:"refId,omitempty"`     //
+	From      string `json:"from,omitempty"`      // YYYY-MM-DD or RFC 3339; dates are UTC days
+	To        string `json:"to,omitempty"`        // Exclusive; a date includes its whole day
+	Direction string `json:"direction,omitempty"` // inbound or outbound
+	Format    string `json:"format,omitempty"`    // ndjson (default) or csv
+}
+
+// StartQueryExport exports the messages of every conversation that match a
+// search, gzipped, in the background. Requires the admin scope.
+// POST /v1/admin/export/query
+//
+// The filter is that of GET /v1/search, with a creation time range and a
+// direction added. Matches are read oldest first through one store cursor
+// and streamed to the file. An export holding more than
+// ExportQueryMaxRows messages fails naming the limit, so a query too
+// broad for discovery is narrowed rather than cut short. The response is
+// 202 with the job; the file is downloaded from GET /v1/exports/{jobId}.
+// With data residency, only the messages of the regions the deployment
+// serves are exported, unless ?regionOverride=true.
+func (h *Handler) StartQueryExport(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	override, ok := h.regionOverride(w, r)
+	if !ok {
+		return
+	}
+	if h.exports == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "exports are not configured")
+		return
+	}
+	if h.querier == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "query exports are not supported by the message store")
+		return
+	}
+
+	var req exportQueryRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	q, prefix, status, err := h.parseExportQuery(req)
+	if err != nil {
+		writeError(w, status, errorCode(status), err.Error())
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = "ndjson"
+	}
+	if _, ok := queryExportFormats[format]; !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be ndjson or csv")
+		return
+	}
+
+	job, err := h.jobs.Submit(exportQueryJobType, h.runQueryExport(q, prefix, format, requestedCase(r), override))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start export")
+		return
+	}
+
+	downloadURL := "/v1/exports/" + job.ID
+	w.Header().Set("Location", downloadURL)
+	writeJSON(w, http.StatusAccepted, exportStartedResponse{
+		Message:     "Export started",
+		JobID:       job.ID,
+		DownloadURL: downloadURL,
+		Job:         job,
+	})
+}
+
+// parseExportQuery validates req as GET /v1/search validates its query. It
+// returns the store query, the prefix query its matches are checked
+// against, if any, and the status of an error.
+func (h *Handler) parseExportQuery(req exportQueryRequest) (store.MessageQuery, string, int, error) {
+	var q store.MessageQuery
+	text := strings.TrimSpace(req.Q)
+	prefix := strings.TrimSpace(req.Prefix)
+	switch {
+	case text != "" && prefix != "":
+		return q, "", http.StatusBadRequest, errors.New("use either q or prefix")
+	case len([]rune(text+prefix)) < minSearchQueryLen:
+		return q, "", http.StatusBadRequest, errors.New("q must be at least 2 characters")
+	case prefix != "" && h.tokenizer == nil:
+		return q, "", http.StatusNotImplemented, errors.New("prefix search is not enabled")
+	}
+	q.Text = text
+	if prefix != "" {
+		q.Tokens = h.tokenizer.QueryTokens(prefix)
+		if len(q.Tokens) == 0 {
+			return q, "", http.StatusBadRequest, errors.New("q must be at least 2 characters")
+		}
+	}
+
+	ref := models.ExternalRef{Type: strings.TrimSpace(req.RefType), ID: strings.TrimSpace(req.RefID)}
+	switch {
+	case ref.Type != "" && ref.ID != "":
+		q.ExternalRef = &ref
+	case ref.Type != "" || ref.ID != "":
+		return q, "", http.StatusBadRequest, errors.New("refType and refId must be given together")
+	}
+
+	var err error
+	if q.From, err = parseDigestBound(req.From, time.UTC, false); err != nil {
+		return q, "", http.StatusBadRequest, errors.New("from must be YYYY-MM-DD or RFC 3339")
+	}
+	if q.To, err = parseDigestBound(req.To, time.UTC, true); err != nil {
+		return q, "", http.StatusBadRequest, errors.New("to must be YYYY-MM-DD or RFC 3339")
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return q, "", http.StatusBadRequest, errors.New("from must be before to")
+	}
+
+	switch direction := strings.ToLower(strings.TrimSpace(req.Direction)); direction {
+	case "", models.DirectionInbound, models.DirectionOutbound:
+		q.Direction = direction
+	default:
+		return q, "", http.StatusBadRequest, errors.New("direction must be inbound or outbound")
+	}
+	return q, prefix, 0, nil
+}
+
+// errorCode returns the error code of the statuses parseExportQuery returns.
+func errorCode(status int) string {
+	if status == http.StatusNotImplemented {
+		return "NOT_IMPLEMENTED"
+	}
+	return "BAD_REQUEST"
+}
+
+// runQueryExport streams the matches of q into a gzipped export named after
+// the job, failing once they outnumber ExportQueryMaxRows. With override,
+// the matches of every data residency region are exported.
+func (h *Handler) runQueryExport(q store.MessageQuery, prefix, format string, fc fieldCase, override bool) jobs.Func {
+	querier := h.querier
+	if override {
+		querier = store.UnscopedQuerier(querier)
+	}
+	return func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		out, err := h.exports.Create(p.JobID())
+		if err != nil {
+			return nil, err
+		}
+
+		zw := gzip.NewWriter(out)
+		enc, err := newQueryExportEncoder(zw, format, fc)
+		if err != nil {
+			out.Abort()
+			return nil, err
+		}
+
+		limit := h.config.ExportQueryMaxRows
+		var count int64
+		conversations := make(map[string]bool)
+		err = querier.QueryMessages(ctx, q, cmp.Or(h.config.ExportBatchSize, exportPageSize), func(batch []models.Message) error {
+			for _, msg := range batch {
+				// Stored tokens only narrow a prefix query down
+				if prefix != "" && !search.MatchesPrefixes(msg.Text, prefix) {
+					continue
+				}
+				if limit > 0 && count >= int64(limit) {
+					return fmt.Errorf("more than %d messages match the query, the most one export holds; narrow it down", limit)
+				}
+				if err := enc.encode(msg); err != nil {
+					return err
+				}
+				count++
+				conversations[cmp.Or(msg.ConversationID, msg.PhoneNumber)] = true
+			}
+			p.Add(int64(len(batch)))
+			return nil
+		})
+		if err == nil {
+			err = enc.flush()
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		if err != nil {
+			out.Abort()
+			return nil, err
+		}
+		size, err := out.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{
+			"format":        format,
+			"messages":      count,
+			"conversations": len(conversations),
+			"bytes":         size,
+			"downloadUrl":   "/v1/exports/" + p.JobID(),
+			"expiresAt":     h.Clock().Now().Add(h.exports.TTL()),
+		}, nil
+	}
+}
+
+// queryExportEncoder writes the messages of a query export in one format.
+type queryExportEncoder struct {
+	encode func(models.Message) error
+	flush  func() error
+}
+
+// newQueryExportEncoder returns an encoder of format writing to w, with
+// field names in fc. A CSV export starts with its header row.
+func newQueryExportEncoder(w io.Writer, format string, fc fieldCase) (queryExportEncoder, error) {
+	if format != "csv" {
+		return queryExportEncoder{
+			encode: func(msg models.Message) error {
+				line, err := json.Marshal(msg)
+				if err != nil {
+					return err
+				}
+				_, err = w.Write(append(transcodeResponse(line, fc), '\n'))
+				return err
+			},
+			flush: func() error { return nil },
+		}, nil
+	}
+
+	cw := csv.NewWriter(w)
+	header := make([]string, len(csvExportColumns))
+	for i, column := range csvExportColumns {
+		header[i] = column
+		if fc == snakeCase {
+			header[i] = toSnake(column)
+		}
+	}
+	if err := cw.Write(header); err != nil {
+		return queryExportEncoder{}, err
+	}
+	return queryExportEncoder{
+		encode: func(msg models.Message) error {
+			return cw.Write(csvExportRow(msg))
+		},
+		flush: func() error {
+			cw.Flush()
+			return cw.Error()
+		},
+	}, nil
+}
+
+// csvExportRow returns the csvExportColumns of msg.
+func csvExportRow(msg models.Message) []string {
+	direction := cmp.Or(msg.Direction, models.DirectionOutbound)
+	var senderID, receivedAt string
+	if msg.Provider != nil {
+		senderID = msg.Provider.SenderID
+	}
+	if !msg.ReceivedAt.IsZero() {
+		receivedAt = msg.ReceivedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return []string{
+		msg.ID, msg.PhoneNumber, msg.ConversationID, direction, msg.Status, senderID,
+		msg.CreatedAt.UTC().Format(time.RFC3339Nano), receivedAt, msg.Text,
+	}
+}
@@ -0,0 +1,235 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"sms-store/internal/exports"
+	"sms-store/internal/jobs"
+	"sms-store/internal/store"
+)
+
+const (
+	exportJobType  = "export_messages"
+	exportPageSize = 500
+)
+
+// exportFormats are the file types of the jobs whose output is served from
+// GET /v1/exports/{jobId}, by job type.
+var exportFormats = map[string]struct{ ext, contentType string }{
+	exportJobType:         {".ndjson", "application/x-ndjson"},
+	exportTimelineJobType: {".ndjson", "application/x-ndjson"},
+	transcriptJobType:     {".pdf", "application/pdf"},
+}
+
+// SetExportArtifacts attaches the directory finished exports are kept in.
+// Export endpoints answer 501 until one is set.
+func (h *Handler) SetExportArtifacts(a *exports.Artifacts) {
+	h.exports = a
+}
+
+type exportStartedResponse struct {
+	Message     string   `json:"message"`
+	JobID       string   `json:"jobId"`
+	DownloadURL string   `json:"downloadUrl"`
+	Job         jobs.Job `json:"job"`
+}
+
+// StartExport builds an NDJSON export of a conversation in the background.
+// POST /v1/user/{phoneNumber}/messages/export?format=timeline
+//
+// The response is 202 with the job; the export is then downloaded from
+// GET /v1/exports/{jobId}. Starting an export while one is already running
+// for the same number returns that export's job. The default format,
+// messages, lists the messages newest first; timeline merges them with the
+// conversation's audit entries, oldest first, one typed row per line.
+func (h *Handler) StartExport(w http.ResponseWriter, r *http.Request) {
+	if h.exports == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "exports are not configured")
+		return
+	}
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/messages/export")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	fc := requestedCase(r)
+	jobType, run := exportJobType, h.runExport(phoneNumber, fc)
+	switch r.URL.Query().Get("format") {
+	case "", "messages":
+	case "timeline":
+		jobType, run = exportTimelineJobType, h.runTimelineExport(phoneNumber, fc)
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be messages or timeline")
+		return
+	}
+
+	// A snake_case export is a different file, so it doesn't share the job
+	key := jobType + ":" + phoneNumber
+	if fc == snakeCase {
+		key += ":snake"
+	}
+	job, err := h.jobs.SubmitKeyed(jobType, key, run)
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start export")
+		return
+	}
+
+	downloadURL := "/v1/exports/" + job.ID
+	w.Header().Set("Location", downloadURL)
+	writeJSON(w, http.StatusAccepted, exportStartedResponse{
+		Message:     "Export started",
+		JobID:       job.ID,
+		DownloadURL: downloadURL,
+		Job:         job,
+	})
+}
+
+// runExport writes every message of phoneNumber, newest first, as one JSON
+// object per line into an export named after the job.
+func (h *Handler) runExport(phoneNumber string, fc fieldCase) jobs.Func {
+	return func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		out, err := h.exports.Create(p.JobID())
+		if err != nil {
+			return nil, err
+		}
+
+		buf := bufio.NewWriter(out)
+		count, err := h.writeNDJSON(ctx, buf, phoneNumber, fc, p.Add)
+		if err != nil {
+			out.Abort()
+			return nil, err
+		}
+
+		if err := buf.Flush(); err != nil {
+			out.Abort()
+			return nil, err
+		}
+		size, err := out.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{
+			"phoneNumber": phoneNumber,
+			"messages":    count,
+			"bytes":       size,
+			"downloadUrl": "/v1/exports/" + p.JobID(),
+			"expiresAt":   h.Clock().Now().Add(h.exports.TTL()),
+		}, nil
+	}
+}
+
+// writeNDJSON writes every message of phoneNumber, newest first, as one JSON
+// object per line in the field naming fc, calling progress after each page.
+func (h *Handler) writeNDJSON(ctx context.Context, w io.Writer, phoneNumber string, fc fieldCase, progress func(int64)) (int64, error) {
+	page := store.PageQuery{Limit: exportPageSize, BatchSize: h.config.ExportBatchSize}
+	var count int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		msgs, err := h.analyticsStore().FindByPhoneNumberPage(phoneNumber, page)
+		if err != nil {
+			return count, err
+		}
+		for _, msg := range msgs {
+			line, err := json.Marshal(msg)
+			if err != nil {
+				return count, err
+			}
+			if _, err := w.Write(append(transcodeResponse(line, fc), '\n')); err != nil {
+				return count, err
+			}
+		}
+		count += int64(len(msgs))
+		progress(int64(len(msgs)))
+
+		if len(msgs) < page.Limit {
+			return count, nil
+		}
+		last := msgs[len(msgs)-1]
+		page.Before, page.BeforeID = last.CreatedAt, last.ID
+	}
+}
+
+// exportFormatOf returns the file type of the output of job, and whether
+// it has one. A query export is in the format it was asked for, which its
+// result only names once it is done.
+func exportFormatOf(job jobs.Job) (struct{ ext, contentType string }, bool) {
+	if job.Type == exportQueryJobType {
+		name, _ := job.Result["format"].(string)
+		return queryExportFormats[name], true
+	}
+	format, ok := exportFormats[job.Type]
+	return format, ok
+}
+
+// DownloadExport serves a finished export, query export or PDF transcript.
+// GET /v1/exports/{jobId}
+//
+// Downloads support Range requests, so an interrupted download can resume
+// with Range and If-Range against the ETag. While the export is still being
+// built the response is 202 with the job.
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	if h.exports == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "exports are not configured")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/exports/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid export ID")
+		return
+	}
+
+	job, err := h.jobs.Get(id)
+	format, isExport := exportFormatOf(job)
+	if errors.Is(err, jobs.ErrNotFound) || (err == nil && !isExport) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "export not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not fetch export")
+		return
+	}
+
+	switch job.Status {
+	case jobs.StatusQueued, jobs.StatusRunning:
+		writeJSON(w, http.StatusAccepted, map[string]any{"message": "Export in progress", "job": job})
+		return
+	case jobs.StatusFailed, jobs.StatusCancelled:
+		writeErrorDetails(w, http.StatusConflict, "CONFLICT", "export did not complete", job)
+		return
+	}
+
+	artifact, err := h.exports.Open(id)
+	if errors.Is(err, exports.ErrNotFound) {
+		writeError(w, http.StatusGone, "GONE", "export has expired")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not open export")
+		return
+	}
+	defer artifact.Close()
+
+	filename := id + format.ext
+	if phoneNumber, ok := job.Result["phoneNumber"].(string); ok {
+		filename = phoneNumber + "-" + filename
+	}
+
+	// ServeContent handles Range, If-Range and If-None-Match against the ETag
+	w.Header().Set("ETag", artifact.ETag)
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("Expires", artifact.ExpiresAt.UTC().Format(http.TimeFormat))
+	http.ServeContent(w, r, filename, artifact.ModTime, artifact)
+}
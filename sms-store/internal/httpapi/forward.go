@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"sms-store/internal/models"
+)
+
+type forwardRequest struct {
+	To string `json:"to"` // Phone number of the conversation to forward to
+}
+
+func (req *forwardRequest) validate() error {
+	req.To = strings.TrimSpace(req.To)
+	if req.To == "" {
+		return errors.New("to is required")
+	}
+	return nil
+}
+
+// ForwardMessage stores a message to another number with the text of an
+// existing one, archived or not, after ForwardPrefix. The new message
+// records the original's ID as forwardedFromId, and its response links to
+// the original. This service sends nothing, so the message is stored only,
+// like one from POST /messages.
+// POST /messages/{id}/forward
+func (h *Handler) ForwardMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := messagePathID(r.URL.Path, "/forward")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return
+	}
+	var req forwardRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+
+	original, err := h.findMessage(id)
+	if err != nil {
+		writeStoreError(w, err, "retrieve message")
+		return
+	}
+
+	now := h.Clock().Now()
+	msg := models.Message{
+		ID:              "msg-" + now.Format("20060102150405.000000000"),
+		PhoneNumber:     req.To,
+		SenderType:      models.ClassifySender(req.To),
+		Text:            h.config.ForwardPrefix + original.Text,
+		Status:          "RECEIVED",
+		CreatedAt:       now,
+		ReceivedAt:      now,
+		AccountID:       accountID(r),
+		ForwardedFromID: original.ID,
+	}
+
+	saved, err := h.store.Save(msg)
+	if err != nil {
+		writeStoreError(w, err, "save message")
+		return
+	}
+
+	writeCreated(w, messageURL(saved.ID), newMessageResponse(saved))
+}
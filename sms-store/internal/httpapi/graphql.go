@@ -0,0 +1,511 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"sms-store/internal/graphql"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const defaultGraphQLPageSize = 20
+
+// GraphQL serves read-only GraphQL queries of conversations, messages,
+// profiles and store stats, for frontends that want to pick their fields.
+// Queries deeper than GraphQLMaxDepth or costing more than
+// GraphQLMaxComplexity are rejected, and __schema and __type are only
+// answered with GraphQLIntrospection. Mutations aren't supported.
+//
+// Responses follow the query's field names, so ?case=snake doesn't apply.
+// They are 200 with any field errors in errors, or 400 when the query is
+// rejected before running.
+// POST /graphql {"query": "...", "operationName": "...", "variables": {...}}
+// GET /graphql?query=...&operationName=...&variables=...
+func (h *Handler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if raw := q.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "BAD_REQUEST", "variables must be a JSON object")
+				return
+			}
+		}
+	} else if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "query is required")
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphQLLoaderKey{}, &graphQLLoader{h: h})
+	resp := h.graphQLSchema().Execute(ctx, req, graphql.Options{
+		MaxDepth:      h.config.GraphQLMaxDepth,
+		MaxComplexity: h.config.GraphQLMaxComplexity,
+		Introspection: h.config.GraphQLIntrospection,
+	})
+
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		recordWriteError(w, err)
+	}
+}
+
+// graphQLSchema returns the schema GraphQL serves, built on first use.
+func (h *Handler) graphQLSchema() *graphql.Schema {
+	h.graphQLOnce.Do(func() {
+		schema, err := graphql.NewSchema(h.newGraphQLQuery())
+		if err != nil {
+			panic(err) // The schema is fixed, so this is a programming error
+		}
+		h.graphQL = schema
+	})
+	return h.graphQL
+}
+
+type graphQLLoaderKey struct{}
+
+// graphQLLoader caches the summaries and profiles one GraphQL request has
+// read, so every conversation or message of a level shares one lookup.
+type graphQLLoader struct {
+	h         *Handler
+	summaries map[string]*store.ConversationSummary // Nil for numbers without one
+	profiles  map[string]*models.Profile            // Nil for numbers without one
+}
+
+func loaderFrom(ctx context.Context) *graphQLLoader {
+	return ctx.Value(graphQLLoaderKey{}).(*graphQLLoader)
+}
+
+// summariesOf returns the summaries of phoneNumbers, looking up those not
+// read yet in one call. Without a summary store there are none.
+func (l *graphQLLoader) summariesOf(phoneNumbers []string) (map[string]*store.ConversationSummary, error) {
+	if l.summaries == nil {
+		l.summaries = make(map[string]*store.ConversationSummary)
+	}
+	missing := unread(l.summaries, phoneNumbers)
+	if len(missing) > 0 && l.h.summaries != nil {
+		found, err := l.h.summaries.GetSummaries(missing)
+		if err != nil {
+			log.Printf("GraphQL: could not retrieve conversation summaries: %v", err)
+			return nil, errors.New("could not retrieve conversation summaries")
+		}
+		for _, pn := range missing {
+			if s, ok := found[pn]; ok {
+				l.summaries[pn] = &s
+			}
+		}
+	}
+	for _, pn := range missing {
+		if _, ok := l.summaries[pn]; !ok {
+			l.summaries[pn] = nil
+		}
+	}
+	return l.summaries, nil
+}
+
+// profilesOf returns the profiles of phoneNumbers, looking up those not
+// read yet in one call. Without a profile store there are none.
+func (l *graphQLLoader) profilesOf(phoneNumbers []string) (map[string]*models.Profile, error) {
+	if l.profiles == nil {
+		l.profiles = make(map[string]*models.Profile)
+	}
+	missing := unread(l.profiles, phoneNumbers)
+	if len(missing) > 0 && l.h.profileStore != nil {
+		found, err := l.h.profileStore.GetProfiles(missing)
+		if err != nil {
+			log.Printf("GraphQL: could not retrieve profiles: %v", err)
+			return nil, errors.New("could not retrieve profiles")
+		}
+		for _, pn := range missing {
+			if p, ok := found[pn]; ok {
+				l.profiles[pn] = &p
+			}
+		}
+	}
+	for _, pn := range missing {
+		if _, ok := l.profiles[pn]; !ok {
+			l.profiles[pn] = nil
+		}
+	}
+	return l.profiles, nil
+}
+
+// unread returns the phone numbers, once each, that cache has no entry for.
+func unread[V any](cache map[string]V, phoneNumbers []string) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, pn := range phoneNumbers {
+		if _, ok := cache[pn]; !ok && !seen[pn] {
+			seen[pn] = true
+			missing = append(missing, pn)
+		}
+	}
+	return missing
+}
+
+// graphQLConversationPage is a page of Query.conversations. Conversations
+// are resolved as their phone numbers.
+type graphQLConversationPage struct {
+	Nodes      []string `json:"nodes"`
+	NextCursor *string  `json:"nextCursor"`
+	TotalCount int      `json:"totalCount"`
+}
+
+// graphQLMessagePage is a page of Conversation.messages, newest first.
+type graphQLMessagePage struct {
+	Nodes      []models.Message `json:"nodes"`
+	NextCursor *string          `json:"nextCursor"`
+}
+
+// graphQLStats is Query.stats: the counts of GET /v1/admin/store/stats,
+// without the store's limits.
+type graphQLStats struct {
+	Backend       string `json:"backend"`
+	Messages      int64  `json:"messages"`
+	Conversations *int64 `json:"conversations"`
+}
+
+// newGraphQLQuery builds the query type of the schema, whose resolvers read
+// h's stores.
+func (h *Handler) newGraphQLQuery() *graphql.Object {
+	nonNullString := graphql.NewNonNull(graphql.String)
+	pageArgs := func(cursor string) []*graphql.Argument {
+		return []*graphql.Argument{
+			{Name: "first", Description: "Most items of the page.", Type: graphql.Int, Default: defaultGraphQLPageSize},
+			{Name: cursor, Description: "nextCursor of the previous page.", Type: graphql.String},
+		}
+	}
+
+	profile := &graphql.Object{
+		Name:        "Profile",
+		Description: "The profile of a phone number.",
+		Fields: []*graphql.Field{
+			{Name: "phoneNumber", Type: nonNullString},
+			{Name: "name", Type: nonNullString},
+			{Name: "avatar", Type: graphql.String, Resolve: optionalField(func(p *models.Profile) string { return p.Avatar })},
+			{Name: "source", Type: graphql.String, Resolve: optionalField(func(p *models.Profile) string { return p.Source })},
+			{Name: "version", Type: graphql.NewNonNull(graphql.Int)},
+			{Name: "createdAt", Type: graphql.DateTime},
+			{Name: "updatedAt", Type: graphql.DateTime},
+		},
+	}
+	profileOf := func(phoneNumber func(source any) string) graphql.BatchResolveFunc {
+		return func(ctx context.Context, sources []any, _ map[string]any) ([]any, error) {
+			phoneNumbers := make([]string, len(sources))
+			for i, source := range sources {
+				phoneNumbers[i] = phoneNumber(source)
+			}
+			profiles, err := loaderFrom(ctx).profilesOf(phoneNumbers)
+			if err != nil {
+				return nil, err
+			}
+			values := make([]any, len(sources))
+			for i, pn := range phoneNumbers {
+				values[i] = profiles[pn]
+			}
+			return values, nil
+		}
+	}
+
+	message := &graphql.Object{
+		Name:        "Message",
+		Description: "A message of a conversation.",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: graphql.NewNonNull(graphql.ID)},
+			{Name: "correlationId", Type: graphql.String},
+			{Name: "phoneNumber", Type: nonNullString},
+			{Name: "conversationId", Description: "Group conversation of the message.", Type: graphql.String, Resolve: optionalField(func(m models.Message) string { return m.ConversationID })},
+			{Name: "text", Type: nonNullString},
+			{Name: "status", Type: nonNullString},
+			{Name: "direction", Description: "inbound, or null for outbound messages.", Type: graphql.String, Resolve: optionalField(func(m models.Message) string { return m.Direction })},
+			{Name: "senderType", Type: graphql.String, Resolve: optionalField(func(m models.Message) string { return m.SenderType })},
+			{Name: "createdAt", Type: graphql.NewNonNull(graphql.DateTime)},
+			{Name: "receivedAt", Type: graphql.DateTime},
+			{Name: "replyToId", Type: graphql.ID, Resolve: optionalField(func(m models.Message) string { return m.ReplyToID })},
+			{Name: "language", Description: "Code of the detected language.", Type: graphql.String, Resolve: optionalField(func(m models.Message) string {
+				if m.Language == nil {
+					return ""
+				}
+				return m.Language.Code
+			})},
+			{Name: "profile", Description: "Profile of the message's phone number.", Type: profile, BatchResolve: profileOf(func(source any) string {
+				return source.(models.Message).PhoneNumber
+			})},
+		},
+	}
+
+	messagePage := &graphql.Object{
+		Name:        "MessagePage",
+		Description: "A page of messages, newest first.",
+		Fields: []*graphql.Field{
+			{Name: "nodes", Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(message)))},
+			{Name: "nextCursor", Description: "Cursor of the next page, or null on the last.", Type: graphql.String},
+		},
+	}
+
+	state := &graphql.Enum{
+		Name:        "ConversationState",
+		Description: "The lifecycle state of a conversation.",
+		Values:      []string{models.ConversationOpen, models.ConversationClosed, models.ConversationSnoozed},
+	}
+	summaryField := func(name string, t graphql.Type, get func(s *store.ConversationSummary) any) *graphql.Field {
+		return &graphql.Field{Name: name, Type: t, BatchResolve: func(ctx context.Context, sources []any, _ map[string]any) ([]any, error) {
+			phoneNumbers := make([]string, len(sources))
+			for i, source := range sources {
+				phoneNumbers[i] = source.(string)
+			}
+			summaries, err := loaderFrom(ctx).summariesOf(phoneNumbers)
+			if err != nil {
+				return nil, err
+			}
+			values := make([]any, len(sources))
+			for i, pn := range phoneNumbers {
+				if s := summaries[pn]; s != nil {
+					values[i] = get(s)
+				}
+			}
+			return values, nil
+		}}
+	}
+
+	conversation := &graphql.Object{
+		Name:        "Conversation",
+		Description: "The conversation of a phone number. Summary fields are null without conversation summaries.",
+		Fields: []*graphql.Field{
+			{Name: "phoneNumber", Type: nonNullString, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+				return source, nil
+			}},
+			{Name: "senderType", Type: nonNullString, Resolve: func(_ context.Context, source any, _ map[string]any) (any, error) {
+				return models.ClassifySender(source.(string)), nil
+			}},
+			summaryField("state", state, func(s *store.ConversationSummary) any { return s.EffectiveState(h.Clock().Now()) }),
+			summaryField("messageCount", graphql.Int, func(s *store.ConversationSummary) any { return s.MessageCount }),
+			summaryField("lastMessageAt", graphql.DateTime, func(s *store.ConversationSummary) any { return s.LastMessageAt }),
+			summaryField("preview", graphql.String, func(s *store.ConversationSummary) any { return s.Preview }),
+			summaryField("language", graphql.String, func(s *store.ConversationSummary) any { return optionalString(s.Language) }),
+			{Name: "profile", Type: profile, BatchResolve: profileOf(func(source any) string { return source.(string) })},
+			{Name: "messages", Type: graphql.NewNonNull(messagePage), Args: pageArgs("before"), Resolve: h.resolveConversationMessages},
+		},
+	}
+
+	conversationPage := &graphql.Object{
+		Name:        "ConversationPage",
+		Description: "A page of conversations, by phone number.",
+		Fields: []*graphql.Field{
+			{Name: "nodes", Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(conversation)))},
+			{Name: "nextCursor", Description: "Cursor of the next page, or null on the last.", Type: graphql.String},
+			{Name: "totalCount", Description: "Conversations across every page.", Type: graphql.NewNonNull(graphql.Int)},
+		},
+	}
+
+	stats := &graphql.Object{
+		Name:        "Stats",
+		Description: "What the message store holds.",
+		Fields: []*graphql.Field{
+			{Name: "backend", Type: nonNullString},
+			{Name: "messages", Type: graphql.NewNonNull(graphql.Int)},
+			{Name: "conversations", Description: "Null where counting them isn't cheap.", Type: graphql.Int},
+		},
+	}
+
+	return &graphql.Object{
+		Name: "Query",
+		Fields: []*graphql.Field{
+			{
+				Name:        "conversations",
+				Description: "Conversations by phone number, optionally only those in one state.",
+				Type:        graphql.NewNonNull(conversationPage),
+				Args:        append(pageArgs("after"), &graphql.Argument{Name: "state", Type: state}),
+				Resolve:     h.resolveConversations,
+			},
+			{
+				Name:        "conversation",
+				Description: "The conversation of phoneNumber, or null if it has none.",
+				Type:        conversation,
+				Args:        []*graphql.Argument{{Name: "phoneNumber", Type: nonNullString}},
+				Resolve:     h.resolveConversation,
+			},
+			{
+				Name:        "message",
+				Description: "The message with id, archived ones included, or null.",
+				Type:        message,
+				Args:        []*graphql.Argument{{Name: "id", Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve:     h.resolveMessage,
+			},
+			{
+				Name:        "profile",
+				Description: "The profile of phoneNumber, or null.",
+				Type:        profile,
+				Args:        []*graphql.Argument{{Name: "phoneNumber", Type: nonNullString}},
+				Resolve: func(ctx context.Context, _ any, args map[string]any) (any, error) {
+					phoneNumber := args["phoneNumber"].(string)
+					profiles, err := loaderFrom(ctx).profilesOf([]string{phoneNumber})
+					if err != nil {
+						return nil, err
+					}
+					return profiles[phoneNumber], nil
+				},
+			},
+			{
+				Name:        "stats",
+				Description: "What the message store holds, or null where it isn't reported.",
+				Type:        stats,
+				Resolve:     h.resolveStats,
+			},
+		},
+	}
+}
+
+// pageSize reads a first argument, capped at maxPageLimit.
+func pageSize(args map[string]any) (int, error) {
+	first, _ := args["first"].(int)
+	if first <= 0 {
+		return 0, errors.New("first must be a positive integer")
+	}
+	return min(first, maxPageLimit), nil
+}
+
+func (h *Handler) resolveConversations(_ context.Context, _ any, args map[string]any) (any, error) {
+	first, err := pageSize(args)
+	if err != nil {
+		return nil, err
+	}
+	var after string
+	if raw, ok := args["after"].(string); ok {
+		cursor, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		after = string(cursor)
+	}
+
+	phoneNumbers, err := h.conversationPhoneNumbers()
+	if err != nil {
+		return nil, errors.New("could not retrieve conversations")
+	}
+	if h.summaries != nil {
+		if phoneNumbers, _, err = h.withEmptyConversations(phoneNumbers); err != nil {
+			return nil, errors.New("could not retrieve empty conversations")
+		}
+	}
+	if state, ok := args["state"].(string); ok {
+		if h.summaries == nil {
+			return nil, errors.New("conversation summaries are not configured")
+		}
+		if phoneNumbers, err = h.filterByState(phoneNumbers, state); err != nil {
+			return nil, errors.New("could not retrieve conversation states")
+		}
+	}
+
+	sort.Strings(phoneNumbers)
+	page := graphQLConversationPage{TotalCount: len(phoneNumbers)}
+	start := sort.Search(len(phoneNumbers), func(i int) bool { return phoneNumbers[i] > after })
+	end := min(start+first, len(phoneNumbers))
+	page.Nodes = phoneNumbers[start:end]
+	if end < len(phoneNumbers) {
+		next := base64.RawURLEncoding.EncodeToString([]byte(phoneNumbers[end-1]))
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+func (h *Handler) resolveConversation(ctx context.Context, _ any, args map[string]any) (any, error) {
+	phoneNumber := args["phoneNumber"].(string)
+	summaries, err := loaderFrom(ctx).summariesOf([]string{phoneNumber})
+	if err != nil {
+		return nil, err
+	}
+	if summaries[phoneNumber] != nil {
+		return phoneNumber, nil
+	}
+	messages, err := h.store.FindByPhoneNumberPage(phoneNumber, store.PageQuery{Limit: 1})
+	if err != nil {
+		return nil, errors.New("could not retrieve messages")
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return phoneNumber, nil
+}
+
+func (h *Handler) resolveConversationMessages(_ context.Context, source any, args map[string]any) (any, error) {
+	first, err := pageSize(args)
+	if err != nil {
+		return nil, err
+	}
+	page := store.PageQuery{Limit: first + 1}
+	if raw, ok := args["before"].(string); ok {
+		if page.Before, page.BeforeID, err = decodeCursor(raw); err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+	messages, err := h.store.FindByPhoneNumberPage(source.(string), page)
+	if err != nil {
+		return nil, errors.New("could not retrieve messages")
+	}
+	resp := newMessagePage(messages, first)
+	out := graphQLMessagePage{Nodes: resp.Data}
+	if resp.Meta.HasMore {
+		out.NextCursor = &resp.Meta.NextCursor
+	}
+	return out, nil
+}
+
+func (h *Handler) resolveMessage(_ context.Context, _ any, args map[string]any) (any, error) {
+	msg, err := h.findMessage(args["id"].(string))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("could not retrieve message")
+	}
+	return msg, nil
+}
+
+func (h *Handler) resolveStats(_ context.Context, _ any, _ map[string]any) (any, error) {
+	if h.storeUsage == nil {
+		return nil, errors.New("store usage is not reported")
+	}
+	usage, err := h.storeUsage.Usage()
+	if err != nil {
+		return nil, errors.New("could not retrieve store usage")
+	}
+	return graphQLStats{Backend: usage.Backend, Messages: usage.Messages, Conversations: usage.Conversations}, nil
+}
+
+// optionalField resolves a string field of a T source, or null when it's
+// empty.
+func optionalField[T any](get func(T) string) graphql.ResolveFunc {
+	return func(_ context.Context, source any, _ map[string]any) (any, error) {
+		return optionalString(get(source.(T))), nil
+	}
+}
+
+// optionalString is s, or nil when it's empty.
+func optionalString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
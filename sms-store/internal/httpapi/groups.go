@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// SetConversationStore attaches the group conversation store.
+// Group endpoints answer 501 until one is set.
+func (h *Handler) SetConversationStore(cs store.ConversationStore) {
+	h.conversations = cs
+}
+
+// ListGroups lists group conversations, most recent message first.
+// GET /v1/groups?limit=
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	if h.conversations == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "group conversations are not configured")
+		return
+	}
+
+	limit := defaultPageLimit
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+
+	convs, err := h.conversations.ListConversations(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not list group conversations")
+		return
+	}
+	writeJSON(w, http.StatusOK, convs)
+}
+
+// GetGroup serves a group conversation, or its messages.
+// GET /v1/groups/{conversationId}
+// GET /v1/groups/{conversationId}/messages?limit=&cursor=
+//
+// Messages come newest first in the paginated envelope of
+// GET /v1/user/{phoneNumber}/messages, which is the default form here.
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	if h.conversations == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "group conversations are not configured")
+		return
+	}
+
+	id, messages := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/groups/"), "/messages")
+	id = strings.TrimSpace(id)
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "route not found")
+		return
+	}
+
+	conv, err := h.conversations.GetConversation(id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "group conversation not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve group conversation")
+		return
+	}
+	if !messages {
+		writeJSON(w, http.StatusOK, conv)
+		return
+	}
+
+	page, err := parsePageQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	limit := page.Limit
+	page.Limit = limit + 1
+	msgs, err := h.store.FindByConversationPage(conv.ID, page)
+	if err != nil {
+		writeStoreError(w, err, "retrieve messages")
+		return
+	}
+
+	resp := newMessagePage(withIngestion(r, msgs), limit)
+	if h.isCacheablePage(page, resp.Data) {
+		writeCacheableJSON(w, r, resp)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// withGroups appends every group conversation to convs.
+func (h *Handler) withGroups(convs []conversationWithPreferences) ([]conversationWithPreferences, error) {
+	groups, err := h.conversations.ListConversations(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		convs = append(convs, conversationWithPreferences{
+			Type:           models.ConversationGroup,
+			ConversationID: g.ID,
+			Participants:   g.Participants,
+			LastMessageAt:  &g.LastMessageAt,
+		})
+	}
+	return convs, nil
+}
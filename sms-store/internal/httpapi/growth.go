@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"sms-store/internal/growth"
+)
+
+type growthResponse struct {
+	Collection      string         `json:"collection"`
+	Interval        string         `json:"interval"`
+	Threshold       float64        `json:"threshold"` // As a fraction; 0 never alerts
+	MinStorageBytes int64          `json:"minStorageBytes"`
+	Status          growth.Status  `json:"status"`
+	Samples         []growth.Point `json:"samples"` // Oldest first
+}
+
+// SetGrowthMonitor attaches the monitor of the messages collection's size
+// and reports it on /healthz as the "growth" component, degraded while its
+// growth in a day is past the threshold. Growth only warns; it never fails
+// the check. It must be called before the server starts handling requests.
+func (h *Handler) SetGrowthMonitor(m *growth.Monitor) {
+	h.growth = m
+	h.RegisterHealthCheck("growth", func() ComponentHealth {
+		status := m.Status()
+		if !status.Fast {
+			return ComponentHealth{Status: HealthUp}
+		}
+		return ComponentHealth{Status: HealthDegraded, Message: m.Summary(*status.Latest), Details: status}
+	})
+}
+
+// GetGrowth reports the sampled sizes of the messages collection, oldest
+// first, each with its growth since the sample a day before, and the
+// threshold past which growth alerts. Requires the admin scope.
+// GET /v1/admin/growth
+func (h *Handler) GetGrowth(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.growth == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "growth monitor is not configured")
+		return
+	}
+
+	samples, err := h.growth.Series()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not read growth history")
+		return
+	}
+	config := h.growth.Config()
+	writeJSON(w, http.StatusOK, growthResponse{
+		Collection:      config.Collection,
+		Interval:        config.Interval.String(),
+		Threshold:       config.Threshold,
+		MinStorageBytes: config.MinStorageBytes,
+		Status:          h.growth.Status(),
+		Samples:         samples,
+	})
+}
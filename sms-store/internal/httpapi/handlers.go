@@ -2,23 +2,164 @@ package httpapi
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
+	"sms-store/internal/autoack"
+	"sms-store/internal/clock"
+	"sms-store/internal/exports"
+	"sms-store/internal/graphql"
+	"sms-store/internal/growth"
+	"sms-store/internal/i18n"
+	"sms-store/internal/jobs"
+	"sms-store/internal/kafka"
+	"sms-store/internal/migrate"
 	"sms-store/internal/models"
+	"sms-store/internal/pricing"
+	"sms-store/internal/scheduler"
+	"sms-store/internal/search"
 	"sms-store/internal/store"
+	"sms-store/internal/watchdog"
 )
 
 type Handler struct {
 	store        store.Store
 	profileStore store.ProfileStore
+	config       HandlerConfig
+
+	analytics         store.Store        // Nil unless analytics read elsewhere
+	analyticsProfiles store.ProfileStore // Nil unless profile searches read elsewhere
+
+	preferenceStore  store.PreferenceStore
+	readCursors      store.ReadCursorStore
+	tombstoneStore   store.TombstoneStore
+	conversations    store.ConversationStore
+	tokenizer        *search.Tokenizer
+	pricer           *pricing.Pricer
+	exports          *exports.Artifacts
+	exportLinks      *exports.LinkSigner
+	shares           store.ShareStore
+	archiver         store.Archiver
+	querier          store.MessageQuerier
+	summaries        store.SummaryStore
+	attributeSchemas store.AttributeSchemaStore
+	autoAcks         store.AutoAckStore
+	autoAckTemplates *autoack.Templates
+	profileHistory   *store.ProfileHistoryRecorder
+	rawEvents        store.RawEventStore
+	storeLatency     *store.InstrumentedStore
+	storeUsage       store.UsageReporter
+	migrator         *migrate.Migrator
+	migrationS3      *migrate.S3Config // Credentials of s3:// migration sources; nil refuses them
+	quotas           *store.QuotaEnforcingStore
+	lifecycle        *store.ConversationLifecycle
+	audit            store.AuditStore
+	deletionReceipts store.DeletionReceiptStore
+	snapshots        store.SnapshotStore
+	autoProfiles     store.AutoProfileLister // Nil unless stale auto-created profiles are cleaned up
+	kafka            *kafka.Supervisor
+	watchdog         *watchdog.Watchdog
+	growth           *growth.Monitor
+	healthChecks     []namedHealthCheck
+	jobs             *jobs.Manager
+	scheduler        *scheduler.Scheduler
+	warmUp           *warmUp
+	graphQL          *graphql.Schema // Built on first use, by graphQLOnce
+	graphQLOnce      sync.Once
+	totals           *countCache // Totals of ?includeTotal=true pages
+
+	clock.Clocked // Tells the time of timestamps, expiry and retention
+}
+
+// HandlerConfig holds tunables for the HTTP handlers.
+type HandlerConfig struct {
+	MessageCacheThreshold time.Duration    // Message pages whose newest item is older than this are cacheable
+	AdminAPIKey           string           // Bearer token granting admin scope (empty disables admin operations)
+	APIKeys               map[string]Scope // Further bearer tokens and the scope each grants
+	AnonymousScope        Scope            // Scope of requests without a known bearer token; ScopeNone unless a deployment opts in
+	DeleteBatchSize       int              // Messages removed per batch by the batched delete-all
+	DeleteAllWait         time.Duration    // How long DELETE /messages waits for its job before answering 202
+	ListMessagesLimit     int              // Most messages GET /messages returns without the admin scope
+	ListMessagesMaxLimit  int              // Most messages GET /messages returns even with the admin scope
+	StrictJSON            StrictJSON       // Routes whose JSON bodies must not contain unknown fields
+	ArchiveAfter          time.Duration    // Default age past which messages are archived
+	ArchiveBatchSize      int              // Messages moved per archive batch
+	ThreadMaxDepth        int              // Most ancestors GET /messages/{id}/thread returns
+	ExportLinkTTL         time.Duration    // How long a signed export link stays valid
+	ShareLinkTTL          time.Duration    // How long a conversation share link lasts unless ?expiresIn= says otherwise
+	ShareLinkMaxTTL       time.Duration    // Longest ?expiresIn= a share link may be created with (0 for no limit)
+	MigrationDir          string           // Directory migration source paths are resolved in (empty disables migration)
+	MigrationParallelism  int              // Default files a migration reads at once
+	MigrationBatchSize    int              // Default messages per migration batch write
+
+	ProfileEnrichmentTimeout time.Duration // Longest wait for profiles decorating a response before serving without them
+	EmptyConversationTTL     time.Duration // How long a conversation opened without messages is kept (0 keeps it)
+	MaxFutureSkew            time.Duration // How far past the server's clock a message's createdAt may be (0 accepts any)
+	ForwardPrefix            string        // Put before the text of forwarded messages
+	TombstoneWindow          time.Duration // How long deleted conversations keep their tombstone, and so how old a change feed cursor may be
+	SeedingEnabled           bool          // Allows generating and removing demo data with /v1/admin/seed
+	ExportQueryMaxRows       int           // Most messages one POST /v1/admin/export/query export holds (0 for no limit)
+	ExportBatchSize          int           // Documents per MongoDB cursor batch of export and transcript reads (0 keeps the store's)
+	SnapshotTTL              time.Duration // How long a conversation snapshot is kept
+	SnapshotMaxEntries       int           // Most messages a snapshot keeps the hashes of before rolling them up (0 for no limit)
+	GraphQLMaxDepth          int           // How deeply /graphql queries may nest fields (0 for no limit)
+	GraphQLMaxComplexity     int           // Most a /graphql query may cost, each field counting once per item of the pages above it (0 for no limit)
+	GraphQLIntrospection     bool          // Answers __schema and __type queries on /graphql; keep off in production
+	ProfileCleanupAfter      time.Duration // Default time without messages after which auto-created profiles are cleaned up
+	ProfileCleanupBatchSize  int           // Profiles checked per profile cleanup batch
+	PageCountCacheTTL        time.Duration // How long the total of a ?includeTotal=true page is reused for the same filter (0 counts every page)
+}
+
+// DefaultHandlerConfig returns default configuration values.
+func DefaultHandlerConfig() HandlerConfig {
+	return HandlerConfig{
+		MessageCacheThreshold: 24 * time.Hour,
+		AnonymousScope:        ScopeNone,
+		DeleteBatchSize:       5000,
+		DeleteAllWait:         2 * time.Second,
+		ListMessagesLimit:     1000,
+		ListMessagesMaxLimit:  10000,
+		StrictJSON:            StrictJSONV1,
+		ArchiveAfter:          90 * 24 * time.Hour,
+		ArchiveBatchSize:      1000,
+		ThreadMaxDepth:        50,
+		ExportLinkTTL:         24 * time.Hour,
+		ShareLinkTTL:          7 * 24 * time.Hour,
+		ShareLinkMaxTTL:       30 * 24 * time.Hour,
+		MigrationParallelism:  4,
+		MigrationBatchSize:    1000,
+
+		ProfileEnrichmentTimeout: 200 * time.Millisecond,
+		EmptyConversationTTL:     24 * time.Hour,
+		MaxFutureSkew:            models.DefaultMaxFutureSkew,
+		ForwardPrefix:            "Fwd: ",
+		TombstoneWindow:          24 * time.Hour,
+		ExportQueryMaxRows:       100000,
+		ExportBatchSize:          100,
+		SnapshotTTL:              7 * 24 * time.Hour,
+		SnapshotMaxEntries:       10000,
+		GraphQLMaxDepth:          8,
+		GraphQLMaxComplexity:     5000,
+		ProfileCleanupAfter:      365 * 24 * time.Hour,
+		ProfileCleanupBatchSize:  500,
+		PageCountCacheTTL:        30 * time.Second,
+	}
 }
 
 func NewHandler(s store.Store, ps store.ProfileStore) *Handler {
+	return NewHandlerWithConfig(s, ps, DefaultHandlerConfig())
+}
+
+// NewHandlerWithConfig creates a handler with custom configuration.
+func NewHandlerWithConfig(s store.Store, ps store.ProfileStore, config HandlerConfig) *Handler {
 	return &Handler{
 		store:        s,
 		profileStore: ps,
+		config:       config,
+		jobs:         jobs.NewManager(jobs.NewMemoryRepository()),
+		totals:       newCountCache(),
 	}
 }
 
@@ -27,286 +168,59 @@ func NewHandler(s store.Store, ps store.ProfileStore) *Handler {
 type errorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
 }
 
+// writeJSON encodes payload before touching the response, so an encode failure
+// can still be answered with a 500 instead of a truncated body. Write failures
+// are logged and counted, with client disconnects kept apart from real errors.
 func writeJSON(w http.ResponseWriter, status int, payload any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(payload)
-}
-
-func writeError(w http.ResponseWriter, status int, code string, message string) {
-	writeJSON(w, status, errorResponse{Code: code, Message: message})
-}
-
-/* ---------- handlers ---------- */
-
-func (h *Handler) Ping(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]string{"status": "UP"})
-}
-
-type createMessageRequest struct {
-	PhoneNumber string `json:"phoneNumber"`
-	Text        string `json:"text"`
-}
-
-func (h *Handler) CreateMessage(w http.ResponseWriter, r *http.Request) {
-	var req createMessageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid JSON body")
-		return
-	}
-
-	req.PhoneNumber = strings.TrimSpace(req.PhoneNumber)
-	req.Text = strings.TrimSpace(req.Text)
-
-	if req.PhoneNumber == "" {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "phoneNumber is required")
-		return
-	}
-	if req.Text == "" {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "text is required")
-		return
-	}
-
-	msg := models.Message{
-		ID:          "msg-" + time.Now().Format("20060102150405.000000000"),
-		PhoneNumber: req.PhoneNumber,
-		Text:        req.Text,
-		Status:      "RECEIVED",
-		CreatedAt:   time.Now(),
-	}
-
-	saved, err := h.store.Save(msg)
+	body, err := json.Marshal(payload)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not save message")
-		return
-	}
-
-	writeJSON(w, http.StatusCreated, saved)
-}
-
-func (h *Handler) ListMessages(w http.ResponseWriter, r *http.Request) {
-	list, err := h.store.List()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not list messages")
-		return
-	}
-
-	writeJSON(w, http.StatusOK, list)
-}
-
-func (h *Handler) GetUserMessages(w http.ResponseWriter, r *http.Request) {
-	// Extract phoneNumber from URL path: /v1/user/{phoneNumber}/messages
-	// Path will be like: /v1/user/1234567890/messages
-	path := r.URL.Path
-
-	// Validate path format: /v1/user/{phoneNumber}/messages
-	prefix := "/v1/user/"
-	suffix := "/messages"
-
-	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid URL path")
-		return
-	}
-
-	// Extract phoneNumber: remove prefix and suffix
-	phoneNumber := strings.TrimPrefix(path, prefix)
-	phoneNumber = strings.TrimSuffix(phoneNumber, suffix)
-	phoneNumber = strings.TrimSpace(phoneNumber)
-
-	// Validate phoneNumber is not empty and doesn't contain slashes (to prevent path traversal)
-	if phoneNumber == "" || strings.Contains(phoneNumber, "/") {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
-		return
+		route, requestID, wroteHeader, _ := responseInfo(w)
+		responseEncodeErrors.WithLabelValues(route).Inc()
+		log.Printf("Failed to encode JSON response (route=%s request_id=%s): %v", route, requestID, err)
+		if wroteHeader {
+			return
+		}
+		status = http.StatusInternalServerError
+		body = []byte(`{"code":"INTERNAL","message":"could not encode response"}`)
 	}
-
-	messages, err := h.store.FindByPhoneNumber(phoneNumber)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve messages")
-		return
+	if _, _, _, req := responseInfo(w); req != nil {
+		body = transcodeResponse(body, requestedCase(req))
 	}
 
-	// Return empty array if no messages found (not an error)
-	writeJSON(w, http.StatusOK, messages)
-}
-
-func (h *Handler) DeleteAllMessages(w http.ResponseWriter, r *http.Request) {
-	deletedCount, err := h.store.DeleteAll()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not delete messages")
-		return
-	}
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"message":      "All messages deleted successfully",
-		"deletedCount": deletedCount,
-	})
-}
-
-// GetConversations retrieves all distinct phone numbers (conversations) from the store.
-func (h *Handler) GetConversations(w http.ResponseWriter, r *http.Request) {
-	phoneNumbers, err := h.store.GetDistinctPhoneNumbers()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversations")
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		recordWriteError(w, err)
 	}
-
-	// Return empty array if no conversations found (not an error)
-	writeJSON(w, http.StatusOK, phoneNumbers)
 }
 
-// DeleteUserMessages deletes all messages for a specific phone number.
-// DELETE /v1/user/{phoneNumber}/messages
-func (h *Handler) DeleteUserMessages(w http.ResponseWriter, r *http.Request) {
-	// Extract phoneNumber from URL path: /v1/user/{phoneNumber}/messages
-	path := r.URL.Path
-
-	// Validate path format: /v1/user/{phoneNumber}/messages
-	prefix := "/v1/user/"
-	suffix := "/messages"
-
-	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid URL path")
-		return
-	}
-
-	// Extract phoneNumber: remove prefix and suffix
-	phoneNumber := strings.TrimPrefix(path, prefix)
-	phoneNumber = strings.TrimSuffix(phoneNumber, suffix)
-	phoneNumber = strings.TrimSpace(phoneNumber)
-
-	// Validate phoneNumber is not empty and doesn't contain slashes (to prevent path traversal)
-	if phoneNumber == "" || strings.Contains(phoneNumber, "/") {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
-		return
-	}
-
-	deletedCount, err := h.store.DeleteByPhoneNumber(phoneNumber)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not delete messages")
-		return
-	}
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"message":      "Messages deleted successfully",
-		"deletedCount": deletedCount,
-		"phoneNumber":  phoneNumber,
-	})
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, errorResponse{Code: code, Message: localize(w, message)})
 }
 
-// GetProfile retrieves a profile by phone number.
-// GET /v1/profile/{phoneNumber}
-func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
-	// Extract phoneNumber from URL path: /v1/profile/{phoneNumber}
-	path := r.URL.Path
-	prefix := "/v1/profile/"
-
-	if !strings.HasPrefix(path, prefix) {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid URL path")
-		return
-	}
-
-	phoneNumber := strings.TrimPrefix(path, prefix)
-	phoneNumber = strings.TrimSpace(phoneNumber)
-
-	// Validate phoneNumber is not empty and doesn't contain slashes (to prevent path traversal)
-	if phoneNumber == "" || strings.Contains(phoneNumber, "/") {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
-		return
-	}
-
-	profile, err := h.profileStore.GetProfile(phoneNumber)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
-			return
-		}
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve profile")
-		return
-	}
-
-	writeJSON(w, http.StatusOK, profile)
+func writeErrorDetails(w http.ResponseWriter, status int, code string, message string, details any) {
+	writeJSON(w, status, errorResponse{Code: code, Message: localize(w, message), Details: details})
 }
 
-// UpdateProfile updates an existing profile.
-// PUT /v1/profile/{phoneNumber}
-func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
-	// Extract phoneNumber from URL path: /v1/profile/{phoneNumber}
-	path := r.URL.Path
-	prefix := "/v1/profile/"
-
-	if !strings.HasPrefix(path, prefix) {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid URL path")
-		return
+// localize translates an error message, written in English, to the language
+// the request's Accept-Language prefers. The code is never translated, so
+// clients should match on it rather than on the message.
+func localize(w http.ResponseWriter, message string) string {
+	lang := i18n.DefaultLanguage
+	if _, _, _, req := responseInfo(w); req != nil {
+		lang = i18n.Default.Negotiate(req.Header.Get("Accept-Language"))
 	}
-
-	phoneNumber := strings.TrimPrefix(path, prefix)
-	phoneNumber = strings.TrimSpace(phoneNumber)
-
-	// Validate phoneNumber is not empty and doesn't contain slashes (to prevent path traversal)
-	if phoneNumber == "" || strings.Contains(phoneNumber, "/") {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
-		return
-	}
-
-	var req models.Profile
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid JSON body")
-		return
-	}
-
-	// Trim and validate fields
-	req.Name = strings.TrimSpace(req.Name)
-	req.Avatar = strings.TrimSpace(req.Avatar)
-
-	// Update the profile
-	updated, err := h.profileStore.UpdateProfile(phoneNumber, req)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
-			return
-		}
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not update profile")
-		return
-	}
-
-	writeJSON(w, http.StatusOK, updated)
+	message, lang = i18n.Default.Translate(message, lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", lang)
+	return message
 }
 
-// CreateProfile creates a new profile.
-// POST /v1/profile
-func (h *Handler) CreateProfile(w http.ResponseWriter, r *http.Request) {
-	var req models.Profile
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid JSON body")
-		return
-	}
-
-	req.PhoneNumber = strings.TrimSpace(req.PhoneNumber)
-	req.Name = strings.TrimSpace(req.Name)
-	req.Avatar = strings.TrimSpace(req.Avatar)
-
-	if req.PhoneNumber == "" {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "phoneNumber is required")
-		return
-	}
-
-	// Validate phoneNumber doesn't contain slashes (to prevent path traversal)
-	if strings.Contains(req.PhoneNumber, "/") {
-		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
-		return
-	}
-
-	created, err := h.profileStore.CreateProfile(req)
-	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			writeError(w, http.StatusConflict, "CONFLICT", err.Error())
-			return
-		}
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not create profile")
-		return
-	}
+/* ---------- handlers ---------- */
 
-	writeJSON(w, http.StatusCreated, created)
+func (h *Handler) Ping(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "UP"})
 }
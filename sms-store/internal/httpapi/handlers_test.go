@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+)
+
+// failingWriter accepts headers but fails every write with err.
+type failingWriter struct {
+	header http.Header
+	status int
+	err    error
+}
+
+func (w *failingWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *failingWriter) WriteHeader(status int) { w.status = status }
+
+func (w *failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestWriteJSONCountsFailedWrites(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		err          error
+		writes       uint64
+		clientAborts uint64
+	}{
+		{"Error", errors.New("disk on fire"), 1, 0},
+		{"BrokenPipe", fmt.Errorf("write: %w", syscall.EPIPE), 0, 1},
+		{"ConnectionReset", syscall.ECONNRESET, 0, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			route := "/test/write-json/" + tc.name
+			mux := http.NewServeMux()
+			mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+			})
+			writes, aborts := responseWriteErrors.WithLabelValues(route).Value(), responseClientAborts.WithLabelValues(route).Value()
+
+			w := &failingWriter{err: tc.err}
+			RequestContext(mux).ServeHTTP(w, httptest.NewRequest(http.MethodGet, route, nil))
+
+			if w.status != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("status %d with headers %v, want 200 JSON", w.status, w.Header())
+			}
+			if got := responseWriteErrors.WithLabelValues(route).Value() - writes; got != tc.writes {
+				t.Errorf("write errors counted %d, want %d", got, tc.writes)
+			}
+			if got := responseClientAborts.WithLabelValues(route).Value() - aborts; got != tc.clientAborts {
+				t.Errorf("client aborts counted %d, want %d", got, tc.clientAborts)
+			}
+		})
+	}
+}
+
+func TestWriteJSONAnswers500WhenEncodingFails(t *testing.T) {
+	route := "/test/write-json/encode"
+	mux := http.NewServeMux()
+	mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"feed": make(chan int)})
+	})
+	before := responseEncodeErrors.WithLabelValues(route).Value()
+
+	w := httptest.NewRecorder()
+	RequestContext(mux).ServeHTTP(w, httptest.NewRequest(http.MethodGet, route, nil))
+
+	if w.Code != http.StatusInternalServerError || w.Body.String() != `{"code":"INTERNAL","message":"could not encode response"}`+"\n" {
+		t.Fatalf("answered %d %q, want the 500 envelope", w.Code, w.Body.String())
+	}
+	if got := responseEncodeErrors.WithLabelValues(route).Value() - before; got != 1 {
+		t.Fatalf("encode errors counted %d, want 1", got)
+	}
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"sms-store/internal/version"
+)
+
+// Component health statuses reported by /healthz.
+const (
+	HealthUp         = "up"
+	HealthConnecting = "connecting"
+	HealthDegraded   = "degraded" // Working, but something needs looking at
+	HealthFailed     = "failed"
+)
+
+// ComponentHealth is the health of one dependency.
+type ComponentHealth struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// HealthCheck reports the current health of a dependency.
+type HealthCheck func() ComponentHealth
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// RegisterHealthCheck adds a dependency to the /healthz report.
+// It must be called before the server starts handling requests.
+func (h *Handler) RegisterHealthCheck(name string, check HealthCheck) {
+	h.healthChecks = append(h.healthChecks, namedHealthCheck{name: name, check: check})
+}
+
+type healthResponse struct {
+	Status     string                     `json:"status"`
+	Version    version.Info               `json:"version"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// Healthz reports the health of every registered dependency.
+// GET /healthz
+//
+// The service is "UP" when all components are up and "DEGRADED" while any
+// component is still connecting; it keeps answering 200 because the read API
+// still works. A component that failed permanently turns the response into
+// 503 "DOWN" so orchestrators can restart the instance.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{Status: "UP", Version: version.Get(), Components: make(map[string]ComponentHealth, len(h.healthChecks))}
+	status := http.StatusOK
+
+	for _, c := range h.healthChecks {
+		health := c.check()
+		resp.Components[c.name] = health
+
+		switch health.Status {
+		case HealthUp:
+		case HealthFailed:
+			resp.Status = "DOWN"
+			status = http.StatusServiceUnavailable
+		default:
+			if resp.Status == "UP" {
+				resp.Status = "DEGRADED"
+			}
+		}
+	}
+
+	writeJSON(w, status, resp)
+}
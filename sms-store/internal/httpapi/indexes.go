@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"context"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/store"
+)
+
+const buildIndexesJobType = "build_indexes"
+
+// indexBuildProgress is how far the index build got, as /healthz reports it.
+type indexBuildProgress struct {
+	JobID    string  `json:"jobId"`
+	Status   string  `json:"status"`
+	Progress float64 `json:"progress"`
+}
+
+// StartIndexBuild builds the query indexes b lacks in a background job, and
+// reports them on /healthz as the "indexes" component, connecting until
+// they are ready: the service is DEGRADED meanwhile, answering queries
+// without the indexes. A failed build is retried on the next start. It must
+// be called before the server starts handling requests.
+func (h *Handler) StartIndexBuild(b store.IndexBuilder) (jobs.Job, error) {
+	job, err := h.jobs.Submit(buildIndexesJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		var reported int64
+		err := b.BuildIndexes(ctx, func(done, total int64) {
+			p.SetTotal(total)
+			p.Add(done - reported)
+			reported = done
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"documents": reported}, nil
+	})
+	if err != nil {
+		return job, err
+	}
+
+	h.RegisterHealthCheck("indexes", func() ComponentHealth {
+		if b.IndexesReady() {
+			return ComponentHealth{Status: HealthUp}
+		}
+		current, err := h.jobs.Get(job.ID)
+		if err != nil {
+			return ComponentHealth{Status: HealthConnecting, Message: "building query indexes"}
+		}
+		details := indexBuildProgress{JobID: current.ID, Status: current.Status, Progress: current.Progress}
+		if current.Status == jobs.StatusFailed || current.Status == jobs.StatusCancelled {
+			return ComponentHealth{Status: HealthConnecting, Message: "query index build " + current.Status + "; queries run without the indexes", Details: details}
+		}
+		return ComponentHealth{Status: HealthConnecting, Message: "building query indexes", Details: details}
+	})
+	return job, nil
+}
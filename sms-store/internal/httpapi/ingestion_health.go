@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"sms-store/internal/watchdog"
+)
+
+// SetIngestionWatchdog attaches the watchdog of ingestion sources, tells it
+// of messages created through the API, and reports it on /healthz as the
+// "ingestion" component, degraded while any watched source is quiet. It
+// must be called before the server starts handling requests.
+func (h *Handler) SetIngestionWatchdog(w *watchdog.Watchdog) {
+	h.watchdog = w
+	h.RegisterHealthCheck("ingestion", func() ComponentHealth {
+		quiet := w.Quiet()
+		if len(quiet) == 0 {
+			return ComponentHealth{Status: HealthUp}
+		}
+		names := make([]string, len(quiet))
+		for i, s := range quiet {
+			names[i] = s.Source
+		}
+		return ComponentHealth{Status: HealthDegraded, Message: "no messages stored recently from " + strings.Join(names, ", "), Details: quiet}
+	})
+}
+
+// GetIngestionHealth reports when each ingestion source last stored a
+// message, how long it has been quiet and whether that is past its
+// threshold. Requires the admin scope.
+// GET /v1/admin/ingestion/health
+func (h *Handler) GetIngestionHealth(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.watchdog == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "ingestion watchdog is not configured")
+		return
+	}
+
+	now := h.watchdog.Clock().Now()
+	hours := h.watchdog.Hours()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"expectedHours": hours.String(),
+		"withinHours":   hours.Within(now),
+		"sources":       h.watchdog.Sources(),
+	})
+}
@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// GetIngestionLatency summarizes how long recently stored Kafka messages
+// took from the broker to the consumer and from the consumer to the store.
+// Requires the admin scope.
+// GET /v1/admin/ingestion/latency?window=5m
+func (h *Handler) GetIngestionLatency(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	consumer, ok := h.kafkaConsumer(w)
+	if !ok {
+		return
+	}
+
+	window := defaultLatencyWindow
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > maxLatencyWindow {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "window must be a duration between 0 and "+maxLatencyWindow.String())
+			return
+		}
+		window = d
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"window": window.String(),
+		"stages": consumer.IngestionLatency(window),
+	})
+}
+
+// withIngestion returns messages with their ingestion times, for
+// ?includeIngestion=true, or else without them: most clients only need
+// createdAt and receivedAt.
+func withIngestion(r *http.Request, messages []models.Message) []models.Message {
+	if r.URL.Query().Get("includeIngestion") == "true" {
+		return messages
+	}
+	if !slices.ContainsFunc(messages, func(msg models.Message) bool { return msg.Ingestion != nil }) {
+		return messages
+	}
+	stripped := slices.Clone(messages)
+	for i := range stripped {
+		stripped[i].Ingestion = nil
+	}
+	return stripped
+}
@@ -0,0 +1,185 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// maxAuditLimit is the most entries GET /v1/admin/audit returns at once.
+const maxAuditLimit = 1000
+
+// SetConversationLifecycle attaches the conversation states. Until it is
+// set, close, reopen and snooze answer 501.
+func (h *Handler) SetConversationLifecycle(l *store.ConversationLifecycle) {
+	h.lifecycle = l
+}
+
+// SetAuditStore attaches the audit log read by GET /v1/admin/audit.
+func (h *Handler) SetAuditStore(as store.AuditStore) {
+	h.audit = as
+}
+
+// conversationStateResponse is a conversation's lifecycle state.
+type conversationStateResponse struct {
+	PhoneNumber    string     `json:"phoneNumber"`
+	State          string     `json:"state"`
+	SnoozedUntil   *time.Time `json:"snoozedUntil,omitempty"`
+	StateChangedAt *time.Time `json:"stateChangedAt,omitempty"`
+}
+
+// CloseConversation closes a resolved conversation. The next inbound
+// message reopens it.
+// POST /v1/user/{phoneNumber}/close
+func (h *Handler) CloseConversation(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "/close", models.ConversationClosed, nil)
+}
+
+// ReopenConversation opens a closed or snoozed conversation again.
+// POST /v1/user/{phoneNumber}/reopen
+func (h *Handler) ReopenConversation(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "/reopen", models.ConversationOpen, nil)
+}
+
+// SnoozeConversation sets an open conversation aside until ?until=, an RFC
+// 3339 time in the future, when it is open again; snoozing a snoozed one
+// moves its snooze. An inbound message ends the snooze early.
+// POST /v1/user/{phoneNumber}/snooze?until=
+func (h *Handler) SnoozeConversation(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimSpace(r.URL.Query().Get("until"))
+	if raw == "" {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "until is required")
+		return
+	}
+	until, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "until must be an RFC 3339 time")
+		return
+	}
+	if !until.After(h.Clock().Now()) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "until must be in the future")
+		return
+	}
+	h.transition(w, r, "/snooze", models.ConversationSnoozed, &until)
+}
+
+// transition moves the conversation of the path ending in suffix to state.
+// A change its current state doesn't allow answers 422 with both states.
+func (h *Handler) transition(w http.ResponseWriter, r *http.Request, suffix, state string, until *time.Time) {
+	if h.lifecycle == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation states are not configured")
+		return
+	}
+
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, suffix)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	info := h.requestInfo(w, r)
+	summary, err := h.lifecycle.Transition(phoneNumber, state, until, info.AccountID, info.ClientIP)
+	var invalid *store.TransitionError
+	switch {
+	case errors.As(err, &invalid):
+		writeErrorDetails(w, http.StatusUnprocessableEntity, "INVALID_TRANSITION", "conversation is "+invalid.From+" and can't become "+invalid.To, invalid)
+		return
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "conversation not found")
+		return
+	case err != nil:
+		writeStoreError(w, err, "change conversation state")
+		return
+	}
+
+	summary = summary.Current(h.Clock().Now())
+	writeJSON(w, http.StatusOK, conversationStateResponse{
+		PhoneNumber:    phoneNumber,
+		State:          summary.State,
+		SnoozedUntil:   summary.SnoozedUntil,
+		StateChangedAt: summary.StateChangedAt,
+	})
+}
+
+// filterByState keeps the direct conversations among phoneNumbers in state,
+// as of now. Conversations without a summary are open.
+func (h *Handler) filterByState(phoneNumbers []string, state string) ([]string, error) {
+	summaries, err := h.summaries.GetSummaries(phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	now := h.Clock().Now()
+	kept := make([]string, 0, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		current := models.ConversationOpen
+		if s, ok := summaries[pn]; ok {
+			current = s.EffectiveState(now)
+		}
+		if current == state {
+			kept = append(kept, pn)
+		}
+	}
+	return kept, nil
+}
+
+// filterByConversationLanguage keeps the direct conversations among
+// phoneNumbers whose dominant language matches the language tag.
+// Conversations without a summary, or without a language, match none.
+func (h *Handler) filterByConversationLanguage(phoneNumbers []string, tag string) ([]string, error) {
+	summaries, err := h.summaries.GetSummaries(phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		if s, ok := summaries[pn]; ok && s.Language != "" && models.LanguageMatches(s.Language, tag) {
+			kept = append(kept, pn)
+		}
+	}
+	return kept, nil
+}
+
+// validState reports whether state names a conversation lifecycle state.
+func validState(state string) bool {
+	switch state {
+	case models.ConversationOpen, models.ConversationClosed, models.ConversationSnoozed:
+		return true
+	}
+	return false
+}
+
+// ListAudit returns the newest audit entries, optionally only those of one
+// ?phoneNumber=, at most ?limit= (default 100). Requires the admin scope.
+// GET /v1/admin/audit
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.audit == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "the audit log is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	q := store.AuditQuery{PhoneNumber: strings.TrimSpace(query.Get("phoneNumber"))}
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	entries, err := h.audit.ListAudit(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": entries})
+}
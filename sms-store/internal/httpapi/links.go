@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/url"
+
+	"sms-store/internal/models"
+)
+
+// messageResponse is a message as GET /messages/{id} and POST /messages
+// answer it, with the URL it can be fetched again at.
+type messageResponse struct {
+	models.Message
+	Self          string `json:"self"`
+	ForwardedFrom string `json:"forwardedFrom,omitempty"` // URL of the message this one forwards
+}
+
+// profileResponse is a profile as the /v1/profile endpoints answer it, with
+// the URL it can be fetched again at.
+type profileResponse struct {
+	models.Profile
+	Self string `json:"self"`
+}
+
+// messageURL returns the path of GET /messages/{id}.
+func messageURL(id string) string {
+	return "/messages/" + url.PathEscape(id)
+}
+
+// profileURL returns the path of GET /v1/profile/{phoneNumber}.
+func profileURL(phoneNumber string) string {
+	return "/v1/profile/" + url.PathEscape(phoneNumber)
+}
+
+// conversationURL returns the path of GET /v1/user/{phoneNumber}/messages,
+// where a direct conversation's messages are read.
+func conversationURL(phoneNumber string) string {
+	return "/v1/user/" + url.PathEscape(phoneNumber) + "/messages"
+}
+
+func newMessageResponse(msg models.Message) messageResponse {
+	resp := messageResponse{Message: msg, Self: messageURL(msg.ID)}
+	if msg.ForwardedFromID != "" {
+		resp.ForwardedFrom = messageURL(msg.ForwardedFromID)
+	}
+	return resp
+}
+
+func newProfileResponse(profile models.Profile) profileResponse {
+	return profileResponse{Profile: profile, Self: profileURL(profile.PhoneNumber)}
+}
+
+// writeCreated answers 201 with v, and a Location header pointing at self,
+// the URL the new resource can be fetched at.
+func writeCreated(w http.ResponseWriter, self string, v any) {
+	w.Header().Set("Location", self)
+	writeJSON(w, http.StatusCreated, v)
+}
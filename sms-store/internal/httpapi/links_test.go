@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestCreatedLocationsResolve(t *testing.T) {
+	mem := store.NewMemoryStore()
+	summaries := store.NewMemorySummaryStore(mem)
+	if _, err := mem.Save(models.Message{ID: "m1", PhoneNumber: "9876543210", Text: "hello", Status: "SUCCESS", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(store.NewSummarizingStore(mem, summaries), store.NewMemoryProfileStore())
+	h.SetSummaryStore(summaries)
+	// As main.go serves it
+	routes := RequestContext(h.Routes())
+
+	for _, tc := range []struct {
+		name, path, body string
+		field            string // Compared between the 201 and the GET of its Location
+	}{
+		{"Message", "/messages", `{"phoneNumber": "+919876543210", "text": "hello"}`, "id"},
+		{"ForwardedMessage", "/messages/m1/forward", `{"to": "+918765432109"}`, "id"},
+		{"Profile", "/v1/profile", `{"phoneNumber": "+919876543210", "name": "Ram"}`, "phoneNumber"},
+		{"Conversation", "/v1/conversations", `{"phoneNumber": "+917654321098"}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+			var created map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+				t.Fatalf("POST %s = %d %s", tc.path, w.Code, w.Body.String())
+			}
+			loc := w.Header().Get("Location")
+			if loc == "" || created["self"] != loc {
+				t.Fatalf("Location %q, self %v; want them equal", loc, created["self"])
+			}
+
+			w = httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, loc, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d %s, want the created resource", loc, w.Code, w.Body.String())
+			}
+			if tc.field == "" {
+				return
+			}
+			var fetched map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &fetched); err != nil {
+				t.Fatalf("decoding %s: %v", w.Body.String(), err)
+			}
+			if fetched[tc.field] != created[tc.field] || fetched["self"] != loc {
+				t.Fatalf("GET %s = %s, want the resource created as %s", loc, w.Body.String(), created[tc.field])
+			}
+		})
+	}
+}
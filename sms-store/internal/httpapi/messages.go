@@ -0,0 +1,630 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+	"sms-store/internal/watchdog"
+)
+
+type createMessageRequest struct {
+	PhoneNumber  string               `json:"phoneNumber"`
+	Text         string               `json:"text"`
+	Provider     *models.Provider     `json:"provider,omitempty"`
+	ReplyToID    string               `json:"replyToId,omitempty"`
+	CreatedAt    *time.Time           `json:"createdAt,omitempty"` // When the message was sent, for messages stored after the fact; defaults to now
+	ExternalRefs []models.ExternalRef `json:"externalRefs,omitempty"`
+
+	// Who, of the people sharing the number, the message is from or for;
+	// participantId defaults to one derived from senderName
+	ParticipantID string `json:"participantId,omitempty"`
+	SenderName    string `json:"senderName,omitempty"`
+
+	participant *models.Participant
+}
+
+func (req *createMessageRequest) validate() error {
+	req.PhoneNumber = strings.TrimSpace(req.PhoneNumber)
+	req.Text = strings.TrimSpace(req.Text)
+	req.ReplyToID = strings.TrimSpace(req.ReplyToID)
+
+	switch {
+	case req.PhoneNumber == "":
+		return errors.New("phoneNumber is required")
+	case req.Text == "":
+		return errors.New("text is required")
+	case req.Provider != nil && strings.TrimSpace(req.Provider.Name) == "":
+		return errors.New("provider.name is required")
+	}
+
+	refs, err := models.NormalizeExternalRefs(req.ExternalRefs)
+	if err != nil {
+		return err
+	}
+	req.ExternalRefs = refs
+
+	req.participant, err = models.NewParticipant(req.ParticipantID, req.SenderName)
+	return err
+}
+
+func (h *Handler) CreateMessage(w http.ResponseWriter, r *http.Request) {
+	var req createMessageRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+	now := h.Clock().Now()
+	createdAt := now
+	if req.CreatedAt != nil {
+		if err := models.CheckCreatedAt(*req.CreatedAt, now, h.config.MaxFutureSkew); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		createdAt = *req.CreatedAt
+	}
+	if req.ReplyToID != "" && !h.checkReplyTo(w, req.PhoneNumber, req.ReplyToID) {
+		return
+	}
+
+	msg := models.Message{
+		ID:           "msg-" + now.Format("20060102150405.000000000"),
+		PhoneNumber:  req.PhoneNumber,
+		SenderType:   models.ClassifySender(req.PhoneNumber),
+		Text:         req.Text,
+		Status:       "RECEIVED",
+		CreatedAt:    createdAt,
+		ReceivedAt:   now,
+		Provider:     req.Provider,
+		AccountID:    accountID(r),
+		ReplyToID:    req.ReplyToID,
+		ExternalRefs: req.ExternalRefs,
+		Participant:  req.participant,
+	}
+
+	saved, err := h.store.Save(msg)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		writeError(w, http.StatusConflict, "CONFLICT", "message already exists for this provider message ID")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "save message")
+		return
+	}
+	if h.watchdog != nil {
+		h.watchdog.Stored(watchdog.SourceHTTP, 1, h.Clock().Now())
+	}
+
+	writeCreated(w, messageURL(saved.ID), newMessageResponse(saved))
+}
+
+// GetMessage returns a single message by ID, from the archive if it has
+// been archived.
+// GET /messages/{id}
+func (h *Handler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := messagePathID(r.URL.Path, "")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return
+	}
+
+	msg, err := h.findMessage(id)
+	if err != nil {
+		writeStoreError(w, err, "retrieve message")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newMessageResponse(msg))
+}
+
+// ListMessages lists the newest messages, optionally only those from ?senderId=.
+// GET /messages?limit=100&cursor=...&senderId=...
+//
+// At most ListMessagesLimit messages are returned unless the admin scope asks
+// for a larger ?limit=, up to ListMessagesMaxLimit; a larger one answers 400
+// whatever the scope. With limit or cursor the response is a page; with
+// ?includeTotal=true too, its meta.totalCount is the number of matching
+// messages. The plain-array form without them is deprecated and returns
+// only the newest messages.
+func (h *Handler) ListMessages(w http.ResponseWriter, r *http.Request) {
+	info := h.requestInfo(w, r)
+	page, err := h.parseListQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if page.Limit > h.config.ListMessagesMaxLimit {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("limit must be at most %d", h.config.ListMessagesMaxLimit))
+		return
+	}
+	if page.Limit > h.config.ListMessagesLimit && !info.Scope.includes(ScopeAdmin) {
+		writeError(w, http.StatusForbidden, "FORBIDDEN", fmt.Sprintf("limit above %d requires admin scope", h.config.ListMessagesLimit))
+		return
+	}
+
+	if !isPaginated(r) {
+		log.Printf("Deprecated: GET /messages without limit or cursor (request_id=%s client_ip=%s user_agent=%q); returning the newest %d messages",
+			info.RequestID, info.ClientIP, r.UserAgent(), page.Limit)
+		w.Header().Set("Deprecation", "true")
+
+		list, err := h.store.ListPage(page)
+		if err != nil {
+			writeStoreError(w, err, "list messages")
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	// Fetch one extra message to learn whether another page follows
+	fetch := page
+	fetch.Limit = page.Limit + 1
+	list, err := h.store.ListPage(fetch)
+	if err != nil {
+		writeStoreError(w, err, "list messages")
+		return
+	}
+	resp := newMessagePage(list, page.Limit)
+
+	// Messages aren't counted by language or annotation, so a page of one
+	// has no total
+	if includesTotal(r) && page.Language == "" && page.Annotation == "" {
+		total, err := h.cachedTotal(func() (int64, error) { return h.store.CountMessages(page.SenderID) }, "messages", page.SenderID)
+		if err != nil {
+			writeStoreError(w, err, "count messages")
+			return
+		}
+		resp.Meta.TotalCount = &total
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseListQuery reads GET /messages parameters. The limit defaults to
+// ListMessagesLimit; the caller decides whether a larger one is allowed.
+func (h *Handler) parseListQuery(r *http.Request) (store.PageQuery, error) {
+	q := r.URL.Query()
+	page := store.PageQuery{
+		Limit:    h.config.ListMessagesLimit,
+		SenderID: strings.TrimSpace(q.Get("senderId")),
+	}
+	language, err := parseLanguage(q.Get("language"))
+	if err != nil {
+		return store.PageQuery{}, err
+	}
+	page.Language = language
+	if page.Annotation, page.MinConfidence, err = parseAnnotationFilter(q); err != nil {
+		return store.PageQuery{}, err
+	}
+
+	if raw := strings.TrimSpace(q.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return store.PageQuery{}, errors.New("limit must be a positive integer")
+		}
+		page.Limit = limit
+	}
+
+	if raw := strings.TrimSpace(q.Get("cursor")); raw != "" {
+		before, beforeID, err := decodeCursor(raw)
+		if err != nil {
+			return store.PageQuery{}, errors.New("invalid cursor")
+		}
+		page.Before = before
+		page.BeforeID = beforeID
+	}
+
+	return page, nil
+}
+
+// GetUserMessages returns a conversation's messages, all of them newest
+// first or, with ?limit= or ?cursor=, one page. ?includeIngestion=true
+// keeps the times each Kafka message passed the stages of ingestion.
+// ?participant= keeps the messages of one of the people sharing the number,
+// and ?includeParticipants=true adds the conversation's participants with their
+// message counts. ?annotation=complaint&minConfidence=0.8 keeps the messages
+// a classifier labelled so, and ?includeAnnotations=true adds the
+// conversation's annotation counts by label to a page. ?includeTotal=true
+// adds meta.totalCount to a page, unless it filters by sender, language or
+// annotation. ?includeTranslations=hi,ta adds each message's translations
+// into those languages.
+// GET /v1/user/{phoneNumber}/messages
+func (h *Handler) GetUserMessages(w http.ResponseWriter, r *http.Request) {
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/messages")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	// Paginated form: ?limit=N&cursor=... returns an envelope with a next cursor
+	if isPaginated(r) {
+		h.getUserMessagesPage(w, r, phoneNumber)
+		return
+	}
+
+	language, err := parseLanguage(r.URL.Query().Get("language"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	annotation, minConfidence, err := parseAnnotationFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	translations, err := parseIncludedTranslations(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	messages, err := h.store.FindByPhoneNumber(phoneNumber)
+	if err != nil {
+		writeStoreError(w, err, "retrieve messages")
+		return
+	}
+
+	// ?includeArchived=true merges in archived messages, newest first
+	if h.includeArchived(r) {
+		if messages, err = h.withArchived(phoneNumber, messages); err != nil {
+			writeStoreError(w, err, "retrieve archived messages")
+			return
+		}
+	}
+
+	// Return empty array if no messages found (not an error)
+	messages = filterBySender(messages, strings.TrimSpace(r.URL.Query().Get("senderId")))
+	messages = filterByParticipant(messages, strings.TrimSpace(r.URL.Query().Get("participant")))
+	messages = filterByAnnotation(messages, annotation, minConfidence)
+	messages = withTranslations(filterByLanguage(messages, language), translations)
+	writeJSON(w, http.StatusOK, withIngestion(r, messages))
+}
+
+// getUserMessagesPage serves one newest-first page of a conversation.
+// Pages anchored entirely in the past are immutable and get caching headers.
+func (h *Handler) getUserMessagesPage(w http.ResponseWriter, r *http.Request, phoneNumber string) {
+	page, err := parsePageQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	translations, err := parseIncludedTranslations(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	// Fetch one extra message to learn whether another page exists
+	limit := page.Limit
+	page.Limit = limit + 1
+	messages, err := h.store.FindByPhoneNumberPage(phoneNumber, page)
+	if err != nil {
+		writeStoreError(w, err, "retrieve messages")
+		return
+	}
+
+	// Both collections share the sort key, so merging their next limit+1
+	// messages gives the same page as one combined collection would
+	if h.includeArchived(r) {
+		archived, err := h.archiver.FindArchivedByPhoneNumberPage(phoneNumber, page)
+		if err != nil {
+			writeStoreError(w, err, "retrieve archived messages")
+			return
+		}
+		messages = mergeNewestFirst(messages, archived)
+		if len(messages) > page.Limit {
+			messages = messages[:page.Limit]
+		}
+	}
+
+	resp := newMessagePage(withIngestion(r, withTranslations(messages, translations)), limit)
+
+	// ?includeTotal=true counts the messages across every page, which new
+	// messages change, so the page is no longer immutable
+	includeTotal := includesTotal(r)
+	if includeTotal {
+		if resp.Meta.TotalCount, err = h.conversationTotal(phoneNumber, page, h.includeArchived(r)); err != nil {
+			writeStoreError(w, err, "count messages")
+			return
+		}
+	}
+
+	// ?includeParticipants=true counts the conversation's messages by
+	// participant. New messages change the counts, so the page is no longer
+	// immutable
+	includeParticipants := r.URL.Query().Get("includeParticipants") == "true"
+	if includeParticipants {
+		if resp.Participants, err = h.store.CountByParticipant(phoneNumber); err != nil {
+			writeStoreError(w, err, "count participants")
+			return
+		}
+	}
+
+	// ?includeAnnotations=true counts the conversation's annotations by
+	// label; classifiers and reviewers change them, so the page is no
+	// longer immutable either
+	includeAnnotations := r.URL.Query().Get("includeAnnotations") == "true"
+	if includeAnnotations {
+		if resp.Annotations, err = h.store.CountAnnotations(phoneNumber); err != nil {
+			writeStoreError(w, err, "count annotations")
+			return
+		}
+	}
+
+	// ?includeProfile=true adds the profile, best-effort. Profiles change,
+	// so the page is no longer immutable
+	if r.URL.Query().Get("includeProfile") == "true" {
+		profiles, partial := h.lookupProfiles(w, []string{phoneNumber})
+		withProfile := userMessagesWithProfile{Data: resp.Data, Participants: resp.Participants, Annotations: resp.Annotations, Meta: resp.Meta}
+		withProfile.Meta.Partial = partial
+		if p, ok := profiles[phoneNumber]; ok {
+			withProfile.Profile = &p
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, withProfile)
+		return
+	}
+
+	// Translations can be overwritten, so a page with them isn't immutable
+	if !includeTotal && !includeParticipants && !includeAnnotations && translations == nil && h.isCacheablePage(page, resp.Data) {
+		writeCacheableJSON(w, r, resp)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteAllMessages deletes every message.
+// DELETE /messages[?mode=batched|drop]
+//
+// The default batched mode deletes in bounded batches as a background job and
+// waits briefly for it: small stores still get the immediate 200 with a
+// deletedCount, large ones get 202 with a job ID to poll at
+// /v1/admin/jobs/{id}. Retries while the job runs join it instead of
+// starting another, and a retry after a failure resumes with what is left.
+// mode=drop (admin scope) swaps in an empty collection in one step.
+// With data residency, a store holding messages of regions the deployment
+// doesn't serve is only emptied with ?regionOverride=true (admin scope).
+func (h *Handler) DeleteAllMessages(w http.ResponseWriter, r *http.Request) {
+	override, ok := h.regionOverride(w, r)
+	if !ok {
+		return
+	}
+	messages := h.messageStore(override)
+
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "batched":
+	case "drop":
+		if !h.requireAdmin(w, r) {
+			return
+		}
+		deletedCount, err := messages.DropAll()
+		if err != nil {
+			log.Printf("Failed to drop messages: %v", err)
+			writeStoreError(w, err, "delete messages")
+			return
+		}
+		receipt := newDeletionReceipt(r, models.DeletionAllMessages, "")
+		receipt.Matched[models.DeletedMessages] = deletedCount
+		if err := h.recordDeletion(receipt); err != nil {
+			log.Printf("Failed to record deletion receipt of dropped messages: %v", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not record deletion receipt")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message":      "All messages deleted successfully",
+			"deletedCount": deletedCount,
+			"mode":         "drop",
+		})
+		return
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "mode must be batched or drop")
+		return
+	}
+
+	receipt := newDeletionReceipt(r, models.DeletionAllMessages, "")
+	job, err := h.jobs.Submit(deleteAllJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		return h.runDeleteAll(ctx, p, messages, receipt)
+	})
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not delete messages")
+		return
+	}
+
+	select {
+	case <-h.jobs.Done(job.ID):
+	case <-time.After(h.config.DeleteAllWait):
+	case <-r.Context().Done():
+		return
+	}
+
+	job, err = h.jobs.Get(job.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve delete job")
+		return
+	}
+
+	switch job.Status {
+	case jobs.StatusSucceeded:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message":      "All messages deleted successfully",
+			"deletedCount": job.Processed,
+			"jobId":        job.ID,
+			"mode":         "batched",
+		})
+	case jobs.StatusFailed, jobs.StatusCancelled:
+		writeErrorDetails(w, http.StatusInternalServerError, "INTERNAL", "could not delete messages", job)
+	default:
+		w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"message": "Delete in progress",
+			"jobId":   job.ID,
+			"job":     job,
+		})
+	}
+}
+
+const (
+	// deleteAllJobType is the job type of the batched delete-all.
+	deleteAllJobType = "delete_all_messages"
+
+	// deleteBatchAttempts is how many times one failing batch is tried
+	// before the delete-all job gives up.
+	deleteBatchAttempts = 3
+)
+
+// runDeleteAll deletes the messages of messages batch by batch until none
+// are left, then records receipt with how many it deleted. A job that fails
+// records what it deleted before failing.
+func (h *Handler) runDeleteAll(ctx context.Context, p *jobs.Progress, messages store.Store, receipt models.DeletionReceipt) (result map[string]any, err error) {
+	batchSize := h.config.DeleteBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultHandlerConfig().DeleteBatchSize
+	}
+
+	total, err := messages.Count()
+	if err != nil {
+		return nil, err
+	}
+	p.SetTotal(total)
+
+	var deleted int64
+	defer func() {
+		receipt.Matched[models.DeletedMessages] = deleted
+		if rerr := h.recordDeletion(receipt); rerr != nil {
+			log.Printf("Failed to record deletion receipt of %d messages: %v", deleted, rerr)
+			if err == nil {
+				result, err = nil, fmt.Errorf("record deletion receipt: %w", rerr)
+			}
+		}
+	}()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var n int64
+		for attempt := 1; attempt <= deleteBatchAttempts; attempt++ {
+			if n, err = messages.DeleteAllBatch(batchSize); err == nil {
+				break
+			}
+			log.Printf("Delete-all batch attempt %d failed: %v", attempt, err)
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return map[string]any{"deletedCount": deleted}, nil
+		}
+		deleted += n
+		p.Add(n)
+	}
+}
+
+// DeleteUserMessages deletes all messages for a specific phone number. A
+// number with no messages answers 200 with deletedCount 0 if its
+// conversation has a summary, such as one opened without messages, and 404
+// CONVERSATION_NOT_FOUND if it was never seen. profileExists tells whether
+// the number's profile remains, which deleting the messages leaves alone.
+// DELETE /v1/user/{phoneNumber}/messages
+func (h *Handler) DeleteUserMessages(w http.ResponseWriter, r *http.Request) {
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/messages")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	// The summary goes with the messages, so look for it first
+	hasSummary, err := h.hasSummary(phoneNumber)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not look up conversation")
+		return
+	}
+
+	ids, err := h.conversationMessageIDs(phoneNumber)
+	if err != nil {
+		writeStoreError(w, err, "list messages to delete")
+		return
+	}
+	receipt := withIDs(newDeletionReceipt(r, models.DeletionConversation, phoneNumber), ids)
+
+	deletedCount, err := h.store.DeleteByPhoneNumber(phoneNumber)
+	if err != nil {
+		writeStoreError(w, err, "delete messages")
+		return
+	}
+	receipt.Matched[models.DeletedMessages] = deletedCount
+	if hasSummary {
+		receipt.Matched[models.DeletedSummaries] = 1
+	}
+
+	// Deleting a conversation removes its archived messages too
+	if h.archiver != nil {
+		archivedCount, err := h.archiver.DeleteArchivedByPhoneNumber(phoneNumber)
+		if err != nil {
+			writeStoreError(w, err, "delete archived messages")
+			return
+		}
+		deletedCount += archivedCount
+		receipt.Matched[models.DeletedArchivedMessages] = archivedCount
+	}
+
+	// Deleting a number never seen is recorded all the same
+	if err := h.recordDeletion(receipt); err != nil {
+		log.Printf("Failed to record deletion receipt of %s: %v", phoneNumber, err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not record deletion receipt")
+		return
+	}
+
+	if deletedCount == 0 && !hasSummary {
+		writeError(w, http.StatusNotFound, "CONVERSATION_NOT_FOUND", "conversation not found")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":      "Messages deleted successfully",
+		"deletedCount": deletedCount,
+		"phoneNumber":  phoneNumber,
+	}
+	// The messages are gone by now, so a failed lookup only leaves the flag out
+	if exists, err := h.profileExists(phoneNumber); err != nil {
+		log.Printf("Failed to look up profile %s after deleting its messages: %v", phoneNumber, err)
+	} else {
+		response["profileExists"] = exists
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// hasSummary reports whether phoneNumber's conversation has a summary, and
+// false without a summary store.
+func (h *Handler) hasSummary(phoneNumber string) (bool, error) {
+	if h.summaries == nil {
+		return false, nil
+	}
+	summaries, err := h.summaries.GetSummaries([]string{phoneNumber})
+	if err != nil {
+		return false, err
+	}
+	_, ok := summaries[phoneNumber]
+	return ok, nil
+}
+
+// profileExists reports whether phoneNumber has a profile.
+func (h *Handler) profileExists(phoneNumber string) (bool, error) {
+	if h.profileStore == nil {
+		return false, nil
+	}
+	_, err := h.profileStore.GetProfile(phoneNumber)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// deleteConversation serves DELETE /v1/user/{phoneNumber}/messages and
+// decodes the answer.
+func deleteConversation(t *testing.T, h *Handler, phoneNumber string) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/user/"+phoneNumber+"/messages", nil))
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("DELETE %s = %d %s: %v", phoneNumber, w.Code, w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func TestDeleteConversation(t *testing.T) {
+	mem := store.NewMemoryStore()
+	summaries := store.NewMemorySummaryStore(mem)
+	tombstones := store.NewMemoryTombstoneStore()
+	s := store.NewSummarizingStore(store.NewTombstoningStore(mem, tombstones, time.Hour), summaries)
+	profiles := store.NewMemoryProfileStore()
+	h := NewHandler(s, profiles)
+	h.SetSummaryStore(summaries)
+	h.SetTombstoneStore(tombstones)
+
+	created := time.Now().Add(-time.Minute)
+	for _, id := range []string{"m1", "m2"} {
+		if _, err := s.Save(models.Message{ID: id, PhoneNumber: "9876543210", Text: "hello", Status: "SUCCESS", CreatedAt: created}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if _, err := profiles.CreateProfile(models.Profile{PhoneNumber: "9876543210", Name: "Ram"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := summaries.CreateEmptySummary("9876543211", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Existing", func(t *testing.T) {
+		code, body := deleteConversation(t, h, "9876543210")
+		if code != http.StatusOK || body["deletedCount"] != 2.0 || body["profileExists"] != true {
+			t.Fatalf("DELETE = %d %v, want 200 with 2 deleted and the profile kept", code, body)
+		}
+		if got, _ := summaries.GetSummaries([]string{"9876543210"}); len(got) != 0 {
+			t.Fatalf("summary %+v was left behind", got)
+		}
+		if got, _ := tombstones.FindTombstones([]string{"9876543210"}); len(got) != 1 {
+			t.Fatalf("tombstones = %+v, want one for the deleted conversation", got)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		code, body := deleteConversation(t, h, "9876543211")
+		if code != http.StatusOK || body["deletedCount"] != 0.0 || body["profileExists"] != false {
+			t.Fatalf("DELETE = %d %v, want 200 with none deleted and no profile", code, body)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		code, body := deleteConversation(t, h, "9876543219")
+		if code != http.StatusNotFound || body["code"] != "CONVERSATION_NOT_FOUND" {
+			t.Fatalf("DELETE = %d %v, want 404 CONVERSATION_NOT_FOUND", code, body)
+		}
+	})
+
+	t.Run("AlreadyTombstoned", func(t *testing.T) {
+		// A replayed event from before the deletion doesn't bring it back
+		if _, err := s.Save(models.Message{ID: "m3", PhoneNumber: "9876543210", Text: "hello", Status: "SUCCESS", CreatedAt: created}); !errors.Is(err, store.ErrTombstoned) {
+			t.Fatalf("Save of a message older than the tombstone: err = %v, want ErrTombstoned", err)
+		}
+		code, body := deleteConversation(t, h, "9876543210")
+		if code != http.StatusNotFound || body["code"] != "CONVERSATION_NOT_FOUND" {
+			t.Fatalf("DELETE again = %d %v, want 404 CONVERSATION_NOT_FOUND", code, body)
+		}
+		if got, _ := tombstones.FindTombstones([]string{"9876543210"}); len(got) != 1 {
+			t.Fatalf("tombstones = %+v, want the one tombstone kept", got)
+		}
+	})
+}
+
+func TestLateMessageSortsIntoPlace(t *testing.T) {
+	h := NewHandler(store.NewMemoryStore(), store.NewMemoryProfileStore())
+	created := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	for _, body := range []string{
+		`{"phoneNumber": "9876543210", "text": "newer", "createdAt": "` + created.Format(time.RFC3339) + `"}`,
+		`{"phoneNumber": "9876543210", "text": "older", "createdAt": "` + created.Add(-time.Hour).Format(time.RFC3339) + `"}`,
+	} {
+		w := httptest.NewRecorder()
+		h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("POST /messages = %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/user/9876543210/messages?limit=2", nil))
+	var page messagePage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET = %d %s", w.Code, w.Body.String())
+	}
+	if len(page.Data) != 2 || page.Data[0].Text != "newer" || page.Data[1].Text != "older" || !page.Data[0].CreatedAt.Equal(created) {
+		t.Fatalf("page = %s, want the late, older message after the newer one", w.Body.String())
+	}
+}
+
+// oversizedStore fails the reads returning every matching message, as
+// MongoStore does past ReadLimits.MaxDocuments.
+type oversizedStore struct {
+	store.Store
+}
+
+func (s oversizedStore) FindByPhoneNumber(string) ([]models.Message, error) {
+	return nil, &store.ReadLimitError{Operation: "FindByPhoneNumber", Limit: 50000}
+}
+
+func (s oversizedStore) ListPage(store.PageQuery) ([]models.Message, error) {
+	return nil, &store.ReadLimitError{Operation: "List", Limit: 50000}
+}
+
+func TestOversizedReadAnswers422(t *testing.T) {
+	h := NewHandler(oversizedStore{Store: store.NewMemoryStore()}, store.NewMemoryProfileStore())
+	for _, tc := range []struct {
+		path      string
+		operation string
+	}{
+		{"/v1/user/9876543210/messages", "FindByPhoneNumber"},
+		{"/messages", "List"},
+	} {
+		w := httptest.NewRecorder()
+		RequestContext(h.Routes()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		var resp struct {
+			Code    string               `json:"code"`
+			Details store.ReadLimitError `json:"details"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("GET %s = %d %s", tc.path, w.Code, w.Body.String())
+		}
+		if resp.Code != "RESULT_TOO_LARGE" || resp.Details.Operation != tc.operation || resp.Details.Limit != 50000 {
+			t.Fatalf("GET %s = %s, want RESULT_TOO_LARGE with the %s limit", tc.path, w.Body.String(), tc.operation)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"syscall"
+
+	"sms-store/internal/metrics"
+)
+
+var (
+	responseEncodeErrors = metrics.NewCounterVec(
+		"http_response_encode_errors_total",
+		"Responses whose JSON payload could not be encoded.",
+		"route",
+	)
+	responseWriteErrors = metrics.NewCounterVec(
+		"http_response_write_errors_total",
+		"Responses that failed while being written for reasons other than the client going away.",
+		"route",
+	)
+	responseClientAborts = metrics.NewCounterVec(
+		"http_response_client_aborts_total",
+		"Responses that could not be written because the client disconnected.",
+		"route",
+	)
+	pageTotalLookups = metrics.NewCounterVec(
+		"http_page_total_lookups_total",
+		"Totals of ?includeTotal=true pages answered from the count cache (hit) or by counting (miss).",
+		"result",
+	)
+)
+
+// recordWriteError classifies a failed response write. Client disconnects are
+// expected noise and are counted separately so they don't trip error alerts.
+func recordWriteError(w http.ResponseWriter, err error) {
+	route, requestID, _, req := responseInfo(w)
+	if isClientGone(req, err) {
+		responseClientAborts.WithLabelValues(route).Inc()
+		return
+	}
+	responseWriteErrors.WithLabelValues(route).Inc()
+	log.Printf("Failed to write response (route=%s request_id=%s client_ip=%s): %v", route, requestID, ClientIP(req), err)
+}
+
+// isClientGone reports whether err is the result of the client cancelling the request.
+func isClientGone(req *http.Request, err error) bool {
+	if req != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		return true
+	}
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
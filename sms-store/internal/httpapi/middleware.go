@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// requestIDHeader carries the request ID in and out of the service.
+const requestIDHeader = "X-Request-ID"
+
+// trackingWriter remembers the request it serves and whether the header
+// has been written, so response helpers can log with route and request ID
+// and decide whether an error status can still be sent.
+type trackingWriter struct {
+	http.ResponseWriter
+	req         *http.Request
+	requestID   string
+	wroteHeader bool
+}
+
+func (tw *trackingWriter) WriteHeader(status int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+	tw.wroteHeader = true
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer so streaming responses keep working.
+func (tw *trackingWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		tw.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (tw *trackingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// route returns the mux pattern that matched the request, which keeps metric
+// labels bounded (no phone numbers), falling back to "unmatched".
+func (tw *trackingWriter) route() string {
+	if tw.req.Pattern != "" {
+		return tw.req.Pattern
+	}
+	return "unmatched"
+}
+
+// RequestContext wraps the whole mux: it assigns a request ID (reusing a
+// sane inbound X-Request-ID) and tracks the response for the helpers below.
+func RequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := strings.TrimSpace(r.Header.Get(requestIDHeader))
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		next.ServeHTTP(&trackingWriter{ResponseWriter: w, req: r, requestID: requestID}, r)
+	})
+}
+
+// newRequestID returns a random 16-byte hex identifier.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// responseInfo extracts route, request ID and header state from a writer
+// wrapped by RequestContext. Unwrapped writers report unknown values.
+func responseInfo(w http.ResponseWriter) (route, requestID string, wroteHeader bool, req *http.Request) {
+	if tw, ok := w.(*trackingWriter); ok {
+		return tw.route(), tw.requestID, tw.wroteHeader, tw.req
+	}
+	return "unknown", "", false, nil
+}
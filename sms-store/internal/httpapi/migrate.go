@@ -0,0 +1,188 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/migrate"
+)
+
+const (
+	migrateJobType      = "migrate"
+	maxMigrationWorkers = 32
+	maxMigrationBatch   = 10000
+)
+
+// SetMigrator attaches the bulk importer behind POST /v1/admin/migrate/start.
+// Migrations answer 501 until one is set and MigrationDir is configured.
+func (h *Handler) SetMigrator(m *migrate.Migrator) {
+	h.migrator = m
+}
+
+// SetMigrationS3 configures the S3 access of s3://bucket/prefix migration
+// sources, which answer 501 until it is set.
+func (h *Handler) SetMigrationS3(config migrate.S3Config) {
+	h.migrationS3 = &config
+}
+
+type startMigrationRequest struct {
+	Path        string `json:"path"`                  // Directory of *.ndjson or *.xml files, relative to MigrationDir, or an s3://bucket/prefix
+	Format      string `json:"format,omitempty"`      // ndjson (default) or sms-backup-xml
+	Parallelism int    `json:"parallelism,omitempty"` // Files read at once
+	BatchSize   int    `json:"batchSize,omitempty"`   // Messages per batch write
+	Restart     bool   `json:"restart,omitempty"`     // Ignore the checkpoint of an earlier run
+}
+
+// StartMigration imports the NDJSON files, or SMS Backup & Restore XML
+// exports, of a directory or an S3 prefix in the background.
+// Running it again for the same path resumes from the last checkpoint, so
+// a migration interrupted by a restart is continued rather than repeated.
+// Requires the admin scope.
+// POST /v1/admin/migrate/start
+func (h *Handler) StartMigration(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.migrator == nil || h.config.MigrationDir == "" && h.migrationS3 == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "migration is not configured")
+		return
+	}
+
+	var req startMigrationRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	format, err := migrate.ParseFormat(req.Format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be ndjson or sms-backup-xml")
+		return
+	}
+
+	req.Path = strings.TrimSpace(req.Path)
+	var src migrate.Source
+	switch {
+	case strings.HasPrefix(req.Path, "s3://"):
+		if h.migrationS3 == nil {
+			writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "S3 migration sources are not configured")
+			return
+		}
+		bucket, prefix, err := migrate.ParseS3URL(req.Path)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		src = migrate.NewS3Source(*h.migrationS3, bucket, prefix, format)
+	case strings.Contains(req.Path, "://"):
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "migration sources must be directories on the server's disk or s3:// prefixes")
+		return
+	default:
+		if h.config.MigrationDir == "" {
+			writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "migration directory is not configured")
+			return
+		}
+		dir, ok := h.migrationDir(req.Path)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "path must be a directory inside the migration directory")
+			return
+		}
+		src = migrate.NewDirSource(dir, format)
+	}
+
+	opts := migrate.Options{
+		Parallelism: h.config.MigrationParallelism,
+		BatchSize:   h.config.MigrationBatchSize,
+		Restart:     req.Restart,
+	}
+	if req.Parallelism != 0 {
+		opts.Parallelism = req.Parallelism
+	}
+	if req.BatchSize != 0 {
+		opts.BatchSize = req.BatchSize
+	}
+	if opts.Parallelism < 1 || opts.Parallelism > maxMigrationWorkers {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "parallelism must be between 1 and 32")
+		return
+	}
+	if opts.BatchSize < 1 || opts.BatchSize > maxMigrationBatch {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "batchSize must be between 1 and 10000")
+		return
+	}
+
+	if _, err := src.Files(); err != nil {
+		if _, ok := src.(*migrate.S3Source); ok {
+			log.Printf("Listing migration source %s failed: %v", src.Name(), err)
+			writeError(w, http.StatusBadGateway, "S3_UNAVAILABLE", "could not list the S3 prefix")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "path is not a readable directory")
+		return
+	}
+
+	job, err := h.jobs.Submit(migrateJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		return h.runMigration(ctx, p, src, opts)
+	})
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start migration")
+		return
+	}
+
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": "Migration started",
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+// migrationDir resolves path inside MigrationDir, rejecting paths that
+// climb out of it.
+func (h *Handler) migrationDir(path string) (string, bool) {
+	root := filepath.Clean(h.config.MigrationDir)
+	dir := filepath.Join(root, filepath.FromSlash(path))
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return dir, true
+}
+
+// runMigration imports src and describes the result.
+func (h *Handler) runMigration(ctx context.Context, p *jobs.Progress, src migrate.Source, opts migrate.Options) (map[string]any, error) {
+	result, err := h.migrator.Run(ctx, src, opts, p)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]map[string]any, len(result.InvalidSamples))
+	for i, s := range result.InvalidSamples {
+		samples[i] = map[string]any{"file": s.File, "offset": s.Offset, "error": s.Error}
+		if s.Element > 0 {
+			samples[i]["line"], samples[i]["element"] = s.Line, s.Element
+		}
+	}
+	return map[string]any{
+		"source":            result.Source,
+		"format":            src.Format(),
+		"resumed":           result.Resumed,
+		"files":             result.Files,
+		"lines":             result.Lines,
+		"imported":          result.Imported,
+		"duplicates":        result.Duplicates,
+		"invalid":           result.Invalid,
+		"invalidSamples":    samples,
+		"bytesRead":         result.Bytes,
+		"durationMs":        result.Duration.Milliseconds(),
+		"messagesPerSecond": result.MessagesPerSecond,
+		"verification": map[string]any{
+			"expectedCount": result.Verification.ExpectedCount,
+			"storeCount":    result.Verification.StoreCount,
+			"verified":      result.Verification.Verified,
+		},
+	}, nil
+}
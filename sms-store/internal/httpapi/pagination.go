@@ -0,0 +1,206 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// pageMeta describes the position of a page within a result set.
+type pageMeta struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	TotalCount *int64 `json:"totalCount,omitempty"` // Matching messages across all pages, with ?includeTotal=true where counted
+	Partial    bool   `json:"partial,omitempty"`    // Best-effort enrichment, such as ?includeProfile=true, was left out
+}
+
+// messagePage is the envelope returned by paginated message endpoints.
+type messagePage struct {
+	Data         []models.Message         `json:"data"`
+	Participants []store.ParticipantCount `json:"participants,omitempty"` // With ?includeParticipants=true
+	Annotations  []store.AnnotationCount  `json:"annotations,omitempty"`  // With ?includeAnnotations=true
+	Meta         pageMeta                 `json:"meta"`
+}
+
+// isPaginated reports whether the client asked for the paginated response form.
+// Requests without pagination parameters keep the legacy plain-array response.
+func isPaginated(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("limit") || q.Has("cursor")
+}
+
+// parsePageQuery reads ?limit= and ?cursor=, and the sender, language,
+// participant and annotation filters, into a store.PageQuery.
+func parsePageQuery(r *http.Request) (store.PageQuery, error) {
+	q := r.URL.Query()
+	page := store.PageQuery{Limit: defaultPageLimit}
+
+	if raw := strings.TrimSpace(q.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return store.PageQuery{}, errors.New("limit must be a positive integer")
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		page.Limit = limit
+	}
+
+	if raw := strings.TrimSpace(q.Get("cursor")); raw != "" {
+		before, beforeID, err := decodeCursor(raw)
+		if err != nil {
+			return store.PageQuery{}, errors.New("invalid cursor")
+		}
+		page.Before = before
+		page.BeforeID = beforeID
+	}
+
+	page.SenderID = strings.TrimSpace(q.Get("senderId"))
+	language, err := parseLanguage(q.Get("language"))
+	if err != nil {
+		return store.PageQuery{}, err
+	}
+	page.Language = language
+	page.Participant = strings.TrimSpace(q.Get("participant"))
+	if page.Annotation, page.MinConfidence, err = parseAnnotationFilter(q); err != nil {
+		return store.PageQuery{}, err
+	}
+
+	return page, nil
+}
+
+// languageTag matches the language codes ?language= takes: a primary
+// language subtag and any further subtags, as in hi or hi-Latn.
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// parseLanguage reads a ?language= filter; empty filters nothing.
+func parseLanguage(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw != "" && !languageTag.MatchString(raw) {
+		return "", errors.New("language must be a language code such as hi or hi-Latn")
+	}
+	return raw, nil
+}
+
+// filterByLanguage keeps only messages detected in language or one of its
+// subtags; an empty language keeps all.
+func filterByLanguage(messages []models.Message, language string) []models.Message {
+	if language == "" {
+		return messages
+	}
+	out := make([]models.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Language != nil && models.LanguageMatches(msg.Language.Code, language) {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// filterBySender keeps only messages sent from senderID; an empty senderID keeps all.
+func filterBySender(messages []models.Message, senderID string) []models.Message {
+	if senderID == "" {
+		return messages
+	}
+	out := make([]models.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Provider != nil && msg.Provider.SenderID == senderID {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// filterByParticipant keeps only messages of the participant with ID
+// participant, where models.DefaultParticipantID keeps those without one;
+// an empty participant keeps all.
+func filterByParticipant(messages []models.Message, participant string) []models.Message {
+	if participant == "" {
+		return messages
+	}
+	out := make([]models.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.ParticipantID() == participant {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// newMessagePage trims a limit+1 result to limit and fills in the meta block.
+func newMessagePage(messages []models.Message, limit int) messagePage {
+	resp := messagePage{Data: messages, Meta: pageMeta{Limit: limit}}
+	if len(messages) > limit {
+		resp.Data = messages[:limit]
+		resp.Meta.HasMore = true
+		last := resp.Data[len(resp.Data)-1]
+		resp.Meta.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return resp
+}
+
+// conversationTotal counts, for meta.totalCount, the messages of
+// phoneNumber's conversation that a page of it filtered by page lists, the
+// archived ones included with archived. It returns nil for filters messages
+// aren't counted by: sender, language, annotation, and participant across
+// the archive.
+func (h *Handler) conversationTotal(phoneNumber string, page store.PageQuery, archived bool) (*int64, error) {
+	if page.SenderID != "" || page.Language != "" || page.Annotation != "" || (archived && page.Participant != "") {
+		return nil, nil
+	}
+	total, err := h.cachedTotal(func() (int64, error) {
+		if archived {
+			counts, err := h.archiver.ConversationCounts([]string{phoneNumber})
+			c := counts[phoneNumber]
+			return c.MessageCount + c.ArchivedCount, err
+		}
+		counts, err := h.store.CountByParticipant(phoneNumber)
+		var n int64
+		for _, c := range counts {
+			if page.Participant == "" || c.ID == page.Participant {
+				n += c.Messages
+			}
+		}
+		return n, err
+	}, "conversation", phoneNumber, page.Participant, strconv.FormatBool(archived))
+	if err != nil {
+		return nil, err
+	}
+	return &total, nil
+}
+
+// encodeCursor builds an opaque cursor from a message's sort key.
+func encodeCursor(createdAt time.Time, id string) string {
+	raw := strconv.FormatInt(createdAt.UnixNano(), 10) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor.
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	nanos, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", errors.New("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return time.Unix(0, n).UTC(), id, nil
+}
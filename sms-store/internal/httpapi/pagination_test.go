@@ -0,0 +1,157 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		createdAt time.Time
+		id        string
+	}{
+		{time.Date(2026, 10, 14, 12, 0, 0, 123456789, time.UTC), "m1"},
+		{time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), "before-the-epoch"},
+		{time.Date(2026, 10, 14, 17, 30, 0, 0, time.FixedZone("IST", 19800)), "in-another-zone"},
+		{time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC), "with|pipe"},
+		{time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC), ""},
+	} {
+		cursor := encodeCursor(tc.createdAt, tc.id)
+		if strings.ContainsAny(cursor, "+/=") {
+			t.Errorf("cursor %q isn't URL-safe", cursor)
+		}
+		createdAt, id, err := decodeCursor(cursor)
+		if err != nil || !createdAt.Equal(tc.createdAt) || createdAt.Location() != time.UTC || id != tc.id {
+			t.Errorf("decodeCursor(encodeCursor(%v, %q)) = %v, %q, %v", tc.createdAt, tc.id, createdAt, id, err)
+		}
+	}
+}
+
+func TestMalformedCursorIsBadRequest(t *testing.T) {
+	h := NewHandler(store.NewMemoryStore(), store.NewMemoryProfileStore())
+	for _, cursor := range []string{
+		"not*base64",
+		base64.StdEncoding.EncodeToString([]byte("1|m1")), // Padded
+		base64.RawURLEncoding.EncodeToString([]byte("no separator")),
+		base64.RawURLEncoding.EncodeToString([]byte("yesterday|m1")),
+		base64.RawURLEncoding.EncodeToString([]byte("99999999999999999999|m1")),
+	} {
+		for _, path := range []string{"/v1/user/9876543210/messages", "/messages"} {
+			w := httptest.NewRecorder()
+			h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?cursor="+cursor, nil))
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"message":"invalid cursor"`) {
+				t.Errorf("GET %s?cursor=%s = %d %s, want 400 invalid cursor", path, cursor, w.Code, w.Body)
+			}
+		}
+	}
+}
+
+func TestPagingThroughConversation(t *testing.T) {
+	// Seven messages, three of them sent in the same instant, which the
+	// cursor tells apart by ID
+	s := store.NewMemoryStore()
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	var want []string
+	for i := range 7 {
+		createdAt := start.Add(time.Duration(i) * time.Second)
+		if i >= 2 && i <= 4 {
+			createdAt = start.Add(2 * time.Second)
+		}
+		msg := models.Message{ID: fmt.Sprintf("m%d", i), PhoneNumber: "9876543210", Text: "hello", Status: "SUCCESS", CreatedAt: createdAt}
+		if _, err := s.Save(msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		want = append([]string{msg.ID}, want...)
+	}
+	h := NewHandler(s, store.NewMemoryProfileStore())
+
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 7 {
+			t.Fatal("paging didn't end")
+		}
+		w := httptest.NewRecorder()
+		h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/user/9876543210/messages?limit=2&cursor="+cursor, nil))
+		var page messagePage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("page %d = %d %s", pages, w.Code, w.Body)
+		}
+		for _, msg := range page.Data {
+			got = append(got, msg.ID)
+		}
+		if !page.Meta.HasMore {
+			if page.Meta.NextCursor != "" {
+				t.Fatalf("last page has cursor %q", page.Meta.NextCursor)
+			}
+			break
+		}
+		cursor = page.Meta.NextCursor
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("paged through %v, want %v", got, want)
+	}
+}
+
+func TestParsePageQueryLimits(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		limit int
+		err   string
+	}{
+		{"", defaultPageLimit, ""},
+		{"limit=10", 10, ""},
+		{"limit=%2010%20", 10, ""},
+		{"limit=100000", maxPageLimit, ""},
+		{"limit=0", 0, "limit must be a positive integer"},
+		{"limit=-1", 0, "limit must be a positive integer"},
+		{"limit=ten", 0, "limit must be a positive integer"},
+		{"language=not_a_tag", 0, "language must be a language code such as hi or hi-Latn"},
+	} {
+		page, err := parsePageQuery(httptest.NewRequest(http.MethodGet, "/v1/user/9876543210/messages?"+tc.query, nil))
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("parsePageQuery(%q) = %v, want %q", tc.query, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || page.Limit != tc.limit {
+			t.Errorf("parsePageQuery(%q) = limit %d, %v; want %d", tc.query, page.Limit, err, tc.limit)
+		}
+	}
+}
+
+func TestListMessagesLimitByScope(t *testing.T) {
+	h := newScopesTestHandler()
+	routes := h.Authorize(h.Routes())
+	for _, tc := range []struct {
+		scope Scope
+		limit int
+		want  int
+	}{
+		{ScopeRead, 1000, http.StatusOK},
+		{ScopeRead, 1001, http.StatusForbidden},
+		{ScopeAdmin, 1001, http.StatusOK},
+		{ScopeAdmin, 10000, http.StatusOK},
+		// The hard maximum holds for every scope
+		{ScopeAdmin, 10001, http.StatusBadRequest},
+		{ScopeRead, 10001, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/messages?limit=%d", tc.limit), nil)
+		r.Header.Set("Authorization", "Bearer "+scopeKeys[tc.scope])
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("GET /messages?limit=%d with a %s key = %d %s, want %d", tc.limit, tc.scope, w.Code, w.Body.String(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// patchMessageRequest tags a message with its participant.
+type patchMessageRequest struct {
+	ParticipantID string `json:"participantId"`
+	SenderName    string `json:"senderName"`
+
+	participant *models.Participant
+}
+
+func (req *patchMessageRequest) validate() error {
+	if strings.TrimSpace(req.ParticipantID) == "" && strings.TrimSpace(req.SenderName) == "" {
+		return errors.New("participantId or senderName is required")
+	}
+	var err error
+	if req.participant, err = models.NewParticipant(req.ParticipantID, req.SenderName); err != nil {
+		return err
+	}
+	if req.participant == nil {
+		// The default participant is the absence of one, which an empty
+		// patch participant removes
+		req.participant = &models.Participant{}
+	}
+	return nil
+}
+
+// PatchMessage tags a message with who, of the people sharing its number,
+// it is from or for. participantId defaults to one derived from senderName;
+// participantId "default" removes the tag, moving the message back to the
+// default participant.
+// PATCH /messages/{id}
+func (h *Handler) PatchMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := messagePathID(r.URL.Path, "")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return
+	}
+	var req patchMessageRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+
+	msg, err := h.store.UpdateMessage(id, store.MessagePatch{Participant: req.participant})
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "message not found")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "update message")
+		return
+	}
+	writeJSON(w, http.StatusOK, newMessageResponse(msg))
+}
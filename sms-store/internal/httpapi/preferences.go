@@ -0,0 +1,227 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	// accountIDHeader selects the account a request acts on.
+	accountIDHeader  = "X-Account-ID"
+	defaultAccountID = models.DefaultAccountID
+
+	maxPreferenceLabels = 10
+	maxLabelLength      = 32
+)
+
+// preferenceColors is the fixed palette a conversation color must come from.
+// An empty color clears it.
+var preferenceColors = map[string]bool{
+	"":       true,
+	"red":    true,
+	"orange": true,
+	"yellow": true,
+	"green":  true,
+	"teal":   true,
+	"blue":   true,
+	"purple": true,
+	"pink":   true,
+	"gray":   true,
+}
+
+// SetPreferenceStore attaches the conversation preference store.
+// Preference endpoints answer 501 until one is set.
+func (h *Handler) SetPreferenceStore(ps store.PreferenceStore) {
+	h.preferenceStore = ps
+}
+
+// accountID returns the account a request acts on.
+func accountID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(accountIDHeader)); id != "" {
+		return id
+	}
+	return defaultAccountID
+}
+
+type preferencesRequest struct {
+	Color  string   `json:"color"`
+	Labels []string `json:"labels"`
+}
+
+// normalizeLabels trims, validates and de-duplicates labels, keeping their order.
+func normalizeLabels(labels []string) ([]string, error) {
+	if len(labels) > maxPreferenceLabels {
+		return nil, errors.New("at most 10 labels are allowed")
+	}
+
+	seen := make(map[string]bool, len(labels))
+	out := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			return nil, errors.New("labels must not be empty")
+		}
+		if len([]rune(label)) > maxLabelLength {
+			return nil, errors.New("labels must be at most 32 characters")
+		}
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		out = append(out, label)
+	}
+	return out, nil
+}
+
+// GetPreferences retrieves preferences for a conversation.
+// GET /v1/user/{phoneNumber}/preferences
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	if h.preferenceStore == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "preferences are not configured")
+		return
+	}
+
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/preferences")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	prefs, err := h.preferenceStore.GetPreferences(accountID(r), phoneNumber)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "preferences not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// PutPreferences creates or replaces preferences for a conversation.
+// PUT /v1/user/{phoneNumber}/preferences
+func (h *Handler) PutPreferences(w http.ResponseWriter, r *http.Request) {
+	if h.preferenceStore == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "preferences are not configured")
+		return
+	}
+
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/preferences")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	var req preferencesRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	color := strings.ToLower(strings.TrimSpace(req.Color))
+	if !preferenceColors[color] {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "color must be one of red, orange, yellow, green, teal, blue, purple, pink, gray")
+		return
+	}
+
+	labels, err := normalizeLabels(req.Labels)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	prefs, err := h.preferenceStore.PutPreferences(models.ConversationPreferences{
+		AccountID:   accountID(r),
+		PhoneNumber: phoneNumber,
+		Color:       color,
+		Labels:      labels,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not save preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+type conversationWithPreferences struct {
+	Type           string                          `json:"type"` // models.ConversationDirect or models.ConversationGroup
+	ConversationID string                          `json:"conversationId"`
+	PhoneNumber    string                          `json:"phoneNumber,omitempty"`  // Direct conversations only
+	SenderType     string                          `json:"senderType,omitempty"`   // Direct conversations only; models.ClassifySender of PhoneNumber
+	Participants   []string                        `json:"participants,omitempty"` // Group conversations only
+	Preferences    *models.ConversationPreferences `json:"preferences"`
+	Empty          bool                            `json:"empty,omitempty"` // Opened with POST /v1/conversations, no messages yet
+
+	// Set with ?includeCounts=true
+	MessageCount  *int64 `json:"messageCount,omitempty"`
+	ArchivedCount *int64 `json:"archivedCount,omitempty"`
+
+	// Set with ?includeSummary=true, once the conversation has a summary
+	Summary *store.ConversationSummary `json:"summary,omitempty"`
+
+	// Set with ?includeSummary=true when read cursors are configured; all
+	// messages are unread until the conversation is first marked read
+	LastReadMessageAt *time.Time `json:"lastReadMessageAt,omitempty"`
+	UnreadCount       *int64     `json:"unreadCount,omitempty"`
+
+	// Set for group conversations, which have no summary
+	LastMessageAt *time.Time `json:"lastMessageAt,omitempty"`
+}
+
+// lastMessageAt returns when the conversation's newest message was sent,
+// if that is known. An empty conversation counts from when it was opened.
+func (c conversationWithPreferences) lastMessageAt() (time.Time, bool) {
+	if c.Summary != nil && c.Summary.MessageCount == 0 && c.Summary.CreatedAt != nil {
+		return *c.Summary.CreatedAt, true
+	}
+	if c.Summary != nil {
+		return c.Summary.LastMessageAt, true
+	}
+	if c.LastMessageAt != nil {
+		return *c.LastMessageAt, true
+	}
+	return time.Time{}, false
+}
+
+// directPhoneNumbers returns the phone numbers of the direct conversations
+// among convs.
+func directPhoneNumbers(convs []conversationWithPreferences) []string {
+	phoneNumbers := make([]string, 0, len(convs))
+	for _, c := range convs {
+		if c.Type == models.ConversationDirect {
+			phoneNumbers = append(phoneNumbers, c.PhoneNumber)
+		}
+	}
+	return phoneNumbers
+}
+
+// withPreferences pairs each conversation with its preferences, if any.
+// The list stays driven by phoneNumbers, so saved preferences for a number
+// without messages never surface as a conversation.
+func (h *Handler) withPreferences(r *http.Request, phoneNumbers []string) ([]conversationWithPreferences, error) {
+	prefs := map[string]models.ConversationPreferences{}
+	if h.preferenceStore != nil {
+		var err error
+		prefs, err = h.preferenceStore.ListPreferences(accountID(r), phoneNumbers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]conversationWithPreferences, 0, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		conv := conversationWithPreferences{Type: models.ConversationDirect, ConversationID: pn, PhoneNumber: pn, SenderType: models.ClassifySender(pn)}
+		if p, ok := prefs[pn]; ok {
+			conv.Preferences = &p
+		}
+		out = append(out, conv)
+	}
+	return out, nil
+}
@@ -0,0 +1,236 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	profileCleanupJobType = "profile_cleanup"
+
+	// maxCleanupReport is the most phone numbers a profile cleanup lists in
+	// its result; the counts cover the rest.
+	maxCleanupReport = 10000
+)
+
+// Reasons a stale profile cleanup keeps a profile, as keys of the
+// skipped counts of its result.
+const (
+	cleanupSkippedRecent = "recentMessages"    // The number has messages after the cutoff
+	cleanupSkippedState  = "conversationState" // Its conversation was reopened or snoozed and isn't closed
+)
+
+// SetAutoProfileLister attaches the listing of auto-created profiles that
+// the stale profile cleanup goes through. It answers 501 until one is set.
+func (h *Handler) SetAutoProfileLister(l store.AutoProfileLister) {
+	h.autoProfiles = l
+}
+
+// StartProfileCleanup deletes, in the background, the auto-created
+// profiles of numbers without messages in ?olderThanDays= (default
+// ProfileCleanupAfter). With ?dryRun=true it only reports the numbers it
+// would delete. Requires the admin scope.
+// POST /v1/admin/profiles/cleanup?olderThanDays=365&dryRun=true
+func (h *Handler) StartProfileCleanup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.autoProfiles == nil || h.profileStore == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "profile cleanup is not configured")
+		return
+	}
+
+	q := r.URL.Query()
+	olderThan := h.config.ProfileCleanupAfter
+	if raw := strings.TrimSpace(q.Get("olderThanDays")); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "olderThanDays must be a positive integer")
+			return
+		}
+		olderThan = time.Duration(days) * 24 * time.Hour
+	}
+	dryRun := q.Get("dryRun") == "true"
+
+	job, err := h.submitProfileCleanup(olderThan, dryRun, newDeletionReceipt(r, models.DeletionStaleProfiles, ""))
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start profile cleanup")
+		return
+	}
+
+	message := "Profile cleanup started"
+	if dryRun {
+		message = "Profile cleanup dry run started"
+	}
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": message,
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+// SubmitProfileCleanup starts a job cleaning up the auto-created profiles
+// of numbers without messages in olderThan, or returns the cleanup already
+// running with jobs.ErrAlreadyRunning. It is called on a schedule.
+func (h *Handler) SubmitProfileCleanup(olderThan time.Duration, dryRun bool) (jobs.Job, error) {
+	return h.submitProfileCleanup(olderThan, dryRun, models.DeletionReceipt{
+		Operation: models.DeletionStaleProfiles,
+		Request:   "scheduled profile cleanup",
+		Actor:     models.AuditActorScheduler,
+		AccountID: defaultAccountID,
+		Matched:   map[string]int64{},
+	})
+}
+
+func (h *Handler) submitProfileCleanup(olderThan time.Duration, dryRun bool, receipt models.DeletionReceipt) (jobs.Job, error) {
+	if h.autoProfiles == nil || h.profileStore == nil {
+		return jobs.Job{}, errors.New("profile cleanup is not configured")
+	}
+	cutoff := h.Clock().Now().Add(-olderThan)
+	return h.jobs.Submit(profileCleanupJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		return h.runProfileCleanup(ctx, p, cutoff, dryRun, receipt)
+	})
+}
+
+// runProfileCleanup goes through the auto-created profiles a batch at a
+// time, deleting those stale at cutoff unless dryRun is set. Profiles
+// created after cutoff are never candidates: their number can't have gone
+// quiet for long enough. A profile edited by a person loses its auto
+// source, so it is never listed either.
+//
+// The checks and the delete are separate reads and writes, so a message
+// arriving in between is stored without a profile. The consumer remembers
+// the numbers it made a profile for, and only makes one again once it has
+// forgotten the number, as after a restart.
+func (h *Handler) runProfileCleanup(ctx context.Context, p *jobs.Progress, cutoff time.Time, dryRun bool, receipt models.DeletionReceipt) (map[string]any, error) {
+	batchSize := h.config.ProfileCleanupBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultHandlerConfig().ProfileCleanupBatchSize
+	}
+
+	var scanned, stale, deleted int64
+	skipped := map[string]int64{cleanupSkippedRecent: 0, cleanupSkippedState: 0}
+	phoneNumbers := []string{}
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		batch, err := h.autoProfiles.ListAutoProfiles(cutoff, after, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		after = batch[len(batch)-1].PhoneNumber
+		scanned += int64(len(batch))
+
+		numbers, err := h.staleProfiles(batch, cutoff, skipped)
+		if err != nil {
+			return nil, err
+		}
+		for _, pn := range numbers {
+			if !dryRun {
+				err := h.profileStore.DeleteProfile(pn)
+				if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrRegionNotAllowed) {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("delete profile %s: %w", pn, err)
+				}
+				deleted++
+			}
+			stale++
+			if len(phoneNumbers) < maxCleanupReport {
+				phoneNumbers = append(phoneNumbers, pn)
+			}
+		}
+		p.Add(int64(len(batch)))
+
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	if !dryRun {
+		receipt.Matched[models.DeletedProfiles] = deleted
+		if err := h.recordDeletion(receipt); err != nil {
+			return nil, fmt.Errorf("record deletion receipt: %w", err)
+		}
+	}
+	return map[string]any{
+		"dryRun":                dryRun,
+		"cutoff":                cutoff,
+		"scanned":               scanned,
+		"stale":                 stale,
+		"profilesDeleted":       deleted,
+		"skipped":               skipped,
+		"phoneNumbers":          phoneNumbers,
+		"phoneNumbersTruncated": stale > int64(len(phoneNumbers)),
+	}, nil
+}
+
+// staleProfiles returns the numbers of profiles, out of batch, without
+// live or archived messages at or after cutoff, and whose conversation
+// nobody has kept open. A conversation starts open; one reopened or
+// snoozed by a person, or by an inbound reply, is in use until it is
+// closed. The profiles kept are counted in skipped by reason.
+func (h *Handler) staleProfiles(batch []models.Profile, cutoff time.Time, skipped map[string]int64) ([]string, error) {
+	numbers := make([]string, len(batch))
+	for i, profile := range batch {
+		numbers[i] = profile.PhoneNumber
+	}
+	var summaries map[string]store.ConversationSummary
+	if h.summaries != nil {
+		var err error
+		if summaries, err = h.summaries.GetSummaries(numbers); err != nil {
+			return nil, fmt.Errorf("look up conversation states: %w", err)
+		}
+	}
+
+	now := h.Clock().Now()
+	var stale []string
+	for _, pn := range numbers {
+		if summary, ok := summaries[pn]; ok && summary.StateChangedAt != nil && summary.EffectiveState(now) != models.ConversationClosed {
+			skipped[cleanupSkippedState]++
+			continue
+		}
+		recent, err := h.hasMessagesSince(pn, cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("look up messages of %s: %w", pn, err)
+		}
+		if recent {
+			skipped[cleanupSkippedRecent]++
+			continue
+		}
+		stale = append(stale, pn)
+	}
+	return stale, nil
+}
+
+// hasMessagesSince reports whether phoneNumber's newest message, live or
+// else archived, was created at or after since.
+func (h *Handler) hasMessagesSince(phoneNumber string, since time.Time) (bool, error) {
+	newest, err := h.store.FindByPhoneNumberPage(phoneNumber, store.PageQuery{Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	if len(newest) == 0 && h.archiver != nil {
+		if newest, err = h.archiver.FindArchivedByPhoneNumberPage(phoneNumber, store.PageQuery{Limit: 1}); err != nil {
+			return false, err
+		}
+	}
+	return len(newest) > 0 && !newest[0].CreatedAt.Before(since), nil
+}
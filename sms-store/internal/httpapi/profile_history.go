@@ -0,0 +1,176 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// SetProfileHistory attaches the recorder of profile changes. Changes made
+// through the API are recorded with the client's IP as their actor; the
+// history and rollback endpoints answer 501 until it is set.
+func (h *Handler) SetProfileHistory(ph *store.ProfileHistoryRecorder) {
+	h.profileHistory = ph
+}
+
+// profileHistoryPage is the body of GET /v1/profile/{phoneNumber}/history.
+// MissingVersions are the versions on the page, or between it and the
+// profile's current version, whose change failed to be recorded.
+type profileHistoryPage struct {
+	Data            []models.ProfileChange `json:"data"`
+	Meta            pageMeta               `json:"meta"`
+	MissingVersions []int64                `json:"missingVersions,omitempty"`
+}
+
+// profileRollbackResponse is the body of POST
+// /v1/profile/{phoneNumber}/rollback/{historyId}.
+type profileRollbackResponse struct {
+	Profile profileResponse      `json:"profile"`
+	Change  models.ProfileChange `json:"change"`
+}
+
+// profileWriter returns the store the profile writes of r go to, which
+// records them as made by its client when history is kept.
+func (h *Handler) profileWriter(r *http.Request) store.ProfileStore {
+	if h.profileHistory == nil {
+		return h.profileStore
+	}
+	return h.profileHistory.As(ClientIP(r))
+}
+
+// GetProfileHistory lists the changes of a profile, newest first.
+// GET /v1/profile/{phoneNumber}/history?limit=&cursor=
+func (h *Handler) GetProfileHistory(w http.ResponseWriter, r *http.Request) {
+	if h.profileHistory == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "profile history is not configured")
+		return
+	}
+
+	phoneNumber, ok := pathParam(r.URL.Path, "/v1/profile/", "/history")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultPageLimit
+	if raw := strings.TrimSpace(q.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+	var before int64
+	if raw := strings.TrimSpace(q.Get("cursor")); raw != "" {
+		v, err := decodeVersionCursor(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid cursor")
+			return
+		}
+		before = v
+	}
+
+	profile, profileErr := h.profileStore.GetProfile(phoneNumber)
+	found := profileErr == nil
+	if profileErr != nil && !errors.Is(profileErr, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve profile history")
+		return
+	}
+
+	// One more than asked tells whether there is a next page, and whether
+	// the version just below this one was recorded
+	changes, err := h.profileHistory.History().ListProfileHistory(phoneNumber, before, limit+1)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve profile history")
+		return
+	}
+	if !found && len(changes) == 0 && before == 0 {
+		writeStoreError(w, profileErr, "retrieve profile history")
+		return
+	}
+
+	page := profileHistoryPage{Data: changes, Meta: pageMeta{Limit: limit}}
+	if len(changes) > limit {
+		page.Data = changes[:limit]
+		page.Meta.HasMore = true
+		page.Meta.NextCursor = encodeVersionCursor(page.Data[len(page.Data)-1].Version)
+	}
+
+	// The first page counts gaps down from the current version. A later one
+	// leaves out the gap above its first entry: the page before reported it,
+	// from the entry it fetched past its end
+	var newest int64
+	if before == 0 && found {
+		newest = profile.Version + 1
+	}
+	for _, c := range changes {
+		if newest > 0 {
+			for v := c.Version + 1; v < newest; v++ {
+				page.MissingVersions = append(page.MissingVersions, v)
+			}
+		}
+		newest = c.Version
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// RollbackProfile restores the values a profile had before one of its
+// changes, as a new change; the history itself is never rewritten.
+// Rolling back the change that created the profile answers 409.
+// POST /v1/profile/{phoneNumber}/rollback/{historyId}
+func (h *Handler) RollbackProfile(w http.ResponseWriter, r *http.Request) {
+	if h.profileHistory == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "profile history is not configured")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/profile/")
+	phoneNumber, changeID, ok := strings.Cut(rest, "/rollback/")
+	phoneNumber = strings.TrimSpace(phoneNumber)
+	changeID = strings.TrimSpace(changeID)
+	if !ok || phoneNumber == "" || strings.Contains(phoneNumber, "/") {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+	if changeID == "" || strings.Contains(changeID, "/") {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid historyId")
+		return
+	}
+
+	restored, change, err := h.profileHistory.As(ClientIP(r)).Rollback(phoneNumber, changeID)
+	if errors.Is(err, store.ErrNothingToRestore) {
+		writeError(w, http.StatusConflict, "CONFLICT", "the change created the profile, so there are no earlier values to restore")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "roll back profile")
+		return
+	}
+	writeJSON(w, http.StatusOK, profileRollbackResponse{Profile: newProfileResponse(restored), Change: change})
+}
+
+// encodeVersionCursor builds an opaque cursor continuing a profile's
+// history below version.
+func encodeVersionCursor(version int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(version, 10)))
+}
+
+// decodeVersionCursor parses a cursor produced by encodeVersionCursor.
+func decodeVersionCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || v <= 0 {
+		return 0, errors.New("malformed cursor")
+	}
+	return v, nil
+}
@@ -0,0 +1,232 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// Merge precedences: whose value a merged profile keeps for a field both
+// profiles have a value of their own for.
+const (
+	mergePreferTarget = "target"
+	mergePreferSource = "source"
+	mergePreferNewest = "newest" // The profile updated last
+)
+
+// maxProfileRedirects bounds how many merges GET /v1/profile/{phoneNumber}
+// follows, a profile merged into one that was merged in turn.
+const maxProfileRedirects = 5
+
+// mergeProfilesRequest is the body of POST /v1/admin/profiles/merge.
+type mergeProfilesRequest struct {
+	Source string `json:"source"` // Number whose profile is merged and then redirects to target
+	Target string `json:"target"` // Number whose profile is kept
+	Prefer string `json:"prefer"` // Precedence where both have a value: target (default), source or newest
+}
+
+func (req *mergeProfilesRequest) validate() error {
+	req.Source = strings.TrimSpace(req.Source)
+	req.Target = strings.TrimSpace(req.Target)
+	req.Prefer = strings.ToLower(strings.TrimSpace(req.Prefer))
+	if req.Prefer == "" {
+		req.Prefer = mergePreferTarget
+	}
+
+	switch {
+	case req.Source == "" || req.Target == "":
+		return errors.New("source and target are required")
+	case strings.Contains(req.Source, "/") || strings.Contains(req.Target, "/"):
+		return errors.New("invalid phoneNumber")
+	case req.Source == req.Target:
+		return errors.New("cannot merge a profile into itself")
+	case req.Prefer != mergePreferTarget && req.Prefer != mergePreferSource && req.Prefer != mergePreferNewest:
+		return errors.New("prefer must be one of target, source, newest")
+	}
+	return nil
+}
+
+// mergeProfilesResponse is the outcome of POST /v1/admin/profiles/merge.
+type mergeProfilesResponse struct {
+	Profile          profileResponse `json:"profile"`          // The merged target profile
+	Source           string          `json:"source"`           // Now redirecting to the target
+	FromSource       []string        `json:"fromSource"`       // Fields whose value came from the source profile
+	PreferencesMoved int             `json:"preferencesMoved"` // Accounts whose conversation preferences of source moved to target
+}
+
+// MergeProfiles merges the profile of one number into the profile of
+// another, for duplicate contacts such as one person stored under two
+// formats of a number. For each field the richer value wins: a value over
+// none, and a name over one that is just the profile's number, as
+// automatically created profiles have. Where both profiles have a value,
+// prefer decides. Conversation preferences of the source are moved to the
+// target in every account; its messages stay under their number.
+//
+// The source profile is kept as a redirect: it stops changing, and
+// GET /v1/profile/{source} answers with the target profile and movedTo.
+// Merging a profile into itself, or one that was merged already or into
+// one that was, is rejected.
+// POST /v1/admin/profiles/merge
+func (h *Handler) MergeProfiles(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req mergeProfilesRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+
+	source, err := h.profileStore.GetProfile(req.Source)
+	if err != nil {
+		writeStoreError(w, err, "retrieve profile")
+		return
+	}
+	target, err := h.profileStore.GetProfile(req.Target)
+	if err != nil {
+		writeStoreError(w, err, "retrieve profile")
+		return
+	}
+	if source.MovedTo != "" {
+		writeErrorDetails(w, http.StatusConflict, "CONFLICT", "source profile was already merged", map[string]any{"movedTo": source.MovedTo})
+		return
+	}
+	if target.MovedTo != "" {
+		writeErrorDetails(w, http.StatusConflict, "CONFLICT", "cannot merge into a profile that was merged; merge into its movedTo", map[string]any{"movedTo": target.MovedTo})
+		return
+	}
+
+	merged, fromSource := mergeProfiles(target, source, req.Prefer)
+	writer := h.profileWriter(r)
+	updated, err := writer.UpdateProfileIfVersion(req.Target, merged, target.Version)
+	var conflict *store.VersionConflictError
+	if errors.As(err, &conflict) {
+		writeErrorDetails(w, http.StatusConflict, "CONFLICT", "target profile changed during the merge; retry it", conflict)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "update profile")
+		return
+	}
+
+	moved := 0
+	if h.preferenceStore != nil {
+		if moved, err = h.preferenceStore.MovePreferences(req.Source, req.Target); err != nil {
+			log.Printf("Failed to move preferences of merged profile %s to %s: %v", req.Source, req.Target, err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not move conversation preferences; merge again to retry")
+			return
+		}
+	}
+
+	// Redirecting fails if a concurrent merge of the source redirected it
+	// first; the target keeps the values merged into it regardless
+	if _, err := writer.RedirectProfile(req.Source, req.Target); err != nil {
+		writeStoreError(w, err, "redirect profile")
+		return
+	}
+
+	if h.audit != nil {
+		if _, err := h.audit.RecordAudit(models.AuditEntry{
+			At:          h.Clock().Now(),
+			AccountID:   accountID(r),
+			Actor:       ClientIP(r),
+			Action:      models.AuditProfileMerged,
+			PhoneNumber: req.Target,
+			Details: map[string]any{
+				"source":           req.Source,
+				"target":           req.Target,
+				"prefer":           req.Prefer,
+				"fromSource":       fromSource,
+				"preferencesMoved": moved,
+			},
+		}); err != nil {
+			log.Printf("Failed to audit merge of profile %s into %s: %v", req.Source, req.Target, err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, mergeProfilesResponse{
+		Profile:          newProfileResponse(updated),
+		Source:           req.Source,
+		FromSource:       fromSource,
+		PreferencesMoved: moved,
+	})
+}
+
+// mergeProfiles returns the values target keeps merging source into it,
+// with the names of the fields taken from source.
+func mergeProfiles(target, source models.Profile, prefer string) (models.Profile, []string) {
+	preferSource := prefer == mergePreferSource ||
+		prefer == mergePreferNewest && source.UpdatedAt.After(target.UpdatedAt)
+
+	merged := models.Profile{Name: target.Name, Avatar: target.Avatar}
+	fromSource := []string{}
+	if sourceWins(nameRichness(source), nameRichness(target), preferSource) {
+		merged.Name = source.Name
+		fromSource = append(fromSource, "name")
+	}
+	if sourceWins(avatarRichness(source), avatarRichness(target), preferSource) {
+		merged.Avatar = source.Avatar
+		fromSource = append(fromSource, "avatar")
+	}
+	// A merge of two automatically created profiles is automatic still
+	if target.Source == models.ProfileSourceAuto && source.Source == models.ProfileSourceAuto {
+		merged.Source = models.ProfileSourceAuto
+	}
+	return merged, fromSource
+}
+
+// sourceWins reports whether the source value of richness source wins over
+// the target value of richness target. Only two values of their own tie,
+// for preferSource to decide.
+func sourceWins(source, target int, preferSource bool) bool {
+	if source != target {
+		return source > target
+	}
+	return source == richnessValue && preferSource
+}
+
+// Richness of a profile field's value.
+const (
+	richnessNone   = iota
+	richnessNumber // The profile's own number, named after it on creation
+	richnessValue
+)
+
+func nameRichness(p models.Profile) int {
+	switch name := strings.TrimSpace(p.Name); name {
+	case "":
+		return richnessNone
+	case p.PhoneNumber:
+		return richnessNumber
+	default:
+		return richnessValue
+	}
+}
+
+func avatarRichness(p models.Profile) int {
+	if strings.TrimSpace(p.Avatar) == "" {
+		return richnessNone
+	}
+	return richnessValue
+}
+
+// followProfileMoves returns the profile profile was merged into, following
+// up to maxProfileRedirects merges, with MovedTo set to its number. A
+// profile never merged is returned as it is.
+func (h *Handler) followProfileMoves(profile models.Profile) (models.Profile, error) {
+	for hops := 0; profile.MovedTo != "" && hops < maxProfileRedirects; hops++ {
+		next, err := h.profileStore.GetProfile(profile.MovedTo)
+		if err != nil {
+			return models.Profile{}, err
+		}
+		if next.MovedTo == "" {
+			next.MovedTo = next.PhoneNumber
+			return next, nil
+		}
+		profile = next
+	}
+	return profile, nil
+}
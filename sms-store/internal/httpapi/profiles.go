@@ -0,0 +1,190 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// createProfileRequest is the body of POST /v1/profile.
+type createProfileRequest models.Profile
+
+func (req *createProfileRequest) validate() error {
+	req.PhoneNumber = strings.TrimSpace(req.PhoneNumber)
+	req.Name = strings.TrimSpace(req.Name)
+	req.Avatar = strings.TrimSpace(req.Avatar)
+	req.Source = ""  // Created by a person
+	req.MovedTo = "" // Set only by a merge
+
+	switch {
+	case req.PhoneNumber == "":
+		return errors.New("phoneNumber is required")
+	case strings.Contains(req.PhoneNumber, "/"): // Would allow path traversal
+		return errors.New("invalid phoneNumber")
+	}
+	return nil
+}
+
+// updateProfileRequest is the body of PUT /v1/profile/{phoneNumber}.
+type updateProfileRequest struct {
+	models.Profile
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"` // Update only a profile still at this version, as If-Match does
+}
+
+// GetProfile retrieves a profile by phone number. The ETag is the profile's
+// version, for If-Match on PUT. A number whose profile was merged into
+// another's answers with that one, its number in movedTo.
+// GET /v1/profile/{phoneNumber}
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	phoneNumber, ok := pathParam(r.URL.Path, "/v1/profile/", "")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	profile, err := h.profileStore.GetProfile(phoneNumber)
+	if err == nil {
+		profile, err = h.followProfileMoves(profile)
+	}
+	if err != nil {
+		writeStoreError(w, err, "retrieve profile")
+		return
+	}
+
+	w.Header().Set("ETag", profileETag(profile.Version))
+	writeJSON(w, http.StatusOK, newProfileResponse(profile))
+}
+
+// UpdateProfile updates an existing profile. With an If-Match header or an
+// expectedVersion in the body it updates only a profile still at that
+// version, and answers 412 with the current version otherwise, so two
+// editors of one profile can't overwrite each other unknowingly. Without
+// either the last write wins.
+// PUT /v1/profile/{phoneNumber}
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	phoneNumber, ok := pathParam(r.URL.Path, "/v1/profile/", "")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	var req updateProfileRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	expected, err := expectedProfileVersion(r.Header.Get("If-Match"), req.ExpectedVersion)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	// Trim and validate fields
+	profile := req.Profile
+	profile.Name = strings.TrimSpace(profile.Name)
+	profile.Avatar = strings.TrimSpace(profile.Avatar)
+	profile.Source = "" // Edited by a person
+
+	var updated models.Profile
+	if expected != nil {
+		updated, err = h.profileWriter(r).UpdateProfileIfVersion(phoneNumber, profile, *expected)
+	} else {
+		updated, err = h.profileWriter(r).UpdateProfile(phoneNumber, profile)
+	}
+	var conflict *store.VersionConflictError
+	if errors.As(err, &conflict) {
+		w.Header().Set("ETag", profileETag(conflict.Current))
+		writeErrorDetails(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "profile has changed since the expected version", conflict)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "update profile")
+		return
+	}
+
+	w.Header().Set("ETag", profileETag(updated.Version))
+	writeJSON(w, http.StatusOK, newProfileResponse(updated))
+}
+
+// profileETag returns the ETag of a profile at version.
+func profileETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// expectedProfileVersion returns the version an update is conditional on,
+// from an If-Match header or the body's expectedVersion, or nil for an
+// unconditional update. If-Match: * matches any existing profile, as it
+// would without the header.
+func expectedProfileVersion(ifMatch string, bodyVersion *int64) (*int64, error) {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return bodyVersion, nil
+	}
+
+	raw, ok := strings.CutPrefix(ifMatch, `"`)
+	raw, closed := strings.CutSuffix(raw, `"`)
+	version, err := strconv.ParseInt(raw, 10, 64)
+	if !ok || !closed || err != nil || version < 0 {
+		return nil, errors.New(`If-Match must be the ETag of one profile version, such as "3"`)
+	}
+	if bodyVersion != nil && *bodyVersion != version {
+		return nil, errors.New("If-Match and expectedVersion disagree")
+	}
+	return &version, nil
+}
+
+// CreateProfile creates a new profile.
+// POST /v1/profile
+func (h *Handler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	var req createProfileRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+
+	created, err := h.createProfile(h.profileWriter(r), models.Profile(req))
+	if errors.Is(err, store.ErrAlreadyExists) {
+		h.writeProfileConflict(w, req.PhoneNumber)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "create profile")
+		return
+	}
+
+	writeCreated(w, profileURL(created.PhoneNumber), newProfileResponse(created))
+}
+
+// createProfile creates profile in ps. A number with only an automatically
+// created profile has none a person made, so that one is replaced rather
+// than reported as a conflict.
+func (h *Handler) createProfile(ps store.ProfileStore, profile models.Profile) (models.Profile, error) {
+	created, err := ps.CreateProfile(profile)
+	if !errors.Is(err, store.ErrAlreadyExists) {
+		return created, err
+	}
+	existing, getErr := ps.GetProfile(profile.PhoneNumber)
+	if getErr != nil || existing.Source != models.ProfileSourceAuto {
+		return models.Profile{}, err
+	}
+	return ps.UpdateProfile(profile.PhoneNumber, profile)
+}
+
+// writeProfileConflict answers a duplicate create with 409 and the existing profile's createdAt,
+// so a client that double-submitted can tell its first request succeeded.
+func (h *Handler) writeProfileConflict(w http.ResponseWriter, phoneNumber string) {
+	message := "profile already exists for phone number: " + phoneNumber
+
+	existing, err := h.profileStore.GetProfile(phoneNumber)
+	if err != nil {
+		writeError(w, http.StatusConflict, "CONFLICT", message)
+		return
+	}
+
+	writeErrorDetails(w, http.StatusConflict, "CONFLICT", message, map[string]any{
+		"phoneNumber": existing.PhoneNumber,
+		"createdAt":   existing.CreatedAt,
+	})
+}
@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sms-store/internal/store"
+)
+
+func TestConcurrentCreateProfileOneCreatedRestConflict(t *testing.T) {
+	profiles := store.NewMemoryProfileStore()
+	h := NewHandler(store.NewMemoryStore(), profiles)
+
+	const attempts = 50
+	codes := make([]int, attempts)
+	bodies := make([]string, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/v1/profile", strings.NewReader(`{"phoneNumber": "9876543210", "name": "Ram"}`))
+			w := httptest.NewRecorder()
+			h.CreateProfile(w, r)
+			codes[i], bodies[i] = w.Code, w.Body.String()
+		}()
+	}
+	wg.Wait()
+
+	existing, err := profiles.GetProfile("9876543210")
+	if err != nil {
+		t.Fatalf("GetProfile after concurrent creates: %v", err)
+	}
+	created, conflicts := 0, 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+			var resp struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+				Details struct {
+					CreatedAt time.Time `json:"createdAt"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal([]byte(bodies[i]), &resp); err != nil {
+				t.Fatalf("409 body %s: %v", bodies[i], err)
+			}
+			if resp.Code != "CONFLICT" || resp.Message != "profile already exists for phone number: 9876543210" {
+				t.Fatalf("409 body = %s, want a clean CONFLICT message", bodies[i])
+			}
+			if !resp.Details.CreatedAt.Equal(existing.CreatedAt) {
+				t.Fatalf("409 createdAt = %v, want the existing profile's %v", resp.Details.CreatedAt, existing.CreatedAt)
+			}
+		default:
+			t.Fatalf("create %d answered %d: %s", i, code, bodies[i])
+		}
+	}
+	if created != 1 || conflicts != attempts-1 {
+		t.Fatalf("%d created and %d conflicts, want 1 and %d", created, conflicts, attempts-1)
+	}
+}
+
+func TestConcurrentUpdatesOfOneVersionOneWinsOtherPreconditionFails(t *testing.T) {
+	profiles := store.NewMemoryProfileStore()
+	h := NewHandler(store.NewMemoryStore(), profiles)
+	routes := h.Routes()
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/profile", strings.NewReader(`{"phoneNumber": "9876543210", "name": "Ram"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /v1/profile = %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/profile/9876543210", nil))
+	etag := w.Header().Get("ETag")
+
+	// Both editors read the same version and save their edits together
+	names := []string{"Ram K.", "Ramakrishnan"}
+	codes := make([]int, len(names))
+	bodies := make([]string, len(names))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPut, "/v1/profile/9876543210", strings.NewReader(`{"name": "`+name+`"}`))
+			r.Header.Set("If-Match", etag)
+			w := httptest.NewRecorder()
+			<-start
+			routes.ServeHTTP(w, r)
+			codes[i], bodies[i] = w.Code, w.Body.String()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	winner := slices.Index(codes, http.StatusOK)
+	loser := slices.Index(codes, http.StatusPreconditionFailed)
+	if winner < 0 || loser < 0 {
+		t.Fatalf("updates answered %v: %v; want one 200 and one 412", codes, bodies)
+	}
+	var resp struct {
+		Code    string                     `json:"code"`
+		Details store.VersionConflictError `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(bodies[loser]), &resp); err != nil {
+		t.Fatalf("412 body %s: %v", bodies[loser], err)
+	}
+	if resp.Code != "PRECONDITION_FAILED" || resp.Details.Current != resp.Details.Expected+1 {
+		t.Fatalf("412 body = %s, want PRECONDITION_FAILED at the winner's version", bodies[loser])
+	}
+	if p, err := profiles.GetProfile("9876543210"); err != nil || p.Name != names[winner] {
+		t.Fatalf("profile = %+v, %v; want the winner's name %q", p, err, names[winner])
+	}
+}
@@ -0,0 +1,144 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/store"
+)
+
+const quotaReconcileJobType = "reconcile_quotas"
+
+// SetQuotas attaches the store enforcing per-account message quotas.
+// Quota endpoints answer 501 until one is set.
+func (h *Handler) SetQuotas(q *store.QuotaEnforcingStore) {
+	h.quotas = q
+}
+
+// accountQuotaResponse is an account's storage usage against its quota.
+type accountQuotaResponse struct {
+	AccountID    string     `json:"accountId"`
+	Messages     int64      `json:"messages"`
+	Limit        int64      `json:"limit"`        // 0 is unlimited
+	DefaultLimit bool       `json:"defaultLimit"` // The account has no limit of its own
+	Remaining    *int64     `json:"remaining"`    // Null when unlimited
+	Exceeded     bool       `json:"exceeded"`     // At or past the limit, so writes are rejected
+	ReconciledAt *time.Time `json:"reconciledAt,omitempty"`
+}
+
+// setQuotaRequest is the body of PUT /v1/admin/accounts/{id}/quota. A null
+// or missing limit returns the account to the default limit.
+type setQuotaRequest struct {
+	Limit *int64 `json:"limit"`
+}
+
+// AccountQuota reports an account's stored messages against its quota, or
+// sets its limit with PUT. Requires the admin scope.
+// GET /v1/admin/accounts/{id}/quota
+// PUT /v1/admin/accounts/{id}/quota
+func (h *Handler) AccountQuota(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.quotas == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "quotas are not configured")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/admin/accounts/")
+	accountID, ok := strings.CutSuffix(rest, "/quota")
+	accountID = strings.TrimSpace(accountID)
+	if !ok || accountID == "" || strings.Contains(accountID, "/") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "route not found")
+		return
+	}
+
+	var q store.AccountQuota
+	var err error
+	if r.Method == http.MethodPut {
+		var req setQuotaRequest
+		if !h.decodeJSON(w, r, &req) {
+			return
+		}
+		if req.Limit != nil && *req.Limit < 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be 0 (unlimited) or more")
+			return
+		}
+		q, err = h.quotas.SetLimit(accountID, req.Limit)
+	} else {
+		q, err = h.quotas.Quota(accountID)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve quota")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.quotaResponse(q))
+}
+
+func (h *Handler) quotaResponse(q store.AccountQuota) accountQuotaResponse {
+	resp := accountQuotaResponse{
+		AccountID:    q.AccountID,
+		Messages:     q.Messages,
+		Limit:        h.quotas.EffectiveLimit(q),
+		DefaultLimit: q.Limit == nil,
+		ReconciledAt: q.ReconciledAt,
+	}
+	if resp.Limit > 0 {
+		remaining := max(resp.Limit-q.Messages, 0)
+		resp.Remaining = &remaining
+		resp.Exceeded = q.Messages >= resp.Limit
+	}
+	return resp
+}
+
+// StartQuotaReconcile recounts every account's messages in the background,
+// correcting counters that drifted. Requires the admin scope.
+// POST /v1/admin/quotas/reconcile
+func (h *Handler) StartQuotaReconcile(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.quotas == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "quotas are not configured")
+		return
+	}
+
+	job, err := h.SubmitQuotaReconcile()
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start quota reconciliation")
+		return
+	}
+
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": "Quota reconciliation started",
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+// SubmitQuotaReconcile starts a job reconciling the quota counters, or
+// returns the one already running with jobs.ErrAlreadyRunning. It is also
+// called on a schedule.
+func (h *Handler) SubmitQuotaReconcile() (jobs.Job, error) {
+	if h.quotas == nil {
+		return jobs.Job{}, errors.New("quotas are not configured")
+	}
+	return h.jobs.Submit(quotaReconcileJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		result, err := h.quotas.Reconcile()
+		if err != nil {
+			return nil, err
+		}
+		p.Add(int64(result.Accounts))
+		return map[string]any{
+			"accounts":  result.Accounts,
+			"corrected": result.Corrected,
+			"drift":     result.Drift,
+			"skipped":   result.Skipped,
+		}, nil
+	})
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-store/internal/store"
+)
+
+// SetRawEventStore attaches the store of captured event payloads.
+// GET /v1/admin/messages/{id}/raw answers 501 until one is set.
+func (h *Handler) SetRawEventStore(rs store.RawEventStore) {
+	h.rawEvents = rs
+}
+
+// GetRawEvent answers the payload the event that made a message arrived
+// with, decompressed, with the content type it arrived with. Where it came
+// from is in X-Raw-* headers; X-Raw-Truncated: true means only its first
+// bytes, of X-Raw-Size, were kept.
+// GET /v1/admin/messages/{id}/raw
+func (h *Handler) GetRawEvent(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.rawEvents == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "raw event capture is not configured")
+		return
+	}
+
+	id, ok := pathParam(r.URL.Path, "/v1/admin/messages/", "/raw")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return
+	}
+
+	event, err := h.rawEvents.GetRawEvent(id)
+	if err != nil {
+		writeStoreError(w, err, "retrieve raw event")
+		return
+	}
+	payload := event.Payload
+	if event.ContentEncoding == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err == nil {
+			payload, err = io.ReadAll(zr)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not decompress raw event")
+			return
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", event.ContentType)
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Raw-Source", event.Source)
+	header.Set("X-Raw-Topic", event.Topic)
+	header.Set("X-Raw-Partition", strconv.Itoa(int(event.Partition)))
+	header.Set("X-Raw-Offset", strconv.FormatInt(event.Offset, 10))
+	header.Set("X-Raw-Size", strconv.Itoa(event.Size))
+	header.Set("X-Raw-Truncated", strconv.FormatBool(event.Truncated))
+	header.Set("X-Raw-Captured-At", event.CapturedAt.UTC().Format(time.RFC3339Nano))
+	header.Set("Expires", event.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(payload); err != nil {
+		recordWriteError(w, err)
+	}
+}
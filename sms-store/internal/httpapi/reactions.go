@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	maxEmojiBytes   = 64 // Longer than the longest ZWJ sequence in use
+	maxActorLength  = 128
+	zeroWidthJoiner = '\u200d'
+	combiningKeycap = '\u20e3'
+)
+
+type reactionRequest struct {
+	Emoji string `json:"emoji"`
+	Actor string `json:"actor"`
+}
+
+func (req *reactionRequest) validate() error {
+	req.Actor = strings.TrimSpace(req.Actor)
+	if req.Actor == "" || utf8.RuneCountInString(req.Actor) > maxActorLength {
+		return fmt.Errorf("actor is required and at most %d characters", maxActorLength)
+	}
+	if !validReactionEmoji(req.Emoji) {
+		return errors.New("emoji must be a single emoji or character")
+	}
+	return nil
+}
+
+type reactionsResponse struct {
+	MessageID string            `json:"messageId"`
+	Reactions []models.Reaction `json:"reactions"` // Oldest first
+	Counts    map[string]int    `json:"counts"`
+}
+
+// AddReaction tags a message with an emoji on behalf of an actor. Adding
+// the same emoji again for the actor changes nothing. A message keeps at
+// most store.MaxReactionsPerMessage reactions.
+// POST /messages/{id}/reactions
+func (h *Handler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	id, req, ok := h.reactionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := h.store.AddReaction(id, models.Reaction{Emoji: req.Emoji, Actor: req.Actor, CreatedAt: h.Clock().Now().UTC()})
+	switch {
+	case errors.Is(err, store.ErrTooManyReactions):
+		writeError(w, http.StatusConflict, "CONFLICT", fmt.Sprintf("message already has %d reactions", store.MaxReactionsPerMessage))
+		return
+	case err != nil:
+		writeReactionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newReactionsResponse(msg))
+}
+
+// RemoveReaction takes an actor's emoji off a message. Removing a reaction
+// the message doesn't have changes nothing.
+// DELETE /messages/{id}/reactions
+func (h *Handler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	id, req, ok := h.reactionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := h.store.RemoveReaction(id, req.Emoji, req.Actor)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newReactionsResponse(msg))
+}
+
+// reactionRequest reads the message ID from the path and the reaction from
+// the body, answering 400 when either is invalid.
+func (h *Handler) reactionRequest(w http.ResponseWriter, r *http.Request) (string, reactionRequest, bool) {
+	id, ok := messagePathID(r.URL.Path, "/reactions")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return "", reactionRequest{}, false
+	}
+
+	var req reactionRequest
+	if !h.decodeValid(w, r, &req) {
+		return "", reactionRequest{}, false
+	}
+	return id, req, true
+}
+
+func writeReactionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "message not found")
+		return
+	}
+	writeStoreError(w, err, "update reactions")
+}
+
+func newReactionsResponse(msg models.Message) reactionsResponse {
+	resp := reactionsResponse{MessageID: msg.ID, Reactions: msg.Reactions, Counts: msg.ReactionCounts}
+	if resp.Reactions == nil {
+		resp.Reactions = []models.Reaction{}
+	}
+	if resp.Counts == nil {
+		resp.Counts = map[string]int{}
+	}
+	return resp
+}
+
+// validReactionEmoji reports whether s is a single grapheme cluster of the
+// kinds emoji are written as: a character followed by its modifiers
+// (variation selectors, skin tones, tags, combining marks), characters
+// like that joined by zero-width joiners, or a flag's pair of regional
+// indicators. ASCII is only accepted as the base of a keycap such as 1️⃣,
+// which also keeps "." and "$" out of the store's per-emoji counts.
+func validReactionEmoji(s string) bool {
+	if s == "" || len(s) > maxEmojiBytes || !utf8.ValidString(s) {
+		return false
+	}
+	runes := []rune(s)
+	if isRegionalIndicator(runes[0]) {
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	}
+	if runes[0] < utf8.RuneSelf && !isKeycap(runes) {
+		return false
+	}
+
+	for i := 0; ; {
+		base := runes[i]
+		if i > 0 && base < utf8.RuneSelf {
+			return false
+		}
+		if !unicode.IsGraphic(base) || unicode.IsSpace(base) || isEmojiExtender(base) || isRegionalIndicator(base) {
+			return false
+		}
+		for i++; i < len(runes) && isEmojiExtender(runes[i]); i++ {
+		}
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner || i+1 == len(runes) {
+			return false
+		}
+		i++
+	}
+}
+
+// isEmojiExtender reports whether r extends the character before it into
+// the same grapheme cluster.
+func isEmojiExtender(r rune) bool {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me): // Includes variation selectors and the keycap
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // Skin tone modifiers
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // Tags of subdivision flags
+		return true
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isKeycap reports whether runes are a keycap: 0-9, # or *, an optional
+// variation selector and the combining keycap.
+func isKeycap(runes []rune) bool {
+	if !strings.ContainsRune("0123456789#*", runes[0]) {
+		return false
+	}
+	switch len(runes) {
+	case 2:
+		return runes[1] == combiningKeycap
+	case 3:
+		return runes[1] == '\ufe0f' && runes[2] == combiningKeycap
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// SetReadCursorStore attaches the per-conversation read cursors. Until one
+// is set, marking read answers 501 and conversations carry no unread count.
+func (h *Handler) SetReadCursorStore(rs store.ReadCursorStore) {
+	h.readCursors = rs
+}
+
+// markReadRequest is the optional body of POST /v1/user/{phoneNumber}/read.
+type markReadRequest struct {
+	UpTo *time.Time `json:"upTo,omitempty"` // Defaults to the newest message
+}
+
+// readCursorResponse is a conversation's read cursor and what is unread past it.
+type readCursorResponse struct {
+	PhoneNumber       string     `json:"phoneNumber"`
+	LastReadMessageAt *time.Time `json:"lastReadMessageAt"` // Null until the conversation is first marked read
+	UnreadCount       int64      `json:"unreadCount"`
+}
+
+// MarkRead moves the conversation's read cursor, shared by every device of
+// the account, up to the body's upTo or to its newest message.
+// POST /v1/user/{phoneNumber}/read
+//
+// The cursor never moves backwards: marking read up to a time before the
+// cursor, as a device that is behind would, leaves it where it is. upTo is
+// capped at the newest message, so a fast clock can't mark messages that
+// haven't arrived yet as read.
+func (h *Handler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	if h.readCursors == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "read cursors are not configured")
+		return
+	}
+
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/read")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	var req markReadRequest
+	if r.ContentLength != 0 && !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	newest, err := h.store.FindByPhoneNumberPage(phoneNumber, store.PageQuery{Limit: 1})
+	if err != nil {
+		writeStoreError(w, err, "retrieve messages")
+		return
+	}
+
+	account := accountID(r)
+	var cursor models.ReadCursor
+	if len(newest) == 0 {
+		// Nothing to read; the cursor is reported as it is
+		cursors, err := h.readCursors.ListReadCursors(account, []string{phoneNumber})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve read cursor")
+			return
+		}
+		cursor = cursors[phoneNumber]
+	} else {
+		upTo := newest[0].CreatedAt
+		if req.UpTo != nil && req.UpTo.Before(upTo) {
+			upTo = *req.UpTo
+		}
+		if cursor, err = h.readCursors.MarkRead(account, phoneNumber, upTo); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not mark conversation read")
+			return
+		}
+	}
+
+	resp := readCursorResponse{PhoneNumber: phoneNumber}
+	if !cursor.LastReadMessageAt.IsZero() {
+		resp.LastReadMessageAt = &cursor.LastReadMessageAt
+		counts, err := h.store.CountAfter(map[string]time.Time{phoneNumber: cursor.LastReadMessageAt})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not count unread messages")
+			return
+		}
+		resp.UnreadCount = counts[phoneNumber]
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// withUnreadCounts sets the read cursor and unread count of the direct
+// conversations among convs, whose summaries are already filled in. A
+// conversation never marked read has all of its messages unread.
+//
+// The summaries answer most conversations without a query: one never
+// marked read has its whole MessageCount unread, and one read up to its
+// summary's LastMessageAt, which only counted messages move, has none.
+// Only conversations with messages past their cursor are counted.
+func (h *Handler) withUnreadCounts(r *http.Request, convs []conversationWithPreferences) error {
+	cursors, err := h.readCursors.ListReadCursors(accountID(r), directPhoneNumbers(convs))
+	if err != nil {
+		return err
+	}
+	after := make(map[string]time.Time, len(cursors))
+	for _, c := range convs {
+		cursor, ok := cursors[c.PhoneNumber]
+		if !ok || c.Type != models.ConversationDirect {
+			continue
+		}
+		if c.Summary != nil && !c.Summary.LastMessageAt.After(cursor.LastReadMessageAt) {
+			continue // Read up to the newest counted message
+		}
+		after[c.PhoneNumber] = cursor.LastReadMessageAt
+	}
+	counts := map[string]int64{}
+	if len(after) > 0 {
+		if counts, err = h.store.CountAfter(after); err != nil {
+			return err
+		}
+	}
+
+	for i := range convs {
+		c := &convs[i]
+		if c.Type != models.ConversationDirect {
+			continue
+		}
+		var unread int64
+		if cursor, ok := cursors[c.PhoneNumber]; ok {
+			c.LastReadMessageAt = &cursor.LastReadMessageAt
+			unread = counts[c.PhoneNumber]
+		} else if c.Summary != nil {
+			unread = c.Summary.MessageCount
+		} else {
+			continue // No summary to count from yet
+		}
+		c.UnreadCount = &unread
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// countingStore records the phone numbers each CountAfter counts.
+type countingStore struct {
+	store.Store
+	counted [][]string
+}
+
+func (s *countingStore) CountAfter(after map[string]time.Time) (map[string]int64, error) {
+	phoneNumbers := make([]string, 0, len(after))
+	for pn := range after {
+		phoneNumbers = append(phoneNumbers, pn)
+	}
+	slices.Sort(phoneNumbers)
+	s.counted = append(s.counted, phoneNumbers)
+	return s.Store.CountAfter(after)
+}
+
+func TestConversationListUnreadCounts(t *testing.T) {
+	inner := store.NewMemoryStore()
+	summaries := store.NewMemorySummaryStore(inner)
+	s := &countingStore{Store: store.NewSummarizingStore(inner, summaries)}
+	h := NewHandler(s, store.NewMemoryProfileStore())
+	h.SetSummaryStore(summaries)
+	h.SetReadCursorStore(store.NewMemoryReadCursorStore())
+
+	start := time.Now().Add(-time.Hour)
+	n := 0
+	save := func(phoneNumber, source string) {
+		t.Helper()
+		n++
+		msg := models.Message{ID: fmt.Sprintf("m%d", n), PhoneNumber: phoneNumber, Text: "hello", Status: "SUCCESS", Source: source, CreatedAt: start.Add(time.Duration(n) * time.Second)}
+		if _, err := s.Save(msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.Routes().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s = %d: %s", method, path, w.Code, w.Body)
+		}
+		return w
+	}
+
+	// 1111111111 is never read; 2222222222 is read, then sent an automatic
+	// acknowledgement; 3333333333 is read, then gains two messages and an
+	// acknowledgement
+	for range 3 {
+		save("1111111111", "")
+	}
+	save("2222222222", "")
+	save("3333333333", "")
+	serve(http.MethodPost, "/v1/user/2222222222/read")
+	serve(http.MethodPost, "/v1/user/3333333333/read")
+	save("2222222222", models.MessageSourceAutoAck)
+	save("3333333333", "")
+	save("3333333333", models.MessageSourceAutoAck)
+	save("3333333333", "")
+	s.counted = nil
+
+	var convs []struct {
+		PhoneNumber       string     `json:"phoneNumber"`
+		LastReadMessageAt *time.Time `json:"lastReadMessageAt"`
+		UnreadCount       *int64     `json:"unreadCount"`
+	}
+	w := serve(http.MethodGet, "/v1/conversations?includeSummary=true")
+	if err := json.Unmarshal(w.Body.Bytes(), &convs); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	unread := map[string]int64{}
+	for _, c := range convs {
+		if c.UnreadCount == nil {
+			t.Fatalf("%s has no unreadCount", c.PhoneNumber)
+		}
+		if (c.LastReadMessageAt == nil) != (c.PhoneNumber == "1111111111") {
+			t.Fatalf("%s has lastReadMessageAt %v", c.PhoneNumber, c.LastReadMessageAt)
+		}
+		unread[c.PhoneNumber] = *c.UnreadCount
+	}
+	if fmt.Sprint(unread) != "map[1111111111:3 2222222222:0 3333333333:2]" {
+		t.Fatalf("unread counts = %v", unread)
+	}
+
+	// Only the conversation with messages past its cursor is counted; the
+	// summaries answer the others
+	if fmt.Sprint(s.counted) != "[[3333333333]]" {
+		t.Fatalf("CountAfter counted %v, want only 3333333333", s.counted)
+	}
+
+	// Once every conversation is read, the list runs no count at all
+	for _, pn := range []string{"1111111111", "3333333333"} {
+		serve(http.MethodPost, "/v1/user/"+pn+"/read")
+	}
+	s.counted = nil
+	serve(http.MethodGet, "/v1/conversations?includeSummary=true")
+	if len(s.counted) != 0 {
+		t.Fatalf("CountAfter counted %v with nothing unread", s.counted)
+	}
+}
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sms-store/internal/models"
+)
+
+// GetRefMessages lists the messages carrying an external reference, such as
+// an order, across all conversations, newest first.
+// GET /v1/refs/{type}/{id}/messages?limit=50&cursor=...
+func (h *Handler) GetRefMessages(w http.ResponseWriter, r *http.Request) {
+	ref, ok := refPath(r.URL.EscapedPath())
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "route not found")
+		return
+	}
+
+	page, err := parsePageQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	page.ExternalRef = &ref
+	limit := page.Limit
+	page.Limit = limit + 1
+	msgs, err := h.store.ListPage(page)
+	if err != nil {
+		writeStoreError(w, err, "retrieve messages")
+		return
+	}
+
+	resp := newMessagePage(msgs, limit)
+	if h.isCacheablePage(page, resp.Data) {
+		writeCacheableJSON(w, r, resp)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// refPath returns the reference of an escaped /v1/refs/{type}/{id}/messages
+// path. The segments are unescaped after splitting, so an ID may hold an
+// escaped slash.
+func refPath(path string) (models.ExternalRef, bool) {
+	rest, ok := strings.CutPrefix(path, "/v1/refs/")
+	if !ok {
+		return models.ExternalRef{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, "/messages")
+	if !ok {
+		return models.ExternalRef{}, false
+	}
+	rawType, rawID, ok := strings.Cut(rest, "/")
+	if !ok || strings.Contains(rawID, "/") {
+		return models.ExternalRef{}, false
+	}
+	refType, err := url.PathUnescape(rawType)
+	if err != nil {
+		return models.ExternalRef{}, false
+	}
+	id, err := url.PathUnescape(rawID)
+	if err != nil {
+		return models.ExternalRef{}, false
+	}
+	ref := models.ExternalRef{Type: strings.TrimSpace(refType), ID: strings.TrimSpace(id)}
+	if ref.Type == "" || ref.ID == "" {
+		return models.ExternalRef{}, false
+	}
+	return ref, true
+}
+
+// refQuery reads the ?refType= and ?refId= filter of a search, which are
+// given together or not at all.
+func refQuery(q url.Values) (*models.ExternalRef, error) {
+	ref := models.ExternalRef{Type: strings.TrimSpace(q.Get("refType")), ID: strings.TrimSpace(q.Get("refId"))}
+	switch {
+	case ref.Type == "" && ref.ID == "":
+		return nil, nil
+	case ref.Type == "" || ref.ID == "":
+		return nil, errors.New("refType and refId must be given together")
+	}
+	return &ref, nil
+}
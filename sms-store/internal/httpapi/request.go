@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"sms-store/internal/store"
+)
+
+// requestInfo is what a handler knows about a request beyond its path and
+// body: the scope it was granted, the account it acts on, where it came
+// from and the request ID its log lines carry.
+type requestInfo struct {
+	Scope     Scope
+	AccountID string
+	ClientIP  string
+	RequestID string // Empty unless w was wrapped by RequestContext
+}
+
+// requestInfo gathers the requestInfo of r.
+func (h *Handler) requestInfo(w http.ResponseWriter, r *http.Request) requestInfo {
+	_, requestID, _, _ := responseInfo(w)
+	return requestInfo{
+		Scope:     h.scope(r),
+		AccountID: accountID(r),
+		ClientIP:  ClientIP(r),
+		RequestID: requestID,
+	}
+}
+
+// pathParam returns the segment of path between prefix and suffix, trimmed
+// of spaces. It reports false when path doesn't have that shape, or the
+// segment is empty or holds a slash (to prevent path traversal).
+func pathParam(path, prefix, suffix string) (string, bool) {
+	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) || len(path) < len(prefix)+len(suffix) {
+		return "", false
+	}
+	param := strings.TrimSpace(path[len(prefix) : len(path)-len(suffix)])
+	if param == "" || strings.Contains(param, "/") {
+		return "", false
+	}
+	return param, true
+}
+
+// userPathPhoneNumber returns the phone number of a
+// /v1/user/{phoneNumber}{suffix} path.
+func userPathPhoneNumber(path, suffix string) (string, bool) {
+	return pathParam(path, "/v1/user/", suffix)
+}
+
+// messagePathID returns the message ID of a /messages/{id}{suffix} path.
+// Unlike phone numbers, IDs are taken as they are.
+func messagePathID(path, suffix string) (string, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(path, "/messages/"), suffix)
+	if id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+// validator is a request body that normalizes and checks itself once
+// decoded. The error's text is the message of the 400 answer.
+type validator interface {
+	validate() error
+}
+
+// decodeValid decodes the JSON body into dst and validates it, answering
+// 400 and returning false when either fails.
+func (h *Handler) decodeValid(w http.ResponseWriter, r *http.Request, dst validator) bool {
+	if !h.decodeJSON(w, r, dst) {
+		return false
+	}
+	if err := dst.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return false
+	}
+	return true
+}
+
+// writeStoreError answers a failed store call: 404 with the error's text
+// for store.ErrNotFound, 409 with it for store.ErrProfileMoved, 403 with
+// the quota for a *store.QuotaError, 422 with the limit for a
+// *store.ReadLimitError, 451 with the regions for a *store.RegionError,
+// and 500 "could not <action>" for anything else.
+func writeStoreError(w http.ResponseWriter, err error, action string) {
+	var quota *store.QuotaError
+	var readLimit *store.ReadLimitError
+	var region *store.RegionError
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, store.ErrProfileMoved):
+		writeError(w, http.StatusConflict, "CONFLICT", err.Error())
+	case errors.As(err, &quota):
+		writeErrorDetails(w, http.StatusForbidden, "QUOTA_EXCEEDED", "account is over its storage quota", quota)
+	case errors.As(err, &readLimit):
+		writeErrorDetails(w, http.StatusUnprocessableEntity, "RESULT_TOO_LARGE", "too many messages match to read at once; read them a page at a time with ?limit= and ?cursor=", readLimit)
+	case errors.As(err, &region):
+		writeErrorDetails(w, http.StatusUnavailableForLegalReasons, "REGION_NOT_ALLOWED", "the data is kept in a region this deployment does not serve", region)
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not "+action)
+	}
+}
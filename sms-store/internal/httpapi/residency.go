@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// regionOverride reports whether the request asked with
+// ?regionOverride=true to reach the data of every region rather than only
+// those the deployment's data residency allows. Overriding requires the
+// admin scope and is recorded in the audit log; without an audit log, or
+// when the entry can't be recorded, the request is refused. ok is false
+// once the response was written.
+func (h *Handler) regionOverride(w http.ResponseWriter, r *http.Request) (override, ok bool) {
+	if r.URL.Query().Get("regionOverride") != "true" {
+		return false, true
+	}
+	if !h.requireAdmin(w, r) {
+		return false, false
+	}
+	if h.audit == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "region overrides require the audit log")
+		return false, false
+	}
+	if _, err := h.audit.RecordAudit(models.AuditEntry{
+		At:        h.Clock().Now(),
+		AccountID: accountID(r),
+		Actor:     ClientIP(r),
+		Action:    models.AuditRegionOverride,
+		Details:   map[string]any{"method": r.Method, "path": r.URL.Path},
+	}); err != nil {
+		log.Printf("Failed to audit region override of %s %s: %v", r.Method, r.URL.Path, err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not record region override")
+		return false, false
+	}
+	return true, true
+}
+
+// messageStore returns the message store of a request, serving every
+// region when it overrides residency.
+func (h *Handler) messageStore(override bool) store.Store {
+	if override {
+		return store.Unscoped(h.store)
+	}
+	return h.store
+}
@@ -0,0 +1,182 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// newResidencyTestHandler returns a handler serving region in over a store
+// that also holds messages of eu: eu1 of 2222222222 and in1 of 1111111111.
+// It has a read, a write and an admin key like newScopesTestHandler.
+func newResidencyTestHandler(t *testing.T) (*Handler, store.Store) {
+	t.Helper()
+	inner := store.NewMemoryStore()
+	for _, msg := range []models.Message{
+		{ID: "in1", PhoneNumber: "1111111111", Text: "hello", Region: "in"},
+		{ID: "eu1", PhoneNumber: "2222222222", Text: "hello", AccountID: "acme", Region: "eu"},
+	} {
+		msg.Status = "SUCCESS"
+		msg.CreatedAt = time.Now().Add(-time.Minute)
+		if _, err := inner.Save(msg); err != nil {
+			t.Fatalf("Save %s: %v", msg.ID, err)
+		}
+	}
+	residency := store.Residency{Allowed: []string{"in"}, DefaultRegion: "in", Accounts: map[string]string{"acme": "eu"}}
+
+	config := DefaultHandlerConfig()
+	config.AdminAPIKey = "admin-key"
+	config.APIKeys = map[string]Scope{"read-key": ScopeRead, "write-key": ScopeWrite}
+	return NewHandlerWithConfig(store.NewRegionScopedStore(inner, residency), store.NewMemoryProfileStore(), config), inner
+}
+
+// serveResidency sends a request with key through the routes of h.
+func serveResidency(h *Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+key)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.Authorize(h.Routes()).ServeHTTP(w, r)
+	return w
+}
+
+func TestResidencyRefusesForeignData(t *testing.T) {
+	h, _ := newResidencyTestHandler(t)
+	for _, tt := range []struct {
+		method, path, key, body string
+	}{
+		{http.MethodGet, "/messages/eu1", "read-key", ""},
+		{http.MethodGet, "/messages/eu1/translations", "read-key", ""},
+		{http.MethodPatch, "/messages/eu1", "write-key", `{"participantId": "amma"}`},
+		{http.MethodPut, "/messages/eu1/translations/hi", "write-key", `{"text": "namaste"}`},
+		{http.MethodGet, "/messages/eu1/thread", "read-key", ""},
+		{http.MethodPost, "/messages/eu1/reactions", "write-key", `{"emoji": "👍", "actor": "agent"}`},
+		{http.MethodPost, "/messages/eu1/annotations", "write-key", `{"source": "clf", "label": "complaint", "confidence": 0.9}`},
+		{http.MethodPost, "/messages/eu1/annotations/clf/review", "write-key", `{"reviewer": "agent", "decision": "confirmed"}`},
+		{http.MethodPost, "/messages/eu1/forward", "write-key", `{"to": "9876543219"}`},
+		{http.MethodDelete, "/v1/user/2222222222/messages", "write-key", ""},
+		{http.MethodGet, "/v1/conversations", "read-key", ""}, // A store-wide read
+	} {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := serveResidency(h, tt.method, tt.path, tt.key, tt.body)
+			var resp struct {
+				Code    string            `json:"code"`
+				Details store.RegionError `json:"details"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%d %s: %v", w.Code, w.Body.String(), err)
+			}
+			if w.Code != http.StatusUnavailableForLegalReasons || resp.Code != "REGION_NOT_ALLOWED" || resp.Details.Region != "eu" {
+				t.Fatalf("= %d %s, want 451 REGION_NOT_ALLOWED of region eu", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if w := serveResidency(h, http.MethodGet, "/messages/in1", "read-key", ""); w.Code != http.StatusOK {
+		t.Fatalf("GET of a message of region in = %d %s", w.Code, w.Body.String())
+	}
+	if w := serveResidency(h, http.MethodGet, "/messages", "read-key", ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "eu1") {
+		t.Fatalf("GET /messages = %d %s, want 200 without eu1", w.Code, w.Body.String())
+	}
+}
+
+func TestRegionOverrideRequiresAdmin(t *testing.T) {
+	h, inner := newResidencyTestHandler(t)
+	h.SetAuditStore(store.NewMemoryAuditStore())
+
+	// Authorize lets nothing but admin keys reach DELETE /messages, so the
+	// handler is called directly to check regionOverride itself
+	r := httptest.NewRequest(http.MethodDelete, "/messages?regionOverride=true", nil)
+	r.Header.Set("Authorization", "Bearer write-key")
+	w := httptest.NewRecorder()
+	h.DeleteAllMessages(w, r)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"requiredScope":"admin"`) {
+		t.Fatalf("override with a write key = %d %s, want 403 requiring admin", w.Code, w.Body.String())
+	}
+	if w := serveResidency(h, http.MethodDelete, "/messages?regionOverride=true", "write-key", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("override with a write key through the routes = %d, want 403", w.Code)
+	}
+	if n, _ := inner.Count(); n != 2 {
+		t.Fatalf("refused overrides left %d messages, want 2", n)
+	}
+}
+
+func TestRegionOverrideIsAudited(t *testing.T) {
+	h, inner := newResidencyTestHandler(t)
+
+	// Without an override the store-wide delete is refused
+	if w := serveResidency(h, http.MethodDelete, "/messages?mode=drop", "admin-key", ""); w.Code != http.StatusUnavailableForLegalReasons {
+		t.Fatalf("DELETE /messages without an override = %d %s, want 451", w.Code, w.Body.String())
+	}
+	// Nor is an override taken without an audit log to record it in
+	if w := serveResidency(h, http.MethodDelete, "/messages?mode=drop&regionOverride=true", "admin-key", ""); w.Code != http.StatusNotImplemented {
+		t.Fatalf("override without an audit log = %d %s, want 501", w.Code, w.Body.String())
+	}
+	if n, _ := inner.Count(); n != 2 {
+		t.Fatalf("refused deletes left %d messages, want 2", n)
+	}
+
+	audit := store.NewMemoryAuditStore()
+	h.SetAuditStore(audit)
+	w := serveResidency(h, http.MethodDelete, "/messages?mode=drop&regionOverride=true", "admin-key", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deletedCount":2`) {
+		t.Fatalf("audited override = %d %s, want 200 deleting both regions' messages", w.Code, w.Body.String())
+	}
+	entries, err := audit.ListAudit(store.AuditQuery{})
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != models.AuditRegionOverride ||
+		entries[0].Details["method"] != http.MethodDelete || entries[0].Details["path"] != "/messages" {
+		t.Fatalf("audit log = %+v, want one region override of DELETE /messages", entries)
+	}
+}
+
+func TestResidencyLeavesForeignSummariesOut(t *testing.T) {
+	h, inner := newResidencyTestHandler(t)
+	summaries := store.NewMemorySummaryStore(inner.(*store.MemoryStore))
+	if _, err := summaries.RebuildSummaries(nil); err != nil {
+		t.Fatalf("RebuildSummaries: %v", err)
+	}
+	residency := store.Residency{Allowed: []string{"in"}, DefaultRegion: "in", Accounts: map[string]string{"acme": "eu"}}
+	scoped := store.NewRegionScopedSummaryStore(summaries, h.store, residency)
+	h.SetSummaryStore(scoped)
+	h.SetConversationLifecycle(store.NewConversationLifecycle(scoped, store.NewMemoryAuditStore()))
+	h.SetTombstoneStore(store.NewMemoryTombstoneStore())
+	// Past the settling delay of the summaries just written
+	h.SetClock(clocktest.NewFake(time.Now().Add(time.Minute)))
+
+	since := encodeCursor(time.Now().Add(-time.Hour), "")
+	w := serveResidency(h, http.MethodGet, "/v1/conversations/changes?since="+since, "read-key", "")
+	var changes conversationChangesPage
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET /v1/conversations/changes = %d %s", w.Code, w.Body.String())
+	}
+	if len(changes.Data) != 1 || changes.Data[0].PhoneNumber != "1111111111" {
+		t.Fatalf("changes = %s, want only 1111111111", w.Body.String())
+	}
+
+	w = serveResidency(h, http.MethodPost, "/graphql", "read-key",
+		`{"query": "{ eu: conversation(phoneNumber: \"2222222222\") { phoneNumber preview } in: conversation(phoneNumber: \"1111111111\") { preview } }"}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "2222222222") ||
+		!strings.Contains(w.Body.String(), `"eu":null`) || !strings.Contains(w.Body.String(), `"preview":"hello"`) {
+		t.Fatalf("GraphQL conversations = %d %s, want eu null and in's preview", w.Code, w.Body.String())
+	}
+
+	// Nor is its state changed, as if it had no summary
+	if w := serveResidency(h, http.MethodPost, "/v1/user/2222222222/close", "write-key", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("closing an eu conversation = %d %s, want 404", w.Code, w.Body.String())
+	}
+	if s, _ := summaries.GetSummaries([]string{"2222222222"}); s["2222222222"].State != "" {
+		t.Fatalf("eu conversation is %s, want it left open", s["2222222222"].State)
+	}
+}
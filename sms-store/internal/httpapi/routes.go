@@ -0,0 +1,435 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"sms-store/internal/metrics"
+)
+
+// Routes returns a mux serving every route of the API. Scopes are not
+// checked here: the server wraps the mux in Authorize.
+func (h *Handler) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// GET /ping - Health check endpoint
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Ping(w, r)
+	})
+
+	// GET /version - Build information
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Version(w, r)
+	})
+
+	// GET /healthz - Dependency health (MongoDB, Kafka)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Healthz(w, r)
+	})
+
+	// GET /readyz - Readiness, held back by the startup warm-up
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Readyz(w, r)
+	})
+
+	// GET /metrics - Prometheus metrics
+	mux.Handle("/metrics", metrics.Handler())
+
+	// GET /v1/conversations - Get all distinct phone numbers (conversations)
+	// POST /v1/conversations - Open a conversation before its first message
+	mux.HandleFunc("/v1/conversations", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetConversations(w, r)
+		case http.MethodPost:
+			h.CreateConversation(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// GET|POST /graphql - Read-only GraphQL queries of conversations, messages, profiles and stats
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GraphQL(w, r)
+	})
+
+	// GET /v1/conversations/changes?since= - Conversations changed or deleted since a cursor
+	mux.HandleFunc("/v1/conversations/changes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetConversationChanges(w, r)
+	})
+
+	// GET /v1/groups - List group conversations
+	mux.HandleFunc("/v1/groups", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListGroups(w, r)
+	})
+
+	// GET /v1/groups/{conversationId} - Get a group conversation
+	// GET /v1/groups/{conversationId}/messages - Get its messages, newest first
+	mux.HandleFunc("/v1/groups/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetGroup(w, r)
+	})
+
+	// GET /v1/refs/{type}/{id}/messages - Messages carrying an external reference
+	mux.HandleFunc("/v1/refs/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetRefMessages(w, r)
+	})
+
+	// GET /v1/search?q= - Search profiles and messages
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Search(w, r)
+	})
+
+	// GET /v1/user/{user_id}/messages - Required endpoint for SMS Store
+	// DELETE /v1/user/{user_id}/messages - Delete all messages for a conversation
+	// GET/PUT /v1/user/{user_id}/preferences - Conversation color and labels
+	// GET/PUT /v1/user/{user_id}/attributes - Conversation custom attributes
+	// POST /v1/user/{user_id}/read - Move the conversation's read cursor
+	// POST /v1/user/{user_id}/close, /reopen, /snooze?until= - Conversation state
+	// GET /v1/user/{user_id}/messages/daily - Messages grouped by local day
+	// GET /v1/user/{user_id}/messages/transcript - HTML or PDF transcript
+	// POST /v1/user/{user_id}/messages/export - Build an export in the background
+	// POST /v1/user/{user_id}/messages/export-link - Signed export link (admin)
+	// POST /v1/user/{user_id}/share?expiresIn= - Read-only share link
+	mux.HandleFunc("/v1/user/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/share") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.CreateShare(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/messages/daily") {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.GetDailyDigest(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/messages/transcript") {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.GetTranscript(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/messages/export-link") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.CreateExportLink(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/messages/export") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.StartExport(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/read") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.MarkRead(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/close") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.CloseConversation(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/reopen") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.ReopenConversation(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/snooze") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.SnoozeConversation(w, r)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/preferences") {
+			switch r.Method {
+			case http.MethodGet:
+				h.GetPreferences(w, r)
+			case http.MethodPut:
+				h.PutPreferences(w, r)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/attributes") {
+			switch r.Method {
+			case http.MethodGet:
+				h.GetConversationAttributes(w, r)
+			case http.MethodPut:
+				h.PutConversationAttributes(w, r)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// Otherwise only handle paths that end with /messages
+		if !strings.HasSuffix(r.URL.Path, "/messages") {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			h.GetUserMessages(w, r)
+		case http.MethodDelete:
+			h.DeleteUserMessages(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// GET /v1/profile/{phoneNumber} - Get profile
+	// PUT /v1/profile/{phoneNumber} - Update profile
+	// GET /v1/profile/{phoneNumber}/history - List profile changes
+	// POST /v1/profile/{phoneNumber}/rollback/{historyId} - Restore a profile's values before a change
+	mux.HandleFunc("/v1/profile/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/history") {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.GetProfileHistory(w, r)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/rollback/") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.RollbackProfile(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.GetProfile(w, r)
+		case http.MethodPut:
+			h.UpdateProfile(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// POST /v1/profile - Create profile
+	mux.HandleFunc("/v1/profile", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.CreateProfile(w, r)
+	})
+
+	// POST /messages, GET /messages, DELETE /messages - Optional endpoints for testing
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.CreateMessage(w, r)
+		case http.MethodGet:
+			h.ListMessages(w, r)
+		case http.MethodDelete:
+			h.DeleteAllMessages(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// GET /messages/{id} - A single message
+	// PATCH /messages/{id} - Tag a message with its participant
+	// GET /messages/{id}/thread - A message and the messages it replies to
+	// POST, DELETE /messages/{id}/reactions - Add or remove an emoji reaction
+	// POST /messages/{id}/forward - Forward a message to another number
+	// POST /messages/{id}/annotations - Set a classifier's label on a message
+	// POST /messages/{id}/annotations/{source}/review - Confirm or reject an annotation
+	// GET /messages/{id}/translations - A message's stored translations
+	// PUT /messages/{id}/translations/{lang} - Store a message's translation into a language
+	mux.HandleFunc("/messages/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/translations") || strings.Contains(r.URL.Path, "/translations/") {
+			switch {
+			case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/translations"):
+				h.GetTranslations(w, r)
+			case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/translations/"):
+				h.SetTranslation(w, r)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/annotations") || (strings.Contains(r.URL.Path, "/annotations/") && strings.HasSuffix(r.URL.Path, "/review")) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if strings.HasSuffix(r.URL.Path, "/review") {
+				h.ReviewAnnotation(w, r)
+			} else {
+				h.SetAnnotation(w, r)
+			}
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/forward") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.ForwardMessage(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/reactions") {
+			switch r.Method {
+			case http.MethodPost:
+				h.AddReaction(w, r)
+			case http.MethodDelete:
+				h.RemoveReaction(w, r)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		get := h.GetMessage
+		if rest := strings.TrimPrefix(r.URL.Path, "/messages/"); strings.Contains(rest, "/") {
+			if !strings.HasSuffix(rest, "/thread") {
+				http.NotFound(w, r)
+				return
+			}
+			get = h.GetThread
+		} else if r.Method == http.MethodPatch {
+			h.PatchMessage(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		get(w, r)
+	})
+
+	// GET /v1/exports/{jobId} - Download a finished export (supports Range)
+	mux.HandleFunc("/v1/exports/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.DownloadExport(w, r)
+	})
+
+	// GET /v1/export-download?token= - Stream the export a signed link grants
+	mux.HandleFunc("/v1/export-download", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.DownloadExportLink(w, r)
+	})
+
+	// GET /v1/shares - The account's share links
+	mux.HandleFunc("/v1/shares", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListShares(w, r)
+	})
+
+	// DELETE /v1/shares/{id} - Revoke a share link
+	mux.HandleFunc("/v1/shares/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.DeleteShare(w, r)
+	})
+
+	// GET /v1/shared/{token}/messages - Read the conversation a share link grants
+	mux.HandleFunc("/v1/shared/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetSharedMessages(w, r)
+	})
+
+	// GET /v1/analytics/cost - Estimated message cost by day, account, language or annotation
+	mux.HandleFunc("/v1/analytics/cost", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetCostSummary(w, r)
+	})
+
+	h.adminRoutes(mux)
+	return mux
+}
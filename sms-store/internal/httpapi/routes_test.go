@@ -0,0 +1,167 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// newRoutesTestHandler returns a handler serving h.Routes() behind
+// Authorize, as the server does, over memory stores holding message m1 of
+// 9876543210 and that number's profile. Only its message and profile stores
+// are configured, so the routes needing more answer 501.
+func newRoutesTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	s := store.NewMemoryStore()
+	if _, err := s.Save(models.Message{ID: "m1", PhoneNumber: "9876543210", Text: "hello", Status: "SUCCESS", CreatedAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	ps := store.NewMemoryProfileStore()
+	if _, err := ps.CreateProfile(models.Profile{PhoneNumber: "9876543210", Name: "Ram"}); err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	config := DefaultHandlerConfig()
+	config.AdminAPIKey = "admin-key"
+	h := NewHandlerWithConfig(s, ps, config)
+	return h.Authorize(h.Routes())
+}
+
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		wantStatus         int
+		wantBody           string // Part of the response body showing which handler answered
+	}{
+		{"GET", "/ping", "", 200, `"status":"UP"`},
+		{"POST", "/ping", "", 405, "method not allowed"},
+		{"GET", "/version", "", 200, `"goVersion"`},
+		{"GET", "/healthz", "", 200, `"components"`},
+		{"GET", "/readyz", "", 200, `"READY"`},
+		{"GET", "/metrics", "", 200, "# HELP"},
+
+		{"GET", "/v1/conversations", "", 200, `["9876543210"]`},
+		{"POST", "/v1/conversations", `{"phoneNumber": "9876543211"}`, 501, "conversation summaries are not configured"},
+		{"DELETE", "/v1/conversations", "", 405, "method not allowed"},
+		{"GET", "/v1/conversations/changes", "", 501, "conversation summaries are not configured"},
+		{"POST", "/graphql", `{"query": "{ conversations { nope } }"}`, 400, `unknown field \"nope\"`},
+		{"PUT", "/graphql", "", 405, "method not allowed"},
+		{"GET", "/v1/groups", "", 501, "group conversations are not configured"},
+		{"GET", "/v1/groups/g1/messages", "", 501, "group conversations are not configured"},
+		{"GET", "/v1/refs/order/1/messages", "", 200, `"hasMore":false`},
+		{"GET", "/v1/search?q=hello", "", 200, `"phoneNumber":"9876543210"`},
+
+		{"GET", "/v1/user/9876543210/messages", "", 200, `"id":"m1"`},
+		{"DELETE", "/v1/user/9876543210/messages", "", 200, `"deletedCount":1`},
+		{"PATCH", "/v1/user/9876543210/messages", "", 405, "method not allowed"},
+		{"GET", "/v1/user/9876543210/messages/daily", "", 200, `"days"`},
+		{"GET", "/v1/user/9876543210/messages/transcript", "", 200, "<!DOCTYPE html>"},
+		{"POST", "/v1/user/9876543210/messages/export", "", 501, "exports are not configured"},
+		{"POST", "/v1/user/9876543210/messages/export-link", "", 501, "export links are not configured"},
+		{"POST", "/v1/user/9876543210/share", "", 501, "share links are not configured"},
+		{"GET", "/v1/user/9876543210/preferences", "", 501, "preferences are not configured"},
+		{"PUT", "/v1/user/9876543210/preferences", `{"color": "red"}`, 501, "preferences are not configured"},
+		{"GET", "/v1/user/9876543210/attributes", "", 501, "attribute schemas are not configured"},
+		{"POST", "/v1/user/9876543210/read", `{}`, 501, "read cursors are not configured"},
+		{"POST", "/v1/user/9876543210/close", "", 501, "conversation states are not configured"},
+		{"POST", "/v1/user/9876543210/reopen", "", 501, "conversation states are not configured"},
+		{"POST", "/v1/user/9876543210/snooze?until=2030-01-01T00:00:00Z", "", 501, "conversation states are not configured"},
+		{"GET", "/v1/user/9876543210/other", "", 404, "404 page not found"},
+
+		{"POST", "/v1/profile", `{"phoneNumber": "9876543211", "name": "Sita"}`, 201, `"name":"Sita"`},
+		{"POST", "/v1/profile", `{"phoneNumber": "9876543210", "name": "Ram"}`, 409, `"CONFLICT"`},
+		{"GET", "/v1/profile", "", 405, "method not allowed"},
+		{"GET", "/v1/profile/9876543210", "", 200, `"name":"Ram"`},
+		{"PUT", "/v1/profile/9876543210", `{"name": "Ramesh"}`, 200, `"version":2`},
+		{"GET", "/v1/profile/9876543210/history", "", 501, "profile history is not configured"},
+		{"POST", "/v1/profile/9876543210/rollback/h1", "", 501, "profile history is not configured"},
+
+		{"POST", "/messages", `{"phoneNumber": "9876543210", "text": "hi"}`, 201, `"text":"hi"`},
+		{"GET", "/messages", "", 200, `"id":"m1"`},
+		{"PUT", "/messages", "", 405, "method not allowed"},
+		{"GET", "/messages/m1", "", 200, `"id":"m1"`},
+		{"GET", "/messages/nope", "", 404, "message not found"},
+		{"PATCH", "/messages/m1", `{"participantId": "amma"}`, 200, `"participant":{"id":"amma"}`},
+		{"GET", "/messages/m1/thread", "", 200, `"id":"m1"`},
+		{"GET", "/messages/m1/other", "", 404, "404 page not found"},
+		{"POST", "/messages/m1/reactions", `{"emoji": "👍", "actor": "agent-1"}`, 200, "👍"},
+		{"PUT", "/messages/m1/reactions", "", 405, "method not allowed"},
+		{"POST", "/messages/nope/forward", `{"to": "9876543219"}`, 404, "message not found"},
+		{"POST", "/messages/m1/annotations", `{"source": "clf", "label": "complaint", "confidence": 0.9}`, 200, `"label":"complaint"`},
+		{"POST", "/messages/m1/annotations/clf/review", `{}`, 400, "reviewer is required"},
+		{"GET", "/messages/m1/translations", "", 200, `"translations":[]`},
+		{"PUT", "/messages/m1/translations/hi", `{"text": "namaste"}`, 200, `"language":"hi"`},
+		{"POST", "/messages/m1/translations/hi", `{"text": "namaste"}`, 405, "method not allowed"},
+
+		{"GET", "/v1/exports/j1", "", 501, "exports are not configured"},
+		{"GET", "/v1/export-download?token=x", "", 501, "export links are not configured"},
+		{"GET", "/v1/shares", "", 501, "share links are not configured"},
+		{"DELETE", "/v1/shares/s1", "", 501, "share links are not configured"},
+		{"GET", "/v1/shared/t/messages", "", 501, "share links are not configured"},
+		{"GET", "/v1/analytics/cost", "", 200, `"groupBy":"day"`},
+
+		{"GET", "/v1/admin/pricing", "", 501, "pricing is not configured"},
+		{"POST", "/v1/admin/pricing/reload", "", 501, "pricing is not configured"},
+		{"POST", "/v1/admin/archive", "", 501, "archiving is not configured"},
+		{"POST", "/v1/admin/search/tokens/backfill", "", 501, "prefix search is not enabled"},
+		{"POST", "/v1/admin/conversations/summaries/rebuild", "", 501, "conversation summaries are not configured"},
+		{"POST", "/v1/admin/conversations/summaries/check", "", 501, "conversation summaries are not configured"},
+		{"GET", "/v1/admin/store/latency", "", 501, "store latency is not recorded"},
+		{"GET", "/v1/admin/store/stats", "", 501, "store usage is not reported"},
+		{"POST", "/v1/admin/migrate/start", `{}`, 501, "migration is not configured"},
+		{"POST", "/v1/admin/seed", `{}`, 501, "seeding is not enabled"},
+		{"DELETE", "/v1/admin/seed", "", 501, "seeding is not enabled"},
+		{"POST", "/v1/admin/export/query", `{}`, 501, "exports are not configured"},
+		{"GET", "/v1/admin/tombstones", "", 501, "tombstones are not configured"},
+		{"DELETE", "/v1/admin/tombstones/9876543210", "", 501, "tombstones are not configured"},
+		{"POST", "/v1/admin/profiles/merge", `{}`, 400, "source and target are required"},
+		{"POST", "/v1/admin/profiles/cleanup", "", 501, "profile cleanup is not configured"},
+		{"GET", "/v1/admin/accounts/a1/quota", "", 501, "quotas are not configured"},
+		{"PUT", "/v1/admin/accounts/a1/attributes", `{}`, 501, "attribute schemas are not configured"},
+		{"GET", "/v1/admin/accounts/a1/auto-ack", "", 501, "auto-acks are not configured"},
+		{"DELETE", "/v1/admin/accounts/a1/quota", "", 405, "method not allowed"},
+		{"POST", "/v1/admin/quotas/reconcile", "", 501, "quotas are not configured"},
+		{"GET", "/v1/admin/audit", "", 501, "the audit log is not configured"},
+		{"POST", "/v1/admin/user/9876543210/snapshot", "", 501, "snapshots are not configured"},
+		{"GET", "/v1/admin/user/9876543210/diff", "", 501, "snapshots are not configured"},
+		{"GET", "/v1/admin/user/9876543210/snapshot", "", 405, "method not allowed"},
+		{"GET", "/v1/admin/user/9876543210/other", "", 404, "404 page not found"},
+		{"GET", "/v1/admin/deletion-receipts", "", 501, "deletion receipts are not configured"},
+		{"GET", "/v1/admin/messages/m1/raw", "", 501, "raw event capture is not configured"},
+		{"GET", "/v1/admin/consumer/offsets", "", 501, "the Kafka consumer is not configured"},
+		{"POST", "/v1/admin/consumer/seek", `{}`, 400, "CONFIRMATION_REQUIRED"},
+		{"POST", "/v1/admin/events/validate", `{}`, 200, `"valid":false`},
+		{"GET", "/v1/admin/ingestion/latency", "", 501, "the Kafka consumer is not configured"},
+		{"GET", "/v1/admin/ingestion/health", "", 501, "ingestion watchdog is not configured"},
+		{"GET", "/v1/admin/growth", "", 501, "growth monitor is not configured"},
+		{"GET", "/v1/admin/jobs", "", 200, "[]"},
+		{"GET", "/v1/admin/jobs/nope", "", 404, "job not found"},
+		{"POST", "/v1/admin/jobs/nope/cancel", "", 404, "job not found"},
+		{"GET", "/v1/admin/tasks", "", 501, "scheduled tasks are not configured"},
+		{"POST", "/v1/admin/tasks/digest/run", "", 501, "scheduled tasks are not configured"},
+		{"POST", "/v1/admin/tasks/digest", "", 404, "404 page not found"},
+
+		{"DELETE", "/messages", "", 200, `"deletedCount":1`},
+		{"GET", "/nowhere", "", 404, "404 page not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			mux := newRoutesTestHandler(t)
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer admin-key")
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("%s %s = %d %s, want %d with %s", tt.method, tt.path, w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
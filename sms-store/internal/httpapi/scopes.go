@@ -0,0 +1,295 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Scope is the access an API key grants. Each scope includes the ones below
+// it: admin keys can write and write keys can read.
+type Scope string
+
+const (
+	ScopeNone  Scope = "none"  // Public routes, and requests without a usable key when anonymous access is off
+	ScopeRead  Scope = "read"  // Reading messages, conversations and profiles
+	ScopeWrite Scope = "write" // Creating, updating and deleting single conversations or profiles
+	ScopeAdmin Scope = "admin" // Store-wide deletes, admin jobs and server configuration
+)
+
+func (s Scope) rank() int {
+	switch s {
+	case ScopeRead:
+		return 1
+	case ScopeWrite:
+		return 2
+	case ScopeAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// includes reports whether a key with scope s may use a route requiring required.
+func (s Scope) includes(required Scope) bool {
+	return s.rank() >= required.rank()
+}
+
+// ParseScope parses a scope name. The empty string means ScopeNone.
+func ParseScope(raw string) (Scope, error) {
+	switch scope := Scope(strings.ToLower(strings.TrimSpace(raw))); scope {
+	case "":
+		return ScopeNone, nil
+	case ScopeNone, ScopeRead, ScopeWrite, ScopeAdmin:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("scope must be none, read, write or admin, got %q", raw)
+	}
+}
+
+// ParseAPIKeys parses an API_KEYS setting: comma-separated key:scope pairs,
+// e.g. "k1:read,k2:write".
+func ParseAPIKeys(raw string) (map[string]Scope, error) {
+	keys := make(map[string]Scope)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, rawScope, ok := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("API key entries must look like key:scope")
+		}
+		scope, err := ParseScope(rawScope)
+		if err != nil {
+			return nil, err
+		}
+		if scope == ScopeNone {
+			return nil, fmt.Errorf("API key scope must be read, write or admin")
+		}
+		keys[key] = scope
+	}
+	return keys, nil
+}
+
+// routeScope is one method and path the server answers, with the scope it
+// requires. Path segments in braces match any single segment.
+type routeScope struct {
+	method string
+	path   string
+	scope  Scope
+}
+
+// routeScopes lists every route Routes registers. Requests that match none
+// of them require the admin scope, so a route added without an entry here
+// fails closed.
+var routeScopes = []routeScope{
+	{http.MethodGet, "/ping", ScopeNone},
+	{http.MethodGet, "/version", ScopeNone},
+	{http.MethodGet, "/healthz", ScopeNone},
+	{http.MethodGet, "/readyz", ScopeNone},
+	{http.MethodGet, "/metrics", ScopeNone},
+	{http.MethodGet, "/v1/export-download", ScopeNone}, // The signed token is the credential
+	{http.MethodHead, "/v1/export-download", ScopeNone},
+	{http.MethodGet, "/v1/shared/{token}/messages", ScopeNone}, // The share token is the credential
+
+	{http.MethodGet, "/v1/conversations", ScopeRead},
+	{http.MethodGet, "/v1/conversations/changes", ScopeRead},
+	{http.MethodGet, "/graphql", ScopeRead},
+	{http.MethodPost, "/graphql", ScopeRead}, // Read-only: mutations are rejected
+	{http.MethodGet, "/v1/groups", ScopeRead},
+	{http.MethodGet, "/v1/groups/{conversationId}", ScopeRead},
+	{http.MethodGet, "/v1/groups/{conversationId}/messages", ScopeRead},
+	{http.MethodGet, "/v1/refs/{type}/{id}/messages", ScopeRead},
+	{http.MethodGet, "/v1/search", ScopeRead},
+	{http.MethodGet, "/v1/user/{phoneNumber}/messages", ScopeRead},
+	{http.MethodGet, "/v1/user/{phoneNumber}/messages/daily", ScopeRead},
+	{http.MethodGet, "/v1/user/{phoneNumber}/messages/transcript", ScopeRead},
+	{http.MethodGet, "/v1/user/{phoneNumber}/preferences", ScopeRead},
+	{http.MethodGet, "/v1/user/{phoneNumber}/attributes", ScopeRead},
+	{http.MethodGet, "/v1/profile/{phoneNumber}", ScopeRead},
+	{http.MethodGet, "/v1/profile/{phoneNumber}/history", ScopeRead},
+	{http.MethodGet, "/messages", ScopeRead},
+	{http.MethodGet, "/messages/{id}", ScopeRead},
+	{http.MethodGet, "/messages/{id}/thread", ScopeRead},
+	{http.MethodGet, "/messages/{id}/translations", ScopeRead},
+	{http.MethodGet, "/v1/exports/{jobId}", ScopeRead},
+	{http.MethodHead, "/v1/exports/{jobId}", ScopeRead},
+	{http.MethodGet, "/v1/analytics/cost", ScopeRead},
+	{http.MethodGet, "/v1/shares", ScopeRead},
+
+	{http.MethodDelete, "/v1/user/{phoneNumber}/messages", ScopeWrite},
+	{http.MethodPost, "/v1/user/{phoneNumber}/messages/export", ScopeWrite},
+	{http.MethodPut, "/v1/user/{phoneNumber}/preferences", ScopeWrite},
+	{http.MethodPut, "/v1/user/{phoneNumber}/attributes", ScopeWrite},
+	{http.MethodPost, "/v1/user/{phoneNumber}/read", ScopeWrite},
+	{http.MethodPost, "/v1/user/{phoneNumber}/close", ScopeWrite},
+	{http.MethodPost, "/v1/user/{phoneNumber}/reopen", ScopeWrite},
+	{http.MethodPost, "/v1/user/{phoneNumber}/snooze", ScopeWrite},
+	{http.MethodPost, "/v1/user/{phoneNumber}/share", ScopeWrite},
+	{http.MethodDelete, "/v1/shares/{id}", ScopeWrite},
+	{http.MethodPut, "/v1/profile/{phoneNumber}", ScopeWrite},
+	{http.MethodPost, "/v1/profile", ScopeWrite},
+	{http.MethodPost, "/v1/profile/{phoneNumber}/rollback/{historyId}", ScopeWrite},
+	{http.MethodPost, "/v1/conversations", ScopeWrite},
+	{http.MethodPost, "/messages", ScopeWrite},
+	{http.MethodPatch, "/messages/{id}", ScopeWrite},
+	{http.MethodPost, "/messages/{id}/reactions", ScopeWrite},
+	{http.MethodDelete, "/messages/{id}/reactions", ScopeWrite},
+	{http.MethodPost, "/messages/{id}/annotations", ScopeWrite},
+	{http.MethodPost, "/messages/{id}/annotations/{source}/review", ScopeWrite},
+	{http.MethodPut, "/messages/{id}/translations/{lang}", ScopeWrite},
+	{http.MethodPost, "/messages/{id}/forward", ScopeWrite},
+
+	{http.MethodDelete, "/messages", ScopeAdmin},
+	{http.MethodPost, "/v1/user/{phoneNumber}/messages/export-link", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/pricing", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/pricing/reload", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/archive", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/search/tokens/backfill", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/conversations/summaries/rebuild", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/conversations/summaries/check", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/store/latency", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/store/stats", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/migrate/start", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/seed", ScopeAdmin},
+	{http.MethodDelete, "/v1/admin/seed", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/export/query", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/tombstones", ScopeAdmin},
+	{http.MethodDelete, "/v1/admin/tombstones/{phoneNumber}", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/profiles/merge", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/profiles/cleanup", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/accounts/{id}/quota", ScopeAdmin},
+	{http.MethodPut, "/v1/admin/accounts/{id}/quota", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/accounts/{id}/attributes", ScopeAdmin},
+	{http.MethodPut, "/v1/admin/accounts/{id}/attributes", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/accounts/{id}/auto-ack", ScopeAdmin},
+	{http.MethodPut, "/v1/admin/accounts/{id}/auto-ack", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/quotas/reconcile", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/audit", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/deletion-receipts", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/user/{phoneNumber}/snapshot", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/user/{phoneNumber}/diff", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/messages/{id}/raw", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/consumer/offsets", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/consumer/seek", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/events/validate", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/ingestion/latency", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/ingestion/health", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/growth", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/jobs", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/jobs/{id}", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/jobs/{id}/cancel", ScopeAdmin},
+	{http.MethodGet, "/v1/admin/tasks", ScopeAdmin},
+	{http.MethodPost, "/v1/admin/tasks/{name}/run", ScopeAdmin},
+}
+
+// matches reports whether a request for method and path hits the route.
+func (rs routeScope) matches(method, path string) bool {
+	if method != rs.method {
+		return false
+	}
+	got := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	want := strings.Split(rs.path, "/")
+	if len(got) != len(want) {
+		return false
+	}
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "{") {
+			if got[i] == "" {
+				return false
+			}
+		} else if got[i] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredScope returns the scope a request needs, ScopeAdmin for requests
+// no route matches. A HEAD without a route of its own reads like the GET of
+// its path.
+func requiredScope(method, path string) Scope {
+	for _, rs := range routeScopes {
+		if rs.matches(method, path) {
+			return rs.scope
+		}
+	}
+	if method == http.MethodHead {
+		return requiredScope(http.MethodGet, path)
+	}
+	return ScopeAdmin
+}
+
+// scope returns the scope of the request's bearer token. Requests without a
+// known key get the anonymous scope.
+func (h *Handler) scope(r *http.Request) Scope {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return h.config.AnonymousScope
+	}
+	token = strings.TrimSpace(token)
+	if h.config.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminAPIKey)) == 1 {
+		return ScopeAdmin
+	}
+	for key, scope := range h.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return scope
+		}
+	}
+	return h.config.AnonymousScope
+}
+
+// scopeConfigured reports whether any key, or anonymous access, grants scope.
+func (h *Handler) scopeConfigured(scope Scope) bool {
+	if h.config.AnonymousScope.includes(scope) {
+		return true
+	}
+	if h.config.AdminAPIKey != "" {
+		return true
+	}
+	for _, s := range h.config.APIKeys {
+		if s.includes(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireScope answers 403 naming the missing scope and returns false unless
+// the request has scope.
+func (h *Handler) requireScope(w http.ResponseWriter, r *http.Request, scope Scope) bool {
+	granted := h.scope(r)
+	if granted.includes(scope) {
+		return true
+	}
+	_, requestID, _, _ := responseInfo(w)
+	log.Printf("Denied %s %s: %s scope required, request has %s (request_id=%s client_ip=%s)",
+		r.Method, r.URL.Path, scope, granted, requestID, ClientIP(r))
+
+	details := map[string]Scope{"requiredScope": scope, "scope": granted}
+	if !h.scopeConfigured(scope) {
+		writeErrorDetails(w, http.StatusForbidden, "FORBIDDEN", string(scope)+" scope is not configured on this server", details)
+		return false
+	}
+	writeErrorDetails(w, http.StatusForbidden, "FORBIDDEN", string(scope)+" scope required", details)
+	return false
+}
+
+// Authorize wraps the mux: each request must have the scope routeScopes
+// gives its route. CORS preflight requests carry no credentials and pass.
+func (h *Handler) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !h.requireScope(w, r, requiredScope(r.Method, r.URL.Path)) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
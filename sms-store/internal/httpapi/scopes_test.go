@@ -0,0 +1,293 @@
+package httpapi
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"sms-store/internal/store"
+)
+
+// newScopesTestHandler returns a handler over memory stores with a key for
+// each scope: read-key, write-key and admin-key.
+func newScopesTestHandler() *Handler {
+	config := DefaultHandlerConfig()
+	config.AdminAPIKey = "admin-key"
+	config.APIKeys = map[string]Scope{"read-key": ScopeRead, "write-key": ScopeWrite}
+	return NewHandlerWithConfig(store.NewMemoryStore(), store.NewMemoryProfileStore(), config)
+}
+
+// scopeKeys are the keys of newScopesTestHandler by scope; ScopeNone sends
+// none.
+var scopeKeys = map[Scope]string{ScopeRead: "read-key", ScopeWrite: "write-key", ScopeAdmin: "admin-key"}
+
+// belowScope is the scope ranked just under each scope.
+var belowScope = map[Scope]Scope{ScopeRead: ScopeNone, ScopeWrite: ScopeRead, ScopeAdmin: ScopeWrite}
+
+func TestRouteScopes(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         Scope
+	}{
+		{http.MethodGet, "/ping", ScopeNone},
+		{http.MethodGet, "/version", ScopeNone},
+		{http.MethodGet, "/healthz", ScopeNone},
+		{http.MethodGet, "/readyz", ScopeNone},
+		{http.MethodGet, "/metrics", ScopeNone},
+		{http.MethodGet, "/v1/export-download", ScopeNone},
+		{http.MethodHead, "/v1/export-download", ScopeNone},
+		{http.MethodGet, "/v1/shared/tok/messages", ScopeNone},
+
+		{http.MethodGet, "/v1/conversations", ScopeRead},
+		{http.MethodGet, "/v1/conversations/changes", ScopeRead},
+		{http.MethodGet, "/graphql", ScopeRead},
+		{http.MethodPost, "/graphql", ScopeRead},
+		{http.MethodGet, "/v1/groups", ScopeRead},
+		{http.MethodGet, "/v1/groups/g1", ScopeRead},
+		{http.MethodGet, "/v1/groups/g1/messages", ScopeRead},
+		{http.MethodGet, "/v1/refs/order/m1/messages", ScopeRead},
+		{http.MethodGet, "/v1/search", ScopeRead},
+		{http.MethodGet, "/v1/user/9876543210/messages", ScopeRead},
+		{http.MethodGet, "/v1/user/9876543210/messages/daily", ScopeRead},
+		{http.MethodGet, "/v1/user/9876543210/messages/transcript", ScopeRead},
+		{http.MethodGet, "/v1/user/9876543210/preferences", ScopeRead},
+		{http.MethodGet, "/v1/user/9876543210/attributes", ScopeRead},
+		{http.MethodGet, "/v1/profile/9876543210", ScopeRead},
+		{http.MethodGet, "/v1/profile/9876543210/history", ScopeRead},
+		{http.MethodGet, "/messages", ScopeRead},
+		{http.MethodGet, "/messages/m1", ScopeRead},
+		{http.MethodGet, "/messages/m1/thread", ScopeRead},
+		{http.MethodGet, "/messages/m1/translations", ScopeRead},
+		{http.MethodGet, "/v1/exports/j1", ScopeRead},
+		{http.MethodHead, "/v1/exports/j1", ScopeRead},
+		{http.MethodGet, "/v1/analytics/cost", ScopeRead},
+		{http.MethodGet, "/v1/shares", ScopeRead},
+
+		{http.MethodDelete, "/v1/user/9876543210/messages", ScopeWrite},
+		{http.MethodPost, "/v1/user/9876543210/messages/export", ScopeWrite},
+		{http.MethodPut, "/v1/user/9876543210/preferences", ScopeWrite},
+		{http.MethodPut, "/v1/user/9876543210/attributes", ScopeWrite},
+		{http.MethodPost, "/v1/user/9876543210/read", ScopeWrite},
+		{http.MethodPost, "/v1/user/9876543210/close", ScopeWrite},
+		{http.MethodPost, "/v1/user/9876543210/reopen", ScopeWrite},
+		{http.MethodPost, "/v1/user/9876543210/snooze", ScopeWrite},
+		{http.MethodPost, "/v1/user/9876543210/share", ScopeWrite},
+		{http.MethodDelete, "/v1/shares/m1", ScopeWrite},
+		{http.MethodPut, "/v1/profile/9876543210", ScopeWrite},
+		{http.MethodPost, "/v1/profile", ScopeWrite},
+		{http.MethodPost, "/v1/profile/9876543210/rollback/h1", ScopeWrite},
+		{http.MethodPost, "/v1/conversations", ScopeWrite},
+		{http.MethodPost, "/messages", ScopeWrite},
+		{http.MethodPatch, "/messages/m1", ScopeWrite},
+		{http.MethodPost, "/messages/m1/reactions", ScopeWrite},
+		{http.MethodDelete, "/messages/m1/reactions", ScopeWrite},
+		{http.MethodPost, "/messages/m1/annotations", ScopeWrite},
+		{http.MethodPost, "/messages/m1/annotations/clf/review", ScopeWrite},
+		{http.MethodPut, "/messages/m1/translations/hi", ScopeWrite},
+		{http.MethodPost, "/messages/m1/forward", ScopeWrite},
+
+		{http.MethodDelete, "/messages", ScopeAdmin},
+		{http.MethodPost, "/v1/user/9876543210/messages/export-link", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/pricing", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/pricing/reload", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/archive", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/search/tokens/backfill", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/conversations/summaries/rebuild", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/conversations/summaries/check", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/store/latency", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/store/stats", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/migrate/start", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/seed", ScopeAdmin},
+		{http.MethodDelete, "/v1/admin/seed", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/export/query", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/tombstones", ScopeAdmin},
+		{http.MethodDelete, "/v1/admin/tombstones/9876543210", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/profiles/merge", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/profiles/cleanup", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/accounts/m1/quota", ScopeAdmin},
+		{http.MethodPut, "/v1/admin/accounts/m1/quota", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/accounts/m1/attributes", ScopeAdmin},
+		{http.MethodPut, "/v1/admin/accounts/m1/attributes", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/accounts/m1/auto-ack", ScopeAdmin},
+		{http.MethodPut, "/v1/admin/accounts/m1/auto-ack", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/quotas/reconcile", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/audit", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/deletion-receipts", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/user/9876543210/snapshot", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/user/9876543210/diff", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/messages/m1/raw", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/consumer/offsets", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/consumer/seek", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/events/validate", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/ingestion/latency", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/ingestion/health", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/growth", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/jobs", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/jobs/m1", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/jobs/m1/cancel", ScopeAdmin},
+		{http.MethodGet, "/v1/admin/tasks", ScopeAdmin},
+		{http.MethodPost, "/v1/admin/tasks/digest/run", ScopeAdmin},
+	}
+	// Each route of routeScopes is listed once
+	if len(tests) != len(routeScopes) {
+		t.Fatalf("%d routes tested, routeScopes has %d", len(tests), len(routeScopes))
+	}
+	for _, rs := range routeScopes {
+		covered := false
+		for _, tt := range tests {
+			covered = covered || rs.matches(tt.method, tt.path)
+		}
+		if !covered {
+			t.Errorf("route %s %s of routeScopes is not tested", rs.method, rs.path)
+		}
+	}
+
+	h := newScopesTestHandler()
+	mux := h.Routes()
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := requiredScope(tt.method, tt.path); got != tt.want {
+				t.Fatalf("requiredScope = %s, want %s", got, tt.want)
+			}
+			if _, pattern := mux.Handler(httptest.NewRequest(tt.method, tt.path, nil)); pattern == "" {
+				t.Fatal("no pattern of Routes serves the route")
+			}
+
+			// A key of the route's scope passes Authorize; one of the scope
+			// below is turned away
+			passed := false
+			authorized := h.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { passed = true }))
+			serve := func(scope Scope) int {
+				passed = false
+				r := httptest.NewRequest(tt.method, tt.path, nil)
+				if key := scopeKeys[scope]; key != "" {
+					r.Header.Set("Authorization", "Bearer "+key)
+				}
+				w := httptest.NewRecorder()
+				authorized.ServeHTTP(w, r)
+				return w.Code
+			}
+			if serve(tt.want); !passed {
+				t.Fatalf("a %s key was refused", tt.want)
+			}
+			if below, ok := belowScope[tt.want]; ok {
+				if code := serve(below); passed || code != http.StatusForbidden {
+					t.Fatalf("a %s key was answered %d, want 403", below, code)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadNeedsTheScopeOfGet(t *testing.T) {
+	for _, path := range []string{
+		"/v1/user/9876543210/messages",
+		"/v1/profile/9876543210",
+		"/messages/m1",
+		"/v1/conversations",
+		"/v1/admin/jobs",
+		"/ping",
+	} {
+		if got, want := requiredScope(http.MethodHead, path), requiredScope(http.MethodGet, path); got != want {
+			t.Errorf("HEAD %s needs %s, want %s like GET", path, got, want)
+		}
+	}
+	// Routes only served for other methods stay admin
+	if got := requiredScope(http.MethodHead, "/v1/admin/migrate/start"); got != ScopeAdmin {
+		t.Errorf("HEAD of a POST route needs %s, want admin", got)
+	}
+}
+
+// registeredPatterns returns the patterns Routes registers, read from the
+// mux.Handle and mux.HandleFunc calls of the files it registers them in.
+func registeredPatterns(t *testing.T) []string {
+	t.Helper()
+	var patterns []string
+	fset := token.NewFileSet()
+	for _, file := range []string{"routes.go", "admin.go"} {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("parse %s: %v", file, err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc" {
+				return true
+			}
+			if recv, ok := sel.X.(*ast.Ident); !ok || recv.Name != "mux" || len(call.Args) == 0 {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				t.Fatalf("%s: route pattern is not a string literal", fset.Position(call.Pos()))
+			}
+			pattern, _ := strconv.Unquote(lit.Value)
+			patterns = append(patterns, pattern)
+			return true
+		})
+	}
+	if len(patterns) == 0 {
+		t.Fatal("found no registered patterns")
+	}
+	return patterns
+}
+
+var routeParam = regexp.MustCompile(`\{[^}/]+\}`)
+
+// TestEveryRegisteredPatternHasScopes walks the patterns Routes registers:
+// each serves at least one route of routeScopes, so none is left to the
+// admin fallback by mistake.
+func TestEveryRegisteredPatternHasScopes(t *testing.T) {
+	mux := newScopesTestHandler().Routes()
+	served := make(map[string]bool)
+	for _, rs := range routeScopes {
+		path := routeParam.ReplaceAllString(rs.path, "x")
+		_, pattern := mux.Handler(httptest.NewRequest(rs.method, path, nil))
+		if pattern == "" {
+			t.Errorf("route %s %s of routeScopes is not served by Routes", rs.method, rs.path)
+		}
+		served[pattern] = true
+	}
+	for _, pattern := range registeredPatterns(t) {
+		if !served[pattern] {
+			t.Errorf("pattern %s is registered without a route in routeScopes", pattern)
+		}
+	}
+}
+
+func TestUnknownRoutesRequireAdmin(t *testing.T) {
+	h := newScopesTestHandler()
+	authorized := h.Authorize(h.Routes())
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/nowhere"},
+		{http.MethodPost, "/ping"},
+		{http.MethodGet, "/v1/admin/unlisted"},
+		{http.MethodPatch, "/v1/profile/9876543210"},
+		{http.MethodGet, "/v1/user/9876543210/unlisted"},
+		{http.MethodPost, "/v1/user/9876543210/messages"},
+		{http.MethodGet, "/messages/m1/thread/extra"},
+		{http.MethodGet, "/v1/shared//messages"},
+	} {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := requiredScope(tt.method, tt.path); got != ScopeAdmin {
+				t.Fatalf("requiredScope = %s, want admin", got)
+			}
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer write-key")
+			w := httptest.NewRecorder()
+			authorized.ServeHTTP(w, r)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("a write key was answered %d, want 403", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/search"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	searchSnippetWidth = 80
+	minSearchQueryLen  = 2
+)
+
+type profileHit struct {
+	Profile      models.Profile `json:"profile"`
+	MatchedField string         `json:"matchedField"` // "name" or "phoneNumber"
+	Snippet      string         `json:"snippet"`
+	Highlights   []search.Range `json:"highlights"`
+}
+
+type messageHit struct {
+	Message    models.Message `json:"message"`
+	Snippet    string         `json:"snippet"`
+	Highlights []search.Range `json:"highlights"`
+}
+
+type conversationHit struct {
+	PhoneNumber    string          `json:"phoneNumber,omitempty"`
+	ConversationID string          `json:"conversationId,omitempty"` // Group conversations only
+	Profile        *models.Profile `json:"profile,omitempty"`
+	LastMatchedAt  time.Time       `json:"lastMatchedAt"`
+	Messages       []messageHit    `json:"messages"`
+}
+
+type searchResponse struct {
+	Query         string            `json:"query"`
+	Profiles      []profileHit      `json:"profiles"`
+	Conversations []conversationHit `json:"conversations"`
+}
+
+// Search finds profiles (by name or number) and messages (by text) matching q.
+// GET /v1/search?q=ram&type=profiles|messages|all&limit=20
+// GET /v1/search?prefix=ram&type=profiles|messages|all&limit=20
+//
+// Profiles that match by name rank ahead of number-only matches, and
+// conversations whose contact matched by name rank ahead of the rest.
+// Highlight offsets are rune-based and relative to each snippet.
+//
+// ?prefix= instead of ?q= matches messages with a word starting with each
+// word of the query, for search as you type. It uses the stored search
+// tokens and answers 501 unless prefix search is enabled.
+//
+// ?refType=order&refId=OD123 restricts messages to those carrying that
+// external reference, and ?annotation=complaint&minConfidence=0.8 to those a
+// classifier labelled so. The annotation filter applies to the over-fetched
+// matches, so a rare label may yield fewer conversations than limit.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	prefix := q.Has("prefix")
+	if prefix {
+		if query != "" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "use either q or prefix")
+			return
+		}
+		query = strings.TrimSpace(q.Get("prefix"))
+	}
+	if len([]rune(query)) < minSearchQueryLen {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "q must be at least 2 characters")
+		return
+	}
+	if prefix && h.tokenizer == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "prefix search is not enabled")
+		return
+	}
+
+	searchType := q.Get("type")
+	if searchType == "" {
+		searchType = "all"
+	}
+	if searchType != "all" && searchType != "profiles" && searchType != "messages" {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "type must be one of profiles, messages, all")
+		return
+	}
+
+	ref, err := refQuery(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	annotation, minConfidence, err := parseAnnotationFilter(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	var (
+		wg          sync.WaitGroup
+		profiles    []models.Profile
+		messages    []models.Message
+		profileErr  error
+		messagesErr error
+	)
+
+	if searchType != "messages" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			profiles, profileErr = h.analyticsProfileStore().SearchProfiles(query, limit)
+		}()
+	}
+	if searchType != "profiles" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Over-fetch messages so that grouping still yields enough conversations
+			if prefix {
+				messages, messagesErr = h.searchMessagePrefixes(query, ref, limit*5)
+			} else {
+				messages, messagesErr = h.analyticsStore().SearchMessages(query, ref, limit*5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if profileErr != nil || messagesErr != nil {
+		writeStoreError(w, errors.Join(profileErr, messagesErr), "search")
+		return
+	}
+
+	resp := searchResponse{Query: query, Profiles: []profileHit{}, Conversations: []conversationHit{}}
+	resp.Profiles = rankProfileHits(profiles, query)
+	messages = filterByAnnotation(messages, annotation, minConfidence)
+	resp.Conversations = groupMessageHits(messages, resp.Profiles, query, limit)
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// rankProfileHits builds profile hits with name matches ahead of number matches.
+func rankProfileHits(profiles []models.Profile, query string) []profileHit {
+	hits := make([]profileHit, 0, len(profiles))
+	for _, p := range profiles {
+		hit := profileHit{Profile: p, MatchedField: "name"}
+		hit.Snippet, hit.Highlights = search.Snippet(p.Name, query, searchSnippetWidth)
+		if len(hit.Highlights) == 0 {
+			hit.MatchedField = "phoneNumber"
+			hit.Snippet, hit.Highlights = search.Snippet(p.PhoneNumber, query, searchSnippetWidth)
+		}
+		hits = append(hits, hit)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].MatchedField == "name" && hits[j].MatchedField != "name"
+	})
+	return hits
+}
+
+// groupMessageHits groups newest-first messages by conversation and ranks
+// conversations whose profile matched by name first, then by recency.
+func groupMessageHits(messages []models.Message, profiles []profileHit, query string, limit int) []conversationHit {
+	nameMatches := make(map[string]*models.Profile)
+	for i := range profiles {
+		if profiles[i].MatchedField == "name" {
+			nameMatches[profiles[i].Profile.PhoneNumber] = &profiles[i].Profile
+		}
+	}
+
+	index := make(map[string]int)
+	convs := make([]conversationHit, 0)
+	for _, msg := range messages {
+		i, ok := index[msg.ConversationKey()]
+		if !ok {
+			i = len(convs)
+			index[msg.ConversationKey()] = i
+			convs = append(convs, conversationHit{
+				PhoneNumber:    msg.PhoneNumber,
+				ConversationID: msg.ConversationID,
+				Profile:        nameMatches[msg.PhoneNumber],
+				LastMatchedAt:  msg.CreatedAt,
+				Messages:       []messageHit{},
+			})
+		}
+
+		hit := messageHit{Message: msg}
+		hit.Snippet, hit.Highlights = search.Snippet(msg.Text, query, searchSnippetWidth)
+		convs[i].Messages = append(convs[i].Messages, hit)
+	}
+
+	sort.SliceStable(convs, func(i, j int) bool {
+		iName, jName := convs[i].Profile != nil, convs[j].Profile != nil
+		if iName != jName {
+			return iName
+		}
+		return convs[i].LastMatchedAt.After(convs[j].LastMatchedAt)
+	})
+
+	if len(convs) > limit {
+		convs = convs[:limit]
+	}
+	return convs
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/search"
+	"sms-store/internal/store"
+)
+
+const (
+	backfillTokensJobType = "backfill_search_tokens"
+	backfillTokensPage    = 1000
+)
+
+// SetSearchTokenizer enables prefix search with the tokenizer messages are
+// stored with. Without one, ?prefix= searches answer 501.
+func (h *Handler) SetSearchTokenizer(t search.Tokenizer) {
+	h.tokenizer = &t
+}
+
+// searchMessagePrefixes retrieves up to limit messages with a word starting
+// with each word of query, carrying ref unless it is nil. Stored tokens
+// narrow the candidates; the text confirms query words longer than the
+// tokens.
+func (h *Handler) searchMessagePrefixes(query string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	tokens := h.tokenizer.QueryTokens(query)
+	if len(tokens) == 0 {
+		return []models.Message{}, nil
+	}
+	candidates, err := h.analyticsStore().SearchMessagePrefixes(tokens, ref, limit)
+	if err != nil {
+		return nil, err
+	}
+	messages := candidates[:0]
+	for _, msg := range candidates {
+		if search.MatchesPrefixes(msg.Text, query) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// BackfillSearchTokens tokenizes messages stored before prefix search was
+// enabled, in the background. Requires the admin scope.
+// POST /v1/admin/search/tokens/backfill
+//
+// Messages whose tokens are already current are skipped, so the job can be
+// rerun after a change of SEARCH_PREFIX_MAX_GRAM or SEARCH_PREFIX_MAX_TOKENS
+// and only rewrites what changed.
+func (h *Handler) BackfillSearchTokens(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.tokenizer == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "prefix search is not enabled")
+		return
+	}
+
+	job, err := h.jobs.Submit(backfillTokensJobType, h.runBackfillTokens(*h.tokenizer))
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start backfill")
+		return
+	}
+
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": "Backfill started",
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+// runBackfillTokens pages through every message, oldest first, writing the
+// tokens of each page in one bulk update.
+func (h *Handler) runBackfillTokens(t search.Tokenizer) jobs.Func {
+	return func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		if total, err := h.store.Count(); err == nil {
+			p.SetTotal(total)
+		}
+
+		page := store.PageQuery{Limit: backfillTokensPage, OldestFirst: true}
+		var scanned, updated int64
+		for {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			msgs, err := h.store.ListPage(page)
+			if err != nil {
+				return nil, err
+			}
+
+			changed := make(map[string][]string)
+			for _, msg := range msgs {
+				if tokens := t.Tokens(msg.Text); !slices.Equal(tokens, msg.SearchTokens) {
+					changed[msg.ID] = tokens
+				}
+			}
+			n, err := h.store.SetSearchTokens(changed)
+			if err != nil {
+				return nil, err
+			}
+			scanned += int64(len(msgs))
+			updated += n
+			p.Add(int64(len(msgs)))
+
+			if len(msgs) < page.Limit {
+				return map[string]any{"scanned": scanned, "updated": updated}, nil
+			}
+			last := msgs[len(msgs)-1]
+			page.After, page.AfterID = last.CreatedAt, last.ID
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package httpapi
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/seed"
+	"sms-store/internal/store"
+)
+
+const (
+	seedJobType       = "seed"
+	seedDeleteJobType = "seed_delete"
+	seedJobKey        = "seed" // Seeding and removing seeded data never run at once
+	defaultSeedDays   = 30
+)
+
+type seedRequest struct {
+	Seed                    int64  `json:"seed"`                              // Same seed, same data
+	Conversations           int    `json:"conversations,omitempty"`           // Default 20
+	MessagesPerConversation int    `json:"messagesPerConversation,omitempty"` // Default 30
+	From                    string `json:"from,omitempty"`                    // Default 30 days before to
+	To                      string `json:"to,omitempty"`                      // Default, and at most, now
+	Locale                  string `json:"locale,omitempty"`                  // en-IN (default) or hi-IN
+}
+
+// StartSeed generates synthetic conversations in the background, for
+// demos and load tests. Requires the admin scope and SeedingEnabled.
+// POST /v1/admin/seed
+//
+// Profiles and messages are written through the handler's stores like any
+// other, so summaries, indexes, prices and detected languages are kept as
+// for real traffic. Conversations get numbers under models.SeedPhonePrefix,
+// profiles source "seed" and messages the seed's marker, which is what
+// DELETE /v1/admin/seed removes. A seed always generates the same numbers,
+// names and texts, and the same times for the same from and to. Seeding
+// again skips the conversations the seed already wrote.
+func (h *Handler) StartSeed(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if !h.config.SeedingEnabled {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "seeding is not enabled")
+		return
+	}
+
+	var req seedRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	now := h.Clock().Now()
+	to, err := parseDigestBound(req.To, time.UTC, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "to must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	// Generated messages are never dated ahead of the clock
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	from, err := parseDigestBound(req.From, time.UTC, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from must be YYYY-MM-DD or RFC 3339")
+		return
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -defaultSeedDays)
+	}
+
+	opts := seed.Options{
+		Seed:                    req.Seed,
+		Conversations:           cmp.Or(req.Conversations, seed.DefaultConversations),
+		MessagesPerConversation: cmp.Or(req.MessagesPerConversation, seed.DefaultMessagesPerConversation),
+		From:                    from,
+		To:                      to,
+		Locale:                  strings.TrimSpace(req.Locale),
+		AccountID:               accountID(r),
+	}
+	if opts.Locale != "" && !slices.Contains(seed.Locales(), opts.Locale) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "locale must be en-IN or hi-IN")
+		return
+	}
+	g, err := seed.New(opts)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	profiles := h.profileWriter(r)
+	h.submitSeedJob(w, seedJobType, "Seeding started", func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		return h.runSeed(ctx, p, g, opts, profiles)
+	})
+}
+
+// DeleteSeed removes the data POST /v1/admin/seed generated, in the
+// background: every conversation under models.SeedPhonePrefix whose
+// messages carry a seed marker, with its archived messages and its
+// profile if that is still a seeded one. Requires the admin scope and
+// SeedingEnabled.
+// DELETE /v1/admin/seed
+func (h *Handler) DeleteSeed(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if !h.config.SeedingEnabled {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "seeding is not enabled")
+		return
+	}
+
+	profiles := h.profileWriter(r)
+	receipt := newDeletionReceipt(r, models.DeletionSeed, "")
+	h.submitSeedJob(w, seedDeleteJobType, "Seed removal started", func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		return h.runDeleteSeed(ctx, p, profiles, receipt)
+	})
+}
+
+// submitSeedJob starts fn as a job of jobType and answers 202 with it, or
+// with the job of the same type already running. A job of the other seed
+// type running answers 409.
+func (h *Handler) submitSeedJob(w http.ResponseWriter, jobType, message string, fn jobs.Func) {
+	job, err := h.jobs.SubmitKeyed(jobType, seedJobKey, fn)
+	if errors.Is(err, jobs.ErrAlreadyRunning) && job.Type != jobType {
+		writeErrorDetails(w, http.StatusConflict, "CONFLICT", "another seeding job is running", map[string]any{"jobId": job.ID, "type": job.Type})
+		return
+	}
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start seeding job")
+		return
+	}
+
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": message,
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+// runSeed writes the conversations of g one at a time, each profile before
+// its messages.
+func (h *Handler) runSeed(ctx context.Context, p *jobs.Progress, g *seed.Generator, opts seed.Options, profiles store.ProfileStore) (map[string]any, error) {
+	p.SetTotal(g.Total())
+
+	marker := seed.Marker(opts.Seed)
+	var saved, created, skipped int64
+	for i := range opts.Conversations {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		conv := g.Conversation(i, h.Clock().Now())
+
+		// A conversation this seed already wrote is left as it is
+		newest, err := h.store.FindByPhoneNumberPage(conv.Profile.PhoneNumber, store.PageQuery{Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(newest) > 0 && newest[0].Seed == marker {
+			skipped++
+			p.Add(int64(len(conv.Messages)))
+			continue
+		}
+
+		// The number's tombstone, left by removing an earlier seed, would
+		// drop its messages; seeded numbers get no Kafka events it guards
+		// against
+		if h.tombstoneStore != nil {
+			if err := h.tombstoneStore.DeleteTombstone(conv.Profile.PhoneNumber); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, fmt.Errorf("clear tombstone of %s: %w", conv.Profile.PhoneNumber, err)
+			}
+		}
+		if profiles != nil {
+			_, ok, err := profiles.EnsureProfile(conv.Profile)
+			if err != nil {
+				return nil, fmt.Errorf("create profile %s: %w", conv.Profile.PhoneNumber, err)
+			}
+			if ok {
+				created++
+			}
+		}
+		n, err := h.store.SaveBatch(conv.Messages)
+		if err != nil {
+			return nil, fmt.Errorf("save messages of %s: %w", conv.Profile.PhoneNumber, err)
+		}
+		saved += int64(n)
+		p.Add(int64(len(conv.Messages)))
+	}
+
+	return map[string]any{
+		"seed":                    opts.Seed,
+		"locale":                  cmp.Or(opts.Locale, seed.DefaultLocale),
+		"from":                    opts.From,
+		"to":                      opts.To,
+		"conversations":           opts.Conversations,
+		"messagesPerConversation": opts.MessagesPerConversation,
+		"conversationsSkipped":    skipped,
+		"messagesStored":          saved,
+		"profilesCreated":         created,
+	}, nil
+}
+
+// runDeleteSeed deletes the seeded conversations. A conversation under the
+// prefix is taken for seeded when its newest message has a seed marker.
+// Each conversation deleted gets a copy of receipt, combining its
+// messages, summary and profile.
+func (h *Handler) runDeleteSeed(ctx context.Context, p *jobs.Progress, profiles store.ProfileStore, receipt models.DeletionReceipt) (map[string]any, error) {
+	phoneNumbers, err := h.store.GetDistinctPhoneNumbers()
+	if err != nil {
+		return nil, err
+	}
+	phoneNumbers = slices.DeleteFunc(phoneNumbers, func(pn string) bool {
+		return !strings.HasPrefix(pn, models.SeedPhonePrefix)
+	})
+	p.SetTotal(int64(len(phoneNumbers)))
+
+	var conversations, deleted, profilesDeleted int64
+	for _, pn := range phoneNumbers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		newest, err := h.store.FindByPhoneNumberPage(pn, store.PageQuery{Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(newest) == 0 || newest[0].Seed == "" {
+			p.Add(1)
+			continue
+		}
+
+		hasSummary, err := h.hasSummary(pn)
+		if err != nil {
+			return nil, fmt.Errorf("look up conversation %s: %w", pn, err)
+		}
+		ids, err := h.conversationMessageIDs(pn)
+		if err != nil {
+			return nil, fmt.Errorf("list messages of %s: %w", pn, err)
+		}
+		convReceipt := withIDs(receipt, ids)
+		convReceipt.PhoneNumber = pn
+		convReceipt.Matched = map[string]int64{}
+
+		n, err := h.store.DeleteByPhoneNumber(pn)
+		if err != nil {
+			return nil, fmt.Errorf("delete messages of %s: %w", pn, err)
+		}
+		convReceipt.Matched[models.DeletedMessages] = n
+		if hasSummary {
+			convReceipt.Matched[models.DeletedSummaries] = 1
+		}
+		if h.archiver != nil {
+			archived, err := h.archiver.DeleteArchivedByPhoneNumber(pn)
+			if err != nil {
+				return nil, fmt.Errorf("delete archived messages of %s: %w", pn, err)
+			}
+			n += archived
+			convReceipt.Matched[models.DeletedArchivedMessages] = archived
+		}
+		deleted += n
+		conversations++
+
+		if profiles != nil {
+			profile, err := profiles.GetProfile(pn)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+			case err != nil:
+				return nil, fmt.Errorf("look up profile %s: %w", pn, err)
+			case profile.Source == models.ProfileSourceSeed:
+				if err := profiles.DeleteProfile(pn); err != nil && !errors.Is(err, store.ErrNotFound) {
+					return nil, fmt.Errorf("delete profile %s: %w", pn, err)
+				}
+				profilesDeleted++
+				convReceipt.Matched[models.DeletedProfiles] = 1
+			}
+		}
+		if err := h.recordDeletion(convReceipt); err != nil {
+			return nil, fmt.Errorf("record deletion receipt of %s: %w", pn, err)
+		}
+		p.Add(1)
+	}
+
+	return map[string]any{
+		"conversations":   conversations,
+		"messagesDeleted": deleted,
+		"profilesDeleted": profilesDeleted,
+	}, nil
+}
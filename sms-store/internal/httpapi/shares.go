@@ -0,0 +1,250 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// SetShareStore attaches the store of conversation share links. Share
+// endpoints answer 501 until one is set.
+func (h *Handler) SetShareStore(ss store.ShareStore) {
+	h.shares = ss
+}
+
+// shareResponse is a share as listed. The token isn't: only its hash is kept.
+type shareResponse struct {
+	ID          string    `json:"id"`
+	PhoneNumber string    `json:"phoneNumber"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+func newShareResponse(s models.Share) shareResponse {
+	return shareResponse{
+		ID:          s.ID,
+		PhoneNumber: s.PhoneNumber,
+		CreatedBy:   s.CreatedBy,
+		CreatedAt:   s.CreatedAt.UTC(),
+		ExpiresAt:   s.ExpiresAt.UTC(),
+	}
+}
+
+// createShareResponse is a new share with its token, shown only this once.
+type createShareResponse struct {
+	shareResponse
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// CreateShare creates a link that lets anyone holding it page through the
+// conversation without an API key, read-only, until it expires or is
+// revoked, e.g. to show a thread to a colleague. ?expiresIn= (a duration
+// such as 48h) sets how long it lasts, ShareLinkTTL by default and at most
+// ShareLinkMaxTTL.
+// POST /v1/user/{phoneNumber}/share
+func (h *Handler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	if h.shares == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "share links are not configured")
+		return
+	}
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/share")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	ttl := h.config.ShareLinkTTL
+	if raw := strings.TrimSpace(r.URL.Query().Get("expiresIn")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "expiresIn must be a positive duration such as 48h")
+			return
+		}
+		ttl = d
+	}
+	if h.config.ShareLinkMaxTTL > 0 && ttl > h.config.ShareLinkMaxTTL {
+		writeErrorDetails(w, http.StatusBadRequest, "BAD_REQUEST", "expiresIn is longer than share links may last",
+			map[string]string{"maxExpiresIn": h.config.ShareLinkMaxTTL.String()})
+		return
+	}
+
+	id, secret, err := newShareToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not create share link")
+		return
+	}
+	now := h.Clock().Now().Truncate(time.Second)
+	share, err := h.shares.CreateShare(models.Share{
+		ID:          id,
+		AccountID:   accountID(r),
+		PhoneNumber: phoneNumber,
+		SecretHash:  hashShareSecret(secret),
+		CreatedBy:   ClientIP(r),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not create share link")
+		return
+	}
+	log.Printf("Created share link %s of %s until %s (account=%s client_ip=%s)",
+		share.ID, phoneNumber, share.ExpiresAt.UTC().Format(time.RFC3339), share.AccountID, share.CreatedBy)
+
+	token := id + "." + secret
+	writeJSON(w, http.StatusCreated, createShareResponse{
+		shareResponse: newShareResponse(share),
+		Token:         token,
+		URL:           "/v1/shared/" + token + "/messages",
+	})
+}
+
+// ListShares lists the account's unexpired share links, newest first.
+// GET /v1/shares
+func (h *Handler) ListShares(w http.ResponseWriter, r *http.Request) {
+	if h.shares == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "share links are not configured")
+		return
+	}
+
+	shares, err := h.shares.ListShares(accountID(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not list share links")
+		return
+	}
+	resp := make([]shareResponse, 0, len(shares))
+	for _, s := range shares {
+		resp = append(resp, newShareResponse(s))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteShare revokes one of the account's share links. Its token stops
+// working at once.
+// DELETE /v1/shares/{id}
+func (h *Handler) DeleteShare(w http.ResponseWriter, r *http.Request) {
+	if h.shares == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "share links are not configured")
+		return
+	}
+	id, ok := pathParam(r.URL.Path, "/v1/shares/", "")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid share id")
+		return
+	}
+
+	if err := h.shares.DeleteShare(accountID(r), id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "share link not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not revoke share link")
+		return
+	}
+	log.Printf("Revoked share link %s (account=%s client_ip=%s)", id, accountID(r), ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedMessages serves one newest-first page of the conversation a
+// share link grants, read-only, with ?limit=, ?cursor= and ?includeTotal=
+// as for GET /v1/user/{phoneNumber}/messages. The token is the only
+// credential. A malformed, unknown, revoked or expired token gets the same
+// 404, so a miss tells nothing about which shares or conversations exist.
+// GET /v1/shared/{token}/messages
+func (h *Handler) GetSharedMessages(w http.ResponseWriter, r *http.Request) {
+	if h.shares == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "share links are not configured")
+		return
+	}
+	token, _ := pathParam(r.URL.Path, "/v1/shared/", "/messages")
+	share, ok := h.verifyShareToken(token)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "share link not found")
+		return
+	}
+
+	page, err := parsePageQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	// Annotations are internal triage, so share holders neither see them
+	// nor filter by them, which would tell them the labels as well
+	page.Annotation, page.MinConfidence = "", 0
+	limit := page.Limit
+	page.Limit = limit + 1
+	messages, err := h.store.FindByPhoneNumberPage(share.PhoneNumber, page)
+	if err != nil {
+		writeStoreError(w, err, "retrieve messages")
+		return
+	}
+	for i := range messages {
+		messages[i].Annotations = nil
+	}
+	resp := newMessagePage(messages, limit)
+	if includesTotal(r) {
+		if resp.Meta.TotalCount, err = h.conversationTotal(share.PhoneNumber, page, false); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not count messages")
+			return
+		}
+	}
+
+	// Whoever holds the link may lose it; keep pages out of shared caches
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// verifyShareToken returns the share an id.secret token grants. The secret
+// is compared by its hash in constant time; expired shares grant nothing
+// even before the store removes them.
+func (h *Handler) verifyShareToken(token string) (models.Share, bool) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return models.Share{}, false
+	}
+	share, err := h.shares.GetShare(id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Failed to look up share link %s: %v", id, err)
+		}
+		return models.Share{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashShareSecret(secret)), []byte(share.SecretHash)) != 1 {
+		return models.Share{}, false
+	}
+	if !share.ExpiresAt.After(h.Clock().Now()) {
+		return models.Share{}, false
+	}
+	return share, true
+}
+
+// newShareToken returns a random share ID and secret, both URL-safe.
+func newShareToken() (id, secret string, err error) {
+	var idBytes [9]byte
+	var secretBytes [32]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", "", err
+	}
+	return "shr_" + hex.EncodeToString(idBytes[:]), base64.RawURLEncoding.EncodeToString(secretBytes[:]), nil
+}
+
+// hashShareSecret returns the hex SHA-256 of a share secret, as stored.
+func hashShareSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/snapshot"
+	"sms-store/internal/store"
+)
+
+// SetSnapshotStore attaches the conversation snapshots. The snapshot and
+// diff endpoints answer 501 until one is set.
+func (h *Handler) SetSnapshotStore(ss store.SnapshotStore) {
+	h.snapshots = ss
+}
+
+// snapshotResponse describes a snapshot taken, leaving out its hashes.
+type snapshotResponse struct {
+	ID               string                  `json:"id"`
+	PhoneNumber      string                  `json:"phoneNumber"`
+	CreatedAt        time.Time               `json:"createdAt"`
+	ExpiresAt        time.Time               `json:"expiresAt"`
+	Messages         int64                   `json:"messages"`
+	ArchivedMessages int64                   `json:"archivedMessages"`
+	Summary          *models.SnapshotSummary `json:"summary,omitempty"`
+	RootHash         string                  `json:"rootHash"`
+	RolledUp         bool                    `json:"rolledUp"`
+	Entries          int                     `json:"entries"` // Message hashes kept; 0 once rolled up
+	Buckets          int                     `json:"buckets"`
+}
+
+// CreateSnapshot captures a conversation's messages, live and archived, as
+// hashes, with its counts and summary, to diff a later state against. A
+// conversation with more than SnapshotMaxEntries messages is rolled up to
+// its buckets. Snapshots expire after SnapshotTTL. Requires the admin scope.
+// POST /v1/admin/user/{phoneNumber}/snapshot
+func (h *Handler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.snapshots == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "snapshots are not configured")
+		return
+	}
+	phoneNumber, ok := pathParam(r.URL.Path, "/v1/admin/user/", "/snapshot")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	snap, err := h.captureConversation(phoneNumber, h.config.SnapshotMaxEntries)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not capture snapshot")
+		return
+	}
+	snap.CreatedBy = ClientIP(r)
+	snap.ExpiresAt = snap.CreatedAt.Add(h.config.SnapshotTTL)
+	snap, err = h.snapshots.SaveSnapshot(snap)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not save snapshot")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, snapshotResponse{
+		ID:               snap.ID,
+		PhoneNumber:      snap.PhoneNumber,
+		CreatedAt:        snap.CreatedAt,
+		ExpiresAt:        snap.ExpiresAt,
+		Messages:         snap.Messages,
+		ArchivedMessages: snap.ArchivedMessages,
+		Summary:          snap.Summary,
+		RootHash:         snap.RootHash,
+		RolledUp:         snap.RolledUp,
+		Entries:          len(snap.Entries),
+		Buckets:          len(snap.Buckets),
+	})
+}
+
+// DiffSnapshots reports the messages added, removed and modified from
+// snapshot ?from= to snapshot ?to=, or to the live conversation when ?to=
+// is live or left out. Against a rolled-up snapshot only the buckets that
+// changed can be told. Requires the admin scope.
+// GET /v1/admin/user/{phoneNumber}/diff?from={snapshot}&to={snapshot|live}
+func (h *Handler) DiffSnapshots(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.snapshots == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "snapshots are not configured")
+		return
+	}
+	phoneNumber, ok := pathParam(r.URL.Path, "/v1/admin/user/", "/diff")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+	query := r.URL.Query()
+	fromID := strings.TrimSpace(query.Get("from"))
+	toID := strings.TrimSpace(query.Get("to"))
+	if fromID == "" {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "from is required")
+		return
+	}
+
+	from, ok := h.conversationSnapshot(w, phoneNumber, fromID)
+	if !ok {
+		return
+	}
+	var to models.ConversationSnapshot
+	if toID == "" || toID == snapshot.Live {
+		var err error
+		if to, err = h.captureConversation(phoneNumber, 0); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not capture snapshot")
+			return
+		}
+	} else if to, ok = h.conversationSnapshot(w, phoneNumber, toID); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot.Compare(from, to))
+}
+
+// conversationSnapshot reads snapshot id of phoneNumber's conversation, or
+// answers 404 when it's missing, expired or of another conversation.
+func (h *Handler) conversationSnapshot(w http.ResponseWriter, phoneNumber, id string) (models.ConversationSnapshot, bool) {
+	snap, err := h.snapshots.GetSnapshot(id)
+	if err == nil && snap.PhoneNumber != phoneNumber {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "snapshot not found")
+		return models.ConversationSnapshot{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve snapshot")
+		return models.ConversationSnapshot{}, false
+	}
+	return snap, true
+}
+
+// captureConversation returns the unsaved snapshot of phoneNumber's
+// conversation now, keeping at most maxEntries hashes (0 for all).
+func (h *Handler) captureConversation(phoneNumber string, maxEntries int) (models.ConversationSnapshot, error) {
+	b := snapshot.NewBuilder(maxEntries)
+	err := eachMessage(func(page store.PageQuery) ([]models.Message, error) {
+		return h.store.FindByPhoneNumberPage(phoneNumber, page)
+	}, func(msg models.Message) error {
+		return b.Add(msg, false)
+	})
+	if err != nil {
+		return models.ConversationSnapshot{}, err
+	}
+	if h.archiver != nil {
+		err := eachMessage(func(page store.PageQuery) ([]models.Message, error) {
+			return h.archiver.FindArchivedByPhoneNumberPage(phoneNumber, page)
+		}, func(msg models.Message) error {
+			return b.Add(msg, true)
+		})
+		if err != nil {
+			return models.ConversationSnapshot{}, err
+		}
+	}
+
+	var summary *models.SnapshotSummary
+	if h.summaries != nil {
+		summaries, err := h.summaries.GetSummaries([]string{phoneNumber})
+		if err != nil {
+			return models.ConversationSnapshot{}, err
+		}
+		if s, ok := summaries[phoneNumber]; ok {
+			summary = &models.SnapshotSummary{
+				MessageCount:  s.MessageCount,
+				LastMessageID: s.LastMessageID,
+				LastMessageAt: s.LastMessageAt,
+				State:         s.State,
+			}
+		}
+	}
+
+	snap := b.Snapshot(phoneNumber, summary)
+	snap.CreatedAt = h.Clock().Now().UTC()
+	return snap, nil
+}
@@ -0,0 +1,75 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"sms-store/internal/store"
+)
+
+const (
+	defaultLatencyWindow = 5 * time.Minute
+	maxLatencyWindow     = time.Hour
+)
+
+// SetStoreLatency attaches the instrumented message store whose recent
+// latencies GET /v1/admin/store/latency reports. It answers 501 until one
+// is set.
+func (h *Handler) SetStoreLatency(s *store.InstrumentedStore) {
+	h.storeLatency = s
+}
+
+// GetStoreLatency summarizes recent store latencies per operation, for
+// environments that don't scrape /metrics. Requires the admin scope.
+// GET /v1/admin/store/latency?window=5m
+func (h *Handler) GetStoreLatency(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.storeLatency == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "store latency is not recorded")
+		return
+	}
+
+	window := defaultLatencyWindow
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > maxLatencyWindow {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "window must be a duration between 0 and "+maxLatencyWindow.String())
+			return
+		}
+		window = d
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"backend":    h.storeLatency.Backend(),
+		"window":     window.String(),
+		"operations": h.storeLatency.LatencySummary(window),
+	})
+}
+
+// SetStoreUsage attaches the message store GET /v1/admin/store/stats
+// reports on. It answers 501 until one is set.
+func (h *Handler) SetStoreUsage(u store.UsageReporter) {
+	h.storeUsage = u
+}
+
+// GetStoreStats reports how many messages the store holds and, for a
+// bounded memory store, its limits and evictions. Requires the admin scope.
+// GET /v1/admin/store/stats
+func (h *Handler) GetStoreStats(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.storeUsage == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "store usage is not reported")
+		return
+	}
+
+	usage, err := h.storeUsage.Usage()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve store usage")
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
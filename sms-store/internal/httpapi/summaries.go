@@ -0,0 +1,257 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const (
+	rebuildSummariesJobType = "rebuild_summaries"
+	checkSummariesJobType   = "check_summaries"
+	defaultSummarySample    = 100
+	maxSummarySample        = 10000
+	maxReportedMismatches   = 20
+)
+
+// SetSummaryStore attaches the pre-aggregated conversation summaries. Until
+// one is set, ?includeSummary=true and the summary admin endpoints answer 501.
+func (h *Handler) SetSummaryStore(ss store.SummaryStore) {
+	h.summaries = ss
+}
+
+// withSummaries fills in stored summaries, with their state as of now, and
+// orders convs by last message, newest first. Conversations without a
+// summary go last.
+func (h *Handler) withSummaries(convs []conversationWithPreferences) error {
+	summaries, err := h.summaries.GetSummaries(directPhoneNumbers(convs))
+	if err != nil {
+		return err
+	}
+	now := h.Clock().Now()
+	for i := range convs {
+		if s, ok := summaries[convs[i].PhoneNumber]; ok && convs[i].Type == models.ConversationDirect {
+			s = s.Current(now)
+			convs[i].Summary = &s
+		}
+	}
+
+	sort.SliceStable(convs, func(i, j int) bool {
+		a, aOK := convs[i].lastMessageAt()
+		b, bOK := convs[j].lastMessageAt()
+		if !aOK || !bOK {
+			return aOK
+		}
+		return a.After(b)
+	})
+	return nil
+}
+
+// RebuildSummaries recomputes conversation summaries from the messages, to
+// repair drift or to build them for the first time. Requires the admin scope.
+// POST /v1/admin/conversations/summaries/rebuild?phoneNumber=
+//
+// With ?phoneNumber= only that conversation is rebuilt and the response is
+// 200 with its summary; otherwise every summary is rebuilt in the background
+// and the response is 202 with the job.
+func (h *Handler) RebuildSummaries(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.summaries == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation summaries are not configured")
+		return
+	}
+
+	if phoneNumber := strings.TrimSpace(r.URL.Query().Get("phoneNumber")); phoneNumber != "" {
+		if _, err := h.summaries.RebuildSummaries([]string{phoneNumber}); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not rebuild conversation summary")
+			return
+		}
+		summaries, err := h.summaries.GetSummaries([]string{phoneNumber})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "could not retrieve conversation summary")
+			return
+		}
+		var summary *store.ConversationSummary
+		if s, ok := summaries[phoneNumber]; ok {
+			s = s.Current(h.Clock().Now())
+			summary = &s
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"phoneNumber": phoneNumber, "summary": summary})
+		return
+	}
+
+	job, err := h.jobs.Submit(rebuildSummariesJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		n, err := h.summaries.RebuildSummaries(nil)
+		if err != nil {
+			return nil, err
+		}
+		p.Add(n)
+		return map[string]any{"summaries": n}, nil
+	})
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start rebuild")
+		return
+	}
+
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": "Rebuild started",
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+// summaryMismatch is a conversation whose stored summary differs from the
+// one computed from its messages. Either side is null when missing.
+type summaryMismatch struct {
+	PhoneNumber string                     `json:"phoneNumber"`
+	Stored      *store.ConversationSummary `json:"stored"`
+	Actual      *store.ConversationSummary `json:"actual"`
+}
+
+// CheckSummaries compares a random sample of summaries with ones computed
+// from the messages, in the background. Requires the admin scope.
+// POST /v1/admin/conversations/summaries/check?sample=100&repair=true
+//
+// The sample takes ?sample= conversations from the messages, catching
+// missing summaries, and as many stored summaries, catching stale ones. With
+// ?repair=true mismatched conversations are rebuilt.
+func (h *Handler) CheckSummaries(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.summaries == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "conversation summaries are not configured")
+		return
+	}
+
+	q := r.URL.Query()
+	sample := defaultSummarySample
+	if raw := q.Get("sample"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxSummarySample {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "sample must be between 1 and "+strconv.Itoa(maxSummarySample))
+			return
+		}
+		sample = n
+	}
+	repair := q.Get("repair") == "true"
+
+	job, err := h.jobs.Submit(checkSummariesJobType, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		return h.runSummaryCheck(ctx, p, sample, repair)
+	})
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start check")
+		return
+	}
+
+	w.Header().Set("Location", "/v1/admin/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"message": "Consistency check started",
+		"jobId":   job.ID,
+		"job":     job,
+	})
+}
+
+func (h *Handler) runSummaryCheck(ctx context.Context, p *jobs.Progress, sample int, repair bool) (map[string]any, error) {
+	phoneNumbers, err := h.store.GetDistinctPhoneNumbers()
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(phoneNumbers), func(i, j int) { phoneNumbers[i], phoneNumbers[j] = phoneNumbers[j], phoneNumbers[i] })
+	if len(phoneNumbers) > sample {
+		phoneNumbers = phoneNumbers[:sample]
+	}
+
+	sampled, err := h.summaries.SampleSummaries(sample)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		seen[pn] = true
+	}
+	for _, s := range sampled {
+		if !seen[s.PhoneNumber] {
+			seen[s.PhoneNumber] = true
+			phoneNumbers = append(phoneNumbers, s.PhoneNumber)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stored, err := h.summaries.GetSummaries(phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := h.summaries.ComputeSummaries(phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	p.Add(int64(len(phoneNumbers)))
+
+	mismatched := make([]string, 0)
+	report := make([]summaryMismatch, 0)
+	for _, pn := range phoneNumbers {
+		s, hasStored := stored[pn]
+		a, hasActual := actual[pn]
+		if hasStored == hasActual && (!hasStored || summariesEqual(s, a)) {
+			continue
+		}
+		if hasStored && !hasActual && s.MessageCount == 0 {
+			continue // Opened with POST /v1/conversations, no messages yet
+		}
+		mismatched = append(mismatched, pn)
+		if len(report) < maxReportedMismatches {
+			m := summaryMismatch{PhoneNumber: pn}
+			if hasStored {
+				m.Stored = &s
+			}
+			if hasActual {
+				m.Actual = &a
+			}
+			report = append(report, m)
+		}
+	}
+
+	result := map[string]any{
+		"checked":           len(phoneNumbers),
+		"mismatched":        len(mismatched),
+		"mismatches":        report,
+		"repaired":          0,
+		"consistentPercent": consistentPercent(len(phoneNumbers), len(mismatched)),
+	}
+	if repair && len(mismatched) > 0 {
+		if _, err := h.summaries.RebuildSummaries(mismatched); err != nil {
+			return nil, err
+		}
+		result["repaired"] = len(mismatched)
+	}
+	return result, nil
+}
+
+// summariesEqual compares summaries at MongoDB's millisecond precision.
+func summariesEqual(a, b store.ConversationSummary) bool {
+	return a.LastMessageAt.UnixMilli() == b.LastMessageAt.UnixMilli() &&
+		a.LastMessageID == b.LastMessageID &&
+		a.Preview == b.Preview &&
+		a.MessageCount == b.MessageCount
+}
+
+func consistentPercent(checked, mismatched int) float64 {
+	if checked == 0 {
+		return 100
+	}
+	return float64(checked-mismatched) * 100 / float64(checked)
+}
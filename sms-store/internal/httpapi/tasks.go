@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"sms-store/internal/scheduler"
+)
+
+// SetScheduler attaches the scheduler of the server's periodic tasks,
+// enabling the /v1/admin/tasks endpoints.
+func (h *Handler) SetScheduler(s *scheduler.Scheduler) {
+	h.scheduler = s
+}
+
+// ListAdminTasks lists the periodic tasks with their last and next runs.
+// GET /v1/admin/tasks
+func (h *Handler) ListAdminTasks(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.scheduler == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "scheduled tasks are not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.scheduler.Tasks())
+}
+
+// RunAdminTask runs a periodic task now, in the background, without
+// changing its schedule. A task that is already running answers 409.
+// POST /v1/admin/tasks/{name}/run
+func (h *Handler) RunAdminTask(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.scheduler == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "scheduled tasks are not configured")
+		return
+	}
+
+	name, ok := pathParam(r.URL.Path, "/v1/admin/tasks/", "/run")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid task name")
+		return
+	}
+
+	status, err := h.scheduler.Trigger(name)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownTask):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "task not found")
+	case errors.Is(err, scheduler.ErrRunning):
+		writeErrorDetails(w, http.StatusConflict, "CONFLICT", "task is already running", status)
+	case errors.Is(err, scheduler.ErrStopped):
+		writeError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "server is shutting down")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not run task")
+	default:
+		writeJSON(w, http.StatusAccepted, status)
+	}
+}
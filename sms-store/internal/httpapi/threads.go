@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const defaultThreadDepth = 10
+
+// missingMessage stands in for an ancestor that has been deleted, so a
+// thread still renders when a message it quotes is gone.
+type missingMessage struct {
+	ID      string `json:"id"`
+	Missing bool   `json:"missing"`
+}
+
+type threadResponse struct {
+	MessageID string `json:"messageId"`
+	Thread    []any  `json:"thread"`    // models.Message or missingMessage
+	Truncated bool   `json:"truncated"` // More ancestors exist beyond ?depth=
+}
+
+// findMessage looks a message up by ID in the store and then, if one is
+// attached, in the archive.
+func (h *Handler) findMessage(id string) (models.Message, error) {
+	msg, err := h.store.FindByID(id)
+	if errors.Is(err, store.ErrNotFound) && h.archiver != nil {
+		return h.archiver.FindArchivedByID(id)
+	}
+	return msg, err
+}
+
+// checkReplyTo verifies that a new message in phoneNumber's conversation can
+// answer replyToID. It answers 404 for an unknown message and 422 for one in
+// another conversation, and returns false in those cases.
+func (h *Handler) checkReplyTo(w http.ResponseWriter, phoneNumber, replyToID string) bool {
+	parent, err := h.findMessage(replyToID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("replyToId %q does not exist", replyToID))
+		return false
+	}
+	if err != nil {
+		writeStoreError(w, err, "check replyToId")
+		return false
+	}
+	if parent.PhoneNumber != phoneNumber {
+		writeError(w, http.StatusUnprocessableEntity, "UNPROCESSABLE_ENTITY", "replyToId must reference a message in the same conversation")
+		return false
+	}
+	return true
+}
+
+// GetThread returns a message followed by the chain of messages it replies
+// to, nearest first, up to ?depth= ancestors (default 10, at most
+// ThreadMaxDepth). Deleted ancestors appear as {"id": ..., "missing": true}.
+// GET /messages/{id}/thread?depth=10
+func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
+	id, ok := messagePathID(r.URL.Path, "/thread")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return
+	}
+
+	depth := defaultThreadDepth
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > h.config.ThreadMaxDepth {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("depth must be between 0 and %d", h.config.ThreadMaxDepth))
+			return
+		}
+		depth = n
+	}
+
+	msg, err := h.findMessage(id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "message not found")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "fetch message")
+		return
+	}
+
+	resp := threadResponse{MessageID: id, Thread: []any{msg}}
+	seen := map[string]bool{id: true}
+	next := msg.ReplyToID
+	for next != "" && !seen[next] {
+		if len(resp.Thread) > depth {
+			resp.Truncated = true
+			break
+		}
+		seen[next] = true
+
+		parent, err := h.findMessage(next)
+		if errors.Is(err, store.ErrNotFound) {
+			resp.Thread = append(resp.Thread, missingMessage{ID: next, Missing: true})
+			break
+		}
+		if err != nil {
+			writeStoreError(w, err, "fetch thread")
+			return
+		}
+		resp.Thread = append(resp.Thread, parent)
+		next = parent.ReplyToID
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,245 @@
+package httpapi
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+const exportTimelineJobType = "export_timeline"
+
+// Types of the rows of a timeline export.
+const (
+	timelineMessage     = "message"      // A message of the conversation
+	timelineStateChange = "state_change" // The conversation was closed, reopened or snoozed
+	timelineAudit       = "audit"        // Another audit entry of the conversation
+)
+
+// timelineRow is one line of a timeline export: an entry of one of the
+// conversation's sources, at the time it is ordered by.
+type timelineRow struct {
+	Type    string             `json:"type"` // timelineMessage, timelineStateChange or timelineAudit
+	At      time.Time          `json:"at"`
+	Message *models.Message    `json:"message,omitempty"`
+	Audit   *models.AuditEntry `json:"audit,omitempty"` // Of a state change or audit row
+
+	source int    // Rank of the source the row came from, breaking ties of At
+	id     string // ID of the message or entry, breaking ties within a source
+}
+
+// before orders rows by time, then by source, then by ID, so rows at the
+// same instant come out the same way on every export.
+func (r timelineRow) before(o timelineRow) bool {
+	if !r.At.Equal(o.At) {
+		return r.At.Before(o.At)
+	}
+	if r.source != o.source {
+		return r.source < o.source
+	}
+	return r.id < o.id
+}
+
+// timelineCursor reads one source of a timeline a page at a time, oldest
+// first.
+type timelineCursor struct {
+	next func() ([]timelineRow, error) // The next page, empty once the source is done
+	page []timelineRow
+}
+
+// fill reads the cursor's next page once it has used up its current one.
+// It reports whether the cursor has a row left.
+func (c *timelineCursor) fill() (bool, error) {
+	if len(c.page) == 0 {
+		page, err := c.next()
+		if err != nil {
+			return false, err
+		}
+		c.page = page
+	}
+	return len(c.page) > 0, nil
+}
+
+// timelineHeap holds the cursors with rows left, the one with the earliest
+// row on top.
+type timelineHeap []*timelineCursor
+
+func (h timelineHeap) Len() int           { return len(h) }
+func (h timelineHeap) Less(i, j int) bool { return h[i].page[0].before(h[j].page[0]) }
+func (h timelineHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *timelineHeap) Push(x any)        { *h = append(*h, x.(*timelineCursor)) }
+func (h *timelineHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// mergeTimeline calls emit with the rows of every cursor in timeline order.
+// Each source must already be in that order. It holds one page per source
+// at a time, however long the sources are.
+func mergeTimeline(ctx context.Context, cursors []*timelineCursor, emit func(timelineRow) error) error {
+	h := make(timelineHeap, 0, len(cursors))
+	for _, c := range cursors {
+		ok, err := c.fill()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c := h[0]
+		row := c.page[0]
+		c.page = c.page[1:]
+		if err := emit(row); err != nil {
+			return err
+		}
+
+		ok, err := c.fill()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return nil
+}
+
+// runTimelineExport writes the timeline of phoneNumber, oldest first, as
+// one JSON object per line into an export named after the job.
+func (h *Handler) runTimelineExport(phoneNumber string, fc fieldCase) jobs.Func {
+	return func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		out, err := h.exports.Create(p.JobID())
+		if err != nil {
+			return nil, err
+		}
+
+		buf := bufio.NewWriter(out)
+		counts, err := h.writeTimeline(ctx, buf, phoneNumber, fc, p.Add)
+		if err != nil {
+			out.Abort()
+			return nil, err
+		}
+
+		if err := buf.Flush(); err != nil {
+			out.Abort()
+			return nil, err
+		}
+		size, err := out.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		var rows int64
+		for _, n := range counts {
+			rows += n
+		}
+		return map[string]any{
+			"phoneNumber": phoneNumber,
+			"format":      "timeline",
+			"rows":        rows,
+			"rowsByType":  counts,
+			"bytes":       size,
+			"downloadUrl": "/v1/exports/" + p.JobID(),
+			"expiresAt":   h.Clock().Now().Add(h.exports.TTL()),
+		}, nil
+	}
+}
+
+// writeTimeline merges the messages and audit entries of phoneNumber into
+// one NDJSON stream in timeline order, in the field naming fc, calling
+// progress after each row. It returns the rows written by type.
+func (h *Handler) writeTimeline(ctx context.Context, w io.Writer, phoneNumber string, fc fieldCase, progress func(int64)) (map[string]int64, error) {
+	cursors := []*timelineCursor{h.timelineMessages(phoneNumber)}
+	if h.audit != nil {
+		cursors = append(cursors, h.timelineAuditEntries(phoneNumber))
+	}
+
+	counts := map[string]int64{timelineMessage: 0, timelineStateChange: 0, timelineAudit: 0}
+	err := mergeTimeline(ctx, cursors, func(row timelineRow) error {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(transcodeResponse(line, fc), '\n')); err != nil {
+			return err
+		}
+		counts[row.Type]++
+		progress(1)
+		return nil
+	})
+	return counts, err
+}
+
+// timelineMessages is the cursor of phoneNumber's messages, by creation.
+func (h *Handler) timelineMessages(phoneNumber string) *timelineCursor {
+	page := store.PageQuery{Limit: exportPageSize, BatchSize: h.config.ExportBatchSize, OldestFirst: true}
+	done := false
+	return &timelineCursor{next: func() ([]timelineRow, error) {
+		if done {
+			return nil, nil
+		}
+		msgs, err := h.analyticsStore().FindByPhoneNumberPage(phoneNumber, page)
+		if err != nil {
+			return nil, err
+		}
+		done = len(msgs) < page.Limit
+		rows := make([]timelineRow, len(msgs))
+		for i := range msgs {
+			rows[i] = timelineRow{Type: timelineMessage, At: msgs[i].CreatedAt, Message: &msgs[i], source: 0, id: msgs[i].ID}
+		}
+		if len(msgs) > 0 {
+			last := msgs[len(msgs)-1]
+			page.After, page.AfterID = last.CreatedAt, last.ID
+		}
+		return rows, nil
+	}}
+}
+
+// timelineAuditEntries is the cursor of the audit entries of phoneNumber's
+// conversation, by time. Conversation state transitions are state change
+// rows; other entries, such as profile merges, are audit rows.
+func (h *Handler) timelineAuditEntries(phoneNumber string) *timelineCursor {
+	q := store.AuditQuery{PhoneNumber: phoneNumber, Limit: exportPageSize, OldestFirst: true}
+	done := false
+	return &timelineCursor{next: func() ([]timelineRow, error) {
+		if done {
+			return nil, nil
+		}
+		entries, err := h.audit.ListAudit(q)
+		if err != nil {
+			return nil, err
+		}
+		done = len(entries) < q.Limit
+		rows := make([]timelineRow, len(entries))
+		for i := range entries {
+			typ := timelineAudit
+			switch entries[i].Action {
+			case models.AuditConversationClosed, models.AuditConversationReopened, models.AuditConversationSnoozed:
+				typ = timelineStateChange
+			}
+			rows[i] = timelineRow{Type: typ, At: entries[i].At, Audit: &entries[i], source: 1, id: entries[i].ID}
+		}
+		if len(entries) > 0 {
+			last := entries[len(entries)-1]
+			q.After, q.AfterID = last.At, last.ID
+		}
+		return rows, nil
+	}}
+}
@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"sms-store/internal/store"
+)
+
+// SetTombstoneStore attaches the conversation tombstone store.
+// Tombstone endpoints answer 501 until one is set.
+func (h *Handler) SetTombstoneStore(ts store.TombstoneStore) {
+	h.tombstoneStore = ts
+}
+
+// ListTombstones lists active conversation tombstones.
+// GET /v1/admin/tombstones
+func (h *Handler) ListTombstones(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.tombstoneStore == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "tombstones are not configured")
+		return
+	}
+
+	tombstones, err := h.tombstoneStore.ListTombstones()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not list tombstones")
+		return
+	}
+	writeJSON(w, http.StatusOK, tombstones)
+}
+
+// DeleteTombstone clears a conversation tombstone so older events for the
+// number are accepted again.
+// DELETE /v1/admin/tombstones/{phoneNumber}
+func (h *Handler) DeleteTombstone(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	if h.tombstoneStore == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "tombstones are not configured")
+		return
+	}
+
+	phoneNumber := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/v1/admin/tombstones/"))
+	if phoneNumber == "" || strings.Contains(phoneNumber, "/") {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	if err := h.tombstoneStore.DeleteTombstone(phoneNumber); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "tombstone not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not delete tombstone")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":     "Tombstone cleared",
+		"phoneNumber": phoneNumber,
+	})
+}
@@ -0,0 +1,179 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-store/internal/jobs"
+	"sms-store/internal/store"
+	"sms-store/internal/transcript"
+)
+
+const transcriptJobType = "transcript_pdf"
+
+type transcriptStartedResponse struct {
+	Message     string   `json:"message"`
+	JobID       string   `json:"jobId"`
+	DownloadURL string   `json:"downloadUrl"`
+	Job         jobs.Job `json:"job"`
+}
+
+// GetTranscript renders a conversation as a human-readable transcript,
+// oldest message first, with times in ?tz= (default UTC).
+// GET /v1/user/{phoneNumber}/messages/transcript?format=html|pdf&tz=Asia/Kolkata
+//
+// HTML is streamed as it is rendered. A PDF is built in the background like
+// an export: the response is 202 with the job, and the file is downloaded
+// from GET /v1/exports/{jobId}.
+func (h *Handler) GetTranscript(w http.ResponseWriter, r *http.Request) {
+	phoneNumber, ok := userPathPhoneNumber(r.URL.Path, "/messages/transcript")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid phoneNumber")
+		return
+	}
+
+	q := r.URL.Query()
+	format := strings.ToLower(strings.TrimSpace(q.Get("format")))
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "pdf" {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be html or pdf")
+		return
+	}
+	loc, err := parseTimezone(q.Get("tz"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "tz must be a valid IANA time zone name")
+		return
+	}
+
+	header := h.transcriptHeader(w, phoneNumber, loc)
+
+	if format == "pdf" {
+		h.startTranscriptPDF(w, header)
+		return
+	}
+
+	filename := phoneNumber + "-transcript.html"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are gone by now, so a failure can only cut the page short
+	buf := bufio.NewWriter(w)
+	tw, err := transcript.NewHTMLWriter(buf, header)
+	if err == nil {
+		_, err = h.writeTranscript(r.Context(), tw, phoneNumber, func(int64) {})
+	}
+	if err != nil {
+		log.Printf("Transcript of %s stopped: %v", phoneNumber, err)
+		return
+	}
+	if err := buf.Flush(); err != nil {
+		recordWriteError(w, err)
+	}
+}
+
+// transcriptHeader describes phoneNumber's conversation, with the profile
+// name when there is one and the profile store answers in time.
+func (h *Handler) transcriptHeader(w http.ResponseWriter, phoneNumber string, loc *time.Location) transcript.Header {
+	header := transcript.Header{PhoneNumber: phoneNumber, Location: loc, GeneratedAt: h.Clock().Now()}
+	profiles, _ := h.lookupProfiles(w, []string{phoneNumber})
+	header.Name = profiles[phoneNumber].Name
+	return header
+}
+
+// startTranscriptPDF answers 202 with a job building the PDF transcript.
+// A request for a transcript already being built returns that job.
+func (h *Handler) startTranscriptPDF(w http.ResponseWriter, header transcript.Header) {
+	if h.exports == nil {
+		writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "exports are not configured")
+		return
+	}
+
+	key := transcriptJobType + ":" + header.PhoneNumber + ":" + header.Location.String()
+	job, err := h.jobs.SubmitKeyed(transcriptJobType, key, h.runTranscriptPDF(header))
+	if err != nil && !errors.Is(err, jobs.ErrAlreadyRunning) {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "could not start transcript")
+		return
+	}
+
+	downloadURL := "/v1/exports/" + job.ID
+	w.Header().Set("Location", downloadURL)
+	writeJSON(w, http.StatusAccepted, transcriptStartedResponse{
+		Message:     "Transcript started",
+		JobID:       job.ID,
+		DownloadURL: downloadURL,
+		Job:         job,
+	})
+}
+
+// runTranscriptPDF writes the PDF transcript into an export named after the job.
+func (h *Handler) runTranscriptPDF(header transcript.Header) jobs.Func {
+	return func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		out, err := h.exports.Create(p.JobID())
+		if err != nil {
+			return nil, err
+		}
+
+		buf := bufio.NewWriter(out)
+		count, err := h.writeTranscript(ctx, transcript.NewPDFWriter(buf, header), header.PhoneNumber, p.Add)
+		if err == nil {
+			err = buf.Flush()
+		}
+		if err != nil {
+			out.Abort()
+			return nil, err
+		}
+		size, err := out.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{
+			"phoneNumber": header.PhoneNumber,
+			"format":      "pdf",
+			"timezone":    header.Location.String(),
+			"messages":    count,
+			"bytes":       size,
+			"downloadUrl": "/v1/exports/" + p.JobID(),
+			"expiresAt":   h.Clock().Now().Add(h.exports.TTL()),
+		}, nil
+	}
+}
+
+// writeTranscript writes every message of phoneNumber, oldest first, to tw
+// and closes it, calling progress after each page.
+func (h *Handler) writeTranscript(ctx context.Context, tw transcript.Writer, phoneNumber string, progress func(int64)) (int64, error) {
+	page := store.PageQuery{Limit: exportPageSize, OldestFirst: true, BatchSize: h.config.ExportBatchSize}
+	var count int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		msgs, err := h.analyticsStore().FindByPhoneNumberPage(phoneNumber, page)
+		if err != nil {
+			return count, err
+		}
+		for _, msg := range msgs {
+			if err := tw.Write(msg); err != nil {
+				return count, err
+			}
+		}
+		count += int64(len(msgs))
+		progress(int64(len(msgs)))
+
+		if len(msgs) < page.Limit {
+			return count, tw.Close()
+		}
+		last := msgs[len(msgs)-1]
+		page.After, page.AfterID = last.CreatedAt, last.ID
+	}
+}
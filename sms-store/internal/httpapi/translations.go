@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// maxTranslationLength is the most characters a translation keeps.
+const maxTranslationLength = 2000
+
+type translationRequest struct {
+	Text string `json:"text"`
+}
+
+func (req *translationRequest) validate() error {
+	if strings.TrimSpace(req.Text) == "" || utf8.RuneCountInString(req.Text) > maxTranslationLength {
+		return fmt.Errorf("text is required and at most %d characters", maxTranslationLength)
+	}
+	return nil
+}
+
+type translationsResponse struct {
+	MessageID    string               `json:"messageId"`
+	Translations []models.Translation `json:"translations"` // In the order their languages were first set
+}
+
+// SetTranslation stores a message's text translated into a language by the
+// client; this service translates nothing itself. A translation, once set,
+// is only replaced with ?overwrite=true. A message keeps translations into
+// at most store.MaxTranslationsPerMessage languages.
+// PUT /messages/{id}/translations/{lang}?overwrite=true
+func (h *Handler) SetTranslation(w http.ResponseWriter, r *http.Request) {
+	id, language, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/messages/"), "/translations/")
+	if !found || id == "" || strings.Contains(id, "/") || !languageTag.MatchString(language) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID or language code")
+		return
+	}
+	language = canonicalLanguage(language)
+	var req translationRequest
+	if !h.decodeValid(w, r, &req) {
+		return
+	}
+
+	msg, err := h.store.SetTranslation(id, models.Translation{
+		Language:  language,
+		Text:      req.Text,
+		CreatedAt: h.Clock().Now().UTC(),
+	}, r.URL.Query().Get("overwrite") == "true")
+	switch {
+	case errors.Is(err, store.ErrAlreadyExists):
+		writeError(w, http.StatusConflict, "CONFLICT", fmt.Sprintf("message already has a translation into %s; set ?overwrite=true to replace it", language))
+		return
+	case errors.Is(err, store.ErrTooManyTranslations):
+		writeError(w, http.StatusConflict, "CONFLICT", fmt.Sprintf("message already has translations into %d languages", store.MaxTranslationsPerMessage))
+		return
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "message not found")
+		return
+	case err != nil:
+		writeStoreError(w, err, "update translations")
+		return
+	}
+	writeJSON(w, http.StatusOK, newTranslationsResponse(msg))
+}
+
+// GetTranslations returns every translation of a message.
+// GET /messages/{id}/translations
+func (h *Handler) GetTranslations(w http.ResponseWriter, r *http.Request) {
+	id, ok := messagePathID(r.URL.Path, "/translations")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid message ID")
+		return
+	}
+	msg, err := h.store.FindByID(id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "message not found")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "retrieve translations")
+		return
+	}
+	writeJSON(w, http.StatusOK, newTranslationsResponse(msg))
+}
+
+func newTranslationsResponse(msg models.Message) translationsResponse {
+	resp := translationsResponse{MessageID: msg.ID, Translations: msg.Translations}
+	if resp.Translations == nil {
+		resp.Translations = []models.Translation{}
+	}
+	return resp
+}
+
+// canonicalLanguage writes a language code, which matches languageTag, in
+// the conventional case of BCP 47, as in hi-Latn or pt-BR, so each language
+// is stored under one code.
+func canonicalLanguage(code string) string {
+	subtags := strings.Split(code, "-")
+	subtags[0] = strings.ToLower(subtags[0])
+	for i, subtag := range subtags[1:] {
+		switch len(subtag) {
+		case 2:
+			subtags[i+1] = strings.ToUpper(subtag)
+		case 4:
+			subtags[i+1] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		default:
+			subtags[i+1] = strings.ToLower(subtag)
+		}
+	}
+	return strings.Join(subtags, "-")
+}
+
+// parseIncludedTranslations reads ?includeTranslations=, a comma-separated
+// list of language codes; empty includes none.
+func parseIncludedTranslations(q url.Values) ([]string, error) {
+	raw := strings.TrimSpace(q.Get("includeTranslations"))
+	if raw == "" {
+		return nil, nil
+	}
+	var languages []string
+	for _, code := range strings.Split(raw, ",") {
+		code = strings.TrimSpace(code)
+		if !languageTag.MatchString(code) {
+			return nil, errors.New("includeTranslations must be language codes such as hi or hi,ta")
+		}
+		languages = append(languages, canonicalLanguage(code))
+	}
+	return languages, nil
+}
+
+// withTranslations shows each message's translations into languages, which
+// listings otherwise leave out. The messages are copied rather than changed,
+// as stores may share them.
+func withTranslations(messages []models.Message, languages []string) []models.Message {
+	if len(languages) == 0 {
+		return messages
+	}
+	shown := make([]models.Message, len(messages))
+	for i, msg := range messages {
+		for _, t := range msg.Translations {
+			if slices.Contains(languages, t.Language) {
+				msg.IncludedTranslations = append(msg.IncludedTranslations, t)
+			}
+		}
+		shown[i] = msg
+	}
+	return shown
+}
@@ -0,0 +1,25 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"sms-store/internal/version"
+)
+
+// appVersionHeader carries the running build's version on every response.
+const appVersionHeader = "X-App-Version"
+
+// Version reports the running build.
+// GET /version
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
+
+// AppVersion sets X-App-Version on every response.
+func AppVersion(next http.Handler) http.Handler {
+	v := version.Get().Version
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(appVersionHeader, v)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,178 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// warmUp is the progress of the startup warm-up, which runs the queries
+// behind GET /v1/conversations once so MongoDB has their indexes and
+// documents in memory before the first client asks.
+type warmUp struct {
+	timeout time.Duration
+	started time.Time
+
+	mu       sync.Mutex
+	total    int
+	done     int
+	step     string   // Running step; empty once all have run
+	failed   []string // Steps that returned an error
+	finished bool
+	took     time.Duration // Set once finished
+	timedOut bool
+}
+
+// warmUpStep is one query of the warm-up.
+type warmUpStep struct {
+	name string
+	run  func() error
+}
+
+// warmUpProgress is how far the warm-up got, as /healthz and /readyz
+// report it.
+type warmUpProgress struct {
+	Step     string   `json:"step,omitempty"`
+	Done     int      `json:"done"`
+	Total    int      `json:"total"`
+	Elapsed  string   `json:"elapsed"`
+	Failed   []string `json:"failed,omitempty"`
+	TimedOut bool     `json:"timedOut,omitempty"`
+}
+
+type readyResponse struct {
+	Status string          `json:"status"`
+	WarmUp *warmUpProgress `json:"warmUp,omitempty"`
+}
+
+// StartWarmUp runs the warm-up in the background and reports it on /healthz
+// as the "warmup" component. /readyz answers 503 until it has finished, or
+// for at most timeout: a slow warm-up then carries on behind a ready
+// instance, which serves cold queries meanwhile, so it can't hold up a
+// rollout. It must be called before the server starts handling requests,
+// once the stores are set.
+func (h *Handler) StartWarmUp(timeout time.Duration) {
+	steps := h.warmUpSteps()
+	wu := &warmUp{timeout: timeout, started: time.Now(), total: len(steps)}
+	h.warmUp = wu
+	h.RegisterHealthCheck("warmup", wu.health)
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		wu.run(steps)
+	}()
+	go func() {
+		select {
+		case <-finished:
+		case <-time.After(timeout):
+			wu.mu.Lock()
+			wu.timedOut = true
+			step := wu.step
+			wu.mu.Unlock()
+			log.Printf("Warm-up timed out after %v during %s; serving cold until it finishes", timeout, step)
+		}
+	}()
+}
+
+// warmUpSteps lists the queries to warm, skipping stores that aren't set.
+func (h *Handler) warmUpSteps() []warmUpStep {
+	var phoneNumbers []string
+	steps := []warmUpStep{{"conversations", func() (err error) {
+		phoneNumbers, err = h.conversationPhoneNumbers()
+		return err
+	}}}
+	if h.summaries != nil {
+		steps = append(steps, warmUpStep{"summaries", func() error {
+			if _, err := h.summaries.GetSummaries(phoneNumbers); err != nil {
+				return err
+			}
+			_, err := h.summaries.ListEmptySummaries()
+			return err
+		}})
+	}
+	if h.archiver != nil {
+		steps = append(steps, warmUpStep{"counts", func() error {
+			_, err := h.archiver.ConversationCounts(phoneNumbers)
+			return err
+		}})
+	}
+	return steps
+}
+
+// run runs steps in order. A failed step is logged and skipped: warming is
+// an optimization, and the queries answer errors of their own later.
+func (wu *warmUp) run(steps []warmUpStep) {
+	for _, s := range steps {
+		wu.mu.Lock()
+		wu.step = s.name
+		wu.mu.Unlock()
+
+		err := s.run()
+
+		wu.mu.Lock()
+		wu.done++
+		if err != nil {
+			wu.failed = append(wu.failed, s.name)
+		}
+		wu.mu.Unlock()
+		if err != nil {
+			log.Printf("Warm-up step %s failed: %v", s.name, err)
+		}
+	}
+
+	took := time.Since(wu.started).Round(time.Millisecond)
+	wu.mu.Lock()
+	wu.step = ""
+	wu.finished = true
+	wu.took = took
+	wu.mu.Unlock()
+	log.Printf("Warm-up finished in %v", took)
+}
+
+// progress returns the warm-up's progress, and whether it still holds up
+// readiness.
+func (wu *warmUp) progress() (warmUpProgress, bool) {
+	wu.mu.Lock()
+	defer wu.mu.Unlock()
+	elapsed := wu.took
+	if !wu.finished {
+		elapsed = time.Since(wu.started).Round(time.Millisecond)
+	}
+	p := warmUpProgress{
+		Step:     wu.step,
+		Done:     wu.done,
+		Total:    wu.total,
+		Elapsed:  elapsed.String(),
+		Failed:   slices.Clone(wu.failed),
+		TimedOut: wu.timedOut,
+	}
+	return p, !wu.finished && !wu.timedOut
+}
+
+func (wu *warmUp) health() ComponentHealth {
+	p, pending := wu.progress()
+	switch {
+	case pending:
+		return ComponentHealth{Status: HealthConnecting, Message: "warming up", Details: p}
+	case p.TimedOut && p.Done < p.Total:
+		return ComponentHealth{Status: HealthConnecting, Message: "warm-up timed out after " + wu.timeout.String() + "; serving cold", Details: p}
+	}
+	return ComponentHealth{Status: HealthUp, Details: p}
+}
+
+// Readyz reports whether the instance should receive traffic: 503 "WARMING"
+// with the warm-up's progress while StartWarmUp holds it back, 200 "READY"
+// otherwise. Dependency health is on /healthz.
+// GET /readyz
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if h.warmUp != nil {
+		if p, pending := h.warmUp.progress(); pending {
+			writeJSON(w, http.StatusServiceUnavailable, readyResponse{Status: "WARMING", WarmUp: &p})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, readyResponse{Status: "READY"})
+}
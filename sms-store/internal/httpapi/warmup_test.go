@@ -0,0 +1,84 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sms-store/internal/store"
+)
+
+// slowDistinctStore holds GetDistinctPhoneNumbers back until release is
+// closed, as a cold MongoDB would.
+type slowDistinctStore struct {
+	store.Store
+	release chan struct{}
+}
+
+func (s *slowDistinctStore) GetDistinctPhoneNumbers() ([]string, error) {
+	<-s.release
+	return s.Store.GetDistinctPhoneNumbers()
+}
+
+// readyz returns the status and warm-up progress GET /readyz answers.
+func readyz(t *testing.T, h *Handler) (int, readyResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp readyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+// waitReady polls GET /readyz until it answers 200, failing after within.
+func waitReady(t *testing.T, h *Handler, within time.Duration) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for {
+		if code, _ := readyz(t, h); code == http.StatusOK {
+			return time.Since(start)
+		}
+		if time.Since(start) > within {
+			t.Fatalf("not ready after %v", within)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWarmUpHoldsReadinessUntilItFinishes(t *testing.T) {
+	s := &slowDistinctStore{Store: store.NewMemoryStore(), release: make(chan struct{})}
+	h := NewHandler(s, store.NewMemoryProfileStore())
+	h.StartWarmUp(time.Minute)
+
+	code, resp := readyz(t, h)
+	if code != http.StatusServiceUnavailable || resp.Status != "WARMING" || resp.WarmUp == nil || resp.WarmUp.Done != 0 || resp.WarmUp.Total != 1 {
+		t.Fatalf("GET /readyz = %d %+v, want 503 WARMING with no step done", code, resp)
+	}
+	close(s.release)
+	waitReady(t, h, 5*time.Second)
+	if health := h.warmUp.health(); health.Status != HealthUp {
+		t.Fatalf("warmup health = %+v, want up", health)
+	}
+}
+
+func TestWarmUpTimeoutServesCold(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	s := &slowDistinctStore{Store: store.NewMemoryStore(), release: make(chan struct{})}
+	defer close(s.release)
+	h := NewHandler(s, store.NewMemoryProfileStore())
+	h.StartWarmUp(timeout)
+
+	// Ready once the timeout passes, with the query still running
+	if waited := waitReady(t, h, 5*time.Second); waited > timeout+time.Second {
+		t.Fatalf("ready after %v, want about the %v timeout", waited, timeout)
+	}
+	health := h.warmUp.health()
+	p, _ := health.Details.(warmUpProgress)
+	if health.Status != HealthConnecting || !p.TimedOut || p.Done != 0 || p.Step != "conversations" {
+		t.Fatalf("warmup health = %+v, want the timed-out warm-up still on conversations", health)
+	}
+}
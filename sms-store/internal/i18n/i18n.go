@@ -0,0 +1,228 @@
+// Package i18n translates the messages of API errors. Handlers keep writing
+// errors in English; a message is recognized by matching it against the
+// English catalog, whose templates name their variable parts, such as
+// "{field} is required", and answered with the template of the same ID in
+// the client's language, filled with the same values. Catalogs are JSON
+// files embedded from catalogs/, one per language, so adding a language
+// takes only a file. A message no catalog knows is answered as it is.
+package i18n
+
+import (
+	"cmp"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language messages are written in, and answered in
+// when the client accepts none of the catalogs'.
+const DefaultLanguage = "en"
+
+//go:embed catalogs/*.json
+var embedded embed.FS
+
+// Default is the catalog of the embedded languages.
+var Default = mustLoad(embedded)
+
+// placeholder matches a variable part of a template, such as {field}.
+var placeholder = regexp.MustCompile(`\{([A-Za-z]+)\}`)
+
+// Catalog holds the message templates of each language by ID.
+type Catalog struct {
+	languages map[string]map[string]string
+	exact     map[string]string // English message without placeholders to its ID
+	patterns  []pattern         // Tried in order; longer literal text first
+}
+
+// pattern recognizes the English messages of a template with placeholders.
+type pattern struct {
+	id      string
+	re      *regexp.Regexp
+	names   []string // Placeholder of each capture group
+	literal int      // Length of the template's fixed text
+}
+
+func mustLoad(fsys fs.FS) *Catalog {
+	c, err := Load(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load reads the catalogs from the catalogs/*.json files of fsys, each named
+// after its language tag and mapping message IDs to templates. The English
+// catalog is required, and the others may only use its IDs and, in each
+// template, the placeholders of the English one.
+func Load(fsys fs.FS) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "catalogs/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{languages: make(map[string]map[string]string), exact: make(map[string]string)}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var templates map[string]string
+		if err := json.Unmarshal(data, &templates); err != nil {
+			return nil, fmt.Errorf("catalog %s: %w", file, err)
+		}
+		c.languages[strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))] = templates
+	}
+
+	english, ok := c.languages[DefaultLanguage]
+	if !ok {
+		return nil, fmt.Errorf("catalog %s.json is required", DefaultLanguage)
+	}
+	for lang, templates := range c.languages {
+		for id, tmpl := range templates {
+			source, ok := english[id]
+			if !ok {
+				return nil, fmt.Errorf("catalog %s: message %s is not in the %s catalog", lang, id, DefaultLanguage)
+			}
+			for _, name := range placeholders(tmpl) {
+				if !slices.Contains(placeholders(source), name) {
+					return nil, fmt.Errorf("catalog %s: message %s uses unknown placeholder {%s}", lang, id, name)
+				}
+			}
+		}
+	}
+
+	for id, tmpl := range english {
+		names := placeholders(tmpl)
+		if len(names) == 0 {
+			c.exact[tmpl] = id
+			continue
+		}
+		var expr strings.Builder
+		expr.WriteByte('^')
+		for i, part := range placeholder.Split(tmpl, -1) {
+			if i > 0 {
+				expr.WriteString("(.+?)")
+			}
+			expr.WriteString(regexp.QuoteMeta(part))
+		}
+		expr.WriteByte('$')
+		c.patterns = append(c.patterns, pattern{
+			id:      id,
+			re:      regexp.MustCompile(expr.String()),
+			names:   names,
+			literal: len(placeholder.ReplaceAllString(tmpl, "")),
+		})
+	}
+	slices.SortFunc(c.patterns, func(a, b pattern) int {
+		return cmp.Or(cmp.Compare(b.literal, a.literal), cmp.Compare(a.id, b.id))
+	})
+	return c, nil
+}
+
+func placeholders(tmpl string) []string {
+	var names []string
+	for _, m := range placeholder.FindAllStringSubmatch(tmpl, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// Languages returns the tags of the catalog's languages, sorted.
+func (c *Catalog) Languages() []string {
+	langs := make([]string, 0, len(c.languages))
+	for lang := range c.languages {
+		langs = append(langs, lang)
+	}
+	slices.Sort(langs)
+	return langs
+}
+
+// Negotiate returns the language of the catalog an Accept-Language header
+// prefers: its tags are tried by descending quality, each as given and
+// then without its region, so "hi-IN" falls back to "hi". It returns
+// DefaultLanguage when none matches.
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	slices.SortStableFunc(tags, func(a, b weighted) int { return cmp.Compare(b.q, a.q) })
+
+	for _, t := range tags {
+		if t.tag == "*" {
+			return DefaultLanguage
+		}
+		if _, ok := c.languages[t.tag]; ok {
+			return t.tag
+		}
+		if base, _, ok := strings.Cut(t.tag, "-"); ok {
+			if _, ok := c.languages[base]; ok {
+				return base
+			}
+		}
+	}
+	return DefaultLanguage
+}
+
+// Translate returns message in lang, and the language it is in: lang, or
+// DefaultLanguage when the message isn't in the catalog or lang's catalog
+// lacks it.
+func (c *Catalog) Translate(message, lang string) (string, string) {
+	if lang == DefaultLanguage {
+		return message, DefaultLanguage
+	}
+	templates, ok := c.languages[lang]
+	if !ok {
+		return message, DefaultLanguage
+	}
+
+	if id, ok := c.exact[message]; ok {
+		if tmpl, ok := templates[id]; ok {
+			return tmpl, lang
+		}
+		return message, DefaultLanguage
+	}
+	for _, p := range c.patterns {
+		m := p.re.FindStringSubmatch(message)
+		if m == nil {
+			continue
+		}
+		tmpl, ok := templates[p.id]
+		if !ok {
+			return message, DefaultLanguage
+		}
+		values := make(map[string]string, len(p.names))
+		for i, name := range p.names {
+			values[name] = m[i+1]
+		}
+		return placeholder.ReplaceAllStringFunc(tmpl, func(ph string) string {
+			return values[ph[1:len(ph)-1]]
+		}), lang
+	}
+	return message, DefaultLanguage
+}
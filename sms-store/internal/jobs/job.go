@@ -0,0 +1,77 @@
+// Package jobs runs long admin operations (mass deletes, purges, backfills,
+// exports) in the background and records their state so clients can poll
+// progress, cancel them, and read the outcome after the server restarts.
+package jobs
+
+import (
+	"errors"
+	"time"
+)
+
+// Job statuses.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	// ErrNotFound is returned when no job has the given ID.
+	ErrNotFound = errors.New("job not found")
+
+	// ErrAlreadyRunning is returned by Submit when a job of the same type is
+	// queued or running.
+	ErrAlreadyRunning = errors.New("a job of this type is already running")
+
+	// ErrFinished is returned by Cancel for a job that has already finished.
+	ErrFinished = errors.New("job already finished")
+)
+
+// Job is the recorded state of one background job.
+type Job struct {
+	ID         string         `json:"id" bson:"id"`
+	Type       string         `json:"type" bson:"type"`
+	Status     string         `json:"status" bson:"status"`
+	Processed  int64          `json:"processed" bson:"processed"`
+	Total      int64          `json:"total" bson:"total"`
+	Progress   float64        `json:"progress" bson:"progress"`                               // Percent complete, 0-100
+	Rate       float64        `json:"ratePerSecond,omitempty" bson:"ratePerSecond,omitempty"` // Items processed per second since the job started
+	ETA        *time.Time     `json:"eta,omitempty" bson:"eta,omitempty"`                     // Estimated finish at the current rate
+	Error      string         `json:"error,omitempty" bson:"error,omitempty"`
+	Result     map[string]any `json:"result,omitempty" bson:"result,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt" bson:"createdAt"`
+	StartedAt  *time.Time     `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	UpdatedAt  time.Time      `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Finished reports whether the job reached a final status.
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// ListFilter narrows List results. Zero values match everything.
+type ListFilter struct {
+	Type   string
+	Status string
+	Limit  int
+}
+
+// Repository persists job state.
+type Repository interface {
+	// Save creates or replaces a job by ID.
+	Save(job Job) error
+
+	// Get retrieves a job by ID. Returns ErrNotFound if it does not exist.
+	Get(id string) (Job, error)
+
+	// List retrieves jobs matching filter, newest first.
+	List(filter ListFilter) ([]Job, error)
+
+	// FailUnfinished marks every queued or running job as failed with reason.
+	// It is called at startup, when no job from a previous process can still
+	// be running. Returns the number of jobs updated.
+	FailUnfinished(reason string) (int64, error)
+}
@@ -0,0 +1,303 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+)
+
+// Func is the body of a job. It should return promptly once ctx is
+// cancelled and report progress through p. The returned result is stored
+// on the job when it succeeds.
+type Func func(ctx context.Context, p *Progress) (map[string]any, error)
+
+// persistInterval throttles how often progress updates are written.
+const persistInterval = time.Second
+
+// Manager runs jobs in background goroutines, at most one queued or running
+// job per key (by default the job type), and keeps their state in a Repository.
+//
+// Jobs only run in the process that submitted them; a restart cannot resume
+// them, so NewManager marks jobs left unfinished by a previous process as
+// failed. Run one Manager per repository.
+type Manager struct {
+	repo Repository
+
+	mu     sync.Mutex
+	active map[string]*run   // By job ID
+	byKey  map[string]string // Exclusivity key -> active job ID
+
+	clock.Clocked
+}
+
+type run struct {
+	job       Job
+	key       string
+	cancel    context.CancelFunc
+	cancelled bool
+	persisted time.Time
+	done      chan struct{}
+}
+
+// NewManager creates a manager storing jobs in repo.
+func NewManager(repo Repository) *Manager {
+	if n, err := repo.FailUnfinished("interrupted by server restart"); err != nil {
+		log.Printf("Warning: could not mark interrupted jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted job(s) as failed", n)
+	}
+
+	return &Manager{
+		repo:   repo,
+		active: make(map[string]*run),
+		byKey:  make(map[string]string),
+	}
+}
+
+// Submit queues fn as a new job of jobType and starts it. If a job of that
+// type is already queued or running, it returns that job and ErrAlreadyRunning.
+func (m *Manager) Submit(jobType string, fn Func) (Job, error) {
+	return m.SubmitKeyed(jobType, jobType, fn)
+}
+
+// SubmitKeyed is like Submit but only one job per key may be queued or
+// running, so jobs of one type can run side by side for different keys,
+// e.g. one export per conversation.
+func (m *Manager) SubmitKeyed(jobType, key string, fn Func) (Job, error) {
+	m.mu.Lock()
+	if id, ok := m.byKey[key]; ok {
+		job := m.active[id].job
+		m.mu.Unlock()
+		return job, ErrAlreadyRunning
+	}
+
+	now := m.Clock().Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &run{
+		job: Job{
+			ID:        newJobID(),
+			Type:      jobType,
+			Status:    StatusQueued,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		key:    key,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if err := m.repo.Save(r.job); err != nil {
+		m.mu.Unlock()
+		cancel()
+		return Job{}, err
+	}
+	m.active[r.job.ID] = r
+	m.byKey[key] = r.job.ID
+	job := r.job
+	m.mu.Unlock()
+
+	go m.execute(ctx, r, fn)
+	return job, nil
+}
+
+func (m *Manager) execute(ctx context.Context, r *run, fn Func) {
+	m.update(r, true, func(job *Job) {
+		started := m.Clock().Now()
+		job.Status = StatusRunning
+		job.StartedAt = &started
+	})
+
+	result, err := m.call(ctx, r, fn)
+
+	m.mu.Lock()
+	cancelled := r.cancelled
+	m.mu.Unlock()
+
+	m.update(r, true, func(job *Job) {
+		finished := m.Clock().Now()
+		job.FinishedAt = &finished
+		job.ETA = nil
+		switch {
+		case cancelled:
+			job.Status = StatusCancelled
+		case err != nil:
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		default:
+			job.Status = StatusSucceeded
+			job.Progress = 100
+			job.Result = result
+		}
+	})
+
+	m.mu.Lock()
+	delete(m.active, r.job.ID)
+	delete(m.byKey, r.key)
+	m.mu.Unlock()
+	r.cancel()
+	close(r.done)
+}
+
+// call runs fn, turning a panic into a job failure.
+func (m *Manager) call(ctx context.Context, r *run, fn Func) (result map[string]any, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("Job %s (%s) panicked: %v", r.job.ID, r.job.Type, rec)
+			err = errors.New("job panicked")
+		}
+	}()
+	return fn(ctx, &Progress{m: m, r: r})
+}
+
+// update applies change to the job and persists it, at most once per
+// persistInterval unless force is set. Persist failures are logged: the
+// in-memory state stays authoritative while the job runs.
+func (m *Manager) update(r *run, force bool, change func(job *Job)) {
+	m.mu.Lock()
+	change(&r.job)
+	r.job.UpdatedAt = m.Clock().Now()
+	if !force && time.Since(r.persisted) < persistInterval {
+		m.mu.Unlock()
+		return
+	}
+	r.persisted = time.Now()
+	job := r.job
+	m.mu.Unlock()
+
+	if err := m.repo.Save(job); err != nil {
+		log.Printf("Failed to persist job %s: %v", job.ID, err)
+	}
+}
+
+// Get returns the current state of a job.
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	if r, ok := m.active[id]; ok {
+		job := r.job
+		m.mu.Unlock()
+		return job, nil
+	}
+	m.mu.Unlock()
+	return m.repo.Get(id)
+}
+
+// List returns jobs matching filter, newest first, with live state for
+// jobs running in this process.
+func (m *Manager) List(filter ListFilter) ([]Job, error) {
+	jobs, err := m.repo.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range jobs {
+		if r, ok := m.active[jobs[i].ID]; ok {
+			jobs[i] = r.job
+		}
+	}
+	return jobs, nil
+}
+
+// Cancel asks a queued or running job to stop. The job reports
+// StatusCancelled once its function returns.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	r, ok := m.active[id]
+	if !ok {
+		m.mu.Unlock()
+		job, err := m.repo.Get(id)
+		if err != nil {
+			return Job{}, err
+		}
+		return job, ErrFinished
+	}
+	r.cancelled = true
+	job := r.job
+	m.mu.Unlock()
+
+	r.cancel()
+	return job, nil
+}
+
+// Done returns a channel closed when the job finishes. For jobs not running
+// in this process the channel is already closed.
+func (m *Manager) Done(id string) <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.active[id]; ok {
+		return r.done
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// Progress lets a running job report how far it has come.
+type Progress struct {
+	m *Manager
+	r *run
+}
+
+// JobID returns the ID of the running job.
+func (p *Progress) JobID() string {
+	return p.r.job.ID
+}
+
+// SetTotal sets the expected number of items.
+func (p *Progress) SetTotal(total int64) {
+	p.m.update(p.r, false, func(job *Job) {
+		job.Total = total
+		job.Progress = percent(job.Processed, job.Total)
+		estimate(job, p.m.Clock().Now())
+	})
+}
+
+// Add records n more processed items.
+func (p *Progress) Add(n int64) {
+	p.m.update(p.r, false, func(job *Job) {
+		job.Processed += n
+		// Totals may be estimates; never report more done than expected
+		if job.Processed > job.Total {
+			job.Total = job.Processed
+		}
+		job.Progress = percent(job.Processed, job.Total)
+		estimate(job, p.m.Clock().Now())
+	})
+}
+
+// estimate sets the job's rate and estimated finish from its progress so
+// far, at now.
+func estimate(job *Job, now time.Time) {
+	if job.StartedAt == nil || job.Processed <= 0 {
+		return
+	}
+	elapsed := now.Sub(*job.StartedAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	job.Rate = float64(job.Processed) / elapsed
+	eta := now.Add(time.Duration(float64(job.Total-job.Processed) / job.Rate * float64(time.Second)))
+	job.ETA = &eta
+}
+
+func percent(processed, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(processed) * 100 / float64(total)
+}
+
+// newJobID returns a random job identifier.
+func newJobID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "job-" + time.Now().Format("20060102150405.000000000")
+	}
+	return "job-" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"sort"
+	"sync"
+
+	"sms-store/internal/clock"
+)
+
+// MemoryRepository keeps jobs in process memory. Jobs are lost on restart.
+type MemoryRepository struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+
+	clock.Clocked
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{jobs: make(map[string]Job)}
+}
+
+func (r *MemoryRepository) Save(job Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jobs[job.ID] = job
+	return nil
+}
+
+func (r *MemoryRepository) Get(id string) (Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (r *MemoryRepository) List(filter ListFilter) ([]Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Job, 0)
+	for _, job := range r.jobs {
+		if filter.Type != "" && job.Type != filter.Type {
+			continue
+		}
+		if filter.Status != "" && job.Status != filter.Status {
+			continue
+		}
+		out = append(out, job)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out, nil
+}
+
+func (r *MemoryRepository) FailUnfinished(reason string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	now := r.Clock().Now()
+	for id, job := range r.jobs {
+		if job.Finished() {
+			continue
+		}
+		job.Status = StatusFailed
+		job.Error = reason
+		job.FinishedAt = &now
+		job.UpdatedAt = now
+		r.jobs[id] = job
+		n++
+	}
+	return n, nil
+}
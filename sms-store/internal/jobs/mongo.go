@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+)
+
+// MongoRepository persists jobs in a MongoDB collection so their final state
+// stays readable across restarts.
+type MongoRepository struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoRepository creates a job repository on the given database.
+// It uses the same MongoDB connection as the message store.
+func NewMongoRepository(client *mongo.Client, databaseName, collectionName string) *MongoRepository {
+	if collectionName == "" {
+		collectionName = "jobs"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("id_unique_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "type", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("type_status_createdAt_idx"),
+		},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		log.Printf("Warning: could not ensure job indexes on %s: %v", collectionName, err)
+	}
+
+	return &MongoRepository{collection: collection}
+}
+
+func (r *MongoRepository) Save(job Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.collection.ReplaceOne(ctx, bson.M{"id": job.ID}, job, opts); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoRepository) Get(id string) (Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var job Job
+	if err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Job{}, ErrNotFound
+		}
+		return Job{}, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+func (r *MongoRepository) List(filter ListFilter) ([]Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := bson.M{}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := make([]Job, 0)
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (r *MongoRepository) FailUnfinished(reason string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := r.Clock().Now()
+	filter := bson.M{"status": bson.M{"$in": bson.A{StatusQueued, StatusRunning}}}
+	update := bson.M{"$set": bson.M{
+		"status":     StatusFailed,
+		"error":      reason,
+		"finishedAt": now,
+		"updatedAt":  now,
+	}}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark unfinished jobs: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
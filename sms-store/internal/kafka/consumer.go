@@ -3,18 +3,25 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
+	"sms-store/internal/autoack"
+	"sms-store/internal/clock"
 	"sms-store/internal/models"
 	"sms-store/internal/store"
 )
 
-// Consumer represents a Kafka consumer for SMS events with worker pool and batch processing.
+// Consumer represents a Kafka consumer for SMS events with per-partition batch processing.
 type Consumer struct {
+	client        sarama.Client
 	consumerGroup sarama.ConsumerGroup
 	store         store.Store
 	topic         string
@@ -22,25 +29,69 @@ type Consumer struct {
 	cancel        context.CancelFunc
 	wg            sync.WaitGroup
 	
-	// Worker pool configuration
-	workerPoolSize int
-	batchSize      int
-	batchTimeout   time.Duration
+	// Each claimed partition is consumed in order by a batch processor of
+	// its own; inFlight caps the messages all of them hold together
+	maxInFlight  int
+	inFlight     *inFlightLimit
+	partitions   *partitionSet
+	batchSize    int
+	batchTimeout time.Duration
+
+	groupID       string
+	saramaConfig  *sarama.Config
+	compression   []string
+	maxFutureSkew time.Duration
+	duplicates    *duplicateTexts // Nil unless repeated texts are suppressed
+	throttle      *throttle       // Nil unless consumption slows for store write latency
+	counters      *consumerCounters
+	routes        eventRoutes
+
+	// Seeks end the group session so the next one starts from new offsets
+	seeker        *seeker
+	seekMu        sync.Mutex // Held for the whole of one seek
+	sessionMu     sync.Mutex
+	cancelSession context.CancelFunc
+
+	clock.Clocked // Tells the time of receipt and future-skew checks
 }
 
 // ConsumerConfig holds configuration for the consumer.
 type ConsumerConfig struct {
-	WorkerPoolSize int           // Number of concurrent workers per partition
+	MaxInFlight    int           // Most messages taken from all partitions and not yet stored (0 for no limit)
 	BatchSize      int           // Number of messages to batch before writing
 	BatchTimeout   time.Duration // Maximum time to wait before flushing batch
+
+	FetchMinBytes          int32         // fetch.min.bytes: minimum bytes the broker waits for
+	FetchMaxBytes          int32         // fetch.max.bytes: maximum bytes of one fetch response
+	MaxPartitionFetchBytes int32         // max.partition.fetch.bytes: fetch size per partition
+	SessionTimeout         time.Duration // Consumer group session timeout
+	HeartbeatInterval      time.Duration // Consumer group heartbeat interval
+	InitialOffset          string        // "earliest" or "latest", used when the group has no committed offset
+	Compression            []string      // Codecs the topic uses, verified at startup (e.g. "zstd")
+
+	MaxFutureSkew time.Duration // How far past the server's clock an event's timestamp may be (0 accepts any)
+
+	DuplicateTextWindow time.Duration // How close in time a repeat of a number's text counts as a duplicate (0 stores repeats as usual)
+	DuplicateTextMode   string        // DuplicateTextMark (the default) or DuplicateTextDrop
+
+	Throttle ThrottleConfig // Slowing down while store writes are slow or failing (off by default)
 }
 
 // DefaultConsumerConfig returns default configuration values.
 func DefaultConsumerConfig() ConsumerConfig {
 	return ConsumerConfig{
-		WorkerPoolSize: 5,                // 5 workers per partition
+		MaxInFlight:    1000,              // Across all partitions
 		BatchSize:      5,                 // Batch 5 messages (reduced for faster flushing)
 		BatchTimeout:   200 * time.Millisecond, // Flush every 200ms (reduced from 2s for better responsiveness)
+
+		FetchMinBytes:          1,                // Minimum bytes to fetch
+		FetchMaxBytes:          10 * 1024 * 1024, // 10MB max fetch size
+		MaxPartitionFetchBytes: 1024 * 1024,      // 1MB default fetch size for better throughput
+		SessionTimeout:         10 * time.Second,
+		HeartbeatInterval:      3 * time.Second,
+		InitialOffset:          OffsetEarliest,
+
+		MaxFutureSkew: models.DefaultMaxFutureSkew,
 	}
 }
 
@@ -62,51 +113,123 @@ func NewConsumerWithConfig(brokers []string, groupID string, topic string, store
 		topic = "sms-events"
 	}
 
-	// Create consumer group config with optimizations
-	cfg := sarama.NewConfig()
-	cfg.Version = sarama.V2_8_0_0 // Use a stable Kafka version
-	cfg.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRoundRobin()
-	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest // Start from beginning if no offset
-	cfg.Consumer.Return.Errors = true
-
-	// Enable compression support (gzip, snappy, lz4, zstd)
-	// Consumer automatically handles decompression based on producer's compression type
-	cfg.Consumer.Fetch.Min = 1                    // Minimum bytes to fetch
-	cfg.Consumer.Fetch.Default = 1024 * 1024      // 1MB default fetch size for better throughput
-	cfg.Consumer.Fetch.Max = 10 * 1024 * 1024     // 10MB max fetch size
-
-	// Optimize consumer group settings
-	cfg.Consumer.Group.Session.Timeout = 10 * time.Second
-	cfg.Consumer.Group.Heartbeat.Interval = 3 * time.Second
-	cfg.Consumer.MaxProcessingTime = 30 * time.Second
+	// Create consumer group config from the tuning settings. Consumers
+	// decompress gzip, snappy, lz4 and zstd automatically based on the
+	// producer's compression type.
+	cfg, err := newSaramaConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	duplicates, err := newDuplicateTexts(config.DuplicateTextWindow, config.DuplicateTextMode)
+	if err != nil {
+		return nil, err
+	}
+	throttle, err := newThrottle(config.Throttle, config.BatchSize)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create consumer group
-	consumerGroup, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	// Create consumer group on a client of its own, which also looks up
+	// offsets for the admin endpoints
+	client, err := sarama.NewClient(brokers, cfg)
 	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	consumerGroup, err := sarama.NewConsumerGroupFromClient(groupID, client)
+	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to create consumer group: %w", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Consumer{
+		client:         client,
 		consumerGroup:  consumerGroup,
 		store:          store,
 		topic:          topic,
 		ctx:            ctx,
 		cancel:         cancel,
-		workerPoolSize: config.WorkerPoolSize,
+		maxInFlight:    config.MaxInFlight,
+		inFlight:       newInFlightLimit(config.MaxInFlight),
+		partitions:     newPartitionSet(),
 		batchSize:      config.BatchSize,
 		batchTimeout:   config.BatchTimeout,
+		groupID:        groupID,
+		saramaConfig:   cfg,
+		compression:    config.Compression,
+		maxFutureSkew:  config.MaxFutureSkew,
+		duplicates:     duplicates,
+		throttle:       throttle,
+		counters:       &consumerCounters{},
+		routes:         eventRoutes{dlq: logDeadLetters{}},
+		seeker:         &seeker{},
 	}, nil
 }
 
+// SetProfileStore routes profile.updated events to ps. Without one they are
+// dead-lettered.
+func (c *Consumer) SetProfileStore(ps store.ProfileStore) {
+	c.routes.profiles = ps
+}
+
+// SetConversationStore records group messages in cs. Without one, events
+// for group conversations are dead-lettered.
+func (c *Consumer) SetConversationStore(cs store.ConversationStore) {
+	c.routes.conversations = cs
+}
+
+// SetAutoCreateProfiles gives each number without a profile one on its
+// first direct message, named after the number and marked
+// models.ProfileSourceAuto, and tells events about it; nil events are only
+// logged. It takes effect once a profile store is set.
+func (c *Consumer) SetAutoCreateProfiles(events ProfileEvents) {
+	if events == nil {
+		events = logProfileEvents{}
+	}
+	c.routes.autoProfiles = &autoProfiles{events: events, known: make(map[string]bool)}
+}
+
+// SetConversationLifecycle reopens closed and snoozed conversations when an
+// inbound message arrives for them.
+func (c *Consumer) SetConversationLifecycle(l *store.ConversationLifecycle) {
+	c.routes.lifecycle = l
+}
+
+// SetAutoAck answers the first inbound message of new conversations as
+// each account's auto-ack config asks, once a batch holding it is stored.
+func (c *Consumer) SetAutoAck(a *autoack.Acknowledger) {
+	c.routes.autoAck = a
+}
+
+// SetRawEvents hands raw the payload of each message.received event, as it
+// arrived, under the ID of the message made from it.
+func (c *Consumer) SetRawEvents(raw RawEvents) {
+	c.routes.raw = raw
+}
+
+// SetDeadLetterQueue sends events that can't be processed to dlq. By default
+// they are only logged.
+func (c *Consumer) SetDeadLetterQueue(dlq DeadLetterQueue) {
+	c.routes.dlq = dlq
+}
+
+// SetIngestionWatch tells w of each batch stored, as from source.
+func (c *Consumer) SetIngestionWatch(w IngestionWatch, source string) {
+	c.routes.watch = w
+	c.routes.watchSource = source
+}
+
 // Start begins consuming messages from Kafka.
 // It runs in a goroutine and processes messages asynchronously.
 func (c *Consumer) Start() error {
 	log.Println("Starting Kafka consumer...")
 	log.Printf("Topic: %s", c.topic)
-	log.Printf("Worker pool size: %d, Batch size: %d, Batch timeout: %v", 
-		c.workerPoolSize, c.batchSize, c.batchTimeout)
+	log.Printf("Max in flight: %d, Batch size: %d, Batch timeout: %v",
+		c.maxInFlight, c.batchSize, c.batchTimeout)
+	log.Printf("Fetch min/max bytes: %d/%d, Max partition fetch bytes: %d, Session timeout: %v, Heartbeat: %v",
+		c.saramaConfig.Consumer.Fetch.Min, c.saramaConfig.Consumer.Fetch.Max, c.saramaConfig.Consumer.Fetch.Default,
+		c.saramaConfig.Consumer.Group.Session.Timeout, c.saramaConfig.Consumer.Group.Heartbeat.Interval)
 
 	c.wg.Add(2)
 
@@ -119,9 +242,22 @@ func (c *Consumer) Start() error {
 				return
 			}
 
-			// Consume messages with optimized handler
-			handler := newConsumerGroupHandler(c.store, c.workerPoolSize, c.batchSize, c.batchTimeout)
-			err := c.consumerGroup.Consume(c.ctx, []string{c.topic}, handler)
+			// Consume messages with optimized handler, until a seek ends
+			// the session
+			handler := newConsumerGroupHandler(c.store, c.routes, c.batchSize, c.batchTimeout, c.counters)
+			handler.inFlight = c.inFlight
+			handler.partitions = c.partitions
+			handler.seeker = c.seeker
+			handler.maxFutureSkew = c.maxFutureSkew
+			handler.duplicates = c.duplicates
+			handler.throttle = c.throttle
+			handler.clock = c.Clock()
+			sessionCtx, cancelSession := context.WithCancel(c.ctx)
+			c.sessionMu.Lock()
+			c.cancelSession = cancelSession
+			c.sessionMu.Unlock()
+			err := c.consumerGroup.Consume(sessionCtx, []string{c.topic}, handler)
+			cancelSession()
 			if err != nil {
 				log.Printf("Error consuming messages: %v", err)
 				// Wait a bit before retrying
@@ -143,7 +279,9 @@ func (c *Consumer) Start() error {
 	return nil
 }
 
-// Stop gracefully stops the consumer.
+// Stop gracefully stops the consumer. It returns once every partition's
+// batch processor has stored what it held and marked its offsets, which
+// the group commits as the session ends.
 func (c *Consumer) Stop() error {
 	log.Println("Stopping Kafka consumer...")
 	c.cancel()
@@ -152,111 +290,160 @@ func (c *Consumer) Stop() error {
 	if err := c.consumerGroup.Close(); err != nil {
 		return fmt.Errorf("error closing consumer group: %w", err)
 	}
+	if err := c.client.Close(); err != nil {
+		return fmt.Errorf("error closing Kafka client: %w", err)
+	}
+	if closer, ok := c.routes.dlq.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("error closing dead-letter queue: %w", err)
+		}
+	}
+	if c.routes.autoProfiles != nil {
+		if closer, ok := c.routes.autoProfiles.events.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return fmt.Errorf("error closing profile events producer: %w", err)
+			}
+		}
+	}
 
 	log.Println("Kafka consumer stopped")
 	return nil
 }
 
 // consumerGroupHandler implements sarama.ConsumerGroupHandler interface
-// with worker pool and batch processing.
+// with batch processing.
 type consumerGroupHandler struct {
 	store          store.Store
-	workerPoolSize int
+	routes         eventRoutes
 	batchSize      int
 	batchTimeout   time.Duration
+	counters       *consumerCounters
+	inFlight       *inFlightLimit // Nil for no limit
+	partitions     *partitionSet
+	seeker         *seeker // Nil when the handler can't seek
+	maxFutureSkew  time.Duration
+	duplicates     *duplicateTexts
+	throttle       *throttle
+	clock          clock.Clock
 }
 
-// newConsumerGroupHandler creates a new handler with worker pool and batch processing.
-func newConsumerGroupHandler(store store.Store, workerPoolSize, batchSize int, batchTimeout time.Duration) *consumerGroupHandler {
+// newConsumerGroupHandler creates a new handler with batch processing.
+func newConsumerGroupHandler(store store.Store, routes eventRoutes, batchSize int, batchTimeout time.Duration, counters *consumerCounters) *consumerGroupHandler {
 	return &consumerGroupHandler{
-		store:          store,
-		workerPoolSize: workerPoolSize,
-		batchSize:      batchSize,
-		batchTimeout:   batchTimeout,
+		store:        store,
+		routes:       routes,
+		batchSize:    batchSize,
+		batchTimeout: batchTimeout,
+		counters:     counters,
+		partitions:   newPartitionSet(),
 	}
 }
 
-// Setup is called when the consumer group session is being set up.
-func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+// Setup is called when the consumer group session is being set up, before
+// any partition is consumed. A pending seek is applied here.
+func (h *consumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	if h.seeker != nil {
+		h.seeker.setup(session)
+	}
 	return nil
 }
 
 // Cleanup is called when the consumer group session is ending.
 func (h *consumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	if h.seeker != nil {
+		h.seeker.cleanup()
+	}
 	return nil
 }
 
-// ConsumeClaim processes messages from a partition using worker pool and batch processing.
+// ConsumeClaim processes the messages of one partition. Sarama calls it in
+// a goroutine of its own for each claimed partition, so partitions don't
+// wait on one another: each has its own batch processor, which takes the
+// partition's messages in order and marks their offsets once they are
+// stored. Only the consumer's in-flight cap is shared.
 func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	// Create worker pool for concurrent message processing
-	workerPool := make(chan struct{}, h.workerPoolSize)
-	var wg sync.WaitGroup
+	partition := h.partitions.add(claim, h.clock.Now())
+	defer h.partitions.remove(partition)
 
-	// Batch processing channel
 	batchChan := make(chan *sarama.ConsumerMessage, h.batchSize*2)
-	batchProcessor := newBatchProcessor(h.store, h.batchSize, h.batchTimeout)
-
-	// Start batch processor
+	batchProcessor := newBatchProcessor(h.store, h.routes, h.batchSize, h.batchTimeout, h.counters)
+	batchProcessor.maxFutureSkew = h.maxFutureSkew
+	batchProcessor.duplicates = h.duplicates
+	batchProcessor.throttle = h.throttle
+	batchProcessor.clock = h.clock
+	batchProcessor.session = session
+	batchProcessor.partition = partition
+	batchProcessor.inFlight = h.inFlight
+
+	// This goroutine is the channel's only sender, so it closes it. The
+	// processor then stores what it holds and marks its offsets before the
+	// claim ends, which the session waits for
+	var wg sync.WaitGroup
 	batchProcessor.Start(batchChan, &wg)
+	defer func() {
+		close(batchChan)
+		wg.Wait()
+	}()
 
-	// Process messages concurrently
 	for {
 		select {
-		case message := <-claim.Messages():
-			if message == nil {
-				// Close batch channel and wait for batch processor to finish
-				close(batchChan)
-				wg.Wait()
+		case message, ok := <-claim.Messages():
+			if !ok || message == nil {
 				return nil
 			}
+			if !h.inFlight.acquire(session.Context()) {
+				return nil
+			}
+			partition.inFlight.Add(1)
 
-			// Acquire worker from pool
-			workerPool <- struct{}{}
-			wg.Add(1)
-
-			// Process message in worker goroutine
-			go func(msg *sarama.ConsumerMessage) {
-				defer func() {
-					<-workerPool // Release worker
-					wg.Done()
-				}()
-
-				// Send to batch processor (parsing happens in batch processor)
-				select {
-				case batchChan <- msg:
-					// Message queued for batch processing
-				case <-session.Context().Done():
-					return
-				}
-
-				// Mark message as processed
-				session.MarkMessage(msg, "")
-
-			}(message)
+			select {
+			case batchChan <- message:
+				partition.received.Add(1)
+			case <-session.Context().Done():
+				partition.inFlight.Add(-1)
+				h.inFlight.release(1)
+				return nil
+			}
 
 		case <-session.Context().Done():
-			// Close batch channel and wait for all workers to finish
-			close(batchChan)
-			wg.Wait()
 			return nil
 		}
 	}
 }
 
-
 // batchProcessor handles batch processing of messages for efficient MongoDB writes.
 type batchProcessor struct {
-	store        store.Store
-	batchSize    int
-	batchTimeout time.Duration
+	store         store.Store
+	routes        eventRoutes
+	batchSize     int
+	batchTimeout  time.Duration
+	counters      *consumerCounters
+	maxFutureSkew time.Duration // Events further ahead of the clock are dead-lettered; 0 accepts any
+	duplicates    *duplicateTexts // Nil unless repeated texts are suppressed
+	throttle      *throttle       // Nil unless batches shrink and pause while the store is slow
+	clock         clock.Clock
+	source        string // Transport the events arrive over, models.RawSourceKafka unless fed by a Pipeline
+
+	// Messages taken and not settled yet, up to pending, whose offset is
+	// marked once they all are
+	session   sarama.ConsumerGroupSession // Nil when offsets aren't marked
+	partition *partitionCounters          // Nil when not counted
+	inFlight  *inFlightLimit
+	pending   *sarama.ConsumerMessage
+	held      int
+	onSettle  func(offset int64) // Nil unless the transport acknowledges settled messages
 }
 
 // newBatchProcessor creates a new batch processor.
-func newBatchProcessor(store store.Store, batchSize int, batchTimeout time.Duration) *batchProcessor {
+func newBatchProcessor(store store.Store, routes eventRoutes, batchSize int, batchTimeout time.Duration, counters *consumerCounters) *batchProcessor {
 	return &batchProcessor{
 		store:        store,
+		routes:       routes,
 		batchSize:    batchSize,
 		batchTimeout: batchTimeout,
+		counters:     counters,
+		clock:        clock.Real{},
+		source:       models.RawSourceKafka,
 	}
 }
 
@@ -270,13 +457,22 @@ func (bp *batchProcessor) Start(messageChan <-chan *sarama.ConsumerMessage, wg *
 		ticker := time.NewTicker(bp.batchTimeout)
 		defer ticker.Stop()
 
+		// flush stores the batch and settles every message taken so far
 		flush := func() {
 			if len(batch) > 0 {
 				if err := bp.flushBatch(batch); err != nil {
 					log.Printf("Error flushing batch: %v", err)
 				}
 				batch = batch[:0] // Reset batch
+				bp.settle()
+
+				// A throttled store gets a pause before the next batch
+				if _, delay := bp.throttle.effective(); delay > 0 {
+					<-bp.clock.After(delay)
+				}
+				return
 			}
+			bp.settle()
 		}
 
 		for {
@@ -288,17 +484,18 @@ func (bp *batchProcessor) Start(messageChan <-chan *sarama.ConsumerMessage, wg *
 					return
 				}
 
-				// Parse message
-				parsedMsg, err := parseKafkaMessage(msg.Value)
-				if err != nil {
-					log.Printf("Error parsing message in batch processor: %v", err)
-					continue
+				if parsed := bp.handle(msg, flush); parsed != nil {
+					batch = append(batch, *parsed)
 				}
-
-				batch = append(batch, *parsedMsg)
-
-				// Flush if batch is full
-				if len(batch) >= bp.batchSize {
+				bp.pending = msg
+				bp.held++
+
+				switch {
+				case len(batch) == 0:
+					// Nothing waits to be stored, so msg is done with
+					bp.settle()
+				case len(batch) >= bp.effectiveBatchSize():
+					// Flush if batch is full
 					flush()
 					ticker.Reset(bp.batchTimeout)
 				}
@@ -311,6 +508,125 @@ func (bp *batchProcessor) Start(messageChan <-chan *sarama.ConsumerMessage, wg *
 	}()
 }
 
+// handle processes msg, returning the message to store for a
+// message.received event. Other events are applied one by one, after flush
+// stored the messages received before them so an update finds its message.
+// Events DecodeEvent rejects are dead-lettered with the reason it gives.
+func (bp *batchProcessor) handle(msg *sarama.ConsumerMessage, flush func()) *models.Message {
+	consumedAt := bp.clock.Now()
+	bp.counters.received.Add(1)
+	bp.counters.lastMessageAt.Store(consumedAt.UnixNano())
+
+	ev, err := DecodeEvent(msg.Value, consumedAt, bp.maxFutureSkew)
+	if ev.Type == EventMessageUpdated || ev.Type == EventProfileUpdated {
+		flush()
+	}
+	if ev.Type == EventProfileUpdated && bp.routes.profiles == nil {
+		bp.deadLetter(msg, EventProfileUpdated, ReasonNoRoute, errors.New("no profile store configured"))
+		return nil
+	}
+	var eventErr *EventError
+	if errors.As(err, &eventErr) {
+		if eventErr.Reason == ReasonInvalidPayload {
+			bp.counters.parseErrors.Add(1)
+		}
+		bp.deadLetter(msg, eventLabel(ev), eventErr.Reason, err)
+		return nil
+	}
+
+	switch ev.Type {
+	case EventMessageReceived:
+		parsedMsg := ev.Message
+		if parsedMsg.ConversationID != "" && !bp.touchConversation(msg, parsedMsg, ev.Participants) {
+			return nil
+		}
+		if !bp.suppressDuplicate(parsedMsg) {
+			return nil
+		}
+
+		parsedMsg.EventKey = bp.eventKey(msg)
+		parsedMsg.Ingestion = &models.Ingestion{BrokerAt: recordTimestamp(msg), ConsumedAt: consumedAt}
+		bp.captureRaw(msg, parsedMsg.ID)
+		routedEvents.WithLabelValues(EventMessageReceived, outcomeApplied).Inc()
+		return parsedMsg
+
+	case EventMessageUpdated:
+		bp.applyMessageUpdate(msg, *ev.Update)
+	case EventProfileUpdated:
+		bp.applyProfileUpdate(*ev.Profile)
+	}
+	return nil
+}
+
+// settle marks the offset of the messages taken so far, up to pending,
+// and gives back their in-flight slots. A batch that failed to store is
+// settled too: the failure is logged, as it was when offsets were marked
+// on receipt, and retrying the batch here would stall the partition.
+func (bp *batchProcessor) settle() {
+	held := bp.held
+	if bp.pending != nil && bp.session != nil {
+		bp.session.MarkMessage(bp.pending, "")
+	}
+	if bp.pending != nil && bp.onSettle != nil {
+		bp.onSettle(bp.pending.Offset)
+	}
+	if bp.partition != nil {
+		var offset int64
+		if bp.pending != nil {
+			offset = bp.pending.Offset
+		}
+		bp.partition.settle(offset, held, bp.clock.Now())
+	}
+	bp.inFlight.release(held)
+	bp.pending = nil
+	bp.held = 0
+}
+
+// suppressDuplicate marks msg as a duplicate of the message whose text it
+// repeats, if duplicate texts are suppressed. It returns false when msg is
+// to be dropped instead.
+func (bp *batchProcessor) suppressDuplicate(msg *models.Message) bool {
+	if bp.duplicates == nil {
+		return true
+	}
+	firstID, ok := bp.duplicates.check(*msg, bp.clock.Now())
+	if !ok {
+		return true
+	}
+	bp.counters.duplicatesSuppressed.Add(1)
+	if bp.duplicates.drop {
+		routedEvents.WithLabelValues(EventMessageReceived, outcomeSuppressed).Inc()
+		return false
+	}
+	msg.DuplicateOf = firstID
+	return true
+}
+
+// captureRaw hands the payload of msg, which became message messageID, to
+// the raw event capture, if there is one.
+func (bp *batchProcessor) captureRaw(msg *sarama.ConsumerMessage, messageID string) {
+	if bp.routes.raw == nil {
+		return
+	}
+	bp.routes.raw.Capture(models.RawEvent{
+		MessageID:   messageID,
+		Source:      bp.source,
+		Topic:       msg.Topic,
+		Partition:   msg.Partition,
+		Offset:      msg.Offset,
+		ContentType: "application/json",
+		Payload:     msg.Value,
+	})
+}
+
+// effectiveBatchSize is the batch size, shrunk while the store is throttled.
+func (bp *batchProcessor) effectiveBatchSize() int {
+	if batchSize, _ := bp.throttle.effective(); batchSize > 0 {
+		return min(batchSize, bp.batchSize)
+	}
+	return bp.batchSize
+}
+
 // flushBatch writes a batch of messages to MongoDB.
 func (bp *batchProcessor) flushBatch(messages []models.Message) error {
 	if len(messages) == 0 {
@@ -318,54 +634,209 @@ func (bp *batchProcessor) flushBatch(messages []models.Message) error {
 	}
 
 	start := time.Now()
+	for i := range messages {
+		messages[i].ReceivedAt = start
+		if messages[i].Ingestion != nil {
+			messages[i].Ingestion.StoredAt = start
+		}
+	}
 	count, err := bp.store.SaveBatch(messages)
 	duration := time.Since(start)
+	if bp.throttle != nil {
+		bp.throttle.observe(duration, err != nil, bp.clock.Now())
+	}
 
+	bp.counters.saved.Add(int64(count))
 	if err != nil {
+		bp.counters.batchErrors.Add(1)
 		return fmt.Errorf("failed to save batch: %w", err)
 	}
+	bp.counters.batchesFlushed.Add(1)
+	bp.observeIngestion(messages, start.Add(duration))
+	if bp.routes.watch != nil {
+		bp.routes.watch.Stored(bp.routes.watchSource, count, bp.clock.Now())
+	}
 
 	log.Printf("Saved batch of %d messages to MongoDB in %v", count, duration)
+
+	if bp.routes.autoProfiles != nil && bp.routes.profiles != nil {
+		bp.routes.autoProfiles.ensure(bp.routes.profiles, messages)
+	}
+	if bp.routes.lifecycle != nil {
+		bp.routes.lifecycle.ReopenOnInbound(messages)
+	}
+	if bp.routes.autoAck != nil {
+		bp.routes.autoAck.Acknowledge(messages)
+	}
 	return nil
 }
 
-// parseKafkaMessage parses a Kafka message value into a Message struct.
-func parseKafkaMessage(data []byte) (*models.Message, error) {
+// parseKafkaMessage parses a Kafka message value into a Message struct,
+// adding the changes made to the payload to transformations. A message to
+// two or more participants belongs to a group conversation: it is returned
+// with a conversation ID and no phone number, along with the normalized
+// participants.
+//
+// The message is dated by the event's createdAt, or else its timestamp in
+// milliseconds, so replayed and delayed events keep their place in the
+// conversation; events with neither are dated now. A date more than
+// maxFutureSkew after now is an error.
+//
+// The error of an invalid event is an *EventError listing every problem
+// found.
+func parseKafkaMessage(data []byte, now time.Time, maxFutureSkew time.Duration, transformations *[]Transformation) (*models.Message, []string, error) {
 	var smsEvent struct {
 		CorrelationID string `json:"correlationId"`
 		PhoneNumber   string `json:"phoneNumber"`
-		Text          string `json:"text"`
-		Status        string `json:"status"`
-		Timestamp     int64  `json:"timestamp"`
+
+		// Group messages name their participants, their conversation or
+		// both; a conversation ID alone must name a known conversation
+		ConversationID string   `json:"conversationId"`
+		Participants   []string `json:"participants"`
+
+		Text      string     `json:"text"`
+		Status    string     `json:"status"`
+		Timestamp int64      `json:"timestamp"`
+		CreatedAt *time.Time `json:"createdAt"` // RFC 3339; takes precedence over timestamp
+
+		// Optional provider metadata
+		ProviderName      string `json:"providerName"`
+		ProviderMessageID string `json:"providerMessageId"`
+		SenderID          string `json:"senderId"`
+		Carrier           string `json:"carrier"`
+
+		// Account the message was sent for; empty means the default account
+		AccountID string `json:"accountId"`
+
+		// Message this one answers, in the same conversation
+		ReplyToID string `json:"replyToId"`
+
+		// "inbound" for a reply received from the number; empty or
+		// "outbound" for a message sent to it
+		Direction string `json:"direction"`
+
+		// Records of other systems the message concerns, such as an order
+		ExternalRefs []models.ExternalRef `json:"externalRefs"`
+
+		// Who, of the people sharing the number, the message is from or
+		// for; participantId defaults to one derived from senderName
+		ParticipantID string `json:"participantId"`
+		SenderName    string `json:"senderName"`
 	}
 
 	if err := json.Unmarshal(data, &smsEvent); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+		return nil, nil, invalidPayload(fmt.Sprintf("failed to unmarshal JSON: %v", err))
+	}
+	var problems []string
+	transformed := func(field, description string) {
+		*transformations = append(*transformations, Transformation{Field: field, Description: description})
+	}
+
+	// A single participant is a direct message to that number
+	participants := models.NormalizeParticipants(smsEvent.Participants)
+	if len(smsEvent.Participants) > 0 && !slices.Equal(participants, smsEvent.Participants) {
+		transformed("participants", "trimmed, sorted and deduplicated")
+	}
+	conversationID := strings.TrimSpace(smsEvent.ConversationID)
+	if len(participants) == 1 && conversationID == "" {
+		if smsEvent.PhoneNumber != "" && smsEvent.PhoneNumber != participants[0] {
+			problems = append(problems, "phoneNumber and participants name different numbers")
+		} else {
+			if smsEvent.PhoneNumber == "" {
+				transformed("phoneNumber", "set to the only participant")
+			}
+			smsEvent.PhoneNumber, participants = participants[0], nil
+		}
+	}
+	if len(participants) > 1 && conversationID == "" {
+		conversationID = models.GroupConversationID(participants)
+		transformed("conversationId", "derived from the participants")
+	}
+	if conversationID != "" && smsEvent.PhoneNumber != "" {
+		problems = append(problems, "phoneNumber can't be combined with a group conversation")
 	}
 
 	// Validate required fields
-	if smsEvent.PhoneNumber == "" {
-		return nil, fmt.Errorf("phoneNumber is required")
+	if smsEvent.PhoneNumber == "" && conversationID == "" {
+		problems = append(problems, "phoneNumber, participants or conversationId is required")
 	}
 	if smsEvent.Text == "" {
-		return nil, fmt.Errorf("text is required")
+		problems = append(problems, "text is required")
 	}
 	if smsEvent.Status == "" {
-		return nil, fmt.Errorf("status is required")
+		problems = append(problems, "status is required")
+	}
+	switch smsEvent.Direction {
+	case "", models.DirectionInbound:
+	case models.DirectionOutbound:
+		transformed("direction", "outbound messages are stored without a direction")
+	default:
+		problems = append(problems, "direction must be inbound or outbound")
+	}
+	externalRefs, err := models.NormalizeExternalRefs(smsEvent.ExternalRefs)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if len(smsEvent.ExternalRefs) > 0 && !slices.Equal(externalRefs, smsEvent.ExternalRefs) {
+		transformed("externalRefs", "trimmed and deduplicated")
+	}
+	participant, err := models.NewParticipant(smsEvent.ParticipantID, smsEvent.SenderName)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if participant != nil && strings.TrimSpace(smsEvent.ParticipantID) == "" {
+		transformed("participantId", "derived from senderName")
 	}
 
-	// Convert timestamp to time.Time
-	createdAt := time.Unix(smsEvent.Timestamp/1000, (smsEvent.Timestamp%1000)*1000000)
+	createdAt := now
+	switch {
+	case smsEvent.CreatedAt != nil:
+		createdAt = *smsEvent.CreatedAt
+	case smsEvent.Timestamp != 0:
+		createdAt = time.UnixMilli(smsEvent.Timestamp)
+		transformed("createdAt", "taken from timestamp")
+	default:
+		transformed("createdAt", "set to the time the event was consumed, as it has neither createdAt nor timestamp")
+	}
+	if err := models.CheckCreatedAt(createdAt, now, maxFutureSkew); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return nil, nil, invalidPayload(problems...)
+	}
 
 	// Generate ID
 	id := fmt.Sprintf("msg-%s", createdAt.Format("20060102150405.000000000"))
+	transformed("id", "generated from createdAt")
+
+	msg := &models.Message{
+		ID:             id,
+		CorrelationID:  smsEvent.CorrelationID,
+		PhoneNumber:    smsEvent.PhoneNumber,
+		SenderType:     models.ClassifySender(smsEvent.PhoneNumber),
+		ConversationID: conversationID,
+		Text:           smsEvent.Text,
+		Status:         smsEvent.Status,
+		CreatedAt:      createdAt,
+		AccountID:      smsEvent.AccountID,
+		ReplyToID:      smsEvent.ReplyToID,
+		ExternalRefs:   externalRefs,
+		Participant:    participant,
+	}
+	if msg.SenderType != "" {
+		transformed("senderType", "classified from phoneNumber")
+	}
 
-	return &models.Message{
-		ID:            id,
-		CorrelationID: smsEvent.CorrelationID,
-		PhoneNumber:   smsEvent.PhoneNumber,
-		Text:          smsEvent.Text,
-		Status:        smsEvent.Status,
-		CreatedAt:     createdAt,
-	}, nil
+	if smsEvent.Direction == models.DirectionInbound {
+		msg.Direction = models.DirectionInbound
+	}
+
+	if smsEvent.ProviderName != "" || smsEvent.ProviderMessageID != "" || smsEvent.SenderID != "" || smsEvent.Carrier != "" {
+		msg.Provider = &models.Provider{
+			Name:      smsEvent.ProviderName,
+			MessageID: smsEvent.ProviderMessageID,
+			SenderID:  smsEvent.SenderID,
+			Carrier:   smsEvent.Carrier,
+		}
+	}
+
+	return msg, participants, nil
 }
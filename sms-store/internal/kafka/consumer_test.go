@@ -0,0 +1,255 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// fakeSession is a consumer group session recording the offsets marked on
+// each partition.
+type fakeSession struct {
+	ctx context.Context
+
+	mu     sync.Mutex
+	marked map[int32][]int64
+}
+
+func newFakeSession(ctx context.Context) *fakeSession {
+	return &fakeSession{ctx: ctx, marked: make(map[int32][]int64)}
+}
+
+func (s *fakeSession) Claims() map[string][]int32                        { return nil }
+func (s *fakeSession) MemberID() string                                  { return "member" }
+func (s *fakeSession) GenerationID() int32                               { return 1 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)           {}
+func (s *fakeSession) Commit()                                           {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string)          {}
+func (s *fakeSession) Context() context.Context                          { return s.ctx }
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) { s.mark(msg) }
+
+func (s *fakeSession) mark(msg *sarama.ConsumerMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked[msg.Partition] = append(s.marked[msg.Partition], msg.Offset)
+}
+
+// lastMarked returns the last offset marked on partition, or -1.
+func (s *fakeSession) lastMarked(partition int32) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	marked := s.marked[partition]
+	if len(marked) == 0 {
+		return -1
+	}
+	return marked[len(marked)-1]
+}
+
+// fakeClaim is a claimed partition fed by the test.
+type fakeClaim struct {
+	partition int32
+	messages  chan *sarama.ConsumerMessage
+	next      int64
+}
+
+func newFakeClaim(partition int32) *fakeClaim {
+	return &fakeClaim{partition: partition, messages: make(chan *sarama.ConsumerMessage, 256)}
+}
+
+func (c *fakeClaim) Topic() string                            { return "sms-events" }
+func (c *fakeClaim) Partition() int32                         { return c.partition }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return c.next }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// send delivers the event of phoneNumber at the claim's next offset.
+func (c *fakeClaim) send(phoneNumber string) {
+	value := fmt.Appendf(nil, `{"correlationId": "p%d-%d", "phoneNumber": %q, "text": "hello", "status": "DELIVERED", "createdAt": %q}`,
+		c.partition, c.next, phoneNumber, time.Now().UTC().Add(-time.Minute).Format(time.RFC3339))
+	c.messages <- &sarama.ConsumerMessage{Topic: "sms-events", Partition: c.partition, Offset: c.next, Value: value}
+	c.next++
+}
+
+// gatedStore holds back the batches of gatedNumber until released.
+type gatedStore struct {
+	store.Store
+	gatedNumber string
+	release     chan struct{}
+}
+
+func (s *gatedStore) SaveBatch(messages []models.Message) (int, error) {
+	if messages[0].PhoneNumber == s.gatedNumber {
+		<-s.release
+	}
+	return s.Store.SaveBatch(messages)
+}
+
+const (
+	slowNumber = "9000000001"
+	fastNumber = "9000000002"
+)
+
+func newTestHandler(s store.Store, maxInFlight int) *consumerGroupHandler {
+	h := newConsumerGroupHandler(s, eventRoutes{}, 10, 5*time.Millisecond, &consumerCounters{})
+	h.clock = clock.Real{}
+	h.inFlight = newInFlightLimit(maxInFlight)
+	return h
+}
+
+// consume runs ConsumeClaim for each claim, as sarama does, returning a
+// channel closed once every claim has ended.
+func consume(t *testing.T, h *consumerGroupHandler, session *fakeSession, claims ...*fakeClaim) <-chan struct{} {
+	t.Helper()
+	var wg sync.WaitGroup
+	for _, claim := range claims {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.ConsumeClaim(session, claim); err != nil {
+				t.Errorf("ConsumeClaim(%d): %v", claim.partition, err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestSlowPartitionDoesNotStallOthers(t *testing.T) {
+	s := &gatedStore{Store: store.NewMemoryStore(), gatedNumber: slowNumber, release: make(chan struct{})}
+	h := newTestHandler(s, 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := newFakeSession(ctx)
+	slow, fast := newFakeClaim(0), newFakeClaim(1)
+	done := consume(t, h, session, slow, fast)
+
+	for range 100 {
+		slow.send(slowNumber)
+		fast.send(fastNumber)
+	}
+
+	// The fast partition stores and marks everything while the slow one is
+	// held up on its first batch
+	waitFor(t, "the fast partition to settle", func() bool { return session.lastMarked(1) == 99 })
+	if got := session.lastMarked(0); got != -1 {
+		t.Fatalf("slow partition marked offset %d before storing it", got)
+	}
+	var slowStats, fastStats PartitionStats
+	for _, ps := range h.partitions.stats(time.Now()) {
+		if ps.Partition == 0 {
+			slowStats = ps
+		} else {
+			fastStats = ps
+		}
+	}
+	if fastStats.MessagesSettled != 100 || fastStats.Offset != 100 || fastStats.Lag != 0 || fastStats.InFlight != 0 {
+		t.Fatalf("fast partition stats = %+v", fastStats)
+	}
+	if slowStats.MessagesSettled != 0 || slowStats.Offset != 0 || slowStats.Lag != 100 || slowStats.InFlight == 0 {
+		t.Fatalf("slow partition stats = %+v", slowStats)
+	}
+
+	// Ending the session drains the slow partition before its claim returns
+	close(s.release)
+	waitFor(t, "the slow partition to take every message", func() bool { return len(slow.messages) == 0 })
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the claims didn't end with the session")
+	}
+
+	if got := session.lastMarked(0); got != 99 {
+		t.Fatalf("slow partition marked up to offset %d, want 99", got)
+	}
+	for partition, marked := range session.marked {
+		for i := 1; i < len(marked); i++ {
+			if marked[i] <= marked[i-1] {
+				t.Fatalf("partition %d marked offsets out of order: %v", partition, marked)
+			}
+		}
+	}
+	if n := h.inFlight.used(); n != 0 {
+		t.Fatalf("%d in-flight slots left taken", n)
+	}
+	if ps := h.partitions.stats(time.Now()); len(ps) != 0 {
+		t.Fatalf("ended claims still counted: %+v", ps)
+	}
+
+	for _, number := range []string{slowNumber, fastNumber} {
+		stored, err := s.FindByPhoneNumber(number)
+		if err != nil {
+			t.Fatalf("FindByPhoneNumber: %v", err)
+		}
+		if len(stored) != 100 {
+			t.Fatalf("stored %d messages of %s, want 100", len(stored), number)
+		}
+	}
+}
+
+func TestInFlightCapBoundsHeldMessages(t *testing.T) {
+	s := &gatedStore{Store: store.NewMemoryStore(), gatedNumber: slowNumber, release: make(chan struct{})}
+	h := newTestHandler(s, 25)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := newFakeSession(ctx)
+	claim := newFakeClaim(0)
+	done := consume(t, h, session, claim)
+
+	for range 100 {
+		claim.send(slowNumber)
+	}
+	waitFor(t, "the cap to fill", func() bool { return h.inFlight.used() == 25 })
+	time.Sleep(20 * time.Millisecond)
+	if ps := h.partitions.stats(time.Now())[0]; ps.MessagesReceived > 25 || ps.InFlight != 25 {
+		t.Fatalf("partition stats = %+v, want 25 messages held", ps)
+	}
+
+	// Storing frees the slots for the rest
+	close(s.release)
+	waitFor(t, "every message to settle", func() bool { return session.lastMarked(0) == 99 })
+	cancel()
+	<-done
+	if n := h.inFlight.used(); n != 0 {
+		t.Fatalf("%d in-flight slots left taken", n)
+	}
+}
+
+func TestPartitionThroughput(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	claim := newFakeClaim(3)
+	claim.next = 500
+	pc := newPartitionSet().add(claim, start)
+
+	pc.settle(119, 120, start.Add(30*time.Second))
+	if got := pc.throughput(start.Add(30 * time.Second)); got != 4 {
+		t.Fatalf("throughput within the first window = %v, want 4", got)
+	}
+	pc.settle(179, 60, start.Add(throughputWindow))
+	if got := pc.throughput(start.Add(90 * time.Second)); got != 3 {
+		t.Fatalf("throughput after a full window = %v, want 3", got)
+	}
+	if pc.next.Load() != 180 || pc.settled.Load() != 180 {
+		t.Fatalf("next offset %d, settled %d", pc.next.Load(), pc.settled.Load())
+	}
+}
@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/IBM/sarama"
+)
+
+// Reasons recorded on dead-lettered events, in the dlq-reason header.
+const (
+	ReasonInvalidPayload       = "invalid_payload"        // Not JSON, or missing required fields
+	ReasonUnknownType          = "unknown_type"           // The type field names no known event
+	ReasonMessageNotFound      = "message_not_found"      // An update for a message that isn't stored
+	ReasonNoRoute              = "no_route"               // A known type this consumer has no destination for
+	ReasonConversationNotFound = "conversation_not_found" // A group message naming only a conversation that isn't known
+)
+
+// DeadLetterQueue receives events the consumer can't process, so they can be
+// inspected and replayed instead of being dropped.
+type DeadLetterQueue interface {
+	Send(msg *sarama.ConsumerMessage, reason string) error
+}
+
+// logDeadLetters is the DeadLetterQueue used when none is configured: it
+// only logs the event.
+type logDeadLetters struct{}
+
+func (logDeadLetters) Send(msg *sarama.ConsumerMessage, reason string) error {
+	log.Printf("Dropping event from %s[%d]@%d (%s): %s", msg.Topic, msg.Partition, msg.Offset, reason, msg.Value)
+	return nil
+}
+
+// KafkaDeadLetterQueue republishes events to a dead-letter topic, unchanged,
+// with headers naming the reason and where the event came from.
+type KafkaDeadLetterQueue struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewKafkaDeadLetterQueue creates a producer for the dead-letter topic.
+func NewKafkaDeadLetterQueue(brokers []string, topic string) (*KafkaDeadLetterQueue, error) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+
+	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter producer: %w", err)
+	}
+	return &KafkaDeadLetterQueue{producer: producer, topic: topic}, nil
+}
+
+// Send publishes msg to the dead-letter topic.
+func (q *KafkaDeadLetterQueue) Send(msg *sarama.ConsumerMessage, reason string) error {
+	headers := []sarama.RecordHeader{
+		{Key: []byte("dlq-reason"), Value: []byte(reason)},
+		{Key: []byte("dlq-source-topic"), Value: []byte(msg.Topic)},
+		{Key: []byte("dlq-source-partition"), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		{Key: []byte("dlq-source-offset"), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	}
+	_, _, err := q.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   q.topic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the producer.
+func (q *KafkaDeadLetterQueue) Close() error {
+	return q.producer.Close()
+}
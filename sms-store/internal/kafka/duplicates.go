@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// What happens to a repeated text, as ConsumerConfig.DuplicateTextMode.
+const (
+	DuplicateTextMark = "mark" // Stored with duplicateOf set, left out of the conversation summary
+	DuplicateTextDrop = "drop" // Not stored
+)
+
+// duplicateTexts remembers the direct messages consumed in the last window,
+// so a message repeating one's text for the same number within window of it
+// is recognized. Providers resending an OTP produce these. It is shared by
+// the consumer's partitions; events of one number usually share a partition,
+// and are only compared with those consumed by this process.
+type duplicateTexts struct {
+	window time.Duration
+	drop   bool
+
+	mu     sync.Mutex
+	recent map[duplicateKey]recentText
+	swept  time.Time
+}
+
+type duplicateKey struct {
+	phoneNumber string
+	text        [sha256.Size]byte
+}
+
+// recentText is the first message of a text, which its repeats point to.
+type recentText struct {
+	id        string
+	createdAt time.Time
+	seen      time.Time // When it was consumed, for expiry
+}
+
+// newDuplicateTexts returns the duplicate filter of window and mode, or nil
+// when window is 0 and repeats are stored like any message.
+func newDuplicateTexts(window time.Duration, mode string) (*duplicateTexts, error) {
+	switch mode {
+	case "", DuplicateTextMark, DuplicateTextDrop:
+	default:
+		return nil, fmt.Errorf("invalid duplicate text mode %q: must be %s or %s", mode, DuplicateTextMark, DuplicateTextDrop)
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("duplicate text window must not be negative")
+	}
+	if window == 0 {
+		return nil, nil
+	}
+	return &duplicateTexts{
+		window: window,
+		drop:   mode == DuplicateTextDrop,
+		recent: make(map[duplicateKey]recentText),
+	}, nil
+}
+
+// check returns the ID of the message msg repeats: one for the same number
+// with the same text, dated at most window before or after msg. Otherwise it
+// remembers msg as the first of its text and returns false. Group messages
+// are never repeats.
+func (d *duplicateTexts) check(msg models.Message, now time.Time) (string, bool) {
+	if msg.PhoneNumber == "" {
+		return "", false
+	}
+	key := duplicateKey{phoneNumber: msg.PhoneNumber, text: sha256.Sum256([]byte(msg.Text))}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(now)
+
+	if first, ok := d.recent[key]; ok && first.id != msg.ID && absDuration(msg.CreatedAt.Sub(first.createdAt)) <= d.window {
+		return first.id, true
+	}
+	d.recent[key] = recentText{id: msg.ID, createdAt: msg.CreatedAt, seen: now}
+	return "", false
+}
+
+// sweep forgets the messages consumed more than window ago, at most once a
+// window. d.mu must be held.
+func (d *duplicateTexts) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.window {
+		return
+	}
+	d.swept = now
+	for key, first := range d.recent {
+		if now.Sub(first.seen) > d.window {
+			delete(d.recent, key)
+		}
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
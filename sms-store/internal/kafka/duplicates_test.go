@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestDuplicateTextWindowBoundaries(t *testing.T) {
+	const window = time.Minute
+	sentAt := time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name      string
+		createdAt time.Time // Of the repeat
+		consumed  time.Duration
+		duplicate bool
+	}{
+		{"JustInside", sentAt.Add(window), 0, true},
+		{"JustOutside", sentAt.Add(window + time.Nanosecond), 0, false},
+		{"JustInsideBefore", sentAt.Add(-window), 0, true},
+		{"JustOutsideBefore", sentAt.Add(-window - time.Nanosecond), 0, false},
+		// The first is remembered for a window after it was consumed
+		{"ConsumedJustInside", sentAt, window, true},
+		{"ConsumedJustOutside", sentAt, window + time.Nanosecond, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := newDuplicateTexts(window, DuplicateTextMark)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			if id, ok := d.check(models.Message{ID: "m1", PhoneNumber: "9876543210", Text: "Your OTP is 1234", CreatedAt: sentAt}, now); ok {
+				t.Fatalf("first message is a duplicate of %s", id)
+			}
+			id, ok := d.check(models.Message{ID: "m2", PhoneNumber: "9876543210", Text: "Your OTP is 1234", CreatedAt: tc.createdAt}, now.Add(tc.consumed))
+			if ok != tc.duplicate || (ok && id != "m1") {
+				t.Fatalf("check = %q, %v; want duplicate %v of m1", id, ok, tc.duplicate)
+			}
+		})
+	}
+}
+
+func TestDuplicateTextsAreMarkedOrDropped(t *testing.T) {
+	sentAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	for _, mode := range []string{DuplicateTextMark, DuplicateTextDrop} {
+		t.Run(mode, func(t *testing.T) {
+			d, err := newDuplicateTexts(time.Minute, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counters := &consumerCounters{}
+			bp := newBatchProcessor(store.NewMemoryStore(), eventRoutes{dlq: &recordingDLQ{}}, 10, time.Second, counters)
+			bp.duplicates = d
+			consume := func(offset int64, correlationID string, createdAt time.Time) *models.Message {
+				t.Helper()
+				value := fmt.Sprintf(`{"correlationId": %q, "phoneNumber": "9876543210", "text": "Your OTP is 1234", "status": "SENT", "createdAt": %q}`,
+					correlationID, createdAt.Format(time.RFC3339))
+				return bp.handle(&sarama.ConsumerMessage{Topic: "sms-events", Partition: 0, Offset: offset, Value: []byte(value)}, func() {})
+			}
+
+			first := consume(1, "c1", sentAt)
+			if first == nil || first.DuplicateOf != "" {
+				t.Fatalf("first = %+v, want it kept", first)
+			}
+			repeat := consume(2, "c2", sentAt.Add(time.Minute))
+			switch {
+			case mode == DuplicateTextDrop && repeat != nil:
+				t.Fatalf("repeat = %+v, want it dropped", repeat)
+			case mode == DuplicateTextMark && (repeat == nil || repeat.DuplicateOf != first.ID):
+				t.Fatalf("repeat = %+v, want it marked a duplicate of %s", repeat, first.ID)
+			}
+			if later := consume(3, "c3", sentAt.Add(time.Minute+time.Second)); later == nil || later.DuplicateOf != "" {
+				t.Fatalf("repeat outside the window = %+v, want it kept", later)
+			}
+			if n := counters.duplicatesSuppressed.Load(); n != 1 {
+				t.Fatalf("%d duplicates suppressed, want 1", n)
+			}
+		})
+	}
+}
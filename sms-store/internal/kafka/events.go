@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// DecodedEvent is an sms-events payload as the consumer reads it before
+// anything is stored: the message, update or profile it carries, and the
+// changes made to the payload on the way.
+type DecodedEvent struct {
+	Type            string           `json:"type"`
+	Message         *models.Message  `json:"message,omitempty"`      // Of a message.received event
+	Participants    []string         `json:"participants,omitempty"` // Of a group message, normalized; they create its conversation
+	Update          *MessageUpdate   `json:"update,omitempty"`       // Of a message.updated event
+	Profile         *models.Profile  `json:"profile,omitempty"`      // Of a profile.updated event
+	Transformations []Transformation `json:"transformations"`
+}
+
+// Transformation is a change decoding made to a field of a payload, such as
+// a default filled in or a value normalized.
+type Transformation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// EventError is why the consumer rejects an event, and the reason it is
+// dead-lettered with.
+type EventError struct {
+	Reason   string   // ReasonInvalidPayload or ReasonUnknownType
+	Problems []string // Every problem found with the payload
+}
+
+func (e *EventError) Error() string { return strings.Join(e.Problems, "; ") }
+
+func invalidPayload(problems ...string) *EventError {
+	return &EventError{Reason: ReasonInvalidPayload, Problems: problems}
+}
+
+// DecodeEvent decodes, validates and normalizes an sms-events payload the
+// way the consumer does, as of now, without touching any store. Where the
+// routes the event may take depend on stores, such as whether a group
+// message's conversation exists, they are left to the caller.
+//
+// A rejected event returns an *EventError, with ev.Type set when the
+// payload names a known type.
+func DecodeEvent(data []byte, now time.Time, maxFutureSkew time.Duration) (ev DecodedEvent, err error) {
+	ev.Transformations = []Transformation{}
+	if ev.Type, err = eventType(data); err != nil {
+		return DecodedEvent{Transformations: ev.Transformations}, invalidPayload(err.Error())
+	}
+
+	switch ev.Type {
+	case EventMessageReceived:
+		ev.Message, ev.Participants, err = parseKafkaMessage(data, now, maxFutureSkew, &ev.Transformations)
+	case EventMessageUpdated:
+		var u MessageUpdate
+		if u, err = parseMessageUpdate(data); err == nil {
+			ev.Update = &u
+		}
+	case EventProfileUpdated:
+		var p models.Profile
+		if p, err = parseProfileUpdate(data); err == nil {
+			ev.Profile = &p
+		}
+	default:
+		typ := ev.Type
+		ev.Type = ""
+		return ev, &EventError{Reason: ReasonUnknownType, Problems: []string{fmt.Sprintf("unknown event type %q", typ)}}
+	}
+	if err != nil {
+		if eventErr, ok := err.(*EventError); ok {
+			return ev, eventErr
+		}
+		return ev, invalidPayload(err.Error())
+	}
+	return ev, nil
+}
+
+// eventLabel is the type label an event is counted under: its type,
+// or "unknown" for one that names none, which could be anything.
+func eventLabel(ev DecodedEvent) string {
+	if ev.Type == "" {
+		return "unknown"
+	}
+	return ev.Type
+}
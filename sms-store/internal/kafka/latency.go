@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+// Ingestion stages, as the stage label of kafka_ingestion_latency_seconds.
+const (
+	StageBrokerToConsume = "broker_to_consume" // From the record's timestamp until the consumer read it
+	StageConsumeToStore  = "consume_to_store"  // From the consumer reading it until its batch was written
+)
+
+// ingestionBuckets are upper bounds in seconds; a lagging consumer delays
+// events by minutes, not milliseconds.
+var ingestionBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+var ingestionLatency = metrics.NewHistogramVec(
+	"kafka_ingestion_latency_seconds",
+	"Time stored messages took through each stage of Kafka ingestion, by stage.",
+	ingestionBuckets,
+	"stage",
+)
+
+// ingestionSamples is how many recently stored messages IngestionLatency
+// can draw on.
+const ingestionSamples = 4096
+
+// StageLatency summarizes one ingestion stage of recently stored messages.
+type StageLatency struct {
+	Stage string  `json:"stage"`
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50Ms"`
+	P95Ms float64 `json:"p95Ms"`
+	P99Ms float64 `json:"p99Ms"`
+	MaxMs float64 `json:"maxMs"`
+}
+
+// IngestionLatency returns percentiles of each stage for the messages
+// stored in the last window. Only the most recent ingestionSamples
+// messages are kept, so a busy consumer covers a shorter span. Stages no
+// message went through in the window are left out.
+func (c *Consumer) IngestionLatency(window time.Duration) []StageLatency {
+	brokerToConsume, consumeToStore := c.counters.ingestion.since(c.Clock().Now().Add(-window))
+	summary := make([]StageLatency, 0, 2)
+	for _, stage := range []struct {
+		name      string
+		durations []time.Duration
+	}{
+		{StageBrokerToConsume, brokerToConsume},
+		{StageConsumeToStore, consumeToStore},
+	} {
+		if len(stage.durations) == 0 {
+			continue
+		}
+		slices.Sort(stage.durations)
+		summary = append(summary, StageLatency{
+			Stage: stage.name,
+			Count: len(stage.durations),
+			P50Ms: percentileMs(stage.durations, 0.50),
+			P95Ms: percentileMs(stage.durations, 0.95),
+			P99Ms: percentileMs(stage.durations, 0.99),
+			MaxMs: percentileMs(stage.durations, 1),
+		})
+	}
+	return summary
+}
+
+// percentileMs returns the nearest-rank percentile p of sorted durations, in milliseconds.
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return float64(sorted[rank]) / float64(time.Millisecond)
+}
+
+// recordTimestamp returns the timestamp of msg, or the zero time when the
+// broker sent none: records of message format v0 have none, and -1 means
+// unset.
+func recordTimestamp(msg *sarama.ConsumerMessage) time.Time {
+	if msg.Timestamp.Unix() <= 0 {
+		return time.Time{}
+	}
+	return msg.Timestamp
+}
+
+// observeIngestion records the stages of messages whose batch was written
+// at storedAt. A broker clock ahead of ours counts as no delay rather than
+// a negative one.
+func (bp *batchProcessor) observeIngestion(messages []models.Message, storedAt time.Time) {
+	for _, msg := range messages {
+		in := msg.Ingestion
+		if in == nil {
+			continue
+		}
+		sample := ingestionSample{at: storedAt, consumeToStore: max(0, storedAt.Sub(in.ConsumedAt))}
+		ingestionLatency.WithLabelValues(StageConsumeToStore).Observe(sample.consumeToStore.Seconds())
+		if !in.BrokerAt.IsZero() {
+			sample.brokerToConsume = max(0, in.ConsumedAt.Sub(in.BrokerAt))
+			sample.hasBroker = true
+			ingestionLatency.WithLabelValues(StageBrokerToConsume).Observe(sample.brokerToConsume.Seconds())
+		}
+		bp.counters.ingestion.add(sample)
+	}
+}
+
+// ingestionWindow is a ring buffer of the stages of recently stored messages.
+type ingestionWindow struct {
+	mu      sync.Mutex
+	samples [ingestionSamples]ingestionSample
+	next    int
+	full    bool
+}
+
+type ingestionSample struct {
+	at              time.Time // When the message was stored
+	brokerToConsume time.Duration
+	consumeToStore  time.Duration
+	hasBroker       bool // The record had a timestamp
+}
+
+func (w *ingestionWindow) add(sample ingestionSample) {
+	w.mu.Lock()
+	w.samples[w.next] = sample
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+	w.mu.Unlock()
+}
+
+// since returns the durations of each stage of the messages stored after t.
+func (w *ingestionWindow) since(t time.Time) (brokerToConsume, consumeToStore []time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	for _, sample := range w.samples[:n] {
+		if !sample.at.After(t) {
+			continue
+		}
+		consumeToStore = append(consumeToStore, sample.consumeToStore)
+		if sample.hasBroker {
+			brokerToConsume = append(brokerToConsume, sample.brokerToConsume)
+		}
+	}
+	return brokerToConsume, consumeToStore
+}
@@ -0,0 +1,314 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrInvalidSeek is wrapped by the errors of seek requests that can't be
+// applied as given.
+var ErrInvalidSeek = errors.New("invalid seek")
+
+// seekTimeout bounds how long Seek waits for the consumer to rejoin its
+// group and apply the new offsets.
+const seekTimeout = 30 * time.Second
+
+// PartitionOffset is the consumer group's position on one partition.
+type PartitionOffset struct {
+	Partition int32 `json:"partition"`
+	Committed int64 `json:"committed"` // Next offset the group consumes; -1 before its first commit
+	Oldest    int64 `json:"oldest"`    // Oldest offset the broker still holds
+	Newest    int64 `json:"newest"`    // Offset the next event will get
+	Lag       int64 `json:"lag"`       // Events not consumed yet
+	Assigned  bool  `json:"assigned"`  // Consumed by this instance
+}
+
+// ConsumerOffsets are the group's positions on every partition of its topic.
+type ConsumerOffsets struct {
+	Topic      string            `json:"topic"`
+	GroupID    string            `json:"groupId"`
+	Partitions []PartitionOffset `json:"partitions"`
+}
+
+// SeekRequest moves the group to explicit offsets, or every partition to
+// its first event at or after a time. Exactly one of them is set.
+type SeekRequest struct {
+	Offsets   map[int32]int64 // Offset of the next event to consume, by partition
+	Timestamp *time.Time
+}
+
+// PartitionSeek is one partition moved by a seek.
+type PartitionSeek struct {
+	Partition int32 `json:"partition"`
+	From      int64 `json:"from"` // Committed offset before the seek; -1 if there was none
+	To        int64 `json:"to"`
+}
+
+// SeekResult is the outcome of Seek.
+type SeekResult struct {
+	Partitions  []PartitionSeek `json:"partitions"`
+	NotAssigned []int32         `json:"notAssigned"` // Consumed by another instance after the rebalance, so left where they were
+}
+
+// Offsets returns the committed offset and lag of every partition.
+func (c *Consumer) Offsets() (ConsumerOffsets, error) {
+	partitions, err := c.client.Partitions(c.topic)
+	if err != nil {
+		return ConsumerOffsets{}, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	committed, err := c.committedOffsets(partitions)
+	if err != nil {
+		return ConsumerOffsets{}, err
+	}
+	assigned := c.seeker.assigned()
+
+	result := ConsumerOffsets{Topic: c.topic, GroupID: c.groupID, Partitions: make([]PartitionOffset, 0, len(partitions))}
+	for _, p := range partitions {
+		oldest, newest, err := c.partitionRange(p)
+		if err != nil {
+			return ConsumerOffsets{}, err
+		}
+		po := PartitionOffset{
+			Partition: p,
+			Committed: committed[p],
+			Oldest:    oldest,
+			Newest:    newest,
+			Assigned:  slices.Contains(assigned, p),
+		}
+		if po.Committed < 0 {
+			po.Lag = newest - oldest
+		} else {
+			po.Lag = max(newest-po.Committed, 0)
+		}
+		result.Partitions = append(result.Partitions, po)
+	}
+	return result, nil
+}
+
+// Seek moves the group's committed offsets and replays from there. The
+// consumer pauses, ends its group session so batches in flight are flushed
+// and their offsets committed, and applies the offsets as it rejoins,
+// before consuming again. Only the partitions this instance is assigned
+// after rejoining are moved; the others are reported as not assigned.
+//
+// Replayed events that were stored before are skipped by the store, which
+// keeps one message per event.
+func (c *Consumer) Seek(req SeekRequest) (SeekResult, error) {
+	c.seekMu.Lock()
+	defer c.seekMu.Unlock()
+
+	partitions, err := c.client.Partitions(c.topic)
+	if err != nil {
+		return SeekResult{}, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	targets, err := c.seekTargets(req, partitions)
+	if err != nil {
+		return SeekResult{}, err
+	}
+	committed, err := c.committedOffsets(partitions)
+	if err != nil {
+		return SeekResult{}, err
+	}
+
+	log.Printf("Seeking %d partition(s) of %s; pausing consumption", len(targets), c.topic)
+	applied := c.seeker.request(c.topic, targets)
+	c.consumerGroup.PauseAll()
+	defer c.consumerGroup.ResumeAll()
+	c.sessionMu.Lock()
+	if c.cancelSession != nil {
+		c.cancelSession()
+	}
+	c.sessionMu.Unlock()
+
+	var moved map[int32]int64
+	select {
+	case moved = <-applied:
+	case <-c.ctx.Done():
+		c.seeker.abandon()
+		return SeekResult{}, errors.New("consumer stopped before the seek was applied")
+	case <-time.After(seekTimeout):
+		if c.seeker.abandon() {
+			return SeekResult{}, fmt.Errorf("consumer did not rejoin its group within %v; no offsets were moved", seekTimeout)
+		}
+		moved = <-applied // Applied just as the wait ran out
+	}
+
+	result := SeekResult{Partitions: []PartitionSeek{}, NotAssigned: []int32{}}
+	for _, p := range slices.Sorted(maps.Keys(targets)) {
+		to, ok := moved[p]
+		if !ok {
+			result.NotAssigned = append(result.NotAssigned, p)
+			continue
+		}
+		result.Partitions = append(result.Partitions, PartitionSeek{Partition: p, From: committed[p], To: to})
+		log.Printf("Moved partition %d of %s from offset %d to %d", p, c.topic, committed[p], to)
+	}
+	return result, nil
+}
+
+// seekTargets resolves req to an offset per partition. A timestamp later
+// than every event of a partition moves it to its end.
+func (c *Consumer) seekTargets(req SeekRequest, partitions []int32) (map[int32]int64, error) {
+	if (len(req.Offsets) == 0) == (req.Timestamp == nil) {
+		return nil, fmt.Errorf("%w: give either offsets or a timestamp", ErrInvalidSeek)
+	}
+
+	targets := make(map[int32]int64)
+	if req.Timestamp != nil {
+		for _, p := range partitions {
+			offset, err := c.client.GetOffset(c.topic, p, req.Timestamp.UnixMilli())
+			if err == nil && offset < 0 {
+				offset, err = c.client.GetOffset(c.topic, p, sarama.OffsetNewest)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up offset of partition %d: %w", p, err)
+			}
+			targets[p] = offset
+		}
+		return targets, nil
+	}
+
+	for p, offset := range req.Offsets {
+		if !slices.Contains(partitions, p) {
+			return nil, fmt.Errorf("%w: %s has no partition %d", ErrInvalidSeek, c.topic, p)
+		}
+		oldest, newest, err := c.partitionRange(p)
+		if err != nil {
+			return nil, err
+		}
+		if offset < oldest || offset > newest {
+			return nil, fmt.Errorf("%w: offset %d of partition %d is outside %d..%d", ErrInvalidSeek, offset, p, oldest, newest)
+		}
+		targets[p] = offset
+	}
+	return targets, nil
+}
+
+// partitionRange returns the oldest offset the broker holds for partition
+// and the offset its next event will get.
+func (c *Consumer) partitionRange(partition int32) (oldest, newest int64, err error) {
+	if oldest, err = c.client.GetOffset(c.topic, partition, sarama.OffsetOldest); err != nil {
+		return 0, 0, fmt.Errorf("failed to look up oldest offset of partition %d: %w", partition, err)
+	}
+	if newest, err = c.client.GetOffset(c.topic, partition, sarama.OffsetNewest); err != nil {
+		return 0, 0, fmt.Errorf("failed to look up newest offset of partition %d: %w", partition, err)
+	}
+	return oldest, newest, nil
+}
+
+// committedOffsets asks the group coordinator for the group's committed
+// offsets, -1 for partitions without one.
+func (c *Consumer) committedOffsets(partitions []int32) (map[int32]int64, error) {
+	coordinator, err := c.client.Coordinator(c.groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find group coordinator: %w", err)
+	}
+	req := sarama.NewOffsetFetchRequest(c.saramaConfig.Version, c.groupID, map[string][]int32{c.topic: partitions})
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+
+	offsets := make(map[int32]int64, len(partitions))
+	for _, p := range partitions {
+		block := resp.GetBlock(c.topic, p)
+		if block == nil {
+			offsets[p] = -1
+			continue
+		}
+		if !errors.Is(block.Err, sarama.ErrNoError) {
+			return nil, fmt.Errorf("failed to fetch committed offset of partition %d: %w", p, block.Err)
+		}
+		offsets[p] = block.Offset
+	}
+	return offsets, nil
+}
+
+// seeker hands a requested seek to the next group session, which applies it
+// in Setup before consuming any partition, and remembers the partitions the
+// current session claims.
+type seeker struct {
+	mu      sync.Mutex
+	topic   string
+	pending map[int32]int64      // Nil unless a seek is waiting for a session
+	applied chan map[int32]int64 // Receives the offsets the session moved
+	claims  []int32
+}
+
+// request queues a seek of topic to targets and returns the channel its
+// outcome is sent on.
+func (s *seeker) request(topic string, targets map[int32]int64) <-chan map[int32]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.topic = topic
+	s.pending = targets
+	s.applied = make(chan map[int32]int64, 1)
+	return s.applied
+}
+
+// abandon drops the pending seek, reporting false if a session applied it
+// already.
+func (s *seeker) abandon() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wasPending := s.pending != nil
+	s.pending = nil
+	return wasPending
+}
+
+// setup records session's claims and moves the claimed partitions of a
+// pending seek. ResetOffset only moves an offset back and MarkOffset only
+// forward, so together they set it either way.
+func (s *seeker) setup(session sarama.ConsumerGroupSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.claims = nil
+	for _, partitions := range session.Claims() {
+		s.claims = append(s.claims, partitions...)
+	}
+	if s.pending == nil {
+		return
+	}
+
+	moved := make(map[int32]int64)
+	for _, p := range s.claims {
+		offset, ok := s.pending[p]
+		if !ok {
+			continue
+		}
+		session.ResetOffset(s.topic, p, offset, "")
+		session.MarkOffset(s.topic, p, offset, "")
+		moved[p] = offset
+	}
+	session.Commit()
+	s.pending = nil
+	s.applied <- moved
+}
+
+// cleanup forgets the claims of a session that ended.
+func (s *seeker) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims = nil
+}
+
+// assigned returns the partitions the current session claims.
+func (s *seeker) assigned() []int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.claims)
+}
+
+// eventKey identifies the Kafka event msg is, so a replay of it is stored
+// once.
+func eventKey(msg *sarama.ConsumerMessage) string {
+	return fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
@@ -0,0 +1,189 @@
+package kafka
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// throughputWindow is how long a partition's throughput is measured over.
+const throughputWindow = time.Minute
+
+// inFlightLimit caps the messages a consumer has taken from its claims and
+// not yet settled: stored, or applied or dead-lettered, with their offsets
+// marked. The cap is shared by every partition. A nil limit never blocks.
+//
+// Each partition holds at most its batch and its channel's buffer, so a
+// slow partition can't take every slot as long as the cap is larger than
+// that.
+type inFlightLimit struct {
+	slots chan struct{}
+}
+
+// newInFlightLimit returns a limit of max messages, nil for max 0 or less.
+func newInFlightLimit(max int) *inFlightLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &inFlightLimit{slots: make(chan struct{}, max)}
+}
+
+// acquire takes a slot, waiting while there is none. It reports false if
+// ctx ended first.
+func (l *inFlightLimit) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release gives back n slots.
+func (l *inFlightLimit) release(n int) {
+	if l == nil {
+		return
+	}
+	for range n {
+		<-l.slots
+	}
+}
+
+// used returns the slots taken.
+func (l *inFlightLimit) used() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+// partitionCounters follow the consumption of one claimed partition.
+type partitionCounters struct {
+	claim      sarama.ConsumerGroupClaim
+	assignedAt time.Time
+
+	received atomic.Int64 // Taken from the claim
+	settled  atomic.Int64 // Stored, applied or dead-lettered, offset marked
+	next     atomic.Int64 // Offset after the last settled message
+	inFlight atomic.Int64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowCount int64
+	rate        float64 // Settled per second over the last full window
+	rated       bool
+}
+
+// settle records n messages settled up to the one at offset, at now.
+func (pc *partitionCounters) settle(offset int64, n int, now time.Time) {
+	if n > 0 {
+		pc.settled.Add(int64(n))
+		pc.inFlight.Add(-int64(n))
+		pc.next.Store(offset + 1)
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.windowCount += int64(n)
+	if elapsed := now.Sub(pc.windowStart); elapsed >= throughputWindow {
+		pc.rate = float64(pc.windowCount) / elapsed.Seconds()
+		pc.rated = true
+		pc.windowStart = now
+		pc.windowCount = 0
+	}
+}
+
+// throughput returns messages settled per second over the last full
+// window, or since the partition was assigned within the first.
+func (pc *partitionCounters) throughput(now time.Time) float64 {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.rated {
+		return pc.rate
+	}
+	elapsed := now.Sub(pc.windowStart).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(pc.windowCount) / elapsed
+}
+
+// PartitionStats is the consumption of one partition assigned to this
+// instance, since it was assigned.
+type PartitionStats struct {
+	Partition         int32     `json:"partition"`
+	AssignedAt        time.Time `json:"assignedAt"`
+	MessagesReceived  int64     `json:"messagesReceived"`
+	MessagesSettled   int64     `json:"messagesSettled"`   // Stored, applied or dead-lettered, with the offset marked
+	InFlight          int64     `json:"inFlight"`          // Received and not settled yet
+	MessagesPerSecond float64   `json:"messagesPerSecond"` // Settled, over the last minute
+	Offset            int64     `json:"offset"`            // Next offset to settle
+	HighWaterMark     int64     `json:"highWaterMark"`     // Offset the partition's next event will get
+	Lag               int64     `json:"lag"`               // Events not settled yet
+}
+
+// partitionSet holds the counters of the partitions a consumer has claimed.
+type partitionSet struct {
+	mu         sync.Mutex
+	partitions map[int32]*partitionCounters
+}
+
+func newPartitionSet() *partitionSet {
+	return &partitionSet{partitions: make(map[int32]*partitionCounters)}
+}
+
+// add starts counting claim from now.
+func (s *partitionSet) add(claim sarama.ConsumerGroupClaim, now time.Time) *partitionCounters {
+	pc := &partitionCounters{claim: claim, assignedAt: now, windowStart: now}
+	pc.next.Store(claim.InitialOffset())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partitions[claim.Partition()] = pc
+	return pc
+}
+
+// remove stops counting the partition of pc, unless a newer claim of it
+// took its place.
+func (s *partitionSet) remove(pc *partitionCounters) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.partitions[pc.claim.Partition()] == pc {
+		delete(s.partitions, pc.claim.Partition())
+	}
+}
+
+// stats returns the stats of every claimed partition, by partition.
+func (s *partitionSet) stats(now time.Time) []PartitionStats {
+	s.mu.Lock()
+	claimed := make([]*partitionCounters, 0, len(s.partitions))
+	for _, pc := range s.partitions {
+		claimed = append(claimed, pc)
+	}
+	s.mu.Unlock()
+
+	stats := make([]PartitionStats, 0, len(claimed))
+	for _, pc := range claimed {
+		ps := PartitionStats{
+			Partition:         pc.claim.Partition(),
+			AssignedAt:        pc.assignedAt,
+			MessagesReceived:  pc.received.Load(),
+			MessagesSettled:   pc.settled.Load(),
+			InFlight:          pc.inFlight.Load(),
+			MessagesPerSecond: pc.throughput(now),
+			Offset:            pc.next.Load(),
+			HighWaterMark:     pc.claim.HighWaterMarkOffset(),
+		}
+		ps.Lag = max(ps.HighWaterMark-ps.Offset, 0)
+		stats = append(stats, ps)
+	}
+	slices.SortFunc(stats, func(a, b PartitionStats) int { return int(a.Partition - b.Partition) })
+	return stats
+}
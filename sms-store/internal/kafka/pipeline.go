@@ -0,0 +1,283 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"sms-store/internal/autoack"
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// ErrPipelineStopped is returned by Ingest once the pipeline is stopped.
+var ErrPipelineStopped = errors.New("pipeline stopped")
+
+// Pipeline ingests events that arrive over a transport other than Kafka the
+// way the consumer ingests its own: the same event schema and parsing,
+// dead-lettering, duplicate suppression, batched saves and routing once a
+// batch is stored. Events are taken in the order they are handed over, as
+// one partition's are.
+//
+// Without offsets that survive a restart, a redelivered event is told by
+// its payload: events with the same payload on the same topic are stored
+// once, which is what makes at-least-once delivery safe.
+type Pipeline struct {
+	store         store.Store
+	source        string
+	routes        eventRoutes
+	batchSize     int
+	batchTimeout  time.Duration
+	maxFutureSkew time.Duration
+	duplicates    *duplicateTexts
+	throttle      *throttle
+	counters      *consumerCounters
+
+	mu       sync.RWMutex // Held to hand over an event, and exclusively to stop
+	messages chan *sarama.ConsumerMessage
+	stopped  bool
+	wg       sync.WaitGroup
+
+	ackMu   sync.Mutex
+	next    int64            // Offset of the next event handed over
+	settled int64            // Offset of the first event not settled yet
+	acks    map[int64]func() // Acknowledgements of events not settled yet, by offset
+
+	clock.Clocked // Tells the time of receipt and future-skew checks
+}
+
+// PipelineStats is a snapshot of a pipeline's counters.
+type PipelineStats struct {
+	Source               string     `json:"source"`
+	MessagesReceived     int64      `json:"messagesReceived"`
+	ParseErrors          int64      `json:"parseErrors"`
+	MessagesSaved        int64      `json:"messagesSaved"`
+	BatchesFlushed       int64      `json:"batchesFlushed"`
+	BatchErrors          int64      `json:"batchErrors"`
+	DeadLettered         int64      `json:"deadLettered"`
+	DuplicatesSuppressed int64      `json:"duplicatesSuppressed"`
+	LastMessageAt        *time.Time `json:"lastMessageAt,omitempty"`
+	Pending              int        `json:"pending"` // Events handed over and not settled yet
+}
+
+// NewPipeline creates a pipeline of events arriving over source, such as
+// models.RawSourceMQTT, into store. Of config, only the batching, future
+// skew, duplicate text and throttle settings apply.
+func NewPipeline(store store.Store, source string, config ConsumerConfig) (*Pipeline, error) {
+	if source == "" {
+		return nil, fmt.Errorf("pipeline source is required")
+	}
+	if config.BatchSize <= 0 {
+		return nil, fmt.Errorf("pipeline batch size must be positive, got %d", config.BatchSize)
+	}
+	if config.BatchTimeout <= 0 {
+		return nil, fmt.Errorf("pipeline batch timeout must be positive, got %v", config.BatchTimeout)
+	}
+	duplicates, err := newDuplicateTexts(config.DuplicateTextWindow, config.DuplicateTextMode)
+	if err != nil {
+		return nil, err
+	}
+	throttle, err := newThrottle(config.Throttle, config.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pipeline{
+		store:         store,
+		source:        source,
+		routes:        eventRoutes{dlq: logDeadLetters{}},
+		batchSize:     config.BatchSize,
+		batchTimeout:  config.BatchTimeout,
+		maxFutureSkew: config.MaxFutureSkew,
+		duplicates:    duplicates,
+		throttle:      throttle,
+		counters:      &consumerCounters{},
+		acks:          make(map[int64]func()),
+	}, nil
+}
+
+// SetProfileStore routes profile.updated events to ps, as
+// Consumer.SetProfileStore does.
+func (p *Pipeline) SetProfileStore(ps store.ProfileStore) {
+	p.routes.profiles = ps
+}
+
+// SetConversationStore records group messages in cs, as
+// Consumer.SetConversationStore does.
+func (p *Pipeline) SetConversationStore(cs store.ConversationStore) {
+	p.routes.conversations = cs
+}
+
+// SetAutoCreateProfiles gives numbers without a profile one on their first
+// direct message, as Consumer.SetAutoCreateProfiles does.
+func (p *Pipeline) SetAutoCreateProfiles(events ProfileEvents) {
+	if events == nil {
+		events = logProfileEvents{}
+	}
+	p.routes.autoProfiles = &autoProfiles{events: events, known: make(map[string]bool)}
+}
+
+// SetConversationLifecycle reopens closed and snoozed conversations when an
+// inbound message arrives for them.
+func (p *Pipeline) SetConversationLifecycle(l *store.ConversationLifecycle) {
+	p.routes.lifecycle = l
+}
+
+// SetAutoAck answers the first inbound message of new conversations, as
+// Consumer.SetAutoAck does.
+func (p *Pipeline) SetAutoAck(a *autoack.Acknowledger) {
+	p.routes.autoAck = a
+}
+
+// SetRawEvents hands raw the payload of each message.received event, with
+// the pipeline's source.
+func (p *Pipeline) SetRawEvents(raw RawEvents) {
+	p.routes.raw = raw
+}
+
+// SetDeadLetterQueue sends events that can't be processed to dlq. By default
+// they are only logged.
+func (p *Pipeline) SetDeadLetterQueue(dlq DeadLetterQueue) {
+	p.routes.dlq = dlq
+}
+
+// SetIngestionWatch tells w of each batch stored, as from source.
+func (p *Pipeline) SetIngestionWatch(w IngestionWatch, source string) {
+	p.routes.watch = w
+	p.routes.watchSource = source
+}
+
+// Start begins processing the events handed over.
+func (p *Pipeline) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.messages != nil || p.stopped {
+		return
+	}
+
+	p.messages = make(chan *sarama.ConsumerMessage, p.batchSize*2)
+	bp := newBatchProcessor(p.store, p.routes, p.batchSize, p.batchTimeout, p.counters)
+	bp.maxFutureSkew = p.maxFutureSkew
+	bp.duplicates = p.duplicates
+	bp.throttle = p.throttle
+	bp.clock = p.Clock()
+	bp.source = p.source
+	bp.onSettle = p.settle
+	bp.Start(p.messages, &p.wg)
+	log.Printf("Started %s ingestion pipeline (batch size: %d, batch timeout: %v)", p.source, p.batchSize, p.batchTimeout)
+}
+
+// Ingest hands over the payload of an event that arrived on topic, waiting
+// while the pipeline is full. ack, if not nil, is called once the event is
+// settled: stored, or dead-lettered, suppressed or failed to store and
+// logged, as the consumer marks offsets. Events are acknowledged in the
+// order they were handed over.
+func (p *Pipeline) Ingest(topic string, payload []byte, ack func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped || p.messages == nil {
+		return ErrPipelineStopped
+	}
+
+	p.ackMu.Lock()
+	offset := p.next
+	p.next++
+	if ack != nil {
+		p.acks[offset] = ack
+	}
+	p.ackMu.Unlock()
+
+	p.messages <- &sarama.ConsumerMessage{Topic: topic, Offset: offset, Value: payload}
+	return nil
+}
+
+// settle acknowledges the events up to and including offset, in order.
+func (p *Pipeline) settle(offset int64) {
+	p.ackMu.Lock()
+	var acks []func()
+	for o := p.settled; o <= offset; o++ {
+		if ack, ok := p.acks[o]; ok {
+			acks = append(acks, ack)
+			delete(p.acks, o)
+		}
+	}
+	p.settled = max(p.settled, offset+1)
+	p.ackMu.Unlock()
+
+	for _, ack := range acks {
+		ack()
+	}
+}
+
+// Stop stores the events handed over and acknowledges them, then closes
+// the routes' producers. Ingest fails once it is called.
+func (p *Pipeline) Stop() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return nil
+	}
+	p.stopped = true
+	if p.messages != nil {
+		close(p.messages)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	if closer, ok := p.routes.dlq.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("error closing dead-letter queue: %w", err)
+		}
+	}
+	if p.routes.autoProfiles != nil {
+		if closer, ok := p.routes.autoProfiles.events.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return fmt.Errorf("error closing profile events producer: %w", err)
+			}
+		}
+	}
+	log.Printf("Stopped %s ingestion pipeline", p.source)
+	return nil
+}
+
+// Stats returns the pipeline's counters.
+func (p *Pipeline) Stats() PipelineStats {
+	p.ackMu.Lock()
+	pending := int(p.next - p.settled)
+	p.ackMu.Unlock()
+
+	stats := PipelineStats{
+		Source:               p.source,
+		MessagesReceived:     p.counters.received.Load(),
+		ParseErrors:          p.counters.parseErrors.Load(),
+		MessagesSaved:        p.counters.saved.Load(),
+		BatchesFlushed:       p.counters.batchesFlushed.Load(),
+		BatchErrors:          p.counters.batchErrors.Load(),
+		DeadLettered:         p.counters.deadLettered.Load(),
+		DuplicatesSuppressed: p.counters.duplicatesSuppressed.Load(),
+		Pending:              pending,
+	}
+	if ns := p.counters.lastMessageAt.Load(); ns > 0 {
+		t := time.Unix(0, ns)
+		stats.LastMessageAt = &t
+	}
+	return stats
+}
+
+// eventKey identifies the event msg is, so a redelivery of it is stored
+// once: Kafka events by their topic, partition and offset, and events of
+// other transports by their source, topic and a hash of their payload.
+func (bp *batchProcessor) eventKey(msg *sarama.ConsumerMessage) string {
+	if bp.source == models.RawSourceKafka {
+		return eventKey(msg)
+	}
+	sum := sha256.Sum256(msg.Value)
+	return fmt.Sprintf("%s:%s/%s", bp.source, msg.Topic, hex.EncodeToString(sum[:16]))
+}
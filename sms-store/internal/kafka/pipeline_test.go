@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// newTestPipeline starts a pipeline of MQTT events into s that flushes
+// batches quickly.
+func newTestPipeline(t *testing.T, s store.Store) *Pipeline {
+	t.Helper()
+	config := DefaultConsumerConfig()
+	config.BatchSize = 10
+	config.BatchTimeout = 10 * time.Millisecond
+	p, err := NewPipeline(s, models.RawSourceMQTT, config)
+	if err != nil {
+		t.Fatalf("NewPipeline: %v", err)
+	}
+	p.Start()
+	return p
+}
+
+func smsEvent(correlationID, text string) []byte {
+	return fmt.Appendf(nil, `{"correlationId": %q, "phoneNumber": "9876543210", "text": %q, "status": "DELIVERED", "createdAt": %q}`,
+		correlationID, text, time.Now().UTC().Add(-time.Minute).Format(time.RFC3339))
+}
+
+func TestPipelineStoresRedeliveryOnceAndAcksInOrder(t *testing.T) {
+	s := store.NewMemoryStore()
+	p := newTestPipeline(t, s)
+
+	var mu sync.Mutex
+	var acked []int
+	ack := func(i int) func() {
+		return func() {
+			mu.Lock()
+			acked = append(acked, i)
+			mu.Unlock()
+		}
+	}
+	first, second := smsEvent("c1", "hello"), smsEvent("c2", "again")
+	for i, payload := range [][]byte{first, []byte("not json"), second, first} {
+		if i == 3 {
+			// The redelivery comes in a later batch, as after a reconnect
+			waitForAcks(t, &mu, &acked, 3)
+		}
+		if err := p.Ingest("sms-events", payload, ack(i)); err != nil {
+			t.Fatalf("Ingest %d: %v", i, err)
+		}
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	stored, err := s.FindByPhoneNumber("9876543210")
+	if err != nil {
+		t.Fatalf("FindByPhoneNumber: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("stored %d messages, want the redelivered one once: %+v", len(stored), stored)
+	}
+	if fmt.Sprint(acked) != "[0 1 2 3]" {
+		t.Fatalf("acknowledged %v, want every event, in order", acked)
+	}
+	stats := p.Stats()
+	if stats.MessagesReceived != 4 || stats.ParseErrors != 1 || stats.Pending != 0 {
+		t.Fatalf("stats = %+v, want 4 received, 1 parse error, none pending", stats)
+	}
+
+	if err := p.Ingest("sms-events", first, nil); err != ErrPipelineStopped {
+		t.Fatalf("Ingest after Stop = %v, want ErrPipelineStopped", err)
+	}
+}
+
+// waitForAcks waits until at least n events are acknowledged.
+func waitForAcks(t *testing.T, mu *sync.Mutex, acked *[]int, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(*acked) >= n
+		mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events weren't acknowledged", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPipelineKeysEventsByTopicAndPayload(t *testing.T) {
+	s := store.NewMemoryStore()
+	p := newTestPipeline(t, s)
+	payload := smsEvent("c1", "hello")
+	for _, topic := range []string{"sms-events", "sms-events-eu"} {
+		if err := p.Ingest(topic, payload, nil); err != nil {
+			t.Fatalf("Ingest: %v", err)
+		}
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	stored, err := s.FindByPhoneNumber("9876543210")
+	if err != nil {
+		t.Fatalf("FindByPhoneNumber: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("stored %d messages, want one per topic", len(stored))
+	}
+}
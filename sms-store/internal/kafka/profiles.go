@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// EventProfileCreated is the type of the events ProfileEvents publishes.
+const EventProfileCreated = "profile.created"
+
+// maxKnownProfiles bounds the numbers remembered as having a profile; past
+// it the set starts over, costing one upsert per number.
+const maxKnownProfiles = 100000
+
+var autoCreatedProfiles = metrics.NewCounterVec(
+	"kafka_auto_profiles_total",
+	"Profiles the consumer created on a number's first message, by outcome.",
+	"outcome",
+)
+
+// ProfileEvents is told about profiles the consumer creates.
+type ProfileEvents interface {
+	ProfileCreated(profile models.Profile) error
+}
+
+// logProfileEvents is the ProfileEvents used when none is configured: it
+// only logs the profile.
+type logProfileEvents struct{}
+
+func (logProfileEvents) ProfileCreated(profile models.Profile) error {
+	log.Printf("Created profile for %s from its first message", profile.PhoneNumber)
+	return nil
+}
+
+// KafkaProfileEvents publishes profile.created events to a topic, keyed by
+// phone number.
+type KafkaProfileEvents struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewKafkaProfileEvents creates a producer for the profile events topic.
+func NewKafkaProfileEvents(brokers []string, topic string) (*KafkaProfileEvents, error) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+
+	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile events producer: %w", err)
+	}
+	return &KafkaProfileEvents{producer: producer, topic: topic}, nil
+}
+
+// ProfileCreated publishes a profile.created event for profile.
+func (p *KafkaProfileEvents) ProfileCreated(profile models.Profile) error {
+	value, err := json.Marshal(struct {
+		Type        string    `json:"type"`
+		PhoneNumber string    `json:"phoneNumber"`
+		Name        string    `json:"name"`
+		Source      string    `json:"source"`
+		CreatedAt   time.Time `json:"createdAt"`
+	}{EventProfileCreated, profile.PhoneNumber, profile.Name, profile.Source, profile.CreatedAt})
+	if err != nil {
+		return fmt.Errorf("failed to encode profile event: %w", err)
+	}
+	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(profile.PhoneNumber),
+		Value: sarama.ByteEncoder(value),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish profile event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the producer.
+func (p *KafkaProfileEvents) Close() error {
+	return p.producer.Close()
+}
+
+// autoProfiles creates a minimal profile for each number the consumer
+// stores a direct message for, on its first message.
+type autoProfiles struct {
+	events ProfileEvents
+
+	mu    sync.Mutex
+	known map[string]bool // Numbers whose profile exists
+}
+
+// ensure gives every phone number of messages a profile. Failures are
+// logged and retried on the number's next message; the messages are
+// already stored.
+func (a *autoProfiles) ensure(ps store.ProfileStore, messages []models.Message) {
+	for _, pn := range a.unknown(messages) {
+		profile, created, err := ps.EnsureProfile(models.Profile{PhoneNumber: pn, Name: pn, Source: models.ProfileSourceAuto})
+		if err != nil {
+			autoCreatedProfiles.WithLabelValues(outcomeFailed).Inc()
+			log.Printf("Error creating profile for %s: %v", pn, err)
+			continue
+		}
+		if created {
+			autoCreatedProfiles.WithLabelValues("created").Inc()
+			if err := a.events.ProfileCreated(profile); err != nil {
+				log.Printf("Error announcing profile of %s: %v", pn, err)
+			}
+		}
+		a.remember(pn)
+	}
+}
+
+// unknown returns the distinct phone numbers of direct messages not yet
+// known to have a profile.
+func (a *autoProfiles) unknown(messages []models.Message) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	seen := make(map[string]bool)
+	var numbers []string
+	for _, msg := range messages {
+		pn := msg.PhoneNumber
+		if pn == "" || msg.ConversationID != "" || seen[pn] || a.known[pn] {
+			continue
+		}
+		seen[pn] = true
+		numbers = append(numbers, pn)
+	}
+	return numbers
+}
+
+func (a *autoProfiles) remember(phoneNumber string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.known) >= maxKnownProfiles {
+		a.known = make(map[string]bool)
+	}
+	a.known[phoneNumber] = true
+}
@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+	"sms-store/internal/autoack"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// Event types carried in the type field of sms-events. Events without a
+// type predate the field and are new messages.
+const (
+	EventMessageReceived = "message.received"
+	EventMessageUpdated  = "message.updated"
+	EventProfileUpdated  = "profile.updated"
+)
+
+// Outcomes of routing one event, as the outcome label of kafka_events_total.
+const (
+	outcomeApplied      = "applied"
+	outcomeFailed       = "failed"
+	outcomeDeadLettered = "dead_lettered"
+	outcomeSuppressed   = "suppressed" // A repeated text, dropped
+)
+
+var routedEvents = metrics.NewCounterVec(
+	"kafka_events_total",
+	"Events consumed from the sms-events topic, by event type and outcome.",
+	"type", "outcome",
+)
+
+// eventRoutes are the destinations of events besides the message store.
+type eventRoutes struct {
+	profiles      store.ProfileStore      // Without one, profile events are dead-lettered
+	conversations store.ConversationStore // Without one, group messages are dead-lettered
+	dlq           DeadLetterQueue
+	autoProfiles  *autoProfiles                // Nil unless numbers get a profile on their first message
+	lifecycle     *store.ConversationLifecycle // Nil unless inbound messages reopen conversations
+	autoAck       *autoack.Acknowledger        // Nil unless new conversations are acknowledged
+	raw           RawEvents                    // Nil unless payloads are captured
+	watch         IngestionWatch               // Nil unless stored batches are reported
+	watchSource   string                       // The source batches are reported as
+}
+
+// RawEvents keeps the payloads events arrived with, for debugging. Capture
+// is called on the consumer's hot path and must not block.
+type RawEvents interface {
+	Capture(event models.RawEvent)
+}
+
+// IngestionWatch is told when the consumer stores a batch of messages, so
+// it can tell when the topic goes quiet. Stored is called on the consumer's
+// hot path and must not block.
+type IngestionWatch interface {
+	Stored(source string, n int, at time.Time)
+}
+
+// eventType returns the type field of an event, or EventMessageReceived for
+// events without one.
+func eventType(data []byte) (string, error) {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	if envelope.Type == "" {
+		return EventMessageReceived, nil
+	}
+	return envelope.Type, nil
+}
+
+// MessageUpdate is the payload of a message.updated event.
+type MessageUpdate struct {
+	ID     string  `json:"id"`
+	Status *string `json:"status,omitempty"`
+	Text   *string `json:"text,omitempty"`
+}
+
+func parseMessageUpdate(data []byte) (MessageUpdate, error) {
+	var u MessageUpdate
+	if err := json.Unmarshal(data, &u); err != nil {
+		return MessageUpdate{}, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	if u.ID == "" {
+		return MessageUpdate{}, fmt.Errorf("id is required")
+	}
+	if u.Status == nil && u.Text == nil {
+		return MessageUpdate{}, fmt.Errorf("status or text is required")
+	}
+	return u, nil
+}
+
+// parseProfileUpdate parses the payload of a profile.updated event.
+func parseProfileUpdate(data []byte) (models.Profile, error) {
+	var event struct {
+		PhoneNumber string `json:"phoneNumber"`
+		Name        string `json:"name"`
+		Avatar      string `json:"avatar"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return models.Profile{}, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	if event.PhoneNumber == "" {
+		return models.Profile{}, fmt.Errorf("phoneNumber is required")
+	}
+	return models.Profile{PhoneNumber: event.PhoneNumber, Name: event.Name, Avatar: event.Avatar}, nil
+}
+
+// applyMessageUpdate patches the status and text of a stored message, as
+// update u of event msg asks.
+func (bp *batchProcessor) applyMessageUpdate(msg *sarama.ConsumerMessage, u MessageUpdate) {
+	_, err := bp.store.UpdateMessage(u.ID, store.MessagePatch{Status: u.Status, Text: u.Text})
+	if errors.Is(err, store.ErrNotFound) {
+		bp.deadLetter(msg, EventMessageUpdated, ReasonMessageNotFound, err)
+		return
+	}
+	if err != nil {
+		routedEvents.WithLabelValues(EventMessageUpdated, outcomeFailed).Inc()
+		log.Printf("Error updating message %s: %v", u.ID, err)
+		return
+	}
+	routedEvents.WithLabelValues(EventMessageUpdated, outcomeApplied).Inc()
+}
+
+// applyProfileUpdate creates or updates the profile of event msg.
+func (bp *batchProcessor) applyProfileUpdate(profile models.Profile) {
+	if err := upsertProfile(bp.routes.profiles, profile); err != nil {
+		routedEvents.WithLabelValues(EventProfileUpdated, outcomeFailed).Inc()
+		log.Printf("Error upserting profile %s: %v", profile.PhoneNumber, err)
+		return
+	}
+	routedEvents.WithLabelValues(EventProfileUpdated, outcomeApplied).Inc()
+}
+
+// touchConversation records a group message in its conversation before the
+// message is batched, creating the conversation on its first message. It
+// reports whether the message should be stored; a message for an unknown
+// conversation without participants is dead-lettered instead.
+func (bp *batchProcessor) touchConversation(msg *sarama.ConsumerMessage, m *models.Message, participants []string) bool {
+	if bp.routes.conversations == nil {
+		bp.deadLetter(msg, EventMessageReceived, ReasonNoRoute, errors.New("no conversation store configured"))
+		return false
+	}
+
+	_, err := bp.routes.conversations.TouchConversation(m.ConversationID, participants, m.AccountID, m.CreatedAt)
+	if errors.Is(err, store.ErrNotFound) {
+		bp.deadLetter(msg, EventMessageReceived, ReasonConversationNotFound, err)
+		return false
+	}
+	if err != nil {
+		// The message is still stored; its conversation catches up on the
+		// group's next message
+		log.Printf("Error updating conversation %s: %v", m.ConversationID, err)
+	}
+	return true
+}
+
+// upsertProfile updates profile, creating it if it doesn't exist yet. A
+// create that loses a race with another one falls back to updating.
+func upsertProfile(ps store.ProfileStore, profile models.Profile) error {
+	_, err := ps.UpdateProfile(profile.PhoneNumber, profile)
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	_, err = ps.CreateProfile(profile)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		_, err = ps.UpdateProfile(profile.PhoneNumber, profile)
+	}
+	return err
+}
+
+// deadLetter sends an event the consumer can't process to the DLQ.
+func (bp *batchProcessor) deadLetter(msg *sarama.ConsumerMessage, eventType, reason string, cause error) {
+	routedEvents.WithLabelValues(eventType, outcomeDeadLettered).Inc()
+	bp.counters.deadLettered.Add(1)
+	log.Printf("Dead-lettering %s event (%s): %v", eventType, reason, cause)
+	if err := bp.routes.dlq.Send(msg, reason); err != nil {
+		log.Printf("Error dead-lettering event: %v", err)
+	}
+}
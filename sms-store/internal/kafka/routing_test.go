@@ -0,0 +1,167 @@
+package kafka
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// recordingDLQ records the reasons of the events dead-lettered to it.
+type recordingDLQ struct {
+	reasons []string
+}
+
+func (q *recordingDLQ) Send(_ *sarama.ConsumerMessage, reason string) error {
+	q.reasons = append(q.reasons, reason)
+	return nil
+}
+
+func TestEventRoutes(t *testing.T) {
+	created := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	received := fmt.Sprintf(`{"correlationId": "c1", "phoneNumber": "9876543210", "text": "hello", "status": "SENT", "createdAt": %q}`, created)
+
+	for _, tc := range []struct {
+		name    string
+		stored  []models.Message // Before the event
+		noRoute bool             // Without a profile store
+		event   string
+		reason  string // Dead-lettered with; empty if routed
+		check   func(t *testing.T, s store.Store, profiles store.ProfileStore, parsed *models.Message)
+	}{
+		{
+			name:  "ReceivedWithoutType",
+			event: received,
+			check: func(t *testing.T, _ store.Store, _ store.ProfileStore, parsed *models.Message) {
+				if parsed == nil || parsed.PhoneNumber != "9876543210" || parsed.EventKey != "sms-events/0/7" || parsed.Ingestion == nil {
+					t.Fatalf("parsed %+v, want the message to batch with its event key", parsed)
+				}
+			},
+		},
+		{
+			name:  "Received",
+			event: fmt.Sprintf(`{"type": "message.received", "correlationId": "c1", "phoneNumber": "9876543210", "text": "hello", "status": "SENT", "createdAt": %q}`, created),
+			check: func(t *testing.T, _ store.Store, _ store.ProfileStore, parsed *models.Message) {
+				if parsed == nil || parsed.Text != "hello" {
+					t.Fatalf("parsed %+v, want the message to batch", parsed)
+				}
+			},
+		},
+		{
+			name:   "Updated",
+			stored: []models.Message{{ID: "m1", PhoneNumber: "9876543210", Text: "hello", Status: "SENT", CreatedAt: time.Now()}},
+			event:  `{"type": "message.updated", "id": "m1", "status": "DELIVERED"}`,
+			check: func(t *testing.T, s store.Store, _ store.ProfileStore, parsed *models.Message) {
+				if msg, err := s.FindByID("m1"); err != nil || msg.Status != "DELIVERED" || msg.Text != "hello" {
+					t.Fatalf("m1 = %+v, %v; want only its status updated", msg, err)
+				}
+			},
+		},
+		{name: "UpdatedMissing", event: `{"type": "message.updated", "id": "m9", "status": "DELIVERED"}`, reason: ReasonMessageNotFound},
+		{name: "UpdatedWithoutChange", event: `{"type": "message.updated", "id": "m1"}`, reason: ReasonInvalidPayload},
+		{
+			name:  "ProfileUpdated",
+			event: `{"type": "profile.updated", "phoneNumber": "9876543210", "name": "Ram"}`,
+			check: func(t *testing.T, _ store.Store, profiles store.ProfileStore, _ *models.Message) {
+				if p, err := profiles.GetProfile("9876543210"); err != nil || p.Name != "Ram" {
+					t.Fatalf("profile = %+v, %v; want it created", p, err)
+				}
+			},
+		},
+		{name: "ProfileUpdatedWithoutPhoneNumber", event: `{"type": "profile.updated", "name": "Ram"}`, reason: ReasonInvalidPayload},
+		{name: "ProfileUpdatedWithoutProfileStore", noRoute: true, event: `{"type": "profile.updated", "phoneNumber": "9876543210", "name": "Ram"}`, reason: ReasonNoRoute},
+		{name: "UnknownType", event: `{"type": "message.exploded", "id": "m1"}`, reason: ReasonUnknownType},
+		{name: "NotJSON", event: `hello`, reason: ReasonInvalidPayload},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			if len(tc.stored) > 0 {
+				if _, err := s.SaveBatch(tc.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+			profiles := store.NewMemoryProfileStore()
+			dlq := &recordingDLQ{}
+			routes := eventRoutes{profiles: profiles, dlq: dlq}
+			if tc.noRoute {
+				routes.profiles = nil
+			}
+			counters := &consumerCounters{}
+			bp := newBatchProcessor(s, routes, 10, time.Second, counters)
+
+			flushes := 0
+			msg := &sarama.ConsumerMessage{Topic: "sms-events", Partition: 0, Offset: 7, Value: []byte(tc.event)}
+			parsed := bp.handle(msg, func() { flushes++ })
+
+			if tc.reason != "" {
+				if parsed != nil || !slices.Equal(dlq.reasons, []string{tc.reason}) || counters.deadLettered.Load() != 1 {
+					t.Fatalf("parsed %+v, dead-lettered %v; want only a %s dead letter", parsed, dlq.reasons, tc.reason)
+				}
+				if tc.reason == ReasonInvalidPayload && counters.parseErrors.Load() != 1 {
+					t.Fatalf("%d parse errors counted, want 1", counters.parseErrors.Load())
+				}
+				return
+			}
+			if len(dlq.reasons) != 0 {
+				t.Fatalf("dead-lettered %v, want the event routed", dlq.reasons)
+			}
+			// Updates apply after the messages received before them are
+			// stored; received messages are batched
+			wantFlushes := 0
+			if parsed == nil {
+				wantFlushes = 1
+			}
+			if flushes != wantFlushes {
+				t.Fatalf("flushed %d times, want %d", flushes, wantFlushes)
+			}
+			tc.check(t, s, profiles, parsed)
+		})
+	}
+}
+
+func TestReplayedEventsDontRegressMessages(t *testing.T) {
+	s := store.NewMemoryStore()
+	bp := newBatchProcessor(s, eventRoutes{dlq: &recordingDLQ{}}, 10, time.Second, &consumerCounters{})
+	consume := func(offset int64, value string) {
+		t.Helper()
+		msg := &sarama.ConsumerMessage{Topic: "sms-events", Partition: 0, Offset: offset, Value: []byte(value)}
+		if parsed := bp.handle(msg, func() {}); parsed != nil {
+			if err := bp.flushBatch([]models.Message{*parsed}); err != nil {
+				t.Fatalf("flushBatch: %v", err)
+			}
+		}
+	}
+	event := func(correlationID string, createdAt time.Time) string {
+		return fmt.Sprintf(`{"correlationId": %q, "phoneNumber": "9876543210", "text": "hello", "status": "SENT", "createdAt": %q}`,
+			correlationID, createdAt.UTC().Format(time.RFC3339))
+	}
+
+	sentAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	consume(1, event("c1", sentAt))
+	stored, err := s.FindByPhoneNumber("9876543210")
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("stored %+v, %v; want the message", stored, err)
+	}
+	id := stored[0].ID
+	consume(2, fmt.Sprintf(`{"type": "message.updated", "id": %q, "status": "DELIVERED"}`, id))
+
+	// Redelivering the received event after the update leaves the message
+	// as it was updated, and an older message sorts in behind it
+	consume(1, event("c1", sentAt))
+	consume(3, event("c0", sentAt.Add(-time.Hour)))
+
+	stored, err = s.FindByPhoneNumber("9876543210")
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("stored %+v, %v; want the message once and the older one", stored, err)
+	}
+	if stored[0].ID != id || stored[0].Status != "DELIVERED" || !stored[0].CreatedAt.Equal(sentAt) {
+		t.Fatalf("newest message = %+v, want %s still DELIVERED", stored[0], id)
+	}
+	if !stored[1].CreatedAt.Equal(sentAt.Add(-time.Hour)) {
+		t.Fatalf("oldest message = %+v, want the one created an hour earlier", stored[1])
+	}
+}
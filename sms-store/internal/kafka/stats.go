@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// consumerCounters are shared by a consumer's handlers and batch processors.
+type consumerCounters struct {
+	received       atomic.Int64
+	parseErrors    atomic.Int64
+	saved          atomic.Int64
+	batchesFlushed atomic.Int64
+	batchErrors    atomic.Int64
+	deadLettered   atomic.Int64
+	lastMessageAt  atomic.Int64 // Unix nanoseconds
+
+	duplicatesSuppressed atomic.Int64
+
+	ingestion ingestionWindow // Stages of recently stored messages
+}
+
+// ConsumerSettings are the effective consumer settings.
+type ConsumerSettings struct {
+	MaxInFlight            int      `json:"maxInFlight"` // 0 for no limit
+	BatchSize              int      `json:"batchSize"`
+	BatchTimeout           string   `json:"batchTimeout"`
+	FetchMinBytes          int32    `json:"fetchMinBytes"`
+	FetchMaxBytes          int32    `json:"fetchMaxBytes"`
+	MaxPartitionFetchBytes int32    `json:"maxPartitionFetchBytes"`
+	SessionTimeout         string   `json:"sessionTimeout"`
+	HeartbeatInterval      string   `json:"heartbeatInterval"`
+	InitialOffset          string   `json:"initialOffset"`
+	Compression            []string `json:"compression,omitempty"`         // Codecs verified at startup
+	DuplicateTextWindow    string   `json:"duplicateTextWindow,omitempty"` // Unset unless repeated texts are suppressed
+	DuplicateTextMode      string   `json:"duplicateTextMode,omitempty"`
+}
+
+// ConsumerStats is a snapshot of a consumer's settings and counters.
+type ConsumerStats struct {
+	Topic            string           `json:"topic"`
+	GroupID          string           `json:"groupId"`
+	Settings         ConsumerSettings `json:"settings"`
+	MessagesReceived int64            `json:"messagesReceived"`
+	ParseErrors      int64            `json:"parseErrors"`
+	MessagesSaved    int64            `json:"messagesSaved"`
+	BatchesFlushed   int64            `json:"batchesFlushed"`
+	BatchErrors      int64            `json:"batchErrors"`
+	DeadLettered     int64            `json:"deadLettered"`
+	LastMessageAt    *time.Time       `json:"lastMessageAt,omitempty"`
+
+	DuplicatesSuppressed int64 `json:"duplicatesSuppressed"` // Repeated texts marked or dropped
+
+	Throttle *ThrottleStats `json:"throttle,omitempty"` // Unset unless consumption slows for store write latency
+
+	InFlight   int              `json:"inFlight"`   // Messages taken from all partitions and not yet settled
+	Partitions []PartitionStats `json:"partitions"` // Partitions assigned to this instance
+}
+
+// Stats returns the consumer's effective settings and counters.
+func (c *Consumer) Stats() ConsumerStats {
+	cfg := c.saramaConfig
+
+	initialOffset := OffsetEarliest
+	if cfg.Consumer.Offsets.Initial == sarama.OffsetNewest {
+		initialOffset = OffsetLatest
+	}
+
+	stats := ConsumerStats{
+		Topic:   c.topic,
+		GroupID: c.groupID,
+		Settings: ConsumerSettings{
+			MaxInFlight:            c.maxInFlight,
+			BatchSize:              c.batchSize,
+			BatchTimeout:           c.batchTimeout.String(),
+			FetchMinBytes:          cfg.Consumer.Fetch.Min,
+			FetchMaxBytes:          cfg.Consumer.Fetch.Max,
+			MaxPartitionFetchBytes: cfg.Consumer.Fetch.Default,
+			SessionTimeout:         cfg.Consumer.Group.Session.Timeout.String(),
+			HeartbeatInterval:      cfg.Consumer.Group.Heartbeat.Interval.String(),
+			InitialOffset:          initialOffset,
+			Compression:            c.compression,
+		},
+		MessagesReceived: c.counters.received.Load(),
+		ParseErrors:      c.counters.parseErrors.Load(),
+		MessagesSaved:    c.counters.saved.Load(),
+		BatchesFlushed:   c.counters.batchesFlushed.Load(),
+		BatchErrors:      c.counters.batchErrors.Load(),
+		DeadLettered:     c.counters.deadLettered.Load(),
+
+		DuplicatesSuppressed: c.counters.duplicatesSuppressed.Load(),
+		Throttle:             c.throttle.stats(),
+
+		InFlight:   c.inFlight.used(),
+		Partitions: c.partitions.stats(c.Clock().Now()),
+	}
+	if d := c.duplicates; d != nil {
+		stats.Settings.DuplicateTextWindow = d.window.String()
+		stats.Settings.DuplicateTextMode = DuplicateTextMark
+		if d.drop {
+			stats.Settings.DuplicateTextMode = DuplicateTextDrop
+		}
+	}
+	if ns := c.counters.lastMessageAt.Load(); ns > 0 {
+		t := time.Unix(0, ns)
+		stats.LastMessageAt = &t
+	}
+	return stats
+}
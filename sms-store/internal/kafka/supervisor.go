@@ -0,0 +1,185 @@
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+)
+
+// Supervisor states reported by State().
+const (
+	StateConnecting = "connecting" // Still trying to create the consumer
+	StateRunning    = "running"    // Consumer created and started
+	StateFailed     = "failed"     // Gave up after exhausting all attempts
+	StateStopped    = "stopped"    // Stop was called
+)
+
+// SupervisorConfig holds configuration for the connection supervisor.
+type SupervisorConfig struct {
+	MaxAttempts    int           // Attempts before giving up permanently (0 = retry forever)
+	InitialBackoff time.Duration // Wait after the first failed attempt
+	MaxBackoff     time.Duration // Upper bound for the exponential backoff
+}
+
+// DefaultSupervisorConfig returns default configuration values.
+func DefaultSupervisorConfig() SupervisorConfig {
+	return SupervisorConfig{
+		MaxAttempts:    20,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     60 * time.Second,
+	}
+}
+
+// SupervisorState is a snapshot of the supervisor for health reporting.
+type SupervisorState struct {
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// Supervisor creates and starts a Consumer in the background, retrying with
+// exponential backoff while the brokers are unreachable. This lets the HTTP
+// API serve reads during a Kafka outage instead of failing at startup.
+type Supervisor struct {
+	factory func() (*Consumer, error)
+	config  SupervisorConfig
+
+	mu       sync.Mutex
+	state    SupervisorState
+	consumer *Consumer
+	started  bool
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	clock.Clocked
+}
+
+// NewSupervisor creates a supervisor that builds consumers with factory.
+func NewSupervisor(factory func() (*Consumer, error), config SupervisorConfig) *Supervisor {
+	return &Supervisor{
+		factory: factory,
+		config:  config,
+		state:   SupervisorState{State: StateConnecting, Since: time.Now()},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start launches the connect loop in a goroutine and returns immediately.
+func (s *Supervisor) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.state.Since = s.Clock().Now()
+	go s.run()
+}
+
+func (s *Supervisor) run() {
+	defer close(s.done)
+
+	backoff := s.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		consumer, err := s.connect()
+		if err == nil {
+			s.mu.Lock()
+			s.consumer = consumer
+			s.state = SupervisorState{State: StateRunning, Attempts: attempt, Since: s.Clock().Now()}
+			s.mu.Unlock()
+			log.Printf("Kafka consumer running after %d attempt(s)", attempt)
+			return
+		}
+
+		s.mu.Lock()
+		s.state.Attempts = attempt
+		s.state.LastError = err.Error()
+		if s.config.MaxAttempts > 0 && attempt >= s.config.MaxAttempts {
+			s.state.State = StateFailed
+			s.state.Since = s.Clock().Now()
+			s.mu.Unlock()
+			log.Printf("Kafka consumer failed permanently after %d attempts: %v", attempt, err)
+			return
+		}
+		s.mu.Unlock()
+
+		log.Printf("Kafka consumer attempt %d failed: %v (retrying in %v)", attempt, err, backoff)
+		select {
+		case <-s.stop:
+			return
+		case <-s.Clock().After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.config.MaxBackoff {
+			backoff = s.config.MaxBackoff
+		}
+	}
+}
+
+// connect creates and starts one consumer.
+func (s *Supervisor) connect() (*Consumer, error) {
+	consumer, err := s.factory()
+	if err != nil {
+		return nil, err
+	}
+	if err := consumer.Start(); err != nil {
+		_ = consumer.Stop()
+		return nil, fmt.Errorf("failed to start consumer: %w", err)
+	}
+	return consumer, nil
+}
+
+// State returns a snapshot of the supervisor state.
+func (s *Supervisor) State() SupervisorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Done returns a channel that is closed once the connect loop has finished,
+// either because the consumer is running or because the supervisor gave up.
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+// Consumer returns the running consumer, or nil if it is not connected yet.
+func (s *Supervisor) Consumer() *Consumer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.consumer
+}
+
+// Stop ends the connect loop and stops the consumer if one is running.
+// It is safe to call more than once.
+func (s *Supervisor) Stop() error {
+	var err error
+	s.stopOnce.Do(func() {
+		close(s.stop)
+
+		s.mu.Lock()
+		started := s.started
+		s.mu.Unlock()
+		if started {
+			<-s.done
+		}
+
+		s.mu.Lock()
+		consumer := s.consumer
+		s.state.State = StateStopped
+		s.state.Since = s.Clock().Now()
+		s.mu.Unlock()
+
+		if consumer != nil {
+			err = consumer.Stop()
+		}
+	})
+	return err
+}
@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"sms-store/internal/metrics"
+)
+
+// Defaults of the ThrottleConfig fields left zero.
+const (
+	defaultThrottleWindow   = 20
+	defaultThrottleStep     = 0.25
+	defaultThrottleMaxDelay = 2 * time.Second
+)
+
+// throttleRecovery is the share of ThrottleConfig.Latency the p99 must fall
+// below before the throttle is eased, so it doesn't flap at the threshold.
+const throttleRecovery = 0.8
+
+var throttleLevel = metrics.NewGauge(
+	"kafka_consumer_throttle_level",
+	"How far the consumer is slowed for store write latency, from 0 (full speed) to 1.",
+)
+
+// ThrottleConfig tunes how the consumer slows down when store writes get
+// slow or fail, so a struggling MongoDB isn't pushed into timeouts.
+type ThrottleConfig struct {
+	Latency   time.Duration // p99 batch write latency above which consumption slows (0 disables throttling)
+	ErrorRate float64       // Share of failed batch writes above which consumption slows (0 counts latency only)
+	Window    int           // Batch writes the p99 and error rate are read from
+	Step      float64       // How far each decision moves the throttle level, from 0 to 1; higher reacts faster and overshoots more
+	MaxDelay  time.Duration // Pause after each batch write at full throttle
+}
+
+// ThrottleStats is the throttle's current state, as ConsumerStats reports it.
+type ThrottleStats struct {
+	Level     float64    `json:"level"`     // From 0, full speed, to 1
+	BatchSize int        `json:"batchSize"` // Effective batch size
+	Delay     string     `json:"delay"`     // Pause after each batch write
+	P99       string     `json:"p99"`       // Of the batch writes in the window
+	ErrorRate float64    `json:"errorRate"` // Of the batch writes in the window
+	Since     *time.Time `json:"since,omitempty"`
+}
+
+// writeSample is one batch write the throttle judges the store by.
+type writeSample struct {
+	latency time.Duration
+	failed  bool
+}
+
+// throttle is an additive controller shared by a consumer's batch
+// processors. Every quarter window of batch writes it compares the p99
+// latency and error rate of the writes since the level last changed with
+// the thresholds: over either raises the level by Step, comfortably under
+// both lowers it by half a step, so it backs off faster than it recovers.
+// A level shrinks batches by that share and pauses each batch write by that
+// share of MaxDelay; the pause holds up partition workers, which stops
+// sarama fetching once its buffers fill.
+type throttle struct {
+	config    ThrottleConfig
+	batchSize int // Undiminished
+
+	mu      sync.Mutex
+	samples []writeSample // Since the level last changed, at most Window
+	pending int           // Samples since the last decision
+	level   float64
+	since   time.Time // When it was last raised from 0
+}
+
+// newThrottle returns the throttle of config for batches of batchSize, or
+// nil when throttling is disabled.
+func newThrottle(config ThrottleConfig, batchSize int) (*throttle, error) {
+	if err := validateThrottle(config); err != nil {
+		return nil, err
+	}
+	if config.Latency == 0 {
+		return nil, nil
+	}
+	if config.Window == 0 {
+		config.Window = defaultThrottleWindow
+	}
+	if config.Step == 0 {
+		config.Step = defaultThrottleStep
+	}
+	if config.MaxDelay == 0 {
+		config.MaxDelay = defaultThrottleMaxDelay
+	}
+	return &throttle{config: config, batchSize: batchSize}, nil
+}
+
+func validateThrottle(config ThrottleConfig) error {
+	switch {
+	case config.Latency < 0:
+		return fmt.Errorf("throttle latency must not be negative")
+	case config.ErrorRate < 0 || config.ErrorRate > 1:
+		return fmt.Errorf("throttle error rate must be between 0 and 1")
+	case config.Window < 0:
+		return fmt.Errorf("throttle window must not be negative")
+	case config.Step < 0 || config.Step > 1:
+		return fmt.Errorf("throttle step must be between 0 and 1")
+	case config.MaxDelay < 0:
+		return fmt.Errorf("throttle max delay must not be negative")
+	}
+	return nil
+}
+
+// observe records a batch write and takes a decision when one is due.
+func (t *throttle) observe(latency time.Duration, failed bool, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.samples = append(t.samples, writeSample{latency: latency, failed: failed})
+	if len(t.samples) > t.config.Window {
+		t.samples = t.samples[1:]
+	}
+	t.pending++
+	if t.pending < max(t.config.Window/4, 1) {
+		return
+	}
+	t.pending = 0
+
+	p99, errorRate := t.measure()
+	over := p99 > t.config.Latency || t.config.ErrorRate > 0 && errorRate > t.config.ErrorRate
+	healthy := float64(p99) < throttleRecovery*float64(t.config.Latency) && (t.config.ErrorRate == 0 || errorRate <= t.config.ErrorRate)
+
+	previous := t.level
+	switch {
+	case over:
+		t.level = min(t.level+t.config.Step, 1)
+	case healthy && t.level > 0:
+		t.level = max(t.level-t.config.Step/2, 0)
+		if t.level < 1e-9 {
+			t.level = 0
+		}
+	}
+	if t.level == previous {
+		return
+	}
+
+	// Judge the new level by its own writes
+	t.samples = t.samples[:0]
+	throttleLevel.Set(t.level)
+	batchSize, delay := t.effectiveLocked()
+	switch {
+	case previous == 0:
+		t.since = now
+		log.Printf("Kafka consumer throttled to level %.2f: p99 write latency %v, %.0f%% failed; batches of %d, %v pause",
+			t.level, p99, errorRate*100, batchSize, delay)
+	case t.level == 0:
+		log.Printf("Kafka consumer throttle released after %v: p99 write latency %v", now.Sub(t.since).Round(time.Second), p99)
+	default:
+		log.Printf("Kafka consumer throttle level %.2f -> %.2f: p99 write latency %v, %.0f%% failed; batches of %d, %v pause",
+			previous, t.level, p99, errorRate*100, batchSize, delay)
+	}
+}
+
+// measure returns the p99 latency and the error rate of the samples.
+func (t *throttle) measure() (time.Duration, float64) {
+	if len(t.samples) == 0 {
+		return 0, 0
+	}
+	latencies := make([]time.Duration, len(t.samples))
+	failed := 0
+	for i, s := range t.samples {
+		latencies[i] = s.latency
+		if s.failed {
+			failed++
+		}
+	}
+	slices.Sort(latencies)
+	i := int(math.Ceil(0.99*float64(len(latencies)))) - 1
+	return latencies[i], float64(failed) / float64(len(t.samples))
+}
+
+// effective returns the batch size and pause after each batch write of the
+// current level. A nil throttle never slows anything.
+func (t *throttle) effective() (int, time.Duration) {
+	if t == nil {
+		return 0, 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.effectiveLocked()
+}
+
+func (t *throttle) effectiveLocked() (int, time.Duration) {
+	batchSize := max(int(math.Ceil(float64(t.batchSize)*(1-t.level))), 1)
+	return batchSize, time.Duration(t.level * float64(t.config.MaxDelay))
+}
+
+func (t *throttle) stats() *ThrottleStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	batchSize, delay := t.effectiveLocked()
+	p99, errorRate := t.measure()
+	stats := &ThrottleStats{
+		Level:     t.level,
+		BatchSize: batchSize,
+		Delay:     delay.String(),
+		P99:       p99.String(),
+		ErrorRate: errorRate,
+	}
+	if t.level > 0 {
+		since := t.since
+		stats.Since = &since
+	}
+	return stats
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestThrottleFollowsLatencyRamp(t *testing.T) {
+	th, err := newThrottle(ThrottleConfig{Latency: 50 * time.Millisecond, ErrorRate: 0.2}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// Each phase is a run of batch writes the store answers in latency,
+	// after which the level has settled at level
+	for _, phase := range []struct {
+		latency time.Duration
+		writes  int
+		failed  bool
+		level   float64
+	}{
+		{5 * time.Millisecond, 20, false, 0},
+		{30 * time.Millisecond, 20, false, 0}, // Slower, but under the threshold
+		{60 * time.Millisecond, 20, false, 1}, // Over it: a step every quarter window
+		{45 * time.Millisecond, 20, false, 1}, // Under it, but not enough to ease off
+		{5 * time.Millisecond, 55, false, 0},  // Recovered: half a step at a time
+		{5 * time.Millisecond, 10, true, 0.5}, // Fast, but failing
+	} {
+		previous := th.stats().Level
+		for range phase.writes {
+			now = now.Add(time.Second)
+			th.observe(phase.latency, phase.failed, now)
+			level := th.stats().Level
+			// The level moves only towards where the phase takes it
+			if (phase.level > previous && level < previous) || (phase.level < previous && level > previous) {
+				t.Fatalf("at %v the level went %.3f -> %.3f, want it to move towards %.2f", phase.latency, previous, level, phase.level)
+			}
+			previous = level
+		}
+		if level := th.stats().Level; level != phase.level {
+			t.Fatalf("after %d writes of %v (failed %v) the level is %.3f, want %.2f", phase.writes, phase.latency, phase.failed, level, phase.level)
+		}
+		batchSize, delay := th.effective()
+		if wantBatch, wantDelay := max(int(100*(1-phase.level)), 1), time.Duration(phase.level*float64(defaultThrottleMaxDelay)); batchSize != wantBatch || delay != wantDelay {
+			t.Fatalf("at level %.2f batches of %d with a %v pause, want %d and %v", phase.level, batchSize, delay, wantBatch, wantDelay)
+		}
+		if gauge := throttleLevel.Value(); gauge != phase.level {
+			t.Fatalf("throttle gauge = %.3f, want %.2f", gauge, phase.level)
+		}
+	}
+}
+
+// slowStore answers SaveBatch after delay.
+type slowStore struct {
+	store.Store
+	delay time.Duration
+}
+
+func (s *slowStore) SaveBatch(messages []models.Message) (int, error) {
+	time.Sleep(s.delay)
+	return s.Store.SaveBatch(messages)
+}
+
+func TestSlowBatchWritesShrinkBatches(t *testing.T) {
+	th, err := newThrottle(ThrottleConfig{Latency: 5 * time.Millisecond, Window: 4, Step: 0.5}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &slowStore{Store: store.NewMemoryStore(), delay: 20 * time.Millisecond}
+	bp := newBatchProcessor(s, eventRoutes{dlq: &recordingDLQ{}}, 10, time.Second, &consumerCounters{})
+	bp.throttle = th
+
+	for i := range 2 {
+		msg := models.Message{ID: fmt.Sprintf("m%d", i), PhoneNumber: "9876543210", Text: "hello", Status: "SENT", CreatedAt: time.Now()}
+		if err := bp.flushBatch([]models.Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size := bp.effectiveBatchSize(); size != 1 {
+		t.Fatalf("batch size %d after two slow writes, want 1", size)
+	}
+
+	s.delay = 0
+	for i := range 2 {
+		msg := models.Message{ID: fmt.Sprintf("n%d", i), PhoneNumber: "9876543210", Text: "hello", Status: "SENT", CreatedAt: time.Now()}
+		if err := bp.flushBatch([]models.Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size := bp.effectiveBatchSize(); size != 5 {
+		t.Fatalf("batch size %d after two fast writes, want 5 as the throttle eases off", size)
+	}
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Initial offsets accepted by ConsumerConfig.InitialOffset.
+const (
+	OffsetEarliest = "earliest"
+	OffsetLatest   = "latest"
+)
+
+// kafkaVersion is the protocol version the consumer speaks.
+var kafkaVersion = sarama.V2_8_0_0
+
+// newSaramaConfig builds the consumer group configuration from config.
+// Zero tuning fields fall back to DefaultConsumerConfig.
+func newSaramaConfig(config ConsumerConfig) (*sarama.Config, error) {
+	defaults := DefaultConsumerConfig()
+	if config.FetchMinBytes == 0 {
+		config.FetchMinBytes = defaults.FetchMinBytes
+	}
+	if config.FetchMaxBytes == 0 {
+		config.FetchMaxBytes = defaults.FetchMaxBytes
+	}
+	if config.MaxPartitionFetchBytes == 0 {
+		config.MaxPartitionFetchBytes = defaults.MaxPartitionFetchBytes
+	}
+	if config.SessionTimeout == 0 {
+		config.SessionTimeout = defaults.SessionTimeout
+	}
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = defaults.HeartbeatInterval
+	}
+
+	cfg := sarama.NewConfig()
+	cfg.Version = kafkaVersion // Use a stable Kafka version
+	cfg.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRoundRobin()
+	cfg.Consumer.Return.Errors = true
+
+	switch config.InitialOffset {
+	case "", OffsetEarliest:
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest // Start from beginning if no offset
+	case OffsetLatest:
+		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return nil, fmt.Errorf("invalid initial offset %q: must be %s or %s", config.InitialOffset, OffsetEarliest, OffsetLatest)
+	}
+
+	// Fetch sizing. Fetch.Default is the per-partition fetch size
+	// (max.partition.fetch.bytes); Fetch.Max caps a whole fetch response.
+	cfg.Consumer.Fetch.Min = config.FetchMinBytes
+	cfg.Consumer.Fetch.Default = config.MaxPartitionFetchBytes
+	cfg.Consumer.Fetch.Max = config.FetchMaxBytes
+
+	cfg.Consumer.Group.Session.Timeout = config.SessionTimeout
+	cfg.Consumer.Group.Heartbeat.Interval = config.HeartbeatInterval
+	cfg.Consumer.MaxProcessingTime = 30 * time.Second
+
+	if err := verifyCompression(config.Compression); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka consumer configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// ValidateConsumerConfig reports configuration errors without connecting,
+// so startup can fail with a clear message instead of retrying forever.
+func ValidateConsumerConfig(config ConsumerConfig) error {
+	if _, err := newSaramaConfig(config); err != nil {
+		return err
+	}
+	if config.MaxInFlight < 0 {
+		return fmt.Errorf("kafka max in-flight messages must not be negative, got %d", config.MaxInFlight)
+	}
+	if _, err := newDuplicateTexts(config.DuplicateTextWindow, config.DuplicateTextMode); err != nil {
+		return err
+	}
+	return validateThrottle(config.Throttle)
+}
+
+// verifyCompression checks that every codec the topic is expected to use can
+// be decoded. Sarama decompresses gzip, snappy, lz4 and zstd natively, but
+// only when the negotiated protocol version supports the codec, so each codec
+// is validated against kafkaVersion the same way sarama validates producers.
+func verifyCompression(codecs []string) error {
+	for _, name := range codecs {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		var codec sarama.CompressionCodec
+		if err := codec.UnmarshalText([]byte(name)); err != nil {
+			return fmt.Errorf("unsupported Kafka compression codec %q: supported codecs are none, gzip, snappy, lz4, zstd", name)
+		}
+
+		probe := sarama.NewConfig()
+		probe.Version = kafkaVersion
+		probe.Producer.Compression = codec
+		if err := probe.Validate(); err != nil {
+			return fmt.Errorf("kafka compression codec %q is not available: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	benchTopic        = "sms-events"
+	benchMessageBytes = 64 << 10 // Large messages, which the default fetch size holds few of
+	benchMessages     = 512
+	benchLatency      = 2 * time.Millisecond
+)
+
+// BenchmarkFetchSizes consumes a partition of 64 KiB messages from a mock
+// broker that takes 2ms to answer each request. A broker fills a fetch up
+// to the partition fetch size, so the mock answers with as many messages
+// as that holds: 16 with the default 1 MiB, 128 with the tuned 8 MiB.
+// Throughput is bound by the round trips each fetch costs.
+func BenchmarkFetchSizes(b *testing.B) {
+	tuned := DefaultConsumerConfig()
+	tuned.MaxPartitionFetchBytes = 8 << 20
+	tuned.FetchMaxBytes = 64 << 20
+
+	for _, bc := range []struct {
+		name   string
+		config ConsumerConfig
+	}{
+		{"Default", DefaultConsumerConfig()},
+		{"Tuned", tuned},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cfg, err := newSaramaConfig(bc.config)
+			if err != nil {
+				b.Fatalf("newSaramaConfig: %v", err)
+			}
+			perFetch := int(min(cfg.Consumer.Fetch.Default, cfg.Consumer.Fetch.Max)) / benchMessageBytes
+
+			broker := sarama.NewMockBroker(b, 1)
+			defer broker.Close()
+			fetch := sarama.NewMockFetchResponse(b, perFetch)
+			value := sarama.ByteEncoder(make([]byte, benchMessageBytes))
+			for offset := range int64(benchMessages) {
+				fetch.SetMessage(benchTopic, 0, offset, value)
+			}
+			fetch.SetHighWaterMark(benchTopic, 0, benchMessages)
+			broker.SetHandlerByMap(map[string]sarama.MockResponse{
+				"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(b),
+				"MetadataRequest": sarama.NewMockMetadataResponse(b).
+					SetBroker(broker.Addr(), broker.BrokerID()).
+					SetLeader(benchTopic, 0, broker.BrokerID()),
+				"OffsetRequest": sarama.NewMockOffsetResponse(b).
+					SetOffset(benchTopic, 0, sarama.OffsetOldest, 0).
+					SetOffset(benchTopic, 0, sarama.OffsetNewest, benchMessages),
+				"FetchRequest": fetch,
+			})
+			broker.SetLatency(benchLatency)
+
+			consumer, err := sarama.NewConsumer([]string{broker.Addr()}, cfg)
+			if err != nil {
+				b.Fatalf("NewConsumer: %v", err)
+			}
+			defer consumer.Close()
+
+			b.SetBytes(benchMessages * benchMessageBytes)
+			iterations := 0
+			for b.Loop() {
+				pc, err := consumer.ConsumePartition(benchTopic, 0, sarama.OffsetOldest)
+				if err != nil {
+					b.Fatalf("ConsumePartition: %v", err)
+				}
+				for range benchMessages {
+					select {
+					case <-pc.Messages():
+					case err := <-pc.Errors():
+						b.Fatalf("consuming: %v", err)
+					case <-time.After(10 * time.Second):
+						b.Fatal("timed out consuming the partition")
+					}
+				}
+				pc.Close()
+				iterations++
+			}
+			b.ReportMetric(float64(iterations*benchMessages)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Package language detects the language of message text: from its script
+// where the script names the language, and from character trigrams for
+// text in the Latin alphabet.
+package language
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Undetermined is the code of text whose language isn't detected with
+// enough confidence.
+const Undetermined = "und"
+
+// Language codes the detector returns, as BCP 47 tags.
+const (
+	English    = "en"
+	Hindi      = "hi"
+	HindiLatin = "hi-Latn" // Hindi in the Latin alphabet, as Hinglish mostly is
+	Bengali    = "bn"
+	Gujarati   = "gu"
+	Kannada    = "kn"
+	Malayalam  = "ml"
+	Oriya      = "or"
+	Punjabi    = "pa"
+	Tamil      = "ta"
+	Telugu     = "te"
+)
+
+// DefaultMinConfidence is the confidence below which text is Undetermined
+// by default.
+const DefaultMinConfidence = 0.5
+
+// scriptLanguages are the scripts that name a language on their own. Text
+// in other scripts, apart from Latin, is Undetermined.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	code   string
+}{
+	{unicode.Devanagari, Hindi},
+	{unicode.Bengali, Bengali},
+	{unicode.Gujarati, Gujarati},
+	{unicode.Kannada, Kannada},
+	{unicode.Malayalam, Malayalam},
+	{unicode.Oriya, Oriya},
+	{unicode.Gurmukhi, Punjabi},
+	{unicode.Tamil, Tamil},
+	{unicode.Telugu, Telugu},
+}
+
+const (
+	minLetters     = 4  // Fewer letters than this are Undetermined
+	fullTrigrams   = 12 // Latin text with fewer trigrams is detected with less confidence
+	fullCoverage   = 0.8
+	posteriorScale = 0.5 // Tempers how fast the trigram evidence becomes certain
+)
+
+// Detector detects the language of text. It is safe for concurrent use.
+type Detector struct {
+	minConfidence float64
+	profiles      []*profile // Of the languages written in the Latin alphabet
+}
+
+// NewDetector returns a detector that answers Undetermined below
+// minConfidence, or DefaultMinConfidence when it is 0.
+func NewDetector(minConfidence float64) *Detector {
+	if minConfidence <= 0 {
+		minConfidence = DefaultMinConfidence
+	}
+	return &Detector{minConfidence: minConfidence, profiles: latinProfiles}
+}
+
+// Detect returns the language of text and the confidence of it, from 0 to
+// 1. Text detected with less than the minimum confidence is Undetermined,
+// with the confidence its likeliest language had.
+//
+// Text with an Indic script is that script's language, taking Latin
+// letters among it for loanwords, unless they outnumber it.
+// Latin text is scored against the trigram profiles of English and
+// romanized Hindi, so Hinglish comes out as whichever it mostly is, with
+// less confidence the more evenly it mixes them. Short text, and Latin
+// text much of which neither profile knows, is detected with little
+// confidence.
+func (d *Detector) Detect(text string) (string, float64) {
+	code, confidence := d.detect(text)
+	if confidence < d.minConfidence {
+		return Undetermined, confidence
+	}
+	return code, confidence
+}
+
+func (d *Detector) detect(text string) (string, float64) {
+	scripts := make(map[string]int)
+	letters, latin := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.Is(unicode.M, r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, sl := range scriptLanguages {
+			if unicode.Is(sl.script, r) {
+				scripts[sl.code]++
+				break
+			}
+		}
+	}
+	if letters < minLetters {
+		return Undetermined, 0
+	}
+
+	best, bestCount := "", 0
+	for code, n := range scripts {
+		if n > bestCount || n == bestCount && code < best {
+			best, bestCount = code, n
+		}
+	}
+	if bestCount > 0 && bestCount+latin >= letters/2 && bestCount >= latin {
+		return best, float64(bestCount+latin) / float64(letters)
+	}
+	if latin*2 < letters {
+		return Undetermined, 0
+	}
+
+	code, confidence := d.scoreLatin(text)
+	return code, confidence * float64(latin) / float64(letters)
+}
+
+// scoreLatin picks the Latin profile that best explains the trigrams of
+// text's words. The confidence is its share of the tempered likelihoods,
+// discounted for few trigrams and for trigrams it has never seen.
+func (d *Detector) scoreLatin(text string) (string, float64) {
+	grams := trigrams(text)
+	if len(grams) == 0 {
+		return Undetermined, 0
+	}
+
+	scores := make([]float64, len(d.profiles))
+	seen := make([]int, len(d.profiles))
+	for i, p := range d.profiles {
+		for _, g := range grams {
+			lp, ok := p.logProb[g]
+			if !ok {
+				lp = p.unseen
+			} else {
+				seen[i]++
+			}
+			scores[i] += lp
+		}
+	}
+
+	best := 0
+	for i := range scores {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	var total float64
+	for i := range scores {
+		total += math.Exp((scores[i] - scores[best]) * posteriorScale)
+	}
+	posterior := 1 / total
+
+	length := min(1, float64(len(grams))/fullTrigrams)
+	coverage := min(1, float64(seen[best])/float64(len(grams))/fullCoverage)
+	return d.profiles[best].code, posterior * length * coverage
+}
+
+// trigrams returns the character trigrams of the Latin words of text,
+// lowercased, each word padded with a space at either end.
+func trigrams(text string) []string {
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.Is(unicode.Latin, r)
+	}) {
+		padded := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			grams = append(grams, string(padded[i:i+3]))
+		}
+	}
+	return grams
+}
+
+// profile is the trigram distribution of one language.
+type profile struct {
+	code    string
+	logProb map[string]float64
+	unseen  float64 // Log probability of a trigram the sample lacks
+}
+
+// newProfile builds the profile of code from a sample of its text, with
+// add-one smoothing.
+func newProfile(code, sample string) *profile {
+	counts := make(map[string]int)
+	grams := trigrams(sample)
+	for _, g := range grams {
+		counts[g]++
+	}
+	// Room for the trigrams the sample lacks
+	vocabulary := float64(len(counts) + 5000)
+	denominator := float64(len(grams)) + vocabulary
+
+	p := &profile{code: code, logProb: make(map[string]float64, len(counts)), unseen: math.Log(1 / denominator)}
+	for g, n := range counts {
+		p.logProb[g] = math.Log(float64(n+1) / denominator)
+	}
+	return p
+}
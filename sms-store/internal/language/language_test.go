@@ -0,0 +1,46 @@
+package language
+
+import "testing"
+
+func TestDetectHinglish(t *testing.T) {
+	d := NewDetector(0)
+	for _, tc := range []struct {
+		text string
+		want string
+	}{
+		// Romanized Hindi, with the English words Hinglish borrows
+		{"Bhai kal subah order deliver kar dena, main ghar pe nahi rahunga", HindiLatin},
+		{"Aapka parcel aaj shaam tak pahunch jayega", HindiLatin},
+		{"kya aap mujhe refund ka status bata sakte ho?", HindiLatin},
+		{"mera payment ho gaya lekin order confirm nahi hua", HindiLatin},
+		{"Haan bhai, main 10 minute mein pahunch raha hoon", HindiLatin},
+		{"theek hai, kal baat karte hain", HindiLatin},
+		// Mostly English, with a Hindi phrase
+		{"order ka status kya hai? It was supposed to come yesterday", English},
+		{"Please deliver my order tomorrow morning, I will not be at home today", English},
+		{"Your OTP is 482913. Do not share it with anyone.", English},
+		// Devanagari, with a Latin loanword
+		{"मेरा ऑर्डर कब आएगा?", Hindi},
+		{"मेरा ऑर्डर कब deliver होगा?", Hindi},
+		{"உங்கள் பார்சல் நாளை வரும்", Tamil},
+		// Too short to tell
+		{"ok", Undetermined},
+		{"haan", Undetermined},
+		{"👍🙏", Undetermined},
+	} {
+		if got, confidence := d.Detect(tc.text); got != tc.want {
+			t.Errorf("Detect(%q) = %s (%.2f), want %s", tc.text, got, confidence, tc.want)
+		}
+	}
+}
+
+func TestDetectBelowMinConfidenceIsUndetermined(t *testing.T) {
+	const text = "mera payment ho gaya lekin order confirm nahi hua"
+	code, confidence := NewDetector(0).Detect(text)
+	if code != HindiLatin || confidence >= 1 {
+		t.Fatalf("Detect(%q) = %s (%.2f), want %s with less than full confidence", text, code, confidence, HindiLatin)
+	}
+	if got, c := NewDetector(confidence + 0.01).Detect(text); got != Undetermined || c != confidence {
+		t.Fatalf("Detect(%q) over a higher minimum = %s (%.2f), want %s (%.2f)", text, got, c, Undetermined, confidence)
+	}
+}
@@ -0,0 +1,68 @@
+package language
+
+// latinProfiles are the languages Latin text is told apart between, built
+// once from the samples below.
+var latinProfiles = []*profile{
+	newProfile(English, englishSample),
+	newProfile(HindiLatin, hindiLatinSample),
+}
+
+// The samples are written like the messages this service stores: order,
+// payment and delivery notices, support chats and everyday texts. The
+// romanized Hindi one spells words the many ways people type them, and
+// keeps the English words Hinglish borrows.
+const englishSample = `
+Your order has been shipped and will be delivered by tomorrow. Track your
+package with the link below. Your payment of the amount was successful,
+thank you for shopping with us. The refund for your return has been
+processed and will reach your account in five to seven working days. Your
+one time password is valid for ten minutes, do not share it with anyone.
+Hi, is the parcel still on its way? I was not at home when the delivery
+person came. Could you please deliver it again in the evening? Sure, we
+will try again tomorrow between ten and six. Thanks a lot, that works for
+me. Please call me when you reach the gate. I am on my way and should be
+there in about twenty minutes. Let me know if you need anything else. The
+product I received is damaged and the colour is not what I ordered. We are
+sorry for the trouble. You can request a replacement from the orders page
+and our team will pick up the item within two days. What time does the
+store open on Sunday? We are open from nine in the morning until nine at
+night every day of the week. Happy birthday, have a wonderful day with your
+family. Can we meet for lunch this week? I will be free after the meeting
+on Thursday. Your account balance is low, please recharge to continue
+using the service. Congratulations, you have earned reward points on this
+purchase. The offer ends tonight, so do not miss it. Where are you right
+now? Just got back from work, will call you later. Good morning, hope you
+slept well. Did you get the documents I sent yesterday? Yes, I signed them
+and sent them back this afternoon. Your appointment is confirmed for
+Monday at eleven. Reply with a number to rate your experience with our
+support. We could not verify your address, please update it so that we
+can complete the delivery. Cash on delivery is available for this order.
+`
+
+const hindiLatinSample = `
+Aapka order ship ho gaya hai aur kal tak deliver ho jayega. Aapka payment
+safal raha, humse kharidari karne ke liye dhanyavaad. Aapka refund process
+ho gaya hai, paanch se saat din mein aapke khate mein aa jayega. Yeh OTP
+kisi ke saath share na karein. Kya haal hai bhai? Main theek hoon, tum
+batao. Kal mil sakte hain kya? Haan zaroor, sham ko aata hoon. Mera parcel
+abhi tak nahi aaya, kab tak aayega? Delivery wala aaya tha par main ghar
+par nahi tha. Kripya dobara bhej dijiye. Ji bilkul, hum kal phir se
+koshish karenge. Bahut bahut shukriya, aap bahut achhe ho. Mujhe yeh
+product pasand nahi aaya, color alag hai aur size bhi chhota hai. Maaf
+kijiye, aap orders page se replacement maang sakte hain. Aap kahan ho
+abhi? Bas ghar pahunch gaya, thodi der mein call karta hoon. Suprabhat,
+aapka din shubh ho. Janamdin ki bahut saari shubhkamnayein. Khana kha
+liya? Nahi yaar, abhi office mein hoon, kaam bahut zyada hai. Koi baat
+nahi, jab free ho tab baat karte hain. Mere paise kab wapas milenge? Aapki
+shikayat darj kar li gayi hai, hamari team jaldi sampark karegi. Bhaiya
+gate pe aa jao, main neeche khada hoon. Accha theek hai, paanch minute
+mein aata hoon. Kya aapne mera message dekha? Haan dekh liya, main soch
+raha tha ki kal chalein. Mummy ne bola hai jaldi ghar aana. Tumhara phone
+kyun band tha? Battery khatam ho gayi thi. Aaj bahut garmi hai, paani
+peete rehna. Chinta mat karo, sab theek ho jayega. Yeh offer sirf aaj raat
+tak hai, jaldi karo. Mujhe samajh nahi aaya, thoda aur batao na. Kaun sa
+wala chahiye tumhe? Wahi jo pichli baar liya tha. Hum log kal subah nikal
+rahe hain. Unka kehna hai ki paisa mil gaya. Kyunki woh nahi aa paye isliye
+humne plan badal diya. Mera naam likh lo aur mujhe bata dena. Theek hai ji,
+dhanyawad. Aap chinta na karein, aapka samaan surakshit hai.
+`
@@ -0,0 +1,319 @@
+// Package metrics is a small dependency-free metrics registry that exposes
+// counters, gauges and histograms in the Prometheus text exposition format on /metrics.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds a set of named metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]collector
+}
+
+// collector is implemented by every metric type.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Default is the process-wide registry served by Handler.
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]collector)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.metrics[name]; exists {
+		panic("metrics: duplicate registration of " + name)
+	}
+	r.metrics[name] = c
+}
+
+// WriteText writes all metrics in the Prometheus text format, sorted by name.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.metrics[name])
+	}
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Default.WriteText(w)
+	})
+}
+
+/* ---------- counters ---------- */
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds n to the counter.
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.RWMutex
+	values map[string]*labelled
+}
+
+type labelled struct {
+	labelValues []string
+	counter     Counter
+}
+
+// NewCounterVec creates and registers a counter family in the default registry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labelNames...)
+}
+
+// NewCounterVec creates and registers a counter family in r.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labelNames: labelNames, values: make(map[string]*labelled)}
+	r.register(name, c)
+	return c
+}
+
+// WithLabelValues returns the counter for the given label values, creating it on first use.
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	if len(values) != len(c.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", c.name, len(c.labelNames), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	c.mu.RLock()
+	l, ok := c.values[key]
+	c.mu.RUnlock()
+	if ok {
+		return &l.counter
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok = c.values[key]; !ok {
+		l = &labelled{labelValues: append([]string(nil), values...)}
+		c.values[key] = l
+	}
+	return &l.counter
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		l := c.values[k]
+		fmt.Fprintf(w, "%s%s %d\n", c.name, formatLabels(c.labelNames, l.labelValues), l.counter.Value())
+	}
+	c.mu.RUnlock()
+}
+
+// formatLabels renders {a="x",b="y"} with Prometheus escaping.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+/* ---------- gauges ---------- */
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	name string
+	help string
+	bits atomic.Uint64
+}
+
+// NewGauge creates and registers a gauge in the default registry.
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewGauge creates and registers a gauge in r.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	fmt.Fprintf(w, "%s %s\n", g.name, strconv.FormatFloat(g.Value(), 'g', -1, 64))
+}
+
+/* ---------- histograms ---------- */
+
+// DefaultBuckets are upper bounds in seconds suited to store and HTTP latencies.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64 // One per bound, plus +Inf
+	sumBits     atomic.Uint64
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.counts[i].Add(1)
+	for {
+		old := h.sumBits.Load()
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	name        string
+	help        string
+	labelNames  []string
+	upperBounds []float64
+
+	mu     sync.RWMutex
+	values map[string]*labelledHistogram
+}
+
+type labelledHistogram struct {
+	labelValues []string
+	histogram   Histogram
+}
+
+// NewHistogramVec creates and registers a histogram family in the default registry.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+// NewHistogramVec creates and registers a histogram family in r. Buckets
+// are upper bounds in increasing order; +Inf is implied.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	upperBounds := append([]float64(nil), buckets...)
+	sort.Float64s(upperBounds)
+	h := &HistogramVec{name: name, help: help, labelNames: labelNames, upperBounds: upperBounds, values: make(map[string]*labelledHistogram)}
+	r.register(name, h)
+	return h
+}
+
+// WithLabelValues returns the histogram for the given label values, creating it on first use.
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	if len(values) != len(h.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labelNames), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	h.mu.RLock()
+	l, ok := h.values[key]
+	h.mu.RUnlock()
+	if ok {
+		return &l.histogram
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if l, ok = h.values[key]; !ok {
+		l = &labelledHistogram{
+			labelValues: append([]string(nil), values...),
+			histogram:   Histogram{upperBounds: h.upperBounds, counts: make([]atomic.Uint64, len(h.upperBounds)+1)},
+		}
+		h.values[key] = l
+	}
+	return &l.histogram
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	names := append(append([]string(nil), h.labelNames...), "le")
+	h.mu.RLock()
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		l := h.values[k]
+		values := append(append([]string(nil), l.labelValues...), "")
+		var cumulative uint64
+		for i := range l.histogram.counts {
+			cumulative += l.histogram.counts[i].Load()
+			values[len(values)-1] = "+Inf"
+			if i < len(h.upperBounds) {
+				values[len(values)-1] = strconv.FormatFloat(h.upperBounds[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values), cumulative)
+		}
+		labels := formatLabels(h.labelNames, l.labelValues)
+		sum := math.Float64frombits(l.histogram.sumBits.Load())
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, strconv.FormatFloat(sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, cumulative)
+	}
+	h.mu.RUnlock()
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogramVecExposition(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("op_seconds", "Duration of ops.", []float64{1, 0.1}, "op", "outcome")
+	ok := h.WithLabelValues("Save", "success")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		ok.Observe(v)
+	}
+	if h.WithLabelValues("Save", "success") != ok {
+		t.Fatal("the same label values gave another histogram")
+	}
+	h.WithLabelValues(`qu"ote`, "failure").Observe(0.2)
+
+	var out strings.Builder
+	r.WriteText(&out)
+	// Buckets are sorted and cumulative, with an observation on a bound
+	// counted in its bucket
+	want := `# HELP op_seconds Duration of ops.
+# TYPE op_seconds histogram
+op_seconds_bucket{op="Save",outcome="success",le="0.1"} 2
+op_seconds_bucket{op="Save",outcome="success",le="1"} 3
+op_seconds_bucket{op="Save",outcome="success",le="+Inf"} 4
+op_seconds_sum{op="Save",outcome="success"} 3.65
+op_seconds_count{op="Save",outcome="success"} 4
+op_seconds_bucket{op="qu\"ote",outcome="failure",le="0.1"} 0
+op_seconds_bucket{op="qu\"ote",outcome="failure",le="1"} 1
+op_seconds_bucket{op="qu\"ote",outcome="failure",le="+Inf"} 1
+op_seconds_sum{op="qu\"ote",outcome="failure"} 0.2
+op_seconds_count{op="qu\"ote",outcome="failure"} 1
+`
+	if out.String() != want {
+		t.Fatalf("exposition:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestHistogramVecChecksLabelCount(t *testing.T) {
+	h := NewRegistry().NewHistogramVec("ops", "Ops.", DefaultBuckets, "op")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithLabelValues with too many values didn't panic")
+		}
+	}()
+	h.WithLabelValues("Save", "extra")
+}
@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Checkpoint records how far a migration of one source has come. It is
+// saved after every batch, so a run interrupted by a crash resumes at the
+// last batch written.
+type Checkpoint struct {
+	Source    string           `json:"source" bson:"_id"`
+	BaseCount int64            `json:"baseCount" bson:"baseCount"` // Messages stored before the first run, for the final count check
+	Files     []FileCheckpoint `json:"files" bson:"files"`
+	StartedAt time.Time        `json:"startedAt" bson:"startedAt"`
+	UpdatedAt time.Time        `json:"updatedAt" bson:"updatedAt"`
+}
+
+// FileCheckpoint is the progress of one file. Offset is the byte offset of
+// the first line not yet written.
+type FileCheckpoint struct {
+	Name       string `json:"name" bson:"name"`
+	Offset     int64  `json:"offset" bson:"offset"`
+	Lines      int64  `json:"lines" bson:"lines"`
+	Imported   int64  `json:"imported" bson:"imported"`
+	Duplicates int64  `json:"duplicates" bson:"duplicates"`
+	Invalid    int64  `json:"invalid" bson:"invalid"`
+	Done       bool   `json:"done" bson:"done"`
+}
+
+// file returns the checkpoint of the named file, adding an empty one.
+func (cp *Checkpoint) file(name string) *FileCheckpoint {
+	for i := range cp.Files {
+		if cp.Files[i].Name == name {
+			return &cp.Files[i]
+		}
+	}
+	cp.Files = append(cp.Files, FileCheckpoint{Name: name})
+	return &cp.Files[len(cp.Files)-1]
+}
+
+// ErrNoCheckpoint is returned by CheckpointStore.Load for a source that has
+// never been migrated.
+var ErrNoCheckpoint = errors.New("no migration checkpoint")
+
+// CheckpointStore persists migration checkpoints.
+type CheckpointStore interface {
+	// Load returns the checkpoint of source, or ErrNoCheckpoint.
+	Load(source string) (Checkpoint, error)
+
+	// Save creates or replaces the checkpoint of cp.Source.
+	Save(cp Checkpoint) error
+
+	// Delete removes the checkpoint of source, if any.
+	Delete(source string) error
+}
+
+// MongoCheckpointStore keeps checkpoints in a MongoDB collection, one
+// document per source.
+type MongoCheckpointStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCheckpointStore creates a checkpoint store on the given database.
+// It uses the same MongoDB connection as the message store.
+func NewMongoCheckpointStore(client *mongo.Client, databaseName, collectionName string) *MongoCheckpointStore {
+	if collectionName == "" {
+		collectionName = "migration_checkpoints"
+	}
+	return &MongoCheckpointStore{collection: client.Database(databaseName).Collection(collectionName)}
+}
+
+func (s *MongoCheckpointStore) Load(source string) (Checkpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var cp Checkpoint
+	err := s.collection.FindOne(ctx, bson.M{"_id": source}).Decode(&cp)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Checkpoint{}, ErrNoCheckpoint
+	}
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("failed to load migration checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+func (s *MongoCheckpointStore) Save(cp Checkpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": cp.Source}, cp, opts); err != nil {
+		return fmt.Errorf("failed to save migration checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoCheckpointStore) Delete(source string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": source}); err != nil {
+		return fmt.Errorf("failed to delete migration checkpoint: %w", err)
+	}
+	return nil
+}
+
+// MemoryCheckpointStore keeps checkpoints in memory, for tests and local
+// runs where resuming after a restart doesn't matter.
+type MemoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpointStore creates an empty in-memory checkpoint store.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: make(map[string]Checkpoint)}
+}
+
+func (s *MemoryCheckpointStore) Load(source string) (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.checkpoints[source]
+	if !ok {
+		return Checkpoint{}, ErrNoCheckpoint
+	}
+	cp.Files = append([]FileCheckpoint(nil), cp.Files...)
+	return cp, nil
+}
+
+func (s *MemoryCheckpointStore) Save(cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp.Files = append([]FileCheckpoint(nil), cp.Files...)
+	s.checkpoints[cp.Source] = cp
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Delete(source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.checkpoints, source)
+	return nil
+}
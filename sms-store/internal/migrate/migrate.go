@@ -0,0 +1,428 @@
+// Package migrate bulk-imports historical messages from NDJSON files or
+// SMS Backup & Restore XML exports. It
+// writes straight to the message store it is given, so the imported history
+// doesn't go through the per-message side effects of live traffic, reads
+// files in parallel, and checkpoints each file's offset so an interrupted
+// migration resumes where it stopped.
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// maxInvalidSamples caps the invalid lines a Result describes.
+const maxInvalidSamples = 20
+
+// Options tune a migration run.
+type Options struct {
+	Parallelism int  // Files read at once
+	BatchSize   int  // Messages per SaveBatch
+	Restart     bool // Discard the source's checkpoint and start over
+}
+
+// Progress receives a run's progress in bytes of source data. It is
+// satisfied by *jobs.Progress.
+type Progress interface {
+	SetTotal(total int64)
+	Add(n int64)
+}
+
+// InvalidLine describes a line, or an XML element, that was skipped because
+// it isn't a valid message.
+type InvalidLine struct {
+	File    string
+	Offset  int64
+	Line    int64 // Of XML files, whose elements needn't each have a line
+	Element int64 // Position among the message elements of an XML file, from 1
+	Error   string
+}
+
+// Result is the outcome of a run. Counts cover every run of the source
+// since its checkpoint was created, so a resumed run reports the whole
+// migration.
+type Result struct {
+	Source            string
+	Resumed           bool
+	Files             int
+	Lines             int64
+	Imported          int64
+	Duplicates        int64
+	Invalid           int64
+	InvalidSamples    []InvalidLine
+	Bytes             int64 // Read by this run
+	Duration          time.Duration
+	MessagesPerSecond float64 // Imported by this run
+	Verification      Verification
+}
+
+// Verification compares the store's message count with the count expected
+// from the messages stored before the migration plus those it imported.
+// Messages arriving from live traffic during the migration also count, so
+// a mismatch on a busy store isn't necessarily a loss.
+type Verification struct {
+	ExpectedCount int64
+	StoreCount    int64
+	Verified      bool
+}
+
+// Migrator imports sources into a message store.
+type Migrator struct {
+	store       store.Store
+	checkpoints CheckpointStore
+
+	clock.Clocked
+}
+
+// NewMigrator creates a migrator writing to s, the store the API writes
+// through, so migrated messages are stored like any other. Messages s
+// declines to store, as of a region not served, count as duplicates.
+func NewMigrator(s store.Store, checkpoints CheckpointStore) *Migrator {
+	return &Migrator{store: s, checkpoints: checkpoints}
+}
+
+// run is the shared state of one Run call.
+type run struct {
+	m        *Migrator
+	src      Source
+	opts     Options
+	progress Progress
+
+	resuming bool // The checkpoint is from an earlier run
+
+	mu         sync.Mutex
+	checkpoint Checkpoint
+	samples    []InvalidLine
+	bytes      int64
+	imported   int64 // By this run
+}
+
+// Run migrates src, resuming from its checkpoint unless opts.Restart is
+// set. It returns at the first write error, leaving the checkpoint at the
+// last batch written; running it again continues from there.
+func (m *Migrator) Run(ctx context.Context, src Source, opts Options, progress Progress) (Result, error) {
+	start := time.Now()
+	opts.Parallelism = max(opts.Parallelism, 1)
+	opts.BatchSize = max(opts.BatchSize, 1)
+
+	files, err := src.Files()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if opts.Restart {
+		if err := m.checkpoints.Delete(src.Name()); err != nil {
+			return Result{}, err
+		}
+	}
+	cp, err := m.checkpoints.Load(src.Name())
+	loaded := err == nil
+	if errors.Is(err, ErrNoCheckpoint) {
+		// Saved before the first write, so a crash at any point leaves a
+		// checkpoint to resume from
+		cp, err = m.newCheckpoint(src.Name())
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Every file gets its entry now; workers hold pointers into cp.Files
+	resumed := false
+	var remaining int64
+	for _, f := range files {
+		fc := cp.file(f.Name)
+		if fc.Offset > 0 {
+			resumed = true
+		}
+		if !fc.Done {
+			remaining += max(f.Size-fc.Offset, 0)
+		}
+	}
+	progress.SetTotal(remaining)
+
+	r := &run{m: m, src: src, opts: opts, progress: progress, checkpoint: cp, resuming: loaded}
+	if err := r.migrateFiles(ctx); err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Source:         src.Name(),
+		Resumed:        resumed,
+		Files:          len(files),
+		InvalidSamples: r.samples,
+		Bytes:          r.bytes,
+		Duration:       time.Since(start),
+	}
+	if result.InvalidSamples == nil {
+		result.InvalidSamples = []InvalidLine{}
+	}
+	for _, fc := range r.checkpoint.Files {
+		result.Lines += fc.Lines
+		result.Imported += fc.Imported
+		result.Duplicates += fc.Duplicates
+		result.Invalid += fc.Invalid
+	}
+	if secs := result.Duration.Seconds(); secs > 0 {
+		result.MessagesPerSecond = float64(r.imported) / secs
+	}
+
+	storeCount, err := m.count()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to count messages: %w", err)
+	}
+	result.Verification = Verification{
+		ExpectedCount: r.checkpoint.BaseCount + result.Imported,
+		StoreCount:    storeCount,
+	}
+	result.Verification.Verified = result.Verification.ExpectedCount == storeCount
+	return result, nil
+}
+
+// newCheckpoint saves an empty checkpoint for source, recording the store's
+// current message count.
+func (m *Migrator) newCheckpoint(source string) (Checkpoint, error) {
+	base, err := m.count()
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("failed to count messages: %w", err)
+	}
+	now := m.Clock().Now()
+	cp := Checkpoint{Source: source, BaseCount: base, Files: []FileCheckpoint{}, StartedAt: now, UpdatedAt: now}
+	if err := m.checkpoints.Save(cp); err != nil {
+		return Checkpoint{}, err
+	}
+	return cp, nil
+}
+
+// count returns how many messages the store holds, of every region: a
+// region-scoped store refuses to count while it holds messages of others.
+func (m *Migrator) count() (int64, error) {
+	return store.Unscoped(m.store).CountMessages("")
+}
+
+// migrateFiles reads the unfinished files with opts.Parallelism workers and
+// returns the first error, cancelling the other workers.
+func (r *run) migrateFiles(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pending := make(chan *FileCheckpoint)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < r.opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fc := range pending {
+				if err := r.migrateFile(ctx, fc); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range r.checkpoint.Files {
+		if r.checkpoint.Files[i].Done {
+			continue
+		}
+		select {
+		case pending <- &r.checkpoint.Files[i]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// migrateFile reads fc's file from its checkpointed offset, writing a batch
+// and saving the checkpoint every opts.BatchSize messages.
+func (r *run) migrateFile(ctx context.Context, fc *FileCheckpoint) error {
+	if r.src.Format() == FormatSMSBackupXML {
+		return r.migrateXMLFile(ctx, fc)
+	}
+
+	r.mu.Lock()
+	name, offset := fc.Name, fc.Offset
+	r.mu.Unlock()
+
+	in, err := r.src.Open(name, offset)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// A crash between a batch and its checkpoint leaves that batch stored
+	// but not recorded, so the first batch after a resume skips messages
+	// that already exist
+	checkExisting := r.resuming
+
+	reader := bufio.NewReaderSize(in, 1<<20)
+	batch := make([]models.Message, 0, r.opts.BatchSize)
+	var pending batchCounts
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return fmt.Errorf("failed to read %s: %w", name, readErr)
+		}
+		lineOffset := offset
+		offset += int64(len(line))
+		pending.bytes += int64(len(line))
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			pending.lines++
+			msg, err := parseMessage(line, name, lineOffset)
+			if err != nil {
+				pending.invalid++
+				r.sample(InvalidLine{File: name, Offset: lineOffset, Error: err.Error()})
+			} else {
+				batch = append(batch, msg)
+			}
+		}
+
+		eof := errors.Is(readErr, io.EOF)
+		if len(batch) >= r.opts.BatchSize || eof {
+			if err := r.writeBatch(batch, checkExisting, &pending); err != nil {
+				return err
+			}
+			checkExisting = false
+			if err := r.commit(fc, offset, pending, eof); err != nil {
+				return err
+			}
+			batch = batch[:0]
+			pending = batchCounts{}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+// batchCounts are a batch's counts not yet in the checkpoint.
+type batchCounts struct {
+	bytes, lines, imported, duplicates, invalid int64
+}
+
+// writeBatch stores batch, counting messages the store skipped as duplicates.
+func (r *run) writeBatch(batch []models.Message, checkExisting bool, counts *batchCounts) error {
+	if checkExisting {
+		fresh := batch[:0]
+		for _, msg := range batch {
+			// One of another region is already stored too
+			if _, err := r.m.store.FindByID(msg.ID); err == nil || errors.Is(err, store.ErrRegionNotAllowed) {
+				counts.duplicates++
+				continue
+			} else if !errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("failed to check message %s: %w", msg.ID, err)
+			}
+			fresh = append(fresh, msg)
+		}
+		batch = fresh
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	saved, err := r.m.store.SaveBatch(batch)
+	if err != nil {
+		return fmt.Errorf("failed to save batch: %w", err)
+	}
+	counts.imported += int64(saved)
+	counts.duplicates += int64(len(batch) - saved)
+	return nil
+}
+
+// commit adds counts to fc, moves it to offset and saves the checkpoint.
+func (r *run) commit(fc *FileCheckpoint, offset int64, counts batchCounts, done bool) error {
+	r.mu.Lock()
+	fc.Offset = offset
+	fc.Lines += counts.lines
+	fc.Imported += counts.imported
+	fc.Duplicates += counts.duplicates
+	fc.Invalid += counts.invalid
+	fc.Done = done
+	r.bytes += counts.bytes
+	r.imported += counts.imported
+	r.checkpoint.UpdatedAt = r.m.Clock().Now()
+	cp := r.checkpoint
+	cp.Files = append([]FileCheckpoint(nil), r.checkpoint.Files...)
+	r.mu.Unlock()
+
+	r.progress.Add(counts.bytes)
+	return r.m.checkpoints.Save(cp)
+}
+
+func (r *run) sample(line InvalidLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.samples) < maxInvalidSamples {
+		r.samples = append(r.samples, line)
+	}
+}
+
+// parseMessage validates one NDJSON line. Messages without an ID get one
+// derived from their position, so importing the line again yields the same
+// ID.
+func parseMessage(line []byte, file string, offset int64) (models.Message, error) {
+	var msg models.Message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return models.Message{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+	msg.PhoneNumber = strings.TrimSpace(msg.PhoneNumber)
+	if msg.PhoneNumber == "" {
+		return models.Message{}, errors.New("phoneNumber is required")
+	}
+	if msg.CreatedAt.IsZero() {
+		return models.Message{}, errors.New("createdAt is required")
+	}
+	msg.SenderType = models.ClassifySender(msg.PhoneNumber)
+	if msg.Provider != nil && strings.TrimSpace(msg.Provider.Name) == "" {
+		return models.Message{}, errors.New("provider.name is required")
+	}
+	refs, err := models.NormalizeExternalRefs(msg.ExternalRefs)
+	if err != nil {
+		return models.Message{}, err
+	}
+	msg.ExternalRefs = refs
+	if msg.ID == "" {
+		msg.ID = derivedID(file, offset)
+	}
+	if msg.AccountID == "" {
+		msg.AccountID = models.DefaultAccountID
+	}
+	return msg, nil
+}
+
+// derivedID is the ID of a message without one, found at offset in file.
+func derivedID(file string, offset int64) string {
+	sum := sha256.Sum256([]byte(file + ":" + strconv.FormatInt(offset, 10)))
+	return "mig-" + hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestMigrateStampsAndChecksRegions(t *testing.T) {
+	dir := t.TempDir()
+	export := `{"id": "in1", "phoneNumber": "9876543210", "text": "hello", "status": "DELIVERED", "createdAt": "2023-04-01T10:00:00Z", "region": "eu"}` + "\n" +
+		`{"id": "eu1", "phoneNumber": "9876543211", "accountId": "acme", "text": "hello", "status": "DELIVERED", "createdAt": "2023-04-01T10:01:00Z", "region": "in"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "export.ndjson"), []byte(export), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The store is shared with a deployment serving eu, whose messages a
+	// scoped count would refuse
+	inner := store.NewMemoryStore()
+	if _, err := inner.Save(models.Message{ID: "old-eu", PhoneNumber: "9876543212", AccountID: "acme", Region: "eu", Status: "SUCCESS", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	residency := store.Residency{Allowed: []string{"in"}, DefaultRegion: "in", Accounts: map[string]string{"acme": "eu"}}
+	s := store.NewRegionScopedStore(inner, residency)
+
+	result, err := NewMigrator(s, NewMemoryCheckpointStore()).Run(context.Background(), NewDirSource(dir, FormatNDJSON), Options{}, nopProgress{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Imported != 1 || result.Duplicates != 1 || !result.Verification.Verified {
+		t.Fatalf("result = %+v, want 1 imported, 1 skipped and verified", result)
+	}
+
+	// The region is the account's, whatever the export claims
+	if msg, err := inner.FindByID("in1"); err != nil || msg.Region != "in" {
+		t.Fatalf("in1 = %+v, %v; want it stored in region in", msg, err)
+	}
+	if _, err := inner.FindByID("eu1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("eu1 of a region not served was stored: err = %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package migrate
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sms-store/internal/clock"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body, which every request an
+// S3Source sends has.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config locates S3 and holds the credentials an S3Source signs its
+// requests with. There is no AWS SDK in this module, so credentials come
+// from the config alone, not from instance roles or profiles.
+type S3Config struct {
+	Region          string // Such as ap-south-1
+	Endpoint        string // Base URL of an S3-compatible service, addressed path-style; empty for AWS
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string       // For temporary credentials
+	HTTPClient      *http.Client // Defaults to http.DefaultClient
+}
+
+// S3Source reads the objects of one format under a prefix of an S3 bucket,
+// in key order. Each object is a file, which Open reads from an offset with
+// a ranged GET.
+type S3Source struct {
+	clock.Clocked // Dates the request signatures
+
+	config S3Config
+	bucket string
+	prefix string
+	format Format
+}
+
+// NewS3Source creates a source over the objects of format under prefix.
+func NewS3Source(config S3Config, bucket, prefix string, format Format) *S3Source {
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &S3Source{config: config, bucket: bucket, prefix: prefix, format: format}
+}
+
+// ParseS3URL splits an s3://bucket/prefix URL into its bucket and key
+// prefix, which may be empty.
+func ParseS3URL(raw string) (bucket, prefix string, err error) {
+	rest, ok := strings.CutPrefix(raw, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("S3 URL %q must start with s3://", raw)
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("S3 URL %q has no bucket", raw)
+	}
+	return bucket, prefix, nil
+}
+
+func (s *S3Source) Name() string {
+	name := "s3://" + s.bucket + "/" + s.prefix
+	if s.format != FormatNDJSON {
+		name += "?format=" + string(s.format)
+	}
+	return name
+}
+
+func (s *S3Source) Format() Format {
+	return s.format
+}
+
+// listObjectsResult is the part of a ListObjectsV2 response Files reads.
+type listObjectsResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// Files lists the objects under the prefix with the format's extension,
+// following ListObjectsV2 continuation tokens, sorted by key.
+func (s *S3Source) Files() ([]File, error) {
+	files := make([]File, 0)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do("", query, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list migration source: %w", err)
+		}
+		var result listObjectsResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list migration source: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			if strings.HasSuffix(strings.ToLower(obj.Key), s.format.extension()) {
+				files = append(files, File{Name: obj.Key, Size: obj.Size})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Open reads the object name from offset. An offset at or past its end
+// reads nothing.
+func (s *S3Source) Open(name string, offset int64) (io.ReadCloser, error) {
+	rangeHeader := ""
+	if offset > 0 {
+		rangeHeader = "bytes=" + strconv.FormatInt(offset, 10) + "-"
+	}
+	resp, err := s.do(name, nil, rangeHeader)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+
+	// A service that ignores Range sends the whole object
+	if offset > 0 && resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to seek %s to %d: %w", name, offset, err)
+		}
+	}
+	return resp.Body, nil
+}
+
+// errRangeNotSatisfiable is returned by do for a range past the object's end.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// s3Error is the body of an S3 error response.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed GET of key, or of the bucket when key is empty, and
+// returns the response of a 2xx status.
+func (s *S3Source) do(key string, query url.Values, rangeHeader string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key, query), nil)
+	if err != nil {
+		return nil, err
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	s.sign(req, s.Clock().Now())
+
+	resp, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return nil, errRangeNotSatisfiable
+	}
+	var e s3Error
+	if body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); xml.Unmarshal(body, &e) != nil || e.Code == "" {
+		return nil, fmt.Errorf("S3 answered %s", resp.Status)
+	}
+	return nil, fmt.Errorf("S3 answered %s: %s: %s", resp.Status, e.Code, e.Message)
+}
+
+// objectURL is the URL of key, or of the bucket when key is empty:
+// virtual-hosted on AWS, path-style on a configured endpoint.
+func (s *S3Source) objectURL(key string, query url.Values) string {
+	base := "https://" + s.bucket + ".s3." + s.config.Region + ".amazonaws.com"
+	if s.config.Endpoint != "" {
+		base = s.config.Endpoint + "/" + uriEncode(s.bucket, true)
+	}
+	u := base + "/" + uriEncode(key, false)
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	return u
+}
+
+// sign adds AWS Signature Version 4 headers to req, a request with an
+// empty body, as of now.
+func (s *S3Source) sign(req *http.Request, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+
+	// Every header set here is signed, along with the host
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	for _, part := range []string{s.config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.config.AccessKeyID+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by name, as Signature Version 4
+// signs it and as requests send it.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return uriEncode(names[i], true) < uriEncode(names[j], true) })
+
+	pairs := make([]string, 0, len(query))
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters,
+// and slashes unless encodeSlash is set, as Signature Version 4 requires.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
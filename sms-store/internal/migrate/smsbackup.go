@@ -0,0 +1,336 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+
+	"sms-store/internal/models"
+)
+
+// backupSMS is an <sms> element of an SMS Backup & Restore export.
+type backupSMS struct {
+	Address string `xml:"address,attr"`
+	Date    string `xml:"date,attr"` // Milliseconds since the epoch
+	Type    string `xml:"type,attr"` // 1 received, 2 sent, 3 draft, 4 outbox, 5 failed, 6 queued
+	Body    string `xml:"body,attr"`
+}
+
+// backupMMS is an <mms> element of an SMS Backup & Restore export. Its
+// text and attachments are parts; addresses of a group MMS are joined by ~.
+type backupMMS struct {
+	Address string `xml:"address,attr"`
+	Date    string `xml:"date,attr"`    // Milliseconds since the epoch
+	MsgBox  string `xml:"msg_box,attr"` // 1 received, 2 sent, 3 draft, 4 outbox
+	Parts   []struct {
+		ContentType string `xml:"ct,attr"`
+		Name        string `xml:"name,attr"`
+		Location    string `xml:"cl,attr"`
+		Text        string `xml:"text,attr"`
+	} `xml:"parts>part"`
+}
+
+// backupTypes maps the message types of an export to a direction and
+// status. Drafts were never sent and aren't imported.
+var backupTypes = map[string]struct{ direction, status string }{
+	"1": {models.DirectionInbound, "received"},
+	"2": {models.DirectionOutbound, "sent"},
+	"4": {models.DirectionOutbound, "pending"},
+	"5": {models.DirectionOutbound, "failed"},
+	"6": {models.DirectionOutbound, "queued"},
+}
+
+// migrateXMLFile reads fc's SMS Backup & Restore file. XML can't be entered
+// mid-document, so the file is always parsed from the start and the
+// checkpointed offset, in decoded bytes, marks the elements to skip.
+// Malformed elements are skipped; malformed XML ends the file, keeping the
+// messages before it.
+func (r *run) migrateXMLFile(ctx context.Context, fc *FileCheckpoint) error {
+	r.mu.Lock()
+	name, done := fc.Name, fc.Offset
+	r.mu.Unlock()
+
+	in, err := r.src.Open(name, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	raw := &countingReader{r: in}
+	dec := newBackupDecoder(raw)
+
+	checkExisting := r.resuming
+
+	batch := make([]models.Message, 0, r.opts.BatchSize)
+	var pending batchCounts
+	var element, reported int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		start := dec.InputOffset()
+		line, _ := dec.InputPos()
+		tok, err := dec.Token()
+		eof := errors.Is(err, io.EOF)
+		if se, ok := tok.(xml.StartElement); ok && err == nil && (se.Name.Local == "sms" || se.Name.Local == "mms") {
+			element++
+			var msg models.Message
+			msg, err = decodeBackupElement(dec, se, name, start)
+			var invalid *invalidElement
+			switch {
+			case errors.As(err, &invalid):
+				err = nil
+				if dec.InputOffset() > done {
+					pending.lines++
+					pending.invalid++
+					r.sample(InvalidLine{File: name, Offset: start, Line: int64(line), Element: element, Error: invalid.reason})
+				}
+			case err != nil:
+			case dec.InputOffset() <= done:
+				// Written, and counted, by an earlier run
+				reported = raw.n
+			default:
+				pending.lines++
+				batch = append(batch, msg)
+			}
+		}
+		if err != nil && !eof {
+			if raw.err != nil && !errors.Is(raw.err, io.EOF) {
+				return fmt.Errorf("failed to read %s: %w", name, raw.err)
+			}
+			pending.lines++
+			pending.invalid++
+			invalid := InvalidLine{File: name, Offset: start, Line: int64(line), Element: element + 1, Error: "malformed XML: " + err.Error()}
+			if syntax, ok := err.(*xml.SyntaxError); ok {
+				invalid.Line, invalid.Error = int64(syntax.Line), "malformed XML: "+syntax.Msg
+			}
+			r.sample(invalid)
+			eof = true
+		}
+
+		if len(batch) >= r.opts.BatchSize || eof {
+			if err := r.writeBatch(batch, checkExisting, &pending); err != nil {
+				return err
+			}
+			checkExisting = false
+			pending.bytes = raw.n - reported
+			reported = raw.n
+			if err := r.commit(fc, max(dec.InputOffset(), done), pending, eof); err != nil {
+				return err
+			}
+			batch = batch[:0]
+			pending = batchCounts{}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+// invalidElement describes a well-formed element that isn't a message that
+// can be imported.
+type invalidElement struct {
+	reason string
+}
+
+func (e *invalidElement) Error() string {
+	return e.reason
+}
+
+func invalidf(format string, args ...any) error {
+	return &invalidElement{reason: fmt.Sprintf(format, args...)}
+}
+
+// decodeBackupElement reads the <sms> or <mms> element opened by se. An
+// *invalidElement describes an element that can't be imported; other errors
+// mean the document can't be read any further.
+func decodeBackupElement(dec *xml.Decoder, se xml.StartElement, file string, offset int64) (models.Message, error) {
+	var address, date, kind, text string
+	if se.Name.Local == "sms" {
+		var sms backupSMS
+		if err := dec.DecodeElement(&sms, &se); err != nil {
+			return models.Message{}, err
+		}
+		address, date, kind, text = sms.Address, sms.Date, sms.Type, sms.Body
+	} else {
+		var mms backupMMS
+		if err := dec.DecodeElement(&mms, &se); err != nil {
+			return models.Message{}, err
+		}
+		address, date, kind = mms.Address, mms.Date, mms.MsgBox
+
+		// Attachments aren't stored, so each is noted in the text in its place
+		var lines []string
+		for _, part := range mms.Parts {
+			switch part.ContentType {
+			case "application/smil":
+				// Layout only
+			case "text/plain":
+				if part.Text != "" && part.Text != "null" {
+					lines = append(lines, part.Text)
+				}
+			default:
+				note := "[MMS attachment: " + part.ContentType
+				if n := attachmentName(part.Name, part.Location); n != "" {
+					note += " " + n
+				}
+				lines = append(lines, note+"]")
+			}
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "[MMS attachment]")
+		}
+		text = strings.Join(lines, "\n")
+	}
+
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return models.Message{}, invalidf("address is required")
+	}
+	if n := strings.Count(address, "~"); n > 0 {
+		return models.Message{}, invalidf("group MMS with %d addresses is not imported", n+1)
+	}
+	ms, err := strconv.ParseInt(strings.TrimSpace(date), 10, 64)
+	if err != nil || ms <= 0 {
+		return models.Message{}, invalidf("date must be milliseconds since the epoch, got %q", date)
+	}
+	if kind == "3" {
+		return models.Message{}, invalidf("drafts are not imported")
+	}
+	t, ok := backupTypes[kind]
+	if !ok {
+		return models.Message{}, invalidf("unknown message type %q", kind)
+	}
+
+	msg := models.Message{
+		ID:          derivedID(file, offset),
+		PhoneNumber: address,
+		SenderType:  models.ClassifySender(address),
+		Text:        text,
+		Status:      t.status,
+		CreatedAt:   time.UnixMilli(ms).UTC(),
+		AccountID:   models.DefaultAccountID,
+	}
+	if t.direction == models.DirectionInbound {
+		msg.Direction = t.direction
+	}
+	return msg, nil
+}
+
+// attachmentName picks the file name of an MMS part; exports write "null"
+// for missing attributes.
+func attachmentName(names ...string) string {
+	for _, n := range names {
+		if n != "" && n != "null" {
+			return n
+		}
+	}
+	return ""
+}
+
+// newBackupDecoder creates a decoder for an export. A byte order mark
+// switches to UTF-8 or UTF-16, and the encoding of the XML declaration is
+// honored otherwise. Exports write emoji as pairs of UTF-16 surrogate
+// references, which the decoder would replace with U+FFFD, so they are
+// joined first.
+func newBackupDecoder(in io.Reader) *xml.Decoder {
+	bom := transform.NewReader(in, unicode.BOMOverride(transform.Nop))
+	dec := xml.NewDecoder(&surrogateReader{r: bufio.NewReader(bom)})
+	dec.Strict = false
+	dec.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if strings.HasPrefix(strings.ToLower(label), "utf-16") {
+			return input, nil // Decoded by its byte order mark
+		}
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported encoding %q", label)
+		}
+		return enc.NewDecoder().Reader(input), nil
+	}
+	return dec
+}
+
+// surrogatePair matches the characters after the & of a pair of numeric
+// character references.
+var surrogatePair = regexp.MustCompile(`^#(x[0-9a-fA-F]{1,6}|[0-9]{1,7});&#(x[0-9a-fA-F]{1,6}|[0-9]{1,7});`)
+
+// maxSurrogatePair is the longest surrogatePair match without leading zeros.
+const maxSurrogatePair = len("#x0000;&#x0000;")
+
+// surrogateReader rewrites pairs of references to UTF-16 surrogates, such
+// as &#55357;&#56832;, into one reference to the character they encode.
+type surrogateReader struct {
+	r       *bufio.Reader
+	pending []byte
+	err     error
+}
+
+func (s *surrogateReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		chunk, err := s.r.ReadSlice('&')
+		s.pending = append(s.pending[:0], chunk...)
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+		case err != nil:
+			s.err = err
+		default:
+			ahead, _ := s.r.Peek(maxSurrogatePair)
+			if m := surrogatePair.FindSubmatch(ahead); m != nil {
+				if c := utf16.DecodeRune(charRef(m[1]), charRef(m[2])); c != utf8.RuneError {
+					s.pending = append(s.pending, "#"+strconv.Itoa(int(c))+";"...)
+					s.r.Discard(len(m[0]))
+				}
+			}
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// charRef returns the code point of a decimal or x-prefixed hex reference.
+func charRef(ref []byte) rune {
+	s, base := string(ref), 10
+	if strings.HasPrefix(s, "x") {
+		s, base = s[1:], 16
+	}
+	n, err := strconv.ParseInt(s, base, 32)
+	if err != nil {
+		return utf8.RuneError
+	}
+	return rune(n)
+}
+
+// countingReader counts the bytes read through it and keeps the last error,
+// telling a failing file apart from malformed XML.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// decodeFixture decodes every <sms> and <mms> element of the sample
+// export, giving the message or the reason it is skipped of each.
+func decodeFixture(t *testing.T) ([]models.Message, []string) {
+	t.Helper()
+	f, err := os.Open("testdata/sms-backup.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	dec := newBackupDecoder(f)
+	var msgs []models.Message
+	var skipped []string
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return msgs, skipped
+		}
+		if err != nil {
+			t.Fatalf("reading the fixture: %v", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || (se.Name.Local != "sms" && se.Name.Local != "mms") {
+			continue
+		}
+		msg, err := decodeBackupElement(dec, se, "sms-backup.xml", start)
+		var invalid *invalidElement
+		switch {
+		case errors.As(err, &invalid):
+			skipped = append(skipped, invalid.reason)
+		case err != nil:
+			t.Fatalf("decoding <%s>: %v", se.Name.Local, err)
+		default:
+			msgs = append(msgs, msg)
+		}
+	}
+}
+
+func TestDecodeBackupMMS(t *testing.T) {
+	msgs, skipped := decodeFixture(t)
+	if len(msgs) != 5 {
+		t.Fatalf("decoded %d messages, want 5", len(msgs))
+	}
+
+	// Attachments are noted in the text in their place, the layout left out
+	received, sent := msgs[3], msgs[4]
+	if received.Text != "[MMS attachment: image/jpeg IMG_2041.jpg]\nPackage arrived damaged" {
+		t.Errorf("received MMS text = %q", received.Text)
+	}
+	if received.PhoneNumber != "+919876543210" || received.Direction != models.DirectionInbound || received.Status != "received" ||
+		!received.CreatedAt.Equal(time.UnixMilli(1710318600000)) {
+		t.Errorf("received MMS = %+v", received)
+	}
+	if sent.Text != "[MMS attachment: video/mp4 VID_0091.mp4]" || sent.Direction != "" || sent.Status != "sent" {
+		t.Errorf("sent MMS = %+v, want the video noted as an outbound message", sent)
+	}
+	if received.ID == sent.ID || received.ID == "" {
+		t.Errorf("MMS IDs %q and %q, want distinct ones derived from their offsets", received.ID, sent.ID)
+	}
+
+	// Surrogate pairs decode to the emoji
+	if msgs[1].Text != "Yes, it left the warehouse today 🚚" {
+		t.Errorf("emoji text = %q", msgs[1].Text)
+	}
+	want := []string{
+		"drafts are not imported",
+		`date must be milliseconds since the epoch, got "yesterday"`,
+		"address is required",
+		"group MMS with 2 addresses is not imported",
+	}
+	if !slices.Equal(skipped, want) {
+		t.Errorf("skipped %q, want %q", skipped, want)
+	}
+}
+
+func TestMigrateSMSBackupImportsMMS(t *testing.T) {
+	s := store.NewMemoryStore()
+	result, err := NewMigrator(s, NewMemoryCheckpointStore()).Run(context.Background(), NewDirSource("testdata", FormatSMSBackupXML), Options{}, nopProgress{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Imported != 5 || result.Invalid != 4 || !result.Verification.Verified {
+		t.Fatalf("result = %+v, want 5 imported and 4 invalid", result)
+	}
+	stored, err := s.FindByPhoneNumber("+919876543210")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mms := 0
+	for _, msg := range stored {
+		if strings.HasPrefix(msg.Text, "[MMS attachment") {
+			mms++
+		}
+	}
+	if len(stored) != 5 || mms != 2 {
+		t.Fatalf("stored %d messages with %d MMS attachments, want 5 with 2", len(stored), mms)
+	}
+}
@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Format is the file format of a source.
+type Format string
+
+const (
+	// FormatNDJSON files hold one message per line in the GET /messages format.
+	FormatNDJSON Format = "ndjson"
+
+	// FormatSMSBackupXML files are exports of the Android app SMS Backup &
+	// Restore: one <smses> document of <sms> and <mms> elements.
+	FormatSMSBackupXML Format = "sms-backup-xml"
+)
+
+// ParseFormat parses the name of a format; empty means FormatNDJSON.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case "":
+		return FormatNDJSON, nil
+	case FormatNDJSON, FormatSMSBackupXML:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown migration format %q", name)
+	}
+}
+
+// extension is the suffix of the files a directory source of format f reads.
+func (f Format) extension() string {
+	if f == FormatSMSBackupXML {
+		return ".xml"
+	}
+	return ".ndjson"
+}
+
+// Source is a set of files holding messages. Each file is a partition: it
+// is read by one worker, front to back, so a checkpoint only needs its
+// byte offset.
+type Source interface {
+	// Name identifies the source across restarts; checkpoints are keyed by it.
+	Name() string
+
+	// Format is the format of every file of the source.
+	Format() Format
+
+	// Files lists the files of the source, in the order they are read.
+	Files() ([]File, error)
+
+	// Open opens a file positioned offset bytes in.
+	Open(name string, offset int64) (io.ReadCloser, error)
+}
+
+// File is one partition of a source.
+type File struct {
+	Name string
+	Size int64
+}
+
+// DirSource reads the files of one format in a directory on disk: *.ndjson
+// or *.xml.
+type DirSource struct {
+	dir    string
+	format Format
+}
+
+// NewDirSource creates a source over the files of format in dir.
+func NewDirSource(dir string, format Format) *DirSource {
+	return &DirSource{dir: filepath.Clean(dir), format: format}
+}
+
+func (s *DirSource) Name() string {
+	if s.format == FormatNDJSON {
+		return "dir:" + s.dir
+	}
+	return "dir:" + s.dir + "?format=" + string(s.format)
+}
+
+func (s *DirSource) Format() Format {
+	return s.format
+}
+
+func (s *DirSource) Files() ([]File, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration source: %w", err)
+	}
+
+	files := make([]File, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), s.format.extension()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+		files = append(files, File{Name: entry.Name(), Size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (s *DirSource) Open(name string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, filepath.Base(name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek %s to %d: %w", name, offset, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Annotation is a label a classifier, or another automated source, gave a
+// message, such as "complaint" or "refund-request".
+type Annotation struct {
+	Source     string            `json:"source" bson:"source"`                     // Classifier that set it; a message has at most one annotation per source
+	Label      string            `json:"label" bson:"label"`                       // Lowercase letters, digits, '-' and '_'
+	Confidence float64           `json:"confidence" bson:"confidence"`             // From 0 to 1
+	CreatedAt  time.Time         `json:"createdAt" bson:"createdAt"`               // When the source last set it
+	Review     *AnnotationReview `json:"review,omitempty" bson:"review,omitempty"` // Nil until a person reviews it; the source setting it again clears it
+}
+
+// AnnotationReview is a person's decision on whether an annotation is right.
+type AnnotationReview struct {
+	Reviewer   string    `json:"reviewer" bson:"reviewer"`
+	Decision   string    `json:"decision" bson:"decision"` // AnnotationConfirmed or AnnotationRejected
+	Note       string    `json:"note,omitempty" bson:"note,omitempty"`
+	ReviewedAt time.Time `json:"reviewedAt" bson:"reviewedAt"`
+}
+
+// Review decisions.
+const (
+	AnnotationConfirmed = "confirmed"
+	AnnotationRejected  = "rejected"
+)
+
+// Rejected reports whether a reviewer rejected the annotation.
+func (a Annotation) Rejected() bool {
+	return a.Review != nil && a.Review.Decision == AnnotationRejected
+}
+
+// HasAnnotation reports whether m has an annotation labelled label with a
+// confidence of at least minConfidence that no reviewer rejected.
+func (m Message) HasAnnotation(label string, minConfidence float64) bool {
+	for _, a := range m.Annotations {
+		if a.Label == label && a.Confidence >= minConfidence && !a.Rejected() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of a custom attribute.
+const (
+	AttributeString = "string"
+	AttributeNumber = "number"
+	AttributeBool   = "bool"
+	AttributeEnum   = "enum"
+)
+
+// MaxAttributeDefinitions is the most attributes an account's schema defines.
+const MaxAttributeDefinitions = 50
+
+// attributeName is the form of an attribute name: it becomes part of a
+// MongoDB field path, so dots and dollar signs are out.
+var attributeName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// AttributeDefinition describes one custom attribute conversations of an
+// account may carry.
+type AttributeDefinition struct {
+	Name     string   `json:"name" bson:"name"`
+	Type     string   `json:"type" bson:"type"`                             // One of the Attribute* types
+	Required bool     `json:"required,omitempty" bson:"required,omitempty"` // Writes must leave the attribute set
+	Values   []string `json:"values,omitempty" bson:"values,omitempty"`     // Allowed values of an enum
+	Indexed  bool     `json:"indexed,omitempty" bson:"indexed,omitempty"`   // Filtered on often enough to be indexed
+}
+
+// AttributeSchema is the set of custom attributes an account's
+// conversations may carry. An account without one has an empty schema.
+type AttributeSchema struct {
+	AccountID  string                `json:"accountId" bson:"_id"`
+	Attributes []AttributeDefinition `json:"attributes" bson:"attributes"`
+	UpdatedAt  time.Time             `json:"updatedAt" bson:"updatedAt"`
+}
+
+// NormalizeAttributeDefinitions trims defs and checks that each has a valid
+// name, used once, and type, and that enums, and only enums, list their
+// values.
+func NormalizeAttributeDefinitions(defs []AttributeDefinition) ([]AttributeDefinition, error) {
+	if len(defs) > MaxAttributeDefinitions {
+		return nil, fmt.Errorf("at most %d attributes are allowed", MaxAttributeDefinitions)
+	}
+
+	out := make([]AttributeDefinition, 0, len(defs))
+	for i, def := range defs {
+		def.Name = strings.TrimSpace(def.Name)
+		def.Type = strings.ToLower(strings.TrimSpace(def.Type))
+		switch {
+		case def.Name == "":
+			return nil, fmt.Errorf("attributes[%d].name is required", i)
+		case !attributeName.MatchString(def.Name):
+			return nil, fmt.Errorf("attributes[%d].name must be at most 64 letters, digits and underscores, starting with a letter", i)
+		case slices.ContainsFunc(out, func(d AttributeDefinition) bool { return d.Name == def.Name }):
+			return nil, fmt.Errorf("attribute %s is defined twice", def.Name)
+		}
+
+		switch def.Type {
+		case AttributeString, AttributeNumber, AttributeBool:
+			if len(def.Values) > 0 {
+				return nil, fmt.Errorf("attributes[%d].values are only allowed for enum attributes", i)
+			}
+		case AttributeEnum:
+			values := make([]string, 0, len(def.Values))
+			for _, v := range def.Values {
+				if v = strings.TrimSpace(v); v != "" && !slices.Contains(values, v) {
+					values = append(values, v)
+				}
+			}
+			if len(values) == 0 {
+				return nil, fmt.Errorf("attributes[%d].values is required", i)
+			}
+			def.Values = values
+		default:
+			return nil, fmt.Errorf("attributes[%d].type must be string, number, bool or enum", i)
+		}
+		out = append(out, def)
+	}
+	return out, nil
+}
+
+// Definition returns the definition of the attribute name.
+func (s AttributeSchema) Definition(name string) (AttributeDefinition, bool) {
+	i := slices.IndexFunc(s.Attributes, func(d AttributeDefinition) bool { return d.Name == name })
+	if i < 0 {
+		return AttributeDefinition{}, false
+	}
+	return s.Attributes[i], true
+}
+
+// Check returns value, as decoded from JSON, if it is of the attribute's
+// type, trimming strings. field names the value in the error.
+func (d AttributeDefinition) Check(field string, value any) (any, error) {
+	switch d.Type {
+	case AttributeNumber:
+		if n, ok := value.(float64); ok {
+			return n, nil
+		}
+	case AttributeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case AttributeString, AttributeEnum:
+		if s, ok := value.(string); ok {
+			s = strings.TrimSpace(s)
+			if d.Type == AttributeEnum && !slices.Contains(d.Values, s) {
+				return nil, fmt.Errorf("%s must be one of %s", field, strings.Join(d.Values, ", "))
+			}
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be a %s", field, d.Type)
+}
+
+// ParseValue parses value, as given in a query string, as the attribute's
+// type. field names the value in the error. Any string is an enum value
+// here, so values the schema has since dropped can still be looked up.
+func (d AttributeDefinition) ParseValue(field, value string) (any, error) {
+	switch d.Type {
+	case AttributeNumber:
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", field)
+		}
+		return n, nil
+	case AttributeBool:
+		switch strings.TrimSpace(value) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%s must be a bool", field)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// ErrUnknownAttribute is wrapped by the errors of values for attributes the
+// schema doesn't define.
+var ErrUnknownAttribute = errors.New("unknown attribute")
+
+// ApplyAttributes checks patch against the schema and returns the
+// attributes to set, and those to remove, for a JSON null, on a
+// conversation whose attributes are stored. Only the attributes written
+// are checked, so stored values the schema has since stopped allowing are
+// kept as they are; but every required attribute must be set once the
+// patch is applied, including ones that became required later.
+func (s AttributeSchema) ApplyAttributes(stored, patch map[string]any) (map[string]any, []string, error) {
+	set := make(map[string]any)
+	var unset []string
+	for _, name := range slices.Sorted(maps.Keys(patch)) {
+		field := "customAttributes." + name
+		value := patch[name]
+		if value == nil {
+			if _, ok := stored[name]; ok {
+				unset = append(unset, name)
+			}
+			continue
+		}
+		def, ok := s.Definition(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w %s", ErrUnknownAttribute, name)
+		}
+		checked, err := def.Check(field, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		set[name] = checked
+	}
+
+	for _, def := range s.Attributes {
+		if !def.Required {
+			continue
+		}
+		_, stays := stored[def.Name]
+		if _, ok := set[def.Name]; !ok && (!stays || slices.Contains(unset, def.Name)) {
+			return nil, nil, fmt.Errorf("customAttributes.%s is required", def.Name)
+		}
+	}
+	return set, unset, nil
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// AuditEntry records one change made to the data, by whom and when.
+type AuditEntry struct {
+	ID          string         `json:"id" bson:"_id"`
+	At          time.Time      `json:"at" bson:"at"`
+	AccountID   string         `json:"accountId" bson:"accountId"`
+	Actor       string         `json:"actor" bson:"actor"`                                 // Client IP of an API call, AuditActorKafka or AuditActorMQTT
+	Action      string         `json:"action" bson:"action"`                               // e.g. AuditConversationClosed
+	PhoneNumber string         `json:"phoneNumber,omitempty" bson:"phoneNumber,omitempty"` // Conversation the change was made to
+	Details     map[string]any `json:"details,omitempty" bson:"details,omitempty"`
+}
+
+// Actors of changes made by the event consumers or scheduled tasks rather
+// than an API call.
+const (
+	AuditActorKafka     = "kafka"     // The Kafka consumer
+	AuditActorMQTT      = "mqtt"      // The MQTT source
+	AuditActorScheduler = "scheduler" // A scheduled task
+)
+
+// Audit actions of conversation state transitions.
+const (
+	AuditConversationClosed   = "conversation.closed"
+	AuditConversationReopened = "conversation.reopened"
+	AuditConversationSnoozed  = "conversation.snoozed"
+)
+
+// AuditConsumerSeek is the audit action of a Kafka consumer seek.
+const AuditConsumerSeek = "consumer.seek"
+
+// AuditProfileMerged is the audit action of merging one number's profile
+// into another's.
+const AuditProfileMerged = "profile.merged"
+
+// AuditRegionOverride is the audit action of an admin request reading or
+// changing data outside the deployment's data residency regions.
+const AuditRegionOverride = "region.override"
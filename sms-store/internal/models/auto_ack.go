@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// DefaultAutoAckWindow is the window of an AutoAckConfig that doesn't set one.
+const DefaultAutoAckWindow = 24 * time.Hour
+
+// AutoAckConfig is an account's automatic acknowledgement of new
+// conversations: the first inbound message from a number that sent none
+// within the window is answered with the template TemplateID. An account
+// without one has acknowledgements disabled.
+type AutoAckConfig struct {
+	AccountID  string    `json:"accountId" bson:"_id"`
+	Enabled    bool      `json:"enabled" bson:"enabled"`
+	TemplateID string    `json:"templateId,omitempty" bson:"templateId,omitempty"`
+	Window     string    `json:"window" bson:"window"` // Duration, such as 24h, a number must be quiet for, and must go without an acknowledgement, to get one
+	UpdatedAt  time.Time `json:"updatedAt,omitzero" bson:"updatedAt"`
+}
+
+// WindowDuration returns the config's window, DefaultAutoAckWindow if it is
+// unset or invalid.
+func (c AutoAckConfig) WindowDuration() time.Duration {
+	if d, err := time.ParseDuration(c.Window); err == nil && d > 0 {
+		return d
+	}
+	return DefaultAutoAckWindow
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Conversation types.
+const (
+	ConversationDirect = "direct" // One phone number; the conversation ID is the number
+	ConversationGroup  = "group"  // Several participants sharing a conversation ID
+)
+
+// Conversation lifecycle states. A conversation is open until it is closed
+// or snoozed; a snoozed one opens again by itself once its snooze ends.
+const (
+	ConversationOpen    = "open"
+	ConversationClosed  = "closed"
+	ConversationSnoozed = "snoozed"
+)
+
+// Conversation is a group conversation: messages sent to several phone
+// numbers at once, stored with its ID in Message.ConversationID. Direct
+// conversations aren't stored; they are the messages of one phone number.
+type Conversation struct {
+	ID            string    `json:"conversationId" bson:"_id"`
+	Type          string    `json:"type" bson:"type"`
+	Participants  []string  `json:"participants" bson:"participants"` // Sorted phone numbers
+	AccountID     string    `json:"accountId,omitempty" bson:"accountId,omitempty"`
+	CreatedAt     time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt" bson:"updatedAt"`
+	LastMessageAt time.Time `json:"lastMessageAt" bson:"lastMessageAt"`
+}
+
+// ConversationKey returns the ID of the conversation msg belongs to: its
+// group conversation, or else its phone number.
+func (m Message) ConversationKey() string {
+	if m.ConversationID != "" {
+		return m.ConversationID
+	}
+	return m.PhoneNumber
+}
+
+// NormalizeParticipants trims participants and returns them sorted without
+// blanks or duplicates.
+func NormalizeParticipants(participants []string) []string {
+	out := make([]string, 0, len(participants))
+	for _, p := range participants {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// GroupConversationID derives a stable conversation ID from normalized
+// participants, so events naming the same group without an ID share one.
+func GroupConversationID(participants []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(participants, "\n")))
+	return "grp-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Operations of a DeletionReceipt.
+const (
+	DeletionConversation  = "conversation"   // A conversation's messages, live and archived
+	DeletionAllMessages   = "all_messages"   // Every message, as DELETE /messages clears them
+	DeletionSeed          = "seed"           // A seeded conversation with its profile, as DELETE /v1/admin/seed removes them
+	DeletionStaleProfiles = "stale_profiles" // Auto-created profiles of numbers gone quiet, as the profile cleanup removes them
+)
+
+// Collections counted in DeletionReceipt.Matched.
+const (
+	DeletedMessages         = "messages"
+	DeletedArchivedMessages = "archivedMessages"
+	DeletedSummaries        = "summaries"
+	DeletedProfiles         = "profiles"
+)
+
+// DeletionReceipt proves a delete happened: what was asked for, how many
+// documents it matched in each collection and a digest of the IDs of the
+// deleted messages, never their content. Receipts are only ever appended,
+// one per delete operation however many collections it spans, and written
+// even when it matched nothing.
+type DeletionReceipt struct {
+	ID          string           `json:"id" bson:"_id"`
+	At          time.Time        `json:"at" bson:"at"`
+	Operation   string           `json:"operation" bson:"operation"` // e.g. DeletionConversation
+	Request     string           `json:"request" bson:"request"`     // The call that asked for the delete, such as DELETE /v1/user/{phoneNumber}/messages
+	Actor       string           `json:"actor" bson:"actor"`         // Client IP of the API call, or AuditActorScheduler for a scheduled delete
+	AccountID   string           `json:"accountId" bson:"accountId"`
+	PhoneNumber string           `json:"phoneNumber,omitempty" bson:"phoneNumber,omitempty"` // Empty for deletes across conversations
+	Matched     map[string]int64 `json:"matched" bson:"matched"`                             // Documents deleted by collection, e.g. DeletedMessages
+	IDCount     int              `json:"idCount" bson:"idCount"`                             // Message IDs in IDDigest
+	IDDigest    string           `json:"idDigest,omitempty" bson:"idDigest,omitempty"`       // DeletionDigest of the deleted message IDs; empty when they weren't listed
+}
+
+// DeletionDigest returns the digest of a DeletionReceipt's IDs: the hex
+// SHA-256 of the IDs sorted and joined by newlines, prefixed "sha256:".
+// Anyone holding the IDs can recompute it; it reveals none of them.
+func DeletionDigest(ids []string) string {
+	sorted := slices.Sorted(slices.Values(ids))
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
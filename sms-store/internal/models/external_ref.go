@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ExternalRef names a record of another system that a message concerns,
+// such as {"type": "order", "id": "OD123"}, so its messages can be found
+// across conversations.
+type ExternalRef struct {
+	Type string `json:"type" bson:"type"`
+	ID   string `json:"id" bson:"id"`
+}
+
+func (r ExternalRef) String() string {
+	return r.Type + "/" + r.ID
+}
+
+// Limits of a message's external references.
+const (
+	MaxExternalRefs      = 10
+	maxExternalRefLength = 128 // Of a type or an ID
+)
+
+// NormalizeExternalRefs trims and de-duplicates refs, keeping their order.
+// It reports an error if a reference lacks a type or an ID, either is longer
+// than 128 characters, or there are more than MaxExternalRefs.
+func NormalizeExternalRefs(refs []ExternalRef) ([]ExternalRef, error) {
+	if len(refs) > MaxExternalRefs {
+		return nil, fmt.Errorf("at most %d externalRefs are allowed", MaxExternalRefs)
+	}
+
+	out := make([]ExternalRef, 0, len(refs))
+	for i, ref := range refs {
+		ref = ExternalRef{Type: strings.TrimSpace(ref.Type), ID: strings.TrimSpace(ref.ID)}
+		for _, f := range []struct{ name, value string }{{"type", ref.Type}, {"id", ref.ID}} {
+			switch {
+			case f.value == "":
+				return nil, fmt.Errorf("externalRefs[%d].%s is required", i, f.name)
+			case len([]rune(f.value)) > maxExternalRefLength:
+				return nil, fmt.Errorf("externalRefs[%d].%s must be at most %d characters", i, f.name, maxExternalRefLength)
+			}
+		}
+		if !slices.Contains(out, ref) {
+			out = append(out, ref)
+		}
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// GrowthSample is the size of the messages collection at one point in time.
+type GrowthSample struct {
+	At           time.Time `json:"at" bson:"at"`
+	Messages     int64     `json:"messages" bson:"messages"`         // Estimated document count
+	DataBytes    int64     `json:"dataBytes" bson:"dataBytes"`       // Uncompressed size of the documents
+	StorageBytes int64     `json:"storageBytes" bson:"storageBytes"` // Disk used by the documents
+	IndexBytes   int64     `json:"indexBytes" bson:"indexBytes"`     // Disk used by all indexes
+}
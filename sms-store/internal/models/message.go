@@ -1,12 +1,119 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Message struct {
-	ID             string    `json:"id" bson:"id"`
-	CorrelationID  string    `json:"correlationId" bson:"correlationId"`
-	PhoneNumber    string    `json:"phoneNumber" bson:"phoneNumber"`
-	Text           string    `json:"text" bson:"text"`
-	Status         string    `json:"status" bson:"status"`
-	CreatedAt      time.Time `json:"createdAt" bson:"createdAt"`
+	ID              string        `json:"id" bson:"id"`
+	CorrelationID   string        `json:"correlationId" bson:"correlationId"`
+	PhoneNumber     string        `json:"phoneNumber" bson:"phoneNumber"`
+	ConversationID  string        `json:"conversationId,omitempty" bson:"conversationId,omitempty"` // Group conversation; empty for a message to PhoneNumber alone
+	Text            string        `json:"text" bson:"text"`
+	Status          string        `json:"status" bson:"status"`
+	Direction       string        `json:"direction,omitempty" bson:"direction,omitempty"`   // DirectionInbound for messages received from PhoneNumber; empty means outbound
+	SenderType      string        `json:"senderType,omitempty" bson:"senderType,omitempty"` // ClassifySender of PhoneNumber, set as the message is ingested; empty for group messages
+	CreatedAt       time.Time     `json:"createdAt" bson:"createdAt"`                       // When the event source says the message was sent or received; conversations are ordered by it
+	ReceivedAt      time.Time     `json:"receivedAt,omitzero" bson:"receivedAt,omitempty"`  // When this service stored the message; zero for messages stored before it was recorded
+	Provider        *Provider     `json:"provider,omitempty" bson:"provider,omitempty"`
+	AccountID       string        `json:"accountId,omitempty" bson:"accountId,omitempty"`
+	Region          string        `json:"region,omitempty" bson:"region,omitempty"` // Data residency region of the account, stamped as the message is stored when residency is configured; empty for messages stored before
+	Cost            *Cost         `json:"cost,omitempty" bson:"cost,omitempty"`
+	ReplyToID       string        `json:"replyToId,omitempty" bson:"replyToId,omitempty"`             // Message in the same conversation this one answers
+	DuplicateOf     string        `json:"duplicateOf,omitempty" bson:"duplicateOf,omitempty"`         // Message whose text this one repeated shortly after; duplicates don't count towards the conversation summary
+	ForwardedFromID string        `json:"forwardedFromId,omitempty" bson:"forwardedFromId,omitempty"` // Message, possibly of another conversation, whose text this one forwards
+	ExternalRefs    []ExternalRef `json:"externalRefs,omitempty" bson:"externalRefs,omitempty"`       // Records of other systems the message concerns, such as an order; at most MaxExternalRefs
+	Language        *Language     `json:"language,omitempty" bson:"language,omitempty"`               // Detected from Text as the message is ingested, when detection is enabled
+	Participant     *Participant  `json:"participant,omitempty" bson:"participant,omitempty"`         // Who, of the people sharing PhoneNumber, the message is from or for; nil counts under DefaultParticipantID
+	Ingestion       *Ingestion    `json:"ingestion,omitempty" bson:"ingestion,omitempty"`             // When the Kafka event passed each stage of ingestion; nil for messages not consumed from Kafka
+	Seed            string        `json:"seed,omitempty" bson:"seed,omitempty"`                       // Seeding run that generated the message for a demo; only such messages are removed by DELETE /v1/admin/seed
+	SearchTokens    []string      `json:"-" bson:"searchTokens,omitempty"`                            // Word prefixes for prefix search, when it is enabled
+	EventKey        string        `json:"-" bson:"eventKey,omitempty"`                                // Event the message was consumed from, as topic/partition/offset for Kafka or source:topic/payload hash otherwise; a replayed event is stored once
+	Source          string        `json:"source,omitempty" bson:"source,omitempty"`                   // What wrote the message on the account's behalf, such as MessageSourceAutoAck; empty for messages from their sender or an operator
+
+	Reactions      []Reaction     `json:"-" bson:"reactions,omitempty"`                        // Oldest first, at most one per actor and emoji
+	ReactionCounts map[string]int `json:"reactions,omitempty" bson:"reactionCounts,omitempty"` // Reactions by emoji, kept with Reactions
+
+	Annotations []Annotation `json:"annotations,omitempty" bson:"annotations,omitempty"` // Labels set by classifiers, at most one per source, in the order the sources first set them
+
+	Translations         []Translation `json:"-" bson:"translations,omitempty"` // Text in other languages, at most one per language, in the order they were first set
+	IncludedTranslations []Translation `json:"translations,omitempty" bson:"-"` // The Translations a listing was asked to include, with ?includeTranslations=
+}
+
+// Message directions. Messages sent to their number leave Direction empty;
+// replies, from live events that say so or from imported history, are
+// inbound.
+const (
+	DirectionOutbound = "outbound"
+	DirectionInbound  = "inbound"
+)
+
+// MessageSourceAutoAck is the Source of the automatic acknowledgement sent
+// for the first inbound message of a conversation. Acknowledgements don't
+// count towards conversation summaries or unread counts.
+const MessageSourceAutoAck = "auto-ack"
+
+// DefaultMaxFutureSkew is how far past the server's clock a message's
+// CreatedAt may be by default. Clocks of event sources drift, but a message
+// days ahead would stay at the top of its conversation.
+const DefaultMaxFutureSkew = 7 * 24 * time.Hour
+
+// CheckCreatedAt reports an error if createdAt is more than maxFutureSkew
+// after now. A maxFutureSkew of zero or less accepts any time.
+func CheckCreatedAt(createdAt, now time.Time, maxFutureSkew time.Duration) error {
+	if maxFutureSkew > 0 && createdAt.After(now.Add(maxFutureSkew)) {
+		return fmt.Errorf("createdAt is more than %v in the future", maxFutureSkew)
+	}
+	return nil
+}
+
+// DefaultAccountID is the account of requests and messages that don't name one.
+const DefaultAccountID = "default"
+
+// Language is the language detected in a message's text.
+type Language struct {
+	Code       string  `json:"code" bson:"code"`             // BCP 47 tag, such as "hi" or "hi-Latn"; LanguageUndetermined below the confidence threshold
+	Confidence float64 `json:"confidence" bson:"confidence"` // From 0 to 1
+}
+
+// LanguageMatches reports whether code is tag or one of its subtags, as
+// "hi" matches "hi" and "hi-Latn": the basic filtering of RFC 4647.
+func LanguageMatches(code, tag string) bool {
+	if len(code) > len(tag) && code[len(tag)] == '-' {
+		code = code[:len(tag)]
+	}
+	return strings.EqualFold(code, tag)
+}
+
+// LanguageUndetermined is the code of text whose language wasn't detected
+// with enough confidence.
+const LanguageUndetermined = "und"
+
+// Ingestion is when the Kafka event a message was consumed from reached
+// each stage of ingestion. CreatedAt, set by the event source, comes
+// before all of them.
+type Ingestion struct {
+	BrokerAt   time.Time `json:"brokerAt,omitzero" bson:"brokerAt,omitempty"` // Timestamp of the Kafka record, the broker's append time unless the topic keeps the producer's; zero when the broker sends none
+	ConsumedAt time.Time `json:"consumedAt" bson:"consumedAt"`                // When the consumer read the record
+	StoredAt   time.Time `json:"storedAt" bson:"storedAt"`                    // When the batch holding the message was written, as ReceivedAt
+}
+
+// Provider is the upstream SMS provider's metadata for a message.
+// It is absent for messages that did not come through a provider.
+type Provider struct {
+	Name      string `json:"name" bson:"name"`
+	MessageID string `json:"messageId,omitempty" bson:"messageId,omitempty"`
+	SenderID  string `json:"senderId,omitempty" bson:"senderId,omitempty"` // Shortcode or sender ID the message was sent from
+	Carrier   string `json:"carrier,omitempty" bson:"carrier,omitempty"`
+}
+
+// Cost is the estimated cost of sending a message, fixed when it is stored.
+type Cost struct {
+	Segments      int     `json:"segments" bson:"segments"`
+	EstimatedCost float64 `json:"estimatedCost" bson:"estimatedCost"`
+	Currency      string  `json:"currency" bson:"currency"`
+	Prefix        string  `json:"prefix,omitempty" bson:"prefix,omitempty"`           // Pricing table prefix that matched
+	DefaultRate   bool    `json:"defaultRate,omitempty" bson:"defaultRate,omitempty"` // No prefix matched; the pricing table needs an entry
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Participant is who, of the people sharing one phone number, a message is
+// from or for, such as one member of a family on a family number.
+type Participant struct {
+	ID   string `json:"id" bson:"id"`                         // What the conversation's messages are filtered and counted by
+	Name string `json:"name,omitempty" bson:"name,omitempty"` // As the sender signed or was tagged
+}
+
+// DefaultParticipantID is the participant of messages without one.
+const DefaultParticipantID = "default"
+
+// maxParticipantLength bounds a participant's ID and name.
+const maxParticipantLength = 128
+
+// NewParticipant returns the participant with id and name, either of which
+// may be empty. Without an ID it is derived from the name by ParticipantSlug,
+// so "Priya S." is "priya-s". It returns nil when both are empty or the ID is
+// DefaultParticipantID, which messages without a participant are counted
+// under, and an error when either is longer than 128 characters or the name
+// has no letters or digits to derive an ID from.
+func NewParticipant(id, name string) (*Participant, error) {
+	id, name = strings.TrimSpace(id), strings.TrimSpace(name)
+	for _, f := range []struct{ name, value string }{{"participantId", id}, {"senderName", name}} {
+		if len([]rune(f.value)) > maxParticipantLength {
+			return nil, fmt.Errorf("%s must be at most %d characters", f.name, maxParticipantLength)
+		}
+	}
+	if id == "" && name == "" {
+		return nil, nil
+	}
+	if id == "" {
+		if id = ParticipantSlug(name); id == "" {
+			return nil, fmt.Errorf("senderName must contain a letter or digit")
+		}
+	}
+	if id == DefaultParticipantID {
+		return nil, nil
+	}
+	return &Participant{ID: id, Name: name}, nil
+}
+
+// ParticipantSlug lowercases name and joins its runs of letters and digits
+// with hyphens.
+func ParticipantSlug(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// ParticipantID returns the ID of the message's participant, or
+// DefaultParticipantID for a message without one.
+func (m Message) ParticipantID() string {
+	if m.Participant == nil {
+		return DefaultParticipantID
+	}
+	return m.Participant.ID
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ConversationPreferences holds an operator's display preferences for one
+// conversation. It is keyed by (AccountID, PhoneNumber) and never creates a
+// conversation on its own.
+type ConversationPreferences struct {
+	AccountID   string    `json:"accountId" bson:"accountId"`
+	PhoneNumber string    `json:"phoneNumber" bson:"phoneNumber"`
+	Color       string    `json:"color" bson:"color"`
+	Labels      []string  `json:"labels" bson:"labels"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
+}
@@ -7,7 +7,24 @@ import "time"
 type Profile struct {
 	PhoneNumber string    `json:"phoneNumber" bson:"phoneNumber"`
 	Name        string    `json:"name" bson:"name"`
-	Avatar      string    `json:"avatar" bson:"avatar"` // URL or base64 encoded image
+	Avatar      string    `json:"avatar" bson:"avatar"`                       // URL or base64 encoded image
+	Source      string    `json:"source,omitempty" bson:"source,omitempty"`   // ProfileSourceAuto for profiles the ingestion pipeline created; empty once edited
+	Version     int64     `json:"version" bson:"version"`                     // Counts creation and every update; 0 for a profile not changed since versions were introduced
+	MovedTo     string    `json:"movedTo,omitempty" bson:"movedTo,omitempty"` // Number whose profile this one was merged into; lookups of this number answer with that profile
+	Region      string    `json:"region,omitempty" bson:"region,omitempty"`   // Data residency region, stamped as the profile is created when residency is configured
 	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
 }
+
+// ProfileSourceAuto marks a profile created on a number's first message,
+// with the number as its name, rather than by a person.
+const ProfileSourceAuto = "auto"
+
+// ProfileSourceSeed marks a profile generated with demo data by
+// POST /v1/admin/seed.
+const ProfileSourceSeed = "seed"
+
+// SeedPhonePrefix starts the phone numbers of generated demo
+// conversations. Country code 999 is reserved and never assigned, so no
+// real number has it.
+const SeedPhonePrefix = "+999"
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Actions of a profile change.
+const (
+	ProfileCreated    = "created"
+	ProfileUpdated    = "updated"
+	ProfileRolledBack = "rolled_back"
+	ProfileMoved      = "moved" // Merged into the profile of another number
+)
+
+// ProfileValues are the fields of a profile a change can set.
+type ProfileValues struct {
+	Name    string `json:"name" bson:"name"`
+	Avatar  string `json:"avatar" bson:"avatar"`
+	Source  string `json:"source,omitempty" bson:"source,omitempty"`
+	MovedTo string `json:"movedTo,omitempty" bson:"movedTo,omitempty"`
+}
+
+// ValuesOf returns the values of p.
+func ValuesOf(p Profile) ProfileValues {
+	return ProfileValues{Name: p.Name, Avatar: p.Avatar, Source: p.Source, MovedTo: p.MovedTo}
+}
+
+// ProfileChange records one mutation of a profile in its history.
+type ProfileChange struct {
+	ID          string         `json:"id" bson:"_id"`
+	PhoneNumber string         `json:"phoneNumber" bson:"phoneNumber"`
+	Version     int64          `json:"version" bson:"version"` // Of the profile the change produced
+	Action      string         `json:"action" bson:"action"`   // ProfileCreated, ProfileUpdated, ProfileRolledBack or ProfileMoved
+	Actor       string         `json:"actor" bson:"actor"`     // Client IP of an API call, AuditActorKafka or AuditActorMQTT
+	At          time.Time      `json:"at" bson:"at"`
+	Previous    *ProfileValues `json:"previous,omitempty" bson:"previous,omitempty"` // Nil for a creation
+	Current     ProfileValues  `json:"current" bson:"current"`
+	RollbackOf  string         `json:"rollbackOf,omitempty" bson:"rollbackOf,omitempty"` // Change whose previous values a rollback restored
+	ExpiresAt   *time.Time     `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`   // Nil when history is kept forever
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RawEvent is the payload an event arrived with, kept for a short while
+// under the ID of the message made from it, to debug what became of it.
+type RawEvent struct {
+	MessageID       string    `json:"messageId" bson:"_id"`
+	Source          string    `json:"source" bson:"source"` // RawSourceKafka or RawSourceMQTT
+	Topic           string    `json:"topic,omitempty" bson:"topic,omitempty"`
+	Partition       int32     `json:"partition" bson:"partition"`
+	Offset          int64     `json:"offset" bson:"offset"`
+	ContentType     string    `json:"contentType" bson:"contentType"`
+	ContentEncoding string    `json:"contentEncoding" bson:"contentEncoding"` // Of Payload as stored, e.g. "gzip"
+	Size            int       `json:"size" bson:"size"`                       // Of the payload as it arrived
+	Truncated       bool      `json:"truncated,omitempty" bson:"truncated,omitempty"`
+	Payload         []byte    `json:"-" bson:"payload"`
+	CapturedAt      time.Time `json:"capturedAt" bson:"capturedAt"`
+	ExpiresAt       time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// Sources of raw payloads.
+const (
+	RawSourceKafka = "kafka" // Consumed from Kafka
+	RawSourceMQTT  = "mqtt"  // Received from an MQTT broker
+)
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Reaction is an emoji an actor tagged a message with.
+type Reaction struct {
+	Emoji     string    `json:"emoji" bson:"emoji"` // A single grapheme cluster, e.g. "👍"
+	Actor     string    `json:"actor" bson:"actor"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
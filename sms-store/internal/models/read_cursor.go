@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ReadCursor marks how far an operator has read one conversation. It is
+// keyed by (AccountID, PhoneNumber), like ConversationPreferences, so every
+// device of the account shares it. Messages created after LastReadMessageAt
+// are unread.
+type ReadCursor struct {
+	AccountID         string    `json:"accountId" bson:"accountId"`
+	PhoneNumber       string    `json:"phoneNumber" bson:"phoneNumber"`
+	LastReadMessageAt time.Time `json:"lastReadMessageAt" bson:"lastReadMessageAt"`
+	UpdatedAt         time.Time `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "strings"
+
+// Sender types of direct conversations, by the form of their phone number.
+// Messages from businesses often come from a shortcode or an alphanumeric
+// sender ID such as "VM-MEESHO" rather than a phone number.
+const (
+	SenderPhoneNumber  = "phone_number"
+	SenderShortcode    = "shortcode"
+	SenderAlphanumeric = "alphanumeric"
+)
+
+// maxShortcodeDigits is the most digits of a shortcode; longer numbers are
+// phone numbers.
+const maxShortcodeDigits = 6
+
+// ClassifySender returns the sender type of a conversation's phone number:
+// a phone number if it is digits with an optional leading "+" and more than
+// maxShortcodeDigits of them (or any number of them after a "+"), a
+// shortcode if it is fewer digits, and an alphanumeric sender ID otherwise.
+// Spaces, dashes, dots and parentheses between digits are ignored. An empty
+// number has no sender type.
+func ClassifySender(phoneNumber string) string {
+	phoneNumber = strings.TrimSpace(phoneNumber)
+	if phoneNumber == "" {
+		return ""
+	}
+	rest, international := strings.CutPrefix(phoneNumber, "+")
+
+	digits := 0
+	for _, r := range rest {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune(" -.()", r):
+		default:
+			return SenderAlphanumeric
+		}
+	}
+	switch {
+	case digits == 0:
+		return SenderAlphanumeric
+	case international || digits > maxShortcodeDigits:
+		return SenderPhoneNumber
+	default:
+		return SenderShortcode
+	}
+}
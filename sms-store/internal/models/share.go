@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Share is a read-only link to one conversation for someone without an API
+// key: whoever holds its token can page through the messages of
+// PhoneNumber until ExpiresAt, or until the share is revoked. Only a hash
+// of the token's secret is stored, so the token is shown once, when the
+// share is created.
+type Share struct {
+	ID          string    `json:"id" bson:"_id"`
+	AccountID   string    `json:"accountId" bson:"accountId"`
+	PhoneNumber string    `json:"phoneNumber" bson:"phoneNumber"`
+	SecretHash  string    `json:"-" bson:"secretHash"`        // Hex SHA-256 of the token's secret
+	CreatedBy   string    `json:"createdBy" bson:"createdBy"` // Client IP of the request that created it
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt" bson:"expiresAt"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// ConversationSnapshot is a compact record of one conversation at a point
+// in time, to compare with a later one when messages are reported missing
+// or changed. It keeps a hash of each message, never its content. Messages
+// are split into buckets by a hash of their ID; a conversation with more
+// messages than a snapshot keeps entries for is rolled up, keeping only
+// its buckets, so it can still be compared bucket by bucket.
+type ConversationSnapshot struct {
+	ID               string           `json:"id" bson:"_id"`
+	PhoneNumber      string           `json:"phoneNumber" bson:"phoneNumber"`
+	CreatedBy        string           `json:"createdBy" bson:"createdBy"` // Client IP of the request that took it
+	CreatedAt        time.Time        `json:"createdAt" bson:"createdAt"`
+	ExpiresAt        time.Time        `json:"expiresAt" bson:"expiresAt"`
+	Messages         int64            `json:"messages" bson:"messages"`                 // Live messages
+	ArchivedMessages int64            `json:"archivedMessages" bson:"archivedMessages"` // Messages in the archive
+	Summary          *SnapshotSummary `json:"summary,omitempty" bson:"summary,omitempty"`
+	RootHash         string           `json:"rootHash" bson:"rootHash"` // Hash of the buckets; equal snapshots have equal roots
+	RolledUp         bool             `json:"rolledUp" bson:"rolledUp"` // Entries were dropped, leaving the buckets
+	Buckets          []SnapshotBucket `json:"buckets" bson:"buckets"`
+	Entries          []SnapshotEntry  `json:"entries,omitempty" bson:"entries,omitempty"` // By ID; nil once rolled up
+}
+
+// SnapshotSummary is the part of a conversation's summary a snapshot keeps.
+type SnapshotSummary struct {
+	MessageCount  int64     `json:"messageCount" bson:"messageCount"`
+	LastMessageID string    `json:"lastMessageId" bson:"lastMessageId"`
+	LastMessageAt time.Time `json:"lastMessageAt" bson:"lastMessageAt"`
+	State         string    `json:"state,omitempty" bson:"state,omitempty"`
+}
+
+// SnapshotEntry is the hash of one message in a snapshot.
+type SnapshotEntry struct {
+	ID   string `json:"id" bson:"id"`
+	Hash string `json:"hash" bson:"hash"`
+}
+
+// SnapshotBucket rolls up the entries of the messages whose ID hashes to
+// Key.
+type SnapshotBucket struct {
+	Key   string `json:"key" bson:"key"`
+	Count int    `json:"count" bson:"count"`
+	Hash  string `json:"hash" bson:"hash"`
+}
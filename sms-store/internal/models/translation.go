@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Translation is a message's text in another language, as a client
+// translated it; this service only stores translations.
+type Translation struct {
+	Language  string    `json:"language" bson:"language"` // Language code, such as "hi" or "hi-Latn"; a message has at most one translation per language
+	Text      string    `json:"text" bson:"text"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"` // When the translation was last set
+}
@@ -0,0 +1,197 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types of MQTT 3.1.1 the source sends or handles.
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	protocolLevel     = 4 // MQTT 3.1.1
+	subscribeFailure  = 0x80
+	maxRemainingBytes = 268435455 // The most a remaining length can encode
+)
+
+// connackErrors are the CONNACK return codes other than accepted.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// packet is one control packet as read: its type, the flags of its fixed
+// header and what follows the remaining length.
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// publish is a PUBLISH packet.
+type publish struct {
+	topic    string
+	packetID uint16 // 0 at QoS 0
+	qos      byte
+	dup      bool
+	payload  []byte
+}
+
+// readPacket reads one control packet, refusing any larger than maxBytes.
+func readPacket(r *bufio.Reader, maxBytes int) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return packet{}, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxBytes {
+		return packet{}, fmt.Errorf("packet of %d bytes is larger than the limit of %d", length, maxBytes)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// encodePacket returns a control packet of kind with flags and body.
+func encodePacket(kind, flags byte, body []byte) []byte {
+	out := []byte{kind<<4 | flags&0x0f}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// connectPacket returns the CONNECT packet of a session of config.
+func connectPacket(config Config) []byte {
+	var flags byte
+	if config.CleanSession {
+		flags |= 0x02
+	}
+	if config.Username != "" {
+		flags |= 0x80
+		if config.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(config.KeepAlive.Seconds()))
+	body = appendString(body, config.ClientID)
+	if config.Username != "" {
+		body = appendString(body, config.Username)
+		if config.Password != "" {
+			body = appendString(body, config.Password)
+		}
+	}
+	return encodePacket(packetConnect, 0, body)
+}
+
+// parseConnack returns an error unless body, of a CONNACK, accepts the
+// connection.
+func parseConnack(body []byte) error {
+	if len(body) != 2 {
+		return fmt.Errorf("malformed CONNACK of %d bytes", len(body))
+	}
+	if code := body[1]; code != 0 {
+		if reason, ok := connackErrors[code]; ok {
+			return fmt.Errorf("connection refused: %s", reason)
+		}
+		return fmt.Errorf("connection refused with return code %d", code)
+	}
+	return nil
+}
+
+// subscribePacket returns a SUBSCRIBE to topic at QoS 1.
+func subscribePacket(packetID uint16, topic string) []byte {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	body = appendString(body, topic)
+	body = append(body, 1)
+	return encodePacket(packetSubscribe, 0x02, body)
+}
+
+// parseSuback returns the QoS granted by body, a SUBACK of packetID.
+func parseSuback(body []byte, packetID uint16) (byte, error) {
+	if len(body) != 3 {
+		return 0, fmt.Errorf("malformed SUBACK of %d bytes", len(body))
+	}
+	if id := binary.BigEndian.Uint16(body); id != packetID {
+		return 0, fmt.Errorf("SUBACK for packet %d, expected %d", id, packetID)
+	}
+	if body[2] == subscribeFailure {
+		return 0, errors.New("subscription refused")
+	}
+	return body[2], nil
+}
+
+// parsePublish parses p, a PUBLISH packet.
+func parsePublish(p packet) (publish, error) {
+	msg := publish{qos: (p.flags >> 1) & 0x03, dup: p.flags&0x08 != 0}
+	if msg.qos > 1 {
+		return publish{}, fmt.Errorf("unexpected PUBLISH at QoS %d", msg.qos)
+	}
+	body := p.body
+	if len(body) < 2 {
+		return publish{}, errors.New("malformed PUBLISH")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return publish{}, errors.New("malformed PUBLISH topic")
+	}
+	msg.topic, body = string(body[2:2+n]), body[2+n:]
+	if msg.qos > 0 {
+		if len(body) < 2 {
+			return publish{}, errors.New("malformed PUBLISH packet identifier")
+		}
+		msg.packetID, body = binary.BigEndian.Uint16(body), body[2:]
+	}
+	msg.payload = body
+	return msg, nil
+}
+
+// pubackPacket returns the PUBACK of packetID.
+func pubackPacket(packetID uint16) []byte {
+	return encodePacket(packetPuback, 0, binary.BigEndian.AppendUint16(nil, packetID))
+}
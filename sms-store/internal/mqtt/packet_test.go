@@ -0,0 +1,235 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodePacketRemainingLength(t *testing.T) {
+	// The boundaries of one to four length bytes, from the MQTT 3.1.1 spec
+	for _, tc := range []struct {
+		length int
+		want   []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	} {
+		body := make([]byte, tc.length)
+		encoded := encodePacket(packetPublish, 0x02, body)
+		if encoded[0] != 0x32 {
+			t.Fatalf("length %d: fixed header %#x, want 0x32", tc.length, encoded[0])
+		}
+		if got := encoded[1 : 1+len(tc.want)]; !bytes.Equal(got, tc.want) {
+			t.Fatalf("length %d encoded as % x, want % x", tc.length, got, tc.want)
+		}
+		if len(encoded) != 1+len(tc.want)+tc.length {
+			t.Fatalf("length %d: packet of %d bytes", tc.length, len(encoded))
+		}
+		p, err := readPacket(bufio.NewReader(bytes.NewReader(encoded)), maxRemainingBytes)
+		if err != nil {
+			t.Fatalf("length %d: readPacket: %v", tc.length, err)
+		}
+		if p.kind != packetPublish || p.flags != 0x02 || len(p.body) != tc.length {
+			t.Fatalf("length %d read as kind %d, flags %#x, %d bytes", tc.length, p.kind, p.flags, len(p.body))
+		}
+	}
+}
+
+func TestReadPacketErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input []byte
+		max   int
+		want  string
+	}{
+		{"FiveLengthBytes", []byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x7f}, maxRemainingBytes, "malformed remaining length"},
+		{"LargerThanLimit", encodePacket(packetPublish, 0, make([]byte, 11)), 10, "packet of 11 bytes is larger than the limit of 10"},
+		{"TruncatedBody", encodePacket(packetPublish, 0, make([]byte, 10))[:8], 100, io.ErrUnexpectedEOF.Error()},
+		{"TruncatedLength", []byte{0x30, 0x80}, 100, io.EOF.Error()},
+		{"Empty", nil, 100, io.EOF.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readPacket(bufio.NewReader(bytes.NewReader(tc.input)), tc.max)
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("readPacket = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadPacketReadsConsecutivePackets(t *testing.T) {
+	var stream []byte
+	stream = append(stream, encodePacket(packetConnack, 0, []byte{0, 0})...)
+	stream = append(stream, encodePacket(packetPingresp, 0, nil)...)
+	stream = append(stream, pubackPacket(7)...)
+	r := bufio.NewReader(bytes.NewReader(stream))
+
+	for _, want := range []byte{packetConnack, packetPingresp, packetPuback} {
+		p, err := readPacket(r, 100)
+		if err != nil || p.kind != want {
+			t.Fatalf("readPacket = kind %d, %v; want kind %d", p.kind, err, want)
+		}
+	}
+	if _, err := readPacket(r, 100); !errors.Is(err, io.EOF) {
+		t.Fatalf("readPacket past the end = %v, want EOF", err)
+	}
+}
+
+func TestConnectPacket(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config Config
+		flags  byte
+		tail   []string // Client ID, then user name and password when sent
+	}{
+		{"Anonymous", Config{ClientID: "sms-store", KeepAlive: 30 * time.Second}, 0x00, []string{"sms-store"}},
+		{"CleanSession", Config{ClientID: "sms-store", CleanSession: true, KeepAlive: 30 * time.Second}, 0x02, []string{"sms-store"}},
+		{"UserOnly", Config{ClientID: "a", Username: "ops", KeepAlive: 45 * time.Second}, 0x80, []string{"a", "ops"}},
+		{"UserAndPassword", Config{ClientID: "a", Username: "ops", Password: "s3cret", KeepAlive: 45 * time.Second}, 0xc0, []string{"a", "ops", "s3cret"}},
+		{"PasswordWithoutUser", Config{ClientID: "a", Password: "s3cret", KeepAlive: 45 * time.Second}, 0x00, []string{"a"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := readPacket(bufio.NewReader(bytes.NewReader(connectPacket(tc.config))), 1024)
+			if err != nil {
+				t.Fatalf("readPacket: %v", err)
+			}
+			if p.kind != packetConnect || p.flags != 0 {
+				t.Fatalf("kind %d flags %#x, want CONNECT", p.kind, p.flags)
+			}
+
+			want := appendString(nil, "MQTT")
+			want = append(want, protocolLevel, tc.flags)
+			want = binary.BigEndian.AppendUint16(want, uint16(tc.config.KeepAlive.Seconds()))
+			for _, s := range tc.tail {
+				want = appendString(want, s)
+			}
+			if !bytes.Equal(p.body, want) {
+				t.Fatalf("CONNECT body\n% x\nwant\n% x", p.body, want)
+			}
+		})
+	}
+}
+
+func TestParseConnack(t *testing.T) {
+	for _, tc := range []struct {
+		body []byte
+		want string // Empty for accepted
+	}{
+		{[]byte{0, 0}, ""},
+		{[]byte{1, 0}, ""}, // Session present
+		{[]byte{0, 4}, "connection refused: bad user name or password"},
+		{[]byte{0, 5}, "connection refused: not authorized"},
+		{[]byte{0, 9}, "connection refused with return code 9"},
+		{[]byte{0}, "malformed CONNACK of 1 bytes"},
+	} {
+		err := parseConnack(tc.body)
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || err.Error() != tc.want) {
+			t.Errorf("parseConnack(% x) = %v, want %q", tc.body, err, tc.want)
+		}
+	}
+}
+
+func TestSubscribeAndSuback(t *testing.T) {
+	p, err := readPacket(bufio.NewReader(bytes.NewReader(subscribePacket(1, "sms/+/events"))), 1024)
+	if err != nil {
+		t.Fatalf("readPacket: %v", err)
+	}
+	// SUBSCRIBE must have flags 0010, and ask for QoS 1
+	want := append(binary.BigEndian.AppendUint16(nil, 1), appendString(nil, "sms/+/events")...)
+	want = append(want, 1)
+	if p.kind != packetSubscribe || p.flags != 0x02 || !bytes.Equal(p.body, want) {
+		t.Fatalf("SUBSCRIBE = kind %d flags %#x body % x", p.kind, p.flags, p.body)
+	}
+
+	for _, tc := range []struct {
+		body    []byte
+		granted byte
+		want    string
+	}{
+		{[]byte{0, 1, 1}, 1, ""},
+		{[]byte{0, 1, 0}, 0, ""},
+		{[]byte{0, 1, subscribeFailure}, 0, "subscription refused"},
+		{[]byte{0, 2, 1}, 0, "SUBACK for packet 2, expected 1"},
+		{[]byte{0, 1}, 0, "malformed SUBACK of 2 bytes"},
+	} {
+		granted, err := parseSuback(tc.body, 1)
+		if tc.want == "" && (err != nil || granted != tc.granted) || tc.want != "" && (err == nil || err.Error() != tc.want) {
+			t.Errorf("parseSuback(% x) = %d, %v; want %d, %q", tc.body, granted, err, tc.granted, tc.want)
+		}
+	}
+}
+
+// publishPacket returns a PUBLISH as a broker sends it.
+func publishPacket(topic string, qos byte, dup bool, packetID uint16, payload string) []byte {
+	flags := qos << 1
+	if dup {
+		flags |= 0x08
+	}
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, packetID)
+	}
+	return encodePacket(packetPublish, flags, append(body, payload...))
+}
+
+func TestParsePublish(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input []byte
+		want  publish
+		err   string
+	}{
+		{"QoS0", publishPacket("sms-events", 0, false, 0, `{"id":"m1"}`), publish{topic: "sms-events", payload: []byte(`{"id":"m1"}`)}, ""},
+		{"QoS1", publishPacket("sms-events", 1, false, 42, `{"id":"m1"}`), publish{topic: "sms-events", qos: 1, packetID: 42, payload: []byte(`{"id":"m1"}`)}, ""},
+		{"Redelivery", publishPacket("sms-events", 1, true, 42, "x"), publish{topic: "sms-events", qos: 1, packetID: 42, dup: true, payload: []byte("x")}, ""},
+		{"EmptyPayload", publishPacket("t", 1, false, 1, ""), publish{topic: "t", qos: 1, packetID: 1, payload: []byte{}}, ""},
+		{"QoS2", publishPacket("t", 2, false, 1, "x"), publish{}, "unexpected PUBLISH at QoS 2"},
+		{"NoTopicLength", encodePacket(packetPublish, 0, []byte{0}), publish{}, "malformed PUBLISH"},
+		{"ShortTopic", encodePacket(packetPublish, 0, []byte{0, 9, 'a'}), publish{}, "malformed PUBLISH topic"},
+		{"NoPacketID", encodePacket(packetPublish, 0x02, appendString(nil, "t")), publish{}, "malformed PUBLISH packet identifier"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := readPacket(bufio.NewReader(bytes.NewReader(tc.input)), 1024)
+			if err != nil {
+				t.Fatalf("readPacket: %v", err)
+			}
+			got, err := parsePublish(p)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("parsePublish = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePublish: %v", err)
+			}
+			if got.topic != tc.want.topic || got.qos != tc.want.qos || got.packetID != tc.want.packetID || got.dup != tc.want.dup || !bytes.Equal(got.payload, tc.want.payload) {
+				t.Fatalf("parsePublish = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPubackPacket(t *testing.T) {
+	if got, want := pubackPacket(0x1234), []byte{0x40, 0x02, 0x12, 0x34}; !bytes.Equal(got, want) {
+		t.Fatalf("pubackPacket = % x, want % x", got, want)
+	}
+}
+
+func TestAppendStringIsLengthPrefixed(t *testing.T) {
+	got := appendString([]byte{9}, strings.Repeat("a", 300))
+	if len(got) != 303 || got[0] != 9 || binary.BigEndian.Uint16(got[1:]) != 300 {
+		t.Fatalf("appendString = % x...", got[:3])
+	}
+}
@@ -0,0 +1,434 @@
+// Package mqtt receives sms-events from an MQTT broker, as an alternative to
+// Kafka for deployments that have one. It speaks the subset of MQTT 3.1.1 a
+// subscriber needs: it subscribes to one topic at QoS 1 and hands each
+// message to the same ingestion pipeline Kafka events go through,
+// acknowledging it once it is settled. A broker redelivers unacknowledged
+// messages after a reconnect; the pipeline stores a redelivery once.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+)
+
+// Source states reported by State().
+const (
+	StateConnecting = "connecting" // Dialing, or waiting to redial after a lost connection
+	StateConnected  = "connected"  // Subscribed and receiving
+	StateStopped    = "stopped"    // Stop was called
+)
+
+var connectedGauge = metrics.NewGauge(
+	"mqtt_connected",
+	"1 while the MQTT source is connected and subscribed, 0 otherwise.",
+)
+
+// Config holds configuration for the MQTT source.
+type Config struct {
+	BrokerURL string // mqtt://host:1883, or mqtts://host:8883 for TLS; tcp, ssl and tls schemes are accepted too
+	Topic     string // Topic filter subscribed to, wildcards allowed
+	ClientID  string // Must be unique per instance; the broker keeps the session under it
+	Username  string
+	Password  string
+
+	TLS    bool   // Use TLS even with an mqtt:// URL
+	CAFile string // PEM certificates to verify the broker with, instead of the system's
+
+	CleanSession   bool          // Start afresh on each connect, losing messages published while disconnected
+	KeepAlive      time.Duration // Interval of pings while idle
+	ConnectTimeout time.Duration // Deadline for dialing, connecting and subscribing
+	InitialBackoff time.Duration // Wait after the first failed attempt
+	MaxBackoff     time.Duration // Upper bound for the exponential backoff
+	MaxPacketBytes int           // Largest packet accepted; a larger one ends the connection
+}
+
+// DefaultConfig returns default configuration values.
+func DefaultConfig() Config {
+	return Config{
+		Topic:          "sms-events",
+		ClientID:       "sms-store",
+		KeepAlive:      30 * time.Second,
+		ConnectTimeout: 10 * time.Second,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     60 * time.Second,
+		MaxPacketBytes: 1024 * 1024,
+	}
+}
+
+// Ingester takes the messages received. kafka.Pipeline is one.
+type Ingester interface {
+	// Ingest hands over the payload of a message published on topic. ack,
+	// if not nil, is to be called once it is settled, in the order
+	// messages were handed over.
+	Ingest(topic string, payload []byte, ack func()) error
+}
+
+// State is a snapshot of the source for health reporting.
+type State struct {
+	State            string     `json:"state"`
+	Broker           string     `json:"broker"`
+	Topic            string     `json:"topic"`
+	Attempts         int        `json:"attempts"`    // Failed attempts since the last connection
+	Connections      int        `json:"connections"` // Sessions established since the source started
+	LastError        string     `json:"lastError,omitempty"`
+	Since            time.Time  `json:"since"`
+	MessagesReceived int64      `json:"messagesReceived"`
+	LastMessageAt    *time.Time `json:"lastMessageAt,omitempty"`
+}
+
+// Source keeps a subscription to the broker, redialing with exponential
+// backoff whenever the connection is lost.
+type Source struct {
+	config    Config
+	address   string
+	broker    string      // BrokerURL without credentials, for reporting
+	tlsConfig *tls.Config // Nil for plain TCP
+	ingest    Ingester
+
+	mu      sync.Mutex
+	state   State
+	conn    *conn // Nil between sessions
+	started bool
+
+	received      atomic.Int64
+	lastMessageAt atomic.Int64 // Unix nanoseconds
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	clock.Clocked
+}
+
+// NewSource creates a source that hands the messages of config.Topic to
+// ingest. It doesn't connect until Start is called.
+func NewSource(config Config, ingest Ingester) (*Source, error) {
+	if config.Topic == "" {
+		return nil, errors.New("mqtt topic is required")
+	}
+	if config.ClientID == "" && !config.CleanSession {
+		return nil, errors.New("mqtt client ID is required unless sessions are clean")
+	}
+	if config.KeepAlive < time.Second || config.KeepAlive > 65535*time.Second {
+		return nil, fmt.Errorf("mqtt keep-alive must be between 1s and 65535s, got %v", config.KeepAlive)
+	}
+	if config.ConnectTimeout <= 0 || config.InitialBackoff <= 0 || config.MaxBackoff < config.InitialBackoff {
+		return nil, errors.New("mqtt connect timeout and backoffs must be positive, with the maximum backoff at least the initial one")
+	}
+	if config.MaxPacketBytes <= 0 || config.MaxPacketBytes > maxRemainingBytes {
+		return nil, fmt.Errorf("mqtt max packet bytes must be between 1 and %d, got %d", maxRemainingBytes, config.MaxPacketBytes)
+	}
+
+	u, err := url.Parse(config.BrokerURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid mqtt broker URL %q", config.BrokerURL)
+	}
+	useTLS := config.TLS
+	port := "1883"
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		useTLS = true
+	default:
+		return nil, fmt.Errorf("unsupported mqtt broker URL scheme %q: use mqtt or mqtts", u.Scheme)
+	}
+	if useTLS {
+		port = "8883"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	s := &Source{
+		config:  config,
+		address: net.JoinHostPort(u.Hostname(), port),
+		broker:  u.Scheme + "://" + u.Host,
+		ingest:  ingest,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if useTLS {
+		s.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+		if config.CAFile != "" {
+			pem, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read mqtt CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in mqtt CA file %s", config.CAFile)
+			}
+			s.tlsConfig.RootCAs = pool
+		}
+	}
+	s.state = State{State: StateConnecting, Broker: s.broker, Topic: config.Topic, Since: time.Now()}
+	return s, nil
+}
+
+// Start launches the connect loop in a goroutine and returns immediately.
+func (s *Source) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.state.Since = s.Clock().Now()
+	log.Printf("Starting MQTT source: broker %s, topic %s", s.broker, s.config.Topic)
+	go s.run()
+}
+
+func (s *Source) run() {
+	defer close(s.done)
+
+	backoff := s.config.InitialBackoff
+	for {
+		connected, err := s.session()
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if connected {
+			backoff = s.config.InitialBackoff
+		}
+
+		s.mu.Lock()
+		if connected {
+			s.state.Attempts = 0
+		}
+		s.state.State = StateConnecting
+		s.state.Attempts++
+		s.state.LastError = err.Error()
+		s.state.Since = s.Clock().Now()
+		attempts := s.state.Attempts
+		s.mu.Unlock()
+		connectedGauge.Set(0)
+
+		log.Printf("MQTT source attempt %d failed: %v (retrying in %v)", attempts, err, backoff)
+		select {
+		case <-s.stop:
+			return
+		case <-s.Clock().After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.config.MaxBackoff {
+			backoff = s.config.MaxBackoff
+		}
+	}
+}
+
+// session connects, subscribes and receives until the connection is lost
+// or the source stops. connected reports whether it got as far as being
+// subscribed.
+func (s *Source) session() (connected bool, err error) {
+	dialer := &net.Dialer{Timeout: s.config.ConnectTimeout, KeepAlive: -1}
+	var nc net.Conn
+	if s.tlsConfig != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}).Dial("tcp", s.address)
+	} else {
+		nc, err = dialer.Dial("tcp", s.address)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to dial %s: %w", s.broker, err)
+	}
+	c := &conn{Conn: nc}
+
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+		s.mu.Unlock()
+		nc.Close()
+		return false, errors.New("stopped")
+	default:
+	}
+	s.conn = c
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	r := bufio.NewReader(nc)
+	nc.SetDeadline(time.Now().Add(s.config.ConnectTimeout))
+	if err := c.write(connectPacket(s.config)); err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+	p, err := readPacket(r, s.config.MaxPacketBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if p.kind != packetConnack {
+		return false, fmt.Errorf("expected CONNACK, got packet type %d", p.kind)
+	}
+	if err := parseConnack(p.body); err != nil {
+		return false, err
+	}
+	const subscribeID = 1
+	if err := c.write(subscribePacket(subscribeID, s.config.Topic)); err != nil {
+		return false, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	// Pings keep an idle connection open; a broker that answers nothing
+	// for one and a half keep-alives is taken to be gone
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go s.ping(c, sessionDone)
+
+	for {
+		if connected {
+			nc.SetReadDeadline(time.Now().Add(s.config.KeepAlive * 3 / 2))
+		}
+		p, err := readPacket(r, s.config.MaxPacketBytes)
+		if err != nil {
+			return connected, fmt.Errorf("connection lost: %w", err)
+		}
+
+		switch p.kind {
+		case packetSuback:
+			granted, err := parseSuback(p.body, subscribeID)
+			if err != nil {
+				return false, err
+			}
+			if granted == 0 {
+				log.Printf("Warning: MQTT broker granted QoS 0 on %s; messages may be lost while disconnected", s.config.Topic)
+			}
+			nc.SetDeadline(time.Time{})
+			connected = true
+			s.subscribed()
+
+		case packetPublish:
+			// A session the broker kept may deliver before the SUBACK
+			msg, err := parsePublish(p)
+			if err != nil {
+				return connected, err
+			}
+			if err := s.receive(c, msg); err != nil {
+				return connected, err
+			}
+
+		case packetPingresp:
+		default:
+			return connected, fmt.Errorf("unexpected packet type %d", p.kind)
+		}
+	}
+}
+
+// ping sends a PINGREQ every keep-alive until done is closed.
+func (s *Source) ping(c *conn, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.Clock().After(s.config.KeepAlive):
+			if err := c.write(encodePacket(packetPingreq, 0, nil)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// subscribed records a session established.
+func (s *Source) subscribed() {
+	s.mu.Lock()
+	s.state.State = StateConnected
+	s.state.Connections++
+	s.state.Attempts = 0
+	s.state.LastError = ""
+	s.state.Since = s.Clock().Now()
+	connections := s.state.Connections
+	s.mu.Unlock()
+	connectedGauge.Set(1)
+	log.Printf("MQTT source subscribed to %s on %s (session %d)", s.config.Topic, s.broker, connections)
+}
+
+// receive hands msg to the pipeline, to be acknowledged on c once settled.
+// An acknowledgement lost with the connection is redelivered by the broker.
+func (s *Source) receive(c *conn, msg publish) error {
+	s.received.Add(1)
+	s.lastMessageAt.Store(s.Clock().Now().UnixNano())
+
+	var ack func()
+	if msg.qos == 1 {
+		packetID := msg.packetID
+		ack = func() { _ = c.write(pubackPacket(packetID)) }
+	}
+	if err := s.ingest.Ingest(msg.topic, msg.payload, ack); err != nil {
+		return fmt.Errorf("failed to ingest message: %w", err)
+	}
+	return nil
+}
+
+// State returns a snapshot of the source state.
+func (s *Source) State() State {
+	s.mu.Lock()
+	state := s.state
+	s.mu.Unlock()
+
+	state.MessagesReceived = s.received.Load()
+	if ns := s.lastMessageAt.Load(); ns > 0 {
+		t := time.Unix(0, ns)
+		state.LastMessageAt = &t
+	}
+	return state
+}
+
+// Stop disconnects from the broker and ends the connect loop. Messages
+// handed over and not acknowledged yet are redelivered by the broker when
+// the source connects again. It is safe to call more than once.
+func (s *Source) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+
+		s.mu.Lock()
+		started := s.started
+		if s.conn != nil {
+			_ = s.conn.write(encodePacket(packetDisconnect, 0, nil))
+			s.conn.Close()
+		}
+		s.mu.Unlock()
+		if started {
+			<-s.done
+		}
+
+		s.mu.Lock()
+		s.state.State = StateStopped
+		s.state.Since = s.Clock().Now()
+		s.mu.Unlock()
+		connectedGauge.Set(0)
+		log.Println("MQTT source stopped")
+	})
+}
+
+// conn serializes writes to a connection: acknowledgements come from the
+// pipeline and pings from their own goroutine.
+type conn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+const writeTimeout = 10 * time.Second
+
+func (c *conn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.Conn.Write(b)
+	return err
+}
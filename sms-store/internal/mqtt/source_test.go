@@ -0,0 +1,280 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker accepts the source's connections on a local port, handing
+// each to the test.
+type fakeBroker struct {
+	listener net.Listener
+	conns    chan net.Conn
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{listener: l, conns: make(chan net.Conn, 4)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			b.conns <- c
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "mqtt://" + b.listener.Addr().String()
+}
+
+// accept returns the source's next connection.
+func (b *fakeBroker) accept(t *testing.T) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	select {
+	case c := <-b.conns:
+		t.Cleanup(func() { c.Close() })
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		return c, bufio.NewReader(c)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the source didn't connect")
+		return nil, nil
+	}
+}
+
+// expect reads the next packet other than a PINGREQ, failing unless it is
+// of kind.
+func expect(t *testing.T, r *bufio.Reader, kind byte) packet {
+	t.Helper()
+	for {
+		p, err := readPacket(r, 1024)
+		if err != nil {
+			t.Fatalf("reading packet type %d: %v", kind, err)
+		}
+		if p.kind == packetPingreq {
+			continue
+		}
+		if p.kind != kind {
+			t.Fatalf("got packet type %d, want %d", p.kind, kind)
+		}
+		return p
+	}
+}
+
+// handshake answers the source's CONNECT and SUBSCRIBE, returning the
+// CONNECT's body.
+func handshake(t *testing.T, c net.Conn, r *bufio.Reader) []byte {
+	t.Helper()
+	connect := expect(t, r, packetConnect)
+	c.Write(encodePacket(packetConnack, 0, []byte{0, 0}))
+	subscribe := expect(t, r, packetSubscribe)
+	if subscribe.flags != 0x02 || subscribe.body[len(subscribe.body)-1] != 1 {
+		t.Fatalf("SUBSCRIBE flags %#x body % x, want QoS 1", subscribe.flags, subscribe.body)
+	}
+	c.Write(encodePacket(packetSuback, 0, []byte{0, 1, 1}))
+	return connect.body
+}
+
+// recordingIngester records payloads, acknowledging each once released.
+type recordingIngester struct {
+	mu       sync.Mutex
+	payloads []string
+	acks     []func()
+	received chan struct{}
+}
+
+func newRecordingIngester() *recordingIngester {
+	return &recordingIngester{received: make(chan struct{}, 16)}
+}
+
+func (i *recordingIngester) Ingest(topic string, payload []byte, ack func()) error {
+	i.mu.Lock()
+	i.payloads = append(i.payloads, topic+" "+string(payload))
+	i.acks = append(i.acks, ack)
+	i.mu.Unlock()
+	i.received <- struct{}{}
+	return nil
+}
+
+func (i *recordingIngester) wait(t *testing.T, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case <-i.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the source didn't hand over a message")
+		}
+	}
+}
+
+func testConfig(brokerURL string) Config {
+	config := DefaultConfig()
+	config.BrokerURL = brokerURL
+	config.Username = "ops"
+	config.Password = "s3cret"
+	config.KeepAlive = time.Minute
+	config.ConnectTimeout = 2 * time.Second
+	config.InitialBackoff = 10 * time.Millisecond
+	config.MaxBackoff = 20 * time.Millisecond
+	return config
+}
+
+func waitForState(t *testing.T, s *Source, ok func(State) bool) State {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state := s.State()
+		if ok(state) {
+			return state
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %+v", state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSourceReceivesAndAcknowledges(t *testing.T) {
+	broker := newFakeBroker(t)
+	ingester := newRecordingIngester()
+	s, err := NewSource(testConfig(broker.url()), ingester)
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+	s.Start()
+	defer s.Stop()
+
+	c, r := broker.accept(t)
+	connect := handshake(t, c, r)
+	if !bytes.Contains(connect, appendString(nil, "ops")) || !bytes.Contains(connect, appendString(nil, "s3cret")) {
+		t.Fatalf("CONNECT % x lacks the credentials", connect)
+	}
+	waitForState(t, s, func(st State) bool { return st.State == StateConnected && st.Connections == 1 })
+
+	c.Write(publishPacket("sms-events", 1, false, 7, `{"id":"m1"}`))
+	c.Write(publishPacket("sms-events", 0, false, 0, `{"id":"m2"}`))
+	c.Write(publishPacket("sms-events", 1, true, 8, `{"id":"m3"}`))
+	ingester.wait(t, 3)
+
+	ingester.mu.Lock()
+	payloads, acks := ingester.payloads, ingester.acks
+	ingester.mu.Unlock()
+	if strings.Join(payloads, "\n") != "sms-events {\"id\":\"m1\"}\nsms-events {\"id\":\"m2\"}\nsms-events {\"id\":\"m3\"}" {
+		t.Fatalf("ingested %q", payloads)
+	}
+	if acks[1] != nil {
+		t.Fatal("a QoS 0 message has an acknowledgement")
+	}
+
+	// Nothing is acknowledged until the pipeline settles the message
+	acks[0]()
+	acks[2]()
+	for _, id := range []byte{7, 8} {
+		if puback := expect(t, r, packetPuback); !bytes.Equal(puback.body, []byte{0, id}) {
+			t.Fatalf("PUBACK % x, want packet %d", puback.body, id)
+		}
+	}
+	if st := s.State(); st.MessagesReceived != 3 || st.LastMessageAt == nil {
+		t.Fatalf("state = %+v, want 3 messages received", st)
+	}
+
+	s.Stop()
+	expect(t, r, packetDisconnect)
+	if st := s.State(); st.State != StateStopped {
+		t.Fatalf("state after Stop = %s", st.State)
+	}
+}
+
+func TestSourceReconnectsAfterLostConnection(t *testing.T) {
+	broker := newFakeBroker(t)
+	s, err := NewSource(testConfig(broker.url()), newRecordingIngester())
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+	s.Start()
+	defer s.Stop()
+
+	c, r := broker.accept(t)
+	handshake(t, c, r)
+	waitForState(t, s, func(st State) bool { return st.Connections == 1 })
+	c.Close()
+
+	c, r = broker.accept(t)
+	handshake(t, c, r)
+	st := waitForState(t, s, func(st State) bool { return st.State == StateConnected && st.Connections == 2 })
+	if st.Attempts != 0 || st.LastError != "" {
+		t.Fatalf("state after reconnecting = %+v, want the failure cleared", st)
+	}
+}
+
+func TestSourceReportsRefusedConnection(t *testing.T) {
+	broker := newFakeBroker(t)
+	s, err := NewSource(testConfig(broker.url()), newRecordingIngester())
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+	s.Start()
+	defer s.Stop()
+
+	c, r := broker.accept(t)
+	expect(t, r, packetConnect)
+	c.Write(encodePacket(packetConnack, 0, []byte{0, 4}))
+	st := waitForState(t, s, func(st State) bool { return st.Attempts >= 1 })
+	if st.State != StateConnecting || st.LastError != "connection refused: bad user name or password" {
+		t.Fatalf("state = %+v, want the refusal reported", st)
+	}
+}
+
+func TestNewSourceValidatesConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"NoTopic", func(c *Config) { c.Topic = "" }, "mqtt topic is required"},
+		{"NoClientID", func(c *Config) { c.ClientID = "" }, "mqtt client ID is required unless sessions are clean"},
+		{"ShortKeepAlive", func(c *Config) { c.KeepAlive = 500 * time.Millisecond }, "mqtt keep-alive must be between 1s and 65535s, got 500ms"},
+		{"BackoffsReversed", func(c *Config) { c.MaxBackoff = time.Millisecond }, "mqtt connect timeout and backoffs must be positive"},
+		{"PacketTooLarge", func(c *Config) { c.MaxPacketBytes = maxRemainingBytes + 1 }, "mqtt max packet bytes must be between 1 and 268435455"},
+		{"NoHost", func(c *Config) { c.BrokerURL = "mqtt://" }, `invalid mqtt broker URL "mqtt://"`},
+		{"WrongScheme", func(c *Config) { c.BrokerURL = "ws://broker:80" }, `unsupported mqtt broker URL scheme "ws"`},
+		{"MissingCAFile", func(c *Config) { c.BrokerURL = "mqtts://broker"; c.CAFile = "/nonexistent/ca.pem" }, "failed to read mqtt CA file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testConfig("mqtt://broker")
+			tc.change(&config)
+			if _, err := NewSource(config, newRecordingIngester()); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("NewSource = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	for url, address := range map[string]string{
+		"mqtt://broker":       "broker:1883",
+		"tcp://broker:1884":   "broker:1884",
+		"mqtts://broker":      "broker:8883",
+		"ssl://broker:9000":   "broker:9000",
+		"mqtt://u:p@broker:1": "broker:1",
+	} {
+		s, err := NewSource(testConfig(url), newRecordingIngester())
+		if err != nil {
+			t.Fatalf("NewSource(%s): %v", url, err)
+		}
+		if s.address != address || strings.Contains(s.broker, "u:p") {
+			t.Errorf("NewSource(%s) dials %s as %s, want %s without credentials", url, s.address, s.broker, address)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package pdf writes simple text documents as PDF without external
+// dependencies. It supports the standard Helvetica fonts, filled
+// rectangles and any number of pages, which is enough for transcripts and
+// reports; it does not embed fonts, so text is limited to the characters of
+// the WinAnsi (Latin-1) encoding and anything else is written as "?".
+//
+// Pages are written to the output as soon as the next one starts, so long
+// documents don't stay in memory.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Font is one of the standard fonts every PDF reader provides.
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = [...]string{Helvetica: "Helvetica", HelveticaBold: "Helvetica-Bold"}
+
+// Page sizes in points.
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Object numbers fixed by the layout: the page tree is written last, but
+// pages refer to it, so its number is reserved up front.
+const (
+	catalogObject = 1
+	pagesObject   = 2
+	firstFont     = 3 // One object per Font, in order
+	firstFree     = firstFont + len(fontNames)
+)
+
+// Document is a PDF being written to an io.Writer.
+type Document struct {
+	buf     *bufio.Writer
+	out     *countingWriter
+	width   float64
+	height  float64
+	offsets map[int]int64 // Object number -> byte offset
+	next    int
+	pages   []int
+	content *bytes.Buffer // Current page; nil before the first AddPage
+	err     error
+}
+
+// New starts a document of pages width by height points on w. Call AddPage
+// before drawing and Close when done.
+func New(w io.Writer, width, height float64) *Document {
+	buf := bufio.NewWriter(w)
+	d := &Document{
+		buf:     buf,
+		out:     &countingWriter{w: buf},
+		width:   width,
+		height:  height,
+		offsets: make(map[int]int64),
+		next:    firstFree,
+	}
+	d.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	for i, name := range fontNames {
+		d.object(firstFont+i, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+	return d
+}
+
+// Width and Height return the page size.
+func (d *Document) Width() float64  { return d.width }
+func (d *Document) Height() float64 { return d.height }
+
+// AddPage finishes the current page, if any, and starts a blank one.
+func (d *Document) AddPage() {
+	d.flushPage()
+	d.content = new(bytes.Buffer)
+}
+
+// Text draws s with its baseline starting at (x, y), measured in points from
+// the bottom-left corner. gray is 0 for black to 1 for white.
+func (d *Document) Text(x, y float64, font Font, size, gray float64, s string) {
+	if d.content == nil {
+		d.AddPage()
+	}
+	fmt.Fprintf(d.content, "BT %s g /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		num(gray), int(font), num(size), num(x), num(y), escape(s))
+}
+
+// FillRect fills a rectangle whose bottom-left corner is at (x, y).
+func (d *Document) FillRect(x, y, w, h, gray float64) {
+	if d.content == nil {
+		d.AddPage()
+	}
+	fmt.Fprintf(d.content, "%s g %s %s %s %s re f\n", num(gray), num(x), num(y), num(w), num(h))
+}
+
+// Close finishes the last page and writes the page tree and cross-reference
+// table. It returns the first write error of the document.
+func (d *Document) Close() error {
+	if d.content == nil {
+		d.AddPage()
+	}
+	d.flushPage()
+
+	kids := make([]string, len(d.pages))
+	for i, p := range d.pages {
+		kids[i] = strconv.Itoa(p) + " 0 R"
+	}
+	fonts := make([]string, len(fontNames))
+	for i := range fontNames {
+		fonts[i] = fmt.Sprintf("/F%d %d 0 R", i, firstFont+i)
+	}
+	d.object(pagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %s %s] /Resources << /Font << %s >> >> >>",
+		strings.Join(kids, " "), len(d.pages), num(d.width), num(d.height), strings.Join(fonts, " ")))
+	d.object(catalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObject))
+
+	xref := d.out.n
+	d.printf("xref\n0 %d\n0000000000 65535 f \n", d.next)
+	for n := 1; n < d.next; n++ {
+		d.printf("%010d 00000 n \n", d.offsets[n])
+	}
+	d.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", d.next, catalogObject, xref)
+
+	if d.err != nil {
+		return d.err
+	}
+	return d.buf.Flush()
+}
+
+// flushPage writes the current page's content stream and page object.
+func (d *Document) flushPage() {
+	if d.content == nil {
+		return
+	}
+	contentObject, pageObject := d.next, d.next+1
+	d.next += 2
+
+	d.offsets[contentObject] = d.out.n
+	d.printf("%d 0 obj\n<< /Length %d >>\nstream\n", contentObject, d.content.Len())
+	d.write(d.content.Bytes())
+	d.printf("\nendstream\nendobj\n")
+	d.object(pageObject, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R >>", pagesObject, contentObject))
+
+	d.pages = append(d.pages, pageObject)
+	d.content = nil
+}
+
+func (d *Document) object(n int, body string) {
+	d.offsets[n] = d.out.n
+	d.printf("%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+func (d *Document) printf(format string, args ...any) {
+	d.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (d *Document) write(b []byte) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = d.out.Write(b)
+}
+
+// TextWidth returns the width of s in points when drawn in font at size.
+func TextWidth(font Font, size float64, s string) float64 {
+	var units int
+	for _, r := range s {
+		units += glyphWidth(encodeRune(r))
+	}
+	w := float64(units) * size / 1000
+	if font == HelveticaBold {
+		// Only the regular widths are tabulated; bold glyphs are up to about
+		// a tenth wider, so this errs towards wrapping early
+		w *= 1.1
+	}
+	return w
+}
+
+// encodeRune maps r to its WinAnsi byte. Latin-1 matches WinAnsi outside
+// 0x80-0x9F; control characters become spaces and the rest "?".
+func encodeRune(r rune) byte {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r':
+		return ' '
+	case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+		return byte(r)
+	default:
+		return '?'
+	}
+}
+
+// escape encodes s as the contents of a PDF literal string.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch c := encodeRune(r); c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c >= 0x80 {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// num formats a coordinate to a hundredth of a point.
+func num(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// helveticaWidths are the Helvetica advance widths, in thousandths of the
+// font size, of the printable ASCII characters from space to tilde.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+func glyphWidth(c byte) int {
+	if c >= 0x20 && c < 0x7F {
+		return helveticaWidths[c-0x20]
+	}
+	return 556 // Accented letters are close to the average lowercase width
+}
+
+// countingWriter tracks the byte offset objects are written at.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
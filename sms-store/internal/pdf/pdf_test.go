@@ -0,0 +1,101 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":              "plain",
+		`a (b) c\d`:          `a \(b\) c\\d`,
+		"café":               `caf\351`,
+		"tab\tand\nnewline":  "tab and newline",
+		"emoji 😀 and नमस्ते": "emoji ? and ??????",
+		"<script>":           "<script>",
+	} {
+		if got := escape(in); got != want {
+			t.Errorf("escape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNum(t *testing.T) {
+	for f, want := range map[float64]string{0: "0", 12: "12", 595.28: "595.28", 1.5: "1.5", 0.126: "0.13", -3.1: "-3.1"} {
+		if got := num(f); got != want {
+			t.Errorf("num(%v) = %q, want %q", f, got, want)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	// "Hi" is 722 + 222 thousandths of the size
+	if got := TextWidth(Helvetica, 10, "Hi"); got != 9.44 {
+		t.Fatalf("TextWidth(Hi) = %v, want 9.44", got)
+	}
+	if regular, bold := TextWidth(Helvetica, 10, "Hello"), TextWidth(HelveticaBold, 10, "Hello"); bold <= regular {
+		t.Fatalf("bold width %v isn't wider than regular %v", bold, regular)
+	}
+}
+
+// TestDocumentStructure checks that the cross-reference table points at
+// each object and the page tree lists every page.
+func TestDocumentStructure(t *testing.T) {
+	var out bytes.Buffer
+	d := New(&out, A4Width, A4Height)
+	d.AddPage()
+	d.Text(50, 700, Helvetica, 10, 0, "first (page)")
+	d.FillRect(50, 600, 100, 20, 0.5)
+	d.AddPage()
+	d.Text(50, 700, HelveticaBold, 12, 0, "second page")
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	doc := out.String()
+
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatalf("document doesn't start and end as a PDF:\n%s", doc)
+	}
+	if !strings.Contains(doc, "/Kids [6 0 R 8 0 R] /Count 2") {
+		t.Fatalf("page tree doesn't list both pages:\n%s", doc)
+	}
+	if !strings.Contains(doc, "BT 0 g /F0 10 Tf 50 700 Td (first \\(page\\)) Tj ET") || !strings.Contains(doc, "0.5 g 50 600 100 20 re f") {
+		t.Fatalf("page content not as drawn:\n%s", doc)
+	}
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+	if startxref == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(startxref[1])
+	if !strings.HasPrefix(doc[xref:], "xref\n0 9\n") {
+		t.Fatalf("startxref %d doesn't point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(doc[xref:], -1)
+	if len(entries) != 8 {
+		t.Fatalf("%d xref entries, want 8", len(entries))
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(e[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(doc[offset:], want) {
+			t.Errorf("xref entry %d points at %q", i+1, doc[offset:offset+10])
+		}
+	}
+	if !strings.Contains(doc, "trailer\n<< /Size 9 /Root 1 0 R >>") {
+		t.Fatalf("trailer not found:\n%s", doc[xref:])
+	}
+}
+
+func TestCloseWithoutPagesWritesOne(t *testing.T) {
+	var out bytes.Buffer
+	if err := New(&out, 100, 100).Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !strings.Contains(out.String(), "/Count 1 /MediaBox [0 0 100 100]") {
+		t.Fatalf("document:\n%s", out.String())
+	}
+}
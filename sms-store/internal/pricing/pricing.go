@@ -0,0 +1,160 @@
+// Package pricing estimates what an outbound SMS costs to send.
+//
+// A Table holds a per-segment rate for each destination country prefix.
+// The Pricer serves estimates from the most recently loaded table and can
+// reload it from its Source without a restart.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+var defaultRateMessages = metrics.NewCounterVec(
+	"pricing_default_rate_messages_total",
+	"Messages priced at the default rate because no prefix in the pricing table matched.",
+	"currency",
+)
+
+// Table is a pricing table. Rates are per message segment.
+type Table struct {
+	Currency    string             `json:"currency" bson:"currency"`
+	DefaultRate float64            `json:"defaultRate" bson:"defaultRate"` // Used when no prefix matches
+	Prefixes    map[string]float64 `json:"prefixes" bson:"prefixes"`       // Country prefix digits, e.g. "91", to rate
+}
+
+// Validate checks that the table can price every message.
+func (t Table) Validate() error {
+	if strings.TrimSpace(t.Currency) == "" {
+		return errors.New("currency is required")
+	}
+	if t.DefaultRate < 0 {
+		return errors.New("defaultRate must not be negative")
+	}
+	for prefix, rate := range t.Prefixes {
+		if prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+			return fmt.Errorf("prefix %q must be digits only", prefix)
+		}
+		if rate < 0 {
+			return fmt.Errorf("rate for prefix %s must not be negative", prefix)
+		}
+	}
+	return nil
+}
+
+// Source loads a pricing table.
+type Source interface {
+	Load(ctx context.Context) (Table, error)
+	String() string
+}
+
+// Snapshot is the table currently in use and where it came from.
+type Snapshot struct {
+	Table
+	Source   string    `json:"source"`
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// Pricer estimates message costs from a reloadable pricing table.
+// It is safe for concurrent use.
+type Pricer struct {
+	source  Source
+	current atomic.Pointer[Snapshot]
+
+	clock.Clocked
+}
+
+// NewPricer loads the initial table from source.
+func NewPricer(source Source) (*Pricer, error) {
+	p := &Pricer{source: source}
+	if _, err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload loads the table from the source again. On error the previous table
+// stays in use.
+func (p *Pricer) Reload() (Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	table, err := p.source.Load(ctx)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to load pricing table from %s: %w", p.source, err)
+	}
+	if err := table.Validate(); err != nil {
+		return Snapshot{}, fmt.Errorf("invalid pricing table in %s: %w", p.source, err)
+	}
+
+	snap := &Snapshot{Table: table, Source: p.source.String(), LoadedAt: p.Clock().Now()}
+	p.current.Store(snap)
+	return *snap, nil
+}
+
+// Snapshot returns the table currently in use.
+func (p *Pricer) Snapshot() Snapshot {
+	return *p.current.Load()
+}
+
+// Estimate prices msg by its segment count and the rate for the longest
+// matching prefix of its phone number. Messages falling back to the default
+// rate are flagged with DefaultRate. Shortcodes and alphanumeric sender IDs
+// have no country prefix, so they get the default rate without the flag.
+func (p *Pricer) Estimate(msg models.Message) *models.Cost {
+	table := p.current.Load().Table
+	segments := Segments(msg.Text)
+
+	cost := &models.Cost{Segments: segments, Currency: table.Currency}
+	if senderType := models.ClassifySender(msg.PhoneNumber); senderType == models.SenderShortcode || senderType == models.SenderAlphanumeric {
+		cost.EstimatedCost = float64(segments) * table.DefaultRate
+		return cost
+	}
+	prefix, rate, ok := table.match(msg.PhoneNumber)
+	if ok {
+		cost.Prefix = prefix
+	} else {
+		rate = table.DefaultRate
+		cost.DefaultRate = true
+		defaultRateMessages.WithLabelValues(table.Currency).Inc()
+	}
+	cost.EstimatedCost = float64(segments) * rate
+	return cost
+}
+
+// match finds the longest prefix of phoneNumber's digits in the table.
+// A leading "+" or international "00" is ignored.
+func (t Table) match(phoneNumber string) (string, float64, bool) {
+	digits := normalizeNumber(phoneNumber)
+	for n := len(digits); n > 0; n-- {
+		if rate, ok := t.Prefixes[digits[:n]]; ok {
+			return digits[:n], rate, true
+		}
+	}
+	return "", 0, false
+}
+
+func normalizeNumber(phoneNumber string) string {
+	phoneNumber = strings.TrimSpace(phoneNumber)
+	international := strings.HasPrefix(phoneNumber, "+")
+
+	var b strings.Builder
+	for _, r := range phoneNumber {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	if !international {
+		digits = strings.TrimPrefix(digits, "00")
+	}
+	return digits
+}
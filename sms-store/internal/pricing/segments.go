@@ -0,0 +1,53 @@
+package pricing
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet; each character takes one septet.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters are sent as an escape plus one septet.
+const gsm7Extension = "^{}\\[~]|€\f"
+
+const (
+	gsm7SingleSegment = 160
+	gsm7MultiSegment  = 153 // A concatenation header takes 7 septets per segment
+	ucs2SingleSegment = 70
+	ucs2MultiSegment  = 67
+)
+
+// Segments returns how many SMS segments text is sent as. Text that fits the
+// GSM 7-bit alphabet is counted in septets; anything else is sent as UCS-2
+// and counted in UTF-16 code units. Empty text still takes one segment.
+func Segments(text string) int {
+	if septets, ok := gsm7Length(text); ok {
+		return segmentCount(septets, gsm7SingleSegment, gsm7MultiSegment)
+	}
+	return segmentCount(len(utf16.Encode([]rune(text))), ucs2SingleSegment, ucs2MultiSegment)
+}
+
+// gsm7Length counts text's septets, or reports false if text needs UCS-2.
+func gsm7Length(text string) (int, bool) {
+	n := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			n++
+		case strings.ContainsRune(gsm7Extension, r):
+			n += 2
+		default:
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+func segmentCount(units, single, multi int) int {
+	if units <= single {
+		return 1
+	}
+	return (units + multi - 1) / multi
+}
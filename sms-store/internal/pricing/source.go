@@ -0,0 +1,64 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FileSource loads a pricing table from a JSON file:
+//
+//	{"currency": "INR", "defaultRate": 0.25, "prefixes": {"91": 0.12, "1": 0.6}}
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Load(ctx context.Context) (Table, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return Table{}, err
+	}
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return Table{}, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return table, nil
+}
+
+func (s FileSource) String() string {
+	return "file " + s.Path
+}
+
+// tableDocumentID is the _id of the pricing table document in a MongoSource.
+const tableDocumentID = "current"
+
+// MongoSource loads a pricing table stored as a single document, with the
+// same fields as the JSON file, under _id "current".
+type MongoSource struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSource reads the pricing table from the given collection.
+func NewMongoSource(client *mongo.Client, databaseName, collectionName string) *MongoSource {
+	return &MongoSource{collection: client.Database(databaseName).Collection(collectionName)}
+}
+
+func (s *MongoSource) Load(ctx context.Context) (Table, error) {
+	var table Table
+	err := s.collection.FindOne(ctx, bson.M{"_id": tableDocumentID}).Decode(&table)
+	if err == mongo.ErrNoDocuments {
+		return Table{}, fmt.Errorf("no pricing document with _id %q", tableDocumentID)
+	}
+	if err != nil {
+		return Table{}, err
+	}
+	return table, nil
+}
+
+func (s *MongoSource) String() string {
+	return "collection " + s.collection.Name()
+}
@@ -0,0 +1,96 @@
+package redact
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// knownNumber is the number the tests log and then look for in the output.
+const knownNumber = "9876543210"
+
+// logThrough logs each line with a logger writing through a Writer, as the
+// server's does, and returns the output.
+func logThrough(lines ...string) string {
+	var out bytes.Buffer
+	logger := log.New(NewWriter(&out), "", log.LstdFlags)
+	for _, line := range lines {
+		logger.Print(line)
+	}
+	return out.String()
+}
+
+func TestLogOutputHasNoPhoneNumbers(t *testing.T) {
+	out := logThrough(
+		"Saved message m1 for "+knownNumber,
+		"Saved message m2 for +91"+knownNumber,
+		"GET /v1/user/"+knownNumber+"/messages 200 3ms",
+		"GET /v1/search?q=%2B91"+knownNumber+" 200",
+		`Failed to parse event: {"phoneNumber":"`+knownNumber+`","text":"call me on `+knownNumber+`","createdAt":"2026-10-14T10:00:00Z"}`,
+		"Failed to look up profile "+knownNumber+" after deleting its messages: context deadline exceeded",
+	)
+
+	if strings.Contains(out, knownNumber) || strings.Contains(out, "987654") {
+		t.Fatalf("log output contains the phone number:\n%s", out)
+	}
+	if strings.Contains(out, "call me") {
+		t.Fatalf("log output contains the message text:\n%s", out)
+	}
+	if n := strings.Count(out, "***3210"); n != 6 {
+		t.Fatalf("log output masks the number %d times, want 6:\n%s", n, out)
+	}
+	if !strings.Contains(out, `"text":"[21 chars sha256:`) {
+		t.Fatalf("log output doesn't keep the text's length and hash:\n%s", out)
+	}
+}
+
+func TestLogOutputWithRedactionDisabled(t *testing.T) {
+	SetEnabled(false)
+	defer SetEnabled(true)
+
+	line := `Failed to parse event: {"phoneNumber":"` + knownNumber + `","text":"call me"}`
+	if out := logThrough(line); !strings.Contains(out, line) {
+		t.Fatalf("log output with redaction disabled = %q, want the line as logged", out)
+	}
+}
+
+func TestLine(t *testing.T) {
+	for _, tc := range []struct {
+		line, want string
+	}{
+		{"message for " + knownNumber, "message for ***3210"},
+		{"message for +919876543210", "message for ***3210"},
+		{"message for +1234567", "message for ***4567"},
+		{"q=%2b919876543210&limit=5", "q=***3210&limit=5"},
+		{"processed 123456789 events", "processed 123456789 events"}, // Nine bare digits
+		{"saved msg-20240313121000 and kafka_1728900000000", "saved msg-20240313121000 and kafka_1728900000000"},
+		{"saved 2 messages in 31ms", "saved 2 messages in 31ms"},
+		{`{"text": "hi \"there\""}`, `{"text":"` + Text(`hi "there"`) + `"}`},
+		{`{"text":""}`, `{"text":"[0 chars sha256:e3b0c442]"}`},
+	} {
+		if got := Line(tc.line); got != tc.want {
+			t.Errorf("Line(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestPhoneNumberAndText(t *testing.T) {
+	for in, want := range map[string]string{
+		knownNumber:       "***3210",
+		"+91 98765 43210": "***3210",
+		"1234":            "***",
+		"":                "***",
+	} {
+		if got := PhoneNumber(in); got != want {
+			t.Errorf("PhoneNumber(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if a, b := Text("hello"), Text("hellp"); a == b || !strings.HasPrefix(a, "[5 chars sha256:") {
+		t.Errorf("Text(hello) = %q and Text(hellp) = %q; want the length and distinct hashes", a, b)
+	}
+	if got := Text("नमस्ते"); !strings.HasPrefix(got, "[6 chars ") {
+		t.Errorf("Text counts %q, want 6 characters", got)
+	}
+}
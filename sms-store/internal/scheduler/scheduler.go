@@ -0,0 +1,256 @@
+// Package scheduler runs the server's periodic tasks in process: each task
+// is registered under a name with a Schedule, and runs at most once at a
+// time until the scheduler is stopped.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+)
+
+var (
+	ErrUnknownTask = errors.New("unknown task")
+	ErrRunning     = errors.New("task is already running")
+	ErrStopped     = errors.New("scheduler is stopped")
+)
+
+var taskRuns = metrics.NewCounterVec(
+	"scheduler_task_runs_total",
+	"Runs of scheduled tasks, by task and outcome (success or failure).",
+	"task", "outcome",
+)
+
+// Func is the body of a task. It should return promptly once ctx is
+// cancelled, which happens when the scheduler stops.
+type Func func(ctx context.Context) error
+
+// Status is what a Scheduler knows about one of its tasks.
+type Status struct {
+	Name         string    `json:"name"`
+	Schedule     string    `json:"schedule"`
+	Running      bool      `json:"running"`
+	Runs         int64     `json:"runs"`
+	LastRun      time.Time `json:"lastRun,omitzero"` // When the last finished run started
+	LastDuration string    `json:"lastDuration,omitempty"`
+	LastError    string    `json:"lastError,omitempty"` // Empty if the last run succeeded
+	NextRun      time.Time `json:"nextRun,omitzero"`    // Zero before Start, and once the schedule has no more runs
+}
+
+// Scheduler runs registered tasks on their schedules. A task whose previous
+// run hasn't finished skips its turn, whether that run is scheduled or was
+// triggered by hand. A task that panics fails that run only.
+type Scheduler struct {
+	clock  clock.Clock
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	tasks   map[string]*task
+	order   []*task // Registration order
+	started bool
+	stopped bool
+}
+
+type task struct {
+	name     string
+	schedule Schedule
+	fn       Func
+
+	// Guarded by Scheduler.mu
+	running bool
+	status  Status
+}
+
+// New creates a scheduler on the system clock.
+func New() *Scheduler {
+	return NewWithClock(clock.Real{})
+}
+
+// NewWithClock creates a scheduler on c, such as a clocktest.Fake.
+func NewWithClock(c clock.Clock) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		clock:  c,
+		ctx:    ctx,
+		cancel: cancel,
+		tasks:  make(map[string]*task),
+	}
+}
+
+// Register adds a task. Names must be unique. A task registered after Start
+// is scheduled at once.
+func (s *Scheduler) Register(name string, schedule Schedule, fn Func) error {
+	if name == "" {
+		return errors.New("task name is required")
+	}
+	now := s.clock.Now()
+	if next := schedule.Next(now); !next.IsZero() && !next.After(now) {
+		return fmt.Errorf("task %s: schedule %s does not advance", name, schedule)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrStopped
+	}
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("task %s is already registered", name)
+	}
+	t := &task{name: name, schedule: schedule, fn: fn, status: Status{Name: name, Schedule: schedule.String()}}
+	s.tasks[name] = t
+	s.order = append(s.order, t)
+	if s.started {
+		s.startLoop(t)
+	}
+	return nil
+}
+
+// Start schedules the registered tasks.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, t := range s.order {
+		s.startLoop(t)
+	}
+}
+
+// Stop cancels running tasks and waits for them to return. The scheduler
+// can't be started again.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Trigger starts a run of the named task now, in the background, and
+// returns its status. The task's schedule is unchanged.
+func (s *Scheduler) Trigger(name string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[name]
+	switch {
+	case !ok:
+		return Status{}, fmt.Errorf("%w: %s", ErrUnknownTask, name)
+	case s.stopped:
+		return Status{}, ErrStopped
+	case t.running:
+		return t.snapshot(), ErrRunning
+	}
+
+	t.running = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(t)
+	}()
+	return t.snapshot(), nil
+}
+
+// Tasks returns the status of every task, in the order they were
+// registered.
+func (s *Scheduler) Tasks() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Status, len(s.order))
+	for i, t := range s.order {
+		list[i] = t.snapshot()
+	}
+	return list
+}
+
+// startLoop runs t's schedule in a goroutine. s.mu must be held.
+func (s *Scheduler) startLoop(t *task) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(t)
+	}()
+}
+
+func (s *Scheduler) loop(t *task) {
+	for {
+		now := s.clock.Now()
+		next := t.schedule.Next(now)
+		s.mu.Lock()
+		t.status.NextRun = next
+		s.mu.Unlock()
+
+		var due <-chan time.Time // Never ready once the schedule has no more runs
+		if !next.IsZero() {
+			due = s.clock.After(next.Sub(now))
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-due:
+		}
+
+		s.mu.Lock()
+		busy := t.running
+		t.running = true
+		s.mu.Unlock()
+		if busy {
+			log.Printf("Skipping scheduled task %s: previous run still going", t.name)
+			continue
+		}
+		s.execute(t)
+	}
+}
+
+// execute runs t, which the caller marked running, and records the outcome.
+func (s *Scheduler) execute(t *task) {
+	start := s.clock.Now()
+	err := call(s.ctx, t)
+	elapsed := s.clock.Now().Sub(start)
+
+	s.mu.Lock()
+	t.running = false
+	t.status.Runs++
+	t.status.LastRun = start
+	t.status.LastDuration = elapsed.String()
+	t.status.LastError = ""
+	if err != nil {
+		t.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		taskRuns.WithLabelValues(t.name, "failure").Inc()
+		log.Printf("Scheduled task %s failed: %v", t.name, err)
+		return
+	}
+	taskRuns.WithLabelValues(t.name, "success").Inc()
+}
+
+// call runs t's function, turning a panic into a failed run.
+func call(ctx context.Context, t *task) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("Scheduled task %s panicked: %v", t.name, rec)
+			err = errors.New("task panicked")
+		}
+	}()
+	return t.fn(ctx)
+}
+
+// snapshot returns t's status. Scheduler.mu must be held.
+func (t *task) snapshot() Status {
+	status := t.status
+	status.Running = t.running
+	return status
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+)
+
+var start = time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+// waitForStatus polls the task's status until ok accepts it.
+func waitForStatus(t *testing.T, s *Scheduler, ok func(Status) bool) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := s.Tasks()[0]
+		if ok(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %+v", status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerRunsOnTheClock(t *testing.T) {
+	fake := clocktest.NewFake(start)
+	s := NewWithClock(fake)
+	defer s.Stop()
+	ran := make(chan time.Time, 4)
+	if err := s.Register("tick", Every(time.Minute), func(ctx context.Context) error {
+		ran <- fake.Now()
+		return nil
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if got := s.Tasks()[0]; !got.NextRun.IsZero() {
+		t.Fatalf("NextRun before Start = %v", got.NextRun)
+	}
+	s.Start()
+
+	fake.BlockUntil(1)
+	if got := s.Tasks()[0].NextRun; !got.Equal(start.Add(time.Minute)) {
+		t.Fatalf("NextRun = %v, want a minute on", got)
+	}
+	fake.Advance(30 * time.Second)
+	select {
+	case <-ran:
+		t.Fatal("ran before it was due")
+	default:
+	}
+
+	// Due at 12:01, then a minute after that wait ended
+	for i, d := range []time.Duration{30 * time.Second, time.Minute} {
+		fake.Advance(d)
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %d didn't happen", i+1)
+		}
+		fake.BlockUntil(1)
+	}
+	status := s.Tasks()[0]
+	if status.Runs != 2 || status.LastError != "" || !status.LastRun.Equal(start.Add(2*time.Minute)) || !status.NextRun.Equal(start.Add(3*time.Minute)) {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestSchedulerSkipsBusyTask(t *testing.T) {
+	fake := clocktest.NewFake(start)
+	s := NewWithClock(fake)
+	defer s.Stop()
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	if err := s.Register("slow", Every(time.Minute), func(ctx context.Context) error {
+		started <- struct{}{}
+		<-release
+		return errors.New("gave up")
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	s.Start()
+	fake.BlockUntil(1)
+
+	if status, err := s.Trigger("slow"); err != nil || !status.Running {
+		t.Fatalf("Trigger = %+v, %v", status, err)
+	}
+	if _, err := s.Trigger("slow"); !errors.Is(err, ErrRunning) {
+		t.Fatalf("Trigger while running = %v, want ErrRunning", err)
+	}
+	<-started
+
+	// The scheduled turn comes while the triggered run is going, and is
+	// skipped
+	fake.Advance(time.Minute)
+	fake.BlockUntil(1)
+	close(release)
+	status := waitForStatus(t, s, func(st Status) bool { return !st.Running })
+	if status.Runs != 1 || status.LastError != "gave up" || !status.LastRun.Equal(start) {
+		t.Fatalf("status = %+v, want the one triggered run", status)
+	}
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	s := NewWithClock(clocktest.NewFake(start))
+	defer s.Stop()
+	if err := s.Register("bad", Every(time.Hour), func(ctx context.Context) error {
+		panic("boom")
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := s.Trigger("bad"); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	if status := waitForStatus(t, s, func(st Status) bool { return st.Runs == 1 }); status.LastError != "task panicked" {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestSchedulerStopCancelsRuns(t *testing.T) {
+	s := NewWithClock(clocktest.NewFake(start))
+	started := make(chan struct{})
+	if err := s.Register("wait", Every(time.Hour), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	s.Start()
+	if _, err := s.Trigger("wait"); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	<-started
+	s.Stop()
+
+	if status := s.Tasks()[0]; status.Running || status.LastError != context.Canceled.Error() {
+		t.Fatalf("status after Stop = %+v", status)
+	}
+	if _, err := s.Trigger("wait"); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Trigger after Stop = %v, want ErrStopped", err)
+	}
+	if err := s.Register("late", Every(time.Hour), nil); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Register after Stop = %v, want ErrStopped", err)
+	}
+}
+
+func TestRegisterValidates(t *testing.T) {
+	s := NewWithClock(clocktest.NewFake(start))
+	defer s.Stop()
+	noop := func(context.Context) error { return nil }
+	if err := s.Register("", Every(time.Hour), noop); err == nil {
+		t.Fatal("registered a task without a name")
+	}
+	if err := s.Register("stuck", Every(0), noop); err == nil {
+		t.Fatal("registered a schedule that doesn't advance")
+	}
+	if err := s.Register("a", Every(time.Hour), noop); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := s.Register("a", Every(time.Hour), noop); err == nil {
+		t.Fatal("registered a name twice")
+	}
+	if _, err := s.Trigger("b"); !errors.Is(err, ErrUnknownTask) {
+		t.Fatalf("Trigger of an unknown task = %v", err)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	after := time.Date(2026, 10, 14, 12, 34, 56, 0, time.UTC)
+	for _, tc := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"90s", after.Add(90 * time.Second)},
+		{"* * * * *", time.Date(2026, 10, 14, 12, 35, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 14, 12, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{"0 0 20 * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		schedule, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", tc.spec, err)
+		}
+		if got := schedule.Next(after); !got.Equal(tc.want) {
+			t.Errorf("%s: Next = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+
+	for _, spec := range []string{"-1m", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", spec)
+		}
+	}
+}
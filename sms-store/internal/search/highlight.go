@@ -0,0 +1,106 @@
+// Package search holds text matching helpers shared by the search endpoints.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Range is a highlighted span measured in runes (not bytes), so clients can
+// index into the text the same way regardless of encoding.
+type Range struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// FindAll returns every non-overlapping case-insensitive occurrence of query in text.
+// Comparison is rune by rune with Unicode simple case folding, so offsets stay
+// aligned with the original text even for runes whose lowercase form differs in length.
+func FindAll(text, query string) []Range {
+	t := []rune(text)
+	q := []rune(strings.TrimSpace(query))
+	if len(q) == 0 || len(q) > len(t) {
+		return nil
+	}
+
+	var ranges []Range
+	for i := 0; i+len(q) <= len(t); {
+		if matchAt(t, q, i) {
+			ranges = append(ranges, Range{Start: i, Length: len(q)})
+			i += len(q)
+			continue
+		}
+		i++
+	}
+	return ranges
+}
+
+// Contains reports whether text contains query, ignoring case.
+func Contains(text, query string) bool {
+	return len(FindAll(text, query)) > 0
+}
+
+func matchAt(t, q []rune, i int) bool {
+	for j, r := range q {
+		if !equalFold(t[i+j], r) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Snippet cuts a window of at most width runes around the first match and
+// returns it with highlight ranges rebased onto the snippet. Ellipses mark
+// truncated edges and are accounted for in the offsets.
+func Snippet(text, query string, width int) (string, []Range) {
+	matches := FindAll(text, query)
+	t := []rune(text)
+	if len(t) <= width || len(matches) == 0 {
+		if len(t) > width {
+			return string(t[:width]) + "…", nil
+		}
+		return text, matches
+	}
+
+	// Start a little before the first match so it has some context
+	start := matches[0].Start - width/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(t) {
+		end = len(t)
+		start = end - width
+	}
+
+	var b strings.Builder
+	offset := start
+	if start > 0 {
+		b.WriteString("…")
+		offset-- // the ellipsis occupies one rune
+	}
+	b.WriteString(string(t[start:end]))
+	if end < len(t) {
+		b.WriteString("…")
+	}
+
+	var ranges []Range
+	for _, m := range matches {
+		if m.Start >= start && m.Start+m.Length <= end {
+			ranges = append(ranges, Range{Start: m.Start - offset, Length: m.Length})
+		}
+	}
+	return b.String(), ranges
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MinGram is the shortest prefix stored for prefix search, matching the
+// shortest query the search endpoint accepts.
+const MinGram = 2
+
+// Tokenizer turns message text into the lowercase edge n-grams stored for
+// prefix search: the prefixes of each word from MinGram up to MaxGram runes.
+type Tokenizer struct {
+	MaxGram   int // Longest prefix stored; longer query words match on it and are checked against the text
+	MaxTokens int // Most tokens stored per message, bounding the index size
+}
+
+// Tokens returns the distinct prefixes of text's words, shortest first
+// across all words, so a message over MaxTokens keeps every word
+// searchable by its first letters and loses only its longest prefixes.
+func (t Tokenizer) Tokens(text string) []string {
+	words := splitWords(text)
+	seen := make(map[string]bool)
+	tokens := make([]string, 0)
+	for n := MinGram; n <= t.MaxGram; n++ {
+		grew := false
+		for _, w := range words {
+			if len(w) < n {
+				continue
+			}
+			grew = true
+			token := string(w[:n])
+			if seen[token] {
+				continue
+			}
+			if len(tokens) == t.MaxTokens {
+				return tokens
+			}
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+		if !grew {
+			break
+		}
+	}
+	return tokens
+}
+
+// QueryTokens returns the tokens a message must have to match query as a
+// prefix search: each query word, cut to MaxGram runes. Words shorter than
+// MinGram are ignored; nil means nothing in query is searchable.
+func (t Tokenizer) QueryTokens(query string) []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, w := range splitWords(query) {
+		if len(w) < MinGram {
+			continue
+		}
+		token := string(w[:min(len(w), t.MaxGram)])
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// MatchesPrefixes reports whether every searchable word of query starts a
+// word of text, ignoring case. It confirms matches for query words longer
+// than the stored prefixes.
+func MatchesPrefixes(text, query string) bool {
+	words := splitWords(text)
+	for _, q := range splitWords(query) {
+		if len(q) < MinGram {
+			continue
+		}
+		found := false
+		for _, w := range words {
+			if len(w) >= len(q) && string(w[:len(q)]) == string(q) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// splitWords lowercases s and splits it into runs of letters and digits.
+func splitWords(s string) [][]rune {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words := make([][]rune, len(fields))
+	for i, f := range fields {
+		words[i] = []rune(f)
+	}
+	return words
+}
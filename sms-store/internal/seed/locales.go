@@ -0,0 +1,115 @@
+package seed
+
+import (
+	"maps"
+	"slices"
+)
+
+// DefaultLocale is the locale of runs that don't name one.
+const DefaultLocale = "en-IN"
+
+// locale is the names and texts of one locale.
+type locale struct {
+	firstNames []string
+	lastNames  []string
+	scripts    [][]line // Exchanges a conversation is made of, one after another
+}
+
+// line is one message of a script.
+type line struct {
+	inbound bool // Sent by the conversation's number rather than to it
+	text    string
+}
+
+// Locales returns the locales there are names and texts for, sorted.
+func Locales() []string {
+	return slices.Sorted(maps.Keys(locales))
+}
+
+func out(text string) line { return line{text: text} }
+func in(text string) line  { return line{inbound: true, text: text} }
+
+var locales = map[string]*locale{
+	"en-IN": {
+		firstNames: []string{"Aarav", "Ananya", "Arjun", "Diya", "Ishaan", "Kavya", "Meera", "Neha", "Priya", "Rahul", "Rohan", "Sneha", "Tanvi", "Vikram", "Zoya"},
+		lastNames:  []string{"Agarwal", "Bose", "Das", "Gupta", "Iyer", "Joshi", "Kapoor", "Menon", "Nair", "Patel", "Reddy", "Shah", "Singh", "Verma"},
+		scripts: [][]line{
+			{
+				out("Your order has been shipped and will be delivered by tomorrow."),
+				in("Great, can it come after 6 pm?"),
+				out("Sure, we have noted your preferred delivery time."),
+			},
+			{
+				out("Your OTP for login is 482913. Do not share it with anyone."),
+			},
+			{
+				out("Your payment was successful. Thank you for shopping with us!"),
+				in("Thanks. When will I get the invoice?"),
+				out("The invoice has been sent to your registered email address."),
+			},
+			{
+				in("Hi, my parcel still hasn't arrived."),
+				out("Sorry for the delay. Your parcel is out for delivery and will reach you today."),
+				in("Okay, thank you."),
+			},
+			{
+				out("Your refund has been processed and will reach your account in 5-7 working days."),
+			},
+			{
+				in("The product I received is damaged."),
+				out("We are sorry about that. You can request a replacement from the orders page."),
+				in("Done, I have raised the request."),
+				out("Thanks! Our team will pick up the item within two days."),
+			},
+			{
+				out("Flash sale starts tonight at 8 pm. Up to 60% off on your wishlist."),
+			},
+			{
+				out("Rate your recent delivery experience from 1 to 5."),
+				in("5"),
+				out("Thank you for your feedback!"),
+			},
+		},
+	},
+	"hi-IN": {
+		firstNames: []string{"Aditi", "Amit", "Deepak", "Geeta", "Kiran", "Manoj", "Nisha", "Pooja", "Rajesh", "Ritu", "Sanjay", "Sunita", "Suresh", "Usha"},
+		lastNames:  []string{"Chauhan", "Dubey", "Mishra", "Pandey", "Rathore", "Saxena", "Sharma", "Shukla", "Tiwari", "Tripathi", "Yadav"},
+		scripts: [][]line{
+			{
+				out("Aapka order ship ho gaya hai aur kal tak deliver ho jayega."),
+				in("Theek hai, sham ko 6 baje ke baad bhejna."),
+				out("Ji zaroor, humne aapka samay note kar liya hai."),
+			},
+			{
+				out("Aapka login OTP 482913 hai. Ise kisi ke saath share na karein."),
+			},
+			{
+				out("Aapka payment safal raha. Humse kharidari karne ke liye dhanyavaad!"),
+				in("Invoice kab milega?"),
+				out("Invoice aapke registered email par bhej diya gaya hai."),
+			},
+			{
+				in("Bhaiya mera parcel abhi tak nahi aaya."),
+				out("Deri ke liye maaf kijiye. Aapka parcel aaj deliver ho jayega."),
+				in("Accha, shukriya."),
+			},
+			{
+				out("आपका रिफंड प्रोसेस हो गया है, 5-7 दिनों में आपके खाते में आ जाएगा।"),
+			},
+			{
+				in("Mujhe jo product mila hai woh toota hua hai."),
+				out("Maaf kijiye. Aap orders page se replacement maang sakte hain."),
+				in("Maine request daal di hai."),
+				out("Dhanyavaad! Hamari team do din mein saamaan le jayegi."),
+			},
+			{
+				out("आज रात 8 बजे से फ्लैश सेल! आपकी विशलिस्ट पर 60% तक की छूट।"),
+			},
+			{
+				out("Apni delivery ko 1 se 5 tak rating dein."),
+				in("5"),
+				out("Aapke feedback ke liye dhanyavaad!"),
+			},
+		},
+	},
+}
@@ -0,0 +1,143 @@
+// Package seed generates synthetic conversations for demos and load tests:
+// profiles with made-up names and messages that read like the order,
+// delivery and support traffic this service stores. The same seed always
+// generates the same data, so a demo can be set up again exactly.
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// Limits of one run.
+const (
+	MaxConversations               = 1000
+	MaxMessagesPerConversation     = 500
+	DefaultConversations           = 20
+	DefaultMessagesPerConversation = 30
+)
+
+// Options describe what a Generator generates.
+type Options struct {
+	Seed                    int64
+	Conversations           int
+	MessagesPerConversation int
+	From, To                time.Time // Messages are spread over [From, To)
+	Locale                  string    // One of Locales(); DefaultLocale when empty
+	AccountID               string
+}
+
+// Conversation is one generated conversation: the profile of its number
+// and its messages, oldest first.
+type Conversation struct {
+	Profile  models.Profile
+	Messages []models.Message
+}
+
+// Generator generates the conversations of one seed.
+type Generator struct {
+	opts   Options
+	locale *locale
+	base   uint64 // Number of the first conversation, after SeedPhonePrefix
+	marker string
+}
+
+// numberSpace is how many numbers follow SeedPhonePrefix.
+const numberSpace = 1_000_000_000
+
+// New returns a generator for opts, or an error naming the first option
+// out of range.
+func New(opts Options) (*Generator, error) {
+	if opts.Locale == "" {
+		opts.Locale = DefaultLocale
+	}
+	loc, ok := locales[opts.Locale]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unknown locale %q", opts.Locale)
+	case opts.Conversations < 1 || opts.Conversations > MaxConversations:
+		return nil, fmt.Errorf("conversations must be between 1 and %d", MaxConversations)
+	case opts.MessagesPerConversation < 1 || opts.MessagesPerConversation > MaxMessagesPerConversation:
+		return nil, fmt.Errorf("messagesPerConversation must be between 1 and %d", MaxMessagesPerConversation)
+	case !opts.From.Before(opts.To):
+		return nil, errors.New("from must be before to")
+	}
+
+	// Each seed gets its own run of numbers, so two seeds rarely share one
+	rng := rand.New(rand.NewPCG(uint64(opts.Seed), 0))
+	return &Generator{
+		opts:   opts,
+		locale: loc,
+		base:   rng.Uint64N(numberSpace - MaxConversations),
+		marker: Marker(opts.Seed),
+	}, nil
+}
+
+// Marker returns the Seed of the messages generated with seed.
+func Marker(seed int64) string {
+	return fmt.Sprintf("seed-%d", seed)
+}
+
+// Total returns the number of messages the generator generates.
+func (g *Generator) Total() int64 {
+	return int64(g.opts.Conversations) * int64(g.opts.MessagesPerConversation)
+}
+
+// Conversation generates conversation i of the seed, from 0, at now. It
+// depends only on the options and i, never on the conversations generated
+// before it.
+func (g *Generator) Conversation(i int, now time.Time) Conversation {
+	rng := rand.New(rand.NewPCG(uint64(g.opts.Seed), uint64(i)+1))
+	phoneNumber := fmt.Sprintf("%s%09d", models.SeedPhonePrefix, g.base+uint64(i))
+
+	profile := models.Profile{
+		PhoneNumber: phoneNumber,
+		Name:        pick(rng, g.locale.firstNames) + " " + pick(rng, g.locale.lastNames),
+		Source:      models.ProfileSourceSeed,
+	}
+
+	n := g.opts.MessagesPerConversation
+	span := g.opts.To.Sub(g.opts.From)
+	times := make([]time.Time, n)
+	for j := range times {
+		times[j] = g.opts.From.Add(time.Duration(rng.Int64N(int64(span)))).Truncate(time.Millisecond)
+	}
+	slices.SortFunc(times, time.Time.Compare)
+
+	msgs := make([]models.Message, n)
+	var script []line
+	for j := range msgs {
+		if len(script) == 0 {
+			script = pick(rng, g.locale.scripts)
+		}
+		l := script[0]
+		script = script[1:]
+
+		msg := models.Message{
+			ID:          fmt.Sprintf("msg-%s-%04d-%04d", g.marker, i, j),
+			PhoneNumber: phoneNumber,
+			SenderType:  models.ClassifySender(phoneNumber),
+			Text:        l.text,
+			Status:      "SUCCESS",
+			CreatedAt:   times[j],
+			ReceivedAt:  now,
+			AccountID:   g.opts.AccountID,
+			Seed:        g.marker,
+		}
+		if l.inbound {
+			msg.Direction = models.DirectionInbound
+			msg.Status = "RECEIVED"
+		}
+		msgs[j] = msg
+	}
+	return Conversation{Profile: profile, Messages: msgs}
+}
+
+func pick[T any](rng *rand.Rand, items []T) T {
+	return items[rng.IntN(len(items))]
+}
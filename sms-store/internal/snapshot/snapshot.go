@@ -0,0 +1,237 @@
+// Package snapshot captures compact snapshots of a conversation and diffs
+// them, to tell what changed when messages are reported missing. A
+// snapshot holds a hash of every message, and a rollup of those hashes into
+// buckets by message ID: messages of two states are compared by their
+// entries when both snapshots kept them, and by their buckets otherwise,
+// the way a Merkle tree narrows a difference down without holding
+// everything.
+package snapshot
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// hashLength is how many hex digits of a SHA-256 entries and buckets keep.
+const hashLength = 16
+
+// Builder collects the messages of a snapshot. Messages can be added a page
+// at a time; only their IDs and hashes are kept.
+type Builder struct {
+	maxEntries int
+	buckets    map[string][]models.SnapshotEntry
+	live       int64
+	archived   int64
+}
+
+// NewBuilder returns a builder of snapshots that keep the entries of at
+// most maxEntries messages, rolling up larger ones; 0 keeps every entry.
+func NewBuilder(maxEntries int) *Builder {
+	return &Builder{maxEntries: maxEntries, buckets: make(map[string][]models.SnapshotEntry)}
+}
+
+// Add adds msg, from the archive when archived is true. A message moved to
+// the archive hashes differently, so it shows as modified.
+func (b *Builder) Add(msg models.Message, archived bool) error {
+	hash, err := messageHash(msg, archived)
+	if err != nil {
+		return err
+	}
+	key := bucketKey(msg.ID)
+	b.buckets[key] = append(b.buckets[key], models.SnapshotEntry{ID: msg.ID, Hash: hash})
+	if archived {
+		b.archived++
+	} else {
+		b.live++
+	}
+	return nil
+}
+
+// Snapshot returns the snapshot of the messages added of phoneNumber, with
+// summary. Its ID and times are left for the caller.
+func (b *Builder) Snapshot(phoneNumber string, summary *models.SnapshotSummary) models.ConversationSnapshot {
+	snap := models.ConversationSnapshot{
+		PhoneNumber:      phoneNumber,
+		Messages:         b.live,
+		ArchivedMessages: b.archived,
+		Summary:          summary,
+		Buckets:          []models.SnapshotBucket{},
+	}
+	root := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(b.buckets)) {
+		entries := b.buckets[key]
+		slices.SortFunc(entries, func(a, b models.SnapshotEntry) int { return cmp.Compare(a.ID, b.ID) })
+		bucket := models.SnapshotBucket{Key: key, Count: len(entries), Hash: entriesHash(entries)}
+		snap.Buckets = append(snap.Buckets, bucket)
+		fmt.Fprintf(root, "%s %d %s\n", bucket.Key, bucket.Count, bucket.Hash)
+		snap.Entries = append(snap.Entries, entries...)
+	}
+	snap.RootHash = hex.EncodeToString(root.Sum(nil))
+	if b.maxEntries > 0 && len(snap.Entries) > b.maxEntries {
+		snap.Entries, snap.RolledUp = nil, true
+	}
+	slices.SortFunc(snap.Entries, func(a, b models.SnapshotEntry) int { return cmp.Compare(a.ID, b.ID) })
+	return snap
+}
+
+// messageHash hashes every field of msg, so any change to a stored message
+// changes it.
+func messageHash(msg models.Message, archived bool) (string, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash message %s: %w", msg.ID, err)
+	}
+	h := sha256.New()
+	if archived {
+		h.Write([]byte("archived\n"))
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))[:hashLength], nil
+}
+
+// bucketKey returns the bucket of a message ID: the first byte of its hash,
+// so messages spread evenly over 256 buckets whatever their IDs look like.
+func bucketKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:1])
+}
+
+func entriesHash(entries []models.SnapshotEntry) string {
+	h := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s %s\n", e.ID, e.Hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:hashLength]
+}
+
+// Live names the current state of a conversation, as the side of a Diff.
+const Live = "live"
+
+// Side describes one of the states a Diff compares.
+type Side struct {
+	Snapshot         string                  `json:"snapshot"` // Its ID, or Live
+	At               time.Time               `json:"at"`       // When it was taken
+	Messages         int64                   `json:"messages"`
+	ArchivedMessages int64                   `json:"archivedMessages"`
+	Summary          *models.SnapshotSummary `json:"summary,omitempty"`
+	RootHash         string                  `json:"rootHash"`
+	RolledUp         bool                    `json:"rolledUp"`
+}
+
+// BucketChange is a bucket whose messages differ between two states, when
+// one of them was rolled up and the messages can't be told apart.
+type BucketChange struct {
+	Key       string `json:"key"`
+	FromCount int    `json:"fromCount"`
+	ToCount   int    `json:"toCount"`
+}
+
+// Diff is what changed between two states of a conversation. When both
+// kept their entries it lists the message IDs added, removed and modified;
+// otherwise Exact is false and ChangedBuckets narrows the changes down to
+// the buckets that differ.
+type Diff struct {
+	PhoneNumber    string         `json:"phoneNumber"`
+	From           Side           `json:"from"`
+	To             Side           `json:"to"`
+	Identical      bool           `json:"identical"` // Same messages, by the root hashes
+	SummaryChanged bool           `json:"summaryChanged"`
+	Exact          bool           `json:"exact"`
+	Added          []string       `json:"added"`
+	Removed        []string       `json:"removed"`
+	Modified       []string       `json:"modified"`
+	ChangedBuckets []BucketChange `json:"changedBuckets,omitempty"`
+}
+
+// Compare returns the diff from one snapshot to another. A snapshot
+// without an ID is of the live state.
+func Compare(fromSnap, toSnap models.ConversationSnapshot) Diff {
+	d := Diff{
+		PhoneNumber:    toSnap.PhoneNumber,
+		From:           side(fromSnap),
+		To:             side(toSnap),
+		Identical:      fromSnap.RootHash == toSnap.RootHash,
+		SummaryChanged: !equalSummaries(fromSnap.Summary, toSnap.Summary),
+		Exact:          !fromSnap.RolledUp && !toSnap.RolledUp,
+		Added:          []string{},
+		Removed:        []string{},
+		Modified:       []string{},
+	}
+	if d.Identical {
+		d.Exact = true
+		return d
+	}
+
+	if !d.Exact {
+		fromBuckets := make(map[string]models.SnapshotBucket, len(fromSnap.Buckets))
+		for _, b := range fromSnap.Buckets {
+			fromBuckets[b.Key] = b
+		}
+		toBuckets := make(map[string]models.SnapshotBucket, len(toSnap.Buckets))
+		for _, b := range toSnap.Buckets {
+			toBuckets[b.Key] = b
+		}
+		keys := slices.Sorted(maps.Keys(fromBuckets))
+		for key := range toBuckets {
+			if _, ok := fromBuckets[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if fromBuckets[key].Hash != toBuckets[key].Hash {
+				d.ChangedBuckets = append(d.ChangedBuckets, BucketChange{Key: key, FromCount: fromBuckets[key].Count, ToCount: toBuckets[key].Count})
+			}
+		}
+		return d
+	}
+
+	// Both are sorted by ID
+	i, j := 0, 0
+	for i < len(fromSnap.Entries) || j < len(toSnap.Entries) {
+		switch {
+		case j == len(toSnap.Entries) || i < len(fromSnap.Entries) && fromSnap.Entries[i].ID < toSnap.Entries[j].ID:
+			d.Removed = append(d.Removed, fromSnap.Entries[i].ID)
+			i++
+		case i == len(fromSnap.Entries) || toSnap.Entries[j].ID < fromSnap.Entries[i].ID:
+			d.Added = append(d.Added, toSnap.Entries[j].ID)
+			j++
+		default:
+			if fromSnap.Entries[i].Hash != toSnap.Entries[j].Hash {
+				d.Modified = append(d.Modified, toSnap.Entries[j].ID)
+			}
+			i++
+			j++
+		}
+	}
+	return d
+}
+
+func side(s models.ConversationSnapshot) Side {
+	return Side{
+		Snapshot:         cmp.Or(s.ID, Live),
+		At:               s.CreatedAt,
+		Messages:         s.Messages,
+		ArchivedMessages: s.ArchivedMessages,
+		Summary:          s.Summary,
+		RootHash:         s.RootHash,
+		RolledUp:         s.RolledUp,
+	}
+}
+
+func equalSummaries(a, b *models.SnapshotSummary) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.MessageCount == b.MessageCount && a.LastMessageID == b.LastMessageID &&
+		a.LastMessageAt.Equal(b.LastMessageAt) && strings.EqualFold(a.State, b.State)
+}
@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/models"
+)
+
+// Archiver moves old messages out of a Store's working set into a cold
+// archive and reads them back on request.
+type Archiver interface {
+	// ArchiveBatch moves up to limit messages created before cutoff, oldest
+	// first, into the archive and returns how many were moved. Calling it
+	// until it returns 0 archives everything before cutoff. A batch
+	// interrupted at any point is completed by the next call, without
+	// duplicating or losing messages.
+	ArchiveBatch(cutoff time.Time, limit int) (int64, error)
+
+	// FindArchivedByPhoneNumber retrieves all archived messages for a phone number.
+	FindArchivedByPhoneNumber(phoneNumber string) ([]models.Message, error)
+
+	// FindArchivedByID retrieves an archived message by its ID.
+	// Returns an error wrapping ErrNotFound if no archived message has that ID.
+	FindArchivedByID(id string) (models.Message, error)
+
+	// FindArchivedByPhoneNumberPage retrieves one page of archived messages,
+	// ordered as Store.FindByPhoneNumberPage.
+	FindArchivedByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error)
+
+	// GetArchivedPhoneNumbers retrieves the distinct phone numbers in the archive.
+	GetArchivedPhoneNumbers() ([]string, error)
+
+	// ConversationCounts returns live and archived message counts for each
+	// of phoneNumbers. Numbers without messages are omitted.
+	ConversationCounts(phoneNumbers []string) (map[string]ConversationCount, error)
+
+	// DeleteArchivedByPhoneNumber deletes all archived messages for a phone number.
+	DeleteArchivedByPhoneNumber(phoneNumber string) (int64, error)
+}
+
+// ConversationCount is the number of messages of one conversation.
+type ConversationCount struct {
+	MessageCount  int64 `json:"messageCount"`  // In the live collection
+	ArchivedCount int64 `json:"archivedCount"` // In the archive
+}
+
+// MongoArchive implements Archiver with a second collection next to a
+// MongoStore's messages collection.
+type MongoArchive struct {
+	live    *mongo.Collection
+	archive *mongo.Collection
+}
+
+// NewMongoArchive archives the messages of s into collectionName in the
+// same database.
+func NewMongoArchive(s *MongoStore, collectionName string) *MongoArchive {
+	archive := s.database.Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Archived messages are read per conversation, newest first. The
+	// collection gets no unique provider index: archived documents keep
+	// their _id, which is what makes a repeated batch detectable.
+	_, _ = archive.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "phoneNumber", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}},
+		Options: options.Index().SetName("phoneNumber_createdAt_id_idx"),
+	})
+
+	return &MongoArchive{live: s.collection, archive: archive}
+}
+
+// ArchiveBatch copies a batch into the archive with its original _id values,
+// verifies every document arrived, and only then deletes the originals. If a
+// previous run stopped after copying, the copy hits duplicate _id errors,
+// which are expected, and the batch carries on to verify and delete.
+func (a *MongoArchive) ArchiveBatch(cutoff time.Time, limit int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := a.live.Find(ctx, bson.M{"createdAt": bson.M{"$lt": cutoff}}, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select archive batch: %w", err)
+	}
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, fmt.Errorf("failed to decode archive batch: %w", err)
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	ids := make(bson.A, len(docs))
+	documents := make([]interface{}, len(docs))
+	for i, d := range docs {
+		ids[i] = d["_id"]
+		documents[i] = d
+	}
+
+	if _, err := a.archive.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false)); err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || !onlyDuplicateKeyErrors(bulkErr) {
+			return 0, fmt.Errorf("failed to copy archive batch: %w", err)
+		}
+	}
+
+	archived, err := a.archive.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify archive batch: %w", err)
+	}
+	if archived != int64(len(ids)) {
+		return 0, fmt.Errorf("archive batch verification failed: %d of %d messages in archive", archived, len(ids))
+	}
+
+	result, err := a.live.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete archived batch: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+func (a *MongoArchive) FindArchivedByPhoneNumber(phoneNumber string) ([]models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := a.archive.Find(ctx, bson.M{"phoneNumber": phoneNumber})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []models.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (a *MongoArchive) FindArchivedByID(id string) (models.Message, error) {
+	archive := &MongoStore{collection: a.archive}
+	return archive.FindByID(id)
+}
+
+// FindArchivedByPhoneNumberPage reuses MongoStore's page query, since the
+// archive has the messages collection's layout.
+func (a *MongoArchive) FindArchivedByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	archive := &MongoStore{collection: a.archive, limits: DefaultReadLimits()}
+	return archive.findPage("FindArchivedByPhoneNumberPage", bson.M{"phoneNumber": phoneNumber}, page)
+}
+
+func (a *MongoArchive) GetArchivedPhoneNumbers() ([]string, error) {
+	archive := &MongoStore{collection: a.archive}
+	return archive.GetDistinctPhoneNumbers()
+}
+
+func (a *MongoArchive) ConversationCounts(phoneNumbers []string) (map[string]ConversationCount, error) {
+	counts := make(map[string]ConversationCount)
+	if len(phoneNumbers) == 0 {
+		return counts, nil
+	}
+
+	live, err := countByPhoneNumber(a.live, phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := countByPhoneNumber(a.archive, phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	for pn, n := range live {
+		c := counts[pn]
+		c.MessageCount = n
+		counts[pn] = c
+	}
+	for pn, n := range archived {
+		c := counts[pn]
+		c.ArchivedCount = n
+		counts[pn] = c
+	}
+	return counts, nil
+}
+
+// countByPhoneNumber counts the messages of each of phoneNumbers in coll.
+func countByPhoneNumber(coll *mongo.Collection, phoneNumbers []string) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"phoneNumber": bson.M{"$in": phoneNumbers}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$phoneNumber", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages in %s: %w", coll.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		PhoneNumber string `bson:"_id"`
+		Count       int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.PhoneNumber] = row.Count
+	}
+	return counts, nil
+}
+
+func (a *MongoArchive) DeleteArchivedByPhoneNumber(phoneNumber string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := a.archive.DeleteMany(ctx, bson.M{"phoneNumber": phoneNumber})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// MemoryArchive implements Archiver for a MemoryStore.
+type MemoryArchive struct {
+	live     *MemoryStore
+	archived *MemoryStore
+}
+
+// NewMemoryArchive archives the messages of s in memory.
+func NewMemoryArchive(s *MemoryStore) *MemoryArchive {
+	return &MemoryArchive{live: s, archived: NewMemoryStore()}
+}
+
+func (a *MemoryArchive) ArchiveBatch(cutoff time.Time, limit int) (int64, error) {
+	a.live.mu.Lock()
+	defer a.live.mu.Unlock()
+
+	// Oldest first, matching MongoArchive
+	old := make([]*memoryEntry, 0)
+	for e := range a.live.entries() {
+		if e.msg.CreatedAt.Before(cutoff) {
+			old = append(old, e)
+		}
+	}
+	sort.SliceStable(old, func(i, j int) bool {
+		return old[i].msg.CreatedAt.Before(old[j].msg.CreatedAt)
+	})
+	if len(old) > limit {
+		old = old[:limit]
+	}
+
+	a.archived.mu.Lock()
+	defer a.archived.mu.Unlock()
+	for _, e := range old {
+		a.archived.insert(a.live.remove(e))
+	}
+	return int64(len(old)), nil
+}
+
+func (a *MemoryArchive) FindArchivedByPhoneNumber(phoneNumber string) ([]models.Message, error) {
+	return a.archived.FindByPhoneNumber(phoneNumber)
+}
+
+func (a *MemoryArchive) FindArchivedByID(id string) (models.Message, error) {
+	return a.archived.FindByID(id)
+}
+
+func (a *MemoryArchive) FindArchivedByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	return a.archived.FindByPhoneNumberPage(phoneNumber, page)
+}
+
+func (a *MemoryArchive) GetArchivedPhoneNumbers() ([]string, error) {
+	return a.archived.GetDistinctPhoneNumbers()
+}
+
+func (a *MemoryArchive) ConversationCounts(phoneNumbers []string) (map[string]ConversationCount, error) {
+	counts := make(map[string]ConversationCount)
+	for _, pn := range phoneNumbers {
+		live, _ := a.live.FindByPhoneNumber(pn)
+		archived, _ := a.archived.FindByPhoneNumber(pn)
+		if len(live) > 0 || len(archived) > 0 {
+			counts[pn] = ConversationCount{MessageCount: int64(len(live)), ArchivedCount: int64(len(archived))}
+		}
+	}
+	return counts, nil
+}
+
+func (a *MemoryArchive) DeleteArchivedByPhoneNumber(phoneNumber string) (int64, error) {
+	return a.archived.DeleteByPhoneNumber(phoneNumber)
+}
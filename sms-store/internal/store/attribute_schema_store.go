@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// AttributeSchemaStore keeps each account's schema of conversation custom
+// attributes.
+type AttributeSchemaStore interface {
+	// GetAttributeSchema returns the schema of accountID, empty if it has
+	// none.
+	GetAttributeSchema(accountID string) (models.AttributeSchema, error)
+
+	// PutAttributeSchema creates or replaces an account's schema.
+	PutAttributeSchema(schema models.AttributeSchema) (models.AttributeSchema, error)
+}
+
+// MongoAttributeSchemaStore implements AttributeSchemaStore with one
+// document per account.
+type MongoAttributeSchemaStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoAttributeSchemaStore keeps schemas in collectionName.
+func NewMongoAttributeSchemaStore(client *mongo.Client, databaseName, collectionName string) *MongoAttributeSchemaStore {
+	if collectionName == "" {
+		collectionName = "attribute_schemas"
+	}
+	return &MongoAttributeSchemaStore{collection: client.Database(databaseName).Collection(collectionName)}
+}
+
+func (s *MongoAttributeSchemaStore) GetAttributeSchema(accountID string) (models.AttributeSchema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var schema models.AttributeSchema
+	err := s.collection.FindOne(ctx, bson.M{"_id": accountID}).Decode(&schema)
+	if err == mongo.ErrNoDocuments {
+		return models.AttributeSchema{AccountID: accountID, Attributes: []models.AttributeDefinition{}}, nil
+	}
+	if err != nil {
+		return models.AttributeSchema{}, fmt.Errorf("failed to get attribute schema: %w", err)
+	}
+	return schema, nil
+}
+
+func (s *MongoAttributeSchemaStore) PutAttributeSchema(schema models.AttributeSchema) (models.AttributeSchema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	schema.UpdatedAt = s.Clock().Now()
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": schema.AccountID}, schema, opts); err != nil {
+		return models.AttributeSchema{}, fmt.Errorf("failed to save attribute schema: %w", err)
+	}
+	return schema, nil
+}
+
+// MemoryAttributeSchemaStore implements AttributeSchemaStore in memory.
+type MemoryAttributeSchemaStore struct {
+	mu      sync.Mutex
+	schemas map[string]models.AttributeSchema
+
+	clock.Clocked
+}
+
+func NewMemoryAttributeSchemaStore() *MemoryAttributeSchemaStore {
+	return &MemoryAttributeSchemaStore{schemas: make(map[string]models.AttributeSchema)}
+}
+
+func (s *MemoryAttributeSchemaStore) GetAttributeSchema(accountID string) (models.AttributeSchema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[accountID]
+	if !ok {
+		return models.AttributeSchema{AccountID: accountID, Attributes: []models.AttributeDefinition{}}, nil
+	}
+	schema.Attributes = slices.Clone(schema.Attributes)
+	return schema, nil
+}
+
+func (s *MemoryAttributeSchemaStore) PutAttributeSchema(schema models.AttributeSchema) (models.AttributeSchema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema.UpdatedAt = s.Clock().Now()
+	schema.Attributes = slices.Clone(schema.Attributes)
+	s.schemas[schema.AccountID] = schema
+	return schema, nil
+}
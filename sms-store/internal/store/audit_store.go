@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// defaultAuditLimit is how many entries ListAudit returns when the query
+// doesn't say.
+const defaultAuditLimit = 100
+
+// AuditQuery selects audit entries, newest first unless OldestFirst is
+// set. Empty fields match every entry.
+type AuditQuery struct {
+	AccountID   string
+	PhoneNumber string
+	Limit       int // Defaults to 100
+
+	// OldestFirst lists the entries oldest first. After and AfterID then
+	// continue a listing, restricting it to entries after that position:
+	// those at After are included only if their ID sorts after AfterID.
+	OldestFirst bool
+	After       time.Time
+	AfterID     string
+}
+
+// follows reports whether e comes after q's After and AfterID position.
+func (q AuditQuery) follows(e models.AuditEntry) bool {
+	return q.After.IsZero() || e.At.After(q.After) || (e.At.Equal(q.After) && e.ID > q.AfterID)
+}
+
+// AuditStore defines the interface for the audit log.
+type AuditStore interface {
+	// RecordAudit appends entry to the log, giving it an ID and, when unset,
+	// the current time.
+	RecordAudit(entry models.AuditEntry) (models.AuditEntry, error)
+
+	// ListAudit retrieves the entries matching q, in the order q asks for.
+	ListAudit(q AuditQuery) ([]models.AuditEntry, error)
+}
+
+// newAuditID returns a random ID for an audit entry.
+func newAuditID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "audit-" + time.Now().Format("20060102150405.000000000")
+	}
+	return "audit-" + hex.EncodeToString(b[:])
+}
+
+// MongoAuditStore implements the AuditStore interface using MongoDB.
+type MongoAuditStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoAuditStore creates a new MongoDB audit store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoAuditStore(client *mongo.Client, databaseName, collectionName string) *MongoAuditStore {
+	if collectionName == "" {
+		collectionName = "audit_log"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "phoneNumber", Value: 1}, {Key: "at", Value: -1}},
+		Options: options.Index().SetName("phoneNumber_at_idx"),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		log.Printf("Warning: could not ensure audit index on %s: %v", collectionName, err)
+	}
+
+	return &MongoAuditStore{collection: collection}
+}
+
+func (s *MongoAuditStore) RecordAudit(entry models.AuditEntry) (models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entry.ID = newAuditID()
+	if entry.At.IsZero() {
+		entry.At = s.Clock().Now()
+	}
+	if _, err := s.collection.InsertOne(ctx, entry); err != nil {
+		return models.AuditEntry{}, fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (s *MongoAuditStore) ListAudit(q AuditQuery) ([]models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if q.AccountID != "" {
+		filter["accountId"] = q.AccountID
+	}
+	if q.PhoneNumber != "" {
+		filter["phoneNumber"] = q.PhoneNumber
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultAuditLimit
+	}
+	order := -1
+	if q.OldestFirst {
+		order = 1
+		if !q.After.IsZero() {
+			filter["$or"] = bson.A{
+				bson.M{"at": bson.M{"$gt": q.After}},
+				bson.M{"at": q.After, "_id": bson.M{"$gt": q.AfterID}},
+			}
+		}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "at", Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(int64(q.Limit))
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]models.AuditEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// MemoryAuditStore implements the AuditStore interface in memory.
+type MemoryAuditStore struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry // Oldest first
+
+	clock.Clocked
+}
+
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{}
+}
+
+func (s *MemoryAuditStore) RecordAudit(entry models.AuditEntry) (models.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = newAuditID()
+	if entry.At.IsZero() {
+		entry.At = s.Clock().Now()
+	}
+	s.entries = append(s.entries, entry)
+	return entry, nil
+}
+
+func (s *MemoryAuditStore) ListAudit(q AuditQuery) ([]models.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q.Limit <= 0 {
+		q.Limit = defaultAuditLimit
+	}
+	out := make([]models.AuditEntry, 0)
+	if q.OldestFirst {
+		// Entries may be recorded with an earlier time than the last one
+		sorted := slices.SortedStableFunc(slices.Values(s.entries), func(a, b models.AuditEntry) int {
+			if c := a.At.Compare(b.At); c != 0 {
+				return c
+			}
+			return strings.Compare(a.ID, b.ID)
+		})
+		for _, e := range sorted {
+			if len(out) == q.Limit {
+				break
+			}
+			if (q.AccountID == "" || e.AccountID == q.AccountID) && (q.PhoneNumber == "" || e.PhoneNumber == q.PhoneNumber) && q.follows(e) {
+				out = append(out, e)
+			}
+		}
+		return out, nil
+	}
+	for _, e := range slices.Backward(s.entries) {
+		if len(out) == q.Limit {
+			break
+		}
+		if (q.AccountID == "" || e.AccountID == q.AccountID) && (q.PhoneNumber == "" || e.PhoneNumber == q.PhoneNumber) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// AutoAckStore keeps each account's automatic acknowledgement config.
+type AutoAckStore interface {
+	// GetAutoAckConfig returns the config of accountID, disabled if it has
+	// none.
+	GetAutoAckConfig(accountID string) (models.AutoAckConfig, error)
+
+	// PutAutoAckConfig creates or replaces an account's config.
+	PutAutoAckConfig(config models.AutoAckConfig) (models.AutoAckConfig, error)
+}
+
+// disabledAutoAck is the config of an account that has none.
+func disabledAutoAck(accountID string) models.AutoAckConfig {
+	return models.AutoAckConfig{AccountID: accountID, Window: models.DefaultAutoAckWindow.String()}
+}
+
+// MongoAutoAckStore implements AutoAckStore with one document per account.
+type MongoAutoAckStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoAutoAckStore keeps configs in collectionName.
+func NewMongoAutoAckStore(client *mongo.Client, databaseName, collectionName string) *MongoAutoAckStore {
+	if collectionName == "" {
+		collectionName = "auto_ack_configs"
+	}
+	return &MongoAutoAckStore{collection: client.Database(databaseName).Collection(collectionName)}
+}
+
+func (s *MongoAutoAckStore) GetAutoAckConfig(accountID string) (models.AutoAckConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var config models.AutoAckConfig
+	err := s.collection.FindOne(ctx, bson.M{"_id": accountID}).Decode(&config)
+	if err == mongo.ErrNoDocuments {
+		return disabledAutoAck(accountID), nil
+	}
+	if err != nil {
+		return models.AutoAckConfig{}, fmt.Errorf("failed to get auto-ack config: %w", err)
+	}
+	return config, nil
+}
+
+func (s *MongoAutoAckStore) PutAutoAckConfig(config models.AutoAckConfig) (models.AutoAckConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	config.UpdatedAt = s.Clock().Now()
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": config.AccountID}, config, opts); err != nil {
+		return models.AutoAckConfig{}, fmt.Errorf("failed to save auto-ack config: %w", err)
+	}
+	return config, nil
+}
+
+// MemoryAutoAckStore implements AutoAckStore in memory.
+type MemoryAutoAckStore struct {
+	mu      sync.Mutex
+	configs map[string]models.AutoAckConfig
+
+	clock.Clocked
+}
+
+func NewMemoryAutoAckStore() *MemoryAutoAckStore {
+	return &MemoryAutoAckStore{configs: make(map[string]models.AutoAckConfig)}
+}
+
+func (s *MemoryAutoAckStore) GetAutoAckConfig(accountID string) (models.AutoAckConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, ok := s.configs[accountID]
+	if !ok {
+		return disabledAutoAck(accountID), nil
+	}
+	return config, nil
+}
+
+func (s *MemoryAutoAckStore) PutAutoAckConfig(config models.AutoAckConfig) (models.AutoAckConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config.UpdatedAt = s.Clock().Now()
+	s.configs[config.AccountID] = config
+	return config, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/models"
+)
+
+// AutoProfileLister pages through the profiles the ingestion pipeline
+// created, which the stale profile cleanup may delete.
+type AutoProfileLister interface {
+	// ListAutoProfiles retrieves up to limit profiles of source
+	// models.ProfileSourceAuto created before createdBefore and not merged
+	// into another, ordered by phone number, starting after the number
+	// after; "" starts from the first. Returns an empty slice when there
+	// are no more.
+	ListAutoProfiles(createdBefore time.Time, after string, limit int) ([]models.Profile, error)
+}
+
+// ListAutoProfiles reads a page of auto-created profiles in the order of
+// the unique phoneNumber index.
+func (s *MongoProfileStore) ListAutoProfiles(createdBefore time.Time, after string, limit int) ([]models.Profile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"source":    models.ProfileSourceAuto,
+		"createdAt": bson.M{"$lt": createdBefore},
+		"movedTo":   bson.M{"$exists": false},
+	}
+	if after != "" {
+		filter["phoneNumber"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "phoneNumber", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auto-created profiles: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	profiles := []models.Profile{}
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to decode profiles: %w", err)
+	}
+	return profiles, nil
+}
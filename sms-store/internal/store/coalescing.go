@@ -0,0 +1,438 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+var coalescedReads = metrics.NewCounterVec(
+	"store_coalesced_reads_total",
+	"Coalesced store reads, by operation and by how they were answered: executed by the store, shared with an identical read in flight, or reused within the window.",
+	"operation", "result",
+)
+
+// Coalescer lets identical concurrent reads share one store call: a read
+// arriving while the same one is in flight waits for it and gets its result,
+// and a successful result is reused for window after it is returned. Reads
+// are keyed by operation and normalized query, and each names the phone
+// numbers whose writes change it. CoalescingStore, CoalescingSummaryStore
+// and CoalescingProfileStore share one, so a message write also drops the
+// summaries of its conversation.
+//
+// A write through one of them drops the reads of its phone numbers before
+// it returns, in flight or not, so a read that starts once the write has
+// returned asks the store again. Reads joining a call before the write
+// still get that call's result, as they would had they run concurrently
+// with the write. Writes below the wrappers, such as archiving and
+// migrations, are seen within window.
+type Coalescer struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+	swept time.Time
+
+	clock.Clocked
+}
+
+// coalescedCall is a read in flight or, once expires is set, its result
+// kept for reuse.
+type coalescedCall struct {
+	scope   []string // Phone numbers whose writes change the result; nil for every one
+	done    chan struct{}
+	val     any
+	err     error
+	expires time.Time
+}
+
+// NewCoalescer returns a coalescer reusing results for window; 0 only
+// shares reads in flight.
+func NewCoalescer(window time.Duration) *Coalescer {
+	return &Coalescer{window: max(window, 0), calls: make(map[string]*coalescedCall)}
+}
+
+// coalesce answers the read op of query from an identical call in flight or
+// reused, or by calling fn. scope lists the phone numbers whose writes
+// change the result, nil for all of them. Every caller gets its own copy of
+// the result, made by clone, so none can change another's.
+func coalesce[T any](c *Coalescer, op, query string, scope []string, clone func(T) T, fn func() (T, error)) (T, error) {
+	key := op + "\x00" + query
+	now := c.Clock().Now()
+
+	c.mu.Lock()
+	c.sweep(now)
+	if call, ok := c.calls[key]; ok {
+		if call.expires.IsZero() {
+			c.mu.Unlock()
+			coalescedReads.WithLabelValues(op, "shared").Inc()
+			<-call.done
+			return cloneResult(call, clone)
+		}
+		if now.Before(call.expires) {
+			c.mu.Unlock()
+			coalescedReads.WithLabelValues(op, "reused").Inc()
+			return cloneResult(call, clone)
+		}
+		delete(c.calls, key)
+	}
+	call := &coalescedCall{scope: scope, done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+	coalescedReads.WithLabelValues(op, "executed").Inc()
+
+	returned := false
+	defer func() {
+		if !returned {
+			call.err = fmt.Errorf("coalesced %s panicked", op)
+		}
+		c.finish(key, call)
+	}()
+	val, err := fn()
+	call.val, call.err = val, err
+	returned = true
+	if err != nil {
+		return val, err
+	}
+	return clone(val), nil
+}
+
+func cloneResult[T any](call *coalescedCall, clone func(T) T) (T, error) {
+	if call.err != nil {
+		var zero T
+		if val, ok := call.val.(T); ok {
+			zero = val
+		}
+		return zero, call.err
+	}
+	return clone(call.val.(T)), nil
+}
+
+// finish wakes the readers waiting for call and keeps its result for
+// reuse, unless it failed or a write dropped it while it was in flight.
+func (c *Coalescer) finish(key string, call *coalescedCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls[key] == call {
+		if call.err == nil && c.window > 0 {
+			call.expires = c.Clock().Now().Add(c.window)
+		} else {
+			delete(c.calls, key)
+		}
+	}
+	close(call.done)
+}
+
+// sweep forgets the results whose window has passed, at most once a window.
+// c.mu must be held.
+func (c *Coalescer) sweep(now time.Time) {
+	if now.Sub(c.swept) < c.window {
+		return
+	}
+	c.swept = now
+	for key, call := range c.calls {
+		if !call.expires.IsZero() && !now.Before(call.expires) {
+			delete(c.calls, key)
+		}
+	}
+}
+
+// Forget drops the reads of phoneNumbers, and those of every conversation,
+// so they ask the store again.
+func (c *Coalescer) Forget(phoneNumbers ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, call := range c.calls {
+		if call.scope == nil || slices.ContainsFunc(call.scope, func(pn string) bool { return slices.Contains(phoneNumbers, pn) }) {
+			delete(c.calls, key)
+		}
+	}
+}
+
+// ForgetAll drops every read.
+func (c *Coalescer) ForgetAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.calls)
+}
+
+func cloneMessages(msgs []models.Message) []models.Message { return slices.Clone(msgs) }
+
+func identity[T any](v T) T { return v }
+
+// normalizedPhoneNumbers returns phoneNumbers sorted without repeats.
+func normalizedPhoneNumbers(phoneNumbers []string) []string {
+	return slices.Compact(slices.Sorted(slices.Values(phoneNumbers)))
+}
+
+/* ---------- messages ---------- */
+
+// CoalescingStore wraps a Store, coalescing its conversation reads with a
+// Coalescer: FindByPhoneNumber, the first page of FindByPhoneNumberPage and
+// GetDistinctPhoneNumbers. Its writes drop the reads they change.
+type CoalescingStore struct {
+	Store
+	coalescer *Coalescer
+}
+
+// NewCoalescingStore wraps s, coalescing its reads with c.
+func NewCoalescingStore(s Store, c *Coalescer) *CoalescingStore {
+	return &CoalescingStore{Store: s, coalescer: c}
+}
+
+func (s *CoalescingStore) FindByPhoneNumber(phoneNumber string) ([]models.Message, error) {
+	return coalesce(s.coalescer, "FindByPhoneNumber", phoneNumber, []string{phoneNumber}, cloneMessages, func() ([]models.Message, error) {
+		return s.Store.FindByPhoneNumber(phoneNumber)
+	})
+}
+
+// FindByPhoneNumberPage coalesces first pages, which every client opening
+// the conversation asks for; later pages go to the store.
+func (s *CoalescingStore) FindByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	if !page.Before.IsZero() || page.BeforeID != "" || !page.After.IsZero() || page.AfterID != "" {
+		return s.Store.FindByPhoneNumberPage(phoneNumber, page)
+	}
+	query := strings.Join([]string{phoneNumber, strconv.Itoa(page.Limit), strconv.FormatBool(page.OldestFirst), page.SenderID, page.Participant}, "\x00")
+	if page.ExternalRef != nil {
+		query += "\x00" + page.ExternalRef.Type + "\x00" + page.ExternalRef.ID
+	}
+	if page.Annotation != "" {
+		query += "\x00" + page.Annotation + "\x00" + strconv.FormatFloat(page.MinConfidence, 'g', -1, 64)
+	}
+	if page.Direction != "" {
+		query += "\x00direction:" + page.Direction
+	}
+	if len(page.Regions) > 0 {
+		query += "\x00regions:" + strconv.FormatBool(page.OutsideRegions) + ":" + strings.Join(page.Regions, ",")
+	}
+	return coalesce(s.coalescer, "FindByPhoneNumberPage", query, []string{phoneNumber}, cloneMessages, func() ([]models.Message, error) {
+		return s.Store.FindByPhoneNumberPage(phoneNumber, page)
+	})
+}
+
+// GetDistinctPhoneNumbers is changed by a write to any conversation.
+func (s *CoalescingStore) GetDistinctPhoneNumbers() ([]string, error) {
+	return coalesce(s.coalescer, "GetDistinctPhoneNumbers", "", nil, slices.Clone[[]string], s.Store.GetDistinctPhoneNumbers)
+}
+
+func (s *CoalescingStore) Save(msg models.Message) (models.Message, error) {
+	saved, err := s.Store.Save(msg)
+	s.coalescer.Forget(msg.PhoneNumber)
+	return saved, err
+}
+
+func (s *CoalescingStore) SaveBatch(msgs []models.Message) (int, error) {
+	n, err := s.Store.SaveBatch(msgs)
+	s.coalescer.Forget(batchPhoneNumbers(msgs)...)
+	return n, err
+}
+
+func (s *CoalescingStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	n, err := s.Store.DeleteByPhoneNumber(phoneNumber)
+	s.coalescer.Forget(phoneNumber)
+	return n, err
+}
+
+func (s *CoalescingStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	return s.forgetUpdated(s.Store.UpdateMessage(id, patch))
+}
+
+func (s *CoalescingStore) AddReaction(id string, reaction models.Reaction) (models.Message, error) {
+	return s.forgetUpdated(s.Store.AddReaction(id, reaction))
+}
+
+func (s *CoalescingStore) RemoveReaction(id, emoji, actor string) (models.Message, error) {
+	return s.forgetUpdated(s.Store.RemoveReaction(id, emoji, actor))
+}
+
+func (s *CoalescingStore) SetAnnotation(id string, annotation models.Annotation) (models.Message, error) {
+	return s.forgetUpdated(s.Store.SetAnnotation(id, annotation))
+}
+
+func (s *CoalescingStore) ReviewAnnotation(id, source string, review models.AnnotationReview) (models.Message, error) {
+	return s.forgetUpdated(s.Store.ReviewAnnotation(id, source, review))
+}
+
+func (s *CoalescingStore) SetTranslation(id string, translation models.Translation, overwrite bool) (models.Message, error) {
+	return s.forgetUpdated(s.Store.SetTranslation(id, translation, overwrite))
+}
+
+// forgetUpdated drops the reads of an updated message's conversation. When
+// the update failed the message's conversation is unknown, so it drops all.
+func (s *CoalescingStore) forgetUpdated(msg models.Message, err error) (models.Message, error) {
+	if err != nil {
+		s.coalescer.ForgetAll()
+	} else {
+		s.coalescer.Forget(msg.PhoneNumber)
+	}
+	return msg, err
+}
+
+func (s *CoalescingStore) SetSearchTokens(tokens map[string][]string) (int64, error) {
+	n, err := s.Store.SetSearchTokens(tokens)
+	s.coalescer.ForgetAll()
+	return n, err
+}
+
+func (s *CoalescingStore) DeleteAll() (int64, error) {
+	n, err := s.Store.DeleteAll()
+	s.coalescer.ForgetAll()
+	return n, err
+}
+
+func (s *CoalescingStore) DeleteAllBatch(limit int) (int64, error) {
+	n, err := s.Store.DeleteAllBatch(limit)
+	s.coalescer.ForgetAll()
+	return n, err
+}
+
+func (s *CoalescingStore) DropAll() (int64, error) {
+	n, err := s.Store.DropAll()
+	s.coalescer.ForgetAll()
+	return n, err
+}
+
+/* ---------- summaries ---------- */
+
+// CoalescingSummaryStore wraps a SummaryStore, coalescing GetSummaries
+// with a Coalescer. Its writes drop the reads they change.
+type CoalescingSummaryStore struct {
+	SummaryStore
+	coalescer *Coalescer
+}
+
+// NewCoalescingSummaryStore wraps ss, coalescing its reads with c.
+func NewCoalescingSummaryStore(ss SummaryStore, c *Coalescer) *CoalescingSummaryStore {
+	return &CoalescingSummaryStore{SummaryStore: ss, coalescer: c}
+}
+
+// GetSummaries is keyed by the set of phoneNumbers, in any order.
+func (s *CoalescingSummaryStore) GetSummaries(phoneNumbers []string) (map[string]ConversationSummary, error) {
+	scope := normalizedPhoneNumbers(phoneNumbers)
+	return coalesce(s.coalescer, "GetSummaries", strings.Join(scope, "\x00"), scope, maps.Clone[map[string]ConversationSummary], func() (map[string]ConversationSummary, error) {
+		return s.SummaryStore.GetSummaries(phoneNumbers)
+	})
+}
+
+func (s *CoalescingSummaryStore) ApplyMessages(msgs []models.Message) error {
+	err := s.SummaryStore.ApplyMessages(msgs)
+	s.coalescer.Forget(batchPhoneNumbers(msgs)...)
+	return err
+}
+
+func (s *CoalescingSummaryStore) DeleteSummary(phoneNumber string) error {
+	err := s.SummaryStore.DeleteSummary(phoneNumber)
+	s.coalescer.Forget(phoneNumber)
+	return err
+}
+
+func (s *CoalescingSummaryStore) DeleteAllSummaries() error {
+	err := s.SummaryStore.DeleteAllSummaries()
+	s.coalescer.ForgetAll()
+	return err
+}
+
+func (s *CoalescingSummaryStore) RebuildSummaries(phoneNumbers []string) (int64, error) {
+	n, err := s.SummaryStore.RebuildSummaries(phoneNumbers)
+	if phoneNumbers == nil {
+		s.coalescer.ForgetAll()
+	} else {
+		s.coalescer.Forget(phoneNumbers...)
+	}
+	return n, err
+}
+
+func (s *CoalescingSummaryStore) CreateEmptySummary(phoneNumber string, at time.Time) (ConversationSummary, bool, error) {
+	summary, created, err := s.SummaryStore.CreateEmptySummary(phoneNumber, at)
+	s.coalescer.Forget(phoneNumber)
+	return summary, created, err
+}
+
+func (s *CoalescingSummaryStore) DeleteEmptySummaries(cutoff time.Time) (int64, error) {
+	n, err := s.SummaryStore.DeleteEmptySummaries(cutoff)
+	s.coalescer.ForgetAll()
+	return n, err
+}
+
+func (s *CoalescingSummaryStore) SetState(phoneNumber string, from string, change StateChange) (ConversationSummary, bool, error) {
+	summary, ok, err := s.SummaryStore.SetState(phoneNumber, from, change)
+	s.coalescer.Forget(phoneNumber)
+	return summary, ok, err
+}
+
+func (s *CoalescingSummaryStore) SetAttributes(phoneNumber string, set map[string]any, unset []string) (ConversationSummary, error) {
+	summary, err := s.SummaryStore.SetAttributes(phoneNumber, set, unset)
+	s.coalescer.Forget(phoneNumber)
+	return summary, err
+}
+
+func (s *CoalescingSummaryStore) ClaimAutoAck(phoneNumber string, since, at time.Time) (bool, error) {
+	claimed, err := s.SummaryStore.ClaimAutoAck(phoneNumber, since, at)
+	s.coalescer.Forget(phoneNumber)
+	return claimed, err
+}
+
+/* ---------- profiles ---------- */
+
+// CoalescingProfileStore wraps a ProfileStore, coalescing GetProfile with
+// a Coalescer. Not-found answers are shared while in flight but not
+// reused. Its writes drop the reads they change.
+type CoalescingProfileStore struct {
+	ProfileStore
+	coalescer *Coalescer
+}
+
+// NewCoalescingProfileStore wraps ps, coalescing its reads with c.
+func NewCoalescingProfileStore(ps ProfileStore, c *Coalescer) *CoalescingProfileStore {
+	return &CoalescingProfileStore{ProfileStore: ps, coalescer: c}
+}
+
+func (s *CoalescingProfileStore) GetProfile(phoneNumber string) (models.Profile, error) {
+	return coalesce(s.coalescer, "GetProfile", phoneNumber, []string{phoneNumber}, identity[models.Profile], func() (models.Profile, error) {
+		return s.ProfileStore.GetProfile(phoneNumber)
+	})
+}
+
+func (s *CoalescingProfileStore) UpdateProfile(phoneNumber string, profile models.Profile) (models.Profile, error) {
+	updated, err := s.ProfileStore.UpdateProfile(phoneNumber, profile)
+	s.coalescer.Forget(phoneNumber)
+	return updated, err
+}
+
+func (s *CoalescingProfileStore) UpdateProfileIfVersion(phoneNumber string, profile models.Profile, version int64) (models.Profile, error) {
+	updated, err := s.ProfileStore.UpdateProfileIfVersion(phoneNumber, profile, version)
+	s.coalescer.Forget(phoneNumber)
+	return updated, err
+}
+
+func (s *CoalescingProfileStore) CreateProfile(profile models.Profile) (models.Profile, error) {
+	created, err := s.ProfileStore.CreateProfile(profile)
+	s.coalescer.Forget(profile.PhoneNumber)
+	return created, err
+}
+
+func (s *CoalescingProfileStore) EnsureProfile(profile models.Profile) (models.Profile, bool, error) {
+	ensured, created, err := s.ProfileStore.EnsureProfile(profile)
+	s.coalescer.Forget(profile.PhoneNumber)
+	return ensured, created, err
+}
+
+func (s *CoalescingProfileStore) DeleteProfile(phoneNumber string) error {
+	err := s.ProfileStore.DeleteProfile(phoneNumber)
+	s.coalescer.Forget(phoneNumber)
+	return err
+}
+
+func (s *CoalescingProfileStore) RedirectProfile(phoneNumber, movedTo string) (models.Profile, error) {
+	redirected, err := s.ProfileStore.RedirectProfile(phoneNumber, movedTo)
+	s.coalescer.Forget(phoneNumber)
+	return redirected, err
+}
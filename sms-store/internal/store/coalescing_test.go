@@ -0,0 +1,244 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// gatedReads counts the conversation reads that reach the store, holding
+// each back until a value is sent on release, if it is set.
+type gatedReads struct {
+	store.Store
+	calls   atomic.Int32
+	release chan struct{}
+	fail    error
+}
+
+func (s *gatedReads) FindByPhoneNumberPage(phoneNumber string, page store.PageQuery) ([]models.Message, error) {
+	s.calls.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	if s.fail != nil {
+		return nil, s.fail
+	}
+	return s.Store.FindByPhoneNumberPage(phoneNumber, page)
+}
+
+// coalescedReads returns store_coalesced_reads_total for op and result.
+func coalescedReads(t *testing.T, op, result string) int {
+	t.Helper()
+	var out strings.Builder
+	metrics.Default.WriteText(&out)
+	m := regexp.MustCompile(fmt.Sprintf(`store_coalesced_reads_total\{operation="%s",result="%s"\} (\d+)`, op, result)).FindStringSubmatch(out.String())
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+func newCoalescingFixture(t *testing.T, window time.Duration) (*gatedReads, *store.CoalescingStore, *clocktest.Fake) {
+	t.Helper()
+	inner := &gatedReads{Store: store.NewMemoryStore()}
+	if _, err := inner.Save(models.Message{ID: "m1", PhoneNumber: "1111111111", Text: "first", CreatedAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	fake := clocktest.NewFake(time.Now())
+	c := store.NewCoalescer(window)
+	c.SetClock(fake)
+	return inner, store.NewCoalescingStore(inner, c), fake
+}
+
+func firstPage(t *testing.T, s store.Store) []models.Message {
+	t.Helper()
+	msgs, err := s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 20})
+	if err != nil {
+		t.Fatalf("FindByPhoneNumberPage: %v", err)
+	}
+	return msgs
+}
+
+func TestCoalescingSharesReadInFlight(t *testing.T) {
+	inner, s, _ := newCoalescingFixture(t, 0)
+	inner.release = make(chan struct{})
+	shared := coalescedReads(t, "FindByPhoneNumberPage", "shared")
+
+	const readers = 100
+	pages := make([][]models.Message, readers)
+	var wg sync.WaitGroup
+	for i := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pages[i] = firstPage(t, s)
+		}()
+	}
+	waitFor(t, "the reads to join the one in flight", func() bool {
+		return coalescedReads(t, "FindByPhoneNumberPage", "shared")-shared == readers-1
+	})
+	close(inner.release)
+	wg.Wait()
+
+	if n := inner.calls.Load(); n != 1 {
+		t.Fatalf("%d identical concurrent reads made %d store calls, want 1", readers, n)
+	}
+	for i, page := range pages {
+		if len(page) != 1 || page[0].ID != "m1" {
+			t.Fatalf("reader %d got %+v", i, page)
+		}
+	}
+
+	// Without a window nothing is kept once the read returns
+	inner.release = nil
+	firstPage(t, s)
+	if n := inner.calls.Load(); n != 2 {
+		t.Fatalf("store calls = %d, want a new one", n)
+	}
+}
+
+func TestCoalescingReusesWithinWindow(t *testing.T) {
+	inner, s, fake := newCoalescingFixture(t, 100*time.Millisecond)
+	firstPage(t, s)
+	fake.Advance(99 * time.Millisecond)
+	page := firstPage(t, s)
+	if n := inner.calls.Load(); n != 1 {
+		t.Fatalf("store calls within the window = %d, want 1", n)
+	}
+
+	// Callers get copies, so changing one leaves the reused result alone
+	page[0].Text = "changed"
+	if again := firstPage(t, s); again[0].Text != "first" {
+		t.Fatalf("reused result changed to %q", again[0].Text)
+	}
+
+	fake.Advance(time.Millisecond)
+	firstPage(t, s)
+	if n := inner.calls.Load(); n != 2 {
+		t.Fatalf("store calls after the window = %d, want 2", n)
+	}
+}
+
+func TestCoalescingSharesOnlyIdenticalFirstPages(t *testing.T) {
+	inner, s, _ := newCoalescingFixture(t, time.Minute)
+	for _, page := range []store.PageQuery{
+		{Limit: 20},
+		{Limit: 20},
+		{Limit: 21},
+		{Limit: 20, OldestFirst: true},
+		{Limit: 20, Direction: models.DirectionInbound},
+		{Limit: 20, Before: time.Now(), BeforeID: "m9"},
+		{Limit: 20, Before: time.Now(), BeforeID: "m9"},
+	} {
+		if _, err := s.FindByPhoneNumberPage("1111111111", page); err != nil {
+			t.Fatalf("FindByPhoneNumberPage: %v", err)
+		}
+	}
+	// The repeated first page is the only one shared; later pages always
+	// go to the store
+	if n := inner.calls.Load(); n != 6 {
+		t.Fatalf("store calls = %d, want 6", n)
+	}
+}
+
+func TestCoalescingDoesNotReuseErrors(t *testing.T) {
+	inner, s, _ := newCoalescingFixture(t, time.Minute)
+	inner.fail = errors.New("connection reset")
+	for range 2 {
+		if _, err := s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 20}); err == nil {
+			t.Fatal("FindByPhoneNumberPage succeeded")
+		}
+	}
+	if n := inner.calls.Load(); n != 2 {
+		t.Fatalf("store calls = %d, want a failed read retried", n)
+	}
+}
+
+func TestCoalescingWriteDropsReadInFlight(t *testing.T) {
+	inner, s, _ := newCoalescingFixture(t, time.Minute)
+	inner.release = make(chan struct{}, 1)
+
+	stale := make(chan []models.Message)
+	go func() { stale <- firstPage(t, s) }()
+	waitFor(t, "the read to reach the store", func() bool { return inner.calls.Load() == 1 })
+
+	if _, err := s.Save(models.Message{ID: "m2", PhoneNumber: "1111111111", Text: "second", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	inner.release <- struct{}{}
+	<-stale
+
+	// A read starting after the write returned asks the store again, and
+	// sees the write
+	inner.release <- struct{}{}
+	if page := firstPage(t, s); len(page) != 2 || page[0].ID != "m2" {
+		t.Fatalf("page after the write = %+v", page)
+	}
+	if n := inner.calls.Load(); n != 2 {
+		t.Fatalf("store calls = %d, want 2", n)
+	}
+}
+
+func TestCoalescerSharedAcrossStores(t *testing.T) {
+	mem := store.NewMemoryStore()
+	c := store.NewCoalescer(time.Minute)
+	summaries := store.NewCoalescingSummaryStore(store.NewMemorySummaryStore(mem), c)
+	s := store.NewCoalescingStore(store.NewSummarizingStore(mem, summaries), c)
+	profiles := store.NewCoalescingProfileStore(store.NewMemoryProfileStore(), c)
+
+	save := func(id string) {
+		if _, err := s.Save(models.Message{ID: id, PhoneNumber: "1111111111", Text: id, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	count := func() int64 {
+		got, err := summaries.GetSummaries([]string{"1111111111", "1111111111"})
+		if err != nil {
+			t.Fatalf("GetSummaries: %v", err)
+		}
+		return got["1111111111"].MessageCount
+	}
+	save("m1")
+	if n := count(); n != 1 {
+		t.Fatalf("MessageCount = %d, want 1", n)
+	}
+	// A message write drops the summaries of its conversation
+	save("m2")
+	if n := count(); n != 2 {
+		t.Fatalf("MessageCount after a write = %d, want 2", n)
+	}
+
+	// Not-found profiles aren't reused, so a created one is found at once
+	if _, err := profiles.GetProfile("1111111111"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetProfile = %v, want ErrNotFound", err)
+	}
+	if _, err := profiles.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "Ram"}); err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	if p, err := profiles.GetProfile("1111111111"); err != nil || p.Name != "Ram" {
+		t.Fatalf("GetProfile after create = %+v, %v", p, err)
+	}
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
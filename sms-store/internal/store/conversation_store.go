@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// ConversationStore defines the interface for group conversation storage.
+type ConversationStore interface {
+	// TouchConversation records a message at time at in conversation id,
+	// adding participants to it. A conversation that doesn't exist is
+	// created when participants are given; without them, it returns an
+	// error wrapping ErrNotFound.
+	TouchConversation(id string, participants []string, accountID string, at time.Time) (models.Conversation, error)
+
+	// GetConversation retrieves a conversation by ID.
+	// Returns an error wrapping ErrNotFound if there is none.
+	GetConversation(id string) (models.Conversation, error)
+
+	// ListConversations retrieves up to limit conversations, most recent
+	// message first. Returns an empty slice if there are none.
+	ListConversations(limit int) ([]models.Conversation, error)
+}
+
+// MongoConversationStore implements the ConversationStore interface using MongoDB.
+type MongoConversationStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoConversationStore creates a new MongoDB conversation store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoConversationStore(client *mongo.Client, databaseName, collectionName string) *MongoConversationStore {
+	if collectionName == "" {
+		collectionName = "conversations"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "lastMessageAt", Value: -1}},
+		Options: options.Index().SetName("lastMessageAt_idx"),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		log.Printf("Warning: could not ensure conversation indexes on %s: %v", collectionName, err)
+	}
+
+	return &MongoConversationStore{collection: collection}
+}
+
+// TouchConversation upserts the conversation in one update, so concurrent
+// messages to a new group create it once and never lose a participant.
+func (s *MongoConversationStore) TouchConversation(id string, participants []string, accountID string, at time.Time) (models.Conversation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := s.Clock().Now()
+	onInsert := bson.M{"type": models.ConversationGroup, "createdAt": now}
+	if accountID != "" {
+		onInsert["accountId"] = accountID
+	}
+	update := bson.M{
+		"$set":         bson.M{"updatedAt": now},
+		"$max":         bson.M{"lastMessageAt": at},
+		"$setOnInsert": onInsert,
+	}
+	if len(participants) > 0 {
+		update["$addToSet"] = bson.M{"participants": bson.M{"$each": participants}}
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(len(participants) > 0).SetReturnDocument(options.After)
+	var conv models.Conversation
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&conv)
+	if err == mongo.ErrNoDocuments {
+		return models.Conversation{}, fmt.Errorf("conversation %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return models.Conversation{}, fmt.Errorf("failed to update conversation: %w", err)
+	}
+	slices.Sort(conv.Participants)
+	return conv, nil
+}
+
+// GetConversation retrieves a conversation by ID from MongoDB.
+func (s *MongoConversationStore) GetConversation(id string) (models.Conversation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var conv models.Conversation
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&conv)
+	if err == mongo.ErrNoDocuments {
+		return models.Conversation{}, fmt.Errorf("conversation %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return models.Conversation{}, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	slices.Sort(conv.Participants)
+	return conv, nil
+}
+
+// ListConversations retrieves conversations from MongoDB, most recent message first.
+func (s *MongoConversationStore) ListConversations(limit int) ([]models.Conversation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "lastMessageAt", Value: -1}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	convs := []models.Conversation{}
+	if err := cursor.All(ctx, &convs); err != nil {
+		return nil, fmt.Errorf("failed to decode conversations: %w", err)
+	}
+	for i := range convs {
+		slices.Sort(convs[i].Participants)
+	}
+	return convs, nil
+}
+
+// MemoryConversationStore implements the ConversationStore interface in memory.
+type MemoryConversationStore struct {
+	mu            sync.Mutex
+	conversations map[string]models.Conversation
+
+	clock.Clocked
+}
+
+func NewMemoryConversationStore() *MemoryConversationStore {
+	return &MemoryConversationStore{conversations: make(map[string]models.Conversation)}
+}
+
+func (s *MemoryConversationStore) TouchConversation(id string, participants []string, accountID string, at time.Time) (models.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	conv, ok := s.conversations[id]
+	if !ok {
+		if len(participants) == 0 {
+			return models.Conversation{}, fmt.Errorf("conversation %w: %s", ErrNotFound, id)
+		}
+		conv = models.Conversation{ID: id, Type: models.ConversationGroup, AccountID: accountID, CreatedAt: now}
+	}
+	conv.Participants = models.NormalizeParticipants(append(slices.Clone(conv.Participants), participants...))
+	if at.After(conv.LastMessageAt) {
+		conv.LastMessageAt = at
+	}
+	conv.UpdatedAt = now
+	s.conversations[id] = conv
+	return conv, nil
+}
+
+func (s *MemoryConversationStore) GetConversation(id string) (models.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[id]
+	if !ok {
+		return models.Conversation{}, fmt.Errorf("conversation %w: %s", ErrNotFound, id)
+	}
+	return conv, nil
+}
+
+func (s *MemoryConversationStore) ListConversations(limit int) ([]models.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]models.Conversation, 0, len(s.conversations))
+	for _, conv := range s.conversations {
+		out = append(out, conv)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastMessageAt.Equal(out[j].LastMessageAt) {
+			return out[i].LastMessageAt.After(out[j].LastMessageAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
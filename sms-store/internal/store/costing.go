@@ -0,0 +1,45 @@
+package store
+
+import "sms-store/internal/models"
+
+// CostEstimator prices a message before it is stored.
+type CostEstimator interface {
+	Estimate(msg models.Message) *models.Cost
+}
+
+// CostingStore wraps a Store so every saved message carries its estimated
+// cost and an account ID. Messages that already have a cost keep it.
+type CostingStore struct {
+	Store
+	estimator CostEstimator
+}
+
+// NewCostingStore wraps s, pricing saved messages with estimator.
+func NewCostingStore(s Store, estimator CostEstimator) *CostingStore {
+	return &CostingStore{Store: s, estimator: estimator}
+}
+
+// Save prices msg and stores it.
+func (s *CostingStore) Save(msg models.Message) (models.Message, error) {
+	return s.Store.Save(s.price(msg))
+}
+
+// SaveBatch prices each message and stores the batch.
+func (s *CostingStore) SaveBatch(msgs []models.Message) (int, error) {
+	priced := make([]models.Message, len(msgs))
+	for i, msg := range msgs {
+		priced[i] = s.price(msg)
+	}
+	return s.Store.SaveBatch(priced)
+}
+
+// price fills in a missing account ID and cost.
+func (s *CostingStore) price(msg models.Message) models.Message {
+	if msg.AccountID == "" {
+		msg.AccountID = models.DefaultAccountID
+	}
+	if msg.Cost == nil {
+		msg.Cost = s.estimator.Estimate(msg)
+	}
+	return msg
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// defaultReceiptLimit is how many receipts ListDeletionReceipts returns
+// when the query doesn't say.
+const defaultReceiptLimit = 100
+
+// DeletionReceiptQuery selects deletion receipts, newest first. Empty
+// fields match every receipt.
+type DeletionReceiptQuery struct {
+	PhoneNumber string
+	From        time.Time // Receipts at or after
+	To          time.Time // Receipts before
+	Limit       int       // Defaults to 100
+}
+
+func (q DeletionReceiptQuery) includes(r models.DeletionReceipt) bool {
+	return (q.PhoneNumber == "" || r.PhoneNumber == q.PhoneNumber) &&
+		(q.From.IsZero() || !r.At.Before(q.From)) &&
+		(q.To.IsZero() || r.At.Before(q.To))
+}
+
+// DeletionReceiptStore defines the interface for the append-only log of
+// deletion receipts. It has no way to change or remove a receipt.
+type DeletionReceiptStore interface {
+	// RecordDeletion appends receipt, giving it an ID and, when unset, the
+	// current time.
+	RecordDeletion(receipt models.DeletionReceipt) (models.DeletionReceipt, error)
+
+	// ListDeletionReceipts retrieves the receipts matching q, newest first.
+	ListDeletionReceipts(q DeletionReceiptQuery) ([]models.DeletionReceipt, error)
+}
+
+// newReceiptID returns a random ID for a deletion receipt.
+func newReceiptID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "receipt-" + time.Now().Format("20060102150405.000000000")
+	}
+	return "receipt-" + hex.EncodeToString(b[:])
+}
+
+// MongoDeletionReceiptStore implements the DeletionReceiptStore interface
+// using MongoDB.
+type MongoDeletionReceiptStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoDeletionReceiptStore creates a new MongoDB deletion receipt store
+// instance. It uses the same MongoDB connection as the message store.
+func NewMongoDeletionReceiptStore(client *mongo.Client, databaseName, collectionName string) *MongoDeletionReceiptStore {
+	if collectionName == "" {
+		collectionName = "deletion_receipts"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "phoneNumber", Value: 1}, {Key: "at", Value: -1}},
+			Options: options.Index().SetName("phoneNumber_at_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "at", Value: -1}},
+			Options: options.Index().SetName("at_idx"),
+		},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		log.Printf("Warning: could not ensure deletion receipt indexes on %s: %v", collectionName, err)
+	}
+
+	return &MongoDeletionReceiptStore{collection: collection}
+}
+
+func (s *MongoDeletionReceiptStore) RecordDeletion(receipt models.DeletionReceipt) (models.DeletionReceipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	receipt.ID = newReceiptID()
+	if receipt.At.IsZero() {
+		receipt.At = s.Clock().Now()
+	}
+	if _, err := s.collection.InsertOne(ctx, receipt); err != nil {
+		return models.DeletionReceipt{}, fmt.Errorf("failed to record deletion receipt: %w", err)
+	}
+	return receipt, nil
+}
+
+func (s *MongoDeletionReceiptStore) ListDeletionReceipts(q DeletionReceiptQuery) ([]models.DeletionReceipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if q.PhoneNumber != "" {
+		filter["phoneNumber"] = q.PhoneNumber
+	}
+	at := bson.M{}
+	if !q.From.IsZero() {
+		at["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		at["$lt"] = q.To
+	}
+	if len(at) > 0 {
+		filter["at"] = at
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultReceiptLimit
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(q.Limit))
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deletion receipts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	receipts := make([]models.DeletionReceipt, 0)
+	if err := cursor.All(ctx, &receipts); err != nil {
+		return nil, fmt.Errorf("failed to decode deletion receipts: %w", err)
+	}
+	return receipts, nil
+}
+
+// MemoryDeletionReceiptStore implements the DeletionReceiptStore interface
+// in memory.
+type MemoryDeletionReceiptStore struct {
+	mu       sync.Mutex
+	receipts []models.DeletionReceipt // Oldest first
+
+	clock.Clocked
+}
+
+func NewMemoryDeletionReceiptStore() *MemoryDeletionReceiptStore {
+	return &MemoryDeletionReceiptStore{}
+}
+
+func (s *MemoryDeletionReceiptStore) RecordDeletion(receipt models.DeletionReceipt) (models.DeletionReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt.ID = newReceiptID()
+	if receipt.At.IsZero() {
+		receipt.At = s.Clock().Now()
+	}
+	receipt.Matched = maps.Clone(receipt.Matched)
+	s.receipts = append(s.receipts, receipt)
+	return receipt, nil
+}
+
+func (s *MemoryDeletionReceiptStore) ListDeletionReceipts(q DeletionReceiptQuery) ([]models.DeletionReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q.Limit <= 0 {
+		q.Limit = defaultReceiptLimit
+	}
+	out := make([]models.DeletionReceipt, 0)
+	for _, r := range slices.Backward(s.receipts) {
+		if len(out) == q.Limit {
+			break
+		}
+		if q.includes(r) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
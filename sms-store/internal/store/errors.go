@@ -0,0 +1,25 @@
+package store
+
+import "errors"
+
+// Sentinel errors returned (wrapped) by store implementations.
+// Callers should match them with errors.Is rather than inspecting messages.
+var (
+	// ErrNotFound is returned when the requested document does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlreadyExists is returned when a create collides with an existing document.
+	ErrAlreadyExists = errors.New("already exists")
+
+	// ErrTooManyReactions is returned when a message already has
+	// MaxReactionsPerMessage reactions.
+	ErrTooManyReactions = errors.New("too many reactions")
+
+	// ErrTooManyAnnotations is returned when a message already has
+	// annotations from MaxAnnotationsPerMessage sources.
+	ErrTooManyAnnotations = errors.New("too many annotations")
+
+	// ErrTooManyTranslations is returned when a message already has
+	// translations into MaxTranslationsPerMessage languages.
+	ErrTooManyTranslations = errors.New("too many translations")
+)
@@ -0,0 +1,14 @@
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"sms-store/internal/models"
+)
+
+// ReadAll exposes readAll to the store_test package, to read cursors built
+// from documents without a server.
+func (s *MongoStore) ReadAll(ctx context.Context, cursor *mongo.Cursor, operation string) ([]models.Message, error) {
+	return s.readAll(ctx, cursor, operation)
+}
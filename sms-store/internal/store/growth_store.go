@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/models"
+)
+
+// GrowthStore defines the interface for the history of messages collection
+// sizes.
+type GrowthStore interface {
+	// AddGrowthSample stores sample, then drops all but the newest keep
+	// samples.
+	AddGrowthSample(sample models.GrowthSample, keep int) error
+
+	// ListGrowthSamples retrieves the stored samples, oldest first.
+	ListGrowthSamples() ([]models.GrowthSample, error)
+}
+
+// SampleGrowth returns the size of the messages collection now, from its
+// estimated document count and collStats. Both read collection metadata
+// rather than documents, so sampling is cheap however large it grows. The
+// sample's time is left for the caller to set.
+func (s *MongoStore) SampleGrowth() (models.GrowthSample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := s.collection.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return models.GrowthSample{}, fmt.Errorf("failed to count messages: %w", err)
+	}
+	var stats struct {
+		Size           float64 `bson:"size"`
+		StorageSize    float64 `bson:"storageSize"`
+		TotalIndexSize float64 `bson:"totalIndexSize"`
+	}
+	err = s.collection.Database().RunCommand(ctx, bson.D{{Key: "collStats", Value: s.collection.Name()}}).Decode(&stats)
+	if err != nil {
+		return models.GrowthSample{}, fmt.Errorf("failed to read collection stats: %w", err)
+	}
+	return models.GrowthSample{
+		Messages:     count,
+		DataBytes:    int64(stats.Size),
+		StorageBytes: int64(stats.StorageSize),
+		IndexBytes:   int64(stats.TotalIndexSize),
+	}, nil
+}
+
+// MongoGrowthStore implements the GrowthStore interface using MongoDB.
+type MongoGrowthStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoGrowthStore creates a new MongoDB growth store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoGrowthStore(client *mongo.Client, databaseName, collectionName string) *MongoGrowthStore {
+	if collectionName == "" {
+		collectionName = "growth_samples"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "at", Value: -1}},
+		Options: options.Index().SetName("at_idx"),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		log.Printf("Warning: could not ensure growth index on %s: %v", collectionName, err)
+	}
+
+	return &MongoGrowthStore{collection: collection}
+}
+
+func (s *MongoGrowthStore) AddGrowthSample(sample models.GrowthSample, keep int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.collection.InsertOne(ctx, sample); err != nil {
+		return fmt.Errorf("failed to store growth sample: %w", err)
+	}
+
+	// The newest sample past the ones kept; it and everything older go
+	var oldest models.GrowthSample
+	opts := options.FindOne().SetSort(bson.D{{Key: "at", Value: -1}}).SetSkip(int64(max(1, keep))).SetProjection(bson.M{"at": 1})
+	err := s.collection.FindOne(ctx, bson.M{}, opts).Decode(&oldest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find growth samples to drop: %w", err)
+	}
+	if _, err := s.collection.DeleteMany(ctx, bson.M{"at": bson.M{"$lte": oldest.At}}); err != nil {
+		return fmt.Errorf("failed to drop old growth samples: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoGrowthStore) ListGrowthSamples() ([]models.GrowthSample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}}).SetProjection(bson.M{"_id": 0}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list growth samples: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	samples := []models.GrowthSample{}
+	if err := cursor.All(ctx, &samples); err != nil {
+		return nil, fmt.Errorf("failed to decode growth samples: %w", err)
+	}
+	return samples, nil
+}
+
+// MemoryGrowthStore implements the GrowthStore interface in memory.
+type MemoryGrowthStore struct {
+	mu      sync.Mutex
+	samples []models.GrowthSample // Oldest first
+}
+
+func NewMemoryGrowthStore() *MemoryGrowthStore {
+	return &MemoryGrowthStore{}
+}
+
+func (s *MemoryGrowthStore) AddGrowthSample(sample models.GrowthSample, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := len(s.samples)
+	for i > 0 && s.samples[i-1].At.After(sample.At) {
+		i--
+	}
+	s.samples = slices.Insert(s.samples, i, sample)
+	if drop := len(s.samples) - max(1, keep); drop > 0 {
+		s.samples = append([]models.GrowthSample(nil), s.samples[drop:]...)
+	}
+	return nil
+}
+
+func (s *MemoryGrowthStore) ListGrowthSamples() ([]models.GrowthSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.GrowthSample{}, s.samples...), nil
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexBuilder is a store whose query indexes are built after startup.
+type IndexBuilder interface {
+	// BuildIndexes creates the query indexes that don't exist yet, one at a
+	// time, calling progress with the documents scanned so far and the
+	// documents to scan in all. It returns once every index is ready.
+	BuildIndexes(ctx context.Context, progress func(done, total int64)) error
+
+	// IndexesReady reports whether the query indexes exist. Until they do,
+	// queries are answered without them, more slowly.
+	IndexesReady() bool
+}
+
+// indexProgressInterval is how often a running index build's progress is
+// read from $currentOp.
+const indexProgressInterval = 2 * time.Second
+
+// serverInfo is what index builds and queries need to know of the server.
+type serverInfo struct {
+	major, minor int  // Version; 0.0 when unknown
+	replicaSet   bool // A member of a replica set, which commits builds by quorum
+}
+
+// atLeast reports whether the server is version major.minor or later,
+// assuming it is when the version is unknown.
+func (si serverInfo) atLeast(major, minor int) bool {
+	if si.major == 0 {
+		return true
+	}
+	return si.major > major || si.major == major && si.minor >= minor
+}
+
+// detectServer reads the server's version with buildInfo and whether it is
+// in a replica set with hello. What can't be read is left unknown.
+func detectServer(ctx context.Context, client *mongo.Client) serverInfo {
+	var si serverInfo
+	admin := client.Database("admin")
+
+	var build struct {
+		Version string `bson:"version"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&build); err == nil {
+		parts := strings.SplitN(build.Version, ".", 3)
+		if len(parts) >= 2 {
+			major, errMajor := strconv.Atoi(parts[0])
+			minor, errMinor := strconv.Atoi(parts[1])
+			if errMajor == nil && errMinor == nil {
+				si.major, si.minor = major, minor
+			}
+		}
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err == nil {
+		si.replicaSet = hello.SetName != ""
+	}
+	return si
+}
+
+// IndexesReady reports whether the query indexes exist.
+func (s *MongoStore) IndexesReady() bool {
+	return s.indexesReady.Load()
+}
+
+// sortedFind returns find options sorting by sort, in batches of the
+// store's BatchSize. Until the query indexes are ready the sort may have to
+// happen in memory, so it may spill to disk rather than fail past MongoDB's
+// 100MB sort limit; servers before 4.4 don't accept allowDiskUse on find.
+func (s *MongoStore) sortedFind(sort bson.D) *options.FindOptions {
+	opts := options.Find().SetSort(sort)
+	if s.limits.BatchSize > 0 {
+		opts.SetBatchSize(int32(s.limits.BatchSize))
+	}
+	if !s.IndexesReady() && s.server.atLeast(4, 4) {
+		opts.SetAllowDiskUse(true)
+	}
+	return opts
+}
+
+// missingQueryIndexes returns the query indexes the collection lacks.
+func (s *MongoStore) missingQueryIndexes(ctx context.Context) ([]mongo.IndexModel, error) {
+	cursor, err := s.collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	var existing []struct {
+		Name string `bson:"name"`
+	}
+	if err := cursor.All(ctx, &existing); err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	names := make(map[string]bool, len(existing))
+	for _, idx := range existing {
+		names[idx.Name] = true
+	}
+
+	var missing []mongo.IndexModel
+	for _, model := range queryIndexModels() {
+		if !names[*model.Options.Name] {
+			missing = append(missing, model)
+		}
+	}
+	return missing, nil
+}
+
+// BuildIndexes creates the missing query indexes one at a time, so each
+// build's progress can be read from $currentOp. Servers before 4.2 build in
+// the foreground unless asked not to, holding the database's lock
+// throughout; later ones ignore the option and always build without
+// blocking writes. On a 4.4+ replica set a build commits once a majority of
+// voting members have it, so a lagging secondary can't hold the rest back.
+// Reading progress is best effort: without the privilege to run
+// $currentOp, builds just report nothing until they finish.
+func (s *MongoStore) BuildIndexes(ctx context.Context, progress func(done, total int64)) error {
+	missing, err := s.missingQueryIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		s.indexesReady.Store(true)
+		return nil
+	}
+
+	count, err := s.collection.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count messages: %w", err)
+	}
+	total := count * int64(len(missing))
+	progress(0, total)
+
+	createOpts := options.CreateIndexes()
+	if s.server.replicaSet && s.server.atLeast(4, 4) {
+		createOpts.SetCommitQuorumMajority()
+	}
+
+	for i, model := range missing {
+		if !s.server.atLeast(4, 2) {
+			model.Options.SetBackground(true)
+		}
+		name := *model.Options.Name
+		log.Printf("Building index %s (%d of %d) on %d messages", name, i+1, len(missing), count)
+
+		built := make(chan error, 1)
+		go func() {
+			_, err := s.collection.Indexes().CreateOne(ctx, model, createOpts)
+			built <- err
+		}()
+
+		base := count * int64(i)
+		var scanned int64
+		ticker := time.NewTicker(indexProgressInterval)
+	wait:
+		for {
+			select {
+			case err := <-built:
+				ticker.Stop()
+				if err != nil {
+					return fmt.Errorf("failed to build index %s: %w", name, err)
+				}
+				break wait
+			case <-ticker.C:
+				if done, ok := s.indexBuildScanned(ctx); ok && done > scanned {
+					scanned = min(done, count)
+					progress(base+scanned, total)
+				}
+			}
+		}
+		progress(base+count, total)
+	}
+
+	s.indexesReady.Store(true)
+	return nil
+}
+
+// indexBuildScanned returns how many documents the collection's running
+// index build has processed, as $currentOp reports it. Later phases of a
+// build restart the count, so callers keep the highest seen.
+func (s *MongoStore) indexBuildScanned(ctx context.Context) (int64, bool) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$currentOp", Value: bson.M{}}},
+		{{Key: "$match", Value: bson.M{
+			"ns":       s.database.Name() + "." + s.collection.Name(),
+			"msg":      bson.M{"$regex": "^Index Build"},
+			"progress": bson.M{"$exists": true},
+		}}},
+	}
+	cursor, err := s.client.Database("admin").Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, false
+	}
+	defer cursor.Close(ctx)
+
+	var ops []struct {
+		Progress struct {
+			Done int64 `bson:"done"`
+		} `bson:"progress"`
+	}
+	if err := cursor.All(ctx, &ops); err != nil || len(ops) == 0 {
+		return 0, false
+	}
+	return ops[0].Progress.Done, true
+}
@@ -0,0 +1,412 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+var storeLatency = metrics.NewHistogramVec(
+	"store_operation_duration_seconds",
+	"Duration of message store operations, by operation, backend and outcome.",
+	metrics.DefaultBuckets,
+	"operation", "backend", "outcome",
+)
+
+// Store operations, as the operation label of store_operation_duration_seconds.
+const (
+	opSave = iota
+	opSaveBatch
+	opFindByPhoneNumber
+	opFindByID
+	opFindByPhoneNumberPage
+	opFindByConversationPage
+	opListPage
+	opCountMessages
+	opCountByAccount
+	opCountByParticipant
+	opCountAfter
+	opSearchMessages
+	opSearchMessagePrefixes
+	opSetSearchTokens
+	opDailyDigest
+	opCostSummary
+	opList
+	opDeleteAll
+	opCount
+	opDeleteAllBatch
+	opDropAll
+	opGetDistinctPhoneNumbers
+	opDeleteByPhoneNumber
+	opUpdateMessage
+	opAddReaction
+	opRemoveReaction
+	opSetAnnotation
+	opReviewAnnotation
+	opCountAnnotations
+	opSetTranslation
+	numOps
+)
+
+var opNames = [numOps]string{
+	"Save", "SaveBatch", "FindByPhoneNumber", "FindByID", "FindByPhoneNumberPage",
+	"FindByConversationPage", "ListPage", "CountMessages", "CountByAccount",
+	"CountByParticipant", "CountAfter", "SearchMessages", "SearchMessagePrefixes", "SetSearchTokens", "DailyDigest", "CostSummary",
+	"List", "DeleteAll", "Count", "DeleteAllBatch", "DropAll",
+	"GetDistinctPhoneNumbers", "DeleteByPhoneNumber", "UpdateMessage",
+	"AddReaction", "RemoveReaction", "SetAnnotation", "ReviewAnnotation", "CountAnnotations",
+	"SetTranslation",
+}
+
+// latencySamples is how many recent calls per operation LatencySummary
+// can draw on.
+const latencySamples = 4096
+
+// InstrumentedStore wraps a Store, recording how long each call takes in
+// the store_operation_duration_seconds histogram and in a window of recent
+// samples for LatencySummary. Not-found, duplicate, reaction-limit and
+// annotation-limit results count as successes: the backend answered.
+type InstrumentedStore struct {
+	Store
+	backend string
+	ops     [numOps]instrumentedOp
+}
+
+// instrumentedOp holds an operation's histograms, looked up on first use so
+// operations never called don't show up on /metrics, and its recent calls.
+type instrumentedOp struct {
+	ok, failed atomic.Pointer[metrics.Histogram]
+	recent     latencyWindow
+}
+
+// NewInstrumentedStore wraps s, labelling its metrics with backend, e.g. "mongo".
+func NewInstrumentedStore(s Store, backend string) *InstrumentedStore {
+	return &InstrumentedStore{Store: s, backend: backend}
+}
+
+// observe records a call to op that started at start and returned err.
+func (s *InstrumentedStore) observe(op int, start time.Time, err error) {
+	d := time.Since(start)
+	failed := err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrAlreadyExists) && !errors.Is(err, ErrTooManyReactions) && !errors.Is(err, ErrTooManyAnnotations) && !errors.Is(err, ErrTooManyTranslations)
+	h, outcome := &s.ops[op].ok, "success"
+	if failed {
+		h, outcome = &s.ops[op].failed, "failure"
+	}
+	histogram := h.Load()
+	if histogram == nil {
+		histogram = storeLatency.WithLabelValues(opNames[op], s.backend, outcome)
+		h.Store(histogram)
+	}
+	histogram.Observe(d.Seconds())
+	s.ops[op].recent.add(start, d, failed)
+}
+
+func (s *InstrumentedStore) Save(msg models.Message) (models.Message, error) {
+	start := time.Now()
+	saved, err := s.Store.Save(msg)
+	s.observe(opSave, start, err)
+	return saved, err
+}
+
+func (s *InstrumentedStore) SaveBatch(msgs []models.Message) (int, error) {
+	start := time.Now()
+	n, err := s.Store.SaveBatch(msgs)
+	s.observe(opSaveBatch, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) FindByPhoneNumber(phoneNumber string) ([]models.Message, error) {
+	start := time.Now()
+	msgs, err := s.Store.FindByPhoneNumber(phoneNumber)
+	s.observe(opFindByPhoneNumber, start, err)
+	return msgs, err
+}
+
+func (s *InstrumentedStore) FindByID(id string) (models.Message, error) {
+	start := time.Now()
+	msg, err := s.Store.FindByID(id)
+	s.observe(opFindByID, start, err)
+	return msg, err
+}
+
+func (s *InstrumentedStore) FindByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	start := time.Now()
+	msgs, err := s.Store.FindByPhoneNumberPage(phoneNumber, page)
+	s.observe(opFindByPhoneNumberPage, start, err)
+	return msgs, err
+}
+
+func (s *InstrumentedStore) FindByConversationPage(conversationID string, page PageQuery) ([]models.Message, error) {
+	start := time.Now()
+	msgs, err := s.Store.FindByConversationPage(conversationID, page)
+	s.observe(opFindByConversationPage, start, err)
+	return msgs, err
+}
+
+func (s *InstrumentedStore) ListPage(page PageQuery) ([]models.Message, error) {
+	start := time.Now()
+	msgs, err := s.Store.ListPage(page)
+	s.observe(opListPage, start, err)
+	return msgs, err
+}
+
+func (s *InstrumentedStore) CountMessages(senderID string) (int64, error) {
+	start := time.Now()
+	n, err := s.Store.CountMessages(senderID)
+	s.observe(opCountMessages, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) CountByAccount(phoneNumber string) (map[string]int64, error) {
+	start := time.Now()
+	counts, err := s.Store.CountByAccount(phoneNumber)
+	s.observe(opCountByAccount, start, err)
+	return counts, err
+}
+
+func (s *InstrumentedStore) CountByParticipant(phoneNumber string) ([]ParticipantCount, error) {
+	start := time.Now()
+	counts, err := s.Store.CountByParticipant(phoneNumber)
+	s.observe(opCountByParticipant, start, err)
+	return counts, err
+}
+
+func (s *InstrumentedStore) CountAfter(after map[string]time.Time) (map[string]int64, error) {
+	start := time.Now()
+	counts, err := s.Store.CountAfter(after)
+	s.observe(opCountAfter, start, err)
+	return counts, err
+}
+
+func (s *InstrumentedStore) SearchMessages(query string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	start := time.Now()
+	msgs, err := s.Store.SearchMessages(query, ref, limit)
+	s.observe(opSearchMessages, start, err)
+	return msgs, err
+}
+
+func (s *InstrumentedStore) SearchMessagePrefixes(tokens []string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	start := time.Now()
+	msgs, err := s.Store.SearchMessagePrefixes(tokens, ref, limit)
+	s.observe(opSearchMessagePrefixes, start, err)
+	return msgs, err
+}
+
+func (s *InstrumentedStore) SetSearchTokens(tokens map[string][]string) (int64, error) {
+	start := time.Now()
+	n, err := s.Store.SetSearchTokens(tokens)
+	s.observe(opSetSearchTokens, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) DailyDigest(phoneNumber string, q DigestQuery) ([]DailyBucket, error) {
+	start := time.Now()
+	days, err := s.Store.DailyDigest(phoneNumber, q)
+	s.observe(opDailyDigest, start, err)
+	return days, err
+}
+
+func (s *InstrumentedStore) CostSummary(q CostQuery) ([]CostBucket, error) {
+	start := time.Now()
+	buckets, err := s.Store.CostSummary(q)
+	s.observe(opCostSummary, start, err)
+	return buckets, err
+}
+
+func (s *InstrumentedStore) List() ([]models.Message, error) {
+	start := time.Now()
+	msgs, err := s.Store.List()
+	s.observe(opList, start, err)
+	return msgs, err
+}
+
+func (s *InstrumentedStore) DeleteAll() (int64, error) {
+	start := time.Now()
+	n, err := s.Store.DeleteAll()
+	s.observe(opDeleteAll, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) Count() (int64, error) {
+	start := time.Now()
+	n, err := s.Store.Count()
+	s.observe(opCount, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) DeleteAllBatch(limit int) (int64, error) {
+	start := time.Now()
+	n, err := s.Store.DeleteAllBatch(limit)
+	s.observe(opDeleteAllBatch, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) DropAll() (int64, error) {
+	start := time.Now()
+	n, err := s.Store.DropAll()
+	s.observe(opDropAll, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) GetDistinctPhoneNumbers() ([]string, error) {
+	start := time.Now()
+	phoneNumbers, err := s.Store.GetDistinctPhoneNumbers()
+	s.observe(opGetDistinctPhoneNumbers, start, err)
+	return phoneNumbers, err
+}
+
+func (s *InstrumentedStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	start := time.Now()
+	n, err := s.Store.DeleteByPhoneNumber(phoneNumber)
+	s.observe(opDeleteByPhoneNumber, start, err)
+	return n, err
+}
+
+func (s *InstrumentedStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	start := time.Now()
+	msg, err := s.Store.UpdateMessage(id, patch)
+	s.observe(opUpdateMessage, start, err)
+	return msg, err
+}
+
+func (s *InstrumentedStore) AddReaction(id string, reaction models.Reaction) (models.Message, error) {
+	start := time.Now()
+	msg, err := s.Store.AddReaction(id, reaction)
+	s.observe(opAddReaction, start, err)
+	return msg, err
+}
+
+func (s *InstrumentedStore) RemoveReaction(id, emoji, actor string) (models.Message, error) {
+	start := time.Now()
+	msg, err := s.Store.RemoveReaction(id, emoji, actor)
+	s.observe(opRemoveReaction, start, err)
+	return msg, err
+}
+
+func (s *InstrumentedStore) SetAnnotation(id string, annotation models.Annotation) (models.Message, error) {
+	start := time.Now()
+	msg, err := s.Store.SetAnnotation(id, annotation)
+	s.observe(opSetAnnotation, start, err)
+	return msg, err
+}
+
+func (s *InstrumentedStore) SetTranslation(id string, translation models.Translation, overwrite bool) (models.Message, error) {
+	start := time.Now()
+	msg, err := s.Store.SetTranslation(id, translation, overwrite)
+	s.observe(opSetTranslation, start, err)
+	return msg, err
+}
+
+func (s *InstrumentedStore) ReviewAnnotation(id, source string, review models.AnnotationReview) (models.Message, error) {
+	start := time.Now()
+	msg, err := s.Store.ReviewAnnotation(id, source, review)
+	s.observe(opReviewAnnotation, start, err)
+	return msg, err
+}
+
+func (s *InstrumentedStore) CountAnnotations(phoneNumber string) ([]AnnotationCount, error) {
+	start := time.Now()
+	counts, err := s.Store.CountAnnotations(phoneNumber)
+	s.observe(opCountAnnotations, start, err)
+	return counts, err
+}
+
+// OperationLatency summarizes the recent calls of one store operation.
+type OperationLatency struct {
+	Operation string  `json:"operation"`
+	Count     int     `json:"count"`
+	Failures  int     `json:"failures"`
+	P50Ms     float64 `json:"p50Ms"`
+	P95Ms     float64 `json:"p95Ms"`
+	P99Ms     float64 `json:"p99Ms"`
+	MaxMs     float64 `json:"maxMs"`
+}
+
+// Backend returns the backend name the store's metrics are labelled with.
+func (s *InstrumentedStore) Backend() string {
+	return s.backend
+}
+
+// LatencySummary returns percentiles of the calls made in the last window,
+// for operations called at least once. Each operation keeps only its most
+// recent latencySamples calls, so busy operations cover a shorter span.
+func (s *InstrumentedStore) LatencySummary(window time.Duration) []OperationLatency {
+	since := time.Now().Add(-window)
+	summary := make([]OperationLatency, 0)
+	for i := range s.ops {
+		durations, failures := s.ops[i].recent.since(since)
+		if len(durations) == 0 {
+			continue
+		}
+		sort.Slice(durations, func(a, b int) bool { return durations[a] < durations[b] })
+		summary = append(summary, OperationLatency{
+			Operation: opNames[i],
+			Count:     len(durations),
+			Failures:  failures,
+			P50Ms:     percentileMs(durations, 0.50),
+			P95Ms:     percentileMs(durations, 0.95),
+			P99Ms:     percentileMs(durations, 0.99),
+			MaxMs:     percentileMs(durations, 1),
+		})
+	}
+	return summary
+}
+
+// percentileMs returns the nearest-rank percentile p of sorted durations, in milliseconds.
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return float64(sorted[rank]) / float64(time.Millisecond)
+}
+
+// latencyWindow is a ring buffer of an operation's most recent calls.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencySamples]latencySample
+	next    int
+	full    bool
+}
+
+type latencySample struct {
+	at     time.Time
+	d      time.Duration
+	failed bool
+}
+
+func (w *latencyWindow) add(at time.Time, d time.Duration, failed bool) {
+	w.mu.Lock()
+	w.samples[w.next] = latencySample{at: at, d: d, failed: failed}
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+	w.mu.Unlock()
+}
+
+// since returns the durations of calls started after t and how many failed.
+func (w *latencyWindow) since(t time.Time) ([]time.Duration, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	durations := make([]time.Duration, 0, n)
+	failures := 0
+	for _, sample := range w.samples[:n] {
+		if sample.at.After(t) {
+			durations = append(durations, sample.d)
+			if sample.failed {
+				failures++
+			}
+		}
+	}
+	return durations, failures
+}
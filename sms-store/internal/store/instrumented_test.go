@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// failingStore fails every Count, as a backend that is down would.
+type failingStore struct {
+	store.Store
+}
+
+func (failingStore) Count() (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestInstrumentedStoreRecordsOutcomes(t *testing.T) {
+	s := store.NewInstrumentedStore(failingStore{store.NewMemoryStore()}, "instrumented_test")
+	if _, err := s.Save(models.Message{ID: "m1", PhoneNumber: "1111111111", Text: "hi", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// Not found is an answer from the backend, so it counts as a success
+	if _, err := s.FindByID("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("FindByID = %v, want ErrNotFound", err)
+	}
+	for range 3 {
+		s.Count()
+	}
+
+	var out strings.Builder
+	metrics.Default.WriteText(&out)
+	for _, want := range []string{
+		`store_operation_duration_seconds_count{operation="Save",backend="instrumented_test",outcome="success"} 1`,
+		`store_operation_duration_seconds_count{operation="FindByID",backend="instrumented_test",outcome="success"} 1`,
+		`store_operation_duration_seconds_count{operation="Count",backend="instrumented_test",outcome="failure"} 3`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("/metrics lacks %s", want)
+		}
+	}
+	if strings.Contains(out.String(), `operation="List",backend="instrumented_test"`) {
+		t.Error("/metrics has an operation never called")
+	}
+
+	summary := s.LatencySummary(time.Minute)
+	got := make(map[string]store.OperationLatency)
+	for _, op := range summary {
+		got[op.Operation] = op
+	}
+	if len(summary) != 3 || got["Save"].Count != 1 || got["FindByID"].Failures != 0 || got["Count"].Count != 3 || got["Count"].Failures != 3 {
+		t.Fatalf("LatencySummary = %+v", summary)
+	}
+	if c := got["Count"]; c.P50Ms > c.P95Ms || c.P95Ms > c.P99Ms || c.P99Ms > c.MaxMs {
+		t.Fatalf("percentiles out of order: %+v", c)
+	}
+	if s.Backend() != "instrumented_test" {
+		t.Fatalf("Backend = %q", s.Backend())
+	}
+}
+
+func TestLatencySummaryKeepsRecentCalls(t *testing.T) {
+	s := store.NewInstrumentedStore(store.NewMemoryStore(), "instrumented_window_test")
+	for range 5000 {
+		s.Count()
+	}
+	summary := s.LatencySummary(time.Hour)
+	if len(summary) != 1 || summary[0].Count != 4096 {
+		t.Fatalf("LatencySummary = %+v, want the last 4096 calls", summary)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if summary := s.LatencySummary(5 * time.Millisecond); len(summary) != 0 {
+		t.Fatalf("LatencySummary over a window with no calls = %+v", summary)
+	}
+}
+
+// BenchmarkInstrumentedStore compares a memory store call with and without
+// instrumentation, which should add well under a microsecond and no
+// allocations.
+func BenchmarkInstrumentedStore(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		s    store.Store
+	}{
+		{"Bare", store.NewMemoryStore()},
+		{"Instrumented", store.NewInstrumentedStore(store.NewMemoryStore(), "benchmark")},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				bc.s.Count()
+			}
+		})
+	}
+}
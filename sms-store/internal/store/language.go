@@ -0,0 +1,84 @@
+package store
+
+import (
+	"cmp"
+
+	"sms-store/internal/models"
+)
+
+// LanguageDetector tells the language of message text, as a BCP 47 code
+// or models.LanguageUndetermined, and the confidence of it from 0 to 1.
+type LanguageDetector interface {
+	Detect(text string) (string, float64)
+}
+
+// LanguageDetectingStore wraps a Store so every saved message, and every
+// message whose text is updated, carries the language of its text.
+// Messages that already have one keep it.
+type LanguageDetectingStore struct {
+	Store
+	detector LanguageDetector
+}
+
+// NewLanguageDetectingStore wraps s, detecting the language of saved
+// messages with detector.
+func NewLanguageDetectingStore(s Store, detector LanguageDetector) *LanguageDetectingStore {
+	return &LanguageDetectingStore{Store: s, detector: detector}
+}
+
+// Save detects the language of msg and stores it.
+func (s *LanguageDetectingStore) Save(msg models.Message) (models.Message, error) {
+	return s.Store.Save(s.detect(msg))
+}
+
+// SaveBatch detects the language of each message and stores the batch.
+func (s *LanguageDetectingStore) SaveBatch(msgs []models.Message) (int, error) {
+	detected := make([]models.Message, len(msgs))
+	for i, msg := range msgs {
+		detected[i] = s.detect(msg)
+	}
+	return s.Store.SaveBatch(detected)
+}
+
+// UpdateMessage patches a message, detecting its language again when the
+// text changes.
+func (s *LanguageDetectingStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	if patch.Text != nil {
+		code, confidence := s.detector.Detect(*patch.Text)
+		patch.Language = &models.Language{Code: code, Confidence: confidence}
+	}
+	return s.Store.UpdateMessage(id, patch)
+}
+
+func (s *LanguageDetectingStore) detect(msg models.Message) models.Message {
+	if msg.Language == nil {
+		code, confidence := s.detector.Detect(msg.Text)
+		msg.Language = &models.Language{Code: code, Confidence: confidence}
+	}
+	return msg
+}
+
+// languageCode returns the language code of msg, models.LanguageUndetermined
+// for messages stored without one.
+func languageCode(msg models.Message) string {
+	if msg.Language == nil || msg.Language.Code == "" {
+		return models.LanguageUndetermined
+	}
+	return msg.Language.Code
+}
+
+// dominantLanguage returns the language most of counts are in, leaving
+// out models.LanguageUndetermined, with ties going to the lesser code; ""
+// when there is none.
+func dominantLanguage(counts map[string]int64) string {
+	best, bestCount := "", int64(0)
+	for code, n := range counts {
+		if code == models.LanguageUndetermined || n <= 0 {
+			continue
+		}
+		if c := cmp.Compare(n, bestCount); c > 0 || c == 0 && code < best {
+			best, bestCount = code, n
+		}
+	}
+	return best
+}
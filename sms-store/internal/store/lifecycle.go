@@ -0,0 +1,206 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// ErrInvalidTransition is wrapped by the *TransitionError returned for a
+// state change the conversation's current state doesn't allow.
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// TransitionError describes a rejected state change.
+type TransitionError struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("conversation is %s, can't become %s: %v", e.From, e.To, ErrInvalidTransition)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// transitionAttempts bounds how often Transition retries a change that
+// raced another one.
+const transitionAttempts = 3
+
+// allowedTransitions lists the states each state may move to. Snoozing a
+// snoozed conversation moves its snooze.
+var allowedTransitions = map[string][]string{
+	models.ConversationOpen:    {models.ConversationClosed, models.ConversationSnoozed},
+	models.ConversationClosed:  {models.ConversationOpen},
+	models.ConversationSnoozed: {models.ConversationOpen, models.ConversationClosed, models.ConversationSnoozed},
+}
+
+// ConversationLifecycle moves conversations between the open, closed and
+// snoozed states kept on their summaries, recording each transition in an
+// audit log.
+type ConversationLifecycle struct {
+	summaries SummaryStore
+	audit     AuditStore
+
+	clock.Clocked
+}
+
+// NewConversationLifecycle keeps states in ss and records transitions in as.
+func NewConversationLifecycle(ss SummaryStore, as AuditStore) *ConversationLifecycle {
+	return &ConversationLifecycle{summaries: ss, audit: as}
+}
+
+// Transition moves phoneNumber's conversation to state, snoozed until until
+// for models.ConversationSnoozed, on behalf of actor in accountID. It
+// returns the updated summary, a *TransitionError when the conversation's
+// current state doesn't allow the change, or ErrNotFound when it has no
+// messages and wasn't opened.
+func (l *ConversationLifecycle) Transition(phoneNumber, state string, until *time.Time, accountID, actor string) (ConversationSummary, error) {
+	if state != models.ConversationSnoozed {
+		until = nil
+	}
+	for range transitionAttempts {
+		summary, err := l.summary(phoneNumber)
+		if err != nil {
+			return ConversationSummary{}, err
+		}
+		now := l.Clock().Now()
+		from := summary.EffectiveState(now)
+		if !slices.Contains(allowedTransitions[from], state) {
+			return ConversationSummary{}, &TransitionError{From: from, To: state}
+		}
+
+		updated, ok, err := l.summaries.SetState(phoneNumber, summary.State, StateChange{State: state, SnoozedUntil: until, At: now})
+		if err != nil {
+			return ConversationSummary{}, err
+		}
+		if !ok {
+			continue // Changed meanwhile; checked again against the new state
+		}
+		l.record(models.AuditEntry{
+			At:          now,
+			AccountID:   accountID,
+			Actor:       actor,
+			Action:      transitionAction(state),
+			PhoneNumber: phoneNumber,
+			Details:     transitionDetails(from, state, until),
+		})
+		return updated, nil
+	}
+	return ConversationSummary{}, fmt.Errorf("conversation %s kept changing state", phoneNumber)
+}
+
+// ReopenOnInbound reopens the closed and snoozed conversations that msgs,
+// just stored, bring a reply to that was sent after the conversation was
+// closed or snoozed. Failures are logged; the messages are
+// already stored and the conversation stays as it was.
+func (l *ConversationLifecycle) ReopenOnInbound(msgs []models.Message) {
+	replies := make(map[string]models.Message)
+	var phoneNumbers []string
+	for _, msg := range msgs {
+		if msg.Direction != models.DirectionInbound || msg.PhoneNumber == "" {
+			continue
+		}
+		if _, ok := replies[msg.PhoneNumber]; !ok {
+			phoneNumbers = append(phoneNumbers, msg.PhoneNumber)
+		}
+		replies[msg.PhoneNumber] = msg
+	}
+	if len(phoneNumbers) == 0 {
+		return
+	}
+
+	summaries, err := l.summaries.GetSummaries(phoneNumbers)
+	if err != nil {
+		log.Printf("Error reading state of %d conversation(s) to reopen: %v", len(phoneNumbers), err)
+		return
+	}
+	now := l.Clock().Now()
+	for _, pn := range phoneNumbers {
+		summary, ok := summaries[pn]
+		if !ok {
+			continue
+		}
+		from := summary.EffectiveState(now)
+		if from == models.ConversationOpen {
+			continue
+		}
+		if summary.StateChangedAt != nil && !replies[pn].CreatedAt.After(*summary.StateChangedAt) {
+			continue // A replayed reply the conversation was closed or snoozed after
+		}
+		_, changed, err := l.summaries.SetState(pn, summary.State, StateChange{State: models.ConversationOpen, At: now})
+		if err != nil {
+			log.Printf("Error reopening conversation %s: %v", pn, err)
+			continue
+		}
+		if !changed {
+			continue // Someone else changed it first
+		}
+		details := transitionDetails(from, models.ConversationOpen, nil)
+		details["reason"] = "inbound_message"
+		details["messageId"] = replies[pn].ID
+		l.record(models.AuditEntry{
+			At:          now,
+			AccountID:   accountOf(replies[pn]),
+			Actor:       models.AuditActorKafka,
+			Action:      models.AuditConversationReopened,
+			PhoneNumber: pn,
+			Details:     details,
+		})
+	}
+}
+
+// summary returns phoneNumber's summary, first building it from the
+// messages when they were stored before summaries were kept.
+func (l *ConversationLifecycle) summary(phoneNumber string) (ConversationSummary, error) {
+	summaries, err := l.summaries.GetSummaries([]string{phoneNumber})
+	if err != nil {
+		return ConversationSummary{}, err
+	}
+	if summary, ok := summaries[phoneNumber]; ok {
+		return summary, nil
+	}
+	if _, err := l.summaries.RebuildSummaries([]string{phoneNumber}); err != nil {
+		return ConversationSummary{}, err
+	}
+	if summaries, err = l.summaries.GetSummaries([]string{phoneNumber}); err != nil {
+		return ConversationSummary{}, err
+	}
+	if summary, ok := summaries[phoneNumber]; ok {
+		return summary, nil
+	}
+	return ConversationSummary{}, fmt.Errorf("conversation %s: %w", phoneNumber, ErrNotFound)
+}
+
+// record appends entry to the audit log. The transition is already applied,
+// so a failure is only logged.
+func (l *ConversationLifecycle) record(entry models.AuditEntry) {
+	if _, err := l.audit.RecordAudit(entry); err != nil {
+		log.Printf("Failed to audit %s of conversation %s: %v", entry.Action, entry.PhoneNumber, err)
+	}
+}
+
+func transitionAction(state string) string {
+	switch state {
+	case models.ConversationClosed:
+		return models.AuditConversationClosed
+	case models.ConversationSnoozed:
+		return models.AuditConversationSnoozed
+	default:
+		return models.AuditConversationReopened
+	}
+}
+
+func transitionDetails(from, to string, until *time.Time) map[string]any {
+	details := map[string]any{"from": from, "to": to}
+	if until != nil {
+		details["snoozedUntil"] = *until
+	}
+	return details
+}
@@ -1,36 +1,272 @@
 package store
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"sms-store/internal/models"
 )
 
+// MemoryLimits caps the size of a MemoryStore. Zero means no limit.
+type MemoryLimits struct {
+	MaxMessages       int `json:"maxMessages"`       // Most messages kept in total
+	MaxPerPhoneNumber int `json:"maxPerPhoneNumber"` // Most messages kept per conversation
+}
+
+// MessagesDeleted reports messages a store deleted on its own rather than
+// by request, so features derived from the messages can catch up.
+type MessagesDeleted struct {
+	Messages []models.Message
+	Reason   string // Why they were deleted, e.g. "evicted"
+}
+
+// MemoryStore keeps messages in memory, in the order they were stored.
+// With limits, storing a message over a limit evicts the oldest stored
+// message of its conversation, or of the whole store, in constant time.
 type MemoryStore struct {
-	mu       sync.Mutex
-	messages []models.Message
+	mu        sync.Mutex
+	limits    MemoryLimits
+	order     *list.List            // *memoryEntry, oldest stored first
+	byConv    map[string]*list.List // *memoryEntry per Message.ConversationKey, oldest stored first
+	providers map[providerKey]*memoryEntry
+	events    map[string]*memoryEntry // By Message.EventKey
+	evicted   int64
+	onDeleted func(MessagesDeleted)
+}
+
+// memoryEntry is a stored message with its places in both orders.
+type memoryEntry struct {
+	msg  models.Message
+	all  *list.Element
+	conv *list.Element
 }
 
+type providerKey struct{ name, messageID string }
+
 func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreWithLimits(MemoryLimits{})
+}
+
+// NewMemoryStoreWithLimits creates a memory store that evicts its oldest
+// messages to stay within limits.
+func NewMemoryStoreWithLimits(limits MemoryLimits) *MemoryStore {
 	return &MemoryStore{
-		messages: make([]models.Message, 0),
+		limits:    limits,
+		order:     list.New(),
+		byConv:    make(map[string]*list.List),
+		providers: make(map[providerKey]*memoryEntry),
+		events:    make(map[string]*memoryEntry),
 	}
 }
 
-func (s *MemoryStore) Save(msg models.Message) (models.Message, error) {
+// OnMessagesDeleted calls fn with the messages each write evicts, after
+// the write. fn may use the store.
+func (s *MemoryStore) OnMessagesDeleted(fn func(MessagesDeleted)) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.messages = append(s.messages, msg)
+	s.onDeleted = fn
+}
+
+func (s *MemoryStore) Save(msg models.Message) (models.Message, error) {
+	s.mu.Lock()
+	if s.hasProviderMessage(msg) {
+		s.mu.Unlock()
+		return models.Message{}, fmt.Errorf("message %w for provider message ID: %s", ErrAlreadyExists, msg.Provider.MessageID)
+	}
+	if s.hasEvent(msg) {
+		s.mu.Unlock()
+		return models.Message{}, fmt.Errorf("message %w for event: %s", ErrAlreadyExists, msg.EventKey)
+	}
+	evicted := s.insert(msg)
+	s.mu.Unlock()
+
+	s.notifyEvicted(evicted)
 	return msg, nil
 }
 
+// hasProviderMessage reports whether a message with the same provider name
+// and provider message ID is already stored. Callers must hold s.mu.
+func (s *MemoryStore) hasProviderMessage(msg models.Message) bool {
+	key, ok := providerKeyOf(msg)
+	if !ok {
+		return false
+	}
+	_, exists := s.providers[key]
+	return exists
+}
+
+// hasEvent reports whether a message consumed from the same Kafka event is
+// already stored. Callers must hold s.mu.
+func (s *MemoryStore) hasEvent(msg models.Message) bool {
+	if msg.EventKey == "" {
+		return false
+	}
+	_, exists := s.events[msg.EventKey]
+	return exists
+}
+
+func providerKeyOf(msg models.Message) (providerKey, bool) {
+	if msg.Provider == nil || msg.Provider.MessageID == "" {
+		return providerKey{}, false
+	}
+	return providerKey{msg.Provider.Name, msg.Provider.MessageID}, true
+}
+
+// insert stores msg and evicts what is over the limits, returning the
+// evicted messages. Callers must hold s.mu.
+func (s *MemoryStore) insert(msg models.Message) []models.Message {
+	e := &memoryEntry{msg: msg}
+	e.all = s.order.PushBack(e)
+	conv, ok := s.byConv[msg.ConversationKey()]
+	if !ok {
+		conv = list.New()
+		s.byConv[msg.ConversationKey()] = conv
+	}
+	e.conv = conv.PushBack(e)
+	if key, ok := providerKeyOf(msg); ok {
+		s.providers[key] = e
+	}
+	if msg.EventKey != "" {
+		s.events[msg.EventKey] = e
+	}
+
+	var evicted []models.Message
+	if limit := s.limits.MaxPerPhoneNumber; limit > 0 {
+		for conv.Len() > limit {
+			evicted = append(evicted, s.remove(conv.Front().Value.(*memoryEntry)))
+		}
+	}
+	if limit := s.limits.MaxMessages; limit > 0 {
+		for s.order.Len() > limit {
+			evicted = append(evicted, s.remove(s.order.Front().Value.(*memoryEntry)))
+		}
+	}
+	s.evicted += int64(len(evicted))
+	return evicted
+}
+
+// remove deletes e from the store and returns its message. Callers must
+// hold s.mu.
+func (s *MemoryStore) remove(e *memoryEntry) models.Message {
+	s.order.Remove(e.all)
+	key := e.msg.ConversationKey()
+	conv := s.byConv[key]
+	conv.Remove(e.conv)
+	if conv.Len() == 0 {
+		delete(s.byConv, key)
+	}
+	if pk, ok := providerKeyOf(e.msg); ok && s.providers[pk] == e {
+		delete(s.providers, pk)
+	}
+	if k := e.msg.EventKey; k != "" && s.events[k] == e {
+		delete(s.events, k)
+	}
+	return e.msg
+}
+
+// reset empties the store. Callers must hold s.mu.
+func (s *MemoryStore) reset() {
+	s.order.Init()
+	s.byConv = make(map[string]*list.List)
+	s.providers = make(map[providerKey]*memoryEntry)
+	s.events = make(map[string]*memoryEntry)
+}
+
+func (s *MemoryStore) notifyEvicted(evicted []models.Message) {
+	if len(evicted) == 0 {
+		return
+	}
+	s.mu.Lock()
+	fn := s.onDeleted
+	s.mu.Unlock()
+	if fn != nil {
+		fn(MessagesDeleted{Messages: evicted, Reason: "evicted"})
+	}
+}
+
+// entries yields every stored entry, oldest stored first. Callers must
+// hold s.mu and not remove entries while iterating.
+func (s *MemoryStore) entries() iter.Seq[*memoryEntry] {
+	return entriesOf(s.order)
+}
+
+// conversation yields the entries of the conversation with key, oldest
+// stored first. Callers must hold s.mu.
+func (s *MemoryStore) conversation(key string) iter.Seq[*memoryEntry] {
+	return entriesOf(s.byConv[key])
+}
+
+func entriesOf(l *list.List) iter.Seq[*memoryEntry] {
+	return func(yield func(*memoryEntry) bool) {
+		if l == nil {
+			return
+		}
+		for el := l.Front(); el != nil; el = el.Next() {
+			if !yield(el.Value.(*memoryEntry)) {
+				return
+			}
+		}
+	}
+}
+
+// Usage reports the store's size against its limits.
+func (s *MemoryStore) Usage() (StoreUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversations := int64(len(s.byConv))
+	limits := s.limits
+	return StoreUsage{
+		Backend:       "memory",
+		Messages:      int64(s.order.Len()),
+		Conversations: &conversations,
+		Limits:        &limits,
+		Evicted:       s.evicted,
+	}, nil
+}
+
+// QueryMessages collects the matching messages under the lock and hands
+// them to fn in batches without it, so fn may use the store.
+func (s *MemoryStore) QueryMessages(ctx context.Context, q MessageQuery, batchSize int, fn func([]models.Message) error) error {
+	s.mu.Lock()
+	matches := make([]models.Message, 0)
+	for e := range s.entries() {
+		if q.includes(e.msg) {
+			matches = append(matches, e.msg)
+		}
+	}
+	s.mu.Unlock()
+
+	sortNewestFirst(matches)
+	slices.Reverse(matches)
+	for batch := range slices.Chunk(matches, max(1, batchSize)) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *MemoryStore) List() ([]models.Message, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	out := make([]models.Message, len(s.messages))
-	copy(out, s.messages)
+	out := make([]models.Message, 0, s.order.Len())
+	for e := range s.entries() {
+		out = append(out, e.msg)
+	}
 	return out, nil
 }
 
@@ -38,46 +274,493 @@ func (s *MemoryStore) FindByPhoneNumber(phoneNumber string) ([]models.Message, e
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var result []models.Message
-	for _, msg := range s.messages {
-		if msg.PhoneNumber == phoneNumber {
+	result := make([]models.Message, 0)
+	for e := range s.conversation(phoneNumber) {
+		if e.msg.PhoneNumber == phoneNumber {
+			result = append(result, e.msg)
+		}
+	}
+	sortNewestFirst(result)
+	return result, nil
+}
+
+func (s *MemoryStore) FindByID(id string) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := range s.entries() {
+		if e.msg.ID == id {
+			return e.msg, nil
+		}
+	}
+	return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+}
+
+func (s *MemoryStore) FindByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]models.Message, 0)
+	for e := range s.conversation(phoneNumber) {
+		if msg := e.msg; msg.PhoneNumber == phoneNumber && page.includes(msg) {
 			result = append(result, msg)
 		}
 	}
+
+	page.sort(result)
+	if page.Limit > 0 && len(result) > page.Limit {
+		result = result[:page.Limit]
+	}
 	return result, nil
 }
 
+func (s *MemoryStore) FindByConversationPage(conversationID string, page PageQuery) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]models.Message, 0)
+	for e := range s.conversation(conversationID) {
+		if msg := e.msg; msg.ConversationID == conversationID && page.includes(msg) {
+			result = append(result, msg)
+		}
+	}
+
+	page.sort(result)
+	if page.Limit > 0 && len(result) > page.Limit {
+		result = result[:page.Limit]
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) ListPage(page PageQuery) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]models.Message, 0)
+	for e := range s.entries() {
+		if msg := e.msg; page.includes(msg) {
+			result = append(result, msg)
+		}
+	}
+
+	page.sort(result)
+	if page.Limit > 0 && len(result) > page.Limit {
+		result = result[:page.Limit]
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) CountMessages(senderID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if senderID == "" {
+		return int64(s.order.Len()), nil
+	}
+	var n int64
+	for e := range s.entries() {
+		if msg := e.msg; msg.Provider != nil && msg.Provider.SenderID == senderID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) CountByAccount(phoneNumber string) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int64)
+	for e := range s.entries() {
+		msg := e.msg
+		if phoneNumber != "" && msg.PhoneNumber != phoneNumber {
+			continue
+		}
+		account := msg.AccountID
+		if account == "" {
+			account = models.DefaultAccountID
+		}
+		counts[account]++
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) CountByParticipant(phoneNumber string) ([]ParticipantCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]*ParticipantCount)
+	named := make(map[string]time.Time)
+	for e := range s.conversation(phoneNumber) {
+		msg := e.msg
+		if msg.PhoneNumber != phoneNumber {
+			continue
+		}
+		id := msg.ParticipantID()
+		c := counts[id]
+		if c == nil {
+			c = &ParticipantCount{ID: id}
+			counts[id] = c
+		}
+		c.Messages++
+		if msg.Participant != nil && msg.Participant.Name != "" {
+			if at, ok := named[id]; !ok || !msg.CreatedAt.Before(at) {
+				c.Name, named[id] = msg.Participant.Name, msg.CreatedAt
+			}
+		}
+	}
+	out := make([]ParticipantCount, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, *c)
+	}
+	sortParticipantCounts(out)
+	return out, nil
+}
+
+func (s *MemoryStore) CountAnnotations(phoneNumber string) ([]AnnotationCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]*AnnotationCount)
+	for e := range s.conversation(phoneNumber) {
+		if e.msg.PhoneNumber != phoneNumber {
+			continue
+		}
+		for _, a := range e.msg.Annotations {
+			c := counts[a.Label]
+			if c == nil {
+				c = &AnnotationCount{Label: a.Label}
+				counts[a.Label] = c
+			}
+			c.Annotations++
+			if a.Review != nil {
+				switch a.Review.Decision {
+				case models.AnnotationConfirmed:
+					c.Confirmed++
+				case models.AnnotationRejected:
+					c.Rejected++
+				}
+			}
+		}
+	}
+	out := make([]AnnotationCount, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, *c)
+	}
+	sortAnnotationCounts(out)
+	return out, nil
+}
+
+func (s *MemoryStore) CountAfter(after map[string]time.Time) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int64)
+	for e := range s.entries() {
+		msg := e.msg
+		if t, ok := after[msg.PhoneNumber]; ok && msg.CreatedAt.After(t) && counted(msg) {
+			counts[msg.PhoneNumber]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) SearchMessages(query string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	needle := strings.ToLower(query)
+	result := make([]models.Message, 0)
+	for e := range s.entries() {
+		if msg := e.msg; strings.Contains(strings.ToLower(msg.Text), needle) && hasExternalRef(msg, ref) {
+			result = append(result, msg)
+		}
+	}
+
+	sortNewestFirst(result)
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) SearchMessagePrefixes(tokens []string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]models.Message, 0)
+	for e := range s.entries() {
+		if msg := e.msg; hasAllTokens(msg.SearchTokens, tokens) && hasExternalRef(msg, ref) {
+			result = append(result, msg)
+		}
+	}
+
+	sortNewestFirst(result)
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// hasExternalRef reports whether msg carries ref; any message matches a nil ref.
+func hasExternalRef(msg models.Message, ref *models.ExternalRef) bool {
+	return ref == nil || slices.Contains(msg.ExternalRefs, *ref)
+}
+
+func hasAllTokens(have, want []string) bool {
+	for _, t := range want {
+		if !slices.Contains(have, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MemoryStore) SetSearchTokens(tokens map[string][]string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for e := range s.entries() {
+		if t, ok := tokens[e.msg.ID]; ok {
+			e.msg.SearchTokens = t
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) DailyDigest(phoneNumber string, q DigestQuery) ([]DailyBucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	msgs := make([]models.Message, 0)
+	for e := range s.conversation(phoneNumber) {
+		msg := e.msg
+		if msg.PhoneNumber != phoneNumber {
+			continue
+		}
+		if !q.From.IsZero() && msg.CreatedAt.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !msg.CreatedAt.Before(q.To) {
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+
+	// Oldest first, so days and their messages come out in order
+	sortNewestFirst(msgs)
+	buckets := make([]DailyBucket, 0)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msg := msgs[i]
+		start := startOfDay(msg.CreatedAt, loc)
+		if n := len(buckets); n == 0 || !buckets[n-1].Start.Equal(start) {
+			buckets = append(buckets, DailyBucket{Date: start.Format("2006-01-02"), Start: start})
+		}
+		b := &buckets[len(buckets)-1]
+		b.Count++
+		if q.IncludeMessages {
+			b.Messages = append(b.Messages, msg)
+		}
+	}
+	return buckets, nil
+}
+
+func (s *MemoryStore) CostSummary(q CostQuery) ([]CostBucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	type groupKey struct{ key, currency string }
+	groups := make(map[groupKey]*CostBucket)
+	for e := range s.entries() {
+		msg := e.msg
+		if msg.Cost == nil {
+			continue
+		}
+		if !q.From.IsZero() && msg.CreatedAt.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !msg.CreatedAt.Before(q.To) {
+			continue
+		}
+
+		k := groupKey{currency: msg.Cost.Currency}
+		switch q.GroupBy {
+		case CostByAccount:
+			k.key = msg.AccountID
+			if k.key == "" {
+				k.key = models.DefaultAccountID
+			}
+		case CostByLanguage:
+			k.key = languageCode(msg)
+		case CostByAnnotation:
+			k.key = topAnnotationLabel(msg)
+		default:
+			k.key = startOfDay(msg.CreatedAt, loc).Format("2006-01-02")
+		}
+
+		b, ok := groups[k]
+		if !ok {
+			b = &CostBucket{Key: k.key, Currency: k.currency}
+			groups[k] = b
+		}
+		b.Messages++
+		b.Segments += msg.Cost.Segments
+		b.EstimatedCost += msg.Cost.EstimatedCost
+		if msg.Cost.DefaultRate {
+			b.DefaultRateMessages++
+		}
+	}
+
+	buckets := make([]CostBucket, 0, len(groups))
+	for _, b := range groups {
+		buckets = append(buckets, *b)
+	}
+	sortCostBuckets(buckets)
+	return buckets, nil
+}
+
+// sortCostBuckets orders buckets by key, then currency.
+func sortCostBuckets(buckets []CostBucket) {
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Key != buckets[j].Key {
+			return buckets[i].Key < buckets[j].Key
+		}
+		return buckets[i].Currency < buckets[j].Currency
+	})
+}
+
+// includes reports whether msg matches the page's sender, language,
+// participant, external reference, annotation, direction and region
+// filters and falls on or after its Before position.
+func (p PageQuery) includes(msg models.Message) bool {
+	if p.SenderID != "" && (msg.Provider == nil || msg.Provider.SenderID != p.SenderID) {
+		return false
+	}
+	if p.Language != "" && (msg.Language == nil || !models.LanguageMatches(msg.Language.Code, p.Language)) {
+		return false
+	}
+	if p.Participant != "" && msg.ParticipantID() != p.Participant {
+		return false
+	}
+	if !hasExternalRef(msg, p.ExternalRef) {
+		return false
+	}
+	if p.Annotation != "" && !msg.HasAnnotation(p.Annotation, p.MinConfidence) {
+		return false
+	}
+	if p.Direction != "" && !(MessageQuery{Direction: p.Direction}).includes(msg) {
+		return false
+	}
+	if !inRegions(msg, p.Regions, p.OutsideRegions) {
+		return false
+	}
+	if p.OldestFirst {
+		if p.After.IsZero() || msg.CreatedAt.After(p.After) {
+			return true
+		}
+		return msg.CreatedAt.Equal(p.After) && msg.ID > p.AfterID
+	}
+	if p.Before.IsZero() {
+		return true
+	}
+	if msg.CreatedAt.Before(p.Before) {
+		return true
+	}
+	return msg.CreatedAt.Equal(p.Before) && msg.ID < p.BeforeID
+}
+
+// sort orders messages as the page asks.
+func (p PageQuery) sort(msgs []models.Message) {
+	sortNewestFirst(msgs)
+	if p.OldestFirst {
+		slices.Reverse(msgs)
+	}
+}
+
+// sortNewestFirst orders messages by createdAt descending, ID descending.
+func sortNewestFirst(msgs []models.Message) {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if !msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+			return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+		}
+		return msgs[i].ID > msgs[j].ID
+	})
+}
+
 func (s *MemoryStore) DeleteAll() (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	count := int64(len(s.messages))
-	s.messages = make([]models.Message, 0)
+	count := int64(s.order.Len())
+	s.reset()
 	return count, nil
 }
 
-func (s *MemoryStore) SaveBatch(msgs []models.Message) (int, error) {
+func (s *MemoryStore) Count() (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.messages = append(s.messages, msgs...)
-	return len(msgs), nil
+	return int64(s.order.Len()), nil
 }
 
-func (s *MemoryStore) GetDistinctPhoneNumbers() ([]string, error) {
+func (s *MemoryStore) DeleteAllBatch(limit int) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	phoneNumberSet := make(map[string]bool)
-	for _, msg := range s.messages {
-		if msg.PhoneNumber != "" {
-			phoneNumberSet[msg.PhoneNumber] = true
+	n := min(limit, s.order.Len())
+	for range n {
+		s.remove(s.order.Front().Value.(*memoryEntry))
+	}
+	return int64(n), nil
+}
+
+func (s *MemoryStore) DropAll() (int64, error) {
+	return s.DeleteAll()
+}
+
+func (s *MemoryStore) SaveBatch(msgs []models.Message) (int, error) {
+	s.mu.Lock()
+
+	// Provider retries and replayed events are skipped, matching the unique
+	// indexes in MongoStore
+	saved := 0
+	var evicted []models.Message
+	for _, msg := range msgs {
+		if s.hasProviderMessage(msg) || s.hasEvent(msg) {
+			continue
 		}
+		evicted = append(evicted, s.insert(msg)...)
+		saved++
 	}
+	s.mu.Unlock()
+
+	s.notifyEvicted(evicted)
+	return saved, nil
+}
+
+func (s *MemoryStore) GetDistinctPhoneNumbers() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	result := make([]string, 0, len(phoneNumberSet))
-	for pn := range phoneNumberSet {
-		result = append(result, pn)
+	result := make([]string, 0, len(s.byConv))
+	for _, conv := range s.byConv {
+		// A conversation's messages share its key, so the first one tells
+		// whether it is a direct conversation
+		if pn := conv.Front().Value.(*memoryEntry).msg.PhoneNumber; pn != "" {
+			result = append(result, pn)
+		}
 	}
 
 	return result, nil
@@ -87,17 +770,175 @@ func (s *MemoryStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var deletedCount int64
-	filtered := make([]models.Message, 0, len(s.messages))
-	
-	for _, msg := range s.messages {
-		if msg.PhoneNumber != phoneNumber {
-			filtered = append(filtered, msg)
-		} else {
-			deletedCount++
+	var deleted []*memoryEntry
+	for e := range s.conversation(phoneNumber) {
+		if e.msg.PhoneNumber == phoneNumber {
+			deleted = append(deleted, e)
+		}
+	}
+	for _, e := range deleted {
+		s.remove(e)
+	}
+	return int64(len(deleted)), nil
+}
+
+func (s *MemoryStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := range s.entries() {
+		if e.msg.ID != id {
+			continue
+		}
+		if patch.Status != nil {
+			e.msg.Status = *patch.Status
+		}
+		if patch.Text != nil {
+			e.msg.Text = *patch.Text
+		}
+		if patch.SearchTokens != nil {
+			e.msg.SearchTokens = patch.SearchTokens
+		}
+		if patch.Language != nil {
+			e.msg.Language = patch.Language
+		}
+		if patch.Participant != nil {
+			e.msg.Participant = patch.Participant
+			if patch.Participant.ID == "" {
+				e.msg.Participant = nil
+			}
+		}
+		return e.msg, nil
+	}
+	return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+}
+
+// AddReaction replaces the message's reactions and counts rather than
+// appending to them, so messages returned earlier keep theirs.
+func (s *MemoryStore) AddReaction(id string, reaction models.Reaction) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := range s.entries() {
+		if e.msg.ID != id {
+			continue
+		}
+		if hasReaction(e.msg, reaction.Emoji, reaction.Actor) {
+			return e.msg, nil
+		}
+		if len(e.msg.Reactions) >= MaxReactionsPerMessage {
+			return models.Message{}, fmt.Errorf("message %s has %d reactions: %w", id, len(e.msg.Reactions), ErrTooManyReactions)
+		}
+		counts := maps.Clone(e.msg.ReactionCounts)
+		if counts == nil {
+			counts = make(map[string]int)
+		}
+		counts[reaction.Emoji]++
+		e.msg.Reactions = append(slices.Clip(e.msg.Reactions), reaction)
+		e.msg.ReactionCounts = counts
+		return e.msg, nil
+	}
+	return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+}
+
+func (s *MemoryStore) RemoveReaction(id, emoji, actor string) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := range s.entries() {
+		if e.msg.ID != id {
+			continue
+		}
+		if !hasReaction(e.msg, emoji, actor) {
+			return e.msg, nil
+		}
+		e.msg.Reactions = slices.DeleteFunc(slices.Clone(e.msg.Reactions), func(r models.Reaction) bool {
+			return r.Emoji == emoji && r.Actor == actor
+		})
+		counts := maps.Clone(e.msg.ReactionCounts)
+		if counts[emoji]--; counts[emoji] <= 0 {
+			delete(counts, emoji)
+		}
+		if len(e.msg.Reactions) == 0 {
+			e.msg.Reactions, counts = nil, nil
+		}
+		e.msg.ReactionCounts = counts
+		return e.msg, nil
+	}
+	return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+}
+
+// SetAnnotation replaces the message's annotations rather than changing
+// them in place, as AddReaction does its reactions.
+func (s *MemoryStore) SetAnnotation(id string, annotation models.Annotation) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := range s.entries() {
+		if e.msg.ID != id {
+			continue
+		}
+		i := annotationIndex(e.msg, annotation.Source)
+		if i < 0 {
+			if len(e.msg.Annotations) >= MaxAnnotationsPerMessage {
+				return models.Message{}, fmt.Errorf("message %s has %d annotations: %w", id, len(e.msg.Annotations), ErrTooManyAnnotations)
+			}
+			e.msg.Annotations = append(slices.Clip(e.msg.Annotations), annotation)
+			return e.msg, nil
+		}
+		annotations := slices.Clone(e.msg.Annotations)
+		annotations[i] = annotation
+		e.msg.Annotations = annotations
+		return e.msg, nil
+	}
+	return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+}
+
+// SetTranslation replaces the message's translations rather than changing
+// them in place, as SetAnnotation does its annotations.
+func (s *MemoryStore) SetTranslation(id string, translation models.Translation, overwrite bool) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := range s.entries() {
+		if e.msg.ID != id {
+			continue
+		}
+		i := translationIndex(e.msg, translation.Language)
+		if i < 0 {
+			if len(e.msg.Translations) >= MaxTranslationsPerMessage {
+				return models.Message{}, fmt.Errorf("message %s has %d translations: %w", id, len(e.msg.Translations), ErrTooManyTranslations)
+			}
+			e.msg.Translations = append(slices.Clip(e.msg.Translations), translation)
+			return e.msg, nil
+		}
+		if !overwrite {
+			return models.Message{}, fmt.Errorf("translation of %s into %s %w", id, translation.Language, ErrAlreadyExists)
+		}
+		translations := slices.Clone(e.msg.Translations)
+		translations[i] = translation
+		e.msg.Translations = translations
+		return e.msg, nil
+	}
+	return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+}
+
+func (s *MemoryStore) ReviewAnnotation(id, source string, review models.AnnotationReview) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := range s.entries() {
+		if e.msg.ID != id {
+			continue
+		}
+		i := annotationIndex(e.msg, source)
+		if i < 0 {
+			return models.Message{}, fmt.Errorf("annotation %w: %s has none from %s", ErrNotFound, id, source)
 		}
+		annotations := slices.Clone(e.msg.Annotations)
+		annotations[i].Review = &review
+		e.msg.Annotations = annotations
+		return e.msg, nil
 	}
-	
-	s.messages = filtered
-	return deletedCount, nil
+	return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
 }
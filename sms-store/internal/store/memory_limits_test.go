@@ -0,0 +1,171 @@
+package store_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+	"sms-store/internal/store/storetest"
+)
+
+// Limits the conformance suite never reaches still change how the store
+// keeps its messages, so it must pass with them too.
+func TestBoundedMemoryStoreConformance(t *testing.T) {
+	storetest.RunStoreConformance(t, func(t *testing.T) store.Store {
+		return store.NewMemoryStoreWithLimits(store.MemoryLimits{MaxMessages: 10000, MaxPerPhoneNumber: 1000})
+	})
+}
+
+func limitsMessage(id, phoneNumber string, at time.Time) models.Message {
+	return models.Message{ID: id, PhoneNumber: phoneNumber, Text: "text of " + id, CreatedAt: at}
+}
+
+func storedIDs(t *testing.T, s store.Store, phoneNumber string) []string {
+	t.Helper()
+	msgs, err := s.FindByPhoneNumber(phoneNumber)
+	if err != nil {
+		t.Fatalf("FindByPhoneNumber: %v", err)
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestMemoryStoreEvictsOldestStored(t *testing.T) {
+	s := store.NewMemoryStoreWithLimits(store.MemoryLimits{MaxMessages: 4, MaxPerPhoneNumber: 2})
+	var deleted []store.MessagesDeleted
+	s.OnMessagesDeleted(func(ev store.MessagesDeleted) { deleted = append(deleted, ev) })
+
+	// Eviction follows the order messages were stored in, not their dates
+	start := time.Now().Add(-time.Hour)
+	for i, id := range []string{"a1", "a2", "b1", "c1"} {
+		if _, err := s.Save(limitsMessage(id, "1111111111"[:9]+id[:1], start.Add(-time.Duration(i)*time.Minute))); err != nil {
+			t.Fatalf("Save %s: %v", id, err)
+		}
+	}
+	// A third message of conversation a evicts its first
+	if _, err := s.Save(limitsMessage("a3", "111111111a", start)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// And a batch over the store's limit evicts the oldest stored overall
+	if n, err := s.SaveBatch([]models.Message{limitsMessage("d1", "111111111d", start), limitsMessage("d2", "111111111d", start)}); err != nil || n != 2 {
+		t.Fatalf("SaveBatch = %d, %v", n, err)
+	}
+
+	for pn, want := range map[string][]string{
+		"111111111a": {"a3"},
+		"111111111b": nil,
+		"111111111c": {"c1"},
+		"111111111d": {"d2", "d1"},
+	} {
+		if got := storedIDs(t, s, pn); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("conversation %s = %v, want %v", pn, got, want)
+		}
+	}
+
+	var evicted [][]string
+	for _, ev := range deleted {
+		if ev.Reason != "evicted" {
+			t.Fatalf("reason = %q", ev.Reason)
+		}
+		var ids []string
+		for _, m := range ev.Messages {
+			ids = append(ids, m.ID)
+		}
+		evicted = append(evicted, ids)
+	}
+	if fmt.Sprint(evicted) != "[[a1] [a2 b1]]" {
+		t.Fatalf("evicted %v, want a1 on its own write, then a2 and b1 on the batch", evicted)
+	}
+
+	usage, err := s.Usage()
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Messages != 4 || *usage.Conversations != 3 || usage.Evicted != 3 || *usage.Limits != (store.MemoryLimits{MaxMessages: 4, MaxPerPhoneNumber: 2}) {
+		t.Fatalf("Usage = %+v", usage)
+	}
+}
+
+func TestMemoryStoreEvictionFreesDuplicateKeys(t *testing.T) {
+	s := store.NewMemoryStoreWithLimits(store.MemoryLimits{MaxPerPhoneNumber: 1})
+	first := limitsMessage("m1", "1111111111", time.Now())
+	first.Provider = &models.Provider{Name: "acme", MessageID: "p1"}
+	first.EventKey = "sms-events/0/1"
+	if _, err := s.Save(first); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := s.Save(first); err == nil {
+		t.Fatal("saved the same provider message twice")
+	}
+	if _, err := s.Save(limitsMessage("m2", "1111111111", time.Now())); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// m1 was evicted, so its provider ID and event may be stored again
+	if _, err := s.Save(first); err != nil {
+		t.Fatalf("Save after eviction: %v", err)
+	}
+}
+
+func TestSummariesFollowEvictions(t *testing.T) {
+	mem := store.NewMemoryStoreWithLimits(store.MemoryLimits{MaxMessages: 5, MaxPerPhoneNumber: 3})
+	summaries := store.NewMemorySummaryStore(mem)
+	s := store.NewSummarizingStore(mem, summaries)
+	mem.OnMessagesDeleted(s.MessagesDeleted)
+
+	start := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+	phoneNumbers := []string{"1111111111", "2222222222", "3333333333"}
+	for i := range 12 {
+		pn := phoneNumbers[i%len(phoneNumbers)]
+		msg := limitsMessage(fmt.Sprintf("m%d", i), pn, start.Add(time.Duration(i)*time.Minute))
+		if i%4 == 0 {
+			if _, err := s.SaveBatch([]models.Message{msg}); err != nil {
+				t.Fatalf("SaveBatch: %v", err)
+			}
+		} else if _, err := s.Save(msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	stored, err := summaries.GetSummaries(phoneNumbers)
+	if err != nil {
+		t.Fatalf("GetSummaries: %v", err)
+	}
+	computed, err := summaries.ComputeSummaries(phoneNumbers)
+	if err != nil {
+		t.Fatalf("ComputeSummaries: %v", err)
+	}
+	var total int64
+	for _, pn := range phoneNumbers {
+		got := stored[pn]
+		total += got.MessageCount
+		got.UpdatedAt = time.Time{} // Set only on stored summaries
+		if !reflect.DeepEqual(got, computed[pn]) {
+			t.Errorf("summary of %s = %+v, recomputed %+v", pn, got, computed[pn])
+		}
+	}
+	if total != 5 {
+		t.Fatalf("summaries count %d messages, want the 5 kept", total)
+	}
+}
+
+// BenchmarkBoundedMemoryStoreSave stores into a full store, so every save
+// evicts.
+func BenchmarkBoundedMemoryStoreSave(b *testing.B) {
+	s := store.NewMemoryStoreWithLimits(store.MemoryLimits{MaxMessages: 100000, MaxPerPhoneNumber: 50})
+	now := time.Now()
+	i := 0
+	b.ReportAllocs()
+	for b.Loop() {
+		msg := models.Message{ID: fmt.Sprintf("m%d", i), PhoneNumber: fmt.Sprintf("9%09d", i%5000), Text: "hello", CreatedAt: now}
+		if _, err := s.Save(msg); err != nil {
+			b.Fatal(err)
+		}
+		i++
+	}
+}
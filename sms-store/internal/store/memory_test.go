@@ -0,0 +1,54 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"sms-store/internal/store"
+	"sms-store/internal/store/storetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storetest.RunStoreConformance(t, func(t *testing.T) store.Store {
+		return store.NewMemoryStore()
+	})
+}
+
+func TestMemoryStoreTombstoningConformance(t *testing.T) {
+	storetest.RunTombstoningConformance(t, func(t *testing.T) store.Store {
+		return store.NewMemoryStore()
+	})
+}
+
+// The decorators main wraps every backend in must pass each call through
+// without changing its contract.
+func TestDecoratedMemoryStoreConformance(t *testing.T) {
+	storetest.RunStoreConformance(t, func(t *testing.T) store.Store {
+		var s store.Store = store.NewMemoryStore()
+		s = store.NewInstrumentedStore(s, "memory")
+		s = store.NewRetryingStore(s, store.DefaultRetryPolicy())
+		s = store.NewCoalescingStore(s, store.NewCoalescer(time.Second))
+		return s
+	})
+}
+
+func TestMemoryProfileStoreConformance(t *testing.T) {
+	storetest.RunProfileStoreConformance(t, func(t *testing.T) store.ProfileStore {
+		return store.NewMemoryProfileStore()
+	})
+}
+
+func TestDecoratedMemoryProfileStoreConformance(t *testing.T) {
+	storetest.RunProfileStoreConformance(t, func(t *testing.T) store.ProfileStore {
+		var ps store.ProfileStore = store.NewMemoryProfileStore()
+		ps = store.NewRetryingProfileStore(ps, store.DefaultRetryPolicy())
+		ps = store.NewCoalescingProfileStore(ps, store.NewCoalescer(time.Second))
+		return ps
+	})
+}
+
+func TestMemoryDeletionReceiptStoreConformance(t *testing.T) {
+	storetest.RunDeletionReceiptConformance(t, func(t *testing.T) store.DeletionReceiptStore {
+		return store.NewMemoryDeletionReceiptStore()
+	})
+}
@@ -1,12 +1,16 @@
 package store
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"sync/atomic"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -18,6 +22,11 @@ type MongoStore struct {
 	client     *mongo.Client
 	database   *mongo.Database
 	collection *mongo.Collection
+
+	server       serverInfo
+	readFrom     string      // Read preference of a store from WithReadPreference; primary when empty
+	limits       ReadLimits  // Of reads returning a slice
+	indexesReady atomic.Bool // The query indexes BuildIndexes creates exist
 }
 
 // NewMongoStore creates a new MongoDB store instance.
@@ -54,22 +63,108 @@ func NewMongoStore(connectionString, databaseName, collectionName string) (*Mong
 	database := client.Database(databaseName)
 	collection := database.Collection(collectionName)
 
-	// Create index on phoneNumber for faster queries
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "phoneNumber", Value: 1}},
-		Options: options.Index().SetName("phoneNumber_idx"),
-	}
-	_, err = collection.Indexes().CreateOne(ctx, indexModel)
+	// The compound query indexes can take long enough to build on a large
+	// collection to block writes past their timeouts, so only the others
+	// are created here; BuildIndexes creates the rest in the background
+	_, err = collection.Indexes().CreateMany(ctx, startupIndexModels())
 	if err != nil {
 		// Log error but don't fail - index might already exist
 		// In production, you'd want proper logging here
 	}
 
-	return &MongoStore{
+	s := &MongoStore{
 		client:     client,
 		database:   database,
 		collection: collection,
-	}, nil
+		server:     detectServer(ctx, client),
+		limits:     DefaultReadLimits(),
+	}
+	if missing, err := s.missingQueryIndexes(ctx); err == nil && len(missing) == 0 {
+		s.indexesReady.Store(true)
+	}
+	return s, nil
+}
+
+// messageIndexModels are the indexes of the messages collection, those
+// created at startup and the query indexes.
+func messageIndexModels() []mongo.IndexModel {
+	return append(startupIndexModels(), queryIndexModels()...)
+}
+
+// startupIndexModels are the indexes NewMongoStore creates: phoneNumber for
+// faster queries, id for lookups and updates by message ID, and unique
+// indexes on the provider's message ID so provider retries are stored once
+// and on the Kafka event key so replayed events are too. Both only cover
+// messages that carry the key, which makes them sparse. The unique indexes
+// are created at startup, however long they take, because without them
+// duplicates would be stored.
+func startupIndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "phoneNumber", Value: 1}},
+			Options: options.Index().SetName("phoneNumber_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetName("id_idx"),
+		},
+		{
+			Keys: bson.D{{Key: "provider.name", Value: 1}, {Key: "provider.messageId", Value: 1}},
+			Options: options.Index().
+				SetName("provider_name_messageId_unique_idx").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"provider.messageId": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "eventKey", Value: 1}},
+			Options: options.Index().
+				SetName("eventKey_unique_idx").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"eventKey": bson.M{"$exists": true}}),
+		},
+	}
+}
+
+// queryIndexModels are the compound indexes serving the newest-first keyset
+// pagination of a conversation, of a group conversation (partial, as only
+// group messages carry a conversationId), of the messages carrying an
+// external reference (partial as well) and of all messages, and the region
+// index finding the messages outside a deployment's data residency
+// regions. BuildIndexes creates them.
+func queryIndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "phoneNumber", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}},
+			Options: options.Index().SetName("phoneNumber_createdAt_id_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "createdAt", Value: -1}, {Key: "id", Value: -1}},
+			Options: options.Index().SetName("createdAt_id_idx"),
+		},
+		{
+			// Not partial: pages of models.DefaultParticipantID match the
+			// messages without a participant
+			Keys:    bson.D{{Key: "phoneNumber", Value: 1}, {Key: "participant.id", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}},
+			Options: options.Index().SetName("phoneNumber_participant_createdAt_id_idx"),
+		},
+		{
+			Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}},
+			Options: options.Index().
+				SetName("conversationId_createdAt_id_idx").
+				SetPartialFilterExpression(bson.M{"conversationId": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "externalRefs.type", Value: 1}, {Key: "externalRefs.id", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}},
+			Options: options.Index().
+				SetName("externalRefs_type_id_createdAt_id_idx").
+				SetPartialFilterExpression(bson.M{"externalRefs": bson.M{"$exists": true}}),
+		},
+		{
+			// Not sparse: messages without a region match a null region
+			Keys:    bson.D{{Key: "region", Value: 1}},
+			Options: options.Index().SetName("region_idx"),
+		},
+	}
 }
 
 // Save stores a message in MongoDB.
@@ -79,6 +174,12 @@ func (s *MongoStore) Save(msg models.Message) (models.Message, error) {
 
 	_, err := s.collection.InsertOne(ctx, msg)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) && msg.Provider != nil {
+			return models.Message{}, fmt.Errorf("message %w for provider message ID: %s", ErrAlreadyExists, msg.Provider.MessageID)
+		}
+		if mongo.IsDuplicateKeyError(err) && msg.EventKey != "" {
+			return models.Message{}, fmt.Errorf("message %w for event: %s", ErrAlreadyExists, msg.EventKey)
+		}
 		return models.Message{}, err
 	}
 
@@ -107,6 +208,12 @@ func (s *MongoStore) SaveBatch(msgs []models.Message) (int, error) {
 		// Check if it's a bulk write error with partial success
 		var bulkErr mongo.BulkWriteException
 		if errors.As(err, &bulkErr) {
+			// Provider retries and replayed events hit the unique provider
+			// and event indexes; they are already stored, so skipping
+			// them is not a failure
+			if onlyDuplicateKeyErrors(bulkErr) {
+				return len(result.InsertedIDs), nil
+			}
 			// Return count of successfully inserted documents
 			return len(result.InsertedIDs), fmt.Errorf("partial batch insert: %w", err)
 		}
@@ -116,54 +223,626 @@ func (s *MongoStore) SaveBatch(msgs []models.Message) (int, error) {
 	return len(result.InsertedIDs), nil
 }
 
+// onlyDuplicateKeyErrors reports whether every failed write in a bulk insert
+// was a duplicate key.
+func onlyDuplicateKeyErrors(bulkErr mongo.BulkWriteException) bool {
+	if bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if we.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
 // FindByPhoneNumber retrieves all messages for a specific phone number from MongoDB.
 func (s *MongoStore) FindByPhoneNumber(phoneNumber string) ([]models.Message, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	filter := bson.M{"phoneNumber": phoneNumber}
+	opts := s.sortedFind(bson.D{{Key: "createdAt", Value: -1}, {Key: "id", Value: -1}})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
 
-	cursor, err := s.collection.Find(ctx, filter)
+	return s.readAll(ctx, cursor, "FindByPhoneNumber")
+}
+
+// FindByPhoneNumberPage retrieves one page of messages for a phone number, newest first.
+func (s *MongoStore) FindByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	return s.findPage("FindByPhoneNumberPage", bson.M{"phoneNumber": phoneNumber}, page)
+}
+
+// FindByConversationPage retrieves one page of a group conversation's messages, newest first.
+func (s *MongoStore) FindByConversationPage(conversationID string, page PageQuery) ([]models.Message, error) {
+	return s.findPage("FindByConversationPage", bson.M{"conversationId": conversationID}, page)
+}
+
+// ListPage retrieves one page of all messages, newest first.
+func (s *MongoStore) ListPage(page PageQuery) ([]models.Message, error) {
+	return s.findPage("ListPage", bson.M{}, page)
+}
+
+// CountMessages counts messages exactly with countDocuments, optionally only
+// those sent from senderID.
+func (s *MongoStore) CountMessages(senderID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if senderID != "" {
+		filter["provider.senderId"] = senderID
+	}
+	return s.collection.CountDocuments(ctx, filter)
+}
+
+// CountByAccount groups messages by account with an aggregation, served by
+// the phoneNumber index when a conversation is given.
+func (s *MongoStore) CountByAccount(phoneNumber string) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	match := bson.M{}
+	if phoneNumber != "" {
+		match["phoneNumber"] = phoneNumber
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"$ifNull": bson.A{"$accountId", models.DefaultAccountID}},
+			"messages": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
 	if err != nil {
+		return nil, fmt.Errorf("failed to count messages by account: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Account  string `bson:"_id"`
+		Messages int64  `bson:"messages"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
 		return nil, err
 	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Account] = row.Messages
+	}
+	return counts, nil
+}
+
+// CountByParticipant groups a conversation's messages by participant with
+// an aggregation served by the participant index. Sorting newest first
+// before grouping makes $first pick the newest name.
+func (s *MongoStore) CountByParticipant(phoneNumber string) ([]ParticipantCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"phoneNumber": phoneNumber}}},
+		{{Key: "$sort", Value: bson.D{{Key: "phoneNumber", Value: 1}, {Key: "participant.id", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"$ifNull": bson.A{"$participant.id", models.DefaultParticipantID}},
+			"name":     bson.M{"$first": "$participant.name"},
+			"messages": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages by participant: %w", err)
+	}
 	defer cursor.Close(ctx)
 
-	var messages []models.Message
-	if err := cursor.All(ctx, &messages); err != nil {
+	var rows []struct {
+		ID       string `bson:"_id"`
+		Name     string `bson:"name"`
+		Messages int64  `bson:"messages"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
 		return nil, err
 	}
+	counts := make([]ParticipantCount, 0, len(rows))
+	for _, row := range rows {
+		counts = append(counts, ParticipantCount{ID: row.ID, Name: row.Name, Messages: row.Messages})
+	}
+	sortParticipantCounts(counts)
+	return counts, nil
+}
+
+// CountAnnotations groups a conversation's annotations by label with an
+// aggregation matched on the phoneNumber index.
+func (s *MongoStore) CountAnnotations(phoneNumber string) ([]AnnotationCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	decided := func(decision string) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$annotations.review.decision", decision}}, 1, 0}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"phoneNumber": phoneNumber, "annotations.0": bson.M{"$exists": true}}}},
+		{{Key: "$unwind", Value: "$annotations"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         "$annotations.label",
+			"annotations": bson.M{"$sum": 1},
+			"confirmed":   decided(models.AnnotationConfirmed),
+			"rejected":    decided(models.AnnotationRejected),
+		}}},
+	}
 
-	// Return empty slice instead of nil if no messages found
-	if messages == nil {
-		messages = []models.Message{}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count annotations: %w", err)
 	}
+	defer cursor.Close(ctx)
 
-	return messages, nil
+	var rows []struct {
+		Label       string `bson:"_id"`
+		Annotations int64  `bson:"annotations"`
+		Confirmed   int64  `bson:"confirmed"`
+		Rejected    int64  `bson:"rejected"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make([]AnnotationCount, 0, len(rows))
+	for _, row := range rows {
+		counts = append(counts, AnnotationCount{Label: row.Label, Annotations: row.Annotations, Confirmed: row.Confirmed, Rejected: row.Rejected})
+	}
+	sortAnnotationCounts(counts)
+	return counts, nil
 }
 
-// List retrieves all messages from MongoDB (used for testing/debugging).
-func (s *MongoStore) List() ([]models.Message, error) {
+// CountAfter counts the messages of several conversations in one
+// aggregation, each matched on the phoneNumber and createdAt index.
+func (s *MongoStore) CountAfter(after map[string]time.Time) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	if len(after) == 0 {
+		return counts, nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := s.collection.Find(ctx, bson.M{})
+	clauses := make(bson.A, 0, len(after))
+	for pn, t := range after {
+		clauses = append(clauses, bson.M{"phoneNumber": pn, "createdAt": bson.M{"$gt": t}})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": clauses}}},
+		{{Key: "$match", Value: countedMessage}},
+		{{Key: "$group", Value: bson.M{"_id": "$phoneNumber", "messages": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
 	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		PhoneNumber string `bson:"_id"`
+		Messages    int64  `bson:"messages"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
 		return nil, err
 	}
+	for _, row := range rows {
+		counts[row.PhoneNumber] = row.Messages
+	}
+	return counts, nil
+}
+
+// findPage runs operation's keyset page query on top of filter, newest
+// first unless page.OldestFirst is set.
+func (s *MongoStore) findPage(operation string, filter bson.M, page PageQuery) ([]models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if page.SenderID != "" {
+		filter["provider.senderId"] = page.SenderID
+	}
+	if page.Language != "" {
+		filter["language.code"] = languageRegex(page.Language)
+	}
+	addParticipantFilter(filter, page.Participant)
+	addExternalRefFilter(filter, page.ExternalRef)
+	addAnnotationFilter(filter, page.Annotation, page.MinConfidence)
+	addDirectionFilter(filter, page.Direction)
+	addRegionFilter(filter, page.Regions, page.OutsideRegions)
+	order := -1
+	if page.OldestFirst {
+		order = 1
+		if !page.After.IsZero() {
+			filter["$or"] = bson.A{
+				bson.M{"createdAt": bson.M{"$gt": page.After}},
+				bson.M{"createdAt": page.After, "id": bson.M{"$gt": page.AfterID}},
+			}
+		}
+	} else if !page.Before.IsZero() {
+		filter["$or"] = bson.A{
+			bson.M{"createdAt": bson.M{"$lt": page.Before}},
+			bson.M{"createdAt": page.Before, "id": bson.M{"$lt": page.BeforeID}},
+		}
+	}
+
+	opts := s.sortedFind(bson.D{{Key: "createdAt", Value: order}, {Key: "id", Value: order}})
+	if page.Limit > 0 {
+		opts.SetLimit(int64(page.Limit))
+	}
+	if page.BatchSize > 0 {
+		opts.SetBatchSize(int32(page.BatchSize))
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	return s.readAll(ctx, cursor, operation)
+}
+
+// addParticipantFilter restricts filter to the messages of participant,
+// unless it is empty. A null match finds the messages without one, so
+// models.DefaultParticipantID is served by the participant index too.
+func addParticipantFilter(filter bson.M, participant string) {
+	switch participant {
+	case "":
+	case models.DefaultParticipantID:
+		filter["participant.id"] = nil
+	default:
+		filter["participant.id"] = participant
+	}
+}
+
+// addExternalRefFilter restricts filter to messages carrying ref, unless it
+// is nil. $elemMatch keeps a message whose type and ID are in different
+// references from matching.
+func addExternalRefFilter(filter bson.M, ref *models.ExternalRef) {
+	if ref != nil {
+		filter["externalRefs"] = bson.M{"$elemMatch": bson.M{"type": ref.Type, "id": ref.ID}}
+	}
+}
+
+// addAnnotationFilter restricts filter to messages with an annotation of
+// label, of at least minConfidence, that no reviewer rejected, unless label
+// is empty. $elemMatch keeps the conditions to one annotation.
+func addAnnotationFilter(filter bson.M, label string, minConfidence float64) {
+	if label != "" {
+		filter["annotations"] = bson.M{"$elemMatch": bson.M{
+			"label":           label,
+			"confidence":      bson.M{"$gte": minConfidence},
+			"review.decision": bson.M{"$ne": models.AnnotationRejected},
+		}}
+	}
+}
+
+// addDirectionFilter restricts filter to inbound messages, or to the
+// others, as direction says; an empty direction restricts nothing.
+func addDirectionFilter(filter bson.M, direction string) {
+	switch direction {
+	case models.DirectionInbound:
+		filter["direction"] = models.DirectionInbound
+	case models.DirectionOutbound:
+		filter["direction"] = bson.M{"$ne": models.DirectionInbound}
+	}
+}
+
+// addRegionFilter restricts filter to messages in one of regions, or in
+// none of them with outside, unless there are none. "" becomes a null
+// match, which finds the messages stored without a region too.
+func addRegionFilter(filter bson.M, regions []string, outside bool) {
+	if len(regions) == 0 {
+		return
+	}
+	values := make(bson.A, len(regions))
+	for i, region := range regions {
+		if region == "" {
+			values[i] = nil
+		} else {
+			values[i] = region
+		}
+	}
+	op := "$in"
+	if outside {
+		op = "$nin"
+	}
+	filter["region"] = bson.M{op: values}
+}
+
+// SearchMessages retrieves messages whose text contains query (case-insensitive), newest first.
+func (s *MongoStore) SearchMessages(query string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"text": containsRegex(query)}
+	addExternalRefFilter(filter, ref)
+	opts := s.sortedFind(bson.D{{Key: "createdAt", Value: -1}, {Key: "id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	return s.readAll(ctx, cursor, "SearchMessages")
+}
+
+// SearchMessagePrefixes finds messages holding all of tokens with the
+// searchTokens multikey index, newest first.
+func (s *MongoStore) SearchMessagePrefixes(tokens []string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"searchTokens": bson.M{"$all": tokens}}
+	addExternalRefFilter(filter, ref)
+	opts := s.sortedFind(bson.D{{Key: "createdAt", Value: -1}, {Key: "id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages by prefix: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	return s.readAll(ctx, cursor, "SearchMessagePrefixes")
+}
+
+// SetSearchTokens updates the messages' tokens in one unordered bulk write.
+func (s *MongoStore) SetSearchTokens(tokens map[string][]string) (int64, error) {
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	writes := make([]mongo.WriteModel, 0, len(tokens))
+	for id, t := range tokens {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"searchTokens": t}}))
+	}
+	res, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, fmt.Errorf("failed to set search tokens: %w", err)
+	}
+	return res.MatchedCount, nil
+}
+
+// EnsureSearchTokenIndex creates the multikey index prefix search queries.
+// It is separate from the other indexes because it is large, and only
+// built when prefix search is enabled.
+func (s *MongoStore) EnsureSearchTokenIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "searchTokens", Value: 1}},
+		Options: options.Index().
+			SetName("searchTokens_idx").
+			SetPartialFilterExpression(bson.M{"searchTokens": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
+// DailyDigest groups a conversation's messages into local days with $dateTrunc,
+// which applies the zone's DST rules when truncating.
+func (s *MongoStore) DailyDigest(phoneNumber string, q DigestQuery) ([]DailyBucket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	match := bson.M{"phoneNumber": phoneNumber}
+	createdAt := bson.M{}
+	if !q.From.IsZero() {
+		createdAt["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		createdAt["$lt"] = q.To
+	}
+	if len(createdAt) > 0 {
+		match["createdAt"] = createdAt
+	}
+
+	group := bson.M{
+		"_id": bson.M{"$dateTrunc": bson.M{
+			"date":     "$createdAt",
+			"unit":     "day",
+			"timezone": loc.String(),
+		}},
+		"count": bson.M{"$sum": 1},
+	}
+	if q.IncludeMessages {
+		group["messages"] = bson.M{"$push": "$$ROOT"}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: 1}, {Key: "id", Value: 1}}}},
+		{{Key: "$group", Value: group}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate daily digest: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Start    time.Time        `bson:"_id"`
+		Count    int              `bson:"count"`
+		Messages []models.Message `bson:"messages"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	buckets := make([]DailyBucket, 0, len(rows))
+	for _, row := range rows {
+		start := row.Start.In(loc)
+		buckets = append(buckets, DailyBucket{
+			Date:     start.Format("2006-01-02"),
+			Start:    start,
+			Count:    row.Count,
+			Messages: row.Messages,
+		})
+	}
+	return buckets, nil
+}
+
+// CostSummary totals stored message costs in MongoDB, grouping days with
+// $dateToString in the requested zone.
+func (s *MongoStore) CostSummary(q CostQuery) ([]CostBucket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	match := bson.M{"cost": bson.M{"$exists": true}}
+	createdAt := bson.M{}
+	if !q.From.IsZero() {
+		createdAt["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		createdAt["$lt"] = q.To
+	}
+	if len(createdAt) > 0 {
+		match["createdAt"] = createdAt
+	}
+
+	var key any = bson.M{"$dateToString": bson.M{
+		"date":     "$createdAt",
+		"format":   "%Y-%m-%d",
+		"timezone": loc.String(),
+	}}
+	switch q.GroupBy {
+	case CostByAccount:
+		key = bson.M{"$ifNull": bson.A{"$accountId", models.DefaultAccountID}}
+	case CostByLanguage:
+		key = bson.M{"$ifNull": bson.A{"$language.code", models.LanguageUndetermined}}
+	case CostByAnnotation:
+		key = topAnnotationLabelExpr
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           bson.M{"key": key, "currency": "$cost.currency"},
+			"messages":      bson.M{"$sum": 1},
+			"segments":      bson.M{"$sum": "$cost.segments"},
+			"estimatedCost": bson.M{"$sum": "$cost.estimatedCost"},
+			"defaultRate": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$eq": bson.A{"$cost.defaultRate", true}}, 1, 0},
+			}},
+		}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate cost summary: %w", err)
+	}
 	defer cursor.Close(ctx)
 
-	var messages []models.Message
-	if err := cursor.All(ctx, &messages); err != nil {
+	var rows []struct {
+		ID struct {
+			Key      string `bson:"key"`
+			Currency string `bson:"currency"`
+		} `bson:"_id"`
+		Messages      int     `bson:"messages"`
+		Segments      int     `bson:"segments"`
+		EstimatedCost float64 `bson:"estimatedCost"`
+		DefaultRate   int     `bson:"defaultRate"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
 		return nil, err
 	}
 
-	// Return empty slice instead of nil if no messages found
-	if messages == nil {
-		messages = []models.Message{}
+	buckets := make([]CostBucket, 0, len(rows))
+	for _, row := range rows {
+		buckets = append(buckets, CostBucket{
+			Key:                 row.ID.Key,
+			Currency:            row.ID.Currency,
+			Messages:            row.Messages,
+			Segments:            row.Segments,
+			EstimatedCost:       row.EstimatedCost,
+			DefaultRateMessages: row.DefaultRate,
+		})
+	}
+	sortCostBuckets(buckets)
+	return buckets, nil
+}
+
+// topAnnotationLabelExpr computes topAnnotationLabel in an aggregation:
+// $reduce keeps the first of the most confident annotations no reviewer
+// rejected.
+var topAnnotationLabelExpr = bson.M{"$let": bson.M{
+	"vars": bson.M{"top": bson.M{"$reduce": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$annotations", bson.A{}}},
+			"cond":  bson.M{"$ne": bson.A{"$$this.review.decision", models.AnnotationRejected}},
+		}},
+		"initialValue": nil,
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"$eq": bson.A{"$$value", nil}},
+				bson.M{"$gt": bson.A{"$$this.confidence", "$$value.confidence"}},
+			}},
+			"$$this", "$$value",
+		}},
+	}}},
+	"in": bson.M{"$ifNull": bson.A{"$$top.label", CostKeyUnannotated}},
+}}
+
+// languageRegex matches language codes as models.LanguageMatches does.
+func languageRegex(tag string) primitive.Regex {
+	return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(tag) + "(-|$)", Options: "i"}
+}
+
+// containsRegex builds a case-insensitive substring match for query.
+// The query is escaped so user input can't inject regex operators.
+func containsRegex(query string) primitive.Regex {
+	return primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+}
+
+// List retrieves all messages from MongoDB (used for testing/debugging).
+func (s *MongoStore) List() ([]models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find()
+	if s.limits.BatchSize > 0 {
+		opts.SetBatchSize(int32(s.limits.BatchSize))
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	return messages, nil
+	return s.readAll(ctx, cursor, "List")
 }
 
 // DeleteAll removes all messages from MongoDB.
@@ -179,6 +858,159 @@ func (s *MongoStore) DeleteAll() (int64, error) {
 	return result.DeletedCount, nil
 }
 
+// Count returns the estimated number of messages from collection metadata,
+// which stays fast on very large collections.
+func (s *MongoStore) Count() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.collection.EstimatedDocumentCount(ctx)
+}
+
+// Usage reports the estimated message count; MongoDB never evicts.
+func (s *MongoStore) Usage() (StoreUsage, error) {
+	n, err := s.Count()
+	if err != nil {
+		return StoreUsage{}, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return StoreUsage{Backend: "mongo", Messages: n, ReadFrom: cmp.Or(s.readFrom, "primary")}, nil
+}
+
+// QueryMessages reads the matching messages through one cursor fetching
+// batchSize documents at a time, with no time limit but ctx's. The sort
+// may spill to disk on servers that allow it, since no index covers every
+// query.
+func (s *MongoStore) QueryMessages(ctx context.Context, q MessageQuery, batchSize int, fn func([]models.Message) error) error {
+	batchSize = max(1, batchSize)
+	filter := bson.M{}
+	if q.Text != "" {
+		filter["text"] = containsRegex(q.Text)
+	}
+	if len(q.Tokens) > 0 {
+		filter["searchTokens"] = bson.M{"$all": q.Tokens}
+	}
+	addExternalRefFilter(filter, q.ExternalRef)
+	createdAt := bson.M{}
+	if !q.From.IsZero() {
+		createdAt["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		createdAt["$lt"] = q.To
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	addDirectionFilter(filter, q.Direction)
+	addRegionFilter(filter, q.Regions, q.OutsideRegions)
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "id", Value: 1}}).
+		SetBatchSize(int32(batchSize))
+	if s.server.atLeast(4, 4) {
+		opts.SetAllowDiskUse(true)
+	}
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	batch := make([]models.Message, 0, batchSize)
+	for cursor.Next(ctx) {
+		var msg models.Message
+		if err := cursor.Decode(&msg); err != nil {
+			return fmt.Errorf("failed to decode message: %w", err)
+		}
+		batch = append(batch, msg)
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// DeleteAllBatch deletes up to limit messages. Each call is a short, bounded
+// operation, so callers loop until it returns 0 and can stop and resume at
+// any point without losing track of progress.
+func (s *MongoStore) DeleteAllBatch(limit int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(int64(limit))
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select delete batch: %w", err)
+	}
+
+	var docs []struct {
+		ID any `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, fmt.Errorf("failed to decode delete batch: %w", err)
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	ids := make(bson.A, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	result, err := s.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete batch: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// DropAll replaces the messages collection with an empty one. The empty
+// collection and its indexes are built under a temporary name first and then
+// renamed over the original with dropTarget, so readers see either the old
+// or the new collection, never one without indexes.
+func (s *MongoStore) DropAll() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	count, err := s.collection.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	name := s.collection.Name()
+	// Real time, not a clock: the name must be unique even when time is faked
+	tmpName := fmt.Sprintf("%s_drop_%d", name, time.Now().UnixNano())
+	if err := s.database.CreateCollection(ctx, tmpName); err != nil {
+		return 0, fmt.Errorf("failed to create replacement collection: %w", err)
+	}
+	tmp := s.database.Collection(tmpName)
+	if _, err := tmp.Indexes().CreateMany(ctx, messageIndexModels()); err != nil {
+		_ = tmp.Drop(ctx)
+		return 0, fmt.Errorf("failed to index replacement collection: %w", err)
+	}
+
+	dbName := s.database.Name()
+	rename := bson.D{
+		{Key: "renameCollection", Value: dbName + "." + tmpName},
+		{Key: "to", Value: dbName + "." + name},
+		{Key: "dropTarget", Value: true},
+	}
+	if err := s.client.Database("admin").RunCommand(ctx, rename).Err(); err != nil {
+		_ = tmp.Drop(ctx)
+		return 0, fmt.Errorf("failed to swap in replacement collection: %w", err)
+	}
+
+	return count, nil
+}
+
 // GetDistinctPhoneNumbers retrieves all distinct phone numbers from MongoDB.
 func (s *MongoStore) GetDistinctPhoneNumbers() ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -231,6 +1063,294 @@ func (s *MongoStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
 	return result.DeletedCount, nil
 }
 
+// FindByID retrieves a message by its ID from MongoDB.
+func (s *MongoStore) FindByID(id string) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var msg models.Message
+	err := s.collection.FindOne(ctx, bson.M{"id": id}).Decode(&msg)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return models.Message{}, fmt.Errorf("failed to find message: %w", err)
+	}
+	return msg, nil
+}
+
+// UpdateMessage patches the message with the given ID in MongoDB.
+func (s *MongoStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{}
+	if patch.Status != nil {
+		set["status"] = *patch.Status
+	}
+	if patch.Text != nil {
+		set["text"] = *patch.Text
+	}
+	if patch.SearchTokens != nil {
+		set["searchTokens"] = patch.SearchTokens
+	}
+	if patch.Language != nil {
+		set["language"] = patch.Language
+	}
+	unset := bson.M{}
+	if patch.Participant != nil && patch.Participant.ID == "" {
+		unset["participant"] = ""
+	} else if patch.Participant != nil {
+		set["participant"] = patch.Participant
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	filter := bson.M{"id": id}
+	var msg models.Message
+	var err error
+	if len(update) == 0 {
+		err = s.collection.FindOne(ctx, filter).Decode(&msg)
+	} else {
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err = s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return models.Message{}, fmt.Errorf("failed to update message: %w", err)
+	}
+	return msg, nil
+}
+
+// AddReaction pushes reaction onto the message with the given ID and counts
+// it, in one update that only matches while the actor hasn't reacted with
+// the emoji and the message has room, so concurrent adds can't exceed the
+// cap or count a reaction twice.
+func (s *MongoStore) AddReaction(id string, reaction models.Reaction) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"id":        id,
+		"reactions": bson.M{"$not": bson.M{"$elemMatch": bson.M{"emoji": reaction.Emoji, "actor": reaction.Actor}}},
+		fmt.Sprintf("reactions.%d", MaxReactionsPerMessage-1): bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$push": bson.M{"reactions": reaction},
+		"$inc":  bson.M{"reactionCounts." + reaction.Emoji: 1},
+	}
+	var msg models.Message
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&msg)
+	if err == nil {
+		return msg, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Message{}, fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	// No match: the message is missing, has the reaction already or is full
+	if err := s.collection.FindOne(ctx, bson.M{"id": id}).Decode(&msg); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+		}
+		return models.Message{}, fmt.Errorf("failed to add reaction: %w", err)
+	}
+	if hasReaction(msg, reaction.Emoji, reaction.Actor) {
+		return msg, nil
+	}
+	return models.Message{}, fmt.Errorf("message %s has %d reactions: %w", id, len(msg.Reactions), ErrTooManyReactions)
+}
+
+// RemoveReaction pulls actor's emoji reaction from the message with the
+// given ID and uncounts it, dropping the emoji's count once it reaches zero.
+func (s *MongoStore) RemoveReaction(id, emoji, actor string) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	countKey := "reactionCounts." + emoji
+	filter := bson.M{"id": id, "reactions": bson.M{"$elemMatch": bson.M{"emoji": emoji, "actor": actor}}}
+	update := bson.M{
+		"$pull": bson.M{"reactions": bson.M{"emoji": emoji, "actor": actor}},
+		"$inc":  bson.M{countKey: -1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var msg models.Message
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The message is missing or doesn't have the reaction
+		err = s.collection.FindOne(ctx, bson.M{"id": id}).Decode(&msg)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return models.Message{}, fmt.Errorf("failed to remove reaction: %w", err)
+		}
+		return msg, nil
+	}
+	if err != nil {
+		return models.Message{}, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	if msg.ReactionCounts[emoji] <= 0 {
+		err := s.collection.FindOneAndUpdate(ctx,
+			bson.M{"id": id, countKey: bson.M{"$lte": 0}},
+			bson.M{"$unset": bson.M{countKey: ""}}, opts).Decode(&msg)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Message{}, fmt.Errorf("failed to remove reaction count: %w", err)
+		}
+	}
+	return msg, nil
+}
+
+// SetAnnotation replaces the source's annotation in place when the message
+// has one, and otherwise pushes it in an update that only matches while the
+// source has none and the message has room, so concurrent sets can't exceed
+// the cap or keep two annotations of a source.
+func (s *MongoStore) SetAnnotation(id string, annotation models.Annotation) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	replace := func() (models.Message, error) {
+		var msg models.Message
+		err := s.collection.FindOneAndUpdate(ctx,
+			bson.M{"id": id, "annotations.source": annotation.Source},
+			bson.M{"$set": bson.M{"annotations.$": annotation}}, opts).Decode(&msg)
+		return msg, err
+	}
+
+	msg, err := replace()
+	if err == nil {
+		return msg, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Message{}, fmt.Errorf("failed to set annotation: %w", err)
+	}
+
+	filter := bson.M{
+		"id":                 id,
+		"annotations.source": bson.M{"$ne": annotation.Source},
+		fmt.Sprintf("annotations.%d", MaxAnnotationsPerMessage-1): bson.M{"$exists": false},
+	}
+	err = s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$push": bson.M{"annotations": annotation}}, opts).Decode(&msg)
+	if err == nil {
+		return msg, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Message{}, fmt.Errorf("failed to set annotation: %w", err)
+	}
+
+	// No match: the message is missing, is full or got the source's
+	// annotation from a concurrent set since the first update
+	if err := s.collection.FindOne(ctx, bson.M{"id": id}).Decode(&msg); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+		}
+		return models.Message{}, fmt.Errorf("failed to set annotation: %w", err)
+	}
+	if annotationIndex(msg, annotation.Source) < 0 {
+		return models.Message{}, fmt.Errorf("message %s has %d annotations: %w", id, len(msg.Annotations), ErrTooManyAnnotations)
+	}
+	if msg, err = replace(); err != nil {
+		return models.Message{}, fmt.Errorf("failed to set annotation: %w", err)
+	}
+	return msg, nil
+}
+
+// SetTranslation pushes a new language's translation in an update that only
+// matches while the message has none into it and has room, as SetAnnotation
+// does, and with overwrite replaces an existing one in place.
+func (s *MongoStore) SetTranslation(id string, translation models.Translation, overwrite bool) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	replace := func() (models.Message, error) {
+		var msg models.Message
+		err := s.collection.FindOneAndUpdate(ctx,
+			bson.M{"id": id, "translations.language": translation.Language},
+			bson.M{"$set": bson.M{"translations.$": translation}}, opts).Decode(&msg)
+		return msg, err
+	}
+
+	var msg models.Message
+	filter := bson.M{
+		"id":                    id,
+		"translations.language": bson.M{"$ne": translation.Language},
+		fmt.Sprintf("translations.%d", MaxTranslationsPerMessage-1): bson.M{"$exists": false},
+	}
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$push": bson.M{"translations": translation}}, opts).Decode(&msg)
+	if err == nil {
+		return msg, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Message{}, fmt.Errorf("failed to set translation: %w", err)
+	}
+
+	// No match: the message is missing, is full or already has the
+	// language's translation
+	if err := s.collection.FindOne(ctx, bson.M{"id": id}).Decode(&msg); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+		}
+		return models.Message{}, fmt.Errorf("failed to set translation: %w", err)
+	}
+	if translationIndex(msg, translation.Language) < 0 {
+		return models.Message{}, fmt.Errorf("message %s has %d translations: %w", id, len(msg.Translations), ErrTooManyTranslations)
+	}
+	if !overwrite {
+		return models.Message{}, fmt.Errorf("translation of %s into %s %w", id, translation.Language, ErrAlreadyExists)
+	}
+	if msg, err = replace(); err != nil {
+		return models.Message{}, fmt.Errorf("failed to set translation: %w", err)
+	}
+	return msg, nil
+}
+
+// ReviewAnnotation sets the review of the source's annotation with the
+// positional operator, in the same update that finds it.
+func (s *MongoStore) ReviewAnnotation(id, source string, review models.AnnotationReview) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var msg models.Message
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"id": id, "annotations.source": source},
+		bson.M{"$set": bson.M{"annotations.$.review": review}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&msg)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The message is missing or has no annotation from source
+		err = s.collection.FindOne(ctx, bson.M{"id": id}).Decode(&msg)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Message{}, fmt.Errorf("message %w: %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return models.Message{}, fmt.Errorf("failed to review annotation: %w", err)
+		}
+		return models.Message{}, fmt.Errorf("annotation %w: %s has none from %s", ErrNotFound, id, source)
+	}
+	if err != nil {
+		return models.Message{}, fmt.Errorf("failed to review annotation: %w", err)
+	}
+	return msg, nil
+}
+
+// Ping checks that MongoDB is reachable.
+func (s *MongoStore) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return s.client.Ping(ctx, nil)
+}
+
 // Close closes the MongoDB connection.
 // Should be called when shutting down the service.
 func (s *MongoStore) Close() error {
@@ -0,0 +1,114 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/store"
+	"sms-store/internal/store/storetest"
+)
+
+// The MongoDB tests run against the server at TEST_MONGODB_URI, such as
+// mongodb://localhost:27017, and are skipped without one. Each test gets
+// a database of its own, dropped when it ends.
+
+var testDatabases atomic.Int64
+
+// testMongo connects to TEST_MONGODB_URI and returns the client and the
+// name of a fresh database.
+func testMongo(t *testing.T) (*mongo.Client, string) {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", uri, err)
+	}
+	database := fmt.Sprintf("sms_store_test_%d_%d", time.Now().UnixNano(), testDatabases.Add(1))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := client.Database(database).Drop(ctx); err != nil {
+			t.Logf("drop %s: %v", database, err)
+		}
+		client.Disconnect(ctx)
+	})
+	return client, database
+}
+
+// newTestMongoStore returns a MongoStore on a fresh database with its query
+// indexes built.
+func newTestMongoStore(t *testing.T) *store.MongoStore {
+	t.Helper()
+	_, database := testMongo(t)
+	s, err := store.NewMongoStore(os.Getenv("TEST_MONGODB_URI"), database, "messages")
+	if err != nil {
+		t.Fatalf("NewMongoStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := s.BuildIndexes(ctx, nil); err != nil {
+		t.Fatalf("BuildIndexes: %v", err)
+	}
+	if !s.IndexesReady() {
+		t.Fatal("IndexesReady = false after BuildIndexes")
+	}
+	return s
+}
+
+// TestMongoStoreConformanceBeforeIndexes runs the suite before BuildIndexes,
+// when queries fall back to plans without the query indexes.
+func TestMongoStoreConformanceBeforeIndexes(t *testing.T) {
+	storetest.RunStoreConformance(t, func(t *testing.T) store.Store {
+		_, database := testMongo(t)
+		s, err := store.NewMongoStore(os.Getenv("TEST_MONGODB_URI"), database, "messages")
+		if err != nil {
+			t.Fatalf("NewMongoStore: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		if s.IndexesReady() {
+			t.Fatal("IndexesReady on a new database before BuildIndexes")
+		}
+		return s
+	})
+}
+
+func TestMongoStoreConformance(t *testing.T) {
+	storetest.RunStoreConformance(t, func(t *testing.T) store.Store {
+		return newTestMongoStore(t)
+	})
+}
+
+func TestMongoStoreTombstoningConformance(t *testing.T) {
+	storetest.RunTombstoningConformance(t, func(t *testing.T) store.Store {
+		return newTestMongoStore(t)
+	})
+}
+
+func TestMongoProfileStoreConformance(t *testing.T) {
+	storetest.RunProfileStoreConformance(t, func(t *testing.T) store.ProfileStore {
+		client, database := testMongo(t)
+		return store.NewMongoProfileStore(client, database, "profiles")
+	})
+}
+
+func TestMongoDeletionReceiptStoreConformance(t *testing.T) {
+	storetest.RunDeletionReceiptConformance(t, func(t *testing.T) store.DeletionReceiptStore {
+		client, database := testMongo(t)
+		return store.NewMongoDeletionReceiptStore(client, database, "")
+	})
+}
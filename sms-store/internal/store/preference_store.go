@@ -0,0 +1,184 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// PreferenceStore defines the interface for per-conversation preference storage.
+type PreferenceStore interface {
+	// GetPreferences retrieves preferences for a conversation.
+	// Returns an error wrapping ErrNotFound if none have been saved.
+	GetPreferences(accountID, phoneNumber string) (models.ConversationPreferences, error)
+
+	// PutPreferences creates or replaces preferences for a conversation.
+	PutPreferences(prefs models.ConversationPreferences) (models.ConversationPreferences, error)
+
+	// ListPreferences retrieves preferences for the given phone numbers, keyed by phone number.
+	// Numbers without preferences are absent from the map.
+	ListPreferences(accountID string, phoneNumbers []string) (map[string]models.ConversationPreferences, error)
+
+	// MovePreferences re-keys every account's preferences of phoneNumber to
+	// to, merging them into preferences to already has: its color stays
+	// unless it has none, and the labels of both are kept. Returns the
+	// number of accounts whose preferences moved.
+	MovePreferences(phoneNumber, to string) (int, error)
+}
+
+// mergePreferences returns dst with the color of src if it has none and
+// the labels of src it lacks after its own.
+func mergePreferences(dst, src models.ConversationPreferences) models.ConversationPreferences {
+	dst.Color = cmp.Or(dst.Color, src.Color)
+	labels := slices.Clone(dst.Labels)
+	for _, label := range src.Labels {
+		if !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	dst.Labels = labels
+	return dst
+}
+
+// MongoPreferenceStore implements the PreferenceStore interface using MongoDB.
+type MongoPreferenceStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoPreferenceStore creates a new MongoDB preference store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoPreferenceStore(client *mongo.Client, databaseName, collectionName string) *MongoPreferenceStore {
+	if collectionName == "" {
+		collectionName = "preferences"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "accountId", Value: 1}, {Key: "phoneNumber", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("accountId_phoneNumber_unique_idx"),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		log.Printf("Warning: could not ensure preferences index on %s: %v", collectionName, err)
+	}
+
+	return &MongoPreferenceStore{collection: collection}
+}
+
+// GetPreferences retrieves preferences for a conversation from MongoDB.
+func (s *MongoPreferenceStore) GetPreferences(accountID, phoneNumber string) (models.ConversationPreferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"accountId": accountID, "phoneNumber": phoneNumber}
+
+	var prefs models.ConversationPreferences
+	err := s.collection.FindOne(ctx, filter).Decode(&prefs)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.ConversationPreferences{}, fmt.Errorf("preferences %w for phone number: %s", ErrNotFound, phoneNumber)
+		}
+		return models.ConversationPreferences{}, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	return prefs, nil
+}
+
+// PutPreferences upserts preferences for a conversation in MongoDB.
+func (s *MongoPreferenceStore) PutPreferences(prefs models.ConversationPreferences) (models.ConversationPreferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	prefs.UpdatedAt = s.Clock().Now()
+	if prefs.Labels == nil {
+		prefs.Labels = []string{}
+	}
+
+	filter := bson.M{"accountId": prefs.AccountID, "phoneNumber": prefs.PhoneNumber}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, filter, prefs, opts); err != nil {
+		return models.ConversationPreferences{}, fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	return prefs, nil
+}
+
+// ListPreferences retrieves preferences for several conversations in one query.
+func (s *MongoPreferenceStore) ListPreferences(accountID string, phoneNumbers []string) (map[string]models.ConversationPreferences, error) {
+	result := make(map[string]models.ConversationPreferences)
+	if len(phoneNumbers) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"accountId": accountID, "phoneNumber": bson.M{"$in": phoneNumbers}}
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preferences: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var prefs []models.ConversationPreferences
+	if err := cursor.All(ctx, &prefs); err != nil {
+		return nil, fmt.Errorf("failed to decode preferences: %w", err)
+	}
+	for _, p := range prefs {
+		result[p.PhoneNumber] = p
+	}
+
+	return result, nil
+}
+
+// MovePreferences moves the preferences of phoneNumber one account at a
+// time, each written to to before it is deleted, so a failure part way
+// leaves copies behind rather than losing any.
+func (s *MongoPreferenceStore) MovePreferences(phoneNumber, to string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"phoneNumber": phoneNumber})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find preferences: %w", err)
+	}
+	var moving []models.ConversationPreferences
+	if err := cursor.All(ctx, &moving); err != nil {
+		return 0, fmt.Errorf("failed to decode preferences: %w", err)
+	}
+
+	moved := 0
+	for _, prefs := range moving {
+		merged, err := s.GetPreferences(prefs.AccountID, to)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			merged = models.ConversationPreferences{AccountID: prefs.AccountID, PhoneNumber: to}
+		case err != nil:
+			return moved, err
+		}
+		if _, err := s.PutPreferences(mergePreferences(merged, prefs)); err != nil {
+			return moved, err
+		}
+		if _, err := s.collection.DeleteOne(ctx, bson.M{"accountId": prefs.AccountID, "phoneNumber": phoneNumber}); err != nil {
+			return moved, fmt.Errorf("failed to delete moved preferences: %w", err)
+		}
+		moved++
+	}
+	return moved, nil
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+var profileMissCacheLookups = metrics.NewCounterVec(
+	"profile_miss_cache_lookups_total",
+	"GetProfile calls answered from the cache of numbers without a profile (hit) or by the profile store (miss).",
+	"result",
+)
+
+// MissCachingProfileStore wraps a ProfileStore so numbers found to have no
+// profile are answered ErrNotFound from memory for ttl, sparing the store
+// clients that poll GET /v1/profile/{phoneNumber} for them. At most size
+// numbers are remembered; past it the least recently used is forgotten.
+//
+// Creating a profile through the wrapper, whether by CreateProfile,
+// EnsureProfile (as the consumer's automatic profiles do) or UpdateProfile,
+// forgets its number at once. A profile created elsewhere, e.g. by another
+// instance, is seen within ttl.
+type MissCachingProfileStore struct {
+	ProfileStore
+	ttl  time.Duration
+	size int
+
+	mu     sync.Mutex
+	misses map[string]*list.Element // Values are *profileMiss
+	lru    *list.List               // Most recently used first
+	forgot uint64                   // Counts Forget calls, so a miss read before one isn't remembered after it
+
+	clock.Clocked
+}
+
+type profileMiss struct {
+	phoneNumber string
+	expires     time.Time
+}
+
+// NewMissCachingProfileStore wraps ps, remembering up to size numbers
+// without a profile for ttl.
+func NewMissCachingProfileStore(ps ProfileStore, size int, ttl time.Duration) *MissCachingProfileStore {
+	return &MissCachingProfileStore{
+		ProfileStore: ps,
+		ttl:          ttl,
+		size:         max(size, 1),
+		misses:       make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+// GetProfile returns the profile of phoneNumber, or an error wrapping
+// ErrNotFound without asking the store if it had none within ttl.
+func (s *MissCachingProfileStore) GetProfile(phoneNumber string) (models.Profile, error) {
+	missing, forgot := s.missing(phoneNumber, s.Clock().Now())
+	if missing {
+		profileMissCacheLookups.WithLabelValues("hit").Inc()
+		return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	profileMissCacheLookups.WithLabelValues("miss").Inc()
+
+	profile, err := s.ProfileStore.GetProfile(phoneNumber)
+	if errors.Is(err, ErrNotFound) {
+		s.remember(phoneNumber, s.Clock().Now().Add(s.ttl), forgot)
+	}
+	return profile, err
+}
+
+// CreateProfile creates profile and forgets that its number had none.
+func (s *MissCachingProfileStore) CreateProfile(profile models.Profile) (models.Profile, error) {
+	created, err := s.ProfileStore.CreateProfile(profile)
+	s.Forget(profile.PhoneNumber)
+	return created, err
+}
+
+// UpdateProfile updates the profile of phoneNumber and forgets that it had
+// none, in case it was created since.
+func (s *MissCachingProfileStore) UpdateProfile(phoneNumber string, profile models.Profile) (models.Profile, error) {
+	updated, err := s.ProfileStore.UpdateProfile(phoneNumber, profile)
+	if err == nil {
+		s.Forget(phoneNumber)
+	}
+	return updated, err
+}
+
+// UpdateProfileIfVersion updates the profile of phoneNumber if it is at
+// version, and forgets that it had none.
+func (s *MissCachingProfileStore) UpdateProfileIfVersion(phoneNumber string, profile models.Profile, version int64) (models.Profile, error) {
+	updated, err := s.ProfileStore.UpdateProfileIfVersion(phoneNumber, profile, version)
+	if err == nil {
+		s.Forget(phoneNumber)
+	}
+	return updated, err
+}
+
+// EnsureProfile creates profile unless its number has one, and forgets that
+// the number had none.
+func (s *MissCachingProfileStore) EnsureProfile(profile models.Profile) (models.Profile, bool, error) {
+	ensured, created, err := s.ProfileStore.EnsureProfile(profile)
+	s.Forget(profile.PhoneNumber)
+	return ensured, created, err
+}
+
+// Forget drops phoneNumber from the cache, so its next GetProfile asks the
+// store.
+func (s *MissCachingProfileStore) Forget(phoneNumber string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forgot++
+	if e, ok := s.misses[phoneNumber]; ok {
+		s.lru.Remove(e)
+		delete(s.misses, phoneNumber)
+	}
+}
+
+// missing reports whether phoneNumber is remembered as having no profile
+// at now, dropping it once it expired, along with the count of Forget calls
+// so far.
+func (s *MissCachingProfileStore) missing(phoneNumber string, now time.Time) (bool, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.misses[phoneNumber]
+	if !ok {
+		return false, s.forgot
+	}
+	if !now.Before(e.Value.(*profileMiss).expires) {
+		s.lru.Remove(e)
+		delete(s.misses, phoneNumber)
+		return false, s.forgot
+	}
+	s.lru.MoveToFront(e)
+	return true, s.forgot
+}
+
+// remember records that phoneNumber has no profile until expires, evicting
+// the least recently used number if the cache is full. The miss was read
+// when forgot Forget calls had been made; after a further one the profile
+// may exist, so it isn't recorded.
+func (s *MissCachingProfileStore) remember(phoneNumber string, expires time.Time, forgot uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.forgot != forgot {
+		return
+	}
+	if e, ok := s.misses[phoneNumber]; ok {
+		e.Value.(*profileMiss).expires = expires
+		s.lru.MoveToFront(e)
+		return
+	}
+	if s.lru.Len() >= s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.misses, oldest.Value.(*profileMiss).phoneNumber)
+	}
+	s.misses[phoneNumber] = s.lru.PushFront(&profileMiss{phoneNumber: phoneNumber, expires: expires})
+}
@@ -0,0 +1,113 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// gatedProfiles holds GetProfile back, once it has read, until release is
+// closed, if it is set.
+type gatedProfiles struct {
+	store.ProfileStore
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *gatedProfiles) GetProfile(phoneNumber string) (models.Profile, error) {
+	profile, err := s.ProfileStore.GetProfile(phoneNumber)
+	if s.release != nil {
+		close(s.read)
+		<-s.release
+	}
+	return profile, err
+}
+
+func TestProfileCreatedAfterCachedMissIsSeen(t *testing.T) {
+	const ttl = time.Minute
+	for _, tc := range []struct {
+		name   string
+		create func(s *store.MissCachingProfileStore, profile models.Profile) error
+	}{
+		{"CreateProfile", func(s *store.MissCachingProfileStore, profile models.Profile) error {
+			_, err := s.CreateProfile(profile)
+			return err
+		}},
+		{"EnsureProfile", func(s *store.MissCachingProfileStore, profile models.Profile) error {
+			_, _, err := s.EnsureProfile(profile)
+			return err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := store.NewMemoryProfileStore()
+			s := store.NewMissCachingProfileStore(inner, 10, ttl)
+			fake := clocktest.NewFake(time.Now())
+			s.SetClock(fake)
+
+			if _, err := s.GetProfile("9876543210"); !errors.Is(err, store.ErrNotFound) {
+				t.Fatalf("GetProfile = %v, want ErrNotFound", err)
+			}
+			if err := tc.create(s, models.Profile{PhoneNumber: "9876543210", Name: "Ram"}); err != nil {
+				t.Fatal(err)
+			}
+			// Seen at once, without waiting out the cached miss
+			if p, err := s.GetProfile("9876543210"); err != nil || p.Name != "Ram" {
+				t.Fatalf("GetProfile = %+v, %v; want the created profile", p, err)
+			}
+		})
+	}
+}
+
+func TestProfileCreatedElsewhereIsSeenWithinTTL(t *testing.T) {
+	const ttl = time.Minute
+	inner := store.NewMemoryProfileStore()
+	s := store.NewMissCachingProfileStore(inner, 10, ttl)
+	fake := clocktest.NewFake(time.Now())
+	s.SetClock(fake)
+
+	if _, err := s.GetProfile("9876543210"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetProfile = %v, want ErrNotFound", err)
+	}
+	// As another instance would, past the cache
+	if _, err := inner.CreateProfile(models.Profile{PhoneNumber: "9876543210", Name: "Ram"}); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(ttl - time.Second)
+	if _, err := s.GetProfile("9876543210"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetProfile within ttl = %v, want the cached ErrNotFound", err)
+	}
+	fake.Advance(time.Second)
+	if p, err := s.GetProfile("9876543210"); err != nil || p.Name != "Ram" {
+		t.Fatalf("GetProfile after ttl = %+v, %v; want the created profile", p, err)
+	}
+}
+
+func TestMissReadBeforeCreateIsNotCached(t *testing.T) {
+	gated := &gatedProfiles{ProfileStore: store.NewMemoryProfileStore(), read: make(chan struct{}), release: make(chan struct{})}
+	s := store.NewMissCachingProfileStore(gated, 10, time.Minute)
+	s.SetClock(clocktest.NewFake(time.Now()))
+
+	done := make(chan error)
+	go func() {
+		_, err := s.GetProfile("9876543210")
+		done <- err
+	}()
+	// The miss is read, then the profile is created before it is recorded
+	<-gated.read
+	if _, err := s.CreateProfile(models.Profile{PhoneNumber: "9876543210", Name: "Ram"}); err != nil {
+		t.Fatal(err)
+	}
+	close(gated.release)
+	if err := <-done; !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("racing GetProfile = %v, want ErrNotFound", err)
+	}
+
+	gated.release = nil
+	if p, err := s.GetProfile("9876543210"); err != nil || p.Name != "Ram" {
+		t.Fatalf("GetProfile = %+v, %v; want the created profile, not the stale miss", p, err)
+	}
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+var profileHistoryFailures = metrics.NewCounterVec(
+	"profile_history_failures_total",
+	"Profile changes made without their history entry, which failed to be recorded.",
+	"action",
+)
+
+// ErrNothingToRestore is returned when rolling back a change that created
+// its profile, which has no earlier values.
+var ErrNothingToRestore = errors.New("no earlier values to restore")
+
+// ProfileHistoryRecorder wraps a ProfileStore, recording every profile it
+// creates or updates in a ProfileHistoryStore with the values before and
+// after and the actor who made the change. Each change carries the version
+// of the profile it produced.
+//
+// A change and its history entry are two writes: a failure to record the
+// entry is logged and counted, and the change stands. The version it
+// produced is then missing from the history, which is how a reader of it
+// can tell. The previous values are read just before the change, so two
+// concurrent updates of one profile may both record the same ones.
+type ProfileHistoryRecorder struct {
+	ProfileStore
+	history   ProfileHistoryStore
+	retention time.Duration // 0 keeps history forever
+	actor     string
+
+	clock.Clocked
+}
+
+// NewProfileHistoryRecorder wraps ps, recording its changes in history for
+// retention, or forever when it is 0.
+func NewProfileHistoryRecorder(ps ProfileStore, history ProfileHistoryStore, retention time.Duration) *ProfileHistoryRecorder {
+	return &ProfileHistoryRecorder{ProfileStore: ps, history: history, retention: retention}
+}
+
+// As returns a recorder of the same profiles and history whose changes are
+// made by actor.
+func (s *ProfileHistoryRecorder) As(actor string) *ProfileHistoryRecorder {
+	as := *s
+	as.actor = actor
+	return &as
+}
+
+// History returns the history changes are recorded in.
+func (s *ProfileHistoryRecorder) History() ProfileHistoryStore {
+	return s.history
+}
+
+func (s *ProfileHistoryRecorder) UpdateProfile(phoneNumber string, profile models.Profile) (models.Profile, error) {
+	before, err := s.ProfileStore.GetProfile(phoneNumber)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	updated, err := s.ProfileStore.UpdateProfile(phoneNumber, profile)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	previous := models.ValuesOf(before)
+	s.record(models.ProfileChange{Action: models.ProfileUpdated, Previous: &previous}, updated)
+	return updated, nil
+}
+
+// UpdateProfileIfVersion rejects the update when the profile read before it
+// isn't at version already, so the previous values recorded are always
+// those of version.
+func (s *ProfileHistoryRecorder) UpdateProfileIfVersion(phoneNumber string, profile models.Profile, version int64) (models.Profile, error) {
+	before, err := s.ProfileStore.GetProfile(phoneNumber)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	if before.Version != version {
+		return models.Profile{}, &VersionConflictError{PhoneNumber: phoneNumber, Expected: version, Current: before.Version}
+	}
+	updated, err := s.ProfileStore.UpdateProfileIfVersion(phoneNumber, profile, version)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	previous := models.ValuesOf(before)
+	s.record(models.ProfileChange{Action: models.ProfileUpdated, Previous: &previous}, updated)
+	return updated, nil
+}
+
+func (s *ProfileHistoryRecorder) CreateProfile(profile models.Profile) (models.Profile, error) {
+	created, err := s.ProfileStore.CreateProfile(profile)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	s.record(models.ProfileChange{Action: models.ProfileCreated}, created)
+	return created, nil
+}
+
+func (s *ProfileHistoryRecorder) EnsureProfile(profile models.Profile) (models.Profile, bool, error) {
+	ensured, created, err := s.ProfileStore.EnsureProfile(profile)
+	if err == nil && created {
+		s.record(models.ProfileChange{Action: models.ProfileCreated}, ensured)
+	}
+	return ensured, created, err
+}
+
+func (s *ProfileHistoryRecorder) RedirectProfile(phoneNumber, movedTo string) (models.Profile, error) {
+	before, err := s.ProfileStore.GetProfile(phoneNumber)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	redirected, err := s.ProfileStore.RedirectProfile(phoneNumber, movedTo)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	previous := models.ValuesOf(before)
+	s.record(models.ProfileChange{Action: models.ProfileMoved, Previous: &previous}, redirected)
+	return redirected, nil
+}
+
+// Rollback restores the values phoneNumber's profile had before the change
+// changeID, as a new update recorded with rollbackOf set; the history is
+// never rewritten. Returns an error wrapping ErrNotFound if the profile or
+// the change doesn't exist, or ErrNothingToRestore if the change created
+// the profile.
+func (s *ProfileHistoryRecorder) Rollback(phoneNumber, changeID string) (models.Profile, models.ProfileChange, error) {
+	change, err := s.history.GetProfileChange(phoneNumber, changeID)
+	if err != nil {
+		return models.Profile{}, models.ProfileChange{}, err
+	}
+	if change.Previous == nil {
+		return models.Profile{}, models.ProfileChange{}, fmt.Errorf("profile change %s created the profile: %w", changeID, ErrNothingToRestore)
+	}
+
+	before, err := s.ProfileStore.GetProfile(phoneNumber)
+	if err != nil {
+		return models.Profile{}, models.ProfileChange{}, err
+	}
+	restored, err := s.ProfileStore.UpdateProfile(phoneNumber, models.Profile{
+		Name:   change.Previous.Name,
+		Avatar: change.Previous.Avatar,
+		Source: change.Previous.Source,
+	})
+	if err != nil {
+		return models.Profile{}, models.ProfileChange{}, err
+	}
+	previous := models.ValuesOf(before)
+	recorded := s.record(models.ProfileChange{Action: models.ProfileRolledBack, Previous: &previous, RollbackOf: changeID}, restored)
+	return restored, recorded, nil
+}
+
+// record completes change as the one that produced profile and appends it
+// to the history, returning it as recorded. A failure is logged and
+// counted rather than returned: the profile has changed regardless.
+func (s *ProfileHistoryRecorder) record(change models.ProfileChange, profile models.Profile) models.ProfileChange {
+	now := s.Clock().Now()
+	change.PhoneNumber = profile.PhoneNumber
+	change.Version = profile.Version
+	change.Actor = s.actor
+	change.At = now
+	change.Current = models.ValuesOf(profile)
+	if s.retention > 0 {
+		expiresAt := now.Add(s.retention)
+		change.ExpiresAt = &expiresAt
+	}
+
+	recorded, err := s.history.RecordProfileChange(change)
+	if err != nil {
+		profileHistoryFailures.WithLabelValues(change.Action).Inc()
+		log.Printf("Failed to record %s change of profile %s at version %d: %v", change.Action, change.PhoneNumber, change.Version, err)
+		return change
+	}
+	return recorded
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// ProfileHistoryStore keeps the changes made to profiles.
+type ProfileHistoryStore interface {
+	// RecordProfileChange appends change to its profile's history, giving it
+	// an ID and, when unset, the current time.
+	RecordProfileChange(change models.ProfileChange) (models.ProfileChange, error)
+
+	// ListProfileHistory retrieves up to limit changes of phoneNumber's
+	// profile with a version below beforeVersion, or any version when it
+	// is 0, newest first. Expired changes are left out.
+	ListProfileHistory(phoneNumber string, beforeVersion int64, limit int) ([]models.ProfileChange, error)
+
+	// GetProfileChange retrieves the change id of phoneNumber's profile.
+	// Returns an error wrapping ErrNotFound if there is none, or it expired.
+	GetProfileChange(phoneNumber, id string) (models.ProfileChange, error)
+}
+
+// newProfileChangeID returns a random ID for a profile change.
+func newProfileChangeID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "change-" + time.Now().Format("20060102150405.000000000")
+	}
+	return "change-" + hex.EncodeToString(b[:])
+}
+
+// MongoProfileHistoryStore implements ProfileHistoryStore using MongoDB.
+// A TTL index removes changes once their expiresAt passes.
+type MongoProfileHistoryStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoProfileHistoryStore creates a new MongoDB profile history store.
+// It uses the same MongoDB connection as the message store.
+func NewMongoProfileHistoryStore(client *mongo.Client, databaseName, collectionName string) *MongoProfileHistoryStore {
+	if collectionName == "" {
+		collectionName = "profile_history"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "phoneNumber", Value: 1}, {Key: "version", Value: -1}},
+			Options: options.Index().SetName("phoneNumber_version_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("expiresAt_ttl_idx"),
+		},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Printf("Warning: could not ensure profile history indexes on %s: %v", collectionName, err)
+	}
+
+	return &MongoProfileHistoryStore{collection: collection}
+}
+
+func (s *MongoProfileHistoryStore) RecordProfileChange(change models.ProfileChange) (models.ProfileChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	change.ID = newProfileChangeID()
+	if change.At.IsZero() {
+		change.At = s.Clock().Now()
+	}
+	if _, err := s.collection.InsertOne(ctx, change); err != nil {
+		return models.ProfileChange{}, fmt.Errorf("failed to record profile change: %w", err)
+	}
+	return change, nil
+}
+
+// ListProfileHistory also filters out expired changes, which the TTL
+// monitor only removes about once a minute.
+func (s *MongoProfileHistoryStore) ListProfileHistory(phoneNumber string, beforeVersion int64, limit int) ([]models.ProfileChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"phoneNumber": phoneNumber,
+		"$or": bson.A{
+			bson.M{"expiresAt": bson.M{"$exists": false}},
+			bson.M{"expiresAt": bson.M{"$gt": s.Clock().Now()}},
+		},
+	}
+	if beforeVersion > 0 {
+		filter["version"] = bson.M{"$lt": beforeVersion}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}, {Key: "at", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profile history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	changes := make([]models.ProfileChange, 0)
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, fmt.Errorf("failed to decode profile history: %w", err)
+	}
+	return changes, nil
+}
+
+func (s *MongoProfileHistoryStore) GetProfileChange(phoneNumber, id string) (models.ProfileChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var change models.ProfileChange
+	err := s.collection.FindOne(ctx, bson.M{"_id": id, "phoneNumber": phoneNumber}).Decode(&change)
+	if err == mongo.ErrNoDocuments || err == nil && change.ExpiresAt != nil && !change.ExpiresAt.After(s.Clock().Now()) {
+		return models.ProfileChange{}, fmt.Errorf("profile change %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return models.ProfileChange{}, fmt.Errorf("failed to get profile change: %w", err)
+	}
+	return change, nil
+}
+
+// MemoryProfileHistoryStore implements ProfileHistoryStore in memory.
+// Expired changes are dropped as new ones are recorded.
+type MemoryProfileHistoryStore struct {
+	mu      sync.Mutex
+	changes map[string][]models.ProfileChange // By phone number, oldest first
+
+	clock.Clocked
+}
+
+func NewMemoryProfileHistoryStore() *MemoryProfileHistoryStore {
+	return &MemoryProfileHistoryStore{changes: make(map[string][]models.ProfileChange)}
+}
+
+func (s *MemoryProfileHistoryStore) RecordProfileChange(change models.ProfileChange) (models.ProfileChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change.ID = newProfileChangeID()
+	if change.At.IsZero() {
+		change.At = s.Clock().Now()
+	}
+	now := s.Clock().Now()
+	kept := slices.DeleteFunc(s.changes[change.PhoneNumber], func(c models.ProfileChange) bool {
+		return c.ExpiresAt != nil && !c.ExpiresAt.After(now)
+	})
+	s.changes[change.PhoneNumber] = append(kept, change)
+	return change, nil
+}
+
+func (s *MemoryProfileHistoryStore) ListProfileHistory(phoneNumber string, beforeVersion int64, limit int) ([]models.ProfileChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	out := make([]models.ProfileChange, 0)
+	for _, c := range s.changes[phoneNumber] {
+		if (beforeVersion == 0 || c.Version < beforeVersion) && (c.ExpiresAt == nil || c.ExpiresAt.After(now)) {
+			out = append(out, c)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b models.ProfileChange) int {
+		return cmp.Or(cmp.Compare(b.Version, a.Version), b.At.Compare(a.At))
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *MemoryProfileHistoryStore) GetProfileChange(phoneNumber, id string) (models.ProfileChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.changes[phoneNumber] {
+		if c.ID == id && (c.ExpiresAt == nil || c.ExpiresAt.After(s.Clock().Now())) {
+			return c, nil
+		}
+	}
+	return models.ProfileChange{}, fmt.Errorf("profile change %s %w", id, ErrNotFound)
+}
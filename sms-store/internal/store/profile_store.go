@@ -4,28 +4,88 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"sms-store/internal/clock"
 	"sms-store/internal/models"
 )
 
 // ProfileStore defines the interface for profile storage operations.
 type ProfileStore interface {
 	// GetProfile retrieves a profile by phone number.
-	// Returns an error if profile is not found.
+	// Returns an error wrapping ErrNotFound if profile is not found.
 	GetProfile(phoneNumber string) (models.Profile, error)
 
 	// UpdateProfile updates an existing profile.
-	// Returns an error if profile is not found.
+	// Returns an error wrapping ErrNotFound if profile is not found, or
+	// ErrProfileMoved if it was merged into another.
 	UpdateProfile(phoneNumber string, profile models.Profile) (models.Profile, error)
 
+	// UpdateProfileIfVersion updates an existing profile like UpdateProfile,
+	// provided it is still at version; the check and the update are one
+	// write. Returns an error wrapping ErrNotFound if profile is not found,
+	// or a *VersionConflictError if it is at another version.
+	UpdateProfileIfVersion(phoneNumber string, profile models.Profile, version int64) (models.Profile, error)
+
 	// CreateProfile creates a new profile.
-	// Returns an error if profile already exists.
+	// Returns an error wrapping ErrAlreadyExists if profile already exists.
 	CreateProfile(profile models.Profile) (models.Profile, error)
+
+	// SearchProfiles retrieves up to limit profiles whose name or phone number
+	// contains query (case-insensitive). Returns an empty slice if none match.
+	SearchProfiles(query string, limit int) ([]models.Profile, error)
+
+	// GetProfiles retrieves the profiles of phoneNumbers, keyed by phone
+	// number. Numbers without a profile are absent from the map.
+	GetProfiles(phoneNumbers []string) (map[string]models.Profile, error)
+
+	// EnsureProfile creates profile unless its number already has one, in
+	// one upsert, so concurrent calls for a number create it once. Returns
+	// the number's profile and whether it was created.
+	EnsureProfile(profile models.Profile) (models.Profile, bool, error)
+
+	// DeleteProfile deletes the profile of phoneNumber.
+	// Returns an error wrapping ErrNotFound if profile is not found.
+	DeleteProfile(phoneNumber string) error
+
+	// RedirectProfile marks the profile of phoneNumber as merged into the
+	// profile of movedTo, keeping its values. Returns an error wrapping
+	// ErrNotFound if profile is not found, or ErrProfileMoved if it was
+	// already merged.
+	RedirectProfile(phoneNumber, movedTo string) (models.Profile, error)
+}
+
+// ErrProfileMoved is returned for a profile merged into another, which no
+// longer changes.
+var ErrProfileMoved = errors.New("profile was merged into another")
+
+// ErrVersionConflict is wrapped by the *VersionConflictError
+// UpdateProfileIfVersion returns for a profile changed since the version
+// the caller read.
+var ErrVersionConflict = errors.New("profile version conflict")
+
+// VersionConflictError describes a conditional update rejected because the
+// profile is no longer at the expected version.
+type VersionConflictError struct {
+	PhoneNumber string `json:"phoneNumber"`
+	Expected    int64  `json:"expectedVersion"`
+	Current     int64  `json:"currentVersion"`
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("profile %s is at version %d, not %d: %v", e.PhoneNumber, e.Current, e.Expected, ErrVersionConflict)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
 }
 
 // MongoProfileStore implements the ProfileStore interface using MongoDB.
@@ -33,6 +93,8 @@ type MongoProfileStore struct {
 	client     *mongo.Client
 	database   *mongo.Database
 	collection *mongo.Collection
+
+	clock.Clocked
 }
 
 // NewMongoProfileStore creates a new MongoDB profile store instance.
@@ -53,7 +115,10 @@ func NewMongoProfileStore(client *mongo.Client, databaseName, collectionName str
 		Keys:    bson.D{{Key: "phoneNumber", Value: 1}},
 		Options: options.Index().SetUnique(true).SetName("phoneNumber_unique_idx"),
 	}
-	_, _ = collection.Indexes().CreateOne(ctx, indexModel)
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		// CreateProfile relies on this index to reject duplicates
+		log.Printf("Warning: could not ensure unique phoneNumber index on %s: %v", collectionName, err)
+	}
 
 	return &MongoProfileStore{
 		client:     client,
@@ -73,7 +138,7 @@ func (s *MongoProfileStore) GetProfile(phoneNumber string) (models.Profile, erro
 	err := s.collection.FindOne(ctx, filter).Decode(&profile)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return models.Profile{}, fmt.Errorf("profile not found for phone number: %s", phoneNumber)
+			return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
 		}
 		return models.Profile{}, fmt.Errorf("failed to get profile: %w", err)
 	}
@@ -83,12 +148,25 @@ func (s *MongoProfileStore) GetProfile(phoneNumber string) (models.Profile, erro
 
 // UpdateProfile updates an existing profile in MongoDB.
 func (s *MongoProfileStore) UpdateProfile(phoneNumber string, profile models.Profile) (models.Profile, error) {
+	return s.updateProfile(phoneNumber, profile, nil)
+}
+
+// UpdateProfileIfVersion updates an existing profile in MongoDB with the
+// version in the filter, so a concurrent update between the read and the
+// write is caught.
+func (s *MongoProfileStore) UpdateProfileIfVersion(phoneNumber string, profile models.Profile, version int64) (models.Profile, error) {
+	return s.updateProfile(phoneNumber, profile, &version)
+}
+
+// updateProfile updates the profile of phoneNumber, only while it is at
+// version when that is non-nil.
+func (s *MongoProfileStore) updateProfile(phoneNumber string, profile models.Profile, version *int64) (models.Profile, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Ensure phoneNumber matches
 	profile.PhoneNumber = phoneNumber
-	profile.UpdatedAt = time.Now()
+	profile.UpdatedAt = s.Clock().Now()
 
 	// Keep CreatedAt from existing profile if it exists
 	filter := bson.M{"phoneNumber": phoneNumber}
@@ -96,26 +174,52 @@ func (s *MongoProfileStore) UpdateProfile(phoneNumber string, profile models.Pro
 	err := s.collection.FindOne(ctx, filter).Decode(&existingProfile)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return models.Profile{}, fmt.Errorf("profile not found for phone number: %s", phoneNumber)
+			return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
 		}
 		return models.Profile{}, fmt.Errorf("failed to check existing profile: %w", err)
 	}
+	if existingProfile.MovedTo != "" {
+		return models.Profile{}, fmt.Errorf("profile %s: %w", phoneNumber, ErrProfileMoved)
+	}
+	if version != nil {
+		if existingProfile.Version != *version {
+			return models.Profile{}, &VersionConflictError{PhoneNumber: phoneNumber, Expected: *version, Current: existingProfile.Version}
+		}
+		// Profiles from before versions were introduced have none stored
+		if *version == 0 {
+			filter["version"] = bson.M{"$in": bson.A{0, nil}}
+		} else {
+			filter["version"] = *version
+		}
+	}
 
 	// Preserve CreatedAt from existing profile
 	profile.CreatedAt = existingProfile.CreatedAt
 
-	// Update the profile
-	update := bson.M{
-		"$set": bson.M{
-			"name":      profile.Name,
-			"avatar":    profile.Avatar,
-			"updatedAt": profile.UpdatedAt,
-		},
+	// Update the profile. An edit makes an automatically created profile
+	// an ordinary one, unless it names a source itself
+	set := bson.M{
+		"name":      profile.Name,
+		"avatar":    profile.Avatar,
+		"updatedAt": profile.UpdatedAt,
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{"source": ""}, "$inc": bson.M{"version": 1}}
+	if profile.Source != "" {
+		set["source"] = profile.Source
+		delete(update, "$unset")
 	}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	var updatedProfile models.Profile
 	err = s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedProfile)
+	if err == mongo.ErrNoDocuments && version != nil {
+		// Updated or deleted since it was read
+		current, getErr := s.GetProfile(phoneNumber)
+		if getErr != nil {
+			return models.Profile{}, getErr
+		}
+		return models.Profile{}, &VersionConflictError{PhoneNumber: phoneNumber, Expected: *version, Current: current.Version}
+	}
 	if err != nil {
 		return models.Profile{}, fmt.Errorf("failed to update profile: %w", err)
 	}
@@ -132,30 +236,348 @@ func (s *MongoProfileStore) CreateProfile(profile models.Profile) (models.Profil
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Check if profile already exists
-	filter := bson.M{"phoneNumber": profile.PhoneNumber}
-	var existingProfile models.Profile
-	err := s.collection.FindOne(ctx, filter).Decode(&existingProfile)
-	if err == nil {
-		return models.Profile{}, fmt.Errorf("profile already exists for phone number: %s", profile.PhoneNumber)
-	}
-	if err != mongo.ErrNoDocuments {
-		return models.Profile{}, fmt.Errorf("failed to check existing profile: %w", err)
-	}
-
 	// Set timestamps
-	now := time.Now()
+	now := s.Clock().Now()
 	profile.CreatedAt = now
 	profile.UpdatedAt = now
+	profile.Version = 1
 
-	_, err = s.collection.InsertOne(ctx, profile)
+	// No pre-read: the unique index on phoneNumber is the only reliable guard
+	// against two concurrent creates for the same number
+	_, err := s.collection.InsertOne(ctx, profile)
 	if err != nil {
-		// Check for duplicate key error
 		if mongo.IsDuplicateKeyError(err) {
-			return models.Profile{}, fmt.Errorf("profile already exists for phone number: %s", profile.PhoneNumber)
+			return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrAlreadyExists, profile.PhoneNumber)
 		}
 		return models.Profile{}, fmt.Errorf("failed to create profile: %w", err)
 	}
 
 	return profile, nil
 }
+
+// SearchProfiles retrieves profiles whose name or phone number contains query.
+func (s *MongoProfileStore) SearchProfiles(query string, limit int) ([]models.Profile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pattern := containsRegex(query)
+	filter := bson.M{"$or": bson.A{
+		bson.M{"name": pattern},
+		bson.M{"phoneNumber": pattern},
+	}}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search profiles: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var profiles []models.Profile
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to decode profiles: %w", err)
+	}
+
+	if profiles == nil {
+		profiles = []models.Profile{}
+	}
+
+	return profiles, nil
+}
+
+// GetProfiles retrieves the profiles of phoneNumbers from MongoDB in one query.
+func (s *MongoProfileStore) GetProfiles(phoneNumbers []string) (map[string]models.Profile, error) {
+	profiles := make(map[string]models.Profile, len(phoneNumbers))
+	if len(phoneNumbers) == 0 {
+		return profiles, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"phoneNumber": bson.M{"$in": phoneNumbers}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profiles: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var profile models.Profile
+		if err := cursor.Decode(&profile); err != nil {
+			return nil, fmt.Errorf("failed to decode profile: %w", err)
+		}
+		profiles[profile.PhoneNumber] = profile
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get profiles: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// EnsureProfile creates profile with $setOnInsert unless its number has one.
+func (s *MongoProfileStore) EnsureProfile(profile models.Profile) (models.Profile, bool, error) {
+	if profile.PhoneNumber == "" {
+		return models.Profile{}, false, errors.New("phoneNumber is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := s.Clock().Now()
+	profile.CreatedAt = now
+	profile.UpdatedAt = now
+	profile.Version = 1
+
+	insert := bson.M{"name": profile.Name, "avatar": profile.Avatar, "version": 1, "createdAt": now, "updatedAt": now}
+	if profile.Source != "" {
+		insert["source"] = profile.Source
+	}
+	if profile.Region != "" {
+		insert["region"] = profile.Region
+	}
+	filter := bson.M{"phoneNumber": profile.PhoneNumber}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	var existing models.Profile
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$setOnInsert": insert}, opts).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return profile, true, nil
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		// Two upserts raced and the other one inserted
+		existing, err = s.GetProfile(profile.PhoneNumber)
+		return existing, false, err
+	}
+	if err != nil {
+		return models.Profile{}, false, fmt.Errorf("failed to ensure profile: %w", err)
+	}
+	return existing, false, nil
+}
+
+// DeleteProfile deletes a profile by phone number from MongoDB.
+func (s *MongoProfileStore) DeleteProfile(phoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"phoneNumber": phoneNumber})
+	if err != nil {
+		return fmt.Errorf("failed to delete profile: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	return nil
+}
+
+// RedirectProfile sets movedTo on the profile of phoneNumber in MongoDB,
+// provided it has none yet, so of two concurrent merges of one profile only
+// one redirects it.
+func (s *MongoProfileStore) RedirectProfile(phoneNumber, movedTo string) (models.Profile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"phoneNumber": phoneNumber, "movedTo": bson.M{"$exists": false}}
+	update := bson.M{
+		"$set": bson.M{"movedTo": movedTo, "updatedAt": s.Clock().Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var redirected models.Profile
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&redirected)
+	if err == mongo.ErrNoDocuments {
+		if _, getErr := s.GetProfile(phoneNumber); getErr != nil {
+			return models.Profile{}, getErr
+		}
+		return models.Profile{}, fmt.Errorf("profile %s: %w", phoneNumber, ErrProfileMoved)
+	}
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("failed to redirect profile: %w", err)
+	}
+	return redirected, nil
+}
+
+// MemoryProfileStore implements the ProfileStore and AutoProfileLister
+// interfaces in memory, for tests and local runs. Like the unique index of
+// MongoProfileStore, it keeps one profile per phone number, so of
+// concurrent creates for a number exactly one succeeds.
+type MemoryProfileStore struct {
+	mu       sync.Mutex
+	profiles map[string]models.Profile
+
+	clock.Clocked
+}
+
+func NewMemoryProfileStore() *MemoryProfileStore {
+	return &MemoryProfileStore{profiles: make(map[string]models.Profile)}
+}
+
+func (s *MemoryProfileStore) GetProfile(phoneNumber string) (models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile, ok := s.profiles[phoneNumber]
+	if !ok {
+		return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	return profile, nil
+}
+
+func (s *MemoryProfileStore) UpdateProfile(phoneNumber string, profile models.Profile) (models.Profile, error) {
+	return s.updateProfile(phoneNumber, profile, nil)
+}
+
+func (s *MemoryProfileStore) UpdateProfileIfVersion(phoneNumber string, profile models.Profile, version int64) (models.Profile, error) {
+	return s.updateProfile(phoneNumber, profile, &version)
+}
+
+// updateProfile changes what MongoProfileStore.updateProfile does: the
+// name, avatar and source, keeping the rest of the stored profile.
+func (s *MemoryProfileStore) updateProfile(phoneNumber string, profile models.Profile, version *int64) (models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.profiles[phoneNumber]
+	if !ok {
+		return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	if existing.MovedTo != "" {
+		return models.Profile{}, fmt.Errorf("profile %s: %w", phoneNumber, ErrProfileMoved)
+	}
+	if version != nil && existing.Version != *version {
+		return models.Profile{}, &VersionConflictError{PhoneNumber: phoneNumber, Expected: *version, Current: existing.Version}
+	}
+
+	existing.Name = profile.Name
+	existing.Avatar = profile.Avatar
+	existing.Source = profile.Source // An edit without a source makes an automatically created profile an ordinary one
+	existing.UpdatedAt = s.Clock().Now()
+	existing.Version++
+	s.profiles[phoneNumber] = existing
+	return existing, nil
+}
+
+func (s *MemoryProfileStore) CreateProfile(profile models.Profile) (models.Profile, error) {
+	if profile.PhoneNumber == "" {
+		return models.Profile{}, errors.New("phoneNumber is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[profile.PhoneNumber]; ok {
+		return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrAlreadyExists, profile.PhoneNumber)
+	}
+	now := s.Clock().Now()
+	profile.CreatedAt = now
+	profile.UpdatedAt = now
+	profile.Version = 1
+	s.profiles[profile.PhoneNumber] = profile
+	return profile, nil
+}
+
+func (s *MemoryProfileStore) SearchProfiles(query string, limit int) ([]models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	profiles := []models.Profile{}
+	for _, p := range s.profiles {
+		if strings.Contains(strings.ToLower(p.Name), query) || strings.Contains(strings.ToLower(p.PhoneNumber), query) {
+			profiles = append(profiles, p)
+		}
+	}
+	slices.SortFunc(profiles, func(a, b models.Profile) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.PhoneNumber, b.PhoneNumber)
+	})
+	if limit > 0 && len(profiles) > limit {
+		profiles = profiles[:limit]
+	}
+	return profiles, nil
+}
+
+func (s *MemoryProfileStore) GetProfiles(phoneNumbers []string) (map[string]models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := make(map[string]models.Profile, len(phoneNumbers))
+	for _, phoneNumber := range phoneNumbers {
+		if p, ok := s.profiles[phoneNumber]; ok {
+			profiles[phoneNumber] = p
+		}
+	}
+	return profiles, nil
+}
+
+func (s *MemoryProfileStore) EnsureProfile(profile models.Profile) (models.Profile, bool, error) {
+	if profile.PhoneNumber == "" {
+		return models.Profile{}, false, errors.New("phoneNumber is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.profiles[profile.PhoneNumber]; ok {
+		return existing, false, nil
+	}
+	now := s.Clock().Now()
+	profile.CreatedAt = now
+	profile.UpdatedAt = now
+	profile.Version = 1
+	profile.MovedTo = ""
+	s.profiles[profile.PhoneNumber] = profile
+	return profile, true, nil
+}
+
+func (s *MemoryProfileStore) DeleteProfile(phoneNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[phoneNumber]; !ok {
+		return fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	delete(s.profiles, phoneNumber)
+	return nil
+}
+
+func (s *MemoryProfileStore) RedirectProfile(phoneNumber, movedTo string) (models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile, ok := s.profiles[phoneNumber]
+	if !ok {
+		return models.Profile{}, fmt.Errorf("profile %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	if profile.MovedTo != "" {
+		return models.Profile{}, fmt.Errorf("profile %s: %w", phoneNumber, ErrProfileMoved)
+	}
+	profile.MovedTo = movedTo
+	profile.UpdatedAt = s.Clock().Now()
+	profile.Version++
+	s.profiles[phoneNumber] = profile
+	return profile, nil
+}
+
+// ListAutoProfiles lists auto-created profiles in phone number order, as
+// MongoProfileStore does.
+func (s *MemoryProfileStore) ListAutoProfiles(createdBefore time.Time, after string, limit int) ([]models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := []models.Profile{}
+	for _, p := range s.profiles {
+		if p.Source == models.ProfileSourceAuto && p.CreatedAt.Before(createdBefore) && p.MovedTo == "" && p.PhoneNumber > after {
+			profiles = append(profiles, p)
+		}
+	}
+	slices.SortFunc(profiles, func(a, b models.Profile) int { return strings.Compare(a.PhoneNumber, b.PhoneNumber) })
+	if len(profiles) > limit {
+		profiles = profiles[:limit]
+	}
+	return profiles, nil
+}
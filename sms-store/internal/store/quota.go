@@ -0,0 +1,306 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+// ErrQuotaExceeded is wrapped by the *QuotaError QuotaEnforcingStore.Save
+// returns for an account holding as many messages as its limit allows.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaError describes a write rejected for its account's quota.
+type QuotaError struct {
+	AccountID string `json:"accountId"`
+	Limit     int64  `json:"limit"`
+	Messages  int64  `json:"messages"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("account %s holds %d of %d messages: %v", e.AccountID, e.Messages, e.Limit, ErrQuotaExceeded)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// staleQuotaWrite is how long a pending write keeps reconciliation away
+// from its account. Writes take seconds at most, so one pending for longer
+// was lost, e.g. to a crash between the write and its count.
+const staleQuotaWrite = 10 * time.Minute
+
+var quotaRejections = metrics.NewCounterVec(
+	"store_quota_rejected_messages_total",
+	"Messages not stored because their account was over its storage quota.",
+	"operation",
+)
+
+// QuotaEnforcingStore wraps a Store so each account stores at most its
+// limit of messages. Every write counts its messages on the account's
+// counter in a QuotaStore; writes that would take an account past its
+// limit are rejected. Writes are checked against the counter as they
+// begin, so concurrent writes may take an account a few messages past it.
+//
+// Messages that come and go behind the store's back, through migrations,
+// archiving or eviction, or whose count failed, leave the counters drifting
+// until Reconcile recounts them.
+type QuotaEnforcingStore struct {
+	Store
+	quotas       QuotaStore
+	defaultLimit int64
+
+	clock.Clocked
+}
+
+// NewQuotaEnforcingStore wraps s, counting messages in qs. Accounts without
+// a limit of their own may store defaultLimit messages; 0 is unlimited.
+func NewQuotaEnforcingStore(s Store, qs QuotaStore, defaultLimit int64) *QuotaEnforcingStore {
+	return &QuotaEnforcingStore{Store: s, quotas: qs, defaultLimit: defaultLimit}
+}
+
+// Save stores msg unless its account is at its limit.
+func (s *QuotaEnforcingStore) Save(msg models.Message) (models.Message, error) {
+	account := accountOf(msg)
+	q, err := s.quotas.BeginWrite(account)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if limit := s.EffectiveLimit(q); limit > 0 && q.Messages >= limit {
+		s.endWrite(account, 0)
+		quotaRejections.WithLabelValues("save").Inc()
+		return models.Message{}, &QuotaError{AccountID: account, Limit: limit, Messages: q.Messages}
+	}
+
+	saved, err := s.Store.Save(msg)
+	var delta int64
+	if err == nil {
+		delta = 1
+	}
+	s.endWrite(account, delta)
+	return saved, err
+}
+
+// SaveBatch stores msgs, silently dropping those past their account's
+// limit. Dropped messages are not counted as saved.
+func (s *QuotaEnforcingStore) SaveBatch(msgs []models.Message) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	// Each account's messages are saved on their own so their count is exact
+	var accounts []string
+	groups := make(map[string][]models.Message)
+	for _, msg := range msgs {
+		account := accountOf(msg)
+		if _, ok := groups[account]; !ok {
+			accounts = append(accounts, account)
+		}
+		groups[account] = append(groups[account], msg)
+	}
+
+	saved := 0
+	for _, account := range accounts {
+		group := groups[account]
+		q, err := s.quotas.BeginWrite(account)
+		if err != nil {
+			return saved, err
+		}
+		if limit := s.EffectiveLimit(q); limit > 0 && q.Messages+int64(len(group)) > limit {
+			keep := max(limit-q.Messages, 0)
+			dropped := int64(len(group)) - keep
+			quotaRejections.WithLabelValues("save_batch").Add(uint64(dropped))
+			log.Printf("Dropped %d message(s) for account %s over its quota of %d", dropped, account, limit)
+			group = group[:keep]
+		}
+		if len(group) == 0 {
+			s.endWrite(account, 0)
+			continue
+		}
+
+		n, err := s.Store.SaveBatch(group)
+		s.endWrite(account, int64(n))
+		saved += n
+		if err != nil {
+			return saved, err
+		}
+	}
+	return saved, nil
+}
+
+// DeleteByPhoneNumber deletes the conversation and takes its messages off
+// their accounts' counts.
+func (s *QuotaEnforcingStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	counts, err := s.Store.CountByAccount(phoneNumber)
+	if err != nil {
+		return 0, err
+	}
+	var begun []string
+	for account := range counts {
+		if _, err := s.quotas.BeginWrite(account); err != nil {
+			for _, a := range begun {
+				s.endWrite(a, 0)
+			}
+			return 0, err
+		}
+		begun = append(begun, account)
+	}
+
+	n, err := s.Store.DeleteByPhoneNumber(phoneNumber)
+	for _, account := range begun {
+		var delta int64
+		switch {
+		case err != nil:
+			// How many went is unknown; left to Reconcile
+		case len(begun) == 1:
+			delta = -n
+		default:
+			delta = -counts[account]
+		}
+		s.endWrite(account, delta)
+	}
+	return n, err
+}
+
+// DeleteAll removes all messages and resets every account's count.
+func (s *QuotaEnforcingStore) DeleteAll() (int64, error) {
+	n, err := s.Store.DeleteAll()
+	if err == nil {
+		s.resetUsage()
+	}
+	return n, err
+}
+
+// DeleteAllBatch deletes a batch; when the store is empty, every account's
+// count is reset.
+func (s *QuotaEnforcingStore) DeleteAllBatch(limit int) (int64, error) {
+	n, err := s.Store.DeleteAllBatch(limit)
+	if err == nil && n == 0 {
+		s.resetUsage()
+	}
+	return n, err
+}
+
+// DropAll empties the store and resets every account's count.
+func (s *QuotaEnforcingStore) DropAll() (int64, error) {
+	n, err := s.Store.DropAll()
+	if err == nil {
+		s.resetUsage()
+	}
+	return n, err
+}
+
+// DefaultLimit returns the limit of accounts without one of their own.
+func (s *QuotaEnforcingStore) DefaultLimit() int64 {
+	return s.defaultLimit
+}
+
+// EffectiveLimit returns the limit q's account is held to; 0 is unlimited.
+func (s *QuotaEnforcingStore) EffectiveLimit(q AccountQuota) int64 {
+	if q.Limit != nil {
+		return *q.Limit
+	}
+	return s.defaultLimit
+}
+
+// Quota returns the counter of accountID, all zeros if it never stored a
+// message.
+func (s *QuotaEnforcingStore) Quota(accountID string) (AccountQuota, error) {
+	quotas, err := s.quotas.GetQuotas([]string{accountID})
+	if err != nil {
+		return AccountQuota{}, err
+	}
+	if q, ok := quotas[accountID]; ok {
+		return q, nil
+	}
+	return AccountQuota{AccountID: accountID}, nil
+}
+
+// SetLimit sets accountID's limit, or returns it to the default when limit
+// is nil.
+func (s *QuotaEnforcingStore) SetLimit(accountID string, limit *int64) (AccountQuota, error) {
+	return s.quotas.SetLimit(accountID, limit)
+}
+
+// QuotaReconciliation is the outcome of Reconcile.
+type QuotaReconciliation struct {
+	Accounts  int      `json:"accounts"`
+	Corrected int      `json:"corrected"` // Accounts whose count had drifted
+	Drift     int64    `json:"drift"`     // Messages added to the counts, negative when they were over
+	Skipped   []string `json:"skipped"`   // Accounts written to while counting, left for the next run
+}
+
+// Reconcile recounts every account's messages and corrects the counters
+// that drifted. A counter is only corrected if no write to its account was
+// pending when the counters were read and none began or ended until the
+// correction: such a write may or may not be in the count, so correcting
+// would count it twice or not at all. Those accounts are skipped until the
+// next run.
+func (s *QuotaEnforcingStore) Reconcile() (QuotaReconciliation, error) {
+	quotas, err := s.quotas.ListQuotas()
+	if err != nil {
+		return QuotaReconciliation{}, err
+	}
+	counts, err := s.Store.CountByAccount("")
+	if err != nil {
+		return QuotaReconciliation{}, err
+	}
+
+	observed := make(map[string]AccountQuota, len(quotas))
+	for _, q := range quotas {
+		observed[q.AccountID] = q
+	}
+	for account := range counts {
+		if _, ok := observed[account]; !ok {
+			observed[account] = AccountQuota{AccountID: account}
+		}
+	}
+
+	now := s.Clock().Now()
+	result := QuotaReconciliation{Accounts: len(observed), Skipped: []string{}}
+	for account, q := range observed {
+		if q.Pending > 0 && now.Sub(q.LastWriteAt) < staleQuotaWrite {
+			result.Skipped = append(result.Skipped, account)
+			continue
+		}
+		ok, err := s.quotas.CorrectUsage(q, counts[account], now)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			result.Skipped = append(result.Skipped, account)
+			continue
+		}
+		if drift := counts[account] - q.Messages; drift != 0 {
+			log.Printf("Corrected message count of account %s from %d to %d", account, q.Messages, counts[account])
+			result.Corrected++
+			result.Drift += drift
+		}
+	}
+	return result, nil
+}
+
+func (s *QuotaEnforcingStore) endWrite(account string, delta int64) {
+	if err := s.quotas.EndWrite(account, delta); err != nil {
+		log.Printf("Failed to count %d message(s) for account %s: %v", delta, account, err)
+	}
+}
+
+func (s *QuotaEnforcingStore) resetUsage() {
+	if err := s.quotas.ResetUsage(); err != nil {
+		log.Printf("Failed to reset account message counts: %v", err)
+	}
+}
+
+// accountOf returns msg's account, which is the default one when unset.
+func accountOf(msg models.Message) string {
+	if msg.AccountID == "" {
+		return models.DefaultAccountID
+	}
+	return msg.AccountID
+}
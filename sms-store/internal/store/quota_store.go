@@ -0,0 +1,316 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+)
+
+// AccountQuota is the message counter of one account. Messages is kept up
+// to date by the writes themselves; Pending and Writes let reconciliation
+// tell whether a write happened while it was counting.
+type AccountQuota struct {
+	AccountID    string     `json:"accountId" bson:"_id"`
+	Messages     int64      `json:"messages" bson:"messages"`
+	Limit        *int64     `json:"limit,omitempty" bson:"limit,omitempty"` // Overrides the default limit; 0 is unlimited
+	Pending      int64      `json:"pending" bson:"pending"`                 // Writes begun and not yet ended
+	Writes       int64      `json:"writes" bson:"writes"`                   // Writes ever begun
+	LastWriteAt  time.Time  `json:"lastWriteAt" bson:"lastWriteAt"`
+	ReconciledAt *time.Time `json:"reconciledAt,omitempty" bson:"reconciledAt,omitempty"`
+}
+
+// QuotaStore defines the interface for per-account message counters.
+type QuotaStore interface {
+	// GetQuotas retrieves the counters of accountIDs, keyed by account ID.
+	// Accounts without a counter are left out.
+	GetQuotas(accountIDs []string) (map[string]AccountQuota, error)
+
+	// ListQuotas retrieves every counter, ordered by account ID.
+	ListQuotas() ([]AccountQuota, error)
+
+	// BeginWrite marks a write to the account as pending, creating its
+	// counter if needed, and returns the counter.
+	BeginWrite(accountID string) (AccountQuota, error)
+
+	// EndWrite ends a write begun with BeginWrite, adding delta to the
+	// account's message count.
+	EndWrite(accountID string, delta int64) error
+
+	// SetLimit sets the account's limit, or clears it when limit is nil,
+	// and returns the counter.
+	SetLimit(accountID string, limit *int64) (AccountQuota, error)
+
+	// CorrectUsage sets the account's message count to messages, clearing
+	// pending writes, only if its counter is still as observed: no write
+	// has begun or ended since. It reports whether the counter was changed.
+	CorrectUsage(observed AccountQuota, messages int64, at time.Time) (bool, error)
+
+	// ResetUsage sets every account's message count to 0.
+	ResetUsage() error
+}
+
+// MongoQuotaStore implements the QuotaStore interface using MongoDB, one
+// document per account keyed by account ID.
+type MongoQuotaStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoQuotaStore creates a new MongoDB quota store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoQuotaStore(client *mongo.Client, databaseName, collectionName string) *MongoQuotaStore {
+	if collectionName == "" {
+		collectionName = "account_quotas"
+	}
+	return &MongoQuotaStore{collection: client.Database(databaseName).Collection(collectionName)}
+}
+
+func (s *MongoQuotaStore) GetQuotas(accountIDs []string) (map[string]AccountQuota, error) {
+	result := make(map[string]AccountQuota)
+	if len(accountIDs) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": accountIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find quotas: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var quotas []AccountQuota
+	if err := cursor.All(ctx, &quotas); err != nil {
+		return nil, fmt.Errorf("failed to decode quotas: %w", err)
+	}
+	for _, q := range quotas {
+		result[q.AccountID] = q
+	}
+	return result, nil
+}
+
+func (s *MongoQuotaStore) ListQuotas() ([]AccountQuota, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quotas: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	quotas := make([]AccountQuota, 0)
+	if err := cursor.All(ctx, &quotas); err != nil {
+		return nil, fmt.Errorf("failed to decode quotas: %w", err)
+	}
+	return quotas, nil
+}
+
+func (s *MongoQuotaStore) BeginWrite(accountID string) (AccountQuota, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$inc":         bson.M{"pending": 1, "writes": 1},
+		"$set":         bson.M{"lastWriteAt": s.Clock().Now()},
+		"$setOnInsert": bson.M{"messages": 0},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var q AccountQuota
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": accountID}, update, opts).Decode(&q)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another write created the counter first; it exists now
+		err = s.collection.FindOneAndUpdate(ctx, bson.M{"_id": accountID}, update, opts).Decode(&q)
+	}
+	if err != nil {
+		return AccountQuota{}, fmt.Errorf("failed to begin quota write: %w", err)
+	}
+	return q, nil
+}
+
+func (s *MongoQuotaStore) EndWrite(accountID string, delta int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$inc": bson.M{"pending": -1, "messages": delta}}
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": accountID}, update); err != nil {
+		return fmt.Errorf("failed to end quota write: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoQuotaStore) SetLimit(accountID string, limit *int64) (AccountQuota, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$setOnInsert": bson.M{"messages": 0, "pending": 0, "writes": 0}}
+	if limit != nil {
+		update["$set"] = bson.M{"limit": *limit}
+	} else {
+		update["$unset"] = bson.M{"limit": ""}
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var q AccountQuota
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": accountID}, update, opts).Decode(&q)
+	if mongo.IsDuplicateKeyError(err) {
+		err = s.collection.FindOneAndUpdate(ctx, bson.M{"_id": accountID}, update, opts).Decode(&q)
+	}
+	if err != nil {
+		return AccountQuota{}, fmt.Errorf("failed to set quota limit: %w", err)
+	}
+	return q, nil
+}
+
+func (s *MongoQuotaStore) CorrectUsage(observed AccountQuota, messages int64, at time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An account without a counter is observed as all zeros, which the
+	// filter's fields also give the document an upsert inserts
+	filter := bson.M{
+		"_id":      observed.AccountID,
+		"messages": observed.Messages,
+		"pending":  observed.Pending,
+		"writes":   observed.Writes,
+	}
+	update := bson.M{
+		"$inc": bson.M{"messages": messages - observed.Messages, "pending": -observed.Pending},
+		"$set": bson.M{"reconciledAt": at},
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The counter exists but no longer matches: a write came in
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to correct quota usage: %w", err)
+	}
+	return result.MatchedCount > 0 || result.UpsertedCount > 0, nil
+}
+
+func (s *MongoQuotaStore) ResetUsage() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Counting as a write keeps a reconciliation that counted before the
+	// reset from applying its count
+	update := bson.M{"$set": bson.M{"messages": 0}, "$inc": bson.M{"writes": 1}}
+	if _, err := s.collection.UpdateMany(ctx, bson.M{}, update); err != nil {
+		return fmt.Errorf("failed to reset quota usage: %w", err)
+	}
+	return nil
+}
+
+// MemoryQuotaStore implements the QuotaStore interface in memory.
+type MemoryQuotaStore struct {
+	mu     sync.Mutex
+	quotas map[string]AccountQuota
+
+	clock.Clocked
+}
+
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{quotas: make(map[string]AccountQuota)}
+}
+
+func (s *MemoryQuotaStore) GetQuotas(accountIDs []string) (map[string]AccountQuota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]AccountQuota)
+	for _, id := range accountIDs {
+		if q, ok := s.quotas[id]; ok {
+			result[id] = q
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryQuotaStore) ListQuotas() ([]AccountQuota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]AccountQuota, 0, len(s.quotas))
+	for _, q := range s.quotas {
+		out = append(out, q)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AccountID < out[j].AccountID })
+	return out, nil
+}
+
+func (s *MemoryQuotaStore) BeginWrite(accountID string) (AccountQuota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.quotas[accountID]
+	q.AccountID = accountID
+	q.Pending++
+	q.Writes++
+	q.LastWriteAt = s.Clock().Now()
+	s.quotas[accountID] = q
+	return q, nil
+}
+
+func (s *MemoryQuotaStore) EndWrite(accountID string, delta int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.quotas[accountID]; ok {
+		q.Pending--
+		q.Messages += delta
+		s.quotas[accountID] = q
+	}
+	return nil
+}
+
+func (s *MemoryQuotaStore) SetLimit(accountID string, limit *int64) (AccountQuota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.quotas[accountID]
+	q.AccountID = accountID
+	q.Limit = limit
+	s.quotas[accountID] = q
+	return q, nil
+}
+
+func (s *MemoryQuotaStore) CorrectUsage(observed AccountQuota, messages int64, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quotas[observed.AccountID]
+	if !ok {
+		q = AccountQuota{AccountID: observed.AccountID}
+	}
+	if q.Messages != observed.Messages || q.Pending != observed.Pending || q.Writes != observed.Writes {
+		return false, nil
+	}
+	q.Messages = messages
+	q.Pending = 0
+	q.ReconciledAt = &at
+	s.quotas[observed.AccountID] = q
+	return true, nil
+}
+
+func (s *MemoryQuotaStore) ResetUsage() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, q := range s.quotas {
+		q.Messages = 0
+		q.Writes++
+		s.quotas[id] = q
+	}
+	return nil
+}
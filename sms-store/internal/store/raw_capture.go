@@ -0,0 +1,192 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+// Outcomes of capturing one payload, as the outcome label of
+// raw_events_captured_total. All but rawStored are drops.
+const (
+	rawStored      = "stored"
+	rawQueueFull   = "queue_full"   // The writer was behind
+	rawWriteFailed = "write_failed" // The store rejected the batch
+	rawClosed      = "closed"       // Captured after Close
+)
+
+var rawEventsCaptured = metrics.NewCounterVec(
+	"raw_events_captured_total",
+	"Raw event payloads offered for capture, by outcome; every outcome but stored is a drop.",
+	"outcome",
+)
+
+// RawCaptureConfig bounds what a RawCapture keeps and how far its writer
+// may fall behind.
+type RawCaptureConfig struct {
+	MaxBytes  int           // Payloads are cut to this many bytes before compression
+	TTL       time.Duration // How long a payload is kept
+	QueueSize int           // Payloads waiting for the writer; more are dropped
+	BatchSize int           // Payloads written at once
+}
+
+// DefaultRawCaptureConfig returns the configuration used when none is given.
+func DefaultRawCaptureConfig() RawCaptureConfig {
+	return RawCaptureConfig{
+		MaxBytes:  64 * 1024,
+		TTL:       24 * time.Hour,
+		QueueSize: 4096,
+		BatchSize: 100,
+	}
+}
+
+// RawCapture writes the payloads events arrived with to a RawEventStore in
+// the background, so the consumer never waits on it: Capture only queues a
+// payload, and drops it when the queue is full. Payloads are truncated and
+// gzipped by the writer. Every drop is counted in raw_events_captured_total;
+// capture is for debugging, and a missing payload is not an error.
+type RawCapture struct {
+	store  RawEventStore
+	config RawCaptureConfig
+	queue  chan models.RawEvent
+	closed atomic.Bool
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	clock.Clocked
+}
+
+// NewRawCapture starts a writer of captured payloads to rs. Zero fields of
+// config take their defaults.
+func NewRawCapture(rs RawEventStore, config RawCaptureConfig) *RawCapture {
+	defaults := DefaultRawCaptureConfig()
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaults.MaxBytes
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaults.TTL
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+
+	c := &RawCapture{
+		store:  rs,
+		config: config,
+		queue:  make(chan models.RawEvent, config.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Store returns the store payloads are written to.
+func (c *RawCapture) Store() RawEventStore {
+	return c.store
+}
+
+// Capture queues event, whose Payload is as it arrived, to be written. It
+// never blocks.
+func (c *RawCapture) Capture(event models.RawEvent) {
+	if c.closed.Load() {
+		rawEventsCaptured.WithLabelValues(rawClosed).Inc()
+		return
+	}
+	event.CapturedAt = c.Clock().Now()
+	select {
+	case c.queue <- event:
+	default:
+		rawEventsCaptured.WithLabelValues(rawQueueFull).Inc()
+	}
+}
+
+// Close writes the payloads still queued and stops the writer. Payloads
+// captured after it are dropped.
+func (c *RawCapture) Close() error {
+	c.once.Do(func() {
+		c.closed.Store(true)
+		close(c.stop)
+	})
+	<-c.done
+	return nil
+}
+
+// run writes queued payloads in batches of what is queued, up to the batch
+// size, until Close.
+func (c *RawCapture) run() {
+	defer close(c.done)
+
+	batch := make([]models.RawEvent, 0, c.config.BatchSize)
+	for {
+		select {
+		case event := <-c.queue:
+			batch = append(batch[:0], c.encode(event))
+			c.fill(&batch)
+			c.write(batch)
+		case <-c.stop:
+			for len(c.queue) > 0 {
+				batch = batch[:0]
+				c.fill(&batch)
+				c.write(batch)
+			}
+			return
+		}
+	}
+}
+
+// fill adds the payloads already queued to batch, up to the batch size.
+func (c *RawCapture) fill(batch *[]models.RawEvent) {
+	for len(*batch) < c.config.BatchSize {
+		select {
+		case event := <-c.queue:
+			*batch = append(*batch, c.encode(event))
+		default:
+			return
+		}
+	}
+}
+
+// encode truncates and compresses the payload of event, and dates its
+// expiry.
+func (c *RawCapture) encode(event models.RawEvent) models.RawEvent {
+	event.Size = len(event.Payload)
+	payload := event.Payload
+	if len(payload) > c.config.MaxBytes {
+		payload = payload[:c.config.MaxBytes]
+		event.Truncated = true
+	}
+
+	// Writing to a bytes.Buffer can't fail
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(payload)
+	zw.Close()
+	event.Payload = buf.Bytes()
+	event.ContentEncoding = "gzip"
+	event.ExpiresAt = event.CapturedAt.Add(c.config.TTL)
+	return event
+}
+
+func (c *RawCapture) write(batch []models.RawEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := c.store.SaveRawEvents(batch); err != nil {
+		rawEventsCaptured.WithLabelValues(rawWriteFailed).Add(uint64(len(batch)))
+		log.Printf("Dropped %d raw event payloads: %v", len(batch), err)
+		return
+	}
+	rawEventsCaptured.WithLabelValues(rawStored).Add(uint64(len(batch)))
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// RawEventStore keeps the payloads events arrived with, by the ID of the
+// message made from each, until they expire.
+type RawEventStore interface {
+	// SaveRawEvents stores events, replacing any already kept under the
+	// same message ID, as a redelivered event is.
+	SaveRawEvents(events []models.RawEvent) error
+
+	// GetRawEvent retrieves the payload of messageID. Returns an error
+	// wrapping ErrNotFound if there is none, or it expired.
+	GetRawEvent(messageID string) (models.RawEvent, error)
+}
+
+// MongoRawEventStore implements RawEventStore using MongoDB. A TTL index
+// removes payloads once their expiresAt passes.
+type MongoRawEventStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoRawEventStore creates a new MongoDB raw event store.
+// It uses the same MongoDB connection as the message store.
+func NewMongoRawEventStore(client *mongo.Client, databaseName, collectionName string) *MongoRawEventStore {
+	if collectionName == "" {
+		collectionName = "raw_events"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("expiresAt_ttl_idx"),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Printf("Warning: could not ensure raw event TTL index on %s: %v", collectionName, err)
+	}
+
+	return &MongoRawEventStore{collection: collection}
+}
+
+func (s *MongoRawEventStore) SaveRawEvents(events []models.RawEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	writes := make([]mongo.WriteModel, 0, len(events))
+	for _, e := range events {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": e.MessageID}).
+			SetReplacement(e).
+			SetUpsert(true))
+	}
+	if _, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to save raw events: %w", err)
+	}
+	return nil
+}
+
+// GetRawEvent also leaves out expired payloads, which the TTL monitor only
+// removes about once a minute.
+func (s *MongoRawEventStore) GetRawEvent(messageID string) (models.RawEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event models.RawEvent
+	err := s.collection.FindOne(ctx, bson.M{"_id": messageID}).Decode(&event)
+	if err == mongo.ErrNoDocuments || err == nil && !event.ExpiresAt.After(s.Clock().Now()) {
+		return models.RawEvent{}, fmt.Errorf("raw event of message %s %w", messageID, ErrNotFound)
+	}
+	if err != nil {
+		return models.RawEvent{}, fmt.Errorf("failed to get raw event: %w", err)
+	}
+	return event, nil
+}
+
+// MemoryRawEventStore implements RawEventStore in memory. Expired payloads
+// are dropped as new ones are saved.
+type MemoryRawEventStore struct {
+	mu     sync.Mutex
+	events map[string]models.RawEvent
+
+	clock.Clocked
+}
+
+func NewMemoryRawEventStore() *MemoryRawEventStore {
+	return &MemoryRawEventStore{events: make(map[string]models.RawEvent)}
+}
+
+func (s *MemoryRawEventStore) SaveRawEvents(events []models.RawEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	for id, e := range s.events {
+		if !e.ExpiresAt.After(now) {
+			delete(s.events, id)
+		}
+	}
+	for _, e := range events {
+		s.events[e.MessageID] = e
+	}
+	return nil
+}
+
+func (s *MemoryRawEventStore) GetRawEvent(messageID string) (models.RawEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[messageID]
+	if !ok || !e.ExpiresAt.After(s.Clock().Now()) {
+		return models.RawEvent{}, fmt.Errorf("raw event of message %s %w", messageID, ErrNotFound)
+	}
+	return e, nil
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// ReadCursorStore defines the interface for per-conversation read cursors.
+type ReadCursorStore interface {
+	// MarkRead moves the conversation's cursor to upTo and returns it. A
+	// cursor already past upTo is kept, so concurrent calls settle on the
+	// latest and a cursor never moves backwards.
+	MarkRead(accountID, phoneNumber string, upTo time.Time) (models.ReadCursor, error)
+
+	// ListReadCursors retrieves the cursors of the given phone numbers, keyed
+	// by phone number. Numbers never marked read are absent from the map.
+	ListReadCursors(accountID string, phoneNumbers []string) (map[string]models.ReadCursor, error)
+
+	// ListChangedReadCursors retrieves up to q.Limit of the account's cursors
+	// updated within q, oldest update first.
+	ListChangedReadCursors(accountID string, q ChangeQuery) ([]models.ReadCursor, error)
+}
+
+// MongoReadCursorStore implements the ReadCursorStore interface using MongoDB.
+type MongoReadCursorStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoReadCursorStore creates a new MongoDB read cursor store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoReadCursorStore(client *mongo.Client, databaseName, collectionName string) *MongoReadCursorStore {
+	if collectionName == "" {
+		collectionName = "read_cursors"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "accountId", Value: 1}, {Key: "phoneNumber", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("accountId_phoneNumber_unique_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "accountId", Value: 1}, {Key: "updatedAt", Value: 1}, {Key: "phoneNumber", Value: 1}},
+			Options: options.Index().SetName("accountId_updatedAt_phoneNumber_idx"),
+		},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		log.Printf("Warning: could not ensure read cursor indexes on %s: %v", collectionName, err)
+	}
+
+	return &MongoReadCursorStore{collection: collection}
+}
+
+// MarkRead advances the cursor with $max, which MongoDB applies atomically.
+func (s *MongoReadCursorStore) MarkRead(accountID, phoneNumber string, upTo time.Time) (models.ReadCursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"accountId": accountID, "phoneNumber": phoneNumber}
+	update := bson.M{
+		"$max": bson.M{"lastReadMessageAt": upTo},
+		"$set": bson.M{"updatedAt": s.Clock().Now()},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var cursor models.ReadCursor
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&cursor)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent call created the cursor first; it exists now
+		err = s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&cursor)
+	}
+	if err != nil {
+		return models.ReadCursor{}, fmt.Errorf("failed to mark conversation read: %w", err)
+	}
+	return cursor, nil
+}
+
+// ListReadCursors retrieves the cursors of several conversations in one query.
+func (s *MongoReadCursorStore) ListReadCursors(accountID string, phoneNumbers []string) (map[string]models.ReadCursor, error) {
+	result := make(map[string]models.ReadCursor)
+	if len(phoneNumbers) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"accountId": accountID, "phoneNumber": bson.M{"$in": phoneNumbers}}
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list read cursors: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var cursors []models.ReadCursor
+	if err := cursor.All(ctx, &cursors); err != nil {
+		return nil, fmt.Errorf("failed to decode read cursors: %w", err)
+	}
+	for _, c := range cursors {
+		result[c.PhoneNumber] = c
+	}
+	return result, nil
+}
+
+func (s *MongoReadCursorStore) ListChangedReadCursors(accountID string, q ChangeQuery) ([]models.ReadCursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"accountId": accountID,
+		"$or": bson.A{
+			bson.M{"updatedAt": bson.M{"$gt": q.After}},
+			bson.M{"updatedAt": q.After, "phoneNumber": bson.M{"$gt": q.AfterPhoneNumber}},
+		},
+	}
+	if !q.Until.IsZero() {
+		filter["$and"] = bson.A{bson.M{"updatedAt": bson.M{"$lt": q.Until}}}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: 1}, {Key: "phoneNumber", Value: 1}}).
+		SetLimit(int64(q.Limit))
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed read cursors: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	cursors := []models.ReadCursor{}
+	if err := cursor.All(ctx, &cursors); err != nil {
+		return nil, fmt.Errorf("failed to decode read cursors: %w", err)
+	}
+	return cursors, nil
+}
+
+// MemoryReadCursorStore implements the ReadCursorStore interface in memory.
+type MemoryReadCursorStore struct {
+	mu      sync.Mutex
+	cursors map[[2]string]models.ReadCursor // Keyed by account ID and phone number
+
+	clock.Clocked
+}
+
+func NewMemoryReadCursorStore() *MemoryReadCursorStore {
+	return &MemoryReadCursorStore{cursors: make(map[[2]string]models.ReadCursor)}
+}
+
+func (s *MemoryReadCursorStore) MarkRead(accountID, phoneNumber string, upTo time.Time) (models.ReadCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{accountID, phoneNumber}
+	cursor, ok := s.cursors[key]
+	if !ok {
+		cursor = models.ReadCursor{AccountID: accountID, PhoneNumber: phoneNumber}
+	}
+	if upTo.After(cursor.LastReadMessageAt) {
+		cursor.LastReadMessageAt = upTo
+	}
+	cursor.UpdatedAt = s.Clock().Now()
+	s.cursors[key] = cursor
+	return cursor, nil
+}
+
+func (s *MemoryReadCursorStore) ListReadCursors(accountID string, phoneNumbers []string) (map[string]models.ReadCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]models.ReadCursor)
+	for _, pn := range phoneNumbers {
+		if c, ok := s.cursors[[2]string{accountID, pn}]; ok {
+			result[pn] = c
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryReadCursorStore) ListChangedReadCursors(accountID string, q ChangeQuery) ([]models.ReadCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make([]models.ReadCursor, 0)
+	for key, c := range s.cursors {
+		if key[0] == accountID && q.Includes(c.UpdatedAt, c.PhoneNumber) {
+			changed = append(changed, c)
+		}
+	}
+	slices.SortFunc(changed, func(a, b models.ReadCursor) int {
+		return cmp.Or(a.UpdatedAt.Compare(b.UpdatedAt), cmp.Compare(a.PhoneNumber, b.PhoneNumber))
+	})
+	if len(changed) > q.Limit {
+		changed = changed[:q.Limit]
+	}
+	return changed, nil
+}
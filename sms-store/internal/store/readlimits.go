@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+// ErrReadLimitExceeded is wrapped by the *ReadLimitError of a read that
+// matched more documents than ReadLimits.MaxDocuments.
+var ErrReadLimitExceeded = errors.New("read limit exceeded")
+
+// ReadLimitError describes a read aborted for matching too many documents.
+type ReadLimitError struct {
+	Operation string `json:"operation"`
+	Limit     int    `json:"limit"`
+}
+
+func (e *ReadLimitError) Error() string {
+	return fmt.Sprintf("%s matched more than %d messages: %v", e.Operation, e.Limit, ErrReadLimitExceeded)
+}
+
+func (e *ReadLimitError) Unwrap() error {
+	return ErrReadLimitExceeded
+}
+
+// ReadLimits bound the memory one MongoStore read takes.
+type ReadLimits struct {
+	// BatchSize is how many documents each cursor batch holds, unless a
+	// PageQuery asks for fewer. Without one the server fills batches up to
+	// 16MB, all of it decoded at once. 0 keeps the server's batches.
+	BatchSize int
+
+	// MaxDocuments is the most documents one read returning a slice may
+	// decode; the read fails with a *ReadLimitError past it. 0 for no limit.
+	MaxDocuments int
+}
+
+// DefaultReadLimits are the read limits of a new MongoStore.
+func DefaultReadLimits() ReadLimits {
+	return ReadLimits{BatchSize: 500, MaxDocuments: 50000}
+}
+
+var (
+	readBatchBytes = metrics.NewHistogramVec(
+		"store_read_batch_bytes",
+		"Size of the cursor batches MongoDB reads returned, by operation.",
+		[]float64{16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20},
+		"operation",
+	)
+	readBatchBytesMax = metrics.NewGauge(
+		"store_read_batch_bytes_max",
+		"Largest cursor batch a MongoDB read returned since the server started, in bytes.",
+	)
+	readLimitAborts = metrics.NewCounterVec(
+		"store_read_limit_exceeded_total",
+		"MongoDB reads aborted for matching more documents than MONGODB_READ_MAX_DOCUMENTS, by operation.",
+		"operation",
+	)
+
+	largestBatch atomic.Int64
+)
+
+// SetReadLimits replaces the read limits of s; call it before serving.
+func (s *MongoStore) SetReadLimits(limits ReadLimits) {
+	s.limits = limits
+}
+
+// observeBatch records a cursor batch of n bytes.
+func observeBatch(operation string, n int) {
+	readBatchBytes.WithLabelValues(operation).Observe(float64(n))
+	for {
+		largest := largestBatch.Load()
+		if int64(n) <= largest {
+			return
+		}
+		if largestBatch.CompareAndSwap(largest, int64(n)) {
+			readBatchBytesMax.Set(float64(n))
+			return
+		}
+	}
+}
+
+// readAll decodes the messages of cursor one at a time, instead of
+// cursor.All's whole result at once, failing with a *ReadLimitError past
+// MaxDocuments. It records the size of each batch as it is used up.
+func (s *MongoStore) readAll(ctx context.Context, cursor *mongo.Cursor, operation string) ([]models.Message, error) {
+	messages := []models.Message{}
+	batch := 0
+	for cursor.Next(ctx) {
+		if limit := s.limits.MaxDocuments; limit > 0 && len(messages) == limit {
+			readLimitAborts.WithLabelValues(operation).Inc()
+			return nil, &ReadLimitError{Operation: operation, Limit: limit}
+		}
+		batch += len(cursor.Current)
+		if cursor.RemainingBatchLength() == 0 {
+			observeBatch(operation, batch)
+			batch = 0
+		}
+
+		var msg models.Message
+		if err := cursor.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("failed to decode message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
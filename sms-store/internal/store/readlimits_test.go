@@ -0,0 +1,83 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sms-store/internal/metrics"
+	"sms-store/internal/store"
+)
+
+// messageCursor returns a cursor over n message documents, as a read
+// matching them would return.
+func messageCursor(t *testing.T, n int) *mongo.Cursor {
+	t.Helper()
+	docs := make([]any, n)
+	for i := range docs {
+		docs[i] = bson.D{{Key: "id", Value: fmt.Sprintf("m%d", i)}, {Key: "phoneNumber", Value: "9876543210"}, {Key: "text", Value: "hello"}}
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursor
+}
+
+// readLimitAborts returns store_read_limit_exceeded_total for operation.
+func readLimitAborts(t *testing.T, operation string) int {
+	t.Helper()
+	var out strings.Builder
+	metrics.Default.WriteText(&out)
+	m := regexp.MustCompile(fmt.Sprintf(`store_read_limit_exceeded_total\{operation="%s"\} (\d+)`, operation)).FindStringSubmatch(out.String())
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+func TestReadPastMaxDocumentsAborts(t *testing.T) {
+	s := &store.MongoStore{}
+	s.SetReadLimits(store.ReadLimits{MaxDocuments: 100})
+
+	for _, tc := range []struct {
+		name      string
+		documents int
+		aborted   bool
+	}{
+		{"UnderLimit", 99, false},
+		{"AtLimit", 100, false},
+		{"OverLimit", 101, true},
+		{"FarOverLimit", 60000, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			operation := "FindByPhoneNumber" + tc.name
+			before := readLimitAborts(t, operation)
+			messages, err := s.ReadAll(context.Background(), messageCursor(t, tc.documents), operation)
+
+			var limitErr *store.ReadLimitError
+			if !tc.aborted {
+				if err != nil || len(messages) != tc.documents || messages[0].ID != "m0" {
+					t.Fatalf("ReadAll = %d messages, %v; want all %d", len(messages), err, tc.documents)
+				}
+				return
+			}
+			if !errors.As(err, &limitErr) || !errors.Is(err, store.ErrReadLimitExceeded) || messages != nil {
+				t.Fatalf("ReadAll = %d messages, %v; want a *ReadLimitError", len(messages), err)
+			}
+			if limitErr.Limit != 100 || limitErr.Operation != operation {
+				t.Fatalf("ReadLimitError = %+v, want the limit of 100 for %s", limitErr, operation)
+			}
+			if got := readLimitAborts(t, operation) - before; got != 1 {
+				t.Fatalf("%d aborts counted, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// minMaxStaleness is the smallest maxStalenessSeconds servers accept.
+const minMaxStaleness = 90 * time.Second
+
+// ParseReadPreference parses a MONGODB_ANALYTICS_READ_PREFERENCE setting:
+// primary, primaryPreferred, secondaryPreferred or nearest, with secondaries
+// at most maxStaleness behind the primary when it is above 0. Every mode
+// reads from the primary when no secondary is available; secondary, which
+// fails instead, is refused.
+func ParseReadPreference(mode string, maxStaleness time.Duration) (*readpref.ReadPref, error) {
+	m, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, errors.New("read preference must be primary, primaryPreferred, secondaryPreferred or nearest")
+	}
+	if m == readpref.SecondaryMode {
+		return nil, errors.New("read preference secondary fails when no secondary is available; use secondaryPreferred")
+	}
+	if maxStaleness <= 0 {
+		return readpref.New(m)
+	}
+	if m == readpref.PrimaryMode {
+		return nil, errors.New("a max staleness needs a read preference other than primary")
+	}
+	if maxStaleness < minMaxStaleness {
+		return nil, fmt.Errorf("max staleness must be at least %v", minMaxStaleness)
+	}
+	return readpref.New(m, readpref.WithMaxStaleness(maxStaleness))
+}
+
+// WithReadPreference returns a store reading the same collection with rp,
+// for reads that can be served by a secondary, such as analytics and
+// exports. It shares the client of s; writes and index builds belong on s.
+func (s *MongoStore) WithReadPreference(rp *readpref.ReadPref) (*MongoStore, error) {
+	collection, err := s.collection.Clone(options.Collection().SetReadPreference(rp))
+	if err != nil {
+		return nil, err
+	}
+	reader := &MongoStore{
+		client:     s.client,
+		database:   s.client.Database(s.database.Name(), options.Database().SetReadPreference(rp)),
+		collection: collection,
+		server:     s.server,
+		readFrom:   rp.Mode().String(),
+		limits:     s.limits,
+	}
+	reader.indexesReady.Store(s.indexesReady.Load())
+	return reader, nil
+}
+
+// WithReadPreference returns a profile store reading the same collection
+// with rp, for profile searches that can be served by a secondary.
+func (s *MongoProfileStore) WithReadPreference(rp *readpref.ReadPref) (*MongoProfileStore, error) {
+	collection, err := s.collection.Clone(options.Collection().SetReadPreference(rp))
+	if err != nil {
+		return nil, err
+	}
+	reader := &MongoProfileStore{
+		client:     s.client,
+		database:   s.client.Database(s.database.Name(), options.Database().SetReadPreference(rp)),
+		collection: collection,
+	}
+	reader.SetClock(s.Clock())
+	return reader, nil
+}
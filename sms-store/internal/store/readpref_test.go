@@ -0,0 +1,158 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sms-store/internal/store"
+)
+
+func TestParseReadPreference(t *testing.T) {
+	tests := []struct {
+		mode         string
+		maxStaleness time.Duration
+		want         readpref.Mode
+		wantErr      bool
+	}{
+		{mode: "primary", want: readpref.PrimaryMode},
+		{mode: "primaryPreferred", want: readpref.PrimaryPreferredMode},
+		{mode: "secondaryPreferred", want: readpref.SecondaryPreferredMode},
+		{mode: "nearest", maxStaleness: 2 * time.Minute, want: readpref.NearestMode},
+		{mode: "secondary", wantErr: true},
+		{mode: "fastest", wantErr: true},
+		{mode: "primary", maxStaleness: 2 * time.Minute, wantErr: true},
+		{mode: "secondaryPreferred", maxStaleness: time.Minute, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%v", tt.mode, tt.maxStaleness), func(t *testing.T) {
+			rp, err := store.ParseReadPreference(tt.mode, tt.maxStaleness)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseReadPreference(%q, %v) = %v, want an error", tt.mode, tt.maxStaleness, rp.Mode())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseReadPreference(%q, %v): %v", tt.mode, tt.maxStaleness, err)
+			}
+			if rp.Mode() != tt.want {
+				t.Fatalf("ParseReadPreference(%q, %v) mode = %v, want %v", tt.mode, tt.maxStaleness, rp.Mode(), tt.want)
+			}
+			if staleness, set := rp.MaxStaleness(); set != (tt.maxStaleness > 0) || set && staleness != tt.maxStaleness {
+				t.Fatalf("ParseReadPreference(%q, %v) max staleness = %v, %v", tt.mode, tt.maxStaleness, staleness, set)
+			}
+		})
+	}
+}
+
+// TestReadPreferenceServingMember runs against the replica set at
+// TEST_MONGODB_REPLSET_URI, which needs at least one secondary, and is
+// skipped without one. It counts the queries each member's serverStatus
+// reports to tell which member served the reads.
+func TestReadPreferenceServingMember(t *testing.T) {
+	uri := os.Getenv("TEST_MONGODB_REPLSET_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_REPLSET_URI not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	database := fmt.Sprintf("sms_store_test_%d", time.Now().UnixNano())
+	s, err := store.NewMongoStore(uri, database, "messages")
+	if err != nil {
+		t.Fatalf("NewMongoStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", uri, err)
+	}
+	t.Cleanup(func() {
+		client.Database(database).Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	var hello struct {
+		Primary string   `bson:"primary"`
+		Hosts   []string `bson:"hosts"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		t.Fatalf("hello: %v", err)
+	}
+	if hello.Primary == "" || len(hello.Hosts) < 2 {
+		t.Skipf("%s is not a replica set with a secondary: %+v", uri, hello)
+	}
+	members := make(map[string]*mongo.Client, len(hello.Hosts))
+	for _, host := range hello.Hosts {
+		opts := options.Client().ApplyURI(uri).SetHosts([]string{host}).SetDirect(true)
+		opts.ReplicaSet = nil
+		member, err := mongo.Connect(ctx, opts)
+		if err != nil {
+			t.Fatalf("connect to member %s: %v", host, err)
+		}
+		t.Cleanup(func() { member.Disconnect(context.Background()) })
+		members[host] = member
+	}
+	// queriesServed returns the queries the primary and the secondaries
+	// have served since they started.
+	queriesServed := func() (primary, secondaries int64) {
+		for host, member := range members {
+			var status struct {
+				Opcounters struct {
+					Query int64 `bson:"query"`
+				} `bson:"opcounters"`
+			}
+			if err := member.Database("admin").RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).Decode(&status); err != nil {
+				t.Fatalf("serverStatus of %s: %v", host, err)
+			}
+			if host == hello.Primary {
+				primary += status.Opcounters.Query
+			} else {
+				secondaries += status.Opcounters.Query
+			}
+		}
+		return primary, secondaries
+	}
+
+	const reads = 20
+	read := func(s *store.MongoStore) {
+		for range reads {
+			if _, err := s.FindByPhoneNumber("1111111111"); err != nil {
+				t.Fatalf("FindByPhoneNumber: %v", err)
+			}
+		}
+	}
+
+	rp, err := store.ParseReadPreference("secondaryPreferred", 0)
+	if err != nil {
+		t.Fatalf("ParseReadPreference: %v", err)
+	}
+	analytics, err := s.WithReadPreference(rp)
+	if err != nil {
+		t.Fatalf("WithReadPreference: %v", err)
+	}
+	primaryBefore, secondariesBefore := queriesServed()
+	read(analytics)
+	primaryAfter, secondariesAfter := queriesServed()
+	if secondariesAfter-secondariesBefore < reads {
+		t.Fatalf("secondaries served %d of %d secondaryPreferred reads", secondariesAfter-secondariesBefore, reads)
+	}
+	if primaryAfter-primaryBefore >= reads {
+		t.Fatalf("primary served %d queries during %d secondaryPreferred reads", primaryAfter-primaryBefore, reads)
+	}
+
+	primaryBefore, _ = queriesServed()
+	read(s)
+	primaryAfter, _ = queriesServed()
+	if primaryAfter-primaryBefore < reads {
+		t.Fatalf("primary served %d of %d reads of the default store", primaryAfter-primaryBefore, reads)
+	}
+}
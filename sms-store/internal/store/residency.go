@@ -0,0 +1,586 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+// ErrRegionNotAllowed is wrapped by the *RegionError the region-scoped
+// stores return for data of a region the deployment doesn't serve.
+var ErrRegionNotAllowed = errors.New("data region not allowed")
+
+// RegionError describes a read or write refused for the data residency
+// region of its data.
+type RegionError struct {
+	Region  string   `json:"region"`
+	Allowed []string `json:"allowedRegions"`
+}
+
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("region %s is not one of %s: %v", e.Region, strings.Join(e.Allowed, ", "), ErrRegionNotAllowed)
+}
+
+func (e *RegionError) Unwrap() error {
+	return ErrRegionNotAllowed
+}
+
+var regionRejections = metrics.NewCounterVec(
+	"store_region_rejected_messages_total",
+	"Messages not stored because their account's data region is not served by this deployment.",
+	"operation",
+)
+
+// Residency is the data residency configuration of a deployment: the
+// regions whose data it serves, and the region each account's data is
+// kept in.
+type Residency struct {
+	Allowed       []string          // Regions served; none disables residency
+	DefaultRegion string            // Of accounts not in Accounts, of profiles and of data stored without a region
+	Accounts      map[string]string // Region by account ID
+}
+
+// ParseResidency parses the DATA_REGIONS_ALLOWED, DATA_REGION_DEFAULT and
+// DATA_REGION_ACCOUNTS settings: comma-separated regions, the default
+// region, which is the first allowed one when empty, and comma-separated
+// account=region pairs, e.g. "acme=eu,globex=in".
+func ParseResidency(allowed, defaultRegion, accounts string) (Residency, error) {
+	var r Residency
+	for _, region := range strings.Split(allowed, ",") {
+		if region = strings.TrimSpace(region); region != "" && !slices.Contains(r.Allowed, region) {
+			r.Allowed = append(r.Allowed, region)
+		}
+	}
+	if len(r.Allowed) == 0 {
+		return Residency{}, nil
+	}
+	r.DefaultRegion = strings.TrimSpace(defaultRegion)
+	if r.DefaultRegion == "" {
+		r.DefaultRegion = r.Allowed[0]
+	}
+
+	r.Accounts = make(map[string]string)
+	for _, entry := range strings.Split(accounts, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		account, region, ok := strings.Cut(entry, "=")
+		account, region = strings.TrimSpace(account), strings.TrimSpace(region)
+		if !ok || account == "" {
+			return Residency{}, errors.New("account entries must look like account=region")
+		}
+		if region == "" {
+			return Residency{}, fmt.Errorf("region of account %s must not be empty", account)
+		}
+		r.Accounts[account] = region
+	}
+	return r, nil
+}
+
+// Enabled reports whether r restricts the data served to some regions.
+func (r Residency) Enabled() bool {
+	return len(r.Allowed) > 0
+}
+
+// RegionOf returns the region of accountID's data.
+func (r Residency) RegionOf(accountID string) string {
+	if accountID == "" {
+		accountID = models.DefaultAccountID
+	}
+	if region, ok := r.Accounts[accountID]; ok {
+		return region
+	}
+	return r.DefaultRegion
+}
+
+// Allows reports whether data of region is served. Data stored without a
+// region is in the default region.
+func (r Residency) Allows(region string) bool {
+	return slices.Contains(r.Allowed, r.dataRegion(region))
+}
+
+// scope returns the regions a query is restricted to, with "" for the
+// data stored without a region when the default region is served.
+func (r Residency) scope() []string {
+	regions := slices.Clone(r.Allowed)
+	if r.Allows("") {
+		regions = append(regions, "")
+	}
+	return regions
+}
+
+// refuse returns the error of data of region.
+func (r Residency) refuse(region string) error {
+	return &RegionError{Region: r.dataRegion(region), Allowed: r.Allowed}
+}
+
+// check returns the error of data of region unless it is served.
+func (r Residency) check(region string) error {
+	if r.Allows(region) {
+		return nil
+	}
+	return r.refuse(region)
+}
+
+func (r Residency) dataRegion(region string) string {
+	if region == "" {
+		return r.DefaultRegion
+	}
+	return region
+}
+
+// filterMessages keeps the messages of regions r serves, in place.
+func (r Residency) filterMessages(msgs []models.Message) []models.Message {
+	return slices.DeleteFunc(msgs, func(msg models.Message) bool {
+		return !r.Allows(msg.Region)
+	})
+}
+
+// outside returns a page of one message of the regions r doesn't serve.
+func (r Residency) outside() PageQuery {
+	return PageQuery{Limit: 1, Regions: r.scope(), OutsideRegions: true}
+}
+
+// RegionScopedStore wraps a Store so a deployment only serves the data of
+// the regions its Residency allows. Every message is stamped with its
+// account's region as it is stored, and one of a region not served is
+// rejected. Pages and queries are restricted to the regions served, and
+// reads without a region filter of their own drop the messages of others.
+// Reads and writes of one message, and aggregates of a conversation or of
+// the whole store, which can't leave messages out, fail with a
+// *RegionError if they would touch data of another region.
+//
+// Every method of Store is scoped here, so a read never reaches the
+// wrapped store unscoped. Unscoped is for admin requests that override
+// residency.
+type RegionScopedStore struct {
+	Store
+	residency Residency
+}
+
+// NewRegionScopedStore wraps s, serving the regions r allows.
+func NewRegionScopedStore(s Store, r Residency) *RegionScopedStore {
+	return &RegionScopedStore{Store: s, residency: r}
+}
+
+// Unscoped returns the wrapped store, which serves every region.
+func (s *RegionScopedStore) Unscoped() Store {
+	return s.Store
+}
+
+// Unscoped returns the store s wraps when it is a RegionScopedStore, and
+// s otherwise.
+func Unscoped(s Store) Store {
+	if scoped, ok := s.(*RegionScopedStore); ok {
+		return scoped.Unscoped()
+	}
+	return s
+}
+
+// Save stamps msg with its account's region and stores it, unless the
+// region is not served.
+func (s *RegionScopedStore) Save(msg models.Message) (models.Message, error) {
+	msg.Region = s.residency.RegionOf(msg.AccountID)
+	if err := s.residency.check(msg.Region); err != nil {
+		regionRejections.WithLabelValues("save").Inc()
+		return models.Message{}, err
+	}
+	return s.Store.Save(msg)
+}
+
+// SaveBatch stamps msgs with their accounts' regions and stores them,
+// dropping those of regions not served. Dropped messages are not counted
+// as saved.
+func (s *RegionScopedStore) SaveBatch(msgs []models.Message) (int, error) {
+	kept := make([]models.Message, 0, len(msgs))
+	dropped := make(map[string]int)
+	for _, msg := range msgs {
+		msg.Region = s.residency.RegionOf(msg.AccountID)
+		if !s.residency.Allows(msg.Region) {
+			dropped[msg.Region]++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	for region, n := range dropped {
+		regionRejections.WithLabelValues("save_batch").Add(uint64(n))
+		log.Printf("Dropped %d message(s) of region %s, which this deployment doesn't serve", n, region)
+	}
+	if len(kept) == 0 {
+		return 0, nil
+	}
+	return s.Store.SaveBatch(kept)
+}
+
+func (s *RegionScopedStore) FindByPhoneNumber(phoneNumber string) ([]models.Message, error) {
+	msgs, err := s.Store.FindByPhoneNumber(phoneNumber)
+	return s.residency.filterMessages(msgs), err
+}
+
+func (s *RegionScopedStore) FindByID(id string) (models.Message, error) {
+	msg, err := s.Store.FindByID(id)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if err := s.residency.check(msg.Region); err != nil {
+		return models.Message{}, err
+	}
+	return msg, nil
+}
+
+func (s *RegionScopedStore) FindByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	return s.Store.FindByPhoneNumberPage(phoneNumber, s.scoped(page))
+}
+
+func (s *RegionScopedStore) FindByConversationPage(conversationID string, page PageQuery) ([]models.Message, error) {
+	return s.Store.FindByConversationPage(conversationID, s.scoped(page))
+}
+
+func (s *RegionScopedStore) ListPage(page PageQuery) ([]models.Message, error) {
+	return s.Store.ListPage(s.scoped(page))
+}
+
+func (s *RegionScopedStore) CountMessages(senderID string) (int64, error) {
+	if err := s.checkAll(); err != nil {
+		return 0, err
+	}
+	return s.Store.CountMessages(senderID)
+}
+
+func (s *RegionScopedStore) CountByAccount(phoneNumber string) (map[string]int64, error) {
+	if err := s.checkScope(phoneNumber); err != nil {
+		return nil, err
+	}
+	return s.Store.CountByAccount(phoneNumber)
+}
+
+func (s *RegionScopedStore) CountByParticipant(phoneNumber string) ([]ParticipantCount, error) {
+	if err := s.checkConversation(phoneNumber); err != nil {
+		return nil, err
+	}
+	return s.Store.CountByParticipant(phoneNumber)
+}
+
+// CountAfter checks each conversation of after, one query each.
+func (s *RegionScopedStore) CountAfter(after map[string]time.Time) (map[string]int64, error) {
+	for pn := range after {
+		if err := s.checkConversation(pn); err != nil {
+			return nil, err
+		}
+	}
+	return s.Store.CountAfter(after)
+}
+
+// SearchMessages drops the matches of other regions, so it may return
+// fewer than limit messages while more match.
+func (s *RegionScopedStore) SearchMessages(query string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	msgs, err := s.Store.SearchMessages(query, ref, limit)
+	return s.residency.filterMessages(msgs), err
+}
+
+// SearchMessagePrefixes drops the matches of other regions, like
+// SearchMessages.
+func (s *RegionScopedStore) SearchMessagePrefixes(tokens []string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	msgs, err := s.Store.SearchMessagePrefixes(tokens, ref, limit)
+	return s.residency.filterMessages(msgs), err
+}
+
+// SetSearchTokens checks every message of tokens, one lookup each, and
+// sets none of them if one is of another region.
+func (s *RegionScopedStore) SetSearchTokens(tokens map[string][]string) (int64, error) {
+	for id := range tokens {
+		if err := s.checkID(id); err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+	}
+	return s.Store.SetSearchTokens(tokens)
+}
+
+func (s *RegionScopedStore) DailyDigest(phoneNumber string, q DigestQuery) ([]DailyBucket, error) {
+	if err := s.checkConversation(phoneNumber); err != nil {
+		return nil, err
+	}
+	return s.Store.DailyDigest(phoneNumber, q)
+}
+
+func (s *RegionScopedStore) CostSummary(q CostQuery) ([]CostBucket, error) {
+	if err := s.checkAll(); err != nil {
+		return nil, err
+	}
+	return s.Store.CostSummary(q)
+}
+
+func (s *RegionScopedStore) List() ([]models.Message, error) {
+	msgs, err := s.Store.List()
+	return s.residency.filterMessages(msgs), err
+}
+
+func (s *RegionScopedStore) DeleteAll() (int64, error) {
+	if err := s.checkAll(); err != nil {
+		return 0, err
+	}
+	return s.Store.DeleteAll()
+}
+
+func (s *RegionScopedStore) Count() (int64, error) {
+	if err := s.checkAll(); err != nil {
+		return 0, err
+	}
+	return s.Store.Count()
+}
+
+func (s *RegionScopedStore) DeleteAllBatch(limit int) (int64, error) {
+	if err := s.checkAll(); err != nil {
+		return 0, err
+	}
+	return s.Store.DeleteAllBatch(limit)
+}
+
+func (s *RegionScopedStore) DropAll() (int64, error) {
+	if err := s.checkAll(); err != nil {
+		return 0, err
+	}
+	return s.Store.DropAll()
+}
+
+func (s *RegionScopedStore) GetDistinctPhoneNumbers() ([]string, error) {
+	if err := s.checkAll(); err != nil {
+		return nil, err
+	}
+	return s.Store.GetDistinctPhoneNumbers()
+}
+
+func (s *RegionScopedStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	if err := s.checkConversation(phoneNumber); err != nil {
+		return 0, err
+	}
+	return s.Store.DeleteByPhoneNumber(phoneNumber)
+}
+
+func (s *RegionScopedStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	if err := s.checkID(id); err != nil {
+		return models.Message{}, err
+	}
+	return s.Store.UpdateMessage(id, patch)
+}
+
+func (s *RegionScopedStore) AddReaction(id string, reaction models.Reaction) (models.Message, error) {
+	if err := s.checkID(id); err != nil {
+		return models.Message{}, err
+	}
+	return s.Store.AddReaction(id, reaction)
+}
+
+func (s *RegionScopedStore) RemoveReaction(id, emoji, actor string) (models.Message, error) {
+	if err := s.checkID(id); err != nil {
+		return models.Message{}, err
+	}
+	return s.Store.RemoveReaction(id, emoji, actor)
+}
+
+func (s *RegionScopedStore) SetAnnotation(id string, annotation models.Annotation) (models.Message, error) {
+	if err := s.checkID(id); err != nil {
+		return models.Message{}, err
+	}
+	return s.Store.SetAnnotation(id, annotation)
+}
+
+func (s *RegionScopedStore) ReviewAnnotation(id, source string, review models.AnnotationReview) (models.Message, error) {
+	if err := s.checkID(id); err != nil {
+		return models.Message{}, err
+	}
+	return s.Store.ReviewAnnotation(id, source, review)
+}
+
+func (s *RegionScopedStore) SetTranslation(id string, translation models.Translation, overwrite bool) (models.Message, error) {
+	if err := s.checkID(id); err != nil {
+		return models.Message{}, err
+	}
+	return s.Store.SetTranslation(id, translation, overwrite)
+}
+
+func (s *RegionScopedStore) CountAnnotations(phoneNumber string) ([]AnnotationCount, error) {
+	if err := s.checkConversation(phoneNumber); err != nil {
+		return nil, err
+	}
+	return s.Store.CountAnnotations(phoneNumber)
+}
+
+// scoped restricts page to the regions served.
+func (s *RegionScopedStore) scoped(page PageQuery) PageQuery {
+	page.Regions = s.residency.scope()
+	page.OutsideRegions = false
+	return page
+}
+
+// checkID returns the error of the message with id if it is of another
+// region, looking it up first.
+func (s *RegionScopedStore) checkID(id string) error {
+	_, err := s.FindByID(id)
+	return err
+}
+
+// checkConversation returns the error of phoneNumber's conversation if it
+// holds a message of another region.
+func (s *RegionScopedStore) checkConversation(phoneNumber string) error {
+	foreign, err := s.Store.FindByPhoneNumberPage(phoneNumber, s.residency.outside())
+	if err != nil {
+		return err
+	}
+	if len(foreign) > 0 {
+		return s.residency.refuse(foreign[0].Region)
+	}
+	return nil
+}
+
+// checkAll returns the error of the whole store if it holds a message of
+// another region.
+func (s *RegionScopedStore) checkAll() error {
+	foreign, err := s.Store.ListPage(s.residency.outside())
+	if err != nil {
+		return err
+	}
+	if len(foreign) > 0 {
+		return s.residency.refuse(foreign[0].Region)
+	}
+	return nil
+}
+
+// checkScope checks phoneNumber's conversation, or the whole store when
+// it is empty.
+func (s *RegionScopedStore) checkScope(phoneNumber string) error {
+	if phoneNumber == "" {
+		return s.checkAll()
+	}
+	return s.checkConversation(phoneNumber)
+}
+
+// RegionScopedQuerier wraps a MessageQuerier so its queries are restricted
+// to the regions a Residency allows.
+type RegionScopedQuerier struct {
+	MessageQuerier
+	residency Residency
+}
+
+// NewRegionScopedQuerier wraps q, serving the regions r allows.
+func NewRegionScopedQuerier(q MessageQuerier, r Residency) *RegionScopedQuerier {
+	return &RegionScopedQuerier{MessageQuerier: q, residency: r}
+}
+
+// Unscoped returns the wrapped querier, which serves every region.
+func (q *RegionScopedQuerier) Unscoped() MessageQuerier {
+	return q.MessageQuerier
+}
+
+// UnscopedQuerier returns the querier q wraps when it is a
+// RegionScopedQuerier, and q otherwise.
+func UnscopedQuerier(q MessageQuerier) MessageQuerier {
+	if scoped, ok := q.(*RegionScopedQuerier); ok {
+		return scoped.Unscoped()
+	}
+	return q
+}
+
+func (q *RegionScopedQuerier) QueryMessages(ctx context.Context, mq MessageQuery, batchSize int, fn func([]models.Message) error) error {
+	mq.Regions = q.residency.scope()
+	mq.OutsideRegions = false
+	return q.MessageQuerier.QueryMessages(ctx, mq, batchSize, fn)
+}
+
+// RegionScopedArchiver wraps an Archiver like RegionScopedStore wraps a
+// Store. Archiving itself moves messages as they are, keeping their
+// region, so it is not scoped.
+type RegionScopedArchiver struct {
+	Archiver
+	live      Store
+	residency Residency
+}
+
+// NewRegionScopedArchiver wraps a, which archives the messages of live,
+// serving the regions r allows.
+func NewRegionScopedArchiver(a Archiver, live Store, r Residency) *RegionScopedArchiver {
+	return &RegionScopedArchiver{Archiver: a, live: Unscoped(live), residency: r}
+}
+
+func (a *RegionScopedArchiver) FindArchivedByPhoneNumber(phoneNumber string) ([]models.Message, error) {
+	msgs, err := a.Archiver.FindArchivedByPhoneNumber(phoneNumber)
+	return a.residency.filterMessages(msgs), err
+}
+
+func (a *RegionScopedArchiver) FindArchivedByID(id string) (models.Message, error) {
+	msg, err := a.Archiver.FindArchivedByID(id)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if err := a.residency.check(msg.Region); err != nil {
+		return models.Message{}, err
+	}
+	return msg, nil
+}
+
+func (a *RegionScopedArchiver) FindArchivedByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	page.Regions = a.residency.scope()
+	page.OutsideRegions = false
+	return a.Archiver.FindArchivedByPhoneNumberPage(phoneNumber, page)
+}
+
+// GetArchivedPhoneNumbers checks every archived conversation, one query
+// each.
+func (a *RegionScopedArchiver) GetArchivedPhoneNumbers() ([]string, error) {
+	numbers, err := a.Archiver.GetArchivedPhoneNumbers()
+	if err != nil {
+		return nil, err
+	}
+	for _, pn := range numbers {
+		if err := a.checkArchived(pn); err != nil {
+			return nil, err
+		}
+	}
+	return numbers, nil
+}
+
+// ConversationCounts checks the live and archived messages of every
+// conversation, two queries each.
+func (a *RegionScopedArchiver) ConversationCounts(phoneNumbers []string) (map[string]ConversationCount, error) {
+	for _, pn := range phoneNumbers {
+		foreign, err := a.live.FindByPhoneNumberPage(pn, a.residency.outside())
+		if err != nil {
+			return nil, err
+		}
+		if len(foreign) > 0 {
+			return nil, a.residency.refuse(foreign[0].Region)
+		}
+		if err := a.checkArchived(pn); err != nil {
+			return nil, err
+		}
+	}
+	return a.Archiver.ConversationCounts(phoneNumbers)
+}
+
+func (a *RegionScopedArchiver) DeleteArchivedByPhoneNumber(phoneNumber string) (int64, error) {
+	if err := a.checkArchived(phoneNumber); err != nil {
+		return 0, err
+	}
+	return a.Archiver.DeleteArchivedByPhoneNumber(phoneNumber)
+}
+
+// checkArchived returns the error of phoneNumber's archived conversation
+// if it holds a message of another region.
+func (a *RegionScopedArchiver) checkArchived(phoneNumber string) error {
+	foreign, err := a.Archiver.FindArchivedByPhoneNumberPage(phoneNumber, a.residency.outside())
+	if err != nil {
+		return err
+	}
+	if len(foreign) > 0 {
+		return a.residency.refuse(foreign[0].Region)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// RegionScopedProfileStore wraps a ProfileStore like RegionScopedStore
+// wraps a Store. Profiles belong to no account, so they are stamped with
+// the default region as they are created. Profiles stored without one are
+// in the default region.
+type RegionScopedProfileStore struct {
+	ProfileStore
+	residency Residency
+}
+
+// NewRegionScopedProfileStore wraps ps, serving the regions r allows.
+func NewRegionScopedProfileStore(ps ProfileStore, r Residency) *RegionScopedProfileStore {
+	return &RegionScopedProfileStore{ProfileStore: ps, residency: r}
+}
+
+func (s *RegionScopedProfileStore) GetProfile(phoneNumber string) (models.Profile, error) {
+	profile, err := s.ProfileStore.GetProfile(phoneNumber)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	if err := s.residency.check(profile.Region); err != nil {
+		return models.Profile{}, err
+	}
+	return profile, nil
+}
+
+func (s *RegionScopedProfileStore) UpdateProfile(phoneNumber string, profile models.Profile) (models.Profile, error) {
+	if _, err := s.GetProfile(phoneNumber); err != nil {
+		return models.Profile{}, err
+	}
+	return s.ProfileStore.UpdateProfile(phoneNumber, profile)
+}
+
+func (s *RegionScopedProfileStore) UpdateProfileIfVersion(phoneNumber string, profile models.Profile, version int64) (models.Profile, error) {
+	if _, err := s.GetProfile(phoneNumber); err != nil {
+		return models.Profile{}, err
+	}
+	return s.ProfileStore.UpdateProfileIfVersion(phoneNumber, profile, version)
+}
+
+func (s *RegionScopedProfileStore) CreateProfile(profile models.Profile) (models.Profile, error) {
+	profile.Region = s.residency.DefaultRegion
+	if err := s.residency.check(profile.Region); err != nil {
+		return models.Profile{}, err
+	}
+	return s.ProfileStore.CreateProfile(profile)
+}
+
+// EnsureProfile refuses the number's existing profile if it is of another
+// region.
+func (s *RegionScopedProfileStore) EnsureProfile(profile models.Profile) (models.Profile, bool, error) {
+	profile.Region = s.residency.DefaultRegion
+	if err := s.residency.check(profile.Region); err != nil {
+		return models.Profile{}, false, err
+	}
+	ensured, created, err := s.ProfileStore.EnsureProfile(profile)
+	if err != nil {
+		return models.Profile{}, false, err
+	}
+	if err := s.residency.check(ensured.Region); err != nil {
+		return models.Profile{}, false, err
+	}
+	return ensured, created, nil
+}
+
+// SearchProfiles drops the matches of other regions, so it may return
+// fewer than limit profiles while more match.
+func (s *RegionScopedProfileStore) SearchProfiles(query string, limit int) ([]models.Profile, error) {
+	profiles, err := s.ProfileStore.SearchProfiles(query, limit)
+	return slices.DeleteFunc(profiles, func(p models.Profile) bool {
+		return !s.residency.Allows(p.Region)
+	}), err
+}
+
+// GetProfiles leaves the profiles of other regions out, as if the numbers
+// had none.
+func (s *RegionScopedProfileStore) GetProfiles(phoneNumbers []string) (map[string]models.Profile, error) {
+	profiles, err := s.ProfileStore.GetProfiles(phoneNumbers)
+	maps.DeleteFunc(profiles, func(_ string, p models.Profile) bool {
+		return !s.residency.Allows(p.Region)
+	})
+	return profiles, err
+}
+
+func (s *RegionScopedProfileStore) DeleteProfile(phoneNumber string) error {
+	if _, err := s.GetProfile(phoneNumber); err != nil {
+		return err
+	}
+	return s.ProfileStore.DeleteProfile(phoneNumber)
+}
+
+func (s *RegionScopedProfileStore) RedirectProfile(phoneNumber, movedTo string) (models.Profile, error) {
+	if _, err := s.GetProfile(phoneNumber); err != nil {
+		return models.Profile{}, err
+	}
+	return s.ProfileStore.RedirectProfile(phoneNumber, movedTo)
+}
+
+// RegionScopedAutoProfileLister wraps an AutoProfileLister so it only
+// lists the profiles of the regions a Residency allows.
+type RegionScopedAutoProfileLister struct {
+	AutoProfileLister
+	residency Residency
+}
+
+// NewRegionScopedAutoProfileLister wraps l, serving the regions r allows.
+func NewRegionScopedAutoProfileLister(l AutoProfileLister, r Residency) *RegionScopedAutoProfileLister {
+	return &RegionScopedAutoProfileLister{AutoProfileLister: l, residency: r}
+}
+
+// ListAutoProfiles reads pages until it has limit profiles of the regions
+// served or the profiles run out, so a short page still means the last.
+func (l *RegionScopedAutoProfileLister) ListAutoProfiles(createdBefore time.Time, after string, limit int) ([]models.Profile, error) {
+	kept := []models.Profile{}
+	for {
+		batch, err := l.AutoProfileLister.ListAutoProfiles(createdBefore, after, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range batch {
+			if l.residency.Allows(p.Region) {
+				kept = append(kept, p)
+			}
+		}
+		// Profiles past the limit are listed again after the last one kept
+		if len(kept) >= limit || len(batch) < limit {
+			return kept[:min(len(kept), limit)], nil
+		}
+		after = batch[len(batch)-1].PhoneNumber
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"slices"
+	"time"
+)
+
+// RegionScopedSummaryStore wraps a SummaryStore like RegionScopedStore
+// wraps a Store. Summaries have no region of their own, so one is of
+// another region when its conversation holds a message of one, which is
+// checked on the live messages, one query each. Reads leave those
+// summaries out, and changes to them fail with a *RegionError.
+//
+// Folding in messages, rebuilds and auto-ack claims are left unscoped:
+// they are driven by messages the region-scoped store already accepted.
+type RegionScopedSummaryStore struct {
+	SummaryStore
+	live      Store
+	residency Residency
+}
+
+// NewRegionScopedSummaryStore wraps ss, which summarizes the messages of
+// live, serving the regions r allows.
+func NewRegionScopedSummaryStore(ss SummaryStore, live Store, r Residency) *RegionScopedSummaryStore {
+	return &RegionScopedSummaryStore{SummaryStore: ss, live: Unscoped(live), residency: r}
+}
+
+// GetSummaries leaves the summaries of other regions out, as if the
+// numbers had none.
+func (s *RegionScopedSummaryStore) GetSummaries(phoneNumbers []string) (map[string]ConversationSummary, error) {
+	summaries, err := s.SummaryStore.GetSummaries(phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	return s.filterMap(summaries)
+}
+
+// SampleSummaries drops the summaries of other regions, so it may return
+// fewer than n while more are stored.
+func (s *RegionScopedSummaryStore) SampleSummaries(n int) ([]ConversationSummary, error) {
+	summaries, err := s.SummaryStore.SampleSummaries(n)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(summaries)
+}
+
+func (s *RegionScopedSummaryStore) ComputeSummaries(phoneNumbers []string) (map[string]ConversationSummary, error) {
+	summaries, err := s.SummaryStore.ComputeSummaries(phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+	return s.filterMap(summaries)
+}
+
+// CreateEmptySummary refuses a conversation that already holds messages of
+// another region.
+func (s *RegionScopedSummaryStore) CreateEmptySummary(phoneNumber string, at time.Time) (ConversationSummary, bool, error) {
+	if err := s.checkConversation(phoneNumber); err != nil {
+		return ConversationSummary{}, false, err
+	}
+	return s.SummaryStore.CreateEmptySummary(phoneNumber, at)
+}
+
+func (s *RegionScopedSummaryStore) SetState(phoneNumber string, from string, change StateChange) (ConversationSummary, bool, error) {
+	if err := s.checkConversation(phoneNumber); err != nil {
+		return ConversationSummary{}, false, err
+	}
+	return s.SummaryStore.SetState(phoneNumber, from, change)
+}
+
+func (s *RegionScopedSummaryStore) SetAttributes(phoneNumber string, set map[string]any, unset []string) (ConversationSummary, error) {
+	if err := s.checkConversation(phoneNumber); err != nil {
+		return ConversationSummary{}, err
+	}
+	return s.SummaryStore.SetAttributes(phoneNumber, set, unset)
+}
+
+// FindByAttributes leaves the conversations of other regions out.
+func (s *RegionScopedSummaryStore) FindByAttributes(filter map[string]any) ([]string, error) {
+	phoneNumbers, err := s.SummaryStore.FindByAttributes(filter)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		foreign, err := s.foreign(pn)
+		if err != nil {
+			return nil, err
+		}
+		if !foreign {
+			kept = append(kept, pn)
+		}
+	}
+	return kept, nil
+}
+
+// ListChangedSummaries reads pages until it has q.Limit summaries of the
+// regions served or the changes run out, so a short page still means the
+// last.
+func (s *RegionScopedSummaryStore) ListChangedSummaries(q ChangeQuery) ([]ConversationSummary, error) {
+	kept := []ConversationSummary{}
+	for {
+		batch, err := s.SummaryStore.ListChangedSummaries(q)
+		if err != nil {
+			return nil, err
+		}
+		allowed, err := s.filter(slices.Clone(batch))
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, allowed...)
+		// Summaries past the limit are listed again after the last one kept
+		if q.Limit <= 0 || len(kept) >= q.Limit || len(batch) < q.Limit {
+			if q.Limit > 0 {
+				kept = kept[:min(len(kept), q.Limit)]
+			}
+			return kept, nil
+		}
+		last := batch[len(batch)-1]
+		q.After, q.AfterPhoneNumber = last.UpdatedAt, last.PhoneNumber
+	}
+}
+
+// ListSummaries reads pages until it has limit summaries of the regions
+// served or the conversations run out, like ListChangedSummaries.
+func (s *RegionScopedSummaryStore) ListSummaries(afterPhoneNumber string, limit int) ([]ConversationSummary, error) {
+	kept := []ConversationSummary{}
+	for {
+		batch, err := s.SummaryStore.ListSummaries(afterPhoneNumber, limit)
+		if err != nil {
+			return nil, err
+		}
+		allowed, err := s.filter(slices.Clone(batch))
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, allowed...)
+		if limit <= 0 || len(kept) >= limit || len(batch) < limit {
+			if limit > 0 {
+				kept = kept[:min(len(kept), limit)]
+			}
+			return kept, nil
+		}
+		afterPhoneNumber = batch[len(batch)-1].PhoneNumber
+	}
+}
+
+// filter keeps the summaries of the regions served, in place.
+func (s *RegionScopedSummaryStore) filter(summaries []ConversationSummary) ([]ConversationSummary, error) {
+	kept := summaries[:0]
+	for _, summary := range summaries {
+		foreign, err := s.foreign(summary.PhoneNumber)
+		if err != nil {
+			return nil, err
+		}
+		if !foreign {
+			kept = append(kept, summary)
+		}
+	}
+	return kept, nil
+}
+
+// filterMap deletes the summaries of other regions from summaries.
+func (s *RegionScopedSummaryStore) filterMap(summaries map[string]ConversationSummary) (map[string]ConversationSummary, error) {
+	for pn := range summaries {
+		foreign, err := s.foreign(pn)
+		if err != nil {
+			return nil, err
+		}
+		if foreign {
+			delete(summaries, pn)
+		}
+	}
+	return summaries, nil
+}
+
+// foreign reports whether phoneNumber's conversation holds a message of
+// another region.
+func (s *RegionScopedSummaryStore) foreign(phoneNumber string) (bool, error) {
+	msgs, err := s.live.FindByPhoneNumberPage(phoneNumber, s.residency.outside())
+	return len(msgs) > 0, err
+}
+
+// checkConversation returns the error of phoneNumber's conversation if it
+// holds a message of another region.
+func (s *RegionScopedSummaryStore) checkConversation(phoneNumber string) error {
+	msgs, err := s.live.FindByPhoneNumberPage(phoneNumber, s.residency.outside())
+	if err != nil {
+		return err
+	}
+	if len(msgs) > 0 {
+		return s.residency.refuse(msgs[0].Region)
+	}
+	return nil
+}
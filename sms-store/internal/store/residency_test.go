@@ -0,0 +1,327 @@
+package store_test
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// testResidency serves region in, the default, and keeps the data of
+// account acme in eu.
+var testResidency = store.Residency{
+	Allowed:       []string{"in"},
+	DefaultRegion: "in",
+	Accounts:      map[string]string{"acme": "eu"},
+}
+
+// newMixedRegionStore returns a RegionScopedStore over a memory store
+// already holding messages of both regions, as a store shared with a
+// deployment serving eu would: 1111111111 has in1 and in2 of region in
+// (in1 stored before regions were), 2222222222 has eu1 of eu, and
+// 3333333333 has in3 of in and eu2 of eu.
+func newMixedRegionStore(t *testing.T) (*store.RegionScopedStore, store.Store) {
+	t.Helper()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	inner := store.NewMemoryStore()
+	for i, msg := range []models.Message{
+		{ID: "in1", PhoneNumber: "1111111111", Text: "hello"},
+		{ID: "in2", PhoneNumber: "1111111111", Text: "hello again", Region: "in"},
+		{ID: "eu1", PhoneNumber: "2222222222", Text: "hello", AccountID: "acme", Region: "eu"},
+		{ID: "in3", PhoneNumber: "3333333333", Text: "hello", Region: "in"},
+		{ID: "eu2", PhoneNumber: "3333333333", Text: "hello", AccountID: "acme", Region: "eu"},
+	} {
+		msg.Status = "SUCCESS"
+		msg.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if _, err := inner.Save(msg); err != nil {
+			t.Fatalf("Save %s: %v", msg.ID, err)
+		}
+	}
+	return store.NewRegionScopedStore(inner, testResidency), inner
+}
+
+// assertRegionError fails unless err is the *RegionError of region.
+func assertRegionError(t *testing.T, op string, err error, region string) {
+	t.Helper()
+	var regionErr *store.RegionError
+	if !errors.As(err, &regionErr) || !errors.Is(err, store.ErrRegionNotAllowed) {
+		t.Fatalf("%s: err = %v, want a *RegionError", op, err)
+	}
+	if regionErr.Region != region || !slices.Equal(regionErr.Allowed, testResidency.Allowed) {
+		t.Fatalf("%s: RegionError = %+v, want region %s of allowed %v", op, regionErr, region, testResidency.Allowed)
+	}
+}
+
+func TestRegionScopedStoreStampsAndRejectsWrites(t *testing.T) {
+	s, inner := newMixedRegionStore(t)
+
+	saved, err := s.Save(models.Message{ID: "new", PhoneNumber: "1111111111", Text: "hi", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if saved.Region != "in" {
+		t.Fatalf("Save stamped region %q, want in", saved.Region)
+	}
+	// The region is the account's, whatever the message claims
+	_, err = s.Save(models.Message{ID: "foreign", PhoneNumber: "1111111111", AccountID: "acme", Region: "in", CreatedAt: time.Now()})
+	assertRegionError(t, "Save of an eu account's message", err, "eu")
+	if _, err := inner.FindByID("foreign"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("refused message was stored: err = %v", err)
+	}
+
+	n, err := s.SaveBatch([]models.Message{
+		{ID: "b1", PhoneNumber: "4444444444", CreatedAt: time.Now()},
+		{ID: "b2", PhoneNumber: "4444444444", AccountID: "acme", CreatedAt: time.Now()},
+		{ID: "b3", PhoneNumber: "4444444444", AccountID: "globex", CreatedAt: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("SaveBatch: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("SaveBatch = %d, want the 2 messages of region in", n)
+	}
+	stored, err := inner.FindByPhoneNumber("4444444444")
+	if err != nil {
+		t.Fatalf("FindByPhoneNumber: %v", err)
+	}
+	for _, msg := range stored {
+		if msg.ID == "b2" || msg.Region != "in" {
+			t.Fatalf("SaveBatch stored %s of region %q", msg.ID, msg.Region)
+		}
+	}
+	if n, err := s.SaveBatch([]models.Message{{ID: "b4", PhoneNumber: "4444444444", AccountID: "acme"}}); n != 0 || err != nil {
+		t.Fatalf("SaveBatch of only foreign messages = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestRegionScopedStoreRefusesForeignMessages(t *testing.T) {
+	s, inner := newMixedRegionStore(t)
+
+	if msg, err := s.FindByID("in1"); err != nil || msg.ID != "in1" {
+		t.Fatalf("FindByID of a message stored without a region = %+v, %v", msg, err)
+	}
+	_, err := s.FindByID("eu1")
+	assertRegionError(t, "FindByID", err, "eu")
+	if _, err := s.FindByID("nope"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("FindByID of a missing message: err = %v, want ErrNotFound", err)
+	}
+
+	status := "DELIVERED"
+	writes := map[string]func() error{
+		"UpdateMessage": func() error {
+			_, err := s.UpdateMessage("eu1", store.MessagePatch{Status: &status})
+			return err
+		},
+		"AddReaction": func() error {
+			_, err := s.AddReaction("eu1", models.Reaction{Emoji: "👍", Actor: "agent"})
+			return err
+		},
+		"RemoveReaction": func() error {
+			_, err := s.RemoveReaction("eu1", "👍", "agent")
+			return err
+		},
+		"SetAnnotation": func() error {
+			_, err := s.SetAnnotation("eu1", models.Annotation{Source: "clf", Label: "complaint", Confidence: 0.9})
+			return err
+		},
+		"ReviewAnnotation": func() error {
+			_, err := s.ReviewAnnotation("eu1", "clf", models.AnnotationReview{Reviewer: "agent", Decision: models.AnnotationConfirmed})
+			return err
+		},
+		"SetTranslation": func() error {
+			_, err := s.SetTranslation("eu1", models.Translation{Language: "hi", Text: "namaste"}, false)
+			return err
+		},
+		"SetSearchTokens": func() error {
+			_, err := s.SetSearchTokens(map[string][]string{"in1": {"hello"}, "eu1": {"hello"}})
+			return err
+		},
+	}
+	for op, write := range writes {
+		assertRegionError(t, op, write(), "eu")
+	}
+	untouched, err := inner.FindByID("eu1")
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if untouched.Status != "SUCCESS" || len(untouched.Reactions) > 0 || len(untouched.Annotations) > 0 || len(untouched.Translations) > 0 || len(untouched.SearchTokens) > 0 {
+		t.Fatalf("refused writes changed the eu message: %+v", untouched)
+	}
+}
+
+func TestRegionScopedStoreFiltersAndScopesReads(t *testing.T) {
+	s, _ := newMixedRegionStore(t)
+
+	mixed, err := s.FindByPhoneNumber("3333333333")
+	if err != nil || len(mixed) != 1 || mixed[0].ID != "in3" {
+		t.Fatalf("FindByPhoneNumber of a mixed conversation = %v, %v; want only in3", mixed, err)
+	}
+	page, err := s.ListPage(store.PageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListPage: %v", err)
+	}
+	for _, msg := range page {
+		if msg.Region == "eu" {
+			t.Fatalf("ListPage returned %s of region eu", msg.ID)
+		}
+	}
+	if len(page) != 3 {
+		t.Fatalf("ListPage returned %d messages, want in1, in2 and in3", len(page))
+	}
+	// A page's own region filter can't widen it
+	outside, err := s.FindByPhoneNumberPage("3333333333", store.PageQuery{Limit: 10, Regions: []string{"in", ""}, OutsideRegions: true})
+	if err != nil || len(outside) != 1 || outside[0].ID != "in3" {
+		t.Fatalf("FindByPhoneNumberPage asking outside the regions = %v, %v; want only in3", outside, err)
+	}
+	all, err := s.List()
+	if err != nil || len(all) != 3 {
+		t.Fatalf("List = %d messages, %v; want 3", len(all), err)
+	}
+	found, err := s.SearchMessages("hello", nil, 10)
+	if err != nil || len(found) != 3 {
+		t.Fatalf("SearchMessages = %d messages, %v; want 3", len(found), err)
+	}
+
+	// A conversation of region in alone is aggregated; one holding a
+	// message of eu is not
+	if counts, err := s.CountByAccount("1111111111"); err != nil || counts[models.DefaultAccountID] != 2 {
+		t.Fatalf("CountByAccount of a conversation of region in = %v, %v", counts, err)
+	}
+	_, err = s.CountByAccount("3333333333")
+	assertRegionError(t, "CountByAccount of a mixed conversation", err, "eu")
+	_, err = s.DailyDigest("3333333333", store.DigestQuery{Location: time.UTC})
+	assertRegionError(t, "DailyDigest of a mixed conversation", err, "eu")
+	_, err = s.CountAfter(map[string]time.Time{"1111111111": {}, "2222222222": {}})
+	assertRegionError(t, "CountAfter", err, "eu")
+	_, err = s.DeleteByPhoneNumber("3333333333")
+	assertRegionError(t, "DeleteByPhoneNumber of a mixed conversation", err, "eu")
+	if n, err := s.DeleteByPhoneNumber("1111111111"); err != nil || n != 2 {
+		t.Fatalf("DeleteByPhoneNumber of a conversation of region in = %d, %v; want 2", n, err)
+	}
+}
+
+// TestRegionScopedStoreRefusesStoreWideReads covers checkAll: reads and
+// deletes of the whole store fail while it holds messages of another
+// region, and succeed through Unscoped.
+func TestRegionScopedStoreRefusesStoreWideReads(t *testing.T) {
+	s, inner := newMixedRegionStore(t)
+
+	storeWide := map[string]func() error{
+		"Count":                   func() error { _, err := s.Count(); return err },
+		"CountMessages":           func() error { _, err := s.CountMessages(""); return err },
+		"CountByAccount":          func() error { _, err := s.CountByAccount(""); return err },
+		"GetDistinctPhoneNumbers": func() error { _, err := s.GetDistinctPhoneNumbers(); return err },
+		"CostSummary":             func() error { _, err := s.CostSummary(store.CostQuery{}); return err },
+		"DeleteAll":               func() error { _, err := s.DeleteAll(); return err },
+		"DeleteAllBatch":          func() error { _, err := s.DeleteAllBatch(10); return err },
+		"DropAll":                 func() error { _, err := s.DropAll(); return err },
+	}
+	for op, read := range storeWide {
+		assertRegionError(t, op, read(), "eu")
+	}
+	if n, err := inner.Count(); err != nil || n != 5 {
+		t.Fatalf("Count after the refused deletes = %d, %v; want 5", n, err)
+	}
+
+	if store.Unscoped(s) != inner {
+		t.Fatal("Unscoped did not return the wrapped store")
+	}
+	if n, err := store.Unscoped(s).Count(); err != nil || n != 5 {
+		t.Fatalf("Unscoped Count = %d, %v; want 5", n, err)
+	}
+	if store.Unscoped(inner) != inner {
+		t.Fatal("Unscoped of an unscoped store did not return it")
+	}
+
+	// Once only the served region is left, store-wide reads succeed
+	if _, err := inner.DeleteByPhoneNumber("2222222222"); err != nil {
+		t.Fatalf("DeleteByPhoneNumber: %v", err)
+	}
+	if _, err := inner.DeleteByPhoneNumber("3333333333"); err != nil {
+		t.Fatalf("DeleteByPhoneNumber: %v", err)
+	}
+	if n, err := s.Count(); err != nil || n != 2 {
+		t.Fatalf("Count of a store of region in = %d, %v; want 2", n, err)
+	}
+}
+
+// TestRegionScopedStoreOverridesEveryStoreMethod fails when a method of
+// Store reaches the wrapped store unscoped, through the embedded field,
+// because residency.go declares no method of that name on
+// *RegionScopedStore.
+func TestRegionScopedStoreOverridesEveryStoreMethod(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "residency.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parse residency.go: %v", err)
+	}
+	declared := make(map[string]bool)
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		if star, ok := fn.Recv.List[0].Type.(*ast.StarExpr); ok {
+			if recv, ok := star.X.(*ast.Ident); ok && recv.Name == "RegionScopedStore" {
+				declared[fn.Name.Name] = true
+			}
+		}
+	}
+
+	storeType := reflect.TypeOf((*store.Store)(nil)).Elem()
+	for i := range storeType.NumMethod() {
+		if name := storeType.Method(i).Name; !declared[name] {
+			t.Errorf("RegionScopedStore does not scope Store.%s", name)
+		}
+	}
+}
+
+func TestRegionScopedSummaryStoreLeavesForeignConversationsOut(t *testing.T) {
+	s, inner := newMixedRegionStore(t)
+	summaries := store.NewMemorySummaryStore(inner.(*store.MemoryStore))
+	if _, err := summaries.RebuildSummaries(nil); err != nil {
+		t.Fatalf("RebuildSummaries: %v", err)
+	}
+	scoped := store.NewRegionScopedSummaryStore(summaries, s, testResidency)
+
+	// 2222222222 only has eu1 and 3333333333 mixes in3 with eu2
+	got, err := scoped.GetSummaries([]string{"1111111111", "2222222222", "3333333333"})
+	if err != nil {
+		t.Fatalf("GetSummaries: %v", err)
+	}
+	if len(got) != 1 || got["1111111111"].MessageCount != 2 {
+		t.Fatalf("GetSummaries = %+v, want only 1111111111's", got)
+	}
+
+	// A page short of foreign summaries reads on past them
+	changed, err := scoped.ListChangedSummaries(store.ChangeQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListChangedSummaries: %v", err)
+	}
+	if len(changed) != 1 || changed[0].PhoneNumber != "1111111111" {
+		t.Fatalf("ListChangedSummaries = %+v, want only 1111111111's", changed)
+	}
+	listed, err := scoped.ListSummaries("", 2)
+	if err != nil || len(listed) != 1 || listed[0].PhoneNumber != "1111111111" {
+		t.Fatalf("ListSummaries = %+v, %v; want only 1111111111's", listed, err)
+	}
+
+	sample, err := scoped.SampleSummaries(3)
+	if err != nil || len(sample) != 1 || sample[0].PhoneNumber != "1111111111" {
+		t.Fatalf("SampleSummaries = %+v, %v; want only 1111111111's", sample, err)
+	}
+
+	_, _, err = scoped.SetState("3333333333", models.ConversationOpen, store.StateChange{State: models.ConversationClosed, At: time.Now()})
+	assertRegionError(t, "SetState of a mixed conversation", err, "eu")
+	_, err = scoped.SetAttributes("2222222222", map[string]any{"tier": "gold"}, nil)
+	assertRegionError(t, "SetAttributes of an eu conversation", err, "eu")
+	if _, _, err := scoped.SetState("1111111111", models.ConversationOpen, store.StateChange{State: models.ConversationClosed, At: time.Now()}); err != nil {
+		t.Fatalf("SetState of an in conversation: %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package store
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+var (
+	storeRetries = metrics.NewCounterVec(
+		"store_retries_total",
+		"Store calls attempted again after a transient MongoDB error, by operation.",
+		"operation",
+	)
+	storeRetriedCalls = metrics.NewCounterVec(
+		"store_retried_calls_total",
+		"Store calls that were retried, by operation and outcome: recovered once an attempt got an answer, not-found included, or exhausted when attempts or the budget ran out first.",
+		"operation", "outcome",
+	)
+)
+
+// RetryPolicy says how often and how long RetryingStore and
+// RetryingProfileStore retry a call failing with a transient error.
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts of a call, the first included; 1 or less never retries
+	BaseDelay   time.Duration // Wait before the first retry, doubled before each next one and jittered
+	MaxDelay    time.Duration // Longest wait between two attempts; 0 for no cap
+	Budget      time.Duration // No retry starts this long after the first attempt did; 0 for no limit
+}
+
+// DefaultRetryPolicy is the retry policy used unless configured otherwise.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: 50 * time.Millisecond, MaxDelay: time.Second, Budget: 2 * time.Second}
+}
+
+// IsTransient reports whether err is a MongoDB error that an identical call
+// made again may not get: a network error, such as a connection reset, or
+// one the server labels TransientTransactionError or RetryableWriteError.
+// Timeouts aren't, as the attempt already used up its time.
+func IsTransient(err error) bool {
+	if err == nil || mongo.IsTimeout(err) {
+		return false
+	}
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) &&
+		(labeled.HasErrorLabel("TransientTransactionError") || labeled.HasErrorLabel("RetryableWriteError"))
+}
+
+// retrier runs calls under a RetryPolicy.
+type retrier struct {
+	policy RetryPolicy
+
+	clock.Clocked
+}
+
+// retry calls fn until it returns an error that isn't transient, it has
+// been called policy.MaxAttempts times, or the next attempt would start
+// past policy.Budget, and returns its last result.
+//
+// Store calls take no context; each MongoDB call bounds itself with its
+// own timeout. The budget is what keeps retries within the time a request
+// has, so it should be well below the clients' timeouts.
+func retry[T any](r *retrier, op string, fn func() (T, error)) (T, error) {
+	start := r.Clock().Now()
+	delay := r.policy.BaseDelay
+	v, err := fn()
+	attempts := 1
+	for ; IsTransient(err) && attempts < r.policy.MaxAttempts; attempts++ {
+		wait := delay
+		if r.policy.MaxDelay > 0 {
+			wait = min(wait, r.policy.MaxDelay)
+		}
+		wait = jitter(wait)
+		if r.policy.Budget > 0 && r.Clock().Now().Add(wait).Sub(start) >= r.policy.Budget {
+			break
+		}
+		<-r.Clock().After(wait)
+		delay *= 2
+
+		storeRetries.WithLabelValues(op).Inc()
+		v, err = fn()
+	}
+	if attempts > 1 {
+		outcome := "recovered"
+		if IsTransient(err) {
+			outcome = "exhausted"
+		}
+		storeRetriedCalls.WithLabelValues(op, outcome).Inc()
+	}
+	return v, err
+}
+
+// jitter returns a random duration between d/2 and d, so clients failing
+// together don't all retry together.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d-d/2)
+}
+
+/* ---------- messages ---------- */
+
+// RetryingStore wraps a Store, retrying calls that fail with a transient
+// MongoDB error (see IsTransient) under a RetryPolicy. Only calls that do
+// the same whether they run once or twice are retried: reads, and writes
+// that set or delete rather than add, annotations and their reviews among
+// them. Inserts (Save, SaveBatch), reactions and the bulk admin deletes are never retried, as an attempt that failed
+// to answer may still have been applied.
+//
+// A retried delete whose first attempt was applied counts what the retry
+// deleted, which may be nothing.
+type RetryingStore struct {
+	Store
+	retrier
+}
+
+// NewRetryingStore wraps s, retrying its idempotent calls under policy.
+func NewRetryingStore(s Store, policy RetryPolicy) *RetryingStore {
+	return &RetryingStore{Store: s, retrier: retrier{policy: policy}}
+}
+
+func (s *RetryingStore) FindByPhoneNumber(phoneNumber string) ([]models.Message, error) {
+	return retry(&s.retrier, "FindByPhoneNumber", func() ([]models.Message, error) {
+		return s.Store.FindByPhoneNumber(phoneNumber)
+	})
+}
+
+func (s *RetryingStore) FindByID(id string) (models.Message, error) {
+	return retry(&s.retrier, "FindByID", func() (models.Message, error) {
+		return s.Store.FindByID(id)
+	})
+}
+
+func (s *RetryingStore) FindByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error) {
+	return retry(&s.retrier, "FindByPhoneNumberPage", func() ([]models.Message, error) {
+		return s.Store.FindByPhoneNumberPage(phoneNumber, page)
+	})
+}
+
+func (s *RetryingStore) FindByConversationPage(conversationID string, page PageQuery) ([]models.Message, error) {
+	return retry(&s.retrier, "FindByConversationPage", func() ([]models.Message, error) {
+		return s.Store.FindByConversationPage(conversationID, page)
+	})
+}
+
+func (s *RetryingStore) ListPage(page PageQuery) ([]models.Message, error) {
+	return retry(&s.retrier, "ListPage", func() ([]models.Message, error) {
+		return s.Store.ListPage(page)
+	})
+}
+
+func (s *RetryingStore) CountMessages(senderID string) (int64, error) {
+	return retry(&s.retrier, "CountMessages", func() (int64, error) {
+		return s.Store.CountMessages(senderID)
+	})
+}
+
+func (s *RetryingStore) CountByAccount(phoneNumber string) (map[string]int64, error) {
+	return retry(&s.retrier, "CountByAccount", func() (map[string]int64, error) {
+		return s.Store.CountByAccount(phoneNumber)
+	})
+}
+
+func (s *RetryingStore) CountByParticipant(phoneNumber string) ([]ParticipantCount, error) {
+	return retry(&s.retrier, "CountByParticipant", func() ([]ParticipantCount, error) {
+		return s.Store.CountByParticipant(phoneNumber)
+	})
+}
+
+func (s *RetryingStore) CountAfter(after map[string]time.Time) (map[string]int64, error) {
+	return retry(&s.retrier, "CountAfter", func() (map[string]int64, error) {
+		return s.Store.CountAfter(after)
+	})
+}
+
+func (s *RetryingStore) SearchMessages(query string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	return retry(&s.retrier, "SearchMessages", func() ([]models.Message, error) {
+		return s.Store.SearchMessages(query, ref, limit)
+	})
+}
+
+func (s *RetryingStore) SearchMessagePrefixes(tokens []string, ref *models.ExternalRef, limit int) ([]models.Message, error) {
+	return retry(&s.retrier, "SearchMessagePrefixes", func() ([]models.Message, error) {
+		return s.Store.SearchMessagePrefixes(tokens, ref, limit)
+	})
+}
+
+// SetSearchTokens is retried: it sets each message's tokens, so writing
+// them twice leaves them as writing them once.
+func (s *RetryingStore) SetSearchTokens(tokens map[string][]string) (int64, error) {
+	return retry(&s.retrier, "SetSearchTokens", func() (int64, error) {
+		return s.Store.SetSearchTokens(tokens)
+	})
+}
+
+func (s *RetryingStore) DailyDigest(phoneNumber string, q DigestQuery) ([]DailyBucket, error) {
+	return retry(&s.retrier, "DailyDigest", func() ([]DailyBucket, error) {
+		return s.Store.DailyDigest(phoneNumber, q)
+	})
+}
+
+func (s *RetryingStore) CostSummary(q CostQuery) ([]CostBucket, error) {
+	return retry(&s.retrier, "CostSummary", func() ([]CostBucket, error) {
+		return s.Store.CostSummary(q)
+	})
+}
+
+func (s *RetryingStore) List() ([]models.Message, error) {
+	return retry(&s.retrier, "List", s.Store.List)
+}
+
+func (s *RetryingStore) Count() (int64, error) {
+	return retry(&s.retrier, "Count", s.Store.Count)
+}
+
+func (s *RetryingStore) GetDistinctPhoneNumbers() ([]string, error) {
+	return retry(&s.retrier, "GetDistinctPhoneNumbers", s.Store.GetDistinctPhoneNumbers)
+}
+
+func (s *RetryingStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	return retry(&s.retrier, "DeleteByPhoneNumber", func() (int64, error) {
+		return s.Store.DeleteByPhoneNumber(phoneNumber)
+	})
+}
+
+// UpdateMessage is retried: a patch sets or removes fields, so applying it
+// twice leaves the message as applying it once.
+func (s *RetryingStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	return retry(&s.retrier, "UpdateMessage", func() (models.Message, error) {
+		return s.Store.UpdateMessage(id, patch)
+	})
+}
+
+func (s *RetryingStore) CountAnnotations(phoneNumber string) ([]AnnotationCount, error) {
+	return retry(&s.retrier, "CountAnnotations", func() ([]AnnotationCount, error) {
+		return s.Store.CountAnnotations(phoneNumber)
+	})
+}
+
+// SetAnnotation is retried: a source has one annotation per message, so
+// setting it twice leaves the message as setting it once.
+func (s *RetryingStore) SetAnnotation(id string, annotation models.Annotation) (models.Message, error) {
+	return retry(&s.retrier, "SetAnnotation", func() (models.Message, error) {
+		return s.Store.SetAnnotation(id, annotation)
+	})
+}
+
+// SetTranslation is only retried with overwrite: without it, a retry after
+// a write that did land would answer ErrAlreadyExists.
+func (s *RetryingStore) SetTranslation(id string, translation models.Translation, overwrite bool) (models.Message, error) {
+	if !overwrite {
+		return s.Store.SetTranslation(id, translation, overwrite)
+	}
+	return retry(&s.retrier, "SetTranslation", func() (models.Message, error) {
+		return s.Store.SetTranslation(id, translation, overwrite)
+	})
+}
+
+func (s *RetryingStore) ReviewAnnotation(id, source string, review models.AnnotationReview) (models.Message, error) {
+	return retry(&s.retrier, "ReviewAnnotation", func() (models.Message, error) {
+		return s.Store.ReviewAnnotation(id, source, review)
+	})
+}
+
+/* ---------- profiles ---------- */
+
+// RetryingProfileStore wraps a ProfileStore as RetryingStore does a Store.
+// Reads and EnsureProfile, an upsert, are retried. Creates, updates, which
+// count versions, and deletes and redirects, which a second attempt would
+// answer ErrNotFound or ErrProfileMoved to, are not.
+type RetryingProfileStore struct {
+	ProfileStore
+	retrier
+}
+
+// NewRetryingProfileStore wraps ps, retrying its idempotent calls under
+// policy.
+func NewRetryingProfileStore(ps ProfileStore, policy RetryPolicy) *RetryingProfileStore {
+	return &RetryingProfileStore{ProfileStore: ps, retrier: retrier{policy: policy}}
+}
+
+func (s *RetryingProfileStore) GetProfile(phoneNumber string) (models.Profile, error) {
+	return retry(&s.retrier, "GetProfile", func() (models.Profile, error) {
+		return s.ProfileStore.GetProfile(phoneNumber)
+	})
+}
+
+func (s *RetryingProfileStore) SearchProfiles(query string, limit int) ([]models.Profile, error) {
+	return retry(&s.retrier, "SearchProfiles", func() ([]models.Profile, error) {
+		return s.ProfileStore.SearchProfiles(query, limit)
+	})
+}
+
+func (s *RetryingProfileStore) GetProfiles(phoneNumbers []string) (map[string]models.Profile, error) {
+	return retry(&s.retrier, "GetProfiles", func() (map[string]models.Profile, error) {
+		return s.ProfileStore.GetProfiles(phoneNumbers)
+	})
+}
+
+// EnsureProfile is retried: it creates the profile only if the number has
+// none. A retry after an attempt that created it reports it not created.
+func (s *RetryingProfileStore) EnsureProfile(profile models.Profile) (models.Profile, bool, error) {
+	type ensured struct {
+		profile models.Profile
+		created bool
+	}
+	result, err := retry(&s.retrier, "EnsureProfile", func() (ensured, error) {
+		p, created, err := s.ProfileStore.EnsureProfile(profile)
+		return ensured{p, created}, err
+	})
+	return result.profile, result.created, err
+}
@@ -0,0 +1,222 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"sms-store/internal/clock/clocktest"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+var (
+	errConnReset = mongo.CommandError{Code: 6, Message: "connection reset by peer", Labels: []string{"NetworkError"}}
+	errRetryable = mongo.CommandError{Code: 91, Message: "shutdown in progress", Labels: []string{"RetryableWriteError"}}
+	errPermanent = errors.New("document failed validation")
+)
+
+// selfAdvancingClock is a fake clock that moves on by each wait it is asked
+// for, so retries run at once and the test can read how long they waited.
+type selfAdvancingClock struct {
+	*clocktest.Fake
+}
+
+func (c selfAdvancingClock) After(d time.Duration) <-chan time.Time {
+	ch := c.Fake.After(d)
+	c.Fake.Advance(d)
+	return ch
+}
+
+// scriptedStore answers each call with the next error of its script, then
+// with success, recording the time of each attempt.
+type scriptedStore struct {
+	store.Store
+	clock    *clocktest.Fake
+	script   []error
+	attempts []time.Time
+}
+
+func (s *scriptedStore) next() error {
+	s.attempts = append(s.attempts, s.clock.Now())
+	if len(s.script) == 0 {
+		return nil
+	}
+	err := s.script[0]
+	s.script = s.script[1:]
+	return err
+}
+
+func (s *scriptedStore) FindByID(id string) (models.Message, error) {
+	if err := s.next(); err != nil {
+		return models.Message{}, err
+	}
+	return models.Message{ID: id}, nil
+}
+
+func (s *scriptedStore) Save(msg models.Message) (models.Message, error) {
+	return msg, s.next()
+}
+
+func (s *scriptedStore) SaveBatch(msgs []models.Message) (int, error) {
+	return 0, s.next()
+}
+
+func (s *scriptedStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	return 1, s.next()
+}
+
+func newRetryingFixture(policy store.RetryPolicy, script ...error) (*scriptedStore, *store.RetryingStore, time.Time) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	fake := clocktest.NewFake(start)
+	inner := &scriptedStore{clock: fake, script: script}
+	s := store.NewRetryingStore(inner, policy)
+	s.SetClock(selfAdvancingClock{fake})
+	return inner, s, start
+}
+
+func TestRetryingStoreRecovers(t *testing.T) {
+	policy := store.RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	inner, s, start := newRetryingFixture(policy, errConnReset, errRetryable)
+	msg, err := s.FindByID("m1")
+	if err != nil || msg.ID != "m1" {
+		t.Fatalf("FindByID = %+v, %v; want the third attempt's answer", msg, err)
+	}
+	if len(inner.attempts) != 3 {
+		t.Fatalf("%d attempts, want 3", len(inner.attempts))
+	}
+	// Jittered waits of 50-100ms, then of 100-200ms
+	first, second := inner.attempts[1].Sub(start), inner.attempts[2].Sub(inner.attempts[1])
+	if first < 50*time.Millisecond || first > 100*time.Millisecond || second < 100*time.Millisecond || second > 200*time.Millisecond {
+		t.Fatalf("waited %v then %v", first, second)
+	}
+}
+
+func TestRetryingStoreGivesUp(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   store.RetryPolicy
+		script   []error
+		attempts int
+	}{
+		{"OutOfAttempts", store.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, []error{errConnReset, errConnReset, errConnReset, errConnReset}, 3},
+		{"RetriesDisabled", store.RetryPolicy{MaxAttempts: 1, BaseDelay: time.Millisecond}, []error{errConnReset}, 1},
+		{"Permanent", store.DefaultRetryPolicy(), []error{errPermanent}, 1},
+		{"NotFound", store.DefaultRetryPolicy(), []error{fmt.Errorf("message %w", store.ErrNotFound)}, 1},
+		{"Timeout", store.DefaultRetryPolicy(), []error{context.DeadlineExceeded}, 1},
+		{"NetworkTimeout", store.DefaultRetryPolicy(), []error{mongo.CommandError{Labels: []string{"NetworkError", "NetworkTimeoutError"}}}, 1},
+		{"TransientThenPermanent", store.DefaultRetryPolicy(), []error{errConnReset, errPermanent}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inner, s, _ := newRetryingFixture(tc.policy, tc.script...)
+			want := tc.script[tc.attempts-1]
+			// CommandError holds a slice, so errors.Is can't compare it
+			if _, err := s.FindByID("m1"); err == nil || err.Error() != want.Error() {
+				t.Fatalf("FindByID = %v, want %v", err, want)
+			}
+			if len(inner.attempts) != tc.attempts {
+				t.Fatalf("%d attempts, want %d", len(inner.attempts), tc.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryingStoreStaysWithinBudget(t *testing.T) {
+	policy := store.RetryPolicy{MaxAttempts: 100, BaseDelay: 100 * time.Millisecond, MaxDelay: 400 * time.Millisecond, Budget: time.Second}
+	script := make([]error, 100)
+	for i := range script {
+		script[i] = errConnReset
+	}
+	inner, s, start := newRetryingFixture(policy, script...)
+	if _, err := s.FindByID("m1"); err == nil || err.Error() != errConnReset.Error() {
+		t.Fatalf("FindByID = %v, want the last transient error", err)
+	}
+	if len(inner.attempts) < 3 || len(inner.attempts) > 12 {
+		t.Fatalf("%d attempts within the budget", len(inner.attempts))
+	}
+	for i, at := range inner.attempts {
+		if at.Sub(start) >= policy.Budget {
+			t.Fatalf("attempt %d started %v after the first, past the budget", i+1, at.Sub(start))
+		}
+		if i > 0 && at.Sub(inner.attempts[i-1]) > policy.MaxDelay {
+			t.Fatalf("waited %v before attempt %d, more than the cap", at.Sub(inner.attempts[i-1]), i+1)
+		}
+	}
+}
+
+func TestRetryingStoreNeverRetriesInserts(t *testing.T) {
+	inner, s, _ := newRetryingFixture(store.DefaultRetryPolicy(), errConnReset, errConnReset)
+	if _, err := s.Save(models.Message{ID: "m1"}); err == nil {
+		t.Fatal("Save succeeded")
+	}
+	if _, err := s.SaveBatch([]models.Message{{ID: "m2"}}); err == nil {
+		t.Fatal("SaveBatch succeeded")
+	}
+	if len(inner.attempts) != 2 {
+		t.Fatalf("%d attempts for one Save and one SaveBatch, want 2", len(inner.attempts))
+	}
+
+	// Deleting twice deletes the same, so deletes are retried
+	inner, s, _ = newRetryingFixture(store.DefaultRetryPolicy(), errConnReset)
+	if _, err := s.DeleteByPhoneNumber("1111111111"); err != nil || len(inner.attempts) != 2 {
+		t.Fatalf("DeleteByPhoneNumber = %v after %d attempts", err, len(inner.attempts))
+	}
+}
+
+// scriptedProfiles fails every call of its profile store with err.
+type scriptedProfiles struct {
+	store.ProfileStore
+	err   error
+	calls int
+}
+
+func (s *scriptedProfiles) EnsureProfile(p models.Profile) (models.Profile, bool, error) {
+	s.calls++
+	return p, false, s.err
+}
+
+func (s *scriptedProfiles) CreateProfile(p models.Profile) (models.Profile, error) {
+	s.calls++
+	return p, s.err
+}
+
+func TestRetryingProfileStore(t *testing.T) {
+	policy := store.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	inner := &scriptedProfiles{err: errConnReset}
+	s := store.NewRetryingProfileStore(inner, policy)
+	s.SetClock(selfAdvancingClock{clocktest.NewFake(time.Now())})
+
+	if _, _, err := s.EnsureProfile(models.Profile{PhoneNumber: "1111111111"}); err == nil || inner.calls != 3 {
+		t.Fatalf("EnsureProfile = %v after %d calls, want 3 attempts", err, inner.calls)
+	}
+	inner.calls = 0
+	if _, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111"}); err == nil || inner.calls != 1 {
+		t.Fatalf("CreateProfile = %v after %d calls, want 1 attempt", err, inner.calls)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errConnReset, true},
+		{errRetryable, true},
+		{mongo.CommandError{Labels: []string{"TransientTransactionError"}}, true},
+		{fmt.Errorf("find: %w", errConnReset), true},
+		{mongo.CommandError{Code: 121, Message: "validation"}, false},
+		{context.DeadlineExceeded, false},
+		{mongo.CommandError{Labels: []string{"NetworkError", "NetworkTimeoutError"}}, false},
+		{store.ErrNotFound, false},
+		{errPermanent, false},
+	} {
+		if got := store.IsTransient(tc.err); got != tc.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
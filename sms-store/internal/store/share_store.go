@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// ShareStore defines the interface for conversation share links.
+type ShareStore interface {
+	// CreateShare stores share, whose ID must be new.
+	CreateShare(share models.Share) (models.Share, error)
+
+	// GetShare retrieves a share by ID. Returns an error wrapping
+	// ErrNotFound if there is none or it expired.
+	GetShare(id string) (models.Share, error)
+
+	// ListShares retrieves the account's unexpired shares, newest first.
+	ListShares(accountID string) ([]models.Share, error)
+
+	// DeleteShare revokes a share of the account. Returns an error wrapping
+	// ErrNotFound if the account has no share with that ID.
+	DeleteShare(accountID, id string) error
+}
+
+// MongoShareStore implements the ShareStore interface using MongoDB.
+// Expired shares are removed by a TTL index.
+type MongoShareStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoShareStore creates a new MongoDB share store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoShareStore(client *mongo.Client, databaseName, collectionName string) *MongoShareStore {
+	if collectionName == "" {
+		collectionName = "shares"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "accountId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("accountId_createdAt_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("expiresAt_ttl_idx"),
+		},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		log.Printf("Warning: could not ensure share indexes on %s: %v", collectionName, err)
+	}
+
+	return &MongoShareStore{collection: collection}
+}
+
+func (s *MongoShareStore) CreateShare(share models.Share) (models.Share, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.collection.InsertOne(ctx, share); err != nil {
+		return models.Share{}, fmt.Errorf("failed to create share: %w", err)
+	}
+	return share, nil
+}
+
+// GetShare filters out expired shares itself: the TTL monitor removes them
+// only about once a minute.
+func (s *MongoShareStore) GetShare(id string) (models.Share, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "expiresAt": bson.M{"$gt": s.Clock().Now()}}
+	var share models.Share
+	err := s.collection.FindOne(ctx, filter).Decode(&share)
+	if err == mongo.ErrNoDocuments {
+		return models.Share{}, fmt.Errorf("share %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return models.Share{}, fmt.Errorf("failed to get share: %w", err)
+	}
+	return share, nil
+}
+
+func (s *MongoShareStore) ListShares(accountID string) ([]models.Share, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"accountId": accountID, "expiresAt": bson.M{"$gt": s.Clock().Now()}}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	shares := []models.Share{}
+	if err := cursor.All(ctx, &shares); err != nil {
+		return nil, fmt.Errorf("failed to decode shares: %w", err)
+	}
+	return shares, nil
+}
+
+func (s *MongoShareStore) DeleteShare(accountID, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "accountId": accountID})
+	if err != nil {
+		return fmt.Errorf("failed to delete share: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("share %w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// MemoryShareStore implements the ShareStore interface in memory.
+type MemoryShareStore struct {
+	mu     sync.Mutex
+	shares map[string]models.Share
+
+	clock.Clocked
+}
+
+func NewMemoryShareStore() *MemoryShareStore {
+	return &MemoryShareStore{shares: make(map[string]models.Share)}
+}
+
+func (s *MemoryShareStore) CreateShare(share models.Share) (models.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.shares[share.ID]; ok {
+		return models.Share{}, fmt.Errorf("share %w: %s", ErrAlreadyExists, share.ID)
+	}
+	s.shares[share.ID] = share
+	return share, nil
+}
+
+func (s *MemoryShareStore) GetShare(id string) (models.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	share, ok := s.shares[id]
+	if !ok || !share.ExpiresAt.After(s.Clock().Now()) {
+		return models.Share{}, fmt.Errorf("share %w: %s", ErrNotFound, id)
+	}
+	return share, nil
+}
+
+func (s *MemoryShareStore) ListShares(accountID string) ([]models.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	shares := []models.Share{}
+	for id, share := range s.shares {
+		if !share.ExpiresAt.After(now) {
+			delete(s.shares, id)
+			continue
+		}
+		if share.AccountID == accountID {
+			shares = append(shares, share)
+		}
+	}
+	slices.SortFunc(shares, func(a, b models.Share) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return shares, nil
+}
+
+func (s *MemoryShareStore) DeleteShare(accountID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if share, ok := s.shares[id]; !ok || share.AccountID != accountID {
+		return fmt.Errorf("share %w: %s", ErrNotFound, id)
+	}
+	delete(s.shares, id)
+	return nil
+}
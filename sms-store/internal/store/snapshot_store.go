@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// SnapshotStore defines the interface for conversation snapshots.
+type SnapshotStore interface {
+	// SaveSnapshot stores snapshot, giving it an ID.
+	SaveSnapshot(snapshot models.ConversationSnapshot) (models.ConversationSnapshot, error)
+
+	// GetSnapshot retrieves a snapshot by ID. Returns an error wrapping
+	// ErrNotFound if there is none or it expired.
+	GetSnapshot(id string) (models.ConversationSnapshot, error)
+}
+
+// newSnapshotID returns a random ID for a snapshot.
+func newSnapshotID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "snap-" + time.Now().Format("20060102150405.000000000")
+	}
+	return "snap-" + hex.EncodeToString(b[:])
+}
+
+// MongoSnapshotStore implements the SnapshotStore interface using MongoDB.
+// Expired snapshots are removed by a TTL index.
+type MongoSnapshotStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoSnapshotStore creates a new MongoDB snapshot store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoSnapshotStore(client *mongo.Client, databaseName, collectionName string) *MongoSnapshotStore {
+	if collectionName == "" {
+		collectionName = "conversation_snapshots"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("expiresAt_ttl_idx"),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		log.Printf("Warning: could not ensure snapshot index on %s: %v", collectionName, err)
+	}
+
+	return &MongoSnapshotStore{collection: collection}
+}
+
+func (s *MongoSnapshotStore) SaveSnapshot(snapshot models.ConversationSnapshot) (models.ConversationSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snapshot.ID = newSnapshotID()
+	if _, err := s.collection.InsertOne(ctx, snapshot); err != nil {
+		return models.ConversationSnapshot{}, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// GetSnapshot filters out expired snapshots itself: the TTL monitor removes
+// them only about once a minute.
+func (s *MongoSnapshotStore) GetSnapshot(id string) (models.ConversationSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "expiresAt": bson.M{"$gt": s.Clock().Now()}}
+	var snapshot models.ConversationSnapshot
+	err := s.collection.FindOne(ctx, filter).Decode(&snapshot)
+	if err == mongo.ErrNoDocuments {
+		return models.ConversationSnapshot{}, fmt.Errorf("snapshot %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return models.ConversationSnapshot{}, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// MemorySnapshotStore implements the SnapshotStore interface in memory.
+type MemorySnapshotStore struct {
+	mu        sync.Mutex
+	snapshots map[string]models.ConversationSnapshot
+
+	clock.Clocked
+}
+
+func NewMemorySnapshotStore() *MemorySnapshotStore {
+	return &MemorySnapshotStore{snapshots: make(map[string]models.ConversationSnapshot)}
+}
+
+func (s *MemorySnapshotStore) SaveSnapshot(snapshot models.ConversationSnapshot) (models.ConversationSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	for id, stored := range s.snapshots {
+		if !stored.ExpiresAt.After(now) {
+			delete(s.snapshots, id)
+		}
+	}
+	snapshot.ID = newSnapshotID()
+	s.snapshots[snapshot.ID] = snapshot
+	return snapshot, nil
+}
+
+func (s *MemorySnapshotStore) GetSnapshot(id string) (models.ConversationSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, ok := s.snapshots[id]
+	if !ok || !snapshot.ExpiresAt.After(s.Clock().Now()) {
+		return models.ConversationSnapshot{}, fmt.Errorf("snapshot %w: %s", ErrNotFound, id)
+	}
+	return snapshot, nil
+}
@@ -1,6 +1,121 @@
 package store
 
-import "sms-store/internal/models"
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// StoreUsage is how much a message store holds.
+type StoreUsage struct {
+	Backend       string        `json:"backend"`
+	Messages      int64         `json:"messages"`
+	Conversations *int64        `json:"conversations,omitempty"` // Where counting them is cheap
+	Limits        *MemoryLimits `json:"limits,omitempty"`        // Caps of a bounded store; zero is unbounded
+	Evicted       int64         `json:"evicted"`                 // Messages evicted to stay within Limits
+	ReadFrom      string        `json:"readFrom,omitempty"`      // MongoDB read preference the counts were read with
+}
+
+// MessageQuery selects messages across every conversation. Zero fields
+// don't restrict the query.
+type MessageQuery struct {
+	Text           string              // Case-insensitive substring of the text, as SearchMessages
+	Tokens         []string            // Search tokens the message must all have, as SearchMessagePrefixes
+	ExternalRef    *models.ExternalRef // External reference the message must carry
+	From, To       time.Time           // Messages created at or after From and before To
+	Direction      string              // models.DirectionInbound, or models.DirectionOutbound for messages without a direction too
+	Regions        []string            // Data residency regions the messages must be in, or outside of with OutsideRegions, as in PageQuery
+	OutsideRegions bool
+}
+
+// includes reports whether msg matches q.
+func (q MessageQuery) includes(msg models.Message) bool {
+	switch {
+	case q.Text != "" && !strings.Contains(strings.ToLower(msg.Text), strings.ToLower(q.Text)):
+		return false
+	case len(q.Tokens) > 0 && !hasAllTokens(msg.SearchTokens, q.Tokens):
+		return false
+	case !hasExternalRef(msg, q.ExternalRef):
+		return false
+	case !q.From.IsZero() && msg.CreatedAt.Before(q.From):
+		return false
+	case !q.To.IsZero() && !msg.CreatedAt.Before(q.To):
+		return false
+	case !inRegions(msg, q.Regions, q.OutsideRegions):
+		return false
+	case q.Direction == models.DirectionInbound:
+		return msg.Direction == models.DirectionInbound
+	case q.Direction == models.DirectionOutbound:
+		return msg.Direction != models.DirectionInbound
+	}
+	return true
+}
+
+// inRegions reports whether msg is in one of regions, where "" stands for
+// the messages without a region, or is in none of them with outside. No
+// regions restrict nothing.
+func inRegions(msg models.Message, regions []string, outside bool) bool {
+	if len(regions) == 0 {
+		return true
+	}
+	return slices.Contains(regions, msg.Region) != outside
+}
+
+// MessageQuerier is a store that streams the messages matching a query, for
+// exports too large to read a page at a time.
+type MessageQuerier interface {
+	// QueryMessages calls fn with the messages matching q, oldest first
+	// (createdAt, then ID), batchSize at a time until they run out, fn
+	// returns an error or ctx is done. It returns that error. The batch is
+	// reused once fn returns, so fn must not keep it.
+	QueryMessages(ctx context.Context, q MessageQuery, batchSize int, fn func([]models.Message) error) error
+}
+
+// ParticipantCount is how many of a conversation's messages one
+// participant has.
+type ParticipantCount struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"` // Of the participant's newest message that has one
+	Messages int64  `json:"messages"`
+}
+
+// sortParticipantCounts orders counts by messages, most first, then ID.
+func sortParticipantCounts(counts []ParticipantCount) {
+	slices.SortFunc(counts, func(a, b ParticipantCount) int {
+		if a.Messages != b.Messages {
+			return cmp.Compare(b.Messages, a.Messages)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// AnnotationCount is how many of a conversation's annotations have one
+// label, and how many of those reviewers confirmed and rejected.
+type AnnotationCount struct {
+	Label       string `json:"label"`
+	Annotations int64  `json:"annotations"`
+	Confirmed   int64  `json:"confirmed"`
+	Rejected    int64  `json:"rejected"`
+}
+
+// sortAnnotationCounts orders counts by annotations, most first, then label.
+func sortAnnotationCounts(counts []AnnotationCount) {
+	slices.SortFunc(counts, func(a, b AnnotationCount) int {
+		if a.Annotations != b.Annotations {
+			return cmp.Compare(b.Annotations, a.Annotations)
+		}
+		return strings.Compare(a.Label, b.Label)
+	})
+}
+
+// UsageReporter is a store that reports its usage.
+type UsageReporter interface {
+	Usage() (StoreUsage, error)
+}
 
 // Store defines the interface for message storage operations.
 // This allows us to switch between different storage implementations
@@ -8,16 +123,80 @@ import "sms-store/internal/models"
 type Store interface {
 	// Save stores a message and returns the saved message.
 	// The message should include an ID (can be generated or provided).
+	// Returns an error wrapping ErrAlreadyExists if a message with the same
+	// provider name and provider message ID is already stored.
 	Save(msg models.Message) (models.Message, error)
 
 	// SaveBatch stores multiple messages in a single operation for better performance.
 	// Returns the number of successfully saved messages and any error.
+	// Messages duplicating a stored provider message ID are skipped, not errors.
 	SaveBatch(msgs []models.Message) (int, error)
 
-	// FindByPhoneNumber retrieves all messages for a specific phone number.
+	// FindByPhoneNumber retrieves all messages for a specific phone number,
+	// newest first (createdAt descending, ID descending) like its pages.
 	// Returns an empty slice if no messages are found (not an error).
 	FindByPhoneNumber(phoneNumber string) ([]models.Message, error)
 
+	// FindByID retrieves the message with the given ID.
+	// Returns an error wrapping ErrNotFound if no message has that ID.
+	FindByID(id string) (models.Message, error)
+
+	// FindByPhoneNumberPage retrieves one page of messages for a phone number,
+	// newest first (createdAt descending, ID descending as tiebreaker).
+	// Returns an empty slice if the page is empty (not an error).
+	FindByPhoneNumberPage(phoneNumber string, page PageQuery) ([]models.Message, error)
+
+	// FindByConversationPage retrieves one page of the messages of a group
+	// conversation, ordered as FindByPhoneNumberPage.
+	FindByConversationPage(conversationID string, page PageQuery) ([]models.Message, error)
+
+	// ListPage retrieves one page of messages across all phone numbers,
+	// ordered as FindByPhoneNumberPage.
+	ListPage(page PageQuery) ([]models.Message, error)
+
+	// CountMessages returns the exact number of stored messages, or of those
+	// sent from senderID when it is set.
+	CountMessages(senderID string) (int64, error)
+
+	// CountByAccount returns the number of stored messages per account, of
+	// phoneNumber's conversation or of all of them when it is empty.
+	// Messages without an account count towards models.DefaultAccountID.
+	CountByAccount(phoneNumber string) (map[string]int64, error)
+
+	// CountByParticipant returns the number of phoneNumber's messages per
+	// participant, most messages first. Messages without a participant
+	// count towards models.DefaultParticipantID.
+	CountByParticipant(phoneNumber string) ([]ParticipantCount, error)
+
+	// CountAfter returns, per phone number, how many of its messages were
+	// created after the number's time in after, not counting duplicates or
+	// automatic acknowledgements. Numbers without any are absent from the
+	// map.
+	CountAfter(after map[string]time.Time) (map[string]int64, error)
+
+	// SearchMessages retrieves up to limit messages whose text contains query
+	// (case-insensitive), newest first. A non-nil ref restricts the search to
+	// messages carrying that external reference.
+	SearchMessages(query string, ref *models.ExternalRef, limit int) ([]models.Message, error)
+
+	// SearchMessagePrefixes retrieves up to limit messages whose search
+	// tokens include every one of tokens, newest first, restricted to ref
+	// like SearchMessages.
+	SearchMessagePrefixes(tokens []string, ref *models.ExternalRef, limit int) ([]models.Message, error)
+
+	// SetSearchTokens replaces the search tokens of messages, keyed by
+	// message ID, and returns how many of the messages exist.
+	SetSearchTokens(tokens map[string][]string) (int64, error)
+
+	// DailyDigest groups a conversation's messages into local-calendar days,
+	// oldest day first. Days without messages are omitted.
+	DailyDigest(phoneNumber string, q DigestQuery) ([]DailyBucket, error)
+
+	// CostSummary totals the estimated cost of messages, grouped by day, by
+	// account, by language or by annotation. Messages stored without a cost
+	// are left out.
+	CostSummary(q CostQuery) ([]CostBucket, error)
+
 	// List retrieves all messages (used for testing/debugging).
 	// Returns an empty slice if no messages are found.
 	List() ([]models.Message, error)
@@ -26,6 +205,19 @@ type Store interface {
 	// Returns the number of deleted messages and any error.
 	DeleteAll() (int64, error)
 
+	// Count returns the number of stored messages. Backends may return an
+	// estimate; it is used for progress reporting.
+	Count() (int64, error)
+
+	// DeleteAllBatch deletes up to limit messages and returns how many were
+	// deleted. Calling it until it returns 0 empties the store; an interrupted
+	// loop resumes by simply calling it again.
+	DeleteAllBatch(limit int) (int64, error)
+
+	// DropAll empties the store in one operation, recreating any indexes.
+	// Returns the number of messages (possibly estimated) that were dropped.
+	DropAll() (int64, error)
+
 	// GetDistinctPhoneNumbers retrieves all distinct phone numbers from the store.
 	// Returns an empty slice if no phone numbers are found.
 	GetDistinctPhoneNumbers() ([]string, error)
@@ -33,4 +225,246 @@ type Store interface {
 	// DeleteByPhoneNumber deletes all messages for a specific phone number.
 	// Returns the number of deleted messages and any error.
 	DeleteByPhoneNumber(phoneNumber string) (int64, error)
+
+	// UpdateMessage applies patch to the message with the given ID and
+	// returns the updated message.
+	// Returns an error wrapping ErrNotFound if no message has that ID.
+	UpdateMessage(id string, patch MessagePatch) (models.Message, error)
+
+	// AddReaction adds reaction to the message with the given ID and returns
+	// the updated message. Adding a reaction its actor already added with
+	// the same emoji changes nothing.
+	// Returns an error wrapping ErrNotFound if no message has that ID, or
+	// ErrTooManyReactions if it has MaxReactionsPerMessage reactions.
+	AddReaction(id string, reaction models.Reaction) (models.Message, error)
+
+	// RemoveReaction removes actor's emoji reaction from the message with
+	// the given ID and returns the updated message. Removing a reaction the
+	// message doesn't have changes nothing.
+	// Returns an error wrapping ErrNotFound if no message has that ID.
+	RemoveReaction(id, emoji, actor string) (models.Message, error)
+
+	// SetAnnotation sets the annotation of annotation.Source on the message
+	// with the given ID, replacing any the source set before together with
+	// its review, and returns the updated message.
+	// Returns an error wrapping ErrNotFound if no message has that ID, or
+	// ErrTooManyAnnotations if the source is new and the message already
+	// has annotations from MaxAnnotationsPerMessage sources.
+	SetAnnotation(id string, annotation models.Annotation) (models.Message, error)
+
+	// ReviewAnnotation records review on source's annotation of the message
+	// with the given ID, replacing any earlier review, and returns the
+	// updated message.
+	// Returns an error wrapping ErrNotFound if no message has that ID or the
+	// message has no annotation from source.
+	ReviewAnnotation(id, source string, review models.AnnotationReview) (models.Message, error)
+
+	// CountAnnotations returns the number of annotations of phoneNumber's
+	// messages per label, most annotations first.
+	CountAnnotations(phoneNumber string) ([]AnnotationCount, error)
+
+	// SetTranslation stores translation on the message with the given ID
+	// and returns the updated message. A language's translation is only
+	// replaced when overwrite is set.
+	// Returns an error wrapping ErrNotFound if no message has that ID,
+	// ErrAlreadyExists if it has a translation into the language and
+	// overwrite is unset, or ErrTooManyTranslations if the language is new
+	// and the message already has MaxTranslationsPerMessage translations.
+	SetTranslation(id string, translation models.Translation, overwrite bool) (models.Message, error)
+}
+
+// MaxReactionsPerMessage is the most reactions a message keeps.
+const MaxReactionsPerMessage = 100
+
+// MaxAnnotationsPerMessage is the most sources a message keeps annotations of.
+const MaxAnnotationsPerMessage = 20
+
+// MaxTranslationsPerMessage is the most languages a message keeps
+// translations into.
+const MaxTranslationsPerMessage = 10
+
+// MessagePatch lists the message fields UpdateMessage changes. Nil fields
+// are left as they are.
+type MessagePatch struct {
+	Status *string
+	Text   *string
+
+	// SearchTokens, when non-nil, replaces the message's search tokens; set
+	// alongside Text by TokenizingStore.
+	SearchTokens []string
+
+	// Language, when non-nil, replaces the message's detected language; set
+	// alongside Text by LanguageDetectingStore.
+	Language *models.Language
+
+	// Participant, when non-nil, replaces the message's participant; one
+	// with an empty ID removes it.
+	Participant *models.Participant
+}
+
+// PageQuery describes a keyset page of messages ordered newest first.
+type PageQuery struct {
+	// Limit is the maximum number of messages to return.
+	Limit int
+
+	// Before, when non-zero, restricts the page to messages older than this
+	// position. Messages with CreatedAt equal to Before are included only if
+	// their ID sorts before BeforeID, so pages never overlap or skip.
+	Before   time.Time
+	BeforeID string
+
+	// OldestFirst reverses the order of the page. After and AfterID then
+	// continue it, restricting the page to messages newer than that position
+	// the way Before and BeforeID do for newest-first pages.
+	OldestFirst bool
+	After       time.Time
+	AfterID     string
+
+	// SenderID, when set, restricts the page to messages sent from this
+	// provider sender ID (shortcode).
+	SenderID string
+
+	// Language, when set, restricts the page to messages detected in this
+	// language or one of its subtags, as models.LanguageMatches.
+	Language string
+
+	// Participant, when set, restricts the page to messages of the
+	// participant with this ID; models.DefaultParticipantID matches the
+	// messages without one.
+	Participant string
+
+	// ExternalRef, when set, restricts the page to messages carrying this
+	// external reference.
+	ExternalRef *models.ExternalRef
+
+	// Annotation, when set, restricts the page to messages with an
+	// annotation of this label, of at least MinConfidence, that no reviewer
+	// rejected, as models.Message.HasAnnotation.
+	Annotation    string
+	MinConfidence float64
+
+	// Direction, when set, restricts the page to inbound messages with
+	// models.DirectionInbound, or to the others with
+	// models.DirectionOutbound, as in MessageQuery.
+	Direction string
+
+	// Regions, when set, restricts the page to messages of these data
+	// residency regions; "" matches the messages without one. With
+	// OutsideRegions the page holds the messages of none of them instead.
+	Regions        []string
+	OutsideRegions bool
+
+	// BatchSize, when above 0, is how many documents each MongoDB cursor
+	// batch of the page holds, instead of the store's ReadLimits.BatchSize.
+	// It changes how the page is read, not which messages it holds.
+	BatchSize int
+}
+
+// DigestQuery describes a daily digest of one conversation.
+type DigestQuery struct {
+	// Location is the time zone whose calendar days messages are grouped by.
+	Location *time.Location
+
+	// From and To, when non-zero, restrict the digest to messages created
+	// at or after From and before To.
+	From time.Time
+	To   time.Time
+
+	// IncludeMessages fills DailyBucket.Messages, oldest first.
+	IncludeMessages bool
+}
+
+// DailyBucket is one local-calendar day of a daily digest.
+type DailyBucket struct {
+	Date     string           `json:"date"`  // Local date, YYYY-MM-DD
+	Start    time.Time        `json:"start"` // Local midnight starting the day
+	Count    int              `json:"count"`
+	Messages []models.Message `json:"messages,omitempty"`
+}
+
+// CostGroupBy selects how CostSummary groups messages.
+type CostGroupBy string
+
+const (
+	CostByDay      CostGroupBy = "day"
+	CostByAccount  CostGroupBy = "account"
+	CostByLanguage CostGroupBy = "language"
+
+	// CostByAnnotation groups each message under the label of its most
+	// confident annotation that no reviewer rejected, the first of equally
+	// confident ones, so no message counts twice. Messages without one
+	// group under CostKeyUnannotated.
+	CostByAnnotation CostGroupBy = "annotation"
+)
+
+// CostKeyUnannotated is the CostByAnnotation key of messages without an
+// annotation no reviewer rejected.
+const CostKeyUnannotated = "none"
+
+// CostQuery describes a cost summary.
+type CostQuery struct {
+	GroupBy CostGroupBy
+
+	// Location is the time zone whose calendar days CostByDay groups by.
+	Location *time.Location
+
+	// From and To, when non-zero, restrict the summary to messages created
+	// at or after From and before To.
+	From time.Time
+	To   time.Time
+}
+
+// CostBucket is one group of a cost summary. Groups are split by currency
+// so a change of pricing currency never mixes amounts.
+type CostBucket struct {
+	Key                 string  `json:"key"` // Local date (YYYY-MM-DD), account ID, language code or annotation label
+	Currency            string  `json:"currency"`
+	Messages            int     `json:"messages"`
+	Segments            int     `json:"segments"`
+	EstimatedCost       float64 `json:"estimatedCost"`
+	DefaultRateMessages int     `json:"defaultRateMessages"` // Priced at the default rate; see Cost.DefaultRate
+}
+
+// startOfDay returns local midnight of the calendar day containing t in loc.
+// On days where a DST transition skips midnight, time.Date normalises to the
+// first instant of the day.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// hasReaction reports whether actor reacted to msg with emoji.
+func hasReaction(msg models.Message, emoji, actor string) bool {
+	return slices.ContainsFunc(msg.Reactions, func(r models.Reaction) bool {
+		return r.Emoji == emoji && r.Actor == actor
+	})
+}
+
+// translationIndex returns the index of msg's translation into language,
+// or -1.
+func translationIndex(msg models.Message, language string) int {
+	return slices.IndexFunc(msg.Translations, func(t models.Translation) bool {
+		return t.Language == language
+	})
+}
+
+// annotationIndex returns the index of source's annotation of msg, or -1.
+func annotationIndex(msg models.Message, source string) int {
+	return slices.IndexFunc(msg.Annotations, func(a models.Annotation) bool {
+		return a.Source == source
+	})
+}
+
+// topAnnotationLabel returns the CostByAnnotation key of msg.
+func topAnnotationLabel(msg models.Message) string {
+	var top *models.Annotation
+	for i, a := range msg.Annotations {
+		if !a.Rejected() && (top == nil || a.Confidence > top.Confidence) {
+			top = &msg.Annotations[i]
+		}
+	}
+	if top == nil {
+		return CostKeyUnannotated
+	}
+	return top.Label
 }
@@ -0,0 +1,1304 @@
+// Package storetest provides conformance suites for store.Store,
+// store.ProfileStore and store.DeletionReceiptStore implementations.
+//
+// A backend proves it honors the interface contract by running the suite
+// from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.RunStoreConformance(t, func(t *testing.T) store.Store {
+//			return newEmptyBackend(t)
+//		})
+//	}
+//
+// Every factory call must return a fresh, empty store.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+// StoreFactory returns a new, empty Store for one subtest.
+type StoreFactory func(t *testing.T) store.Store
+
+// ProfileStoreFactory returns a new, empty ProfileStore for one subtest.
+type ProfileStoreFactory func(t *testing.T) store.ProfileStore
+
+// DeletionReceiptStoreFactory returns a new, empty DeletionReceiptStore for
+// one subtest.
+type DeletionReceiptStoreFactory func(t *testing.T) store.DeletionReceiptStore
+
+// base is a fixed reference time. Backends such as MongoDB store times at
+// millisecond precision, so fixtures stay on whole milliseconds.
+var base = time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+func message(id, phoneNumber, text string, offset time.Duration) models.Message {
+	return models.Message{
+		ID:          id,
+		PhoneNumber: phoneNumber,
+		Text:        text,
+		Status:      "SUCCESS",
+		CreatedAt:   base.Add(offset),
+	}
+}
+
+// RunStoreConformance runs every Store contract check against fresh stores from newStore.
+func RunStoreConformance(t *testing.T, newStore StoreFactory) {
+	t.Helper()
+
+	t.Run("SaveReturnsMessage", func(t *testing.T) {
+		s := newStore(t)
+		msg := message("m1", "1111111111", "hello", 0)
+		saved, err := s.Save(msg)
+		mustNoErr(t, err, "Save")
+		if saved.ID != msg.ID || saved.PhoneNumber != msg.PhoneNumber || saved.Text != msg.Text {
+			t.Fatalf("Save returned %+v, want %+v", saved, msg)
+		}
+	})
+
+	t.Run("SaveBatchCountsAndEmptyBatch", func(t *testing.T) {
+		s := newStore(t)
+		n, err := s.SaveBatch(nil)
+		mustNoErr(t, err, "SaveBatch(nil)")
+		if n != 0 {
+			t.Fatalf("SaveBatch(nil) = %d, want 0", n)
+		}
+
+		n, err = s.SaveBatch([]models.Message{
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+			message("m3", "2222222222", "c", 2*time.Second),
+		})
+		mustNoErr(t, err, "SaveBatch")
+		if n != 3 {
+			t.Fatalf("SaveBatch = %d, want 3", n)
+		}
+
+		all, err := s.List()
+		mustNoErr(t, err, "List")
+		if len(all) != 3 {
+			t.Fatalf("List returned %d messages, want 3", len(all))
+		}
+	})
+
+	t.Run("SaveBatchSkipsReplayedEvents", func(t *testing.T) {
+		s := newStore(t)
+		first := message("m1", "1111111111", "a", 0)
+		first.EventKey = "sms-events/0/41"
+		second := message("m2", "1111111111", "b", time.Second)
+		second.EventKey = "sms-events/0/42"
+		n, err := s.SaveBatch([]models.Message{first, second})
+		mustNoErr(t, err, "SaveBatch")
+		if n != 2 {
+			t.Fatalf("SaveBatch = %d, want 2", n)
+		}
+
+		// The replay re-reads both events and one new one
+		third := message("m3", "1111111111", "c", 2*time.Second)
+		third.EventKey = "sms-events/0/43"
+		n, err = s.SaveBatch([]models.Message{first, second, third})
+		mustNoErr(t, err, "SaveBatch of replayed events")
+		if n != 1 {
+			t.Fatalf("SaveBatch of replayed events = %d, want 1", n)
+		}
+		if _, err := s.Save(first); !errors.Is(err, store.ErrAlreadyExists) {
+			t.Fatalf("Save of a replayed event = %v, want ErrAlreadyExists", err)
+		}
+
+		all, err := s.List()
+		mustNoErr(t, err, "List")
+		if len(all) != 3 {
+			t.Fatalf("List returned %d messages, want 3", len(all))
+		}
+	})
+
+	t.Run("EmptyResultsAreNonNil", func(t *testing.T) {
+		s := newStore(t)
+		msgs, err := s.FindByPhoneNumber("0000000000")
+		mustNoErr(t, err, "FindByPhoneNumber")
+		if msgs == nil || len(msgs) != 0 {
+			t.Fatalf("FindByPhoneNumber on empty store = %#v, want empty non-nil slice", msgs)
+		}
+
+		list, err := s.List()
+		mustNoErr(t, err, "List")
+		if list == nil || len(list) != 0 {
+			t.Fatalf("List on empty store = %#v, want empty non-nil slice", list)
+		}
+
+		numbers, err := s.GetDistinctPhoneNumbers()
+		mustNoErr(t, err, "GetDistinctPhoneNumbers")
+		if numbers == nil || len(numbers) != 0 {
+			t.Fatalf("GetDistinctPhoneNumbers on empty store = %#v, want empty non-nil slice", numbers)
+		}
+
+		page, err := s.FindByPhoneNumberPage("0000000000", store.PageQuery{Limit: 10})
+		mustNoErr(t, err, "FindByPhoneNumberPage")
+		if page == nil || len(page) != 0 {
+			t.Fatalf("FindByPhoneNumberPage on empty store = %#v, want empty non-nil slice", page)
+		}
+	})
+
+	t.Run("FindByPhoneNumberFilters", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "2222222222", "b", time.Second),
+			message("m3", "1111111111", "c", 2*time.Second),
+		)
+
+		msgs, err := s.FindByPhoneNumber("1111111111")
+		mustNoErr(t, err, "FindByPhoneNumber")
+		assertIDs(t, "FindByPhoneNumber", sortedIDs(msgs), []string{"m1", "m3"})
+	})
+
+	t.Run("FindByIDKeepsReplyTo", func(t *testing.T) {
+		s := newStore(t)
+		reply := message("m2", "1111111111", "b", time.Second)
+		reply.ReplyToID = "m1"
+		seed(t, s, message("m1", "1111111111", "a", 0), reply)
+
+		got, err := s.FindByID("m2")
+		mustNoErr(t, err, "FindByID")
+		if got.ID != "m2" || got.ReplyToID != "m1" {
+			t.Fatalf("FindByID = id %q replyToId %q, want %q %q", got.ID, got.ReplyToID, "m2", "m1")
+		}
+
+		if _, err := s.FindByID("missing"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("FindByID of missing ID: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("PagesAreNewestFirstWithoutOverlap", func(t *testing.T) {
+		s := newStore(t)
+		// m2 and m3 share a timestamp so the ID tiebreaker is exercised
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+			message("m3", "1111111111", "c", time.Second),
+			message("m4", "1111111111", "d", 2*time.Second),
+			message("x1", "2222222222", "other", 3*time.Second),
+		)
+
+		var got []string
+		page := store.PageQuery{Limit: 2}
+		for i := 0; i < 5; i++ {
+			msgs, err := s.FindByPhoneNumberPage("1111111111", page)
+			mustNoErr(t, err, "FindByPhoneNumberPage")
+			if len(msgs) > page.Limit {
+				t.Fatalf("page returned %d messages, limit %d", len(msgs), page.Limit)
+			}
+			if len(msgs) == 0 {
+				break
+			}
+			for _, m := range msgs {
+				got = append(got, m.ID)
+			}
+			last := msgs[len(msgs)-1]
+			page.Before, page.BeforeID = last.CreatedAt, last.ID
+		}
+		assertIDs(t, "paged IDs", got, []string{"m4", "m3", "m2", "m1"})
+	})
+
+	t.Run("LateEventsSortByCreatedAt", func(t *testing.T) {
+		s := newStore(t)
+		// Stored in a different order than they were sent, as after an
+		// outage or a replay
+		received := base.Add(time.Hour)
+		for _, m := range []models.Message{
+			message("m3", "1111111111", "c", 2*time.Second),
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+		} {
+			m.ReceivedAt = received
+			_, err := s.Save(m)
+			mustNoErr(t, err, "Save")
+		}
+
+		msgs, err := s.FindByPhoneNumber("1111111111")
+		mustNoErr(t, err, "FindByPhoneNumber")
+		assertIDs(t, "conversation", ids(msgs), []string{"m3", "m2", "m1"})
+		msgs, err = s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 10})
+		mustNoErr(t, err, "FindByPhoneNumberPage")
+		assertIDs(t, "conversation page", ids(msgs), []string{"m3", "m2", "m1"})
+
+		got, err := s.FindByID("m1")
+		mustNoErr(t, err, "FindByID")
+		if !got.CreatedAt.Equal(base) || !got.ReceivedAt.Equal(received) {
+			t.Fatalf("m1 createdAt=%v receivedAt=%v, want %v and %v", got.CreatedAt, got.ReceivedAt, base, received)
+		}
+	})
+
+	t.Run("OldestFirstPagesWithoutOverlap", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+			message("m3", "1111111111", "c", time.Second),
+			message("m4", "1111111111", "d", 2*time.Second),
+			message("x1", "2222222222", "other", 3*time.Second),
+		)
+
+		var got []string
+		page := store.PageQuery{Limit: 3, OldestFirst: true}
+		for i := 0; i < 5; i++ {
+			msgs, err := s.FindByPhoneNumberPage("1111111111", page)
+			mustNoErr(t, err, "FindByPhoneNumberPage")
+			if len(msgs) == 0 {
+				break
+			}
+			for _, m := range msgs {
+				got = append(got, m.ID)
+			}
+			last := msgs[len(msgs)-1]
+			page.After, page.AfterID = last.CreatedAt, last.ID
+		}
+		assertIDs(t, "paged IDs", got, []string{"m1", "m2", "m3", "m4"})
+	})
+
+	t.Run("ListPageIsNewestFirstAcrossConversations", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "2222222222", "b", time.Second),
+			message("m3", "1111111111", "c", 2*time.Second),
+		)
+
+		first, err := s.ListPage(store.PageQuery{Limit: 2})
+		mustNoErr(t, err, "ListPage")
+		assertIDs(t, "first page", ids(first), []string{"m3", "m2"})
+
+		last := first[len(first)-1]
+		rest, err := s.ListPage(store.PageQuery{Limit: 2, Before: last.CreatedAt, BeforeID: last.ID})
+		mustNoErr(t, err, "ListPage")
+		assertIDs(t, "second page", ids(rest), []string{"m1"})
+
+		n, err := s.CountMessages("")
+		mustNoErr(t, err, "CountMessages")
+		if n != 3 {
+			t.Fatalf("CountMessages = %d, want 3", n)
+		}
+	})
+
+	t.Run("ExternalRefFiltersAcrossConversations", func(t *testing.T) {
+		order := models.ExternalRef{Type: "order", ID: "OD123"}
+		withRefs := func(msg models.Message, refs ...models.ExternalRef) models.Message {
+			msg.ExternalRefs = refs
+			return msg
+		}
+		s := newStore(t)
+		seed(t, s,
+			withRefs(message("m1", "1111111111", "order placed", 0), order),
+			withRefs(message("m2", "2222222222", "order shipped", time.Second), models.ExternalRef{Type: "shipment", ID: "SH9"}, order),
+			withRefs(message("m3", "1111111111", "other order", 2*time.Second), models.ExternalRef{Type: "order", ID: "OD999"}),
+			// Type and ID match only across different references
+			withRefs(message("m4", "3333333333", "order mixed", 3*time.Second), models.ExternalRef{Type: "order", ID: "OD1"}, models.ExternalRef{Type: "ticket", ID: "OD123"}),
+			message("m5", "1111111111", "order untagged", 4*time.Second),
+		)
+
+		first, err := s.ListPage(store.PageQuery{Limit: 1, ExternalRef: &order})
+		mustNoErr(t, err, "ListPage by external ref")
+		assertIDs(t, "first page", ids(first), []string{"m2"})
+
+		rest, err := s.ListPage(store.PageQuery{Limit: 10, ExternalRef: &order, Before: first[0].CreatedAt, BeforeID: first[0].ID})
+		mustNoErr(t, err, "ListPage by external ref")
+		assertIDs(t, "second page", ids(rest), []string{"m1"})
+
+		msgs, err := s.SearchMessages("order", &order, 10)
+		mustNoErr(t, err, "SearchMessages by external ref")
+		assertIDs(t, "SearchMessages by external ref", ids(msgs), []string{"m2", "m1"})
+	})
+
+	t.Run("ParticipantsFilterAndCountWithinConversation", func(t *testing.T) {
+		from := func(msg models.Message, id, name string) models.Message {
+			msg.Participant = &models.Participant{ID: id, Name: name}
+			return msg
+		}
+		s := newStore(t)
+		seed(t, s,
+			from(message("m1", "1111111111", "a", 0), "priya", "Priya"),
+			message("m2", "1111111111", "b", time.Second),
+			from(message("m3", "1111111111", "c", 2*time.Second), "priya", "Priya S"),
+			from(message("m4", "1111111111", "d", 3*time.Second), "ravi", ""),
+			from(message("m5", "2222222222", "e", 4*time.Second), "priya", "Other Priya"),
+		)
+
+		priya, err := s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 10, Participant: "priya"})
+		mustNoErr(t, err, "FindByPhoneNumberPage by participant")
+		assertIDs(t, "priya's page", ids(priya), []string{"m3", "m1"})
+
+		untagged, err := s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 10, Participant: models.DefaultParticipantID})
+		mustNoErr(t, err, "FindByPhoneNumberPage of the default participant")
+		assertIDs(t, "default participant's page", ids(untagged), []string{"m2"})
+
+		counts, err := s.CountByParticipant("1111111111")
+		mustNoErr(t, err, "CountByParticipant")
+		want := []store.ParticipantCount{
+			{ID: "priya", Name: "Priya S", Messages: 2},
+			{ID: models.DefaultParticipantID, Messages: 1},
+			{ID: "ravi", Messages: 1},
+		}
+		if !slices.Equal(counts, want) {
+			t.Fatalf("CountByParticipant = %v, want %v", counts, want)
+		}
+
+		// An empty participant removes the tag
+		got, err := s.UpdateMessage("m4", store.MessagePatch{Participant: &models.Participant{}})
+		mustNoErr(t, err, "UpdateMessage removing the participant")
+		if got.Participant != nil {
+			t.Fatalf("UpdateMessage left participant %+v, want none", got.Participant)
+		}
+		got, err = s.UpdateMessage("m2", store.MessagePatch{Participant: &models.Participant{ID: "ravi", Name: "Ravi"}})
+		mustNoErr(t, err, "UpdateMessage tagging the participant")
+		if got.Participant == nil || got.Participant.ID != "ravi" {
+			t.Fatalf("UpdateMessage set participant %+v, want ravi", got.Participant)
+		}
+		untagged, err = s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 10, Participant: models.DefaultParticipantID})
+		mustNoErr(t, err, "FindByPhoneNumberPage of the default participant")
+		assertIDs(t, "default participant's page after tagging", ids(untagged), []string{"m4"})
+	})
+
+	t.Run("GroupMessagesPageByConversation", func(t *testing.T) {
+		group := func(id, conversationID string, offset time.Duration) models.Message {
+			msg := message(id, "", "group", offset)
+			msg.ConversationID = conversationID
+			return msg
+		}
+		s := newStore(t)
+		seed(t, s,
+			group("g1", "grp-a", 0),
+			message("m1", "1111111111", "direct", time.Second),
+			group("g2", "grp-b", 2*time.Second),
+			group("g3", "grp-a", 3*time.Second),
+		)
+
+		first, err := s.FindByConversationPage("grp-a", store.PageQuery{Limit: 1})
+		mustNoErr(t, err, "FindByConversationPage")
+		assertIDs(t, "first page", ids(first), []string{"g3"})
+
+		rest, err := s.FindByConversationPage("grp-a", store.PageQuery{Limit: 5, Before: first[0].CreatedAt, BeforeID: first[0].ID})
+		mustNoErr(t, err, "FindByConversationPage")
+		assertIDs(t, "second page", ids(rest), []string{"g1"})
+
+		// Group messages have no phone number, so they are no direct conversation
+		numbers, err := s.GetDistinctPhoneNumbers()
+		mustNoErr(t, err, "GetDistinctPhoneNumbers")
+		assertIDs(t, "GetDistinctPhoneNumbers", numbers, []string{"1111111111"})
+	})
+
+	t.Run("SearchMessagesIsCaseInsensitiveNewestFirst", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "Your OTP is 1234", 0),
+			message("m2", "2222222222", "otp resent", time.Second),
+			message("m3", "3333333333", "unrelated", 2*time.Second),
+			message("m4", "1111111111", "Regex chars (otp).*", 3*time.Second),
+		)
+
+		msgs, err := s.SearchMessages("OTP", nil, 10)
+		mustNoErr(t, err, "SearchMessages")
+		assertIDs(t, "SearchMessages", ids(msgs), []string{"m4", "m2", "m1"})
+
+		msgs, err = s.SearchMessages("(otp).*", nil, 10)
+		mustNoErr(t, err, "SearchMessages with regex metacharacters")
+		assertIDs(t, "SearchMessages literal match", ids(msgs), []string{"m4"})
+
+		msgs, err = s.SearchMessages("otp", nil, 1)
+		mustNoErr(t, err, "SearchMessages with limit")
+		assertIDs(t, "SearchMessages limit", ids(msgs), []string{"m4"})
+	})
+
+	t.Run("SearchMessagePrefixesMatchesAllTokens", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "hello world", 0),
+			message("m2", "2222222222", "help", time.Second),
+			message("m3", "3333333333", "untokenized", 2*time.Second),
+		)
+
+		n, err := s.SetSearchTokens(map[string][]string{
+			"m1":      {"he", "hel", "wo", "wor"},
+			"m2":      {"he", "hel"},
+			"missing": {"he"},
+		})
+		mustNoErr(t, err, "SetSearchTokens")
+		if n != 2 {
+			t.Fatalf("SetSearchTokens = %d, want 2", n)
+		}
+
+		msgs, err := s.SearchMessagePrefixes([]string{"hel"}, nil, 10)
+		mustNoErr(t, err, "SearchMessagePrefixes")
+		assertIDs(t, "SearchMessagePrefixes", ids(msgs), []string{"m2", "m1"})
+
+		msgs, err = s.SearchMessagePrefixes([]string{"hel", "wo"}, nil, 10)
+		mustNoErr(t, err, "SearchMessagePrefixes with two tokens")
+		assertIDs(t, "SearchMessagePrefixes all tokens", ids(msgs), []string{"m1"})
+	})
+
+	t.Run("GetDistinctPhoneNumbers", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+			message("m3", "2222222222", "c", 2*time.Second),
+		)
+
+		numbers, err := s.GetDistinctPhoneNumbers()
+		mustNoErr(t, err, "GetDistinctPhoneNumbers")
+		sort.Strings(numbers)
+		assertIDs(t, "GetDistinctPhoneNumbers", numbers, []string{"1111111111", "2222222222"})
+	})
+
+	t.Run("DeleteByPhoneNumberCountsAndIsolates", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+			message("m3", "2222222222", "c", 2*time.Second),
+		)
+
+		n, err := s.DeleteByPhoneNumber("1111111111")
+		mustNoErr(t, err, "DeleteByPhoneNumber")
+		if n != 2 {
+			t.Fatalf("DeleteByPhoneNumber = %d, want 2", n)
+		}
+
+		n, err = s.DeleteByPhoneNumber("1111111111")
+		mustNoErr(t, err, "DeleteByPhoneNumber again")
+		if n != 0 {
+			t.Fatalf("second DeleteByPhoneNumber = %d, want 0", n)
+		}
+
+		rest, err := s.List()
+		mustNoErr(t, err, "List")
+		assertIDs(t, "remaining messages", sortedIDs(rest), []string{"m3"})
+	})
+
+	t.Run("CountByAccountDefaultsMissingAccount", func(t *testing.T) {
+		s := newStore(t)
+		acme := message("m2", "1111111111", "b", time.Second)
+		acme.AccountID = "acme"
+		other := message("m3", "2222222222", "c", 2*time.Second)
+		other.AccountID = "acme"
+		seed(t, s, message("m1", "1111111111", "a", 0), acme, other)
+
+		all, err := s.CountByAccount("")
+		mustNoErr(t, err, "CountByAccount")
+		if len(all) != 2 || all[models.DefaultAccountID] != 1 || all["acme"] != 2 {
+			t.Fatalf("CountByAccount = %v, want default:1 acme:2", all)
+		}
+
+		one, err := s.CountByAccount("2222222222")
+		mustNoErr(t, err, "CountByAccount of a conversation")
+		if len(one) != 1 || one["acme"] != 1 {
+			t.Fatalf("CountByAccount(2222222222) = %v, want acme:1", one)
+		}
+	})
+
+	t.Run("CountAfterIsPerConversationAndExclusive", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+			message("m3", "1111111111", "c", 2*time.Second),
+			message("m4", "2222222222", "d", 3*time.Second),
+		)
+
+		counts, err := s.CountAfter(map[string]time.Time{
+			"1111111111": base.Add(time.Second),
+			"2222222222": base.Add(3 * time.Second),
+		})
+		mustNoErr(t, err, "CountAfter")
+		if len(counts) != 1 || counts["1111111111"] != 1 {
+			t.Fatalf("CountAfter = %v, want 1111111111:1", counts)
+		}
+	})
+
+	t.Run("CountAfterSkipsDuplicatesAndAutoAcks", func(t *testing.T) {
+		s := newStore(t)
+		dup := message("m2", "1111111111", "a", time.Second)
+		dup.DuplicateOf = "m1"
+		ack := message("m3", "1111111111", "We received your message", 2*time.Second)
+		ack.Source = models.MessageSourceAutoAck
+		seed(t, s, message("m1", "1111111111", "a", 0), dup, ack)
+
+		counts, err := s.CountAfter(map[string]time.Time{"1111111111": base.Add(-time.Second)})
+		mustNoErr(t, err, "CountAfter")
+		if counts["1111111111"] != 1 {
+			t.Fatalf("CountAfter = %v, want 1111111111:1", counts)
+		}
+	})
+
+	t.Run("DirectionFiltersPages", func(t *testing.T) {
+		s := newStore(t)
+		in1 := message("m1", "1111111111", "hi", 0)
+		in1.Direction = models.DirectionInbound
+		in3 := message("m3", "1111111111", "again", 2*time.Second)
+		in3.Direction = models.DirectionInbound
+		seed(t, s, in1, message("m2", "1111111111", "hello", time.Second), in3)
+
+		inbound, err := s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 5, Direction: models.DirectionInbound, Before: in3.CreatedAt, BeforeID: in3.ID})
+		mustNoErr(t, err, "FindByPhoneNumberPage")
+		if len(inbound) != 1 || inbound[0].ID != "m1" {
+			t.Fatalf("inbound page before m3 = %v, want [m1]", ids(inbound))
+		}
+		outbound, err := s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 5, Direction: models.DirectionOutbound})
+		mustNoErr(t, err, "FindByPhoneNumberPage")
+		if len(outbound) != 1 || outbound[0].ID != "m2" {
+			t.Fatalf("outbound page = %v, want [m2]", ids(outbound))
+		}
+	})
+
+	t.Run("UpdateMessagePatchesOnlyGivenFields", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+		)
+
+		delivered := "DELIVERED"
+		got, err := s.UpdateMessage("m1", store.MessagePatch{Status: &delivered})
+		mustNoErr(t, err, "UpdateMessage")
+		if got.Status != delivered || got.Text != "a" {
+			t.Fatalf("UpdateMessage returned status %q text %q, want %q %q", got.Status, got.Text, delivered, "a")
+		}
+
+		msgs, err := s.FindByPhoneNumber("1111111111")
+		mustNoErr(t, err, "FindByPhoneNumber")
+		for _, msg := range msgs {
+			if msg.ID == "m2" && msg.Status == delivered {
+				t.Fatal("UpdateMessage changed another message")
+			}
+		}
+
+		if _, err := s.UpdateMessage("missing", store.MessagePatch{Status: &delivered}); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("UpdateMessage of missing ID: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("ReactionsAreIdempotentCountedAndCapped", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s, message("m1", "1111111111", "a", 0))
+
+		at := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+		for _, r := range []models.Reaction{
+			{Emoji: "👍", Actor: "alice", CreatedAt: at},
+			{Emoji: "👍", Actor: "alice", CreatedAt: at.Add(time.Second)},
+			{Emoji: "👍", Actor: "bob", CreatedAt: at},
+			{Emoji: "🎉", Actor: "alice", CreatedAt: at},
+		} {
+			_, err := s.AddReaction("m1", r)
+			mustNoErr(t, err, "AddReaction")
+		}
+		got, err := s.FindByID("m1")
+		mustNoErr(t, err, "FindByID")
+		if len(got.Reactions) != 3 || got.ReactionCounts["👍"] != 2 || got.ReactionCounts["🎉"] != 1 {
+			t.Fatalf("after adds: reactions %v counts %v, want 3 reactions, 👍 2 and 🎉 1", got.Reactions, got.ReactionCounts)
+		}
+
+		got, err = s.RemoveReaction("m1", "🎉", "alice")
+		mustNoErr(t, err, "RemoveReaction")
+		if _, ok := got.ReactionCounts["🎉"]; ok || len(got.Reactions) != 2 {
+			t.Fatalf("after remove: reactions %v counts %v, want 🎉 gone", got.Reactions, got.ReactionCounts)
+		}
+		got, err = s.RemoveReaction("m1", "🎉", "alice")
+		mustNoErr(t, err, "RemoveReaction of a missing reaction")
+		if got.ReactionCounts["👍"] != 2 {
+			t.Fatalf("removing a missing reaction changed counts to %v", got.ReactionCounts)
+		}
+
+		for i := len(got.Reactions); i < store.MaxReactionsPerMessage; i++ {
+			_, err := s.AddReaction("m1", models.Reaction{Emoji: "👍", Actor: fmt.Sprintf("user%d", i), CreatedAt: at})
+			mustNoErr(t, err, "AddReaction up to the cap")
+		}
+		if _, err := s.AddReaction("m1", models.Reaction{Emoji: "👍", Actor: "late", CreatedAt: at}); !errors.Is(err, store.ErrTooManyReactions) {
+			t.Fatalf("AddReaction past the cap: err = %v, want ErrTooManyReactions", err)
+		}
+		if _, err := s.AddReaction("m1", models.Reaction{Emoji: "👍", Actor: "alice", CreatedAt: at}); err != nil {
+			t.Fatalf("repeating a reaction on a full message: err = %v, want nil", err)
+		}
+
+		if _, err := s.AddReaction("missing", models.Reaction{Emoji: "👍", Actor: "alice"}); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("AddReaction to missing ID: err = %v, want ErrNotFound", err)
+		}
+		if _, err := s.RemoveReaction("missing", "👍", "alice"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("RemoveReaction from missing ID: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("AnnotationsKeepOnePerSourceFilterAndCount", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "1111111111", "b", time.Second),
+			message("m3", "1111111111", "c", 2*time.Second),
+		)
+
+		at := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+		for _, set := range []struct {
+			id string
+			a  models.Annotation
+		}{
+			{"m1", models.Annotation{Source: "intent-v1", Label: "complaint", Confidence: 0.6, CreatedAt: at}},
+			{"m1", models.Annotation{Source: "abuse-v1", Label: "abuse", Confidence: 0.3, CreatedAt: at}},
+			{"m1", models.Annotation{Source: "intent-v1", Label: "complaint", Confidence: 0.9, CreatedAt: at.Add(time.Second)}},
+			{"m2", models.Annotation{Source: "intent-v1", Label: "complaint", Confidence: 0.7, CreatedAt: at}},
+			{"m3", models.Annotation{Source: "intent-v1", Label: "refund-request", Confidence: 0.95, CreatedAt: at}},
+		} {
+			_, err := s.SetAnnotation(set.id, set.a)
+			mustNoErr(t, err, "SetAnnotation")
+		}
+		got, err := s.FindByID("m1")
+		mustNoErr(t, err, "FindByID")
+		if len(got.Annotations) != 2 || got.Annotations[0].Source != "intent-v1" || got.Annotations[0].Confidence != 0.9 {
+			t.Fatalf("after sets: annotations %+v, want intent-v1 at 0.9 first, then abuse-v1", got.Annotations)
+		}
+
+		complaints, err := s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 10, Annotation: "complaint", MinConfidence: 0.8})
+		mustNoErr(t, err, "FindByPhoneNumberPage by annotation")
+		assertIDs(t, "confident complaints", ids(complaints), []string{"m1"})
+
+		got, err = s.ReviewAnnotation("m1", "intent-v1", models.AnnotationReview{Reviewer: "asha", Decision: models.AnnotationRejected, ReviewedAt: at})
+		mustNoErr(t, err, "ReviewAnnotation")
+		if r := got.Annotations[0].Review; r == nil || r.Reviewer != "asha" || r.Decision != models.AnnotationRejected {
+			t.Fatalf("ReviewAnnotation recorded %+v, want asha rejecting", r)
+		}
+		_, err = s.ReviewAnnotation("m2", "intent-v1", models.AnnotationReview{Reviewer: "asha", Decision: models.AnnotationConfirmed, ReviewedAt: at})
+		mustNoErr(t, err, "ReviewAnnotation")
+		complaints, err = s.FindByPhoneNumberPage("1111111111", store.PageQuery{Limit: 10, Annotation: "complaint"})
+		mustNoErr(t, err, "FindByPhoneNumberPage by annotation")
+		assertIDs(t, "complaints not rejected", ids(complaints), []string{"m2"})
+
+		counts, err := s.CountAnnotations("1111111111")
+		mustNoErr(t, err, "CountAnnotations")
+		want := []store.AnnotationCount{
+			{Label: "complaint", Annotations: 2, Confirmed: 1, Rejected: 1},
+			{Label: "abuse", Annotations: 1},
+			{Label: "refund-request", Annotations: 1},
+		}
+		if !slices.Equal(counts, want) {
+			t.Fatalf("CountAnnotations = %v, want %v", counts, want)
+		}
+
+		// Setting the annotation again clears the review of the old label
+		got, err = s.SetAnnotation("m1", models.Annotation{Source: "intent-v1", Label: "complaint", Confidence: 0.85, CreatedAt: at.Add(2 * time.Second)})
+		mustNoErr(t, err, "SetAnnotation over a reviewed annotation")
+		if got.Annotations[0].Review != nil {
+			t.Fatalf("SetAnnotation kept review %+v", got.Annotations[0].Review)
+		}
+
+		for i := len(got.Annotations); i < store.MaxAnnotationsPerMessage; i++ {
+			_, err := s.SetAnnotation("m1", models.Annotation{Source: fmt.Sprintf("model%d", i), Label: "other", Confidence: 0.5, CreatedAt: at})
+			mustNoErr(t, err, "SetAnnotation up to the cap")
+		}
+		if _, err := s.SetAnnotation("m1", models.Annotation{Source: "late", Label: "other", Confidence: 0.5, CreatedAt: at}); !errors.Is(err, store.ErrTooManyAnnotations) {
+			t.Fatalf("SetAnnotation of a new source past the cap: err = %v, want ErrTooManyAnnotations", err)
+		}
+		if _, err := s.SetAnnotation("m1", models.Annotation{Source: "abuse-v1", Label: "abuse", Confidence: 0.4, CreatedAt: at}); err != nil {
+			t.Fatalf("SetAnnotation of a known source on a full message: err = %v, want nil", err)
+		}
+
+		if _, err := s.SetAnnotation("missing", models.Annotation{Source: "intent-v1", Label: "complaint"}); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("SetAnnotation on missing ID: err = %v, want ErrNotFound", err)
+		}
+		if _, err := s.ReviewAnnotation("m3", "abuse-v1", models.AnnotationReview{Reviewer: "asha", Decision: models.AnnotationConfirmed}); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("ReviewAnnotation of a missing source: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("TranslationsAreImmutableUnlessOverwrittenAndCapped", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s, message("m1", "1111111111", "hello", 0))
+
+		at := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+		_, err := s.SetTranslation("m1", models.Translation{Language: "hi", Text: "नमस्ते", CreatedAt: at}, false)
+		mustNoErr(t, err, "SetTranslation")
+		if _, err := s.SetTranslation("m1", models.Translation{Language: "hi", Text: "namaste", CreatedAt: at}, false); !errors.Is(err, store.ErrAlreadyExists) {
+			t.Fatalf("SetTranslation of a set language: err = %v, want ErrAlreadyExists", err)
+		}
+		got, err := s.SetTranslation("m1", models.Translation{Language: "hi", Text: "namaste", CreatedAt: at.Add(time.Second)}, true)
+		mustNoErr(t, err, "SetTranslation with overwrite")
+		if len(got.Translations) != 1 || got.Translations[0].Text != "namaste" {
+			t.Fatalf("after overwrite: translations %+v, want hi as namaste alone", got.Translations)
+		}
+
+		for i := len(got.Translations); i < store.MaxTranslationsPerMessage; i++ {
+			_, err := s.SetTranslation("m1", models.Translation{Language: fmt.Sprintf("x%d", i), Text: "t", CreatedAt: at}, false)
+			mustNoErr(t, err, "SetTranslation up to the cap")
+		}
+		if _, err := s.SetTranslation("m1", models.Translation{Language: "ta", Text: "t", CreatedAt: at}, true); !errors.Is(err, store.ErrTooManyTranslations) {
+			t.Fatalf("SetTranslation of a new language past the cap: err = %v, want ErrTooManyTranslations", err)
+		}
+		if _, err := s.SetTranslation("m1", models.Translation{Language: "hi", Text: "नमस्ते", CreatedAt: at}, true); err != nil {
+			t.Fatalf("SetTranslation overwriting on a full message: err = %v, want nil", err)
+		}
+		got, err = s.FindByID("m1")
+		mustNoErr(t, err, "FindByID")
+		if len(got.Translations) != store.MaxTranslationsPerMessage || got.Translations[0].Language != "hi" || got.Translations[0].Text != "नमस्ते" {
+			t.Fatalf("FindByID translations %+v, want %d with hi first", got.Translations, store.MaxTranslationsPerMessage)
+		}
+
+		if _, err := s.SetTranslation("missing", models.Translation{Language: "hi", Text: "t"}, false); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("SetTranslation on missing ID: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("DeleteAllCounts", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s,
+			message("m1", "1111111111", "a", 0),
+			message("m2", "2222222222", "b", time.Second),
+		)
+
+		n, err := s.DeleteAll()
+		mustNoErr(t, err, "DeleteAll")
+		if n != 2 {
+			t.Fatalf("DeleteAll = %d, want 2", n)
+		}
+
+		n, err = s.DeleteAll()
+		mustNoErr(t, err, "DeleteAll on empty store")
+		if n != 0 {
+			t.Fatalf("DeleteAll on empty store = %d, want 0", n)
+		}
+	})
+
+	t.Run("DailyDigestBucketsAcrossDSTTransition", func(t *testing.T) {
+		loc, err := time.LoadLocation("America/New_York")
+		if err != nil {
+			t.Skipf("time zone data unavailable: %v", err)
+		}
+
+		// Clocks in New York jump from 02:00 EST to 03:00 EDT on 2024-03-10,
+		// so that local day is 23 hours long.
+		at := func(day, hour, minute int) time.Time {
+			return time.Date(2024, 3, day, hour, minute, 0, 0, loc)
+		}
+		s := newStore(t)
+		seed(t, s,
+			models.Message{ID: "d1", PhoneNumber: "1111111111", Text: "a", Status: "SUCCESS", CreatedAt: at(9, 23, 30)},
+			models.Message{ID: "d2", PhoneNumber: "1111111111", Text: "b", Status: "SUCCESS", CreatedAt: at(10, 0, 30)},
+			models.Message{ID: "d3", PhoneNumber: "1111111111", Text: "c", Status: "SUCCESS", CreatedAt: at(10, 23, 30)},
+			models.Message{ID: "d4", PhoneNumber: "1111111111", Text: "d", Status: "SUCCESS", CreatedAt: at(11, 0, 30)},
+			models.Message{ID: "d5", PhoneNumber: "2222222222", Text: "e", Status: "SUCCESS", CreatedAt: at(10, 12, 0)},
+		)
+
+		days, err := s.DailyDigest("1111111111", store.DigestQuery{Location: loc, IncludeMessages: true})
+		mustNoErr(t, err, "DailyDigest")
+
+		want := []struct {
+			date string
+			ids  []string
+		}{
+			{"2024-03-09", []string{"d1"}},
+			{"2024-03-10", []string{"d2", "d3"}},
+			{"2024-03-11", []string{"d4"}},
+		}
+		if len(days) != len(want) {
+			t.Fatalf("DailyDigest returned %d days, want %d: %+v", len(days), len(want), days)
+		}
+		for i, w := range want {
+			if days[i].Date != w.date || days[i].Count != len(w.ids) {
+				t.Fatalf("day %d = %s/%d, want %s/%d", i, days[i].Date, days[i].Count, w.date, len(w.ids))
+			}
+			if !days[i].Start.Equal(at(i+9, 0, 0)) {
+				t.Fatalf("day %s starts at %v, want local midnight", w.date, days[i].Start)
+			}
+			assertIDs(t, "messages on "+w.date, ids(days[i].Messages), w.ids)
+		}
+
+		days, err = s.DailyDigest("1111111111", store.DigestQuery{Location: loc, From: at(10, 0, 0), To: at(11, 0, 0)})
+		mustNoErr(t, err, "DailyDigest with range")
+		if len(days) != 1 || days[0].Count != 2 || len(days[0].Messages) != 0 {
+			t.Fatalf("DailyDigest over 2024-03-10 = %+v, want one day of 2 messages without bodies", days)
+		}
+	})
+
+	t.Run("DeleteAllBatchResumesAfterInterruption", func(t *testing.T) {
+		s := newStore(t)
+		for i := 0; i < 7; i++ {
+			seed(t, s, message(fmt.Sprintf("b%d", i), "1111111111", "x", time.Duration(i)*time.Millisecond))
+		}
+
+		// One batch, then the loop is "interrupted"
+		n, err := s.DeleteAllBatch(3)
+		mustNoErr(t, err, "DeleteAllBatch")
+		if n != 3 {
+			t.Fatalf("first DeleteAllBatch = %d, want 3", n)
+		}
+
+		// A new loop picks up what is left without double counting
+		var resumed int64
+		for {
+			n, err := s.DeleteAllBatch(3)
+			mustNoErr(t, err, "resumed DeleteAllBatch")
+			if n == 0 {
+				break
+			}
+			resumed += n
+		}
+		if resumed != 4 {
+			t.Fatalf("resumed loop deleted %d, want 4", resumed)
+		}
+
+		count, err := s.Count()
+		mustNoErr(t, err, "Count")
+		if count != 0 {
+			t.Fatalf("Count after delete = %d, want 0", count)
+		}
+	})
+
+	t.Run("DropAllEmptiesAndStoreStaysUsable", func(t *testing.T) {
+		s := newStore(t)
+		seed(t, s, message("m1", "1111111111", "a", 0), message("m2", "2222222222", "b", time.Millisecond))
+
+		n, err := s.DropAll()
+		mustNoErr(t, err, "DropAll")
+		if n != 2 {
+			t.Fatalf("DropAll = %d, want 2", n)
+		}
+
+		seed(t, s, message("m3", "1111111111", "c", 2*time.Millisecond))
+		msgs, err := s.FindByPhoneNumber("1111111111")
+		mustNoErr(t, err, "FindByPhoneNumber after DropAll")
+		assertIDs(t, "messages after DropAll", ids(msgs), []string{"m3"})
+	})
+
+	t.Run("ConcurrentSaves", func(t *testing.T) {
+		s := newStore(t)
+		const workers, perWorker = 8, 25
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers*perWorker)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < perWorker; i++ {
+					id := fmt.Sprintf("w%d-%d", w, i)
+					if _, err := s.Save(message(id, "1111111111", id, time.Duration(i)*time.Millisecond)); err != nil {
+						errs <- err
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("concurrent Save: %v", err)
+		}
+
+		msgs, err := s.FindByPhoneNumber("1111111111")
+		mustNoErr(t, err, "FindByPhoneNumber")
+		if len(msgs) != workers*perWorker {
+			t.Fatalf("found %d messages after concurrent saves, want %d", len(msgs), workers*perWorker)
+		}
+	})
+}
+
+// RunTombstoningConformance checks that a store wrapped by
+// store.NewTombstoningStore rejects events buffered before a conversation
+// was deleted, while still accepting new ones.
+func RunTombstoningConformance(t *testing.T, newStore StoreFactory) {
+	t.Helper()
+
+	t.Run("ReplayedEventAfterDeleteIsRejected", func(t *testing.T) {
+		s := store.NewTombstoningStore(newStore(t), store.NewMemoryTombstoneStore(), time.Hour)
+		seed(t, s, message("m1", "1111111111", "before delete", 0))
+		_, err := s.DeleteByPhoneNumber("1111111111")
+		mustNoErr(t, err, "DeleteByPhoneNumber")
+
+		// The same buffered event and a batch carrying it arrive late
+		if _, err := s.Save(message("m2", "1111111111", "buffered", time.Second)); !errors.Is(err, store.ErrTombstoned) {
+			t.Fatalf("Save of buffered event: err = %v, want ErrTombstoned", err)
+		}
+		fresh := models.Message{ID: "m4", PhoneNumber: "1111111111", Text: "new", CreatedAt: time.Now().Add(time.Minute).Truncate(time.Millisecond)}
+		n, err := s.SaveBatch([]models.Message{
+			message("m3", "1111111111", "buffered", 2*time.Second),
+			fresh,
+			message("m5", "2222222222", "other conversation", 0),
+		})
+		mustNoErr(t, err, "SaveBatch")
+		if n != 2 {
+			t.Fatalf("SaveBatch = %d, want 2", n)
+		}
+
+		msgs, err := s.FindByPhoneNumber("1111111111")
+		mustNoErr(t, err, "FindByPhoneNumber")
+		assertIDs(t, "conversation after replay", ids(msgs), []string{"m4"})
+	})
+}
+
+// RunProfileStoreConformance runs every ProfileStore contract check against fresh stores from newStore.
+func RunProfileStoreConformance(t *testing.T, newStore ProfileStoreFactory) {
+	t.Helper()
+
+	t.Run("CreateThenGet", func(t *testing.T) {
+		s := newStore(t)
+		created, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "Ram"})
+		mustNoErr(t, err, "CreateProfile")
+		if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+			t.Fatalf("CreateProfile did not set timestamps: %+v", created)
+		}
+
+		got, err := s.GetProfile("1111111111")
+		mustNoErr(t, err, "GetProfile")
+		if got.Name != "Ram" {
+			t.Fatalf("GetProfile name = %q, want %q", got.Name, "Ram")
+		}
+	})
+
+	t.Run("CreateRequiresPhoneNumber", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.CreateProfile(models.Profile{Name: "nobody"}); err == nil {
+			t.Fatal("CreateProfile without phoneNumber succeeded")
+		}
+	})
+
+	t.Run("DuplicateCreateIsErrAlreadyExists", func(t *testing.T) {
+		s := newStore(t)
+		_, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "first"})
+		mustNoErr(t, err, "CreateProfile")
+
+		_, err = s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "second"})
+		if !errors.Is(err, store.ErrAlreadyExists) {
+			t.Fatalf("duplicate CreateProfile error = %v, want ErrAlreadyExists", err)
+		}
+
+		got, err := s.GetProfile("1111111111")
+		mustNoErr(t, err, "GetProfile")
+		if got.Name != "first" {
+			t.Fatalf("duplicate create overwrote profile: name = %q", got.Name)
+		}
+	})
+
+	t.Run("ConcurrentCreatesExactlyOneWins", func(t *testing.T) {
+		s := newStore(t)
+		const attempts = 50
+
+		var wg sync.WaitGroup
+		results := make(chan error, attempts)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: fmt.Sprint(i)})
+				results <- err
+			}(i)
+		}
+		wg.Wait()
+		close(results)
+
+		created, conflicts := 0, 0
+		for err := range results {
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, store.ErrAlreadyExists):
+				conflicts++
+			default:
+				t.Fatalf("concurrent CreateProfile: unexpected error %v", err)
+			}
+		}
+		if created != 1 || conflicts != attempts-1 {
+			t.Fatalf("concurrent creates: %d created, %d conflicts; want 1 and %d", created, conflicts, attempts-1)
+		}
+	})
+
+	t.Run("MissingIsErrNotFound", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.GetProfile("0000000000"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("GetProfile on missing profile error = %v, want ErrNotFound", err)
+		}
+		if _, err := s.UpdateProfile("0000000000", models.Profile{Name: "x"}); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("UpdateProfile on missing profile error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("UpdatePreservesCreatedAt", func(t *testing.T) {
+		s := newStore(t)
+		created, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "old"})
+		mustNoErr(t, err, "CreateProfile")
+
+		updated, err := s.UpdateProfile("1111111111", models.Profile{Name: "new", CreatedAt: base})
+		mustNoErr(t, err, "UpdateProfile")
+		if updated.Name != "new" {
+			t.Fatalf("UpdateProfile name = %q, want %q", updated.Name, "new")
+		}
+		// Allow for backends that store times at millisecond precision
+		if updated.CreatedAt.Sub(created.CreatedAt).Abs() >= time.Millisecond {
+			t.Fatalf("UpdateProfile changed createdAt from %v to %v", created.CreatedAt, updated.CreatedAt)
+		}
+		if updated.PhoneNumber != "1111111111" {
+			t.Fatalf("UpdateProfile phoneNumber = %q", updated.PhoneNumber)
+		}
+	})
+
+	t.Run("SearchProfilesByNameOrNumber", func(t *testing.T) {
+		s := newStore(t)
+		for _, p := range []models.Profile{
+			{PhoneNumber: "9000000001", Name: "Ramesh"},
+			{PhoneNumber: "9000000002", Name: "Suresh"},
+			{PhoneNumber: "9123400003", Name: "Anita"},
+		} {
+			_, err := s.CreateProfile(p)
+			mustNoErr(t, err, "CreateProfile")
+		}
+
+		byName, err := s.SearchProfiles("RAM", 10)
+		mustNoErr(t, err, "SearchProfiles by name")
+		assertIDs(t, "SearchProfiles by name", profileNumbers(byName), []string{"9000000001"})
+
+		byNumber, err := s.SearchProfiles("91234", 10)
+		mustNoErr(t, err, "SearchProfiles by number")
+		assertIDs(t, "SearchProfiles by number", profileNumbers(byNumber), []string{"9123400003"})
+
+		none, err := s.SearchProfiles("zzz", 10)
+		mustNoErr(t, err, "SearchProfiles without matches")
+		if none == nil || len(none) != 0 {
+			t.Fatalf("SearchProfiles without matches = %#v, want empty non-nil slice", none)
+		}
+	})
+
+	t.Run("GetProfilesSkipsMissingNumbers", func(t *testing.T) {
+		s := newStore(t)
+		for _, p := range []models.Profile{
+			{PhoneNumber: "9000000001", Name: "Ramesh"},
+			{PhoneNumber: "9000000002", Name: "Suresh"},
+		} {
+			_, err := s.CreateProfile(p)
+			mustNoErr(t, err, "CreateProfile")
+		}
+
+		got, err := s.GetProfiles([]string{"9000000001", "9000000003"})
+		mustNoErr(t, err, "GetProfiles")
+		if len(got) != 1 || got["9000000001"].Name != "Ramesh" {
+			t.Fatalf("GetProfiles = %#v, want only 9000000001", got)
+		}
+
+		none, err := s.GetProfiles(nil)
+		mustNoErr(t, err, "GetProfiles without numbers")
+		if none == nil || len(none) != 0 {
+			t.Fatalf("GetProfiles without numbers = %#v, want empty non-nil map", none)
+		}
+	})
+
+	t.Run("DeleteProfile", func(t *testing.T) {
+		s := newStore(t)
+		_, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "Ram"})
+		mustNoErr(t, err, "CreateProfile")
+
+		mustNoErr(t, s.DeleteProfile("1111111111"), "DeleteProfile")
+		if _, err := s.GetProfile("1111111111"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("GetProfile after DeleteProfile error = %v, want ErrNotFound", err)
+		}
+		if err := s.DeleteProfile("1111111111"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("DeleteProfile on missing profile error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("UpdateProfileIfVersionRejectsStaleVersion", func(t *testing.T) {
+		s := newStore(t)
+		created, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "Ram"})
+		mustNoErr(t, err, "CreateProfile")
+
+		// Two editors read the same version; the first write wins and the
+		// second is told the version it missed
+		first, err := s.UpdateProfileIfVersion("1111111111", models.Profile{Name: "Ramesh"}, created.Version)
+		mustNoErr(t, err, "UpdateProfileIfVersion by the first editor")
+		if first.Version != created.Version+1 {
+			t.Fatalf("UpdateProfileIfVersion version = %d, want %d", first.Version, created.Version+1)
+		}
+		_, err = s.UpdateProfileIfVersion("1111111111", models.Profile{Name: "Ram Kumar"}, created.Version)
+		var conflict *store.VersionConflictError
+		if !errors.As(err, &conflict) || !errors.Is(err, store.ErrVersionConflict) {
+			t.Fatalf("UpdateProfileIfVersion by the second editor error = %v, want a *VersionConflictError", err)
+		}
+		if conflict.Expected != created.Version || conflict.Current != first.Version {
+			t.Fatalf("VersionConflictError = %+v, want expected %d and current %d", conflict, created.Version, first.Version)
+		}
+
+		got, err := s.GetProfile("1111111111")
+		mustNoErr(t, err, "GetProfile")
+		if got.Name != "Ramesh" {
+			t.Fatalf("GetProfile name = %q after the rejected update, want %q", got.Name, "Ramesh")
+		}
+
+		// Without a precondition the last write still wins
+		_, err = s.UpdateProfile("1111111111", models.Profile{Name: "Ram Kumar"})
+		mustNoErr(t, err, "UpdateProfile")
+
+		if _, err := s.UpdateProfileIfVersion("0000000000", models.Profile{Name: "x"}, 1); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("UpdateProfileIfVersion on missing profile error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("ConcurrentEnsureProfileCreatesOnce", func(t *testing.T) {
+		s := newStore(t)
+		const attempts = 50
+
+		var wg sync.WaitGroup
+		type result struct {
+			profile models.Profile
+			created bool
+			err     error
+		}
+		results := make(chan result, attempts)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p, created, err := s.EnsureProfile(models.Profile{PhoneNumber: "1111111111", Name: "1111111111", Source: models.ProfileSourceAuto})
+				results <- result{p, created, err}
+			}()
+		}
+		wg.Wait()
+		close(results)
+
+		created := 0
+		for r := range results {
+			mustNoErr(t, r.err, "concurrent EnsureProfile")
+			if r.created {
+				created++
+			}
+			if r.profile.PhoneNumber != "1111111111" || r.profile.Source != models.ProfileSourceAuto {
+				t.Fatalf("EnsureProfile = %+v, want the auto profile of 1111111111", r.profile)
+			}
+		}
+		if created != 1 {
+			t.Fatalf("concurrent EnsureProfile created %d profiles, want 1", created)
+		}
+	})
+
+	t.Run("EnsureProfileKeepsExistingProfile", func(t *testing.T) {
+		s := newStore(t)
+		_, err := s.CreateProfile(models.Profile{PhoneNumber: "1111111111", Name: "Ram"})
+		mustNoErr(t, err, "CreateProfile")
+
+		got, created, err := s.EnsureProfile(models.Profile{PhoneNumber: "1111111111", Name: "1111111111", Source: models.ProfileSourceAuto})
+		mustNoErr(t, err, "EnsureProfile")
+		if created || got.Name != "Ram" || got.Source == models.ProfileSourceAuto {
+			t.Fatalf("EnsureProfile on a manual profile = %+v, created %v; want it unchanged", got, created)
+		}
+		if _, _, err := s.EnsureProfile(models.Profile{Name: "nobody"}); err == nil {
+			t.Fatal("EnsureProfile without phoneNumber succeeded")
+		}
+	})
+}
+
+// RunDeletionReceiptConformance runs every DeletionReceiptStore contract
+// check against fresh stores from newStore.
+func RunDeletionReceiptConformance(t *testing.T, newStore DeletionReceiptStoreFactory) {
+	t.Helper()
+
+	t.Run("ReceiptsListNewestFirstAndFilter", func(t *testing.T) {
+		s := newStore(t)
+		for i, phoneNumber := range []string{"1111111111", "2222222222", "1111111111", ""} {
+			r, err := s.RecordDeletion(models.DeletionReceipt{
+				At:          base.Add(time.Duration(i) * time.Hour),
+				Operation:   models.DeletionConversation,
+				PhoneNumber: phoneNumber,
+				Matched:     map[string]int64{models.DeletedMessages: int64(i)},
+			})
+			mustNoErr(t, err, "RecordDeletion")
+			if r.ID == "" {
+				t.Fatal("RecordDeletion did not assign an ID")
+			}
+		}
+
+		all, err := s.ListDeletionReceipts(store.DeletionReceiptQuery{})
+		mustNoErr(t, err, "ListDeletionReceipts")
+		if len(all) != 4 || !all[0].At.Equal(base.Add(3*time.Hour)) || !all[3].At.Equal(base) {
+			t.Fatalf("ListDeletionReceipts = %+v, want 4 receipts newest first", all)
+		}
+		if all[1].Matched[models.DeletedMessages] != 2 {
+			t.Fatalf("receipt matched = %v, want %d messages", all[1].Matched, 2)
+		}
+
+		conversation, err := s.ListDeletionReceipts(store.DeletionReceiptQuery{PhoneNumber: "1111111111"})
+		mustNoErr(t, err, "ListDeletionReceipts by phone number")
+		if len(conversation) != 2 || !conversation[0].At.Equal(base.Add(2*time.Hour)) {
+			t.Fatalf("receipts of 1111111111 = %+v, want 2 newest first", conversation)
+		}
+
+		window, err := s.ListDeletionReceipts(store.DeletionReceiptQuery{From: base.Add(time.Hour), To: base.Add(3 * time.Hour)})
+		mustNoErr(t, err, "ListDeletionReceipts by time")
+		if len(window) != 2 || window[0].PhoneNumber != "1111111111" || window[1].PhoneNumber != "2222222222" {
+			t.Fatalf("receipts from 1h to 3h = %+v, want the second and third", window)
+		}
+
+		limited, err := s.ListDeletionReceipts(store.DeletionReceiptQuery{Limit: 1})
+		mustNoErr(t, err, "ListDeletionReceipts with a limit")
+		if len(limited) != 1 || limited[0].ID != all[0].ID {
+			t.Fatalf("receipts with limit 1 = %+v, want the newest", limited)
+		}
+	})
+
+	t.Run("EmptyListIsNonNil", func(t *testing.T) {
+		s := newStore(t)
+		none, err := s.ListDeletionReceipts(store.DeletionReceiptQuery{PhoneNumber: "0000000000"})
+		mustNoErr(t, err, "ListDeletionReceipts")
+		if none == nil || len(none) != 0 {
+			t.Fatalf("ListDeletionReceipts without matches = %#v, want empty non-nil slice", none)
+		}
+	})
+}
+
+/* ---------- helpers ---------- */
+
+func seed(t *testing.T, s store.Store, msgs ...models.Message) {
+	t.Helper()
+	if _, err := s.SaveBatch(msgs); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+}
+
+func mustNoErr(t *testing.T, err error, op string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", op, err)
+	}
+}
+
+func ids(msgs []models.Message) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.ID
+	}
+	return out
+}
+
+func sortedIDs(msgs []models.Message) []string {
+	out := ids(msgs)
+	sort.Strings(out)
+	return out
+}
+
+func profileNumbers(profiles []models.Profile) []string {
+	out := make([]string, len(profiles))
+	for i, p := range profiles {
+		out[i] = p.PhoneNumber
+	}
+	sort.Strings(out)
+	return out
+}
+
+func assertIDs(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"log"
+	"sync"
+
+	"sms-store/internal/models"
+)
+
+// SummarizingStore wraps a Store so every write keeps the conversation
+// summaries in a SummaryStore up to date. A failed summary update is logged
+// rather than failing the write; the drift it leaves is found by comparing
+// summaries with ComputeSummaries and repaired with RebuildSummaries.
+type SummarizingStore struct {
+	Store
+	summaries SummaryStore
+
+	mu      sync.Mutex
+	deleted map[string]bool // Conversations that lost messages to the store itself
+}
+
+// NewSummarizingStore wraps s, maintaining summaries in ss.
+func NewSummarizingStore(s Store, ss SummaryStore) *SummarizingStore {
+	return &SummarizingStore{Store: s, summaries: ss}
+}
+
+// MessagesDeleted takes note of messages the store deleted on its own, as
+// a MemoryStore does when evicting, e.g.
+//
+//	mem.OnMessagesDeleted(summarizing.MessagesDeleted)
+//
+// Their conversations are rebuilt once the write that caused the deletion
+// has been applied, since the summaries don't have the write's messages yet.
+func (s *SummarizingStore) MessagesDeleted(ev MessagesDeleted) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.deleted == nil {
+		s.deleted = make(map[string]bool)
+	}
+	for _, pn := range batchPhoneNumbers(ev.Messages) {
+		s.deleted[pn] = true
+	}
+}
+
+// Save stores msg and adds it to its conversation's summary.
+func (s *SummarizingStore) Save(msg models.Message) (models.Message, error) {
+	saved, err := s.Store.Save(msg)
+	if err != nil {
+		return saved, err
+	}
+	s.apply([]models.Message{saved})
+	s.rebuildDeleted()
+	return saved, nil
+}
+
+// SaveBatch stores msgs and adds them to their summaries. When some were
+// skipped, as duplicates or by a wrapped store, it can't tell which, so the
+// batch's conversations are rebuilt from their messages instead.
+func (s *SummarizingStore) SaveBatch(msgs []models.Message) (int, error) {
+	count, err := s.Store.SaveBatch(msgs)
+	if count == len(msgs) && err == nil {
+		s.apply(msgs)
+		s.rebuildDeleted()
+		return count, nil
+	}
+	if count > 0 {
+		s.rebuild(batchPhoneNumbers(msgs))
+	}
+	s.rebuildDeleted()
+	return count, err
+}
+
+// UpdateMessage patches a message. A text change may change the preview,
+// so the conversation's summary is rebuilt.
+func (s *SummarizingStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	msg, err := s.Store.UpdateMessage(id, patch)
+	if err == nil && patch.Text != nil {
+		s.rebuild([]string{msg.PhoneNumber})
+	}
+	return msg, err
+}
+
+// DeleteByPhoneNumber deletes a conversation and its summary.
+func (s *SummarizingStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	n, err := s.Store.DeleteByPhoneNumber(phoneNumber)
+	if err != nil {
+		return n, err
+	}
+	if err := s.summaries.DeleteSummary(phoneNumber); err != nil {
+		log.Printf("Failed to delete conversation summary %s: %v", phoneNumber, err)
+	}
+	return n, nil
+}
+
+// DeleteAll deletes every message and summary.
+func (s *SummarizingStore) DeleteAll() (int64, error) {
+	n, err := s.Store.DeleteAll()
+	if err == nil {
+		s.deleteAll()
+	}
+	return n, err
+}
+
+// DeleteAllBatch deletes a batch of messages. Summaries are removed once
+// the store is empty, when a call deletes nothing.
+func (s *SummarizingStore) DeleteAllBatch(limit int) (int64, error) {
+	n, err := s.Store.DeleteAllBatch(limit)
+	if err == nil && n == 0 {
+		s.deleteAll()
+	}
+	return n, err
+}
+
+// DropAll drops every message and summary.
+func (s *SummarizingStore) DropAll() (int64, error) {
+	n, err := s.Store.DropAll()
+	if err == nil {
+		s.deleteAll()
+	}
+	return n, err
+}
+
+func (s *SummarizingStore) apply(msgs []models.Message) {
+	if err := s.summaries.ApplyMessages(msgs); err != nil {
+		log.Printf("Failed to update conversation summaries: %v", err)
+	}
+}
+
+func (s *SummarizingStore) rebuild(phoneNumbers []string) {
+	if _, err := s.summaries.RebuildSummaries(phoneNumbers); err != nil {
+		log.Printf("Failed to rebuild conversation summaries: %v", err)
+	}
+}
+
+// rebuildDeleted rebuilds the conversations MessagesDeleted noted.
+func (s *SummarizingStore) rebuildDeleted() {
+	s.mu.Lock()
+	if len(s.deleted) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	phoneNumbers := make([]string, 0, len(s.deleted))
+	for pn := range s.deleted {
+		phoneNumbers = append(phoneNumbers, pn)
+	}
+	s.deleted = nil
+	s.mu.Unlock()
+
+	s.rebuild(phoneNumbers)
+}
+
+func (s *SummarizingStore) deleteAll() {
+	if err := s.summaries.DeleteAllSummaries(); err != nil {
+		log.Printf("Failed to delete conversation summaries: %v", err)
+	}
+}
+
+// batchPhoneNumbers returns the distinct phone numbers of msgs, leaving out
+// the empty one of group messages.
+func batchPhoneNumbers(msgs []models.Message) []string {
+	seen := make(map[string]bool)
+	phoneNumbers := make([]string, 0)
+	for _, msg := range msgs {
+		if msg.PhoneNumber != "" && !seen[msg.PhoneNumber] {
+			seen[msg.PhoneNumber] = true
+			phoneNumbers = append(phoneNumbers, msg.PhoneNumber)
+		}
+	}
+	return phoneNumbers
+}
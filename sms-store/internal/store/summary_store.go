@@ -0,0 +1,1116 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/models"
+)
+
+// summaryPreviewLength is how many characters of the last message a summary keeps.
+const summaryPreviewLength = 100
+
+// ConversationSummary is the pre-aggregated state of one conversation.
+type ConversationSummary struct {
+	PhoneNumber   string    `json:"phoneNumber" bson:"_id"`
+	LastMessageAt time.Time `json:"lastMessageAt" bson:"lastMessageAt"`
+	LastMessageID string    `json:"lastMessageId" bson:"lastMessageId"`
+	Preview       string    `json:"preview" bson:"preview"` // Start of the last message's text
+	MessageCount  int64     `json:"messageCount" bson:"messageCount"`
+	SenderType    string    `json:"senderType,omitempty" bson:"senderType,omitempty"` // models.ClassifySender of PhoneNumber
+
+	// Messages by detected language code, and the language most are in
+	// apart from models.LanguageUndetermined. Messages stored without a
+	// language aren't counted
+	LanguageCounts map[string]int64 `json:"languageCounts,omitempty" bson:"languageCounts,omitempty"`
+	Language       string           `json:"language,omitempty" bson:"language,omitempty"`
+
+	// Set on conversations opened by CreateEmptySummary; while MessageCount
+	// is 0 it dates the conversation for expiry
+	CreatedAt *time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+
+	// Lifecycle state, stored empty while the conversation is open. Rebuilds
+	// keep it; read it with EffectiveState
+	State          string     `json:"state" bson:"state,omitempty"`
+	SnoozedUntil   *time.Time `json:"snoozedUntil,omitempty" bson:"snoozedUntil,omitempty"`
+	StateChangedAt *time.Time `json:"stateChangedAt,omitempty" bson:"stateChangedAt,omitempty"`
+
+	// Set with SetAttributes as the account's models.AttributeSchema allows
+	// when written. Rebuilds keep them
+	CustomAttributes map[string]any `json:"customAttributes,omitempty" bson:"customAttributes,omitempty"`
+
+	// When the conversation was last sent an automatic acknowledgement, as
+	// claimed with ClaimAutoAck. Rebuilds keep it
+	AutoAckedAt *time.Time `json:"autoAckedAt,omitempty" bson:"autoAckedAt,omitempty"`
+
+	// When any of the above last changed; ListChangedSummaries reads by it
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// EffectiveState returns the conversation's lifecycle state at now: a
+// snooze that has ended leaves the conversation open.
+func (s ConversationSummary) EffectiveState(now time.Time) string {
+	switch {
+	case s.State == models.ConversationSnoozed && s.SnoozedUntil != nil && now.Before(*s.SnoozedUntil):
+		return models.ConversationSnoozed
+	case s.State == models.ConversationClosed:
+		return models.ConversationClosed
+	default:
+		return models.ConversationOpen
+	}
+}
+
+// Current returns s as read at now, its State set to EffectiveState and its
+// snooze cleared once it has ended.
+func (s ConversationSummary) Current(now time.Time) ConversationSummary {
+	if s.SenderType == "" { // Summaries written before it was stored, or by a full rebuild
+		s.SenderType = models.ClassifySender(s.PhoneNumber)
+	}
+	s.State = s.EffectiveState(now)
+	if s.State != models.ConversationSnoozed {
+		s.SnoozedUntil = nil
+	}
+	return s
+}
+
+// StateChange is a lifecycle transition applied with SetState.
+type StateChange struct {
+	State        string     // One of the models.Conversation* states
+	SnoozedUntil *time.Time // Set with models.ConversationSnoozed only
+	At           time.Time
+}
+
+// ChangeQuery selects records changed after a position and before a time,
+// in the order of their change time and phone number.
+type ChangeQuery struct {
+	After            time.Time // Changed after this, or at it with a greater phone number
+	AfterPhoneNumber string
+	Until            time.Time // Changed before this; zero is unbounded
+	Limit            int
+}
+
+// Includes reports whether a record of phoneNumber changed at changedAt
+// falls within q.
+func (q ChangeQuery) Includes(changedAt time.Time, phoneNumber string) bool {
+	if !q.Until.IsZero() && !changedAt.Before(q.Until) {
+		return false
+	}
+	return changedAt.After(q.After) || changedAt.Equal(q.After) && phoneNumber > q.AfterPhoneNumber
+}
+
+// SummaryStore keeps one ConversationSummary per conversation, updated as
+// messages are written so reads don't have to aggregate the messages.
+type SummaryStore interface {
+	// ApplyMessages folds newly stored messages into their conversations'
+	// summaries, creating summaries as needed.
+	ApplyMessages(msgs []models.Message) error
+
+	// DeleteSummary removes the summary of a deleted conversation.
+	DeleteSummary(phoneNumber string) error
+
+	// DeleteAllSummaries removes every summary.
+	DeleteAllSummaries() error
+
+	// GetSummaries returns the stored summaries of phoneNumbers. Numbers
+	// without a summary are omitted.
+	GetSummaries(phoneNumbers []string) (map[string]ConversationSummary, error)
+
+	// SampleSummaries returns up to n stored summaries chosen at random.
+	SampleSummaries(n int) ([]ConversationSummary, error)
+
+	// ComputeSummaries builds the summaries of phoneNumbers, or of every
+	// conversation when phoneNumbers is nil, from the messages themselves,
+	// without storing them. Numbers without messages are omitted.
+	ComputeSummaries(phoneNumbers []string) (map[string]ConversationSummary, error)
+
+	// RebuildSummaries replaces the stored summaries of phoneNumbers, or of
+	// every conversation when phoneNumbers is nil, with computed ones,
+	// keeping their lifecycle state, and removes summaries of conversations
+	// without messages. Returns how many
+	// summaries were written.
+	RebuildSummaries(phoneNumbers []string) (int64, error)
+
+	// CreateEmptySummary opens phoneNumber's conversation with no messages
+	// at time at, unless it already has a summary. Returns the summary and
+	// whether it was created. Rebuilds keep empty summaries.
+	CreateEmptySummary(phoneNumber string, at time.Time) (ConversationSummary, bool, error)
+
+	// ListEmptySummaries returns the summaries of conversations opened
+	// without messages that still have none.
+	ListEmptySummaries() ([]ConversationSummary, error)
+
+	// ListSummaries returns up to limit summaries of conversations with
+	// messages whose phone numbers sort after afterPhoneNumber, in phone
+	// number order, so callers can page through every conversation.
+	ListSummaries(afterPhoneNumber string, limit int) ([]ConversationSummary, error)
+
+	// DeleteEmptySummaries removes the summaries of conversations opened
+	// before cutoff that still have no messages. Returns how many it removed.
+	DeleteEmptySummaries(cutoff time.Time) (int64, error)
+
+	// SetState applies change to phoneNumber's summary if its stored state
+	// is still from, as read from the summary, and returns the updated
+	// summary and whether it was changed. A conversation without a summary
+	// is ErrNotFound.
+	SetState(phoneNumber string, from string, change StateChange) (ConversationSummary, bool, error)
+
+	// SetAttributes sets the custom attributes set and removes those named
+	// in unset on phoneNumber's summary, leaving the others, and returns
+	// the updated summary. A conversation without a summary is ErrNotFound.
+	SetAttributes(phoneNumber string, set map[string]any, unset []string) (ConversationSummary, error)
+
+	// FindByAttributes returns the phone numbers of the conversations whose
+	// custom attributes hold every value of filter.
+	FindByAttributes(filter map[string]any) ([]string, error)
+
+	// EnsureAttributeIndex indexes the custom attribute name, so filters on
+	// it don't scan every summary.
+	EnsureAttributeIndex(name string) error
+
+	// ListChangedSummaries returns up to q.Limit summaries changed within q,
+	// oldest change first.
+	ListChangedSummaries(q ChangeQuery) ([]ConversationSummary, error)
+
+	// ClaimAutoAck records at as when phoneNumber's conversation was sent
+	// an automatic acknowledgement, unless one was claimed after since, and
+	// returns whether it did. The check and the write are one atomic step,
+	// so of callers racing for a conversation only one claims it. A
+	// conversation without a summary yet is claimed on a new one, which
+	// ApplyMessages fills in.
+	ClaimAutoAck(phoneNumber string, since, at time.Time) (bool, error)
+}
+
+// summaryPreview returns the preview kept for a message text.
+func summaryPreview(text string) string {
+	runes := []rune(text)
+	if len(runes) <= summaryPreviewLength {
+		return text
+	}
+	return string(runes[:summaryPreviewLength])
+}
+
+// newerMessage reports whether a sorts after b in newest-first order.
+func newerMessage(a, b models.Message) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+// counted reports whether msg counts towards its conversation's summary and
+// unread count: duplicates and automatic acknowledgements don't.
+func counted(msg models.Message) bool {
+	return msg.DuplicateOf == "" && msg.Source != models.MessageSourceAutoAck
+}
+
+// summaryDeltas groups msgs by conversation into the count and newest
+// message each conversation gains. Group messages have no phone number and
+// no summary, and only counted messages count.
+func summaryDeltas(msgs []models.Message) map[string]ConversationSummary {
+	deltas := make(map[string]ConversationSummary)
+	newest := make(map[string]models.Message)
+	for _, msg := range msgs {
+		if msg.PhoneNumber == "" || !counted(msg) {
+			continue
+		}
+		d := deltas[msg.PhoneNumber]
+		d.PhoneNumber = msg.PhoneNumber
+		d.SenderType = models.ClassifySender(msg.PhoneNumber)
+		d.MessageCount++
+		if msg.Language != nil {
+			if d.LanguageCounts == nil {
+				d.LanguageCounts = make(map[string]int64)
+			}
+			d.LanguageCounts[languageCode(msg)]++
+			d.Language = dominantLanguage(d.LanguageCounts)
+		}
+		if n, ok := newest[msg.PhoneNumber]; !ok || newerMessage(msg, n) {
+			newest[msg.PhoneNumber] = msg
+			d.LastMessageAt = msg.CreatedAt
+			d.LastMessageID = msg.ID
+			d.Preview = summaryPreview(msg.Text)
+		}
+		deltas[msg.PhoneNumber] = d
+	}
+	return deltas
+}
+
+// MongoSummaryStore implements SummaryStore with a collection next to a
+// MongoStore's messages collection, keyed by phone number.
+type MongoSummaryStore struct {
+	messages  *mongo.Collection
+	summaries *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoSummaryStore keeps the summaries of s's messages in
+// collectionName in the same database.
+func NewMongoSummaryStore(s *MongoStore, collectionName string) *MongoSummaryStore {
+	if collectionName == "" {
+		collectionName = "conversation_summaries"
+	}
+	summaries := s.database.Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Serves the change feed, and the sweep of stale summaries after a rebuild
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "updatedAt", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("updatedAt_id_idx"),
+	}
+	if _, err := summaries.Indexes().CreateOne(ctx, indexModel); err != nil {
+		log.Printf("Warning: could not ensure summary index on %s: %v", collectionName, err)
+	}
+
+	return &MongoSummaryStore{messages: s.collection, summaries: summaries}
+}
+
+// ApplyMessages upserts one summary per conversation in msgs. The last
+// message only moves forward, so batches applied out of order still leave
+// the newest message in place.
+func (s *MongoSummaryStore) ApplyMessages(msgs []models.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := s.Clock().Now()
+	writes := make([]mongo.WriteModel, 0)
+	for pn, d := range summaryDeltas(msgs) {
+		newer := bson.M{"$or": bson.A{
+			bson.M{"$gt": bson.A{d.LastMessageAt, bson.M{"$ifNull": bson.A{"$lastMessageAt", time.Time{}}}}},
+			bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{d.LastMessageAt, "$lastMessageAt"}},
+				bson.M{"$gt": bson.A{d.LastMessageID, "$lastMessageId"}},
+			}},
+		}}
+		set := bson.M{
+			"messageCount":  bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$messageCount", 0}}, d.MessageCount}},
+			"lastMessageAt": bson.M{"$cond": bson.A{newer, d.LastMessageAt, "$lastMessageAt"}},
+			"lastMessageId": bson.M{"$cond": bson.A{newer, d.LastMessageID, "$lastMessageId"}},
+			"preview":       bson.M{"$cond": bson.A{newer, d.Preview, "$preview"}},
+			"senderType":    d.SenderType,
+			"updatedAt":     now,
+		}
+		for code, n := range d.LanguageCounts {
+			field := "languageCounts." + code
+			set[field] = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + field, 0}}, n}}
+		}
+		update := mongo.Pipeline{{{Key: "$set", Value: set}}}
+		if len(d.LanguageCounts) > 0 {
+			update = append(update, bson.D{{Key: "$set", Value: bson.M{"language": dominantLanguageExpr}}})
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": pn}).
+			SetUpdate(update).
+			SetUpsert(true))
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	if _, err := s.summaries.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to update conversation summaries: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoSummaryStore) DeleteSummary(phoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.summaries.DeleteOne(ctx, bson.M{"_id": phoneNumber})
+	return err
+}
+
+func (s *MongoSummaryStore) DeleteAllSummaries() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.summaries.DeleteMany(ctx, bson.M{})
+	return err
+}
+
+func (s *MongoSummaryStore) GetSummaries(phoneNumbers []string) (map[string]ConversationSummary, error) {
+	if len(phoneNumbers) == 0 {
+		return map[string]ConversationSummary{}, nil
+	}
+	return s.findSummaries(bson.M{"_id": bson.M{"$in": phoneNumbers}})
+}
+
+func (s *MongoSummaryStore) SampleSummaries(n int) ([]ConversationSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := s.summaries.Aggregate(ctx, mongo.Pipeline{{{Key: "$sample", Value: bson.M{"size": n}}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample conversation summaries: %w", err)
+	}
+	summaries := []ConversationSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (s *MongoSummaryStore) findSummaries(filter bson.M) (map[string]ConversationSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.summaries.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation summaries: %w", err)
+	}
+	var rows []ConversationSummary
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	summaries := make(map[string]ConversationSummary, len(rows))
+	for _, row := range rows {
+		summaries[row.PhoneNumber] = row
+	}
+	return summaries, nil
+}
+
+// hasPhoneNumber matches the phone number of direct messages; group
+// messages store an empty one and have no summary.
+var hasPhoneNumber = bson.M{"$gt": ""}
+
+// countedMessage matches the messages that count towards their summary, as
+// counted.
+var countedMessage = bson.M{"duplicateOf": bson.M{"$exists": false}, "source": bson.M{"$ne": models.MessageSourceAutoAck}}
+
+// dominantLanguageExpr computes dominantLanguage of a summary's
+// languageCounts in an aggregation expression.
+var dominantLanguageExpr = bson.M{"$let": bson.M{
+	"vars": bson.M{"top": bson.M{"$reduce": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$languageCounts", bson.M{}}}},
+			"cond": bson.M{"$and": bson.A{
+				bson.M{"$ne": bson.A{"$$this.k", models.LanguageUndetermined}},
+				bson.M{"$gt": bson.A{"$$this.v", 0}},
+			}},
+		}},
+		"initialValue": bson.M{"k": "", "v": 0},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"$gt": bson.A{"$$this.v", "$$value.v"}},
+				bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$$this.v", "$$value.v"}},
+					bson.M{"$lt": bson.A{"$$this.k", "$$value.k"}},
+				}},
+			}},
+			"$$this",
+			"$$value",
+		}},
+	}}},
+	"in": "$$top.k",
+}}
+
+// summaryPipeline aggregates the messages matching match into summaries,
+// newest message first within each conversation as the
+// phoneNumber_createdAt_id index orders them. Uncounted messages are left
+// out.
+// Messages are grouped by conversation and language first, to count the
+// languages, then by conversation.
+func summaryPipeline(match bson.M) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$match", Value: countedMessage}},
+		{{Key: "$sort", Value: bson.D{{Key: "phoneNumber", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           bson.M{"phoneNumber": "$phoneNumber", "language": "$language.code"},
+			"lastMessageAt": bson.M{"$first": "$createdAt"},
+			"lastMessageId": bson.M{"$first": "$id"},
+			"preview":       bson.M{"$first": bson.M{"$substrCP": bson.A{"$text", 0, summaryPreviewLength}}},
+			"messageCount":  bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.phoneNumber", Value: 1}, {Key: "lastMessageAt", Value: -1}, {Key: "lastMessageId", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           "$_id.phoneNumber",
+			"lastMessageAt": bson.M{"$first": "$lastMessageAt"},
+			"lastMessageId": bson.M{"$first": "$lastMessageId"},
+			"preview":       bson.M{"$first": "$preview"},
+			"messageCount":  bson.M{"$sum": "$messageCount"},
+			"languages":     bson.M{"$push": bson.M{"k": "$_id.language", "v": "$messageCount"}},
+		}}},
+		{{Key: "$set", Value: bson.M{"languageCounts": bson.M{"$arrayToObject": bson.M{"$filter": bson.M{
+			"input": "$languages",
+			"cond":  bson.M{"$eq": bson.A{bson.M{"$type": "$$this.k"}, "string"}},
+		}}}}}},
+		{{Key: "$set", Value: bson.M{"language": dominantLanguageExpr}}},
+		{{Key: "$unset", Value: "languages"}},
+	}
+}
+
+func (s *MongoSummaryStore) ComputeSummaries(phoneNumbers []string) (map[string]ConversationSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	match := bson.M{"phoneNumber": hasPhoneNumber}
+	if phoneNumbers != nil {
+		match["phoneNumber"] = bson.M{"$in": phoneNumbers}
+	}
+	cursor, err := s.messages.Aggregate(ctx, summaryPipeline(match), options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute conversation summaries: %w", err)
+	}
+	var rows []ConversationSummary
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	summaries := make(map[string]ConversationSummary, len(rows))
+	for _, row := range rows {
+		summaries[row.PhoneNumber] = row
+	}
+	return summaries, nil
+}
+
+// RebuildSummaries of every conversation merges the aggregation into the
+// collection server-side, then removes summaries it didn't touch. Summaries
+// updated by writes during the rebuild are newer and survive.
+func (s *MongoSummaryStore) RebuildSummaries(phoneNumbers []string) (int64, error) {
+	if phoneNumbers != nil {
+		return s.rebuildSome(phoneNumbers)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	start := s.Clock().Now()
+	pipeline := append(summaryPipeline(bson.M{"phoneNumber": hasPhoneNumber}),
+		bson.D{{Key: "$set", Value: bson.M{"updatedAt": start}}},
+		bson.D{{Key: "$merge", Value: bson.M{
+			"into":           s.summaries.Name(),
+			"on":             "_id",
+			"whenMatched":    "merge", // Keeps the lifecycle state
+			"whenNotMatched": "insert",
+		}}},
+	)
+	cursor, err := s.messages.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild conversation summaries: %w", err)
+	}
+	cursor.Close(ctx)
+
+	stale := bson.M{"updatedAt": bson.M{"$lt": start}, "messageCount": bson.M{"$ne": 0}}
+	if _, err := s.summaries.DeleteMany(ctx, stale); err != nil {
+		return 0, fmt.Errorf("failed to remove stale conversation summaries: %w", err)
+	}
+	return s.summaries.CountDocuments(ctx, bson.M{})
+}
+
+func (s *MongoSummaryStore) rebuildSome(phoneNumbers []string) (int64, error) {
+	computed, err := s.ComputeSummaries(phoneNumbers)
+	if err != nil {
+		return 0, err
+	}
+	if len(phoneNumbers) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := s.Clock().Now()
+	writes := make([]mongo.WriteModel, 0, len(phoneNumbers))
+	for _, pn := range phoneNumbers {
+		summary, ok := computed[pn]
+		if !ok {
+			writes = append(writes, mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": pn, "messageCount": bson.M{"$ne": 0}}))
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": pn}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"lastMessageAt":  summary.LastMessageAt,
+				"lastMessageId":  summary.LastMessageID,
+				"preview":        summary.Preview,
+				"messageCount":   summary.MessageCount,
+				"senderType":     summary.SenderType,
+				"languageCounts": summary.LanguageCounts,
+				"language":       summary.Language,
+				"updatedAt":      now,
+			}}).
+			SetUpsert(true))
+	}
+	if _, err := s.summaries.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, fmt.Errorf("failed to rebuild conversation summaries: %w", err)
+	}
+	return int64(len(computed)), nil
+}
+
+// CreateEmptySummary inserts the summary only if none exists, in one
+// upsert, so it never resets a conversation that gained messages.
+func (s *MongoSummaryStore) CreateEmptySummary(phoneNumber string, at time.Time) (ConversationSummary, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	senderType := models.ClassifySender(phoneNumber)
+	update := bson.M{"$setOnInsert": bson.M{"messageCount": 0, "senderType": senderType, "createdAt": at, "updatedAt": at}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	var existing ConversationSummary
+	err := s.summaries.FindOneAndUpdate(ctx, bson.M{"_id": phoneNumber}, update, opts).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return ConversationSummary{PhoneNumber: phoneNumber, SenderType: senderType, CreatedAt: &at}, true, nil
+	}
+	if err != nil {
+		return ConversationSummary{}, false, fmt.Errorf("failed to create conversation summary: %w", err)
+	}
+	return existing, false, nil
+}
+
+func (s *MongoSummaryStore) ListEmptySummaries() ([]ConversationSummary, error) {
+	summaries, err := s.findSummaries(bson.M{"messageCount": 0})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ConversationSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		out = append(out, summary)
+	}
+	return out, nil
+}
+
+// ListSummaries walks the _id index from afterPhoneNumber.
+func (s *MongoSummaryStore) ListSummaries(afterPhoneNumber string, limit int) ([]ConversationSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": bson.M{"$gt": afterPhoneNumber}, "messageCount": bson.M{"$gt": 0}}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := s.summaries.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation summaries: %w", err)
+	}
+	summaries := []ConversationSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (s *MongoSummaryStore) DeleteEmptySummaries(cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := s.summaries.DeleteMany(ctx, bson.M{"messageCount": 0, "createdAt": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove empty conversation summaries: %w", err)
+	}
+	return res.DeletedCount, nil
+}
+
+// SetState changes the state in one conditional update, so a transition
+// racing another one from the same state loses rather than overwriting it.
+func (s *MongoSummaryStore) SetState(phoneNumber string, from string, change StateChange) (ConversationSummary, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": phoneNumber, "state": from}
+	if from == "" {
+		filter["state"] = nil // Matches summaries that never left the open state
+	}
+	set := bson.M{"stateChangedAt": change.At, "updatedAt": s.Clock().Now()}
+	unset := bson.M{}
+	if change.State == models.ConversationOpen {
+		unset["state"] = ""
+	} else {
+		set["state"] = change.State
+	}
+	if change.SnoozedUntil != nil {
+		set["snoozedUntil"] = *change.SnoozedUntil
+	} else {
+		unset["snoozedUntil"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var summary ConversationSummary
+	err := s.summaries.FindOneAndUpdate(ctx, filter, update, opts).Decode(&summary)
+	if err == nil {
+		return summary, true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return ConversationSummary{}, false, fmt.Errorf("failed to set conversation state: %w", err)
+	}
+
+	// Either the state moved on or there is no summary at all
+	summaries, err := s.GetSummaries([]string{phoneNumber})
+	if err != nil {
+		return ConversationSummary{}, false, err
+	}
+	current, ok := summaries[phoneNumber]
+	if !ok {
+		return ConversationSummary{}, false, fmt.Errorf("conversation %s: %w", phoneNumber, ErrNotFound)
+	}
+	return current, false, nil
+}
+
+// SetAttributes updates only the attributes named, in one update, so
+// writes of different attributes don't overwrite each other.
+func (s *MongoSummaryStore) SetAttributes(phoneNumber string, set map[string]any, unset []string) (ConversationSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fields := bson.M{"updatedAt": s.Clock().Now()}
+	for name, value := range set {
+		fields["customAttributes."+name] = value
+	}
+	update := bson.M{"$set": fields}
+	if len(unset) > 0 {
+		removed := bson.M{}
+		for _, name := range unset {
+			removed["customAttributes."+name] = ""
+		}
+		update["$unset"] = removed
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var summary ConversationSummary
+	err := s.summaries.FindOneAndUpdate(ctx, bson.M{"_id": phoneNumber}, update, opts).Decode(&summary)
+	if err == mongo.ErrNoDocuments {
+		return ConversationSummary{}, fmt.Errorf("conversation %s: %w", phoneNumber, ErrNotFound)
+	}
+	if err != nil {
+		return ConversationSummary{}, fmt.Errorf("failed to set conversation attributes: %w", err)
+	}
+	return summary, nil
+}
+
+// FindByAttributes matches each attribute by equality, served by the
+// attribute's index when it has one.
+func (s *MongoSummaryStore) FindByAttributes(filter map[string]any) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	match := bson.M{}
+	for name, value := range filter {
+		match["customAttributes."+name] = value
+	}
+	cursor, err := s.summaries.Find(ctx, match, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find conversations by attributes: %w", err)
+	}
+	var rows []struct {
+		PhoneNumber string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	phoneNumbers := make([]string, 0, len(rows))
+	for _, row := range rows {
+		phoneNumbers = append(phoneNumbers, row.PhoneNumber)
+	}
+	return phoneNumbers, nil
+}
+
+// EnsureAttributeIndex creates a partial index on the attribute, covering
+// only the summaries that carry it. Summaries are one document per
+// conversation, so the build is short next to the messages' indexes.
+func (s *MongoSummaryStore) EnsureAttributeIndex(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	field := "customAttributes." + name
+	_, err := s.summaries.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: field, Value: 1}},
+		Options: options.Index().
+			SetName("customAttributes_" + name + "_idx").
+			SetPartialFilterExpression(bson.M{field: bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index attribute %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListChangedSummaries walks the updatedAt_id_idx index from the position.
+func (s *MongoSummaryStore) ListChangedSummaries(q ChangeQuery) ([]ConversationSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"updatedAt": bson.M{"$gt": q.After}},
+		bson.M{"updatedAt": q.After, "_id": bson.M{"$gt": q.AfterPhoneNumber}},
+	}}
+	if !q.Until.IsZero() {
+		filter["$and"] = bson.A{bson.M{"updatedAt": bson.M{"$lt": q.Until}}}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(q.Limit))
+	cursor, err := s.summaries.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed conversation summaries: %w", err)
+	}
+	summaries := []ConversationSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (s *MongoSummaryStore) ClaimAutoAck(phoneNumber string, since, at time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": phoneNumber, "$or": bson.A{
+		bson.M{"autoAckedAt": bson.M{"$exists": false}},
+		bson.M{"autoAckedAt": bson.M{"$lte": since}},
+	}}
+	// The upsert inserts a summary when there is none. When there is one
+	// claimed after since, it fails on the duplicate _id instead: claimed
+	// by another caller.
+	result, err := s.summaries.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"autoAckedAt": at}}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim auto-ack of %s: %w", phoneNumber, err)
+	}
+	return result.MatchedCount == 1 || result.UpsertedCount == 1, nil
+}
+
+// MemorySummaryStore implements SummaryStore for a MemoryStore.
+type MemorySummaryStore struct {
+	messages *MemoryStore
+
+	mu        sync.Mutex
+	summaries map[string]ConversationSummary
+
+	clock.Clocked
+}
+
+// NewMemorySummaryStore keeps the summaries of s's messages in memory.
+func NewMemorySummaryStore(s *MemoryStore) *MemorySummaryStore {
+	return &MemorySummaryStore{messages: s, summaries: make(map[string]ConversationSummary)}
+}
+
+func (s *MemorySummaryStore) ApplyMessages(msgs []models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for pn, d := range summaryDeltas(msgs) {
+		summary, ok := s.summaries[pn]
+		last := models.Message{ID: d.LastMessageID, CreatedAt: d.LastMessageAt}
+		if !ok || newerMessage(last, models.Message{ID: summary.LastMessageID, CreatedAt: summary.LastMessageAt}) {
+			summary.PhoneNumber = pn
+			summary.SenderType = d.SenderType
+			summary.LastMessageAt = d.LastMessageAt
+			summary.LastMessageID = d.LastMessageID
+			summary.Preview = d.Preview
+		}
+		summary.MessageCount += d.MessageCount
+		if len(d.LanguageCounts) > 0 {
+			counts := maps.Clone(summary.LanguageCounts)
+			if counts == nil {
+				counts = make(map[string]int64)
+			}
+			for code, n := range d.LanguageCounts {
+				counts[code] += n
+			}
+			summary.LanguageCounts = counts
+			summary.Language = dominantLanguage(counts)
+		}
+		summary.UpdatedAt = s.Clock().Now()
+		s.summaries[pn] = summary
+	}
+	return nil
+}
+
+func (s *MemorySummaryStore) DeleteSummary(phoneNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.summaries, phoneNumber)
+	return nil
+}
+
+func (s *MemorySummaryStore) DeleteAllSummaries() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summaries = make(map[string]ConversationSummary)
+	return nil
+}
+
+func (s *MemorySummaryStore) GetSummaries(phoneNumbers []string) (map[string]ConversationSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]ConversationSummary)
+	for _, pn := range phoneNumbers {
+		if summary, ok := s.summaries[pn]; ok {
+			out[pn] = summary
+		}
+	}
+	return out, nil
+}
+
+func (s *MemorySummaryStore) SampleSummaries(n int) ([]ConversationSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make([]ConversationSummary, 0, len(s.summaries))
+	for _, summary := range s.summaries {
+		all = append(all, summary)
+	}
+	rand.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all, nil
+}
+
+func (s *MemorySummaryStore) ComputeSummaries(phoneNumbers []string) (map[string]ConversationSummary, error) {
+	if phoneNumbers == nil {
+		msgs, err := s.messages.List()
+		if err != nil {
+			return nil, err
+		}
+		return summaryDeltas(msgs), nil
+	}
+
+	// Conversations are indexed, so a few are computed without a full scan
+	matching := make([]models.Message, 0)
+	for _, pn := range slices.Compact(slices.Sorted(slices.Values(phoneNumbers))) {
+		msgs, err := s.messages.FindByPhoneNumber(pn)
+		if err != nil {
+			return nil, err
+		}
+		matching = append(matching, msgs...)
+	}
+	return summaryDeltas(matching), nil
+}
+
+func (s *MemorySummaryStore) RebuildSummaries(phoneNumbers []string) (int64, error) {
+	computed, err := s.ComputeSummaries(phoneNumbers)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	if phoneNumbers == nil {
+		for pn, summary := range s.summaries {
+			if c, ok := computed[pn]; ok {
+				computed[pn] = withState(c, summary)
+			} else if summary.MessageCount == 0 {
+				computed[pn] = summary
+			}
+		}
+		for pn, summary := range computed {
+			if summary.MessageCount != 0 {
+				summary.UpdatedAt = now
+				computed[pn] = summary
+			}
+		}
+		s.summaries = computed
+		return int64(len(computed)), nil
+	}
+	for _, pn := range phoneNumbers {
+		if summary, ok := computed[pn]; ok {
+			summary = withState(summary, s.summaries[pn])
+			summary.UpdatedAt = now
+			s.summaries[pn] = summary
+		} else if s.summaries[pn].MessageCount != 0 {
+			delete(s.summaries, pn)
+		}
+	}
+	return int64(len(computed)), nil
+}
+
+func (s *MemorySummaryStore) CreateEmptySummary(phoneNumber string, at time.Time) (ConversationSummary, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if summary, ok := s.summaries[phoneNumber]; ok {
+		return summary, false, nil
+	}
+	summary := ConversationSummary{PhoneNumber: phoneNumber, SenderType: models.ClassifySender(phoneNumber), CreatedAt: &at, UpdatedAt: at}
+	s.summaries[phoneNumber] = summary
+	return summary, true, nil
+}
+
+func (s *MemorySummaryStore) ListEmptySummaries() ([]ConversationSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]ConversationSummary, 0)
+	for _, summary := range s.summaries {
+		if summary.MessageCount == 0 {
+			out = append(out, summary)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemorySummaryStore) ListSummaries(afterPhoneNumber string, limit int) ([]ConversationSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]ConversationSummary, 0)
+	for pn, summary := range s.summaries {
+		if summary.MessageCount > 0 && pn > afterPhoneNumber {
+			out = append(out, summary)
+		}
+	}
+	slices.SortFunc(out, func(a, b ConversationSummary) int { return cmp.Compare(a.PhoneNumber, b.PhoneNumber) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *MemorySummaryStore) DeleteEmptySummaries(cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	for pn, summary := range s.summaries {
+		if summary.MessageCount == 0 && summary.CreatedAt != nil && summary.CreatedAt.Before(cutoff) {
+			delete(s.summaries, pn)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (s *MemorySummaryStore) SetState(phoneNumber string, from string, change StateChange) (ConversationSummary, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary, ok := s.summaries[phoneNumber]
+	if !ok {
+		return ConversationSummary{}, false, fmt.Errorf("conversation %s: %w", phoneNumber, ErrNotFound)
+	}
+	if summary.State != from {
+		return summary, false, nil
+	}
+	summary.State = change.State
+	if change.State == models.ConversationOpen {
+		summary.State = ""
+	}
+	summary.SnoozedUntil = change.SnoozedUntil
+	summary.StateChangedAt = &change.At
+	summary.UpdatedAt = s.Clock().Now()
+	s.summaries[phoneNumber] = summary
+	return summary, true, nil
+}
+
+func (s *MemorySummaryStore) SetAttributes(phoneNumber string, set map[string]any, unset []string) (ConversationSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary, ok := s.summaries[phoneNumber]
+	if !ok {
+		return ConversationSummary{}, fmt.Errorf("conversation %s: %w", phoneNumber, ErrNotFound)
+	}
+	attrs := maps.Clone(summary.CustomAttributes)
+	if attrs == nil {
+		attrs = make(map[string]any, len(set))
+	}
+	maps.Copy(attrs, set)
+	for _, name := range unset {
+		delete(attrs, name)
+	}
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+	summary.CustomAttributes = attrs
+	summary.UpdatedAt = s.Clock().Now()
+	s.summaries[phoneNumber] = summary
+	return summary, nil
+}
+
+func (s *MemorySummaryStore) FindByAttributes(filter map[string]any) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	phoneNumbers := make([]string, 0)
+	for pn, summary := range s.summaries {
+		matches := true
+		for name, value := range filter {
+			if stored, ok := summary.CustomAttributes[name]; !ok || stored != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			phoneNumbers = append(phoneNumbers, pn)
+		}
+	}
+	return phoneNumbers, nil
+}
+
+// EnsureAttributeIndex does nothing: memory summaries are scanned.
+func (s *MemorySummaryStore) EnsureAttributeIndex(string) error {
+	return nil
+}
+
+func (s *MemorySummaryStore) ListChangedSummaries(q ChangeQuery) ([]ConversationSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make([]ConversationSummary, 0)
+	for _, summary := range s.summaries {
+		if q.Includes(summary.UpdatedAt, summary.PhoneNumber) {
+			changed = append(changed, summary)
+		}
+	}
+	slices.SortFunc(changed, func(a, b ConversationSummary) int {
+		return cmp.Or(a.UpdatedAt.Compare(b.UpdatedAt), cmp.Compare(a.PhoneNumber, b.PhoneNumber))
+	})
+	if len(changed) > q.Limit {
+		changed = changed[:q.Limit]
+	}
+	return changed, nil
+}
+
+func (s *MemorySummaryStore) ClaimAutoAck(phoneNumber string, since, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary, ok := s.summaries[phoneNumber]
+	if ok && summary.AutoAckedAt != nil && summary.AutoAckedAt.After(since) {
+		return false, nil
+	}
+	summary.PhoneNumber = phoneNumber
+	summary.AutoAckedAt = &at
+	s.summaries[phoneNumber] = summary
+	return true, nil
+}
+
+// withState returns computed with the lifecycle state, creation time,
+// custom attributes and auto-ack claim of stored, which a rebuild doesn't
+// recompute.
+func withState(computed, stored ConversationSummary) ConversationSummary {
+	computed.CustomAttributes = stored.CustomAttributes
+	computed.AutoAckedAt = stored.AutoAckedAt
+	computed.CreatedAt = stored.CreatedAt
+	computed.State = stored.State
+	computed.SnoozedUntil = stored.SnoozedUntil
+	computed.StateChangedAt = stored.StateChangedAt
+	return computed
+}
@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestMemoryClaimAutoAck(t *testing.T) {
+	testClaimAutoAck(t, func(t *testing.T) (store.Store, store.SummaryStore) {
+		s := store.NewMemoryStore()
+		return s, store.NewMemorySummaryStore(s)
+	})
+}
+
+func TestMongoClaimAutoAck(t *testing.T) {
+	testClaimAutoAck(t, func(t *testing.T) (store.Store, store.SummaryStore) {
+		s := newTestMongoStore(t)
+		return s, store.NewMongoSummaryStore(s, "")
+	})
+}
+
+// testClaimAutoAck checks that of 10 concurrent claims of a conversation
+// exactly one succeeds, with and without a summary to claim, and that a
+// claim outside the window succeeds again.
+func testClaimAutoAck(t *testing.T, newStores func(t *testing.T) (store.Store, store.SummaryStore)) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for _, tc := range []struct {
+		name    string
+		summary bool
+	}{
+		{"WithSummary", true},
+		{"WithoutSummary", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, summaries := newStores(t)
+			if tc.summary {
+				msg := models.Message{ID: "m1", PhoneNumber: "9876543210", Text: "hi", Direction: models.DirectionInbound, CreatedAt: now}
+				if _, err := store.NewSummarizingStore(s, summaries).Save(msg); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+
+			const callers = 10
+			claimed := make([]bool, callers)
+			var wg sync.WaitGroup
+			for i := range callers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := summaries.ClaimAutoAck("9876543210", now.Add(-time.Hour), now)
+					if err != nil {
+						t.Errorf("ClaimAutoAck: %v", err)
+					}
+					claimed[i] = ok
+				}()
+			}
+			wg.Wait()
+			n := 0
+			for _, ok := range claimed {
+				if ok {
+					n++
+				}
+			}
+			if n != 1 {
+				t.Fatalf("%d of %d concurrent claims succeeded, want 1", n, callers)
+			}
+
+			got, err := summaries.GetSummaries([]string{"9876543210"})
+			if err != nil {
+				t.Fatalf("GetSummaries after claim: %v", err)
+			}
+			summary := got["9876543210"]
+			if summary.AutoAckedAt == nil || !summary.AutoAckedAt.Equal(now) {
+				t.Fatalf("AutoAckedAt = %v, want %v", summary.AutoAckedAt, now)
+			}
+
+			later := now.Add(2 * time.Hour)
+			if ok, err := summaries.ClaimAutoAck("9876543210", later.Add(-time.Hour), later); err != nil || !ok {
+				t.Fatalf("claim outside the window = %v, %v; want claimed", ok, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package store
+
+import "sms-store/internal/models"
+
+// Tokenizer splits message text into the tokens stored for prefix search.
+type Tokenizer interface {
+	Tokens(text string) []string
+}
+
+// TokenizingStore wraps a Store so every saved message, and every message
+// whose text is updated, carries the search tokens of its text.
+type TokenizingStore struct {
+	Store
+	tokenizer Tokenizer
+}
+
+// NewTokenizingStore wraps s, tokenizing saved messages with tokenizer.
+func NewTokenizingStore(s Store, tokenizer Tokenizer) *TokenizingStore {
+	return &TokenizingStore{Store: s, tokenizer: tokenizer}
+}
+
+// Save tokenizes msg and stores it.
+func (s *TokenizingStore) Save(msg models.Message) (models.Message, error) {
+	msg.SearchTokens = s.tokenizer.Tokens(msg.Text)
+	return s.Store.Save(msg)
+}
+
+// SaveBatch tokenizes each message and stores the batch.
+func (s *TokenizingStore) SaveBatch(msgs []models.Message) (int, error) {
+	tokenized := make([]models.Message, len(msgs))
+	for i, msg := range msgs {
+		msg.SearchTokens = s.tokenizer.Tokens(msg.Text)
+		tokenized[i] = msg
+	}
+	return s.Store.SaveBatch(tokenized)
+}
+
+// UpdateMessage patches a message, replacing its tokens when the text changes.
+func (s *TokenizingStore) UpdateMessage(id string, patch MessagePatch) (models.Message, error) {
+	if patch.Text != nil {
+		patch.SearchTokens = s.tokenizer.Tokens(*patch.Text)
+	}
+	return s.Store.UpdateMessage(id, patch)
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sms-store/internal/clock"
+)
+
+// Tombstone records that a conversation was deleted. While it is active,
+// ingested messages created before DeletedAt are dropped so events still
+// buffered upstream can't resurrect the conversation.
+type Tombstone struct {
+	PhoneNumber  string    `json:"phoneNumber" bson:"phoneNumber"`
+	DeletedAt    time.Time `json:"deletedAt" bson:"deletedAt"`
+	ExpiresAt    time.Time `json:"expiresAt" bson:"expiresAt"`
+	DroppedCount int64     `json:"droppedCount" bson:"droppedCount"`
+}
+
+// TombstoneStore defines the interface for conversation tombstone storage.
+type TombstoneStore interface {
+	// PutTombstone creates or replaces the tombstone for a phone number.
+	PutTombstone(t Tombstone) error
+
+	// FindTombstones retrieves the unexpired tombstones among phoneNumbers,
+	// keyed by phone number.
+	FindTombstones(phoneNumbers []string) (map[string]Tombstone, error)
+
+	// ListTombstones retrieves all unexpired tombstones, most recent first.
+	ListTombstones() ([]Tombstone, error)
+
+	// AddDropped adds n to the tombstone's dropped message count.
+	AddDropped(phoneNumber string, n int64) error
+
+	// DeleteTombstone clears a tombstone.
+	// Returns an error wrapping ErrNotFound if there is none.
+	DeleteTombstone(phoneNumber string) error
+}
+
+// MongoTombstoneStore implements the TombstoneStore interface using MongoDB.
+// Expired tombstones are removed by a TTL index.
+type MongoTombstoneStore struct {
+	collection *mongo.Collection
+
+	clock.Clocked
+}
+
+// NewMongoTombstoneStore creates a new MongoDB tombstone store instance.
+// It uses the same MongoDB connection as the message store.
+func NewMongoTombstoneStore(client *mongo.Client, databaseName, collectionName string) *MongoTombstoneStore {
+	if collectionName == "" {
+		collectionName = "tombstones"
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "phoneNumber", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("phoneNumber_unique_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("expiresAt_ttl_idx"),
+		},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		log.Printf("Warning: could not ensure tombstone indexes on %s: %v", collectionName, err)
+	}
+
+	return &MongoTombstoneStore{collection: collection}
+}
+
+func (s *MongoTombstoneStore) PutTombstone(t Tombstone) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"phoneNumber": t.PhoneNumber}, t, opts); err != nil {
+		return fmt.Errorf("failed to save tombstone: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoTombstoneStore) FindTombstones(phoneNumbers []string) (map[string]Tombstone, error) {
+	result := make(map[string]Tombstone)
+	if len(phoneNumbers) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The TTL monitor runs about once a minute, so filter expired ones too
+	filter := bson.M{
+		"phoneNumber": bson.M{"$in": phoneNumbers},
+		"expiresAt":   bson.M{"$gt": s.Clock().Now()},
+	}
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tombstones: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var tombstones []Tombstone
+	if err := cursor.All(ctx, &tombstones); err != nil {
+		return nil, fmt.Errorf("failed to decode tombstones: %w", err)
+	}
+	for _, t := range tombstones {
+		result[t.PhoneNumber] = t
+	}
+	return result, nil
+}
+
+func (s *MongoTombstoneStore) ListTombstones() ([]Tombstone, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}})
+	cursor, err := s.collection.Find(ctx, bson.M{"expiresAt": bson.M{"$gt": s.Clock().Now()}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tombstones: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	tombstones := make([]Tombstone, 0)
+	if err := cursor.All(ctx, &tombstones); err != nil {
+		return nil, fmt.Errorf("failed to decode tombstones: %w", err)
+	}
+	return tombstones, nil
+}
+
+func (s *MongoTombstoneStore) AddDropped(phoneNumber string, n int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$inc": bson.M{"droppedCount": n}}
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"phoneNumber": phoneNumber}, update); err != nil {
+		return fmt.Errorf("failed to update tombstone: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoTombstoneStore) DeleteTombstone(phoneNumber string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"phoneNumber": phoneNumber})
+	if err != nil {
+		return fmt.Errorf("failed to delete tombstone: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("tombstone %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	return nil
+}
+
+// MemoryTombstoneStore implements the TombstoneStore interface in memory.
+type MemoryTombstoneStore struct {
+	mu         sync.Mutex
+	tombstones map[string]Tombstone
+
+	clock.Clocked
+}
+
+func NewMemoryTombstoneStore() *MemoryTombstoneStore {
+	return &MemoryTombstoneStore{tombstones: make(map[string]Tombstone)}
+}
+
+func (s *MemoryTombstoneStore) PutTombstone(t Tombstone) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tombstones[t.PhoneNumber] = t
+	return nil
+}
+
+func (s *MemoryTombstoneStore) FindTombstones(phoneNumbers []string) (map[string]Tombstone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	result := make(map[string]Tombstone)
+	for _, pn := range phoneNumbers {
+		if t, ok := s.tombstones[pn]; ok && t.ExpiresAt.After(now) {
+			result[pn] = t
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryTombstoneStore) ListTombstones() ([]Tombstone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock().Now()
+	out := make([]Tombstone, 0, len(s.tombstones))
+	for pn, t := range s.tombstones {
+		if !t.ExpiresAt.After(now) {
+			delete(s.tombstones, pn)
+			continue
+		}
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DeletedAt.After(out[j].DeletedAt) })
+	return out, nil
+}
+
+func (s *MemoryTombstoneStore) AddDropped(phoneNumber string, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tombstones[phoneNumber]; ok {
+		t.DroppedCount += n
+		s.tombstones[phoneNumber] = t
+	}
+	return nil
+}
+
+func (s *MemoryTombstoneStore) DeleteTombstone(phoneNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tombstones[phoneNumber]; !ok {
+		return fmt.Errorf("tombstone %w for phone number: %s", ErrNotFound, phoneNumber)
+	}
+	delete(s.tombstones, phoneNumber)
+	return nil
+}
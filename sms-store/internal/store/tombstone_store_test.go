@@ -0,0 +1,41 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+	"sms-store/internal/models"
+	"sms-store/internal/store"
+)
+
+func TestTombstoneExpiresOnTheClock(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	fake := clocktest.NewFake(start)
+	tombstones := store.NewMemoryTombstoneStore()
+	tombstones.SetClock(fake)
+	s := store.NewTombstoningStore(store.NewMemoryStore(), tombstones, time.Hour)
+	s.SetClock(fake)
+
+	if _, err := s.DeleteByPhoneNumber("1111111111"); err != nil {
+		t.Fatalf("DeleteByPhoneNumber: %v", err)
+	}
+	buffered := models.Message{ID: "m1", PhoneNumber: "1111111111", Text: "buffered", CreatedAt: start.Add(-time.Minute)}
+	if _, err := s.Save(buffered); !errors.Is(err, store.ErrTombstoned) {
+		t.Fatalf("Save within the window = %v, want ErrTombstoned", err)
+	}
+	list, err := tombstones.ListTombstones()
+	if err != nil || len(list) != 1 || !list[0].ExpiresAt.Equal(start.Add(time.Hour)) || list[0].DroppedCount != 1 {
+		t.Fatalf("ListTombstones = %+v, %v", list, err)
+	}
+
+	// At its expiry the tombstone lapses and the stale event is let through
+	fake.Advance(time.Hour)
+	if list, err := tombstones.ListTombstones(); err != nil || len(list) != 0 {
+		t.Fatalf("ListTombstones after expiry = %+v, %v", list, err)
+	}
+	if _, err := s.Save(buffered); err != nil {
+		t.Fatalf("Save after the window: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+	"sms-store/internal/models"
+)
+
+// ErrTombstoned is returned by TombstoningStore.Save for a message created
+// before its conversation was deleted.
+var ErrTombstoned = errors.New("conversation was deleted after this message was created")
+
+var tombstonedDrops = metrics.NewCounterVec(
+	"ingest_tombstoned_messages_dropped_total",
+	"Messages dropped because they predate the deletion of their conversation.",
+	"operation",
+)
+
+// TombstoningStore wraps a Store so that deleting a conversation leaves a
+// tombstone for window, during which saved messages created before the
+// deletion are dropped. This keeps events still buffered in Kafka from
+// bringing a deleted conversation back with stale messages.
+type TombstoningStore struct {
+	Store
+	tombstones TombstoneStore
+	window     time.Duration
+
+	clock.Clocked
+}
+
+// NewTombstoningStore wraps s, keeping tombstones in ts for window.
+func NewTombstoningStore(s Store, ts TombstoneStore, window time.Duration) *TombstoningStore {
+	return &TombstoningStore{Store: s, tombstones: ts, window: window}
+}
+
+// Save stores msg unless its conversation was deleted after it was created.
+func (s *TombstoningStore) Save(msg models.Message) (models.Message, error) {
+	tombstones, err := s.tombstones.FindTombstones([]string{msg.PhoneNumber})
+	if err != nil {
+		return models.Message{}, err
+	}
+	if t, ok := tombstones[msg.PhoneNumber]; ok && msg.CreatedAt.Before(t.DeletedAt) {
+		s.recordDropped("save", msg.PhoneNumber, 1)
+		return models.Message{}, fmt.Errorf("message %s: %w", msg.ID, ErrTombstoned)
+	}
+	return s.Store.Save(msg)
+}
+
+// SaveBatch stores msgs, silently dropping those that predate the deletion
+// of their conversation. Dropped messages are not counted as saved.
+func (s *TombstoningStore) SaveBatch(msgs []models.Message) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	tombstones, err := s.tombstones.FindTombstones(batchPhoneNumbers(msgs))
+	if err != nil {
+		return 0, err
+	}
+	if len(tombstones) == 0 {
+		return s.Store.SaveBatch(msgs)
+	}
+
+	keep := make([]models.Message, 0, len(msgs))
+	dropped := make(map[string]int64)
+	for _, msg := range msgs {
+		if t, ok := tombstones[msg.PhoneNumber]; ok && msg.CreatedAt.Before(t.DeletedAt) {
+			dropped[msg.PhoneNumber]++
+			continue
+		}
+		keep = append(keep, msg)
+	}
+	for pn, n := range dropped {
+		s.recordDropped("save_batch", pn, n)
+	}
+
+	if len(keep) == 0 {
+		return 0, nil
+	}
+	return s.Store.SaveBatch(keep)
+}
+
+// DeleteByPhoneNumber records a tombstone, then deletes the conversation.
+// The tombstone goes first so nothing ingested in between survives.
+func (s *TombstoningStore) DeleteByPhoneNumber(phoneNumber string) (int64, error) {
+	now := s.Clock().Now()
+	t := Tombstone{PhoneNumber: phoneNumber, DeletedAt: now, ExpiresAt: now.Add(s.window)}
+	if err := s.tombstones.PutTombstone(t); err != nil {
+		return 0, err
+	}
+	return s.Store.DeleteByPhoneNumber(phoneNumber)
+}
+
+func (s *TombstoningStore) recordDropped(operation, phoneNumber string, n int64) {
+	tombstonedDrops.WithLabelValues(operation).Add(uint64(n))
+	log.Printf("Dropped %d message(s) for deleted conversation %s", n, phoneNumber)
+	if err := s.tombstones.AddDropped(phoneNumber, n); err != nil {
+		log.Printf("Failed to count dropped messages on tombstone %s: %v", phoneNumber, err)
+	}
+}
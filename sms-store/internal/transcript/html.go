@@ -0,0 +1,122 @@
+package transcript
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// htmlTemplates are executed piece by piece: the header once, a message per
+// message and the footer at the end. html/template escapes every value, so
+// message text can't inject markup.
+var htmlTemplates = template.Must(template.New("transcript").Parse(`
+{{- define "header" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Transcript: {{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+h1 { font-size: 1.4rem; margin-bottom: 0.2rem; }
+.details { color: #59636e; font-size: 0.85rem; margin: 0 0 1.5rem; }
+ol.messages { list-style: none; margin: 0; padding: 0; }
+.message { display: flex; flex-direction: column; margin: 0 0 0.9rem; }
+.message.outbound { align-items: flex-end; }
+.message.inbound { align-items: flex-start; }
+.meta { color: #59636e; font-size: 0.75rem; margin-bottom: 0.2rem; }
+.bubble { max-width: 70%; padding: 0.5rem 0.75rem; border-radius: 0.9rem; white-space: pre-wrap; overflow-wrap: anywhere; }
+.outbound .bubble { background: #0969da; color: #fff; }
+.inbound .bubble { background: #eaeef2; }
+.reply { font-size: 0.75rem; margin-top: 0.2rem; }
+.reply a { color: #59636e; }
+.summary { color: #59636e; font-size: 0.85rem; border-top: 1px solid #d1d9e0; padding-top: 0.5rem; }
+@media print { body { margin: 0; } .message { break-inside: avoid; } }
+</style>
+</head>
+<body>
+<h1>Conversation with {{.Title}}</h1>
+<p class="details">Times in {{.Zone}}. Generated {{.GeneratedAt}}.</p>
+<ol class="messages">
+{{end -}}
+
+{{- define "message" -}}
+<li class="message {{.Direction}}" id="msg-{{.ID}}">
+<div class="meta"><time datetime="{{.Timestamp}}">{{.Time}}</time> &middot; {{.Status}}{{if .Sender}} &middot; from {{.Sender}}{{end}}</div>
+<div class="bubble">{{.Text}}</div>
+{{- if .ReplyToID}}
+<div class="reply"><a href="#msg-{{.ReplyToID}}">In reply to an earlier message</a></div>
+{{- end}}
+</li>
+{{end -}}
+
+{{- define "footer" -}}
+</ol>
+<p class="summary">{{.}} message{{if ne . 1}}s{{end}}</p>
+</body>
+</html>
+{{end -}}
+`))
+
+type htmlHeader struct {
+	Title       string
+	Zone        string
+	GeneratedAt string
+}
+
+type htmlMessage struct {
+	ID        string
+	Direction string
+	Timestamp string // RFC 3339, for the datetime attribute
+	Time      string
+	Status    string
+	Sender    string
+	Text      string
+	ReplyToID string
+}
+
+// HTMLWriter writes a transcript as an HTML page.
+type HTMLWriter struct {
+	w     io.Writer
+	loc   *time.Location
+	count int
+}
+
+// NewHTMLWriter writes the page header to w and returns a writer for the
+// messages.
+func NewHTMLWriter(w io.Writer, h Header) (*HTMLWriter, error) {
+	loc := h.location()
+	err := htmlTemplates.ExecuteTemplate(w, "header", htmlHeader{
+		Title:       h.Title(),
+		Zone:        loc.String(),
+		GeneratedAt: h.GeneratedAt.In(loc).Format(timeLayout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &HTMLWriter{w: w, loc: loc}, nil
+}
+
+func (hw *HTMLWriter) Write(msg models.Message) error {
+	m := htmlMessage{
+		ID:        msg.ID,
+		Direction: direction(msg),
+		Timestamp: msg.CreatedAt.Format(time.RFC3339),
+		Time:      msg.CreatedAt.In(hw.loc).Format(timeLayout),
+		Status:    msg.Status,
+		Text:      msg.Text,
+		ReplyToID: msg.ReplyToID,
+	}
+	if msg.Provider != nil {
+		m.Sender = msg.Provider.SenderID
+	}
+	hw.count++
+	return htmlTemplates.ExecuteTemplate(hw.w, "message", m)
+}
+
+// Close writes the page footer.
+func (hw *HTMLWriter) Close() error {
+	return htmlTemplates.ExecuteTemplate(hw.w, "footer", hw.count)
+}
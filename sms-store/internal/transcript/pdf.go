@@ -0,0 +1,184 @@
+package transcript
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"sms-store/internal/models"
+	"sms-store/internal/pdf"
+)
+
+// PDF layout, in points.
+const (
+	pdfMargin      = 50.0
+	pdfTitleSize   = 16.0
+	pdfDetailSize  = 9.0
+	pdfMetaSize    = 8.0
+	pdfTextSize    = 10.0
+	pdfLineHeight  = 13.0
+	pdfBubblePad   = 6.0
+	pdfBubbleShare = 0.7 // Widest a bubble gets, as a share of the text column
+	pdfMessageGap  = 10.0
+)
+
+// PDFWriter writes a transcript as an A4 PDF. Characters outside Latin-1
+// are shown as "?"; the HTML transcript keeps them.
+type PDFWriter struct {
+	doc   *pdf.Document
+	loc   *time.Location
+	y     float64 // Top of the next block
+	count int
+}
+
+// NewPDFWriter starts a PDF transcript on w.
+func NewPDFWriter(w io.Writer, h Header) *PDFWriter {
+	pw := &PDFWriter{doc: pdf.New(w, pdf.A4Width, pdf.A4Height), loc: h.location()}
+	pw.newPage()
+
+	pw.y -= pdfTitleSize
+	pw.doc.Text(pdfMargin, pw.y, pdf.HelveticaBold, pdfTitleSize, 0, "Conversation with "+h.Title())
+	pw.y -= pdfDetailSize + 6
+	details := "Times in " + pw.loc.String() + ". Generated " + h.GeneratedAt.In(pw.loc).Format(timeLayout) + "."
+	pw.doc.Text(pdfMargin, pw.y, pdf.Helvetica, pdfDetailSize, 0.4, details)
+	pw.y -= 2 * pdfMessageGap
+	return pw
+}
+
+func (pw *PDFWriter) newPage() {
+	pw.doc.AddPage()
+	pw.y = pw.doc.Height() - pdfMargin
+}
+
+func (pw *PDFWriter) Write(msg models.Message) error {
+	column := pw.doc.Width() - 2*pdfMargin
+	lines := wrap(msg.Text, column*pdfBubbleShare-2*pdfBubblePad)
+
+	// A message starts on a new page unless it's too long for any page
+	height := pdfMetaSize + 3 + float64(len(lines))*pdfLineHeight + 2*pdfBubblePad
+	if pw.y-height < pdfMargin && pw.y < pw.doc.Height()-pdfMargin {
+		pw.newPage()
+	}
+
+	meta := msg.CreatedAt.In(pw.loc).Format(timeLayout) + " - " + msg.Status
+	if msg.Provider != nil && msg.Provider.SenderID != "" {
+		meta += " - from " + msg.Provider.SenderID
+	}
+	if msg.ReplyToID != "" {
+		meta += " - in reply to an earlier message"
+	}
+	pw.y -= pdfMetaSize
+	pw.doc.Text(pw.align(msg, pdf.TextWidth(pdf.Helvetica, pdfMetaSize, meta)), pw.y, pdf.Helvetica, pdfMetaSize, 0.4, meta)
+	pw.y -= 3
+
+	var width float64
+	for _, line := range lines {
+		width = max(width, pdf.TextWidth(pdf.Helvetica, pdfTextSize, line))
+	}
+	width += 2 * pdfBubblePad
+	x := pw.align(msg, width)
+	shade, ink := 0.9, 0.0
+	if direction(msg) == "outbound" {
+		shade, ink = 0.25, 1
+	}
+
+	// Long messages continue on the next page, the bubble split between them
+	first := true
+	for i, line := range lines {
+		h := pdfLineHeight
+		if first {
+			h += pdfBubblePad
+		}
+		if i == len(lines)-1 {
+			h += pdfBubblePad
+		}
+		if pw.y-h < pdfMargin && !first {
+			pw.newPage()
+			first = true
+			h += pdfBubblePad
+		}
+
+		pw.doc.FillRect(x, pw.y-h, width, h, shade)
+		baseline := pw.y - pdfLineHeight + 3
+		if first {
+			baseline -= pdfBubblePad
+		}
+		pw.doc.Text(x+pdfBubblePad, baseline, pdf.Helvetica, pdfTextSize, ink, line)
+		pw.y -= h
+		first = false
+	}
+	pw.y -= pdfMessageGap
+
+	pw.count++
+	return nil
+}
+
+// Close writes the message count and finishes the document.
+func (pw *PDFWriter) Close() error {
+	if pw.y-pdfDetailSize < pdfMargin {
+		pw.newPage()
+	}
+	pw.y -= pdfDetailSize
+	summary := strconv.Itoa(pw.count) + " messages"
+	if pw.count == 1 {
+		summary = "1 message"
+	}
+	pw.doc.Text(pdfMargin, pw.y, pdf.Helvetica, pdfDetailSize, 0.4, summary)
+	return pw.doc.Close()
+}
+
+// align returns the left edge of a block width points wide on msg's side.
+func (pw *PDFWriter) align(msg models.Message, width float64) float64 {
+	if direction(msg) == "outbound" {
+		return pw.doc.Width() - pdfMargin - width
+	}
+	return pdfMargin
+}
+
+// wrap breaks text into lines no wider than width at the message text size,
+// keeping the message's own line breaks. Words too long for a line are split.
+func wrap(text string, width float64) []string {
+	var lines []string
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if pdf.TextWidth(pdf.Helvetica, pdfTextSize, candidate) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for pdf.TextWidth(pdf.Helvetica, pdfTextSize, word) > width {
+				cut := fit(word, width)
+				lines = append(lines, word[:cut])
+				word = word[cut:]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fit returns the byte length of the longest prefix of word that fits in
+// width, and at least its first character.
+func fit(word string, width float64) int {
+	_, cut := utf8.DecodeRuneInString(word)
+	for i := range word {
+		if i <= cut {
+			continue
+		}
+		if pdf.TextWidth(pdf.Helvetica, pdfTextSize, word[:i]) > width {
+			break
+		}
+		cut = i
+	}
+	return cut
+}
@@ -0,0 +1,53 @@
+// Package transcript renders a conversation as a human-readable document,
+// oldest message first, as HTML or PDF. Both writers take messages one at a
+// time so a conversation of any length can be streamed from the store.
+package transcript
+
+import (
+	"time"
+
+	"sms-store/internal/models"
+)
+
+// Header describes the conversation a transcript covers.
+type Header struct {
+	PhoneNumber string
+	Name        string         // Profile name; empty when the number has no profile
+	Location    *time.Location // Zone message times are shown in
+	GeneratedAt time.Time
+}
+
+// Title names the conversation, with the profile name when it is known.
+func (h Header) Title() string {
+	if h.Name == "" {
+		return h.PhoneNumber
+	}
+	return h.Name + " (" + h.PhoneNumber + ")"
+}
+
+func (h Header) location() *time.Location {
+	if h.Location == nil {
+		return time.UTC
+	}
+	return h.Location
+}
+
+// Layout for times shown in transcripts.
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// Writer renders one transcript. Call Write for each message, oldest
+// first, then Close.
+type Writer interface {
+	Write(msg models.Message) error
+	Close() error
+}
+
+// direction reports which side of the conversation sent msg. Only
+// imported history has inbound messages; the rest were sent to the
+// conversation's number.
+func direction(msg models.Message) string {
+	if msg.Direction == models.DirectionInbound {
+		return models.DirectionInbound
+	}
+	return models.DirectionOutbound
+}
@@ -0,0 +1,131 @@
+package transcript
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-store/internal/models"
+	"sms-store/internal/pdf"
+)
+
+const scriptPayload = `<script>alert("x")</script>`
+
+var (
+	kolkata, _   = time.LoadLocation("Asia/Kolkata")
+	testHeader   = Header{PhoneNumber: "9876543210", Name: "Ram", Location: kolkata, GeneratedAt: time.Date(2026, 10, 14, 6, 30, 0, 0, time.UTC)}
+	testMessages = []models.Message{
+		{ID: "m1", Text: "Your OTP is 1234", Status: "DELIVERED", CreatedAt: time.Date(2026, 10, 14, 4, 0, 0, 0, time.UTC), Provider: &models.Provider{SenderID: "AX-BANK"}},
+		{ID: "m2", Text: scriptPayload, Status: "RECEIVED", Direction: models.DirectionInbound, ReplyToID: "m1", CreatedAt: time.Date(2026, 10, 14, 4, 1, 0, 0, time.UTC)},
+	}
+)
+
+func TestHTMLTranscript(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewHTMLWriter(&out, testHeader)
+	if err != nil {
+		t.Fatalf("NewHTMLWriter: %v", err)
+	}
+	for _, msg := range testMessages {
+		if err := w.Write(msg); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	page := out.String()
+
+	if strings.Contains(page, "<script>") {
+		t.Fatalf("message text injected markup:\n%s", page)
+	}
+	for _, want := range []string{
+		"<title>Transcript: Ram (9876543210)</title>",
+		"Times in Asia/Kolkata. Generated 2026-10-14 12:00:00 IST.",
+		`<li class="message outbound" id="msg-m1">`,
+		`<time datetime="2026-10-14T04:00:00Z">2026-10-14 09:30:00 IST</time> &middot; DELIVERED &middot; from AX-BANK`,
+		`<li class="message inbound" id="msg-m2">`,
+		`<div class="bubble">&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</div>`,
+		`<a href="#msg-m1">In reply to an earlier message</a>`,
+		"<p class=\"summary\">2 messages</p>\n</body>\n</html>\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %s", want)
+		}
+	}
+}
+
+func TestHTMLTranscriptCountsOneMessage(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewHTMLWriter(&out, Header{PhoneNumber: "9876543210"})
+	if err != nil {
+		t.Fatalf("NewHTMLWriter: %v", err)
+	}
+	w.Write(testMessages[0])
+	w.Close()
+	if page := out.String(); !strings.Contains(page, "<title>Transcript: 9876543210</title>") || !strings.Contains(page, "Times in UTC.") || !strings.Contains(page, ">1 message<") {
+		t.Fatalf("page:\n%s", page)
+	}
+}
+
+func TestPDFTranscript(t *testing.T) {
+	var out bytes.Buffer
+	w := NewPDFWriter(&out, testHeader)
+	for _, msg := range testMessages {
+		if err := w.Write(msg); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	doc := out.String()
+
+	// The payload is drawn as text, its parentheses escaped as PDF requires
+	for _, want := range []string{
+		"(Conversation with Ram \\(9876543210\\))",
+		"(2026-10-14 09:30:00 IST - DELIVERED - from AX-BANK)",
+		`(<script>alert\("x"\)</script>)`,
+		"(2026-10-14 09:31:00 IST - RECEIVED - in reply to an earlier message)",
+		"(2 messages)",
+		"/Count 1",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("PDF lacks %s", want)
+		}
+	}
+}
+
+func TestPDFTranscriptSpansPages(t *testing.T) {
+	var out bytes.Buffer
+	w := NewPDFWriter(&out, testHeader)
+	long := models.Message{ID: "long", Text: strings.Repeat("word ", 2000), Status: "DELIVERED", CreatedAt: testHeader.GeneratedAt}
+	for range 3 {
+		w.Write(long)
+	}
+	w.Close()
+	if doc := out.String(); strings.Contains(doc, "/Count 1 ") || !strings.Contains(doc, "(3 messages)") {
+		t.Fatalf("a long transcript didn't span pages")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	width := pdf.TextWidth(pdf.Helvetica, pdfTextSize, "aaaa bbbb")
+	for _, tc := range []struct {
+		text string
+		want []string
+	}{
+		{"short", []string{"short"}},
+		{"aaaa bbbb cccc", []string{"aaaa bbbb", "cccc"}},
+		{"  aa   bb  ", []string{"aa bb"}},
+		{"one\r\ntwo\n\nfour", []string{"one", "two", "", "four"}},
+		{"aaaaaaaaaaaaaaaaaaaa", []string{"aaaaaaaa", "aaaaaaaa", "aaaa"}}, // Eight fit
+		{"", []string{""}},
+	} {
+		got := wrap(tc.text, width)
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("wrap(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
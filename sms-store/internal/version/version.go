@@ -0,0 +1,71 @@
+// Package version reports build information for the running binary.
+//
+// Release builds inject the values with -ldflags:
+//
+//	go build -ldflags "\
+//	  -X sms-store/internal/version.Version=1.4.0 \
+//	  -X sms-store/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X sms-store/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//	  ./cmd/server
+//
+// Local builds without ldflags report "dev", falling back to the VCS
+// information the Go toolchain embeds when building inside a git checkout.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time via -ldflags "-X ...".
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info is the build information of the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information, filling gaps from the embedded build info.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "dev"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "dev"
+	}
+	return info
+}
+
+// String formats the info for log lines.
+func (i Info) String() string {
+	return i.Version + " (commit " + i.Commit + ", built " + i.BuildDate + ", " + i.GoVersion + ")"
+}
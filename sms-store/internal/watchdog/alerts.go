@@ -0,0 +1,85 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Events of an Alert.
+const (
+	EventQuiet   = "ingestion.quiet"   // A source stored nothing for longer than its threshold
+	EventResumed = "ingestion.resumed" // A quiet source stored a message again
+)
+
+// webhookTimeout bounds one webhook delivery, so a hung receiver can't hold
+// up the next check.
+const webhookTimeout = 10 * time.Second
+
+// Alert tells about a source going quiet or resuming.
+type Alert struct {
+	Event   string       `json:"event"`
+	Source  string       `json:"source"`
+	At      time.Time    `json:"at"`
+	Summary string       `json:"summary"` // One line, for chat and logs
+	Status  SourceStatus `json:"status"`
+}
+
+func newAlert(event string, status SourceStatus, now time.Time) Alert {
+	summary := fmt.Sprintf("%s has stored nothing for %s of expected traffic (threshold %s)", status.Source, status.QuietFor, status.Threshold)
+	if event == EventResumed {
+		summary = fmt.Sprintf("%s is storing messages again", status.Source)
+	}
+	return Alert{Event: event, Source: status.Source, At: now, Summary: summary, Status: status}
+}
+
+// Alerter raises alerts beyond the log.
+type Alerter interface {
+	Alert(ctx context.Context, alert Alert) error
+}
+
+// WebhookAlerter posts each alert as JSON to a URL.
+type WebhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlerter returns an alerter posting to url.
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	return &WebhookAlerter{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Alert posts alert, failing unless the receiver answers 2xx.
+func (a *WebhookAlerter) Alert(ctx context.Context, alert Alert) error {
+	return a.Post(ctx, alert, fmt.Sprintf("%s alert for %s", alert.Event, alert.Source))
+}
+
+// Post posts payload as JSON, failing unless the receiver answers 2xx. It
+// lets other monitors alert through the same webhook; what names the
+// payload in errors.
+func (a *WebhookAlerter) Post(ctx context.Context, payload any, what string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build alert webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("alert webhook answered %s to %s", resp.Status, what)
+	}
+	return nil
+}
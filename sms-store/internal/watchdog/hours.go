@@ -0,0 +1,161 @@
+package watchdog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxOverlapSpan bounds how far back Overlap looks. Any quiet stretch that
+// long is past every sensible threshold.
+const maxOverlapSpan = 370 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Hours are the hours traffic is expected in, such as weekdays from 09:00 to
+// 21:00 in one time zone. A window ending at or before its start runs past
+// midnight, and belongs to the day it starts on. The zero Hours are all
+// hours of every day.
+type Hours struct {
+	days     [7]bool // By time.Weekday
+	from, to int     // Minutes into the day
+	loc      *time.Location
+	spec     string
+}
+
+// ParseHours parses hours such as "09:00-21:00", "Mon-Fri 09:00-21:00" or
+// "Mon,Wed,Fri 22:00-06:00", in loc. Days are a comma-separated list of
+// days and ranges of days. An empty spec is all hours.
+func ParseHours(spec string, loc *time.Location) (Hours, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Hours{}, nil
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	h := Hours{loc: loc, spec: spec}
+
+	fields := strings.Fields(spec)
+	window := fields[len(fields)-1]
+	switch len(fields) {
+	case 1:
+		for d := range h.days {
+			h.days[d] = true
+		}
+	case 2:
+		if err := h.parseDays(fields[0]); err != nil {
+			return Hours{}, err
+		}
+	default:
+		return Hours{}, fmt.Errorf("hours %q must be days and a time range, such as Mon-Fri 09:00-21:00", spec)
+	}
+
+	start, end, ok := strings.Cut(window, "-")
+	if !ok {
+		return Hours{}, fmt.Errorf("hours %q must have a time range, such as 09:00-21:00", spec)
+	}
+	var err error
+	if h.from, err = parseClock(start); err != nil {
+		return Hours{}, err
+	}
+	if h.to, err = parseClock(end); err != nil {
+		return Hours{}, err
+	}
+	if h.from == h.to {
+		return Hours{}, fmt.Errorf("hours %q start and end at the same time", spec)
+	}
+	return h, nil
+}
+
+func (h *Hours) parseDays(list string) error {
+	for _, part := range strings.Split(strings.ToLower(list), ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, ok := weekdays[first]
+		to := from
+		if isRange {
+			to, ok = weekdays[last]
+		}
+		if !ok || (isRange && first == "") {
+			return fmt.Errorf("unknown days %q: use Mon, Tue, Wed, Thu, Fri, Sat and Sun", part)
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			h.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM, up to 24:00, into minutes into the day.
+func parseClock(raw string) (int, error) {
+	hh, mm, ok := strings.Cut(raw, ":")
+	hours, err1 := strconv.Atoi(hh)
+	minutes, err2 := strconv.Atoi(mm)
+	if !ok || err1 != nil || err2 != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time %q: use HH:MM", raw)
+	}
+	return hours*60 + minutes, nil
+}
+
+// All reports whether the hours are all hours of every day.
+func (h Hours) All() bool {
+	return h.loc == nil
+}
+
+// String returns the spec the hours were parsed from, or "always".
+func (h Hours) String() string {
+	if h.All() {
+		return "always"
+	}
+	return h.spec
+}
+
+// Within reports whether t is in the hours.
+func (h Hours) Within(t time.Time) bool {
+	return h.All() || h.Overlap(t, t.Add(time.Nanosecond)) > 0
+}
+
+// Overlap returns how much of [from, to) is in the hours.
+func (h Hours) Overlap(from, to time.Time) time.Duration {
+	if !to.After(from) {
+		return 0
+	}
+	if to.Sub(from) > maxOverlapSpan {
+		from = to.Add(-maxOverlapSpan)
+	}
+	if h.All() {
+		return to.Sub(from)
+	}
+
+	// A window starting the day before from can still run into it
+	from, to = from.In(h.loc), to.In(h.loc)
+	var total time.Duration
+	day := time.Date(from.Year(), from.Month(), from.Day()-1, 0, 0, 0, 0, h.loc)
+	for !day.After(to) {
+		if h.days[day.Weekday()] {
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, h.from, 0, 0, h.loc)
+			end := time.Date(day.Year(), day.Month(), day.Day(), 0, h.to, 0, 0, h.loc)
+			if h.to <= h.from {
+				end = end.AddDate(0, 0, 1)
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if overlap := end.Sub(start); overlap > 0 {
+				total += overlap
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return total
+}
@@ -0,0 +1,277 @@
+// Package watchdog notices when ingestion goes quiet. It is told when each
+// source, such as a Kafka topic or the HTTP API, last stored a message, and
+// alerts once a watched source has stored nothing for longer than its
+// threshold, counting only the hours traffic is expected in. A producer that
+// stops without an error is otherwise only noticed by the people waiting for
+// its messages.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"sms-store/internal/clock"
+	"sms-store/internal/metrics"
+)
+
+// SourceHTTP is the source of messages created through the HTTP API.
+const SourceHTTP = "http"
+
+// SourceKafka returns the source of messages consumed from topic.
+func SourceKafka(topic string) string {
+	return "kafka:" + topic
+}
+
+// SourceMQTT returns the source of messages received on an MQTT topic.
+func SourceMQTT(topic string) string {
+	return "mqtt:" + topic
+}
+
+// Statuses of a source.
+const (
+	StatusOK        = "ok"        // Stored a message within its threshold
+	StatusQuiet     = "quiet"     // Stored nothing for longer than its threshold
+	StatusOffHours  = "off_hours" // Outside the expected hours, and not quiet yet
+	StatusUnwatched = "unwatched" // Stored messages but has no threshold
+)
+
+var alertsSent = metrics.NewCounterVec(
+	"ingestion_watchdog_alerts_total",
+	"Alerts the ingestion watchdog raised, by source and event.",
+	"source", "event",
+)
+
+// Config describes which sources are watched and when.
+type Config struct {
+	Threshold  time.Duration            // Longest quiet stretch of a watched source without its own threshold
+	Thresholds map[string]time.Duration // By source; every source named here is watched
+	Hours      Hours                    // When traffic is expected; quiet time outside them doesn't count
+}
+
+// SourceStatus is what the watchdog knows about one source.
+type SourceStatus struct {
+	Source       string    `json:"source"`
+	Status       string    `json:"status"`
+	Threshold    string    `json:"threshold,omitempty"`
+	LastStoredAt time.Time `json:"lastStoredAt,omitzero"` // Zero until the source stores a message
+	Stored       int64     `json:"stored"`                // Messages stored since the server started
+	Gap          string    `json:"gap"`                   // Since the last message, or since watching started
+	QuietFor     string    `json:"quietFor,omitempty"`    // The part of the gap in expected hours
+	AlertedAt    time.Time `json:"alertedAt,omitzero"`    // When the source was last reported quiet, while it still is
+}
+
+// ParseThresholds parses an INGESTION_WATCHDOG_THRESHOLDS setting:
+// comma-separated source=duration pairs, e.g. "kafka:sms-events=15m,http=2h".
+func ParseThresholds(raw string) (map[string]time.Duration, error) {
+	thresholds := make(map[string]time.Duration)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rawThreshold, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, errors.New("threshold entries must look like source=duration")
+		}
+		threshold, err := time.ParseDuration(strings.TrimSpace(rawThreshold))
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("threshold of %s must be a positive duration", name)
+		}
+		thresholds[name] = threshold
+	}
+	return thresholds, nil
+}
+
+// Watchdog tracks the last message each source stored and raises alerts
+// from Check. Its methods are safe for concurrent use.
+type Watchdog struct {
+	config  Config
+	alerter Alerter
+
+	mu      sync.Mutex
+	sources map[string]*source
+
+	clock.Clocked // Tells the time of gaps and alerts
+}
+
+type source struct {
+	watchedAt time.Time     // When watching started; the gap of a source that never stored counts from it
+	threshold time.Duration // 0 if unwatched
+	last      time.Time
+	stored    int64
+	alertedAt time.Time // Zero unless reported quiet
+}
+
+// New returns a watchdog for config that raises alerts with alerter, after
+// logging them. A nil alerter only logs.
+func New(config Config, alerter Alerter) (*Watchdog, error) {
+	if config.Threshold < 0 {
+		return nil, errors.New("threshold must not be negative")
+	}
+	for name, threshold := range config.Thresholds {
+		if threshold <= 0 {
+			return nil, fmt.Errorf("threshold of %s must be positive", name)
+		}
+	}
+	return &Watchdog{config: config, alerter: alerter, sources: make(map[string]*source)}, nil
+}
+
+// Watch starts watching name, with its own threshold or the default one.
+// Until it stores a message its gap counts from now. Watching a source
+// already watched does nothing; without any threshold nothing is watched.
+func (w *Watchdog) Watch(name string) {
+	threshold, ok := w.config.Thresholds[name]
+	if !ok {
+		threshold = w.config.Threshold
+	}
+	if threshold <= 0 {
+		return
+	}
+
+	now := w.Clock().Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.sources[name]
+	if s == nil {
+		s = &source{}
+		w.sources[name] = s
+	}
+	if s.threshold == 0 {
+		s.watchedAt = now
+		s.threshold = threshold
+	}
+}
+
+// WatchConfigured watches every source with a threshold of its own.
+func (w *Watchdog) WatchConfigured() {
+	for name := range w.config.Thresholds {
+		w.Watch(name)
+	}
+}
+
+// Stored records that name stored n messages at at. It is called on the
+// ingestion path and never blocks on alerts.
+func (w *Watchdog) Stored(name string, n int, at time.Time) {
+	if n <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.sources[name]
+	if s == nil {
+		s = &source{}
+		w.sources[name] = s
+	}
+	if at.After(s.last) {
+		s.last = at
+	}
+	s.stored += int64(n)
+}
+
+// Sources returns the status of every source, by name.
+func (w *Watchdog) Sources() []SourceStatus {
+	now := w.Clock().Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.statuses(now)
+}
+
+// Quiet returns the status of the sources that are quiet, by name.
+func (w *Watchdog) Quiet() []SourceStatus {
+	return slices.DeleteFunc(w.Sources(), func(s SourceStatus) bool { return s.Status != StatusQuiet })
+}
+
+// Hours returns the hours traffic is expected in.
+func (w *Watchdog) Hours() Hours {
+	return w.config.Hours
+}
+
+func (w *Watchdog) statuses(now time.Time) []SourceStatus {
+	statuses := make([]SourceStatus, 0, len(w.sources))
+	for name, s := range w.sources {
+		statuses = append(statuses, w.status(name, s, now))
+	}
+	slices.SortFunc(statuses, func(a, b SourceStatus) int { return strings.Compare(a.Source, b.Source) })
+	return statuses
+}
+
+func (w *Watchdog) status(name string, s *source, now time.Time) SourceStatus {
+	since := s.last
+	if since.IsZero() || s.watchedAt.After(since) {
+		since = s.watchedAt
+	}
+	gap := max(0, now.Sub(since))
+	quiet := w.config.Hours.Overlap(since, now)
+	status := SourceStatus{
+		Source:       name,
+		LastStoredAt: s.last,
+		Stored:       s.stored,
+		Gap:          gap.Round(time.Second).String(),
+		QuietFor:     quiet.Round(time.Second).String(),
+		AlertedAt:    s.alertedAt,
+	}
+	switch {
+	case s.threshold == 0:
+		status.Status = StatusUnwatched
+		status.Gap = max(0, now.Sub(s.last)).Round(time.Second).String()
+		status.QuietFor = ""
+	case quiet > s.threshold:
+		status.Status = StatusQuiet
+	case !w.config.Hours.Within(now):
+		status.Status = StatusOffHours
+	default:
+		status.Status = StatusOK
+	}
+	if s.threshold > 0 {
+		status.Threshold = s.threshold.String()
+	}
+	return status
+}
+
+// Check raises an alert for each watched source that went quiet since the
+// last check, and for each that stored a message again. It is meant to run
+// as a scheduled task, every minute or so; alerts lag by up to that
+// interval. It returns the errors of the alerts that could not be raised.
+func (w *Watchdog) Check(ctx context.Context) error {
+	now := w.Clock().Now()
+	var alerts []Alert
+	w.mu.Lock()
+	for name, s := range w.sources {
+		if s.threshold == 0 {
+			continue
+		}
+		status := w.status(name, s, now)
+		switch quiet := status.Status == StatusQuiet; {
+		case quiet && s.alertedAt.IsZero():
+			s.alertedAt = now
+			status.AlertedAt = now
+			alerts = append(alerts, newAlert(EventQuiet, status, now))
+		case !quiet && !s.alertedAt.IsZero():
+			s.alertedAt = time.Time{}
+			status.AlertedAt = time.Time{}
+			alerts = append(alerts, newAlert(EventResumed, status, now))
+		}
+	}
+	w.mu.Unlock()
+
+	slices.SortFunc(alerts, func(a, b Alert) int { return strings.Compare(a.Source, b.Source) })
+	var errs []error
+	for _, alert := range alerts {
+		alertsSent.WithLabelValues(alert.Source, alert.Event).Inc()
+		log.Printf("Ingestion watchdog: %s", alert.Summary)
+		if w.alerter == nil {
+			continue
+		}
+		if err := w.alerter.Alert(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,148 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sms-store/internal/clock/clocktest"
+)
+
+// recordingAlerter records the events it is sent, failing with err if set.
+type recordingAlerter struct {
+	events []string
+	err    error
+}
+
+func (a *recordingAlerter) Alert(_ context.Context, alert Alert) error {
+	a.events = append(a.events, alert.Event+" "+alert.Source)
+	return a.err
+}
+
+// newTestWatchdog returns a watchdog of config on a fake clock starting at
+// start, and the alerter it raises alerts with.
+func newTestWatchdog(t *testing.T, config Config, start time.Time) (*Watchdog, *clocktest.Fake, *recordingAlerter) {
+	t.Helper()
+	alerter := &recordingAlerter{}
+	w, err := New(config, alerter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clocktest.NewFake(start)
+	w.SetClock(fake)
+	return w, fake, alerter
+}
+
+// check runs a Check and returns the alerts it raised.
+func check(t *testing.T, w *Watchdog, alerter *recordingAlerter) []string {
+	t.Helper()
+	alerter.events = nil
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return alerter.events
+}
+
+func TestWatchdogAlertsOnceQuietAndOnResuming(t *testing.T) {
+	source := SourceKafka("sms-events")
+	w, fake, alerter := newTestWatchdog(t, Config{Thresholds: map[string]time.Duration{source: 15 * time.Minute}}, time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC))
+	w.WatchConfigured()
+	w.Stored(source, 3, fake.Now())
+
+	fake.Advance(15 * time.Minute)
+	if alerts := check(t, w, alerter); len(alerts) != 0 {
+		t.Fatalf("alerts at the threshold = %v, want none", alerts)
+	}
+	fake.Advance(time.Second)
+	if alerts := check(t, w, alerter); len(alerts) != 1 || alerts[0] != EventQuiet+" "+source {
+		t.Fatalf("alerts past the threshold = %v, want %s", alerts, EventQuiet)
+	}
+	quiet := w.Quiet()
+	if len(quiet) != 1 || quiet[0].QuietFor != "15m1s" || !quiet[0].AlertedAt.Equal(fake.Now()) {
+		t.Fatalf("quiet sources = %+v, want %s quiet for 15m1s", quiet, source)
+	}
+	// Reported once while it stays quiet
+	fake.Advance(time.Hour)
+	if alerts := check(t, w, alerter); len(alerts) != 0 {
+		t.Fatalf("alerts while still quiet = %v, want none", alerts)
+	}
+
+	w.Stored(source, 1, fake.Now())
+	if alerts := check(t, w, alerter); len(alerts) != 1 || alerts[0] != EventResumed+" "+source {
+		t.Fatalf("alerts after a message = %v, want %s", alerts, EventResumed)
+	}
+	if sources := w.Sources(); len(sources) != 1 || sources[0].Status != StatusOK || sources[0].Stored != 4 || !sources[0].AlertedAt.IsZero() {
+		t.Fatalf("sources = %+v, want %s ok with 4 stored", sources, source)
+	}
+}
+
+func TestWatchdogCountsOnlyExpectedHours(t *testing.T) {
+	hours, err := ParseHours("Mon-Fri 09:00-21:00", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Friday, ten minutes before the hours end
+	w, fake, alerter := newTestWatchdog(t, Config{Threshold: 15 * time.Minute, Hours: hours}, time.Date(2026, 10, 16, 20, 50, 0, 0, time.UTC))
+	w.Watch(SourceHTTP)
+	w.Stored(SourceHTTP, 1, fake.Now())
+
+	// Quiet over the weekend, but only ten minutes of it count
+	for range 2 * 24 * 6 {
+		fake.Advance(10 * time.Minute)
+		if alerts := check(t, w, alerter); len(alerts) != 0 {
+			t.Fatalf("alerts at %v = %v, want none outside the hours", fake.Now(), alerts)
+		}
+	}
+	if sources := w.Sources(); sources[0].Status != StatusOffHours || sources[0].QuietFor != "10m0s" {
+		t.Fatalf("sources at %v = %+v, want off hours, quiet for 10m", fake.Now(), sources)
+	}
+
+	// Monday: five minutes more make the threshold, past it alerts
+	fake.Set(time.Date(2026, 10, 19, 9, 5, 0, 0, time.UTC))
+	if alerts := check(t, w, alerter); len(alerts) != 0 {
+		t.Fatalf("alerts at the threshold = %v, want none", alerts)
+	}
+	fake.Advance(time.Minute)
+	if alerts := check(t, w, alerter); len(alerts) != 1 || alerts[0] != EventQuiet+" "+SourceHTTP {
+		t.Fatalf("alerts past the threshold = %v, want %s", alerts, EventQuiet)
+	}
+}
+
+func TestWatchdogGapOfSilentSourceCountsFromWatching(t *testing.T) {
+	start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	w, fake, alerter := newTestWatchdog(t, Config{Threshold: time.Hour}, start)
+	fake.Advance(2 * time.Hour)
+	w.Watch(SourceMQTT("sms"))
+	// Stored before it was watched, and by a source that isn't watched
+	w.Stored(SourceMQTT("sms"), 1, start)
+	w.Stored(SourceHTTP, 1, fake.Now())
+
+	fake.Advance(time.Hour)
+	if alerts := check(t, w, alerter); len(alerts) != 0 {
+		t.Fatalf("alerts an hour after watching = %v, want none", alerts)
+	}
+	fake.Advance(time.Second)
+	if alerts := check(t, w, alerter); len(alerts) != 1 || alerts[0] != EventQuiet+" "+SourceMQTT("sms") {
+		t.Fatalf("alerts = %v, want only %s quiet", alerts, SourceMQTT("sms"))
+	}
+	if sources := w.Sources(); len(sources) != 2 || sources[0].Source != SourceHTTP || sources[0].Status != StatusUnwatched {
+		t.Fatalf("sources = %+v, want %s unwatched", sources, SourceHTTP)
+	}
+}
+
+func TestWatchdogReturnsAlerterErrors(t *testing.T) {
+	w, fake, alerter := newTestWatchdog(t, Config{Threshold: time.Minute}, time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC))
+	alerter.err = errors.New("webhook down")
+	w.Watch(SourceHTTP)
+
+	fake.Advance(2 * time.Minute)
+	if err := w.Check(context.Background()); !errors.Is(err, alerter.err) {
+		t.Fatalf("Check = %v, want the alerter's error", err)
+	}
+	// The source was reported quiet all the same, and isn't again
+	alerter.err = nil
+	if alerts := check(t, w, alerter); len(alerts) != 0 {
+		t.Fatalf("alerts = %v, want none", alerts)
+	}
+}
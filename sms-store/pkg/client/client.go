@@ -0,0 +1,227 @@
+// Package client provides a typed Go client for the sms-store HTTP API.
+//
+// Services that talk to sms-store should use this package instead of
+// hand-rolling HTTP calls so that retries, error decoding and pagination
+// behave the same everywhere.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds configuration for the client.
+type Config struct {
+	BaseURL    string        // Base URL of the sms-store service, e.g. http://localhost:8082
+	HTTPClient *http.Client  // HTTP client used for requests (defaults to a client with a 30s timeout)
+	MaxRetries int           // Maximum number of retries on 429 and retryable 5xx responses
+	MinBackoff time.Duration // Initial backoff between retries
+	MaxBackoff time.Duration // Upper bound for backoff and honored Retry-After values
+	UserAgent  string        // User-Agent header sent with every request
+	APIKey     string        // Optional API key sent as a bearer token
+}
+
+// DefaultConfig returns default configuration values.
+func DefaultConfig() Config {
+	return Config{
+		BaseURL:    "http://localhost:8082",
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		MaxRetries: 3,
+		MinBackoff: 200 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+		UserAgent:  "sms-store-go-client",
+	}
+}
+
+// Client wraps all sms-store endpoints.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	userAgent  string
+	apiKey     string
+}
+
+// New creates a client for the given base URL using default configuration.
+func New(baseURL string) *Client {
+	cfg := DefaultConfig()
+	cfg.BaseURL = baseURL
+	return NewWithConfig(cfg)
+}
+
+// NewWithConfig creates a client with custom configuration.
+// Zero values fall back to the defaults.
+func NewWithConfig(cfg Config) *Client {
+	def := DefaultConfig()
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = def.BaseURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = def.HTTPClient
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = def.MinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = def.UserAgent
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		httpClient: cfg.HTTPClient,
+		maxRetries: cfg.MaxRetries,
+		minBackoff: cfg.MinBackoff,
+		maxBackoff: cfg.MaxBackoff,
+		userAgent:  cfg.UserAgent,
+		apiKey:     cfg.APIKey,
+	}
+}
+
+/* ---------- request plumbing ---------- */
+
+// do sends a request and decodes a JSON response into out (if non-nil).
+// Requests are retried on 429 and, for idempotent methods, on 5xx responses.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+	}
+
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, endpoint, payload)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			return nil
+		}
+
+		apiErr := decodeAPIError(resp)
+		if attempt >= c.maxRetries || !c.shouldRetry(method, resp.StatusCode) {
+			return apiErr
+		}
+
+		wait := c.backoff(attempt, resp.Header.Get("Retry-After"))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send performs a single HTTP round trip.
+func (c *Client) send(ctx context.Context, method, endpoint string, payload []byte) (*http.Response, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+	return resp, nil
+}
+
+// shouldRetry reports whether a failed response may be retried.
+// 429 means the request was not processed, so it is always safe to retry.
+// 5xx responses are only retried for idempotent methods so a POST is never duplicated.
+func (c *Client) shouldRetry(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	if status < 500 {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// backoff returns how long to wait before the next attempt.
+// A Retry-After header (seconds or HTTP date) takes precedence over exponential backoff.
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+	if d, ok := parseRetryAfter(retryAfter); ok {
+		if d > c.maxBackoff {
+			return c.maxBackoff
+		}
+		return d
+	}
+
+	d := c.minBackoff << attempt
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	// Full jitter keeps concurrent clients from retrying in lockstep
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// parseRetryAfter parses a Retry-After header value.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
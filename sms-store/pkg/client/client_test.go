@@ -0,0 +1,334 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of srv that retries quickly.
+func newTestClient(srv *httptest.Server, maxRetries int) *Client {
+	return NewWithConfig(Config{
+		BaseURL:    srv.URL,
+		HTTPClient: srv.Client(),
+		MaxRetries: maxRetries,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	})
+}
+
+func TestMessagesPagesThroughNextCursor(t *testing.T) {
+	// Three pages of two, with an empty page, which still has more, between
+	// the first two
+	pages := map[string]string{
+		"":   `{"data": [{"id": "m6"}, {"id": "m5"}], "meta": {"limit": 2, "hasMore": true, "nextCursor": "c1"}}`,
+		"c1": `{"data": [], "meta": {"limit": 2, "hasMore": true, "nextCursor": "c2"}}`,
+		"c2": `{"data": [{"id": "m4"}, {"id": "m3"}], "meta": {"limit": 2, "hasMore": true, "nextCursor": "c3"}}`,
+		"c3": `{"data": [{"id": "m2"}, {"id": "m1"}], "meta": {"limit": 2, "hasMore": false}}`,
+	}
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/user/9876543210/messages" || r.URL.Query().Get("limit") != strconv.Itoa(iteratorPageSize) {
+			t.Errorf("request %s, want a page of /v1/user/9876543210/messages", r.URL)
+		}
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		body, ok := pages[cursor]
+		if !ok {
+			http.Error(w, "unknown cursor", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	it := newTestClient(srv, 0).Messages(context.Background(), "9876543210")
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Message().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+	if fmt.Sprint(ids) != "[m6 m5 m4 m3 m2 m1]" {
+		t.Fatalf("iterated %v, want m6 to m1", ids)
+	}
+	if fmt.Sprint(cursors) != "[ c1 c2 c3]" {
+		t.Fatalf("fetched cursors %q, want the first page and then each nextCursor", cursors)
+	}
+	if it.Next() {
+		t.Fatal("Next after the last page = true")
+	}
+}
+
+func TestMessagesStopsOnMissingCursor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"id": "m2"}], "meta": {"limit": 1, "hasMore": true}}`)
+	}))
+	defer srv.Close()
+
+	it := newTestClient(srv, 0).Messages(context.Background(), "9876543210")
+	if !it.Next() || it.Message().ID != "m2" {
+		t.Fatal("the page without a cursor wasn't iterated")
+	}
+	if it.Next() {
+		t.Fatal("Next past a page with more but no cursor = true")
+	}
+	if !errors.Is(it.Err(), errMissingCursor) {
+		t.Fatalf("Err = %v, want errMissingCursor", it.Err())
+	}
+}
+
+func TestMessagesReportsFetchErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "" {
+			fmt.Fprint(w, `{"data": [{"id": "m2"}], "meta": {"limit": 1, "hasMore": true, "nextCursor": "bad"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code": "BAD_REQUEST", "message": "invalid cursor"}`)
+	}))
+	defer srv.Close()
+
+	it := newTestClient(srv, 0).Messages(context.Background(), "9876543210")
+	for it.Next() {
+	}
+	if !errors.Is(it.Err(), ErrBadRequest) {
+		t.Fatalf("Err = %v, want ErrBadRequest", it.Err())
+	}
+}
+
+func TestPageOptionsIncludeTotal(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		if r.URL.Query().Get("includeTotal") == "true" {
+			fmt.Fprint(w, `{"data": [{"id": "m2"}], "meta": {"limit": 1, "hasMore": true, "nextCursor": "c1", "totalCount": 2}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"id": "m2"}], "meta": {"limit": 1, "hasMore": true, "nextCursor": "c1"}}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv, 0)
+
+	page, err := c.ListMessagesPage(context.Background(), PageOptions{Limit: 1, IncludeTotal: true})
+	if err != nil {
+		t.Fatalf("ListMessagesPage: %v", err)
+	}
+	if page.Meta.TotalCount == nil || *page.Meta.TotalCount != 2 {
+		t.Fatalf("TotalCount = %v, want 2", page.Meta.TotalCount)
+	}
+	page, err = c.GetUserMessagesPage(context.Background(), "9876543210", PageOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetUserMessagesPage: %v", err)
+	}
+	if page.Meta.TotalCount != nil {
+		t.Fatalf("TotalCount = %d without IncludeTotal, want none", *page.Meta.TotalCount)
+	}
+	if fmt.Sprint(queries) != "[includeTotal=true&limit=1 limit=1]" {
+		t.Fatalf("queries %q, want includeTotal only when asked", queries)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		method   string
+		statuses []int // Answered in turn; the last one repeats
+		attempts int32
+		wantErr  error
+	}{
+		{"GetRetries5xx", http.MethodGet, []int{503, 502, 200}, 3, nil},
+		{"PostRetries429", http.MethodPost, []int{429, 200}, 2, nil},
+		{"PostDoesNotRetry5xx", http.MethodPost, []int{503, 200}, 1, ErrInternal},
+		{"DoesNotRetry4xx", http.MethodGet, []int{404, 200}, 1, ErrNotFound},
+		{"GivesUpAfterMaxRetries", http.MethodGet, []int{500}, 4, ErrInternal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1))
+				status := tc.statuses[min(n, len(tc.statuses))-1]
+				if status == http.StatusOK {
+					fmt.Fprint(w, `{"status": "ok"}`)
+					return
+				}
+				w.WriteHeader(status)
+				fmt.Fprintf(w, `{"code": "%s", "message": "attempt %d"}`, map[int]string{404: CodeNotFound}[status], n)
+			}))
+			defer srv.Close()
+
+			err := newTestClient(srv, 3).do(context.Background(), tc.method, "/ping", nil, nil, nil)
+			if tc.wantErr == nil && err != nil || tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if got := attempts.Load(); got != tc.attempts {
+				t.Fatalf("%d attempts, want %d", got, tc.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryAfterIsHonored(t *testing.T) {
+	var attempts atomic.Int32
+	var first time.Time
+	var waited time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		waited = time.Since(first)
+		fmt.Fprint(w, `{"status": "ok"}`)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv, 1)
+	c.maxBackoff = 5 * time.Second
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if waited < time.Second {
+		t.Fatalf("retried after %v, want the Retry-After of 1s", waited)
+	}
+}
+
+func TestRetryStopsWhenContextEnds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv, 3)
+	c.maxBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's deadline", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := NewWithConfig(Config{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	for _, tc := range []struct {
+		attempt    int
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{0, "", 1, 100 * time.Millisecond},
+		{2, "", 1, 400 * time.Millisecond},
+		{10, "", 1, time.Second}, // Capped at MaxBackoff
+		{0, "0", 0, 0},
+		{0, "1", time.Second, time.Second},
+		{0, "120", time.Second, time.Second}, // Retry-After is capped too
+		{0, "soon", 1, 100 * time.Millisecond},
+	} {
+		for range 20 { // Jittered
+			if d := c.backoff(tc.attempt, tc.retryAfter); d < tc.min || d > tc.max {
+				t.Fatalf("backoff(%d, %q) = %v, want within [%v, %v]", tc.attempt, tc.retryAfter, d, tc.min, tc.max)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{" 3 ", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true}, // A date in the past means now
+	} {
+		got, ok := parseRetryAfter(tc.value)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	d, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if !ok || d <= 0 || d > time.Minute {
+		t.Errorf("parseRetryAfter of a date a minute away = %v, %v", d, ok)
+	}
+}
+
+func TestAPIErrorSentinels(t *testing.T) {
+	sentinels := []error{ErrBadRequest, ErrNotFound, ErrConflict, ErrInternal}
+	for _, tc := range []struct {
+		status  int
+		body    string
+		want    error // Nil matches no sentinel
+		message string
+	}{
+		{400, `{"code": "BAD_REQUEST", "message": "invalid phone number"}`, ErrBadRequest, "invalid phone number"},
+		{404, `{"code": "NOT_FOUND", "message": "message not found"}`, ErrNotFound, "message not found"},
+		{404, `{"code": "CONVERSATION_NOT_FOUND", "message": "no messages"}`, ErrNotFound, "no messages"},
+		{409, `{"code": "CONFLICT", "message": "profile already exists"}`, ErrConflict, "profile already exists"},
+		{500, `{"code": "INTERNAL", "message": "could not save"}`, ErrInternal, "could not save"},
+		{503, "upstream unavailable", ErrInternal, "upstream unavailable"},
+		{405, "method not allowed\n", nil, "method not allowed\n"},
+		{404, "", ErrNotFound, "Not Found"},
+		{451, `{"code": "REGION_NOT_ALLOWED", "message": "message is stored in region eu"}`, nil, "message is stored in region eu"},
+		{400, `{"code": "UNAUTHORIZED", "message": "nope"}`, nil, "nope"}, // The code decides, not the status
+	} {
+		t.Run(fmt.Sprintf("%d %s", tc.status, tc.body), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer srv.Close()
+
+			_, err := newTestClient(srv, 0).GetMessage(context.Background(), "m1")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != tc.status || apiErr.Message != tc.message {
+				t.Fatalf("APIError = %+v, want status %d and message %q", apiErr, tc.status, tc.message)
+			}
+			for _, sentinel := range sentinels {
+				if got := errors.Is(err, sentinel); got != (sentinel == tc.want) {
+					t.Errorf("errors.Is(err, %v) = %v", sentinel, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthReturnsDownService(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"status": "DOWN", "components": {"mongodb": {"status": "failed", "message": "no reachable servers"}, "kafka": {"status": "up", "details": {"stats": {"messagesSaved": 7}}}}}`)
+	}))
+	defer srv.Close()
+
+	health, err := newTestClient(srv, 3).Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if attempts.Load() != 1 {
+		t.Fatalf("%d attempts, want a DOWN answer taken as is", attempts.Load())
+	}
+	if health.Status != "DOWN" || health.Components["mongodb"].Message != "no reachable servers" {
+		t.Fatalf("health = %+v", health)
+	}
+	stats, err := health.ConsumerStats()
+	if err != nil || stats == nil || stats.MessagesSaved != 7 {
+		t.Fatalf("ConsumerStats = %+v, %v; want 7 saved", stats, err)
+	}
+}
@@ -0,0 +1,568 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message mirrors the message resource returned by the server.
+type Message struct {
+	ID              string        `json:"id"`
+	CorrelationID   string        `json:"correlationId"`
+	PhoneNumber     string        `json:"phoneNumber"`
+	Text            string        `json:"text"`
+	Status          string        `json:"status"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	Provider        *Provider     `json:"provider,omitempty"`
+	AccountID       string        `json:"accountId,omitempty"`
+	Region          string        `json:"region,omitempty"` // Data residency region, on servers with residency configured
+	Cost            *Cost         `json:"cost,omitempty"`
+	ReplyToID       string        `json:"replyToId,omitempty"`
+	ExternalRefs    []ExternalRef `json:"externalRefs,omitempty"`
+	ForwardedFromID string        `json:"forwardedFromId,omitempty"` // Message whose text this one forwards
+	Participant     *Participant  `json:"participant,omitempty"`     // Who, of the people sharing the number, the message is from or for
+	Annotations     []Annotation  `json:"annotations,omitempty"`     // Labels set by classifiers, one per source
+	Translations    []Translation `json:"translations,omitempty"`    // With PageOptions.IncludeTranslations, the translations into those languages
+	Source          string        `json:"source,omitempty"`          // auto-ack for automatic acknowledgements, which don't count as unread
+	Self            string        `json:"self,omitempty"`            // URL of GetMessage; set by CreateMessage and GetMessage
+}
+
+// Annotation is a label a classifier gave a message, as SetAnnotation sets it.
+type Annotation struct {
+	Source     string            `json:"source"`
+	Label      string            `json:"label"`
+	Confidence float64           `json:"confidence"` // From 0 to 1
+	CreatedAt  time.Time         `json:"createdAt"`
+	Review     *AnnotationReview `json:"review,omitempty"` // Nil until ReviewAnnotation; cleared when the source sets the annotation again
+}
+
+// Translation is a message's text in another language, as SetTranslation
+// stores it.
+type Translation struct {
+	Language  string    `json:"language"` // Language code, such as "hi" or "hi-Latn"
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AnnotationReview is a person's decision on an annotation.
+type AnnotationReview struct {
+	Reviewer   string    `json:"reviewer"`
+	Decision   string    `json:"decision"` // "confirmed" or "rejected"
+	Note       string    `json:"note,omitempty"`
+	ReviewedAt time.Time `json:"reviewedAt"`
+}
+
+// AnnotationCount is how many of a conversation's annotations have one
+// label, and how many of those reviewers confirmed and rejected.
+type AnnotationCount struct {
+	Label       string `json:"label"`
+	Annotations int64  `json:"annotations"`
+	Confirmed   int64  `json:"confirmed"`
+	Rejected    int64  `json:"rejected"`
+}
+
+// ExternalRef names a record of another system a message concerns, such as
+// an order.
+type ExternalRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Participant is one of the people sharing a phone number.
+type Participant struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// ParticipantCount is how many of a conversation's messages one participant
+// has. Messages without a participant count towards ID "default".
+type ParticipantCount struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Messages int64  `json:"messages"`
+}
+
+// Cost is the server's estimate of what sending a message cost.
+type Cost struct {
+	Segments      int     `json:"segments"`
+	EstimatedCost float64 `json:"estimatedCost"`
+	Currency      string  `json:"currency"`
+	Prefix        string  `json:"prefix,omitempty"`
+	DefaultRate   bool    `json:"defaultRate,omitempty"` // No pricing table prefix matched
+}
+
+// Provider is the upstream SMS provider's metadata for a message.
+type Provider struct {
+	Name      string `json:"name"`
+	MessageID string `json:"messageId,omitempty"`
+	SenderID  string `json:"senderId,omitempty"`
+	Carrier   string `json:"carrier,omitempty"`
+}
+
+// Profile mirrors the profile resource returned by the server.
+type Profile struct {
+	PhoneNumber string    `json:"phoneNumber"`
+	Name        string    `json:"name"`
+	Avatar      string    `json:"avatar"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	MovedTo     string    `json:"movedTo,omitempty"` // Set by GetProfile of a number whose profile was merged into this one
+	Region      string    `json:"region,omitempty"`  // Data residency region, on servers with residency configured
+	Self        string    `json:"self,omitempty"`    // URL of GetProfile
+}
+
+// CreateMessageRequest is the body for CreateMessage.
+type CreateMessageRequest struct {
+	PhoneNumber  string        `json:"phoneNumber"`
+	Text         string        `json:"text"`
+	Provider     *Provider     `json:"provider,omitempty"`
+	ReplyToID    string        `json:"replyToId,omitempty"`    // Message in the same conversation this one answers
+	ExternalRefs []ExternalRef `json:"externalRefs,omitempty"` // At most 10
+
+	// Who, of the people sharing the number, the message is from or for;
+	// ParticipantID defaults to one derived from SenderName
+	ParticipantID string `json:"participantId,omitempty"`
+	SenderName    string `json:"senderName,omitempty"`
+}
+
+// PageMeta describes the position of a page within a result set.
+type PageMeta struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	TotalCount *int64 `json:"totalCount,omitempty"` // With PageOptions.IncludeTotal, where the server counts the filter
+}
+
+// MessagePage is one page of a paginated message listing.
+type MessagePage struct {
+	Data         []Message          `json:"data"`
+	Participants []ParticipantCount `json:"participants,omitempty"` // With PageOptions.IncludeParticipants, most messages first
+	Annotations  []AnnotationCount  `json:"annotations,omitempty"`  // With PageOptions.IncludeAnnotations, most annotations first
+	Meta         PageMeta           `json:"meta"`
+}
+
+// PageOptions selects a page. A zero Limit requests 200 messages.
+type PageOptions struct {
+	Limit    int
+	Cursor   string
+	SenderID string // Only messages sent from this provider sender ID
+
+	// Participant keeps only the messages of the participant with this ID;
+	// "default" keeps those without one
+	Participant string
+
+	// IncludeParticipants counts the conversation's messages by participant
+	// in MessagePage.Participants; GetUserMessagesPage only
+	IncludeParticipants bool
+
+	// Annotation keeps only the messages with an annotation of this label,
+	// of at least MinConfidence, that no reviewer rejected
+	Annotation    string
+	MinConfidence float64
+
+	// IncludeAnnotations counts the conversation's annotations by label in
+	// MessagePage.Annotations; GetUserMessagesPage only
+	IncludeAnnotations bool
+
+	// IncludeTranslations adds each message's translations into these
+	// language codes to Message.Translations; GetUserMessagesPage only
+	IncludeTranslations []string
+
+	// IncludeTotal counts the messages across every page in
+	// PageMeta.TotalCount, a query of its own that large filtered
+	// listings may find slow
+	IncludeTotal bool
+}
+
+// DeleteResult is returned by the delete endpoints.
+type DeleteResult struct {
+	Message       string `json:"message"`
+	DeletedCount  int64  `json:"deletedCount"`
+	PhoneNumber   string `json:"phoneNumber,omitempty"`
+	JobID         string `json:"jobId,omitempty"` // Background job of a batched delete-all
+	Mode          string `json:"mode,omitempty"`
+	ProfileExists *bool  `json:"profileExists,omitempty"` // Whether a DeleteUserMessages number's profile remains; nil if unknown
+}
+
+/* ---------- health ---------- */
+
+// Ping calls GET /ping and returns the reported status.
+func (c *Client) Ping(ctx context.Context) (string, error) {
+	var resp struct {
+		Status string `json:"status"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/ping", nil, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Status, nil
+}
+
+// Health is the service's health as GET /healthz reports it.
+type Health struct {
+	Status     string                     `json:"status"` // UP, DEGRADED or DOWN
+	Version    BuildInfo                  `json:"version"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// BuildInfo is the build of the server.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// ComponentHealth is the health of one of the server's dependencies, such as
+// mongodb or kafka.
+type ComponentHealth struct {
+	Status  string          `json:"status"` // up, connecting, degraded or failed
+	Message string          `json:"message,omitempty"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// ConsumerStats are the Kafka consumer's counters, part of the kafka
+// component's details while the consumer runs.
+type ConsumerStats struct {
+	Topic                string     `json:"topic"`
+	GroupID              string     `json:"groupId"`
+	MessagesReceived     int64      `json:"messagesReceived"`
+	ParseErrors          int64      `json:"parseErrors"`
+	MessagesSaved        int64      `json:"messagesSaved"`
+	BatchesFlushed       int64      `json:"batchesFlushed"`
+	BatchErrors          int64      `json:"batchErrors"`
+	DeadLettered         int64      `json:"deadLettered"`
+	DuplicatesSuppressed int64      `json:"duplicatesSuppressed"`
+	InFlight             int        `json:"inFlight"`
+	LastMessageAt        *time.Time `json:"lastMessageAt,omitempty"`
+}
+
+// ConsumerStats returns the Kafka consumer's counters, or nil when the
+// server reports none, as while the consumer connects.
+func (h Health) ConsumerStats() (*ConsumerStats, error) {
+	kafka, ok := h.Components["kafka"]
+	if !ok || len(kafka.Details) == 0 {
+		return nil, nil
+	}
+	var details struct {
+		Stats *ConsumerStats `json:"stats"`
+	}
+	if err := json.Unmarshal(kafka.Details, &details); err != nil {
+		return nil, fmt.Errorf("failed to decode kafka stats: %w", err)
+	}
+	return details.Stats, nil
+}
+
+// Health calls GET /healthz. A DOWN service answers 503 with its health,
+// which is returned rather than an error, and isn't retried.
+func (c *Client) Health(ctx context.Context) (Health, error) {
+	resp, err := c.send(ctx, http.MethodGet, c.baseURL+"/healthz", nil)
+	if err != nil {
+		return Health{}, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return Health{}, decodeAPIError(resp)
+	}
+	defer resp.Body.Close()
+	var health Health
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return Health{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return health, nil
+}
+
+/* ---------- conversations ---------- */
+
+// ListConversations calls GET /v1/conversations and returns the phone numbers with messages.
+func (c *Client) ListConversations(ctx context.Context) ([]string, error) {
+	var phoneNumbers []string
+	if err := c.do(ctx, http.MethodGet, "/v1/conversations", nil, nil, &phoneNumbers); err != nil {
+		return nil, err
+	}
+	return phoneNumbers, nil
+}
+
+// GetUserMessages calls GET /v1/user/{phoneNumber}/messages.
+func (c *Client) GetUserMessages(ctx context.Context, phoneNumber string) ([]Message, error) {
+	var messages []Message
+	if err := c.do(ctx, http.MethodGet, userMessagesPath(phoneNumber), nil, nil, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetUserMessagesPage fetches one newest-first page of messages for a phone number.
+// Pass the previous page's Meta.NextCursor to continue.
+func (c *Client) GetUserMessagesPage(ctx context.Context, phoneNumber string, opts PageOptions) (MessagePage, error) {
+	var page MessagePage
+	err := c.do(ctx, http.MethodGet, userMessagesPath(phoneNumber), opts.values(), nil, &page)
+	return page, err
+}
+
+// DeleteUserMessages calls DELETE /v1/user/{phoneNumber}/messages. A number
+// that was never seen fails with an error matching ErrNotFound.
+func (c *Client) DeleteUserMessages(ctx context.Context, phoneNumber string) (DeleteResult, error) {
+	var result DeleteResult
+	err := c.do(ctx, http.MethodDelete, userMessagesPath(phoneNumber), nil, nil, &result)
+	return result, err
+}
+
+// Messages returns an iterator over all messages for a phone number, newest first.
+// Pages are fetched lazily as the iterator advances.
+func (c *Client) Messages(ctx context.Context, phoneNumber string) *MessageIterator {
+	return &MessageIterator{
+		ctx: ctx,
+		fetch: func(ctx context.Context, cursor string) (MessagePage, error) {
+			return c.GetUserMessagesPage(ctx, phoneNumber, PageOptions{Limit: iteratorPageSize, Cursor: cursor})
+		},
+	}
+}
+
+/* ---------- search ---------- */
+
+// Highlight is a rune-based match range within a snippet.
+type Highlight struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// SearchResult is returned by Search.
+type SearchResult struct {
+	Query    string `json:"query"`
+	Profiles []struct {
+		Profile      Profile     `json:"profile"`
+		MatchedField string      `json:"matchedField"`
+		Snippet      string      `json:"snippet"`
+		Highlights   []Highlight `json:"highlights"`
+	} `json:"profiles"`
+	Conversations []struct {
+		PhoneNumber   string    `json:"phoneNumber"`
+		Profile       *Profile  `json:"profile,omitempty"`
+		LastMatchedAt time.Time `json:"lastMatchedAt"`
+		Messages      []struct {
+			Message    Message     `json:"message"`
+			Snippet    string      `json:"snippet"`
+			Highlights []Highlight `json:"highlights"`
+		} `json:"messages"`
+	} `json:"conversations"`
+}
+
+// Search calls GET /v1/search. searchType is "all", "profiles" or "messages" ("" means all).
+func (c *Client) Search(ctx context.Context, query, searchType string, limit int) (SearchResult, error) {
+	q := url.Values{"q": {query}}
+	if searchType != "" {
+		q.Set("type", searchType)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result SearchResult
+	err := c.do(ctx, http.MethodGet, "/v1/search", q, nil, &result)
+	return result, err
+}
+
+/* ---------- messages (testing endpoints) ---------- */
+
+// CreateMessage calls POST /messages.
+func (c *Client) CreateMessage(ctx context.Context, req CreateMessageRequest) (Message, error) {
+	var msg Message
+	err := c.do(ctx, http.MethodPost, "/messages", nil, req, &msg)
+	return msg, err
+}
+
+// GetMessage calls GET /messages/{id}.
+func (c *Client) GetMessage(ctx context.Context, id string) (Message, error) {
+	var msg Message
+	err := c.do(ctx, http.MethodGet, messagePath(id), nil, nil, &msg)
+	return msg, err
+}
+
+// TagMessageParticipant calls PATCH /messages/{id}, tagging the message
+// with the participant participantID, or one derived from senderName when
+// it is empty. participantID "default" removes the tag.
+func (c *Client) TagMessageParticipant(ctx context.Context, id, participantID, senderName string) (Message, error) {
+	var msg Message
+	body := map[string]string{"participantId": participantID, "senderName": senderName}
+	err := c.do(ctx, http.MethodPatch, messagePath(id), nil, body, &msg)
+	return msg, err
+}
+
+// ForwardMessage calls POST /messages/{id}/forward, storing a message to
+// the number to with the text of message id.
+func (c *Client) ForwardMessage(ctx context.Context, id, to string) (Message, error) {
+	var msg Message
+	err := c.do(ctx, http.MethodPost, messagePath(id)+"/forward", nil, map[string]string{"to": to}, &msg)
+	return msg, err
+}
+
+// SetAnnotation calls POST /messages/{id}/annotations, setting source's
+// label on the message and replacing any the source set before. It returns
+// the message's annotations.
+func (c *Client) SetAnnotation(ctx context.Context, id, source, label string, confidence float64) ([]Annotation, error) {
+	var resp struct {
+		Annotations []Annotation `json:"annotations"`
+	}
+	body := map[string]any{"source": source, "label": label, "confidence": confidence}
+	err := c.do(ctx, http.MethodPost, messagePath(id)+"/annotations", nil, body, &resp)
+	return resp.Annotations, err
+}
+
+// ReviewAnnotation calls POST /messages/{id}/annotations/{source}/review,
+// recording reviewer's decision, "confirmed" or "rejected", on source's
+// annotation of the message. It returns the message's annotations.
+func (c *Client) ReviewAnnotation(ctx context.Context, id, source string, review AnnotationReview) ([]Annotation, error) {
+	var resp struct {
+		Annotations []Annotation `json:"annotations"`
+	}
+	body := map[string]string{"reviewer": review.Reviewer, "decision": review.Decision, "note": review.Note}
+	err := c.do(ctx, http.MethodPost, messagePath(id)+"/annotations/"+url.PathEscape(source)+"/review", nil, body, &resp)
+	return resp.Annotations, err
+}
+
+// SetTranslation calls PUT /messages/{id}/translations/{lang}, storing the
+// message's text translated into language. A language's translation is
+// only replaced with overwrite. It returns the message's translations.
+func (c *Client) SetTranslation(ctx context.Context, id, language, text string, overwrite bool) ([]Translation, error) {
+	var resp struct {
+		Translations []Translation `json:"translations"`
+	}
+	var q url.Values
+	if overwrite {
+		q = url.Values{"overwrite": {"true"}}
+	}
+	err := c.do(ctx, http.MethodPut, messagePath(id)+"/translations/"+url.PathEscape(language), q, map[string]string{"text": text}, &resp)
+	return resp.Translations, err
+}
+
+// GetTranslations calls GET /messages/{id}/translations, returning every
+// translation of the message.
+func (c *Client) GetTranslations(ctx context.Context, id string) ([]Translation, error) {
+	var resp struct {
+		Translations []Translation `json:"translations"`
+	}
+	err := c.do(ctx, http.MethodGet, messagePath(id)+"/translations", nil, nil, &resp)
+	return resp.Translations, err
+}
+
+// ListMessagesPage fetches one newest-first page of all messages.
+// Pass the previous page's Meta.NextCursor to continue.
+func (c *Client) ListMessagesPage(ctx context.Context, opts PageOptions) (MessagePage, error) {
+	var page MessagePage
+	err := c.do(ctx, http.MethodGet, "/messages", opts.values(), nil, &page)
+	return page, err
+}
+
+// ListMessages calls GET /messages, which returns only the newest messages
+// up to the server's cap. Use ListMessagesPage to read them all.
+func (c *Client) ListMessages(ctx context.Context) ([]Message, error) {
+	var messages []Message
+	if err := c.do(ctx, http.MethodGet, "/messages", nil, nil, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// DeleteAllMessages calls DELETE /messages.
+func (c *Client) DeleteAllMessages(ctx context.Context) (DeleteResult, error) {
+	var result DeleteResult
+	err := c.do(ctx, http.MethodDelete, "/messages", nil, nil, &result)
+	return result, err
+}
+
+// GetRefMessagesPage fetches one newest-first page of the messages carrying
+// an external reference, across conversations.
+func (c *Client) GetRefMessagesPage(ctx context.Context, ref ExternalRef, opts PageOptions) (MessagePage, error) {
+	var page MessagePage
+	err := c.do(ctx, http.MethodGet, refMessagesPath(ref), opts.values(), nil, &page)
+	return page, err
+}
+
+/* ---------- profiles ---------- */
+
+// GetProfile calls GET /v1/profile/{phoneNumber}.
+func (c *Client) GetProfile(ctx context.Context, phoneNumber string) (Profile, error) {
+	var profile Profile
+	err := c.do(ctx, http.MethodGet, profilePath(phoneNumber), nil, nil, &profile)
+	return profile, err
+}
+
+// CreateProfile calls POST /v1/profile.
+func (c *Client) CreateProfile(ctx context.Context, profile Profile) (Profile, error) {
+	profile.Self = "" // Read-only; the server's strict decoding of /v1 bodies rejects it
+	var created Profile
+	err := c.do(ctx, http.MethodPost, "/v1/profile", nil, profile, &created)
+	return created, err
+}
+
+// UpdateProfile calls PUT /v1/profile/{phoneNumber}.
+func (c *Client) UpdateProfile(ctx context.Context, phoneNumber string, profile Profile) (Profile, error) {
+	profile.Self = "" // Read-only, as in CreateProfile
+	var updated Profile
+	err := c.do(ctx, http.MethodPut, profilePath(phoneNumber), nil, profile, &updated)
+	return updated, err
+}
+
+/* ---------- paths ---------- */
+
+// iteratorPageSize is the page size iterators request from the server.
+const iteratorPageSize = 200
+
+func (o PageOptions) values() url.Values {
+	q := url.Values{}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	} else {
+		// limit must be present for the server to return the paginated form
+		q.Set("limit", strconv.Itoa(iteratorPageSize))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	if o.SenderID != "" {
+		q.Set("senderId", o.SenderID)
+	}
+	if o.Participant != "" {
+		q.Set("participant", o.Participant)
+	}
+	if o.IncludeParticipants {
+		q.Set("includeParticipants", "true")
+	}
+	if o.Annotation != "" {
+		q.Set("annotation", o.Annotation)
+		if o.MinConfidence > 0 {
+			q.Set("minConfidence", strconv.FormatFloat(o.MinConfidence, 'g', -1, 64))
+		}
+	}
+	if o.IncludeAnnotations {
+		q.Set("includeAnnotations", "true")
+	}
+	if len(o.IncludeTranslations) > 0 {
+		q.Set("includeTranslations", strings.Join(o.IncludeTranslations, ","))
+	}
+	if o.IncludeTotal {
+		q.Set("includeTotal", "true")
+	}
+	return q
+}
+
+func userMessagesPath(phoneNumber string) string {
+	return "/v1/user/" + url.PathEscape(phoneNumber) + "/messages"
+}
+
+func messagePath(id string) string {
+	return "/messages/" + url.PathEscape(id)
+}
+
+func refMessagesPath(ref ExternalRef) string {
+	return "/v1/refs/" + url.PathEscape(ref.Type) + "/" + url.PathEscape(ref.ID) + "/messages"
+}
+
+func profilePath(phoneNumber string) string {
+	return "/v1/profile/" + url.PathEscape(phoneNumber)
+}
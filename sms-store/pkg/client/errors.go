@@ -0,0 +1,84 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Error codes returned by the server in the error envelope.
+const (
+	CodeBadRequest           = "BAD_REQUEST"
+	CodeNotFound             = "NOT_FOUND"
+	CodeConversationNotFound = "CONVERSATION_NOT_FOUND"
+	CodeConflict             = "CONFLICT"
+	CodeInternal             = "INTERNAL"
+)
+
+// Sentinel errors that an *APIError matches via errors.Is.
+var (
+	ErrBadRequest = errors.New("bad request")
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrInternal   = errors.New("internal server error")
+)
+
+// APIError is returned for any non-2xx response from the server.
+type APIError struct {
+	StatusCode int    // HTTP status code
+	Code       string // Server error code, e.g. NOT_FOUND
+	Message    string // Human readable message from the server
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("sms-store: HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("sms-store: %s (HTTP %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// Is lets callers use errors.Is(err, client.ErrNotFound) and friends.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.Code == CodeBadRequest || (e.Code == "" && e.StatusCode == http.StatusBadRequest)
+	case ErrNotFound:
+		return e.Code == CodeNotFound || e.Code == CodeConversationNotFound || (e.Code == "" && e.StatusCode == http.StatusNotFound)
+	case ErrConflict:
+		return e.Code == CodeConflict || (e.Code == "" && e.StatusCode == http.StatusConflict)
+	case ErrInternal:
+		return e.Code == CodeInternal || (e.Code == "" && e.StatusCode >= 500)
+	}
+	return false
+}
+
+// decodeAPIError reads the error envelope from a failed response and closes its body.
+// Responses that are not JSON (e.g. plain-text "method not allowed") keep the raw body as the message.
+func decodeAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+		return apiErr
+	}
+
+	var envelope struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &envelope) == nil && envelope.Code != "" {
+		apiErr.Code = envelope.Code
+		apiErr.Message = envelope.Message
+		return apiErr
+	}
+
+	apiErr.Message = string(data)
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
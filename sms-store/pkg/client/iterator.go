@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"errors"
+)
+
+// MessageIterator walks messages page by page.
+//
+//	it := c.Messages(ctx, "9876543210")
+//	for it.Next() {
+//		msg := it.Message()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type MessageIterator struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, cursor string) (MessagePage, error)
+
+	page    []Message
+	index   int
+	cursor  string
+	started bool
+	done    bool
+	err     error
+}
+
+// errMissingCursor is the iterator's error when the server reports more
+// messages but no cursor to fetch them with.
+var errMissingCursor = errors.New("sms-store: page has more messages but no nextCursor")
+
+// Next advances to the next message, fetching pages as needed: each page
+// after the first is fetched with the previous page's nextCursor, until a
+// page has hasMore false. It returns false when iteration is done or an
+// error occurred.
+func (it *MessageIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	for it.index >= len(it.page) {
+		if it.started && it.done {
+			return false
+		}
+		if it.started && it.cursor == "" {
+			it.err = errMissingCursor
+			return false
+		}
+
+		page, err := it.fetch(it.ctx, it.cursor)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.started = true
+		it.page = page.Data
+		it.index = 0
+		it.cursor = page.Meta.NextCursor
+		it.done = !page.Meta.HasMore
+	}
+	return true
+}
+
+// Message returns the current message. Only valid after Next returned true.
+func (it *MessageIterator) Message() Message {
+	return it.page[it.index]
+}
+
+// Err returns the first error encountered during iteration.
+func (it *MessageIterator) Err() error {
+	return it.err
+}
@@ -16,6 +16,12 @@ NC='\033[0m' # No Color
 JAVA_SERVICE="http://localhost:8081"
 GO_SERVICE="http://localhost:8082"
 
+# Clearing all messages needs the Go service's admin scope
+ADMIN_API_KEY="${ADMIN_API_KEY:-}"
+
+# Reading messages needs a read key unless the service allows anonymous reads
+STORE_API_KEY="${STORE_API_KEY:-$ADMIN_API_KEY}"
+
 # Test user
 TEST_USER="1234567890"
 TEST_MESSAGE="Hello from E2E test"
@@ -69,7 +75,7 @@ wait_for_kafka() {
 test_clear_messages() {
     print_header "Step 1: Clear All Messages"
     
-    response=$(curl -s -X DELETE "$GO_SERVICE/messages")
+    response=$(curl -s -X DELETE -H "Authorization: Bearer $ADMIN_API_KEY" "$GO_SERVICE/messages")
     if echo "$response" | grep -q "deletedCount"; then
         deleted_count=$(echo "$response" | grep -o '"deletedCount":[0-9]*' | grep -o '[0-9]*')
         print_success "Cleared $deleted_count messages from database"
@@ -159,7 +165,7 @@ test_verify_message_stored() {
     
     wait_for_kafka
     
-    response=$(curl -s "$GO_SERVICE/v1/user/$TEST_USER/messages")
+    response=$(curl -s -H "Authorization: Bearer $STORE_API_KEY" "$GO_SERVICE/v1/user/$TEST_USER/messages")
     
     if echo "$response" | grep -q "$TEST_MESSAGE"; then
         message_count=$(echo "$response" | grep -o '"id"' | wc -l)
@@ -252,7 +258,7 @@ test_multiple_messages() {
     
     wait_for_kafka
     
-    response=$(curl -s "$GO_SERVICE/v1/user/$TEST_USER/messages")
+    response=$(curl -s -H "Authorization: Bearer $STORE_API_KEY" "$GO_SERVICE/v1/user/$TEST_USER/messages")
     message_count=$(echo "$response" | grep -o '"id"' | wc -l)
     
     if [ "$message_count" -ge 3 ]; then